@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accountInfo é o subconjunto usado da resposta de /api/v3/account
+type accountInfo struct {
+	CanTrade    bool     `json:"canTrade"`
+	CanWithdraw bool     `json:"canWithdraw"`
+	CanDeposit  bool     `json:"canDeposit"`
+	UpdateTime  int64    `json:"updateTime"`
+	AccountType string   `json:"accountType"`
+	Permissions []string `json:"permissions"`
+	Balances    []struct {
+		Asset  string `json:"asset"`
+		Free   string `json:"free"`
+		Locked string `json:"locked"`
+	} `json:"balances"`
+}
+
+type accountBalanceValue struct {
+	Asset  string `json:"asset"`
+	Free   string `json:"free"`
+	Locked string `json:"locked"`
+	Total  string `json:"total"`
+	Price  string `json:"price,omitempty"`
+	Value  string `json:"value,omitempty"`
+	value  float64
+}
+
+// formatAmount formata um valor do resumo com no máximo 8 casas decimais (a
+// precisão dos saldos da Binance), sem o ruído das multiplicações por preço
+func formatAmount(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1e8)/1e8, 'f', -1, 64)
+}
+
+// AccountSummary combina conta, ordens abertas e preços em uma única resposta
+// @Summary Resumo da conta
+// @Description Combina /account, /openOrders e o cache de preços com avaliação por ativo e patrimônio total (requer token de tenant)
+// @Tags Account
+// @Produce json
+// @Param quote query string false "Moeda de avaliação (padrão USDT)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /local/account/summary [get]
+func (p *ProxyServer) AccountSummary(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+	quote := normalizeAsset(c.DefaultQuery("quote", defaultPortfolioQuote))
+	ctx := c.Request.Context()
+
+	// Buscar conta, ordens abertas e preços em paralelo
+	var (
+		wg                    sync.WaitGroup
+		accountBody           []byte
+		ordersBody            []byte
+		prices                map[string]float64
+		accountErr, ordersErr error
+		pricesErr             error
+	)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		accountBody, accountErr = p.signedRequest(ctx, tenant, http.MethodGet, "/api/v3/account", nil)
+	}()
+	go func() {
+		defer wg.Done()
+		ordersBody, ordersErr = p.signedRequest(ctx, tenant, http.MethodGet, "/api/v3/openOrders", nil)
+	}()
+	go func() {
+		defer wg.Done()
+		prices, pricesErr = p.market.Prices(ctx)
+	}()
+	wg.Wait()
+
+	for _, err := range []error{accountErr, ordersErr} {
+		if err != nil {
+			respondUpstreamError(c, err)
+			return
+		}
+	}
+	if pricesErr != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter preços da Binance: "+pricesErr.Error())
+		return
+	}
+
+	var account accountInfo
+	if err := json.Unmarshal(accountBody, &account); err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Resposta inválida de /account: "+err.Error())
+		return
+	}
+	var openOrders []json.RawMessage
+	if err := json.Unmarshal(ordersBody, &openOrders); err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Resposta inválida de /openOrders: "+err.Error())
+		return
+	}
+
+	exists := func(symbol string) bool {
+		_, ok := prices[symbol]
+		return ok
+	}
+	price := func(symbol string) (float64, error) {
+		return prices[symbol], nil
+	}
+
+	balances := []*accountBalanceValue{}
+	unpriced := []string{}
+	equity := 0.0
+	for _, b := range account.Balances {
+		free, _ := strconv.ParseFloat(b.Free, 64)
+		locked, _ := strconv.ParseFloat(b.Locked, 64)
+		total := free + locked
+		if total == 0 {
+			continue
+		}
+
+		balance := &accountBalanceValue{
+			Asset:  b.Asset,
+			Free:   b.Free,
+			Locked: b.Locked,
+			Total:  formatAmount(total),
+		}
+		priced := false
+		for _, path := range findConversionPaths(exists, b.Asset, quote) {
+			if rate, err := conversionRate(path, price); err == nil {
+				balance.value = total * rate
+				balance.Price = formatAmount(rate)
+				balance.Value = formatAmount(balance.value)
+				equity += balance.value
+				priced = true
+				break
+			}
+		}
+		if !priced {
+			unpriced = append(unpriced, b.Asset)
+		}
+		balances = append(balances, balance)
+	}
+	sort.SliceStable(balances, func(i, j int) bool {
+		return balances[i].value > balances[j].value
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":          tenant.Name,
+		"quote":           quote,
+		"totalEquity":     formatAmount(equity),
+		"balances":        balances,
+		"unpriced":        unpriced,
+		"openOrders":      openOrders,
+		"openOrdersCount": len(openOrders),
+		"canTrade":        account.CanTrade,
+		"canWithdraw":     account.CanWithdraw,
+		"canDeposit":      account.CanDeposit,
+		"accountType":     account.AccountType,
+		"permissions":     account.Permissions,
+		"updateTime":      account.UpdateTime,
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestFormatFloatKeepsPrecision(t *testing.T) {
+	for value, want := range map[float64]string{
+		0.123456789: "0.123456789",
+		1e-10:       "0.0000000001",
+		1234.5:      "1234.5",
+		3:           "3",
+	} {
+		if got := formatFloat(value); got != want {
+			t.Errorf("formatFloat(%v) = %q, esperado %q", value, got, want)
+		}
+	}
+}
+
+func TestFormatAmountRoundsToEightDecimals(t *testing.T) {
+	for value, want := range map[float64]string{
+		0.1 + 0.2:   "0.3",
+		0.123456789: "0.12345679",
+		1e-10:       "0",
+		1234.5:      "1234.5",
+	} {
+		if got := formatAmount(value); got != want {
+			t.Errorf("formatAmount(%v) = %q, esperado %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth protege as rotas /admin com ADMIN_TOKEN (header X-Admin-Token ou
+// Authorization: Bearer). Sem ADMIN_TOKEN configurado, a API admin fica desabilitada.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			respondError(c, http.StatusForbidden, -1002, "API admin desabilitada (defina ADMIN_TOKEN)")
+			c.Abort()
+			return
+		}
+		given := c.GetHeader("X-Admin-Token")
+		if auth := c.GetHeader("Authorization"); given == "" && strings.HasPrefix(auth, "Bearer ") {
+			given = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			respondError(c, http.StatusUnauthorized, -1002, "Token admin inválido ou ausente")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
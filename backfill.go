@@ -0,0 +1,700 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	backfillsBucket = "backfills"
+	// Backfills executados ao mesmo tempo (BACKFILL_CONCURRENCY); os demais esperam na fila
+	defaultBackfillConcurrency = 2
+	backfillPageTimeout        = time.Minute
+	// Tentativas seguidas de uma página antes de o backfill falhar
+	backfillMaxAttempts = 6
+	backfillRetryWait   = 5 * time.Second
+)
+
+// Estados de um backfill
+const (
+	backfillQueued   = "queued"
+	backfillRunning  = "running"
+	backfillPaused   = "paused"
+	backfillDone     = "done"
+	backfillFailed   = "failed"
+	backfillCanceled = "canceled"
+)
+
+// backfillDatasets são os endpoints que um backfill sabe percorrer
+var backfillDatasets = map[string]string{
+	"klines":    "/klines",
+	"aggTrades": "/aggTrades",
+}
+
+// BackfillState é o estado gravado de um backfill: a definição e o ponto de
+// onde continuar. Cada página gravada no arquivo atualiza o checkpoint.
+type BackfillState struct {
+	ID       string `json:"id"`
+	Dataset  string `json:"dataset"`
+	Symbol   string `json:"symbol"`
+	Interval string `json:"interval,omitempty"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Status   string `json:"status"`
+	Created  int64  `json:"createdAt"`
+	Updated  int64  `json:"updatedAt"`
+	// Checkpoint: próximo startTime (klines, ou janela de aggTrades) e próximo
+	// fromId de aggTrades (-1 antes da primeira página)
+	Cursor int64 `json:"cursor"`
+	FromID int64 `json:"fromId"`
+	// Linhas e bytes já gravados no arquivo; na retomada, o que passar de
+	// Bytes (uma página gravada sem checkpoint) é descartado
+	Rows  int64 `json:"rows"`
+	Bytes int64 `json:"bytes"`
+	// Instante do último dado gravado
+	Position int64  `json:"position"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BackfillStatus é o backfill em /jobs, com o progresso e a estimativa de término
+type BackfillStatus struct {
+	BackfillState
+	File string `json:"file"`
+	// Fração do intervalo [start, end] já percorrida (0 a 1)
+	Progress float64 `json:"progress"`
+	// Tempo restante estimado pelo ritmo desde que a execução (re)começou
+	ETASeconds    *int64  `json:"etaSeconds"`
+	RowsPerSecond float64 `json:"rowsPerSecond"`
+}
+
+type backfillJob struct {
+	mu     sync.Mutex
+	state  BackfillState
+	cancel context.CancelFunc
+	// Motivo da interrupção (paused/canceled); vazio no encerramento do
+	// proxy, que mantém o estado para a retomada
+	stop string
+	// Ritmo da execução atual, para a estimativa de término
+	runStart    time.Time
+	runPosition int64
+	runRows     int64
+}
+
+// BackfillManager executa os backfills: percorre /klines ou /aggTrades de
+// um intervalo longo em páginas de 1000, gravando as linhas em NDJSON e o
+// checkpoint no armazenamento local, de onde os backfills inacabados são
+// retomados quando o proxy reinicia. As chamadas usam prioridade baixa no
+// agendador de peso e aparecem como backfill:<id> em /ratelimit/status.
+type BackfillManager struct {
+	proxy *ProxyServer
+	store *Store
+	dir   string
+	slots chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]*backfillJob
+	wg   sync.WaitGroup
+}
+
+// NewBackfillManager carrega os backfills gravados; os arquivos ficam em dir
+func NewBackfillManager(proxy *ProxyServer, store *Store, dir string, concurrency int) (*BackfillManager, error) {
+	m := &BackfillManager{
+		proxy: proxy,
+		store: store,
+		dir:   dir,
+		slots: make(chan struct{}, max(1, concurrency)),
+		jobs:  map[string]*backfillJob{},
+	}
+	err := store.ForEach(backfillsBucket, func(key string, data []byte) error {
+		var state BackfillState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("backfill %s: %w", key, err)
+		}
+		m.jobs[state.ID] = &backfillJob{state: state}
+		return nil
+	})
+	return m, err
+}
+
+// Start retoma os backfills que estavam na fila ou em execução
+func (m *BackfillManager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		if job.state.Status == backfillQueued || job.state.Status == backfillRunning {
+			m.launch(job)
+		}
+	}
+}
+
+// Close interrompe as execuções, mantendo o checkpoint para a retomada
+func (m *BackfillManager) Close() {
+	m.mu.Lock()
+	for _, job := range m.jobs {
+		job.mu.Lock()
+		if job.cancel != nil {
+			job.cancel()
+		}
+		job.mu.Unlock()
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+// launch põe o backfill na fila de execução. Chamado com m.mu.
+func (m *BackfillManager) launch(job *backfillJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job.mu.Lock()
+	job.cancel, job.stop = cancel, ""
+	job.state.Status = backfillQueued
+	job.state.Error = ""
+	job.mu.Unlock()
+	m.save(job)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		select {
+		case m.slots <- struct{}{}:
+		case <-ctx.Done():
+			m.stopped(job)
+			return
+		}
+		defer func() { <-m.slots }()
+		m.run(ctx, job)
+	}()
+}
+
+// save grava o estado do backfill
+func (m *BackfillManager) save(job *backfillJob) {
+	job.mu.Lock()
+	job.state.Updated = time.Now().UnixMilli()
+	state := job.state
+	job.mu.Unlock()
+	if err := m.store.Put(backfillsBucket, state.ID, state); err != nil {
+		// log.Printf("[WARN] Erro ao gravar checkpoint do backfill %s: %v", state.ID, err)
+	}
+}
+
+// stopped registra a interrupção pedida (pausa ou cancelamento); no
+// encerramento do proxy o estado fica como estava
+func (m *BackfillManager) stopped(job *backfillJob) {
+	job.mu.Lock()
+	stop := job.stop
+	if stop != "" {
+		job.state.Status = stop
+	}
+	job.mu.Unlock()
+	if stop == backfillPaused {
+		m.save(job)
+	}
+}
+
+func (m *BackfillManager) file(id string) string {
+	return filepath.Join(m.dir, id+".ndjson")
+}
+
+// run percorre as páginas a partir do checkpoint até o fim do intervalo
+func (m *BackfillManager) run(ctx context.Context, job *backfillJob) {
+	job.mu.Lock()
+	job.state.Status = backfillRunning
+	job.runStart, job.runPosition, job.runRows = time.Now(), job.state.Position, job.state.Rows
+	state := job.state
+	job.mu.Unlock()
+	m.save(job)
+
+	fail := func(err error) {
+		job.mu.Lock()
+		job.state.Status, job.state.Error = backfillFailed, redactSecrets(err.Error())
+		job.mu.Unlock()
+		m.save(job)
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		fail(err)
+		return
+	}
+	f, err := os.OpenFile(m.file(state.ID), os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer f.Close()
+	// Descarta uma página gravada depois do último checkpoint
+	if err := f.Truncate(state.Bytes); err != nil {
+		fail(err)
+		return
+	}
+	if _, err := f.Seek(state.Bytes, 0); err != nil {
+		fail(err)
+		return
+	}
+
+	ctx = withConsumer(withPriority(ctx, PriorityLow), "backfill:"+state.ID)
+	// Cada página passa pelo planejador, que segura o backfill quando o peso
+	// da classe baixa chega à margem de segurança
+	weight := requestWeight(http.MethodGet, backfillDatasets[state.Dataset], nil)
+	for {
+		var rows []json.RawMessage
+		var next BackfillState
+		var done bool
+		for attempt := 1; ; attempt++ {
+			var release func()
+			if release, err = m.proxy.planner.Wait(ctx, weight); err != nil {
+				break
+			}
+			rows, next, done, err = m.page(ctx, state)
+			release()
+			if err == nil || ctx.Err() != nil || attempt == backfillMaxAttempts || !retryableBackfillError(err) {
+				break
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(backfillRetryWait * time.Duration(attempt)):
+			}
+		}
+		if ctx.Err() != nil {
+			m.stopped(job)
+			return
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		if len(rows) > 0 {
+			var buf []byte
+			for _, row := range rows {
+				buf = append(buf, row...)
+				buf = append(buf, '\n')
+			}
+			if _, err := f.Write(buf); err == nil {
+				err = f.Sync()
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+			next.Rows += int64(len(rows))
+			next.Bytes += int64(len(buf))
+		}
+		if done {
+			next.Status = backfillDone
+		}
+		job.mu.Lock()
+		job.state = next
+		job.mu.Unlock()
+		m.save(job)
+		if done {
+			return
+		}
+		state = next
+	}
+}
+
+// retryableBackfillError indica falhas passageiras (conexão, 5xx, limites
+// de peso), que são tentadas de novo com espera crescente
+func retryableBackfillError(err error) bool {
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr.StatusCode >= 500 || upstreamErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// page busca a próxima página a partir do checkpoint, retornando as linhas
+// (até o fim do intervalo), o novo checkpoint e se o backfill terminou
+func (m *BackfillManager) page(ctx context.Context, state BackfillState) ([]json.RawMessage, BackfillState, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, backfillPageTimeout)
+	defer cancel()
+	endpoint := backfillDatasets[state.Dataset]
+	query := url.Values{"symbol": {state.Symbol}, "limit": {strconv.Itoa(klinesPageLimit)}}
+
+	if state.Dataset == "klines" {
+		query.Set("interval", state.Interval)
+		query.Set("startTime", strconv.FormatInt(state.Cursor, 10))
+		query.Set("endTime", strconv.FormatInt(state.End, 10))
+		rows, err := m.proxy.fetchRows(ctx, endpoint, query, "")
+		if err != nil || len(rows) == 0 {
+			return nil, state, err == nil, err
+		}
+		var last []json.RawMessage
+		if err := json.Unmarshal(rows[len(rows)-1], &last); err != nil || len(last) == 0 {
+			return nil, state, false, fmt.Errorf("kline inválido: %s", rows[len(rows)-1])
+		}
+		openTime, _ := strconv.ParseInt(string(last[0]), 10, 64)
+		state.Cursor, state.Position = openTime+1, openTime
+		return rows, state, len(rows) < klinesPageLimit || state.Cursor > state.End, nil
+	}
+
+	// aggTrades: antes do primeiro trade, janelas de 1h a partir do cursor
+	// (o limite da Binance para startTime/endTime); depois, por fromId
+	if state.FromID < 0 {
+		windowEnd := min64(state.Cursor+aggTradesWindow.Milliseconds()-1, state.End)
+		query.Set("startTime", strconv.FormatInt(state.Cursor, 10))
+		query.Set("endTime", strconv.FormatInt(windowEnd, 10))
+	} else {
+		query.Set("fromId", strconv.FormatInt(state.FromID, 10))
+	}
+	rows, err := m.proxy.fetchRows(ctx, endpoint, query, "")
+	if err != nil {
+		return nil, state, false, err
+	}
+	if len(rows) == 0 {
+		if state.FromID >= 0 {
+			// Fim do histórico
+			return nil, state, true, nil
+		}
+		state.Cursor += aggTradesWindow.Milliseconds()
+		state.Position = state.Cursor - 1
+		return nil, state, state.Cursor > state.End, nil
+	}
+	done := state.FromID >= 0 && len(rows) < klinesPageLimit
+	for i, row := range rows {
+		if rowField(row, "T") > state.End {
+			rows, done = rows[:i], true
+			break
+		}
+	}
+	if len(rows) > 0 {
+		last := rows[len(rows)-1]
+		state.FromID, state.Position = rowField(last, "a")+1, rowField(last, "T")
+	}
+	return rows, state, done, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// status monta a visão do backfill com o progresso e a estimativa de término
+func (m *BackfillManager) status(job *backfillJob) BackfillStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	s := BackfillStatus{BackfillState: job.state, File: m.file(job.state.ID)}
+	if span := s.End - s.Start; span > 0 {
+		s.Progress = float64(max(s.Position-s.Start+1, 0)) / float64(span)
+		if s.Status == backfillDone || s.Progress > 1 {
+			s.Progress = 1
+		}
+		s.Progress = float64(int64(s.Progress*1e4)) / 1e4
+	}
+	if s.Status == backfillRunning {
+		elapsed := time.Since(job.runStart).Seconds()
+		covered := s.Position - job.runPosition
+		if elapsed > 0 {
+			s.RowsPerSecond = float64(int64(float64(s.Rows-job.runRows)/elapsed*100)) / 100
+		}
+		if elapsed > 0 && covered > 0 {
+			eta := int64(float64(s.End-s.Position) / (float64(covered) / elapsed))
+			s.ETASeconds = &eta
+		}
+	}
+	return s
+}
+
+// backfillRequest é o corpo de POST /jobs
+type backfillRequest struct {
+	Dataset  string `json:"dataset"`
+	Symbol   string `json:"symbol"`
+	Interval string `json:"interval"`
+	// ms ou RFC3339; end vazio = agora
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// requireBackfills responde 503 sem o armazenamento local
+func (p *ProxyServer) requireBackfills(c *gin.Context) bool {
+	if p.backfills == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Backfills indisponíveis: requerem o armazenamento local (DATA_DIR)")
+		return false
+	}
+	return true
+}
+
+// loadBackfill busca o backfill do path, respondendo 404 se não existir
+func (p *ProxyServer) loadBackfill(c *gin.Context) (*backfillJob, bool) {
+	if !p.requireBackfills(c) {
+		return nil, false
+	}
+	p.backfills.mu.Lock()
+	job, ok := p.backfills.jobs[c.Param("id")]
+	p.backfills.mu.Unlock()
+	if !ok {
+		respondError(c, http.StatusNotFound, -1000, "Backfill não encontrado: "+c.Param("id"))
+		return nil, false
+	}
+	return job, true
+}
+
+// CreateBackfill cria um backfill
+// @Summary Criar backfill
+// @Description Percorre /klines ou /aggTrades de um intervalo longo (anos) em segundo plano, gravando as linhas em NDJSON com checkpoint a cada página. Sobrevive a reinícios e usa prioridade baixa no agendador de peso.
+// @Tags Jobs
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param body body backfillRequest true "dataset (klines ou aggTrades), symbol, interval (klines), start e end"
+// @Success 201 {object} BackfillStatus
+// @Failure 400 {object} map[string]interface{}
+// @Router /jobs [post]
+func (p *ProxyServer) CreateBackfill(c *gin.Context) {
+	if !p.requireBackfills(c) {
+		return
+	}
+	var req backfillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "Corpo inválido: "+err.Error())
+		return
+	}
+	if _, ok := backfillDatasets[req.Dataset]; !ok {
+		respondError(c, http.StatusBadRequest, -1100, "Campo 'dataset' deve ser klines ou aggTrades")
+		return
+	}
+	symbols, err := normalizeSymbols([]string{req.Symbol})
+	if err != nil || len(symbols) != 1 {
+		respondError(c, http.StatusBadRequest, -1100, "Campo 'symbol' inválido")
+		return
+	}
+	if req.Dataset == "klines" {
+		if _, ok := klineIntervals[req.Interval]; !ok {
+			respondError(c, http.StatusBadRequest, -1100, "Campo 'interval' inválido: "+req.Interval)
+			return
+		}
+	} else {
+		req.Interval = ""
+	}
+	start, ok := parseHistoryTime(req.Start)
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1100, "Campo 'start' inválido (use ms ou RFC3339)")
+		return
+	}
+	end := time.Now().UnixMilli()
+	if req.End != "" {
+		if end, ok = parseHistoryTime(req.End); !ok {
+			respondError(c, http.StatusBadRequest, -1100, "Campo 'end' inválido (use ms ou RFC3339)")
+			return
+		}
+	}
+	if start >= end {
+		respondError(c, http.StatusBadRequest, -1100, "'start' deve ser anterior a 'end'")
+		return
+	}
+
+	var id [8]byte
+	rand.Read(id[:])
+	job := &backfillJob{state: BackfillState{
+		ID:       hex.EncodeToString(id[:]),
+		Dataset:  req.Dataset,
+		Symbol:   symbols[0],
+		Interval: req.Interval,
+		Start:    start,
+		End:      end,
+		Created:  time.Now().UnixMilli(),
+		Cursor:   start,
+		FromID:   -1,
+		Position: start - 1,
+	}}
+	m := p.backfills
+	m.mu.Lock()
+	m.jobs[job.state.ID] = job
+	m.launch(job)
+	m.mu.Unlock()
+	c.JSON(http.StatusCreated, m.status(job))
+}
+
+// ListBackfills lista os backfills
+// @Summary Backfills
+// @Description Lista os backfills, do mais recente ao mais antigo, com progresso e estimativa de término
+// @Tags Jobs
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /jobs [get]
+func (p *ProxyServer) ListBackfills(c *gin.Context) {
+	if !p.requireBackfills(c) {
+		return
+	}
+	m := p.backfills
+	m.mu.Lock()
+	jobs := make([]BackfillStatus, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, m.status(job))
+	}
+	m.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created > jobs[j].Created })
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// GetBackfill mostra um backfill
+// @Summary Backfill
+// @Description Estado, checkpoint, progresso e estimativa de término (etaSeconds) do backfill
+// @Tags Jobs
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param id path string true "ID do backfill"
+// @Success 200 {object} BackfillStatus
+// @Failure 404 {object} map[string]interface{}
+// @Router /jobs/{id} [get]
+func (p *ProxyServer) GetBackfill(c *gin.Context) {
+	if job, ok := p.loadBackfill(c); ok {
+		c.JSON(http.StatusOK, p.backfills.status(job))
+	}
+}
+
+// BackfillData baixa as linhas já gravadas
+// @Summary Dados do backfill
+// @Description Linhas já gravadas pelo backfill, em NDJSON (uma linha da Binance por linha)
+// @Tags Jobs
+// @Produce application/x-ndjson
+// @Param X-Admin-Token header string true "Token admin"
+// @Param id path string true "ID do backfill"
+// @Success 200 {string} string
+// @Failure 404 {object} map[string]interface{}
+// @Router /jobs/{id}/data [get]
+func (p *ProxyServer) BackfillData(c *gin.Context) {
+	job, ok := p.loadBackfill(c)
+	if !ok {
+		return
+	}
+	job.mu.Lock()
+	size := job.state.Bytes
+	job.mu.Unlock()
+	f, err := os.Open(p.backfills.file(c.Param("id")))
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.Data(http.StatusOK, ndjsonContentType, nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao abrir os dados do backfill: "+err.Error())
+		return
+	}
+	defer f.Close()
+	// Só o que já tem checkpoint: uma página sendo gravada fica de fora
+	c.DataFromReader(http.StatusOK, size, ndjsonContentType, io.LimitReader(f, size), nil)
+}
+
+// PauseBackfill pausa um backfill
+// @Summary Pausar backfill
+// @Tags Jobs
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param id path string true "ID do backfill"
+// @Success 200 {object} BackfillStatus
+// @Failure 409 {object} map[string]interface{}
+// @Router /jobs/{id}/pause [post]
+func (p *ProxyServer) PauseBackfill(c *gin.Context) {
+	job, ok := p.loadBackfill(c)
+	if !ok {
+		return
+	}
+	job.mu.Lock()
+	active := job.state.Status == backfillQueued || job.state.Status == backfillRunning
+	if active {
+		job.stop = backfillPaused
+		job.cancel()
+	}
+	job.mu.Unlock()
+	if !active {
+		respondError(c, http.StatusConflict, -1000, "O backfill não está na fila nem em execução")
+		return
+	}
+	waitBackfillStop(job)
+	c.JSON(http.StatusOK, p.backfills.status(job))
+}
+
+// ResumeBackfill retoma um backfill pausado ou que falhou
+// @Summary Retomar backfill
+// @Description Retoma do último checkpoint um backfill pausado ou que falhou
+// @Tags Jobs
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param id path string true "ID do backfill"
+// @Success 200 {object} BackfillStatus
+// @Failure 409 {object} map[string]interface{}
+// @Router /jobs/{id}/resume [post]
+func (p *ProxyServer) ResumeBackfill(c *gin.Context) {
+	job, ok := p.loadBackfill(c)
+	if !ok {
+		return
+	}
+	m := p.backfills
+	m.mu.Lock()
+	job.mu.Lock()
+	status := job.state.Status
+	job.mu.Unlock()
+	if status == backfillPaused || status == backfillFailed {
+		m.launch(job)
+	}
+	m.mu.Unlock()
+	if status != backfillPaused && status != backfillFailed {
+		respondError(c, http.StatusConflict, -1000, "Só backfills pausados ou que falharam podem ser retomados")
+		return
+	}
+	c.JSON(http.StatusOK, m.status(job))
+}
+
+// DeleteBackfill cancela o backfill e apaga os dados gravados
+// @Summary Cancelar backfill
+// @Description Interrompe o backfill e apaga o checkpoint e o arquivo NDJSON
+// @Tags Jobs
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param id path string true "ID do backfill"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /jobs/{id} [delete]
+func (p *ProxyServer) DeleteBackfill(c *gin.Context) {
+	job, ok := p.loadBackfill(c)
+	if !ok {
+		return
+	}
+	m := p.backfills
+	job.mu.Lock()
+	job.stop = backfillCanceled
+	if job.cancel != nil {
+		job.cancel()
+	}
+	job.mu.Unlock()
+	waitBackfillStop(job)
+
+	m.mu.Lock()
+	delete(m.jobs, job.state.ID)
+	m.mu.Unlock()
+	if _, err := m.store.Delete(backfillsBucket, job.state.ID); err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao apagar o backfill: "+err.Error())
+		return
+	}
+	os.Remove(m.file(job.state.ID))
+	c.JSON(http.StatusOK, gin.H{"id": job.state.ID, "status": backfillCanceled})
+}
+
+// waitBackfillStop espera a execução interrompida deixar a fila ou a página atual
+func waitBackfillStop(job *backfillJob) {
+	for i := 0; i < 100; i++ {
+		job.mu.Lock()
+		status := job.state.Status
+		job.mu.Unlock()
+		if status != backfillQueued && status != backfillRunning {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Políticas para o assinante cujo buffer encheu (consumidor lento)
+const (
+	// A mensagem nova é descartada (comportamento original)
+	slowDropNewest = "drop-newest"
+	// A mensagem mais antiga do buffer sai para dar lugar à nova
+	slowDropOldest = "drop-oldest"
+	// O buffer guarda só a última mensagem de cada stream: para tickers e
+	// bookTicker, que trazem o estado completo, o cliente perde só os
+	// estados intermediários
+	slowConflate = "conflate"
+	// O cliente é desconectado
+	slowDisconnect = "disconnect"
+)
+
+var slowConsumerPolicies = map[string]bool{
+	slowDropNewest: true,
+	slowDropOldest: true,
+	slowConflate:   true,
+	slowDisconnect: true,
+}
+
+type slowConsumerRule struct {
+	pattern string
+	policy  string
+}
+
+type slowConsumerKey struct {
+	stream string
+	policy string
+}
+
+// SlowConsumerPolicies escolhe, por padrão de nome de stream (ex:
+// *@bookTicker=conflate), o que fazer com os clientes que não acompanham o
+// stream, e conta as mensagens descartadas e as desconexões.
+type SlowConsumerPolicies struct {
+	fallback string
+	rules    []slowConsumerRule
+
+	mu          sync.Mutex
+	dropped     map[slowConsumerKey]uint64
+	disconnects map[string]uint64
+}
+
+// ParseSlowConsumerPolicies lê a lista "padrão=política" separada por
+// vírgula. Os padrões seguem path.Match sobre o nome do stream; vale o
+// primeiro que casar e, sem nenhum, fallback.
+func ParseSlowConsumerPolicies(fallback, spec string) (*SlowConsumerPolicies, error) {
+	fallback = strings.TrimSpace(fallback)
+	if fallback == "" {
+		fallback = slowDropNewest
+	}
+	if !slowConsumerPolicies[fallback] {
+		return nil, fmt.Errorf("política inválida: %q (use drop-newest, drop-oldest, conflate ou disconnect)", fallback)
+	}
+	s := newSlowConsumerPolicies(fallback)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, policy, ok := strings.Cut(entry, "=")
+		pattern, policy = strings.TrimSpace(pattern), strings.TrimSpace(policy)
+		if !ok || !slowConsumerPolicies[policy] {
+			return nil, fmt.Errorf("política de consumidor lento inválida: %q (use stream=drop-newest|drop-oldest|conflate|disconnect)", entry)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("padrão inválido %q: %w", pattern, err)
+		}
+		s.rules = append(s.rules, slowConsumerRule{pattern: pattern, policy: policy})
+	}
+	return s, nil
+}
+
+func newSlowConsumerPolicies(fallback string) *SlowConsumerPolicies {
+	return &SlowConsumerPolicies{
+		fallback:    fallback,
+		dropped:     map[slowConsumerKey]uint64{},
+		disconnects: map[string]uint64{},
+	}
+}
+
+// For retorna a política do stream
+func (s *SlowConsumerPolicies) For(stream string) string {
+	for _, rule := range s.rules {
+		if ok, _ := path.Match(rule.pattern, stream); ok {
+			return rule.policy
+		}
+	}
+	return s.fallback
+}
+
+func (s *SlowConsumerPolicies) drop(stream, policy string, n int) {
+	if n <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.dropped[slowConsumerKey{stream, policy}] += uint64(n)
+	s.mu.Unlock()
+}
+
+func (s *SlowConsumerPolicies) disconnect(stream string) {
+	s.mu.Lock()
+	s.disconnects[stream]++
+	s.mu.Unlock()
+}
+
+// overflow aplica a política ao assinante com o buffer cheio. Chamado por
+// quem entrega as mensagens, um de cada vez por assinatura.
+func (s *SlowConsumerPolicies) overflow(sub *Subscription, msg StreamMessage) bool {
+	policy := s.For(msg.Stream)
+	switch policy {
+	case slowDropOldest:
+		select {
+		case old := <-sub.ch:
+			s.drop(old.Stream, policy, 1)
+		default:
+		}
+		select {
+		case sub.ch <- msg:
+			return true
+		default:
+			s.drop(msg.Stream, policy, 1)
+			return false
+		}
+
+	case slowConflate:
+		// Esvazia o buffer e devolve só a última mensagem de cada stream,
+		// na ordem em que chegaram; a nova substitui a do seu stream
+		var pending []StreamMessage
+		for drained := false; !drained; {
+			select {
+			case old := <-sub.ch:
+				pending = append(pending, old)
+			default:
+				drained = true
+			}
+		}
+		pending = append(pending, msg)
+		latest := make(map[string]int, len(pending))
+		for i, m := range pending {
+			latest[m.Stream] = i
+		}
+		for i, m := range pending {
+			if latest[m.Stream] != i {
+				s.drop(m.Stream, policy, 1)
+				continue
+			}
+			select {
+			case sub.ch <- m:
+			default:
+				s.drop(m.Stream, policy, 1)
+			}
+		}
+		return true
+
+	case slowDisconnect:
+		s.drop(msg.Stream, policy, 1)
+		s.disconnect(msg.Stream)
+		sub.disconnect()
+		return false
+	}
+	s.drop(msg.Stream, policy, 1)
+	return false
+}
+
+// writeMetrics escreve os descartes e as desconexões por stream
+func (s *SlowConsumerPolicies) writeMetrics(m *metricsWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]slowConsumerKey, 0, len(s.dropped))
+	for key := range s.dropped {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].stream != keys[j].stream {
+			return keys[i].stream < keys[j].stream
+		}
+		return keys[i].policy < keys[j].policy
+	})
+	m.family("proxy_stream_dropped_messages_total", "counter", "Mensagens de stream descartadas para clientes lentos, por política")
+	for _, key := range keys {
+		m.sample("proxy_stream_dropped_messages_total", float64(s.dropped[key]), "stream", key.stream, "policy", key.policy)
+	}
+	streams := make([]string, 0, len(s.disconnects))
+	for stream := range s.disconnects {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	m.family("proxy_stream_slow_disconnects_total", "counter", "Clientes desconectados por não acompanharem o stream")
+	for _, stream := range streams {
+		m.sample("proxy_stream_slow_disconnects_total", float64(s.disconnects[stream]), "stream", stream)
+	}
+}
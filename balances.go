@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const balanceSnapshotEvent = "snapshot"
+
+// outboundAccountPosition é o evento de saldos alterados do user data stream
+type outboundAccountPosition struct {
+	EventType      string `json:"e"`
+	EventTime      int64  `json:"E"`
+	LastUpdateTime int64  `json:"u"`
+	Balances       []struct {
+		Asset  string `json:"a"`
+		Free   string `json:"f"`
+		Locked string `json:"l"`
+	} `json:"B"`
+}
+
+// BalanceEntry é o saldo de um ativo no formato estável enviado aos clientes
+type BalanceEntry struct {
+	Asset  string `json:"asset"`
+	Free   string `json:"free"`
+	Locked string `json:"locked"`
+	Total  string `json:"total"`
+}
+
+// BalanceEvent é a mensagem de /local/balances/stream. Type é "snapshot" na
+// primeira mensagem (todos os saldos não nulos) e "update" nas seguintes
+// (apenas os ativos alterados).
+type BalanceEvent struct {
+	Type       string         `json:"type"`
+	EventTime  int64          `json:"eventTime"`
+	UpdateTime int64          `json:"updateTime"`
+	Balances   []BalanceEntry `json:"balances"`
+}
+
+func newBalanceEntry(asset, free, locked string) BalanceEntry {
+	f, _ := strconv.ParseFloat(free, 64)
+	l, _ := strconv.ParseFloat(locked, 64)
+	return BalanceEntry{
+		Asset:  asset,
+		Free:   formatFloat(f),
+		Locked: formatFloat(l),
+		Total:  formatFloat(f + l),
+	}
+}
+
+// BalancesStream entrega as alterações de saldo do tenant via WebSocket ou SSE
+// @Summary Stream de saldos
+// @Description Deriva eventos simplificados dos eventos outboundAccountPosition do user data stream. A primeira mensagem é um snapshot dos saldos não nulos (desative com snapshot=false). Requer token de tenant.
+// @Tags Account
+// @Produce json
+// @Param snapshot query bool false "Enviar snapshot inicial (padrão true)"
+// @Success 200 {object} BalanceEvent
+// @Router /local/balances/stream [get]
+func (p *ProxyServer) BalancesStream(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+
+	// Assinar antes do snapshot para não perder alterações nesse intervalo
+	sub := p.userStreams.Get(tenant).Subscribe()
+	defer sub.Close()
+
+	if c.DefaultQuery("snapshot", "true") != "false" {
+		body, err := p.signedRequest(c.Request.Context(), tenant, http.MethodGet, "/api/v3/account", nil)
+		if err != nil {
+			respondUpstreamError(c, err)
+			return
+		}
+		sub.send(StreamMessage{Stream: balanceSnapshotEvent, Data: body})
+	}
+
+	p.serveSubscription(c, sub, func(msg StreamMessage) (interface{}, bool) {
+		switch msg.Stream {
+		case balanceSnapshotEvent:
+			var account accountInfo
+			if err := json.Unmarshal(msg.Data, &account); err != nil {
+				return nil, false
+			}
+			event := BalanceEvent{Type: "snapshot", EventTime: account.UpdateTime, UpdateTime: account.UpdateTime, Balances: []BalanceEntry{}}
+			for _, b := range account.Balances {
+				entry := newBalanceEntry(b.Asset, b.Free, b.Locked)
+				if entry.Total != "0" {
+					event.Balances = append(event.Balances, entry)
+				}
+			}
+			return event, true
+		case "outboundAccountPosition":
+			var position outboundAccountPosition
+			if err := json.Unmarshal(msg.Data, &position); err != nil {
+				return nil, false
+			}
+			event := BalanceEvent{Type: "update", EventTime: position.EventTime, UpdateTime: position.LastUpdateTime, Balances: []BalanceEntry{}}
+			for _, b := range position.Balances {
+				event.Balances = append(event.Balances, newBalanceEntry(b.Asset, b.Free, b.Locked))
+			}
+			return event, true
+		}
+		return nil, false
+	})
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultBBOIdleTimeout = 5 * time.Minute
+
+// bboQuote é o melhor bid/ask de um símbolo servido por /local/bbo
+type bboQuote struct {
+	Symbol   string `json:"symbol"`
+	UpdateID int64  `json:"updateId"`
+	BidPrice string `json:"bidPrice"`
+	BidQty   string `json:"bidQty"`
+	AskPrice string `json:"askPrice"`
+	AskQty   string `json:"askQty"`
+	// Momento em que o proxy recebeu o evento, em microssegundos
+	ReceivedAt int64 `json:"receivedAt"`
+}
+
+// appendJSON acrescenta a cotação a dst no mesmo JSON de json.Marshal,
+// montado à mão: cada evento do stream é serializado sem reflexão
+func (q *bboQuote) appendJSON(dst []byte) []byte {
+	dst = append(dst, `{"symbol":`...)
+	dst = appendJSONString(dst, q.Symbol)
+	dst = append(dst, `,"updateId":`...)
+	dst = strconv.AppendInt(dst, q.UpdateID, 10)
+	dst = append(dst, `,"bidPrice":`...)
+	dst = appendJSONString(dst, q.BidPrice)
+	dst = append(dst, `,"bidQty":`...)
+	dst = appendJSONString(dst, q.BidQty)
+	dst = append(dst, `,"askPrice":`...)
+	dst = appendJSONString(dst, q.AskPrice)
+	dst = append(dst, `,"askQty":`...)
+	dst = appendJSONString(dst, q.AskQty)
+	dst = append(dst, `,"receivedAt":`...)
+	dst = strconv.AppendInt(dst, q.ReceivedAt, 10)
+	return append(dst, '}')
+}
+
+// newBBOQuote converte um evento do stream <symbol>@bookTicker
+func newBBOQuote(data []byte) (*bboQuote, bool) {
+	var event bookTickerEvent
+	if err := json.Unmarshal(data, &event); err != nil || event.Symbol == "" {
+		return nil, false
+	}
+	return &bboQuote{
+		Symbol:     event.Symbol,
+		UpdateID:   event.UpdateID,
+		BidPrice:   event.BidPrice,
+		BidQty:     event.BidQty,
+		AskPrice:   event.AskPrice,
+		AskQty:     event.AskQty,
+		ReceivedAt: time.Now().UnixMicro(),
+	}, true
+}
+
+// BBOCache guarda o top-of-book de cada símbolo consultado, alimentado pelo
+// stream bookTicker. A resposta já fica serializada: a leitura é um
+// atomic.Load, sem locks nem chamadas à Binance.
+type BBOCache struct {
+	proxy *ProxyServer
+	idle  time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]*bboEntry
+}
+
+type bboEntry struct {
+	data     atomic.Pointer[[]byte]
+	lastUsed atomic.Int64
+	ready    chan struct{}
+	once     sync.Once
+}
+
+func (e *bboEntry) store(quote *bboQuote, onlyIfEmpty bool) {
+	// A resposta tem tamanho exato: é ela que fica guardada
+	data := quote.appendJSON(make([]byte, 0, bboQuoteSize(quote)))
+	if onlyIfEmpty {
+		if !e.data.CompareAndSwap(nil, &data) {
+			return
+		}
+	} else {
+		e.data.Store(&data)
+	}
+	e.once.Do(func() { close(e.ready) })
+}
+
+// bboQuoteSize é o teto do tamanho do JSON da cotação sem escapes: nomes,
+// aspas e separadores (91 bytes), os dois inteiros com até 20 dígitos e as
+// strings
+func bboQuoteSize(q *bboQuote) int {
+	return 131 + len(q.Symbol) + len(q.BidPrice) + len(q.BidQty) + len(q.AskPrice) + len(q.AskQty)
+}
+
+func NewBBOCache(proxy *ProxyServer) *BBOCache {
+	return &BBOCache{
+		proxy:   proxy,
+		idle:    getEnvDuration("BBO_IDLE_TIMEOUT", defaultBBOIdleTimeout),
+		entries: make(map[string]*bboEntry),
+	}
+}
+
+// Get retorna a entrada do símbolo, se ele já é acompanhado
+func (b *BBOCache) Get(symbol string) (*bboEntry, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	entry, ok := b.entries[symbol]
+	if ok {
+		entry.lastUsed.Store(time.Now().UnixNano())
+	}
+	return entry, ok
+}
+
+// Watch passa a acompanhar o símbolo. O stream fica aberto enquanto houver
+// consultas dentro de BBO_IDLE_TIMEOUT.
+func (b *BBOCache) Watch(symbol string) *bboEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if entry, ok := b.entries[symbol]; ok {
+		return entry
+	}
+	entry := &bboEntry{ready: make(chan struct{})}
+	entry.lastUsed.Store(time.Now().UnixNano())
+	b.entries[symbol] = entry
+	go b.run(symbol, entry)
+	return entry
+}
+
+// run aplica os eventos do stream na entrada até ela ficar sem uso
+func (b *BBOCache) run(symbol string, entry *bboEntry) {
+	sub := b.proxy.hub.Subscribe(strings.ToLower(symbol) + "@bookTicker").Label("bbo cache")
+	defer sub.Close()
+
+	// Símbolos pouco negociados podem demorar a ter evento: o REST preenche a
+	// entrada até lá (sem sobrescrever um evento que já tenha chegado)
+	go func() {
+		data, err := b.proxy.fetchUpstream(context.Background(), "/ticker/bookTicker", url.Values{"symbol": {symbol}})
+		if err != nil {
+			return
+		}
+		var ticker BookTicker
+		if json.Unmarshal(data, &ticker) == nil && ticker.Symbol != "" {
+			entry.store(&bboQuote{
+				Symbol:     ticker.Symbol,
+				BidPrice:   ticker.BidPrice,
+				BidQty:     ticker.BidQty,
+				AskPrice:   ticker.AskPrice,
+				AskQty:     ticker.AskQty,
+				ReceivedAt: time.Now().UnixMicro(),
+			}, true)
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if b.releaseIfIdle(symbol, entry) {
+				return
+			}
+		case msg := <-sub.C:
+			if quote, ok := newBBOQuote(msg.Data); ok {
+				entry.store(quote, false)
+			}
+		}
+	}
+}
+
+func (b *BBOCache) releaseIfIdle(symbol string, entry *bboEntry) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Since(time.Unix(0, entry.lastUsed.Load())) < b.idle {
+		return false
+	}
+	delete(b.entries, symbol)
+	return true
+}
+
+// LocalBBO retorna o melhor bid/ask do símbolo a partir da memória
+// @Summary Top-of-book (BBO)
+// @Description Melhor bid/ask mantido pelo stream bookTicker, respondido da memória sem passar pela Binance
+// @Tags Market Data
+// @Produce json
+// @Param symbol path string true "Símbolo (ex: BTCUSDT)"
+// @Success 200 {object} bboQuote
+// @Failure 503 {object} map[string]interface{}
+// @Router /local/bbo/{symbol} [get]
+func (p *ProxyServer) LocalBBO(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+	entry, ok := p.bbo.Get(symbol)
+	if !ok {
+		if !p.requireKnownSymbol(c, symbol) {
+			return
+		}
+		entry = p.bbo.Watch(symbol)
+	}
+
+	data := entry.data.Load()
+	if data == nil {
+		timer := time.NewTimer(localBookReadyWait)
+		defer timer.Stop()
+		select {
+		case <-entry.ready:
+		case <-timer.C:
+		case <-c.Request.Context().Done():
+		}
+		if data = entry.data.Load(); data == nil {
+			respondError(c, http.StatusServiceUnavailable, -1000, "Top-of-book de "+symbol+" ainda não disponível")
+			return
+		}
+	}
+	// Headers fixos compartilhados e o JSON já pronto: a leitura do cache não
+	// aloca (c.Data alocaria o Content-Type)
+	header := c.Writer.Header()
+	header["Cache-Control"] = headerValueNoStore
+	header["Content-Type"] = headerValueJSON
+	c.Status(http.StatusOK)
+	c.Writer.Write(*data)
+}
+
+// LocalBBOStream envia cada mudança do melhor bid/ask via WebSocket ou SSE
+// @Summary Stream de top-of-book (BBO)
+// @Tags Market Data
+// @Produce text/event-stream
+// @Param symbol path string true "Símbolo (ex: BTCUSDT)"
+// @Param filter query string false "Filtro avaliado a cada mensagem (ex: bidPrice > 50000)"
+// @Param snapshot query bool false "Enviar o top-of-book atual antes das mudanças, com seq"
+// @Router /local/bbo/{symbol}/stream [get]
+func (p *ProxyServer) LocalBBOStream(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+	withSnapshot, ok := wantsStreamSnapshot(c)
+	if !ok || !p.requireKnownSymbol(c, symbol) {
+		return
+	}
+
+	sub, ok := p.subscribeStreams(c, strings.ToLower(symbol)+"@bookTicker")
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	if !withSnapshot {
+		p.serveSubscription(c, sub, func(msg StreamMessage) (interface{}, bool) {
+			quote, ok := newBBOQuote(msg.Data)
+			if !ok {
+				return nil, false
+			}
+			return json.RawMessage(quote.appendJSON(nil)), true
+		})
+		return
+	}
+
+	entry, ok := p.bbo.Get(symbol)
+	if !ok {
+		entry = p.bbo.Watch(symbol)
+	}
+	timer := time.NewTimer(localBookReadyWait)
+	defer timer.Stop()
+	select {
+	case <-entry.ready:
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+	data := entry.data.Load()
+	if data == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Top-of-book de "+symbol+" ainda não disponível")
+		return
+	}
+	sub.send(StreamMessage{Stream: streamSnapshotEvent, Data: *data})
+
+	// Eventos do buffer já refletidos no snapshot são descartados pelo updateId
+	var last int64
+	p.serveSubscription(c, sub, func(msg StreamMessage) (interface{}, bool) {
+		if msg.Stream == streamSnapshotEvent {
+			var snapshot bboQuote
+			if err := json.Unmarshal(msg.Data, &snapshot); err != nil {
+				return nil, false
+			}
+			last = snapshot.UpdateID
+			return newStreamSnapshot(msg.Data), true
+		}
+		quote, ok := newBBOQuote(msg.Data)
+		if !ok || quote.UpdateID <= last {
+			return nil, false
+		}
+		last = quote.UpdateID
+		return newStreamUpdate(json.RawMessage(quote.appendJSON(nil))), true
+	})
+}
+
+// requireKnownSymbol confere o símbolo em exchangeInfo, respondendo o erro
+// quando ele não existe
+func (p *ProxyServer) requireKnownSymbol(c *gin.Context, symbol string) bool {
+	info, err := p.market.ExchangeInfo(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter exchangeInfo: "+err.Error())
+		return false
+	}
+	if _, ok := info.Symbol(symbol); !ok {
+		respondError(c, http.StatusBadRequest, -1121, "Símbolo inválido: "+symbol)
+		return false
+	}
+	return true
+}
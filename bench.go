@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBenchStep        = 5 * time.Second
+	defaultBenchConcurrency = 64
+	defaultBenchMaxP99      = 50 * time.Millisecond
+	maxBenchDuration        = 2 * time.Minute
+	maxBenchConcurrency     = 1024
+	// Amostras de latência guardadas por nível (as demais só são contadas)
+	maxBenchSamples = 1 << 20
+)
+
+// defaultBenchPaths são servidos pelos caches do proxy, sem chamar a Binance
+// a cada requisição
+var defaultBenchPaths = []string{"/health", "/local/exchangeInfo?symbol=BTCUSDT", "/symbols/search?q=BTC"}
+
+// benchRequest é o perfil de carga de POST /admin/bench
+type benchRequest struct {
+	Paths []string `json:"paths"`
+	// Duração de cada nível de concorrência
+	Step string `json:"step"`
+	// Concorrência do último nível; os níveis dobram a partir de 1
+	Concurrency int `json:"concurrency"`
+	// Taxa fixa (requisições/s) num único nível, em vez da rampa
+	RPS int `json:"rps"`
+	// p99 acima do qual um nível deixa de ser sustentável
+	MaxP99  string            `json:"maxP99"`
+	Headers map[string]string `json:"headers"`
+}
+
+// BenchLevel é o resultado de um nível de carga
+type BenchLevel struct {
+	Concurrency int              `json:"concurrency"`
+	TargetRPS   int              `json:"targetRps,omitempty"`
+	Requests    int64            `json:"requests"`
+	Errors      int64            `json:"errors"`
+	RPS         float64          `json:"rps"`
+	P50Ms       float64          `json:"p50Ms"`
+	P90Ms       float64          `json:"p90Ms"`
+	P99Ms       float64          `json:"p99Ms"`
+	MaxMs       float64          `json:"maxMs"`
+	Status      map[string]int64 `json:"status"`
+	Sustainable bool             `json:"sustainable"`
+}
+
+// BenchReport é o relatório de POST /admin/bench
+type BenchReport struct {
+	Paths             []string     `json:"paths"`
+	Step              string       `json:"step"`
+	MaxP99            string       `json:"maxP99"`
+	Levels            []BenchLevel `json:"levels"`
+	MaxSustainableRPS float64      `json:"maxSustainableRps"`
+	// Motivo do último nível não sustentável: p99 ou errors
+	LimitedBy string `json:"limitedBy,omitempty"`
+}
+
+// benchWriter descarta o corpo e guarda só o status
+type benchWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *benchWriter) Header() http.Header { return w.header }
+
+func (w *benchWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(data), nil
+}
+
+func (w *benchWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *benchWriter) Flush() {}
+
+// benchRunning impede dois benchmarks simultâneos
+var benchRunning atomic.Bool
+
+// validateBenchPath aceita GETs de rotas locais e, entre os paths repassados
+// à Binance, só os cobertos por RESPONSE_CACHE_ROUTES: o benchmark mede o
+// proxy, sem consumir o peso da API
+func (p *ProxyServer) validateBenchPath(target string) error {
+	parsed, err := url.Parse(target)
+	if err != nil || !strings.HasPrefix(parsed.Path, "/") {
+		return fmt.Errorf("path inválido: %q", target)
+	}
+	if strings.HasPrefix(parsed.Path, "/admin") {
+		return fmt.Errorf("rotas admin não entram no benchmark: %s", parsed.Path)
+	}
+	if methods, ok := p.routes.Lookup(parsed.Path); ok {
+		if !methods[http.MethodGet] {
+			return fmt.Errorf("rota sem GET: %s", parsed.Path)
+		}
+		return nil
+	}
+	if p.responses != nil && p.responses.ttlFor(upstreamEndpoint(parsed.Path)) > 0 {
+		return nil
+	}
+	return fmt.Errorf("%s seria repassado à Binance; use rotas locais ou cobertas por RESPONSE_CACHE_ROUTES", parsed.Path)
+}
+
+// runBenchLevel dispara as requisições de um nível contra o próprio router,
+// sem rede: mede middlewares, handlers e caches
+func (p *ProxyServer) runBenchLevel(ctx context.Context, paths []string, headers http.Header, concurrency, rps int, step time.Duration) BenchLevel {
+	level := BenchLevel{Concurrency: concurrency, TargetRPS: rps, Status: map[string]int64{}}
+	ctx, cancel := context.WithTimeout(ctx, step)
+	defer cancel()
+
+	// Com taxa fixa, os workers pegam fichas emitidas no ritmo pedido
+	var tokens chan struct{}
+	if rps > 0 {
+		tokens = make(chan struct{}, concurrency)
+		go func() {
+			ticker := time.NewTicker(time.Second / time.Duration(rps))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					select {
+					case tokens <- struct{}{}:
+					default:
+						// Workers ocupados: a taxa pedida não é atingida
+					}
+				}
+			}
+		}()
+	}
+
+	var (
+		mu      sync.Mutex
+		samples []time.Duration
+		next    atomic.Int64
+		wg      sync.WaitGroup
+	)
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := make([]time.Duration, 0, 1024)
+			status := map[string]int64{}
+			var requests, errors int64
+			for ctx.Err() == nil {
+				if tokens != nil {
+					select {
+					case <-ctx.Done():
+						continue
+					case <-tokens:
+					}
+				}
+				target := paths[int(next.Add(1))%len(paths)]
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+				if err != nil {
+					continue
+				}
+				req.RemoteAddr = "127.0.0.1:0"
+				for key, values := range headers {
+					req.Header[key] = values
+				}
+				w := &benchWriter{header: http.Header{}}
+				began := time.Now()
+				p.router.ServeHTTP(w, req)
+				elapsed := time.Since(began)
+				if ctx.Err() != nil && w.status == 0 {
+					// Interrompida pelo fim do nível
+					break
+				}
+				if w.status == 0 {
+					w.status = http.StatusOK
+				}
+				requests++
+				if w.status >= http.StatusInternalServerError || w.status == http.StatusTooManyRequests {
+					errors++
+				}
+				status[strconv.Itoa(w.status)]++
+				local = append(local, elapsed)
+				if len(local) == cap(local) {
+					mu.Lock()
+					if len(samples) < maxBenchSamples {
+						samples = append(samples, local...)
+					}
+					mu.Unlock()
+					local = local[:0]
+				}
+			}
+			mu.Lock()
+			if len(samples) < maxBenchSamples {
+				samples = append(samples, local...)
+			}
+			level.Requests += requests
+			level.Errors += errors
+			for code, n := range status {
+				level.Status[code] += n
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	level.RPS = float64(level.Requests) / elapsed.Seconds()
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	level.P50Ms = benchPercentile(samples, 0.50)
+	level.P90Ms = benchPercentile(samples, 0.90)
+	level.P99Ms = benchPercentile(samples, 0.99)
+	level.MaxMs = benchPercentile(samples, 1)
+	return level
+}
+
+// benchPercentile retorna o percentil q das amostras ordenadas, em ms
+func benchPercentile(sorted []time.Duration, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(sorted))+0.5) - 1
+	i = max(0, min(i, len(sorted)-1))
+	return float64(sorted[i].Microseconds()) / 1000
+}
+
+// Bench roda uma carga sintética contra o próprio proxy
+// @Summary Benchmark de capacidade
+// @Description Dispara GETs contra as rotas locais e cacheadas do próprio proxy, sem rede e sem chamar a Binance, em níveis de concorrência que dobram de 1 até concurrency (ou numa taxa fixa com rps). Cada nível informa RPS, percentis de latência e erros; maxSustainableRps é o maior RPS de um nível com p99 até maxP99 e menos de 1% de erros.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} BenchReport
+// @Router /admin/bench [post]
+func (p *ProxyServer) Bench(c *gin.Context) {
+	var req benchRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, -1100, "JSON inválido: "+err.Error())
+			return
+		}
+	}
+	if len(req.Paths) == 0 {
+		req.Paths = defaultBenchPaths
+	}
+	for _, target := range req.Paths {
+		if err := p.validateBenchPath(target); err != nil {
+			respondError(c, http.StatusBadRequest, -1100, err.Error())
+			return
+		}
+	}
+	step, maxP99 := defaultBenchStep, defaultBenchMaxP99
+	var err error
+	if req.Step != "" {
+		if step, err = time.ParseDuration(req.Step); err != nil || step <= 0 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'step' inválido")
+			return
+		}
+	}
+	if req.MaxP99 != "" {
+		if maxP99, err = time.ParseDuration(req.MaxP99); err != nil || maxP99 <= 0 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'maxP99' inválido")
+			return
+		}
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = defaultBenchConcurrency
+	}
+	if req.Concurrency > maxBenchConcurrency || req.RPS < 0 {
+		respondError(c, http.StatusBadRequest, -1100, fmt.Sprintf("concurrency deve ir até %d e rps não pode ser negativo", maxBenchConcurrency))
+		return
+	}
+
+	levels := []int{req.Concurrency}
+	if req.RPS == 0 {
+		levels = levels[:0]
+		for n := 1; n < req.Concurrency; n *= 2 {
+			levels = append(levels, n)
+		}
+		levels = append(levels, req.Concurrency)
+	}
+	if total := step * time.Duration(len(levels)); total > maxBenchDuration {
+		respondError(c, http.StatusBadRequest, -1100, fmt.Sprintf("Benchmark de %s excede o máximo de %s (reduza step ou concurrency)", total, maxBenchDuration))
+		return
+	}
+	if !benchRunning.CompareAndSwap(false, true) {
+		respondError(c, http.StatusConflict, -1000, "Já há um benchmark em andamento")
+		return
+	}
+	defer benchRunning.Store(false)
+
+	headers := http.Header{}
+	for key, value := range req.Headers {
+		headers.Set(key, value)
+	}
+	// A resposta só sai no fim de todos os níveis
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(step*time.Duration(len(levels)) + writeTimeout))
+
+	report := BenchReport{Paths: req.Paths, Step: step.String(), MaxP99: maxP99.String(), Levels: []BenchLevel{}}
+	for _, concurrency := range levels {
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		level := p.runBenchLevel(c.Request.Context(), req.Paths, headers, concurrency, req.RPS, step)
+		switch {
+		case level.Requests == 0 || float64(level.Errors)/float64(level.Requests) >= 0.01:
+			report.LimitedBy = "errors"
+		case time.Duration(level.P99Ms*float64(time.Millisecond)) > maxP99:
+			report.LimitedBy = "p99"
+		default:
+			level.Sustainable = true
+			report.MaxSustainableRPS = max(report.MaxSustainableRPS, level.RPS)
+		}
+		report.Levels = append(report.Levels, level)
+	}
+	if len(report.Levels) > 0 && report.Levels[len(report.Levels)-1].Sustainable {
+		report.LimitedBy = ""
+	}
+	c.JSON(http.StatusOK, report)
+}
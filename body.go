@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxRequestBody = 1 << 20
+	formContentType       = "application/x-www-form-urlencoded"
+)
+
+// requestBodyKey guarda no gin.Context o corpo já lido da requisição
+const requestBodyKey = "proxy.requestBody"
+
+// BodyLimit limita o corpo de todas as requisições a limit bytes
+// (MAX_REQUEST_BODY); acima disso, a leitura falha e a requisição recebe 413
+func BodyLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit > 0 && c.Request.Body != nil && c.Request.Body != http.NoBody {
+			if c.Request.ContentLength > limit {
+				respondError(c, http.StatusRequestEntityTooLarge, -1100, "Corpo da requisição acima do limite (MAX_REQUEST_BODY)")
+				c.Abort()
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
+
+// readBody lê o corpo da requisição uma única vez e o deixa disponível de
+// novo em c.Request.Body (e em GetBody, para retries do cliente HTTP). Cada
+// chamada recomeça a leitura do início.
+func readBody(c *gin.Context) ([]byte, error) {
+	if cached, ok := c.Get(requestBodyKey); ok {
+		body := cached.([]byte)
+		resetBody(c.Request, body)
+		return body, nil
+	}
+	var body []byte
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(c.Request.Body); err != nil {
+			return nil, err
+		}
+		c.Request.Body.Close()
+	}
+	setRequestBody(c, body)
+	return body, nil
+}
+
+// setRequestBody troca o corpo da requisição (plugins, assinatura)
+func setRequestBody(c *gin.Context, body []byte) {
+	c.Set(requestBodyKey, body)
+	resetBody(c.Request, body)
+}
+
+func resetBody(r *http.Request, body []byte) {
+	r.ContentLength = int64(len(body))
+	if len(body) == 0 {
+		r.Body, r.GetBody = http.NoBody, nil
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// respondBodyError responde a uma falha de readBody: 413 acima do limite,
+// 400 nos demais casos
+func respondBodyError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondError(c, http.StatusRequestEntityTooLarge, -1100, "Corpo da requisição acima do limite (MAX_REQUEST_BODY)")
+	} else {
+		respondError(c, http.StatusBadRequest, -1100, "Erro ao ler o corpo: "+err.Error())
+	}
+	c.Abort()
+}
+
+// isFormBody indica se o corpo é application/x-www-form-urlencoded
+func isFormBody(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == formContentType
+}
+
+// bodyParams junta os parâmetros da query e os de um corpo form
+func bodyParams(r *http.Request, body []byte) url.Values {
+	params := r.URL.Query()
+	if len(body) == 0 || !isFormBody(r) && r.Header.Get("Content-Type") != "" {
+		return params
+	}
+	if form, err := url.ParseQuery(string(body)); err == nil {
+		for key, values := range form {
+			params[key] = append(params[key], values...)
+		}
+	}
+	return params
+}
+
+// upstreamPath é o path da chamada na Binance: o path da URL base (ex:
+// /api/v3) seguido do path repassado
+func upstreamPath(baseURL, path string) string {
+	if u, err := url.Parse(baseURL); err == nil {
+		return strings.TrimSuffix(u.Path, "/") + path
+	}
+	return path
+}
+
+// signProxyRequest assina com as credenciais do tenant uma chamada
+// repassada na raiz do proxy quando o cliente manda o token e o timestamp,
+// mas não a assinatura nem X-MBX-APIKEY. Como na Binance, a assinatura cobre
+// a query seguida do corpo form e vai no corpo quando ele existe. Retorna o
+// tenant (nil se a chamada não é assinada pelo proxy), a query e o corpo.
+// baseURL e path são o destino escolhido por ProxyRequest: a política do
+// tenant vale sobre o path na Binance (/api/v3/order, não /api/order), e as
+// credenciais nunca vão para uma URL base alternativa.
+func (p *ProxyServer) signProxyRequest(c *gin.Context, baseURL, path, query string, body []byte) (*Tenant, string, []byte, error) {
+	tenant := p.requestTenant(c.Request)
+	if tenant == nil || c.GetHeader("X-MBX-APIKEY") != "" {
+		return nil, query, body, nil
+	}
+	form, formBody := url.Values{}, []byte(nil)
+	if len(body) > 0 && isFormBody(c.Request) {
+		parsed, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, query, body, err
+		}
+		form, formBody = parsed, body
+	}
+	params, _ := url.ParseQuery(query)
+	if params.Has("signature") || form.Has("signature") || !params.Has("timestamp") && !form.Has("timestamp") {
+		return nil, query, body, nil
+	}
+	if baseURL != p.binanceURL {
+		return nil, query, body, policyError(errors.New("chamadas assinadas pelo proxy só vão para BINANCE_API_URL, não para " + baseURL))
+	}
+	symbols := append(querySymbols(params), querySymbols(form)...)
+	if err := tenant.Policy.Allow(c.Request.Method, upstreamPath(baseURL, path), symbols); err != nil {
+		// log.Printf("[WARN] Chamada de %s recusada pela política: %v", tenant.Name, err)
+		return nil, query, body, policyError(err)
+	}
+
+	signature := "signature=" + tenant.sign(query+string(formBody))
+	if len(formBody) > 0 {
+		body = append(append(append([]byte(nil), body...), '&'), signature...)
+	} else if query != "" {
+		query += "&" + signature
+	} else {
+		query = signature
+	}
+	return tenant, query, body, nil
+}
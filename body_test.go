@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newSigningTestProxy cria um proxy apontado para um upstream falso, com um
+// tenant cuja política nega o cancelamento em massa de ordens
+func newSigningTestProxy(t *testing.T) (*ProxyServer, *atomic.Int64) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	var hits atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	file := filepath.Join(t.TempDir(), "tenants.yaml")
+	config := `tenants:
+  - name: desk
+    token: desk-token
+    api_key: KEY
+    secret_key: SECRET
+    policy:
+      deny_endpoints: ["DELETE /api/v3/openOrders"]
+`
+	if err := os.WriteFile(file, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := LoadTenants(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProxyServer()
+	p.binanceURL = upstream.URL + "/api/v3"
+	p.client = newUpstreamClient(p, nil)
+	p.tenants = tenants
+	p.upstreams = map[string]bool{"https://alt.example.com/api/v3": true}
+	return p, &hits
+}
+
+func proxySigned(p *ProxyServer, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, nil)
+	c.Request.Header.Set("X-Proxy-Token", "desk-token")
+	p.ProxyRequest(c)
+	return w
+}
+
+func TestSignProxyRequestPolicyUsesUpstreamPath(t *testing.T) {
+	p, hits := newSigningTestProxy(t)
+
+	w := proxySigned(p, http.MethodDelete, "/api/openOrders?symbol=BTCUSDT&timestamp=1")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("DELETE /api/openOrders: status %d, esperado 403 (%s)", w.Code, w.Body)
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("chamada negada chegou ao upstream")
+	}
+
+	w = proxySigned(p, http.MethodGet, "/api/openOrders?symbol=BTCUSDT&timestamp=1")
+	if w.Code != http.StatusOK || hits.Load() != 1 {
+		t.Fatalf("GET /api/openOrders: status %d, %d chamadas ao upstream", w.Code, hits.Load())
+	}
+}
+
+func TestSignProxyRequestRejectsAlternateBase(t *testing.T) {
+	p, hits := newSigningTestProxy(t)
+
+	w := proxySigned(p, http.MethodGet, "/api/openOrders?symbol=BTCUSDT&timestamp=1&_upstream=https://alt.example.com/api/v3")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, esperado 403 (%s)", w.Code, w.Body)
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("chamada recusada chegou ao upstream")
+	}
+}
+
+func TestUpstreamPath(t *testing.T) {
+	for _, tc := range []struct{ base, path, want string }{
+		{"https://api.binance.com/api/v3", "/order", "/api/v3/order"},
+		{"https://api.binance.com/api/v3/", "/order", "/api/v3/order"},
+		{"https://api.binance.com", "/sapi/v1/asset/tradeFee", "/sapi/v1/asset/tradeFee"},
+	} {
+		if got := upstreamPath(tc.base, tc.path); got != tc.want {
+			t.Errorf("upstreamPath(%q, %q) = %q, esperado %q", tc.base, tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import "container/list"
+
+// cacheBudget limita o tamanho (em bytes) de um cache em memória e mantém a
+// ordem de uso das chaves: quando uma entrada nova não cabe, as menos usadas
+// recentemente saem. Não é seguro para uso concorrente; o cache que o usa
+// chama seus métodos com o próprio mutex.
+type cacheBudget struct {
+	max   int64
+	used  int64
+	order *list.List
+	items map[string]*list.Element
+
+	evictions int64
+	rejected  int64
+}
+
+type budgetItem struct {
+	key  string
+	size int64
+}
+
+func newCacheBudget(max int64) *cacheBudget {
+	return &cacheBudget{max: max, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// touch marca a chave como usada agora
+func (b *cacheBudget) touch(key string) {
+	if elem, ok := b.items[key]; ok {
+		b.order.MoveToFront(elem)
+	}
+}
+
+// set registra (ou atualiza) o tamanho da chave e retorna as chaves que o
+// cache deve descartar para caber no orçamento. Uma entrada maior que o
+// orçamento inteiro não é guardada: ok volta false e a chave sai da conta.
+func (b *cacheBudget) set(key string, size int64) (evicted []string, ok bool) {
+	b.remove(key)
+	if size > b.max {
+		b.rejected++
+		return nil, false
+	}
+	for b.used+size > b.max {
+		oldest := b.order.Back()
+		item := oldest.Value.(*budgetItem)
+		b.order.Remove(oldest)
+		delete(b.items, item.key)
+		b.used -= item.size
+		b.evictions++
+		evicted = append(evicted, item.key)
+	}
+	b.items[key] = b.order.PushFront(&budgetItem{key: key, size: size})
+	b.used += size
+	return evicted, true
+}
+
+// oldest retorna a chave usada há mais tempo
+func (b *cacheBudget) oldest() (string, bool) {
+	if elem := b.order.Back(); elem != nil {
+		return elem.Value.(*budgetItem).key, true
+	}
+	return "", false
+}
+
+// evict descarta a chave por falta de espaço
+func (b *cacheBudget) evict(key string) {
+	if _, ok := b.items[key]; ok {
+		b.remove(key)
+		b.evictions++
+	}
+}
+
+// remove tira a chave da conta
+func (b *cacheBudget) remove(key string) {
+	if elem, ok := b.items[key]; ok {
+		b.used -= elem.Value.(*budgetItem).size
+		b.order.Remove(elem)
+		delete(b.items, key)
+	}
+}
+
+// reset esvazia a conta, mantendo os contadores
+func (b *cacheBudget) reset() {
+	b.used = 0
+	b.order.Init()
+	b.items = map[string]*list.Element{}
+}
+
+// cacheUsage é o retrato de um cache para /metrics e /admin/cache
+type cacheUsage struct {
+	Cache     string `json:"cache"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"maxBytes"`
+	Evictions int64  `json:"evictions"`
+	// Entradas maiores que o orçamento inteiro, que não foram guardadas
+	Rejected int64 `json:"rejected"`
+}
+
+func (b *cacheBudget) usage(cache string) cacheUsage {
+	return cacheUsage{Cache: cache, Entries: len(b.items), Bytes: b.used, MaxBytes: b.max, Evictions: b.evictions, Rejected: b.rejected}
+}
+
+// writeCacheMetrics escreve o tamanho e as remoções de cada cache em memória
+func writeCacheMetrics(w *metricsWriter, caches []cacheUsage) {
+	w.family("proxy_cache_bytes", "gauge", "Tamanho estimado das entradas do cache em memória.")
+	for _, cache := range caches {
+		w.sample("proxy_cache_bytes", float64(cache.Bytes), "cache", cache.Cache)
+	}
+	w.family("proxy_cache_max_bytes", "gauge", "Orçamento de memória do cache.")
+	for _, cache := range caches {
+		w.sample("proxy_cache_max_bytes", float64(cache.MaxBytes), "cache", cache.Cache)
+	}
+	w.family("proxy_cache_entries", "gauge", "Entradas guardadas no cache.")
+	for _, cache := range caches {
+		w.sample("proxy_cache_entries", float64(cache.Entries), "cache", cache.Cache)
+	}
+	w.family("proxy_cache_evictions_total", "counter", "Entradas descartadas (as menos usadas recentemente) para caber no orçamento.")
+	for _, cache := range caches {
+		w.sample("proxy_cache_evictions_total", float64(cache.Evictions), "cache", cache.Cache)
+	}
+	w.family("proxy_cache_rejected_total", "counter", "Entradas maiores que o orçamento inteiro, que não foram guardadas.")
+	for _, cache := range caches {
+		w.sample("proxy_cache_rejected_total", float64(cache.Rejected), "cache", cache.Cache)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultClientAuthWindow = 30 * time.Second
+	nonceSweepInterval      = time.Minute
+)
+
+// Headers da autenticação HMAC do cliente
+const (
+	clientTenantHeader    = "X-Proxy-Tenant"
+	clientTimestampHeader = "X-Proxy-Timestamp"
+	clientNonceHeader     = "X-Proxy-Nonce"
+	clientSignatureHeader = "X-Proxy-Signature"
+)
+
+// clientTenantKey guarda no contexto o tenant autenticado por assinatura
+type clientTenantKey struct{}
+
+// NonceStore registra os nonces já usados. Seen retorna true se o nonce já
+// foi visto dentro do ttl; caso contrário, o registra.
+type NonceStore interface {
+	Seen(key string, ttl time.Duration) (bool, error)
+}
+
+// memoryNonceStore guarda os nonces no processo (uma réplica só)
+type memoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: map[string]time.Time{}, lastSweep: time.Now()}
+}
+
+func (s *memoryNonceStore) Seen(key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	// Remove os expirados de tempos em tempos, sem goroutine própria
+	if now.Sub(s.lastSweep) > nonceSweepInterval {
+		for nonce, expiry := range s.nonces {
+			if now.After(expiry) {
+				delete(s.nonces, nonce)
+			}
+		}
+		s.lastSweep = now
+	}
+	if expiry, ok := s.nonces[key]; ok && now.Before(expiry) {
+		return true, nil
+	}
+	s.nonces[key] = now.Add(ttl)
+	return false, nil
+}
+
+// redisNonceStore compartilha os nonces entre as réplicas (SET NX com TTL)
+type redisNonceStore struct {
+	cluster *Cluster
+}
+
+func NewRedisNonceStore(cluster *Cluster) NonceStore {
+	return &redisNonceStore{cluster: cluster}
+}
+
+func (s *redisNonceStore) Seen(key string, ttl time.Duration) (bool, error) {
+	reply, err := s.cluster.redis.Do("SET", s.cluster.key("nonce:"+key), "1", "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply != "OK", nil
+}
+
+// clientSignaturePayload é o texto assinado pelo cliente: método, path com a
+// query, timestamp, nonce e o SHA-256 do corpo, separados por quebra de linha
+func clientSignaturePayload(r *http.Request, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return r.Method + "\n" + r.URL.RequestURI() + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])
+}
+
+// ClientAuth autentica requisições assinadas pelo cliente com o
+// client_secret do tenant (X-Proxy-Tenant, X-Proxy-Timestamp, X-Proxy-Nonce
+// e X-Proxy-Signature). O timestamp precisa estar dentro de window e cada
+// nonce só vale uma vez, então uma requisição interceptada não pode ser
+// reenviada. Requisições sem X-Proxy-Signature seguem para a autenticação
+// por token.
+func (p *ProxyServer) ClientAuth(window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		signature := c.GetHeader(clientSignatureHeader)
+		if signature == "" {
+			c.Next()
+			return
+		}
+		reject := func(code int, msg string) {
+			respondError(c, http.StatusUnauthorized, code, msg)
+			c.Abort()
+		}
+
+		tenant := p.tenants.ByName(c.GetHeader(clientTenantHeader))
+		if tenant == nil || tenant.ClientSecret == "" {
+			reject(-2015, "Tenant sem client_secret para requisições assinadas")
+			return
+		}
+		timestamp, nonce := c.GetHeader(clientTimestampHeader), c.GetHeader(clientNonceHeader)
+		ms, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || nonce == "" {
+			reject(-1102, clientTimestampHeader+" e "+clientNonceHeader+" são obrigatórios")
+			return
+		}
+		if skew := time.Since(time.UnixMilli(ms)); skew > window || skew < -window {
+			reject(-1021, "Timestamp fora da janela de "+window.String())
+			return
+		}
+
+		body, err := readBody(c)
+		if err != nil {
+			respondBodyError(c, err)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(tenant.ClientSecret))
+		mac.Write([]byte(clientSignaturePayload(c.Request, timestamp, nonce, body)))
+		expected := hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(expected), []byte(signature)) {
+			reject(-1022, "Assinatura da requisição inválida")
+			return
+		}
+
+		// O nonce só é registrado com a assinatura válida, para que terceiros
+		// não consigam queimar nonces alheios. Ele vale pelo dobro da janela,
+		// cobrindo todo o intervalo em que o timestamp ainda seria aceito.
+		seen, err := p.nonces.Seen(tenant.Name+":"+nonce, 2*window)
+		if err != nil {
+			respondError(c, http.StatusServiceUnavailable, -1000, "Registro de nonces indisponível: "+err.Error())
+			c.Abort()
+			return
+		}
+		if seen {
+			// log.Printf("[WARN] Replay recusado para %s (nonce %s)", tenant.Name, nonce)
+			reject(-1022, "Nonce já utilizado (replay)")
+			return
+		}
+
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), clientTenantKey{}, tenant))
+		c.Next()
+	}
+}
+
+// requestTenant identifica o tenant da requisição: pela assinatura já
+// conferida por ClientAuth ou pelo token. Tenants com require_signature não
+// aceitam o token sozinho.
+func (p *ProxyServer) requestTenant(r *http.Request) *Tenant {
+	if tenant, ok := r.Context().Value(clientTenantKey{}).(*Tenant); ok {
+		return tenant
+	}
+	tenant := p.tenants.Lookup(tenantToken(r))
+	if tenant != nil && tenant.RequireSignature {
+		return nil
+	}
+	return tenant
+}
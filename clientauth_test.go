@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRedis atende o subconjunto do RESP usado pelo redisNonceStore
+// (SET chave valor NX PX ms), guardando as chaves em memória
+func fakeRedis(t *testing.T) *RedisClient {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	keys := map[string]time.Time{}
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		rd := bufio.NewReader(conn)
+		for {
+			reply, err := readRedisReply(rd)
+			if err != nil {
+				return
+			}
+			items, _ := reply.([]interface{})
+			args := make([]string, len(items))
+			for i, item := range items {
+				data, _ := item.([]byte)
+				args[i] = string(data)
+			}
+			if len(args) != 6 || !strings.EqualFold(args[0], "SET") {
+				conn.Write([]byte("-ERR comando não suportado\r\n"))
+				continue
+			}
+			ms, _ := strconv.Atoi(args[5])
+			mu.Lock()
+			expiry, exists := keys[args[1]]
+			if exists && time.Now().Before(expiry) {
+				mu.Unlock()
+				conn.Write([]byte("$-1\r\n"))
+				continue
+			}
+			keys[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			mu.Unlock()
+			conn.Write([]byte("+OK\r\n"))
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+
+	client, err := NewRedisClient("redis://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func newClientAuthEngine(t *testing.T, nonces NonceStore) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	file := filepath.Join(t.TempDir(), "tenants.yaml")
+	config := `tenants:
+  - name: desk
+    token: desk-token
+    api_key: KEY
+    secret_key: SECRET
+    client_secret: CLIENT
+`
+	if err := os.WriteFile(file, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := LoadTenants(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProxyServer()
+	p.tenants = tenants
+	p.nonces = nonces
+	r := gin.New()
+	r.Use(p.ClientAuth(defaultClientAuthWindow))
+	r.GET("/api/account", func(c *gin.Context) {
+		if p.requestTenant(c.Request) == nil {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+// signedClientRequest monta uma requisição assinada com o client_secret;
+// secret vazio gera uma assinatura inválida
+func signedClientRequest(ts time.Time, nonce, secret string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/account?recvWindow=5000", nil)
+	timestamp := strconv.FormatInt(ts.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(clientSignaturePayload(req, timestamp, nonce, nil)))
+	req.Header.Set(clientTenantHeader, "desk")
+	req.Header.Set(clientTimestampHeader, timestamp)
+	req.Header.Set(clientNonceHeader, nonce)
+	req.Header.Set(clientSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestClientAuth(t *testing.T) {
+	stores := map[string]func(t *testing.T) NonceStore{
+		"memory": func(t *testing.T) NonceStore { return NewMemoryNonceStore() },
+		"redis": func(t *testing.T) NonceStore {
+			return NewRedisNonceStore(&Cluster{redis: fakeRedis(t), prefix: "test:"})
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			r := newClientAuthEngine(t, newStore(t))
+			do := func(req *http.Request) int {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				return w.Code
+			}
+
+			if code := do(signedClientRequest(time.Now(), "n-1", "CLIENT")); code != http.StatusOK {
+				t.Fatalf("requisição válida: status %d, esperado 200", code)
+			}
+			if code := do(signedClientRequest(time.Now(), "n-1", "CLIENT")); code != http.StatusUnauthorized {
+				t.Fatalf("nonce repetido: status %d, esperado 401", code)
+			}
+
+			old := time.Now().Add(-2 * defaultClientAuthWindow)
+			if code := do(signedClientRequest(old, "n-2", "CLIENT")); code != http.StatusUnauthorized {
+				t.Fatalf("timestamp fora da janela: status %d, esperado 401", code)
+			}
+			future := time.Now().Add(2 * defaultClientAuthWindow)
+			if code := do(signedClientRequest(future, "n-2", "CLIENT")); code != http.StatusUnauthorized {
+				t.Fatalf("timestamp no futuro: status %d, esperado 401", code)
+			}
+
+			// Uma assinatura inválida não pode queimar o nonce do cliente
+			if code := do(signedClientRequest(time.Now(), "n-3", "WRONG")); code != http.StatusUnauthorized {
+				t.Fatalf("assinatura inválida: status %d, esperado 401", code)
+			}
+			if code := do(signedClientRequest(time.Now(), "n-3", "CLIENT")); code != http.StatusOK {
+				t.Fatalf("nonce após assinatura inválida: status %d, esperado 200", code)
+			}
+		})
+	}
+}
+
+func TestNonceStoreExpiry(t *testing.T) {
+	stores := map[string]NonceStore{
+		"memory": NewMemoryNonceStore(),
+		"redis":  NewRedisNonceStore(&Cluster{redis: fakeRedis(t), prefix: "test:"}),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if seen, err := store.Seen("desk:a", 50*time.Millisecond); err != nil || seen {
+				t.Fatalf("primeiro uso: seen=%v err=%v", seen, err)
+			}
+			if seen, err := store.Seen("desk:a", 50*time.Millisecond); err != nil || !seen {
+				t.Fatalf("reuso dentro do ttl: seen=%v err=%v", seen, err)
+			}
+			if seen, _ := store.Seen("other:a", 50*time.Millisecond); seen {
+				t.Fatalf("nonce de outro tenant tratado como repetido")
+			}
+			time.Sleep(80 * time.Millisecond)
+			if seen, err := store.Seen("desk:a", 50*time.Millisecond); err != nil || seen {
+				t.Fatalf("reuso após o ttl: seen=%v err=%v", seen, err)
+			}
+		})
+	}
+}
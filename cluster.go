@@ -0,0 +1,537 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultClusterLeaseTTL   = 10 * time.Second
+	defaultClusterKeyPrefix  = "binance-proxy:"
+	clusterListenKeyLifetime = 60 * time.Minute
+
+	// affinityHeader marca uma requisição já encaminhada por outra réplica,
+	// que deve ser atendida localmente
+	affinityHeader = "X-Proxy-Forwarded-By"
+)
+
+// Modos de CLUSTER_AFFINITY
+const (
+	affinityProxy    = "proxy"
+	affinityRedirect = "redirect"
+	affinityOff      = "off"
+)
+
+// Scripts de lease: só a réplica dona renova ou libera a chave
+const (
+	leaseRenewScript   = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+	leaseReleaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+// Cluster coordena várias réplicas do proxy pelo Redis (REDIS_URL). Cada
+// stream de mercado tem uma réplica dona (lease com TTL), a única que abre a
+// conexão com a Binance e repassa as mensagens às demais por pub/sub. O user
+// data stream de cada tenant fica com uma réplica escolhida por hashing
+// consistente entre as réplicas vivas, com o listenKey guardado no Redis
+// para ser reaproveitado por quem assumir o tenant. A réplica líder (eleita
+// do mesmo jeito) limpa as réplicas expiradas.
+type Cluster struct {
+	redis    *RedisClient
+	pubsub   *RedisPubSub
+	id       string
+	url      string
+	affinity string
+	prefix   string
+	ttl      time.Duration
+	cancel   context.CancelFunc
+
+	leader  atomic.Bool
+	mu      sync.Mutex
+	members []clusterMember
+	changed chan struct{}
+}
+
+// clusterMember é uma réplica viva, com a URL em que as outras a alcançam
+// (REPLICA_URL)
+type clusterMember struct {
+	ID  string `json:"id"`
+	URL string `json:"url,omitempty"`
+}
+
+// NewCluster conecta ao Redis. id identifica a réplica (REPLICA_ID; padrão:
+// hostname-pid, o nome do pod no Kubernetes) e replicaURL é o endereço para
+// onde as outras réplicas encaminham os clientes dos tenants desta.
+func NewCluster(redisURL, id, replicaURL, affinity, prefix string, ttl time.Duration) (*Cluster, error) {
+	client, err := NewRedisClient(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.Do("PING"); err != nil {
+		return nil, fmt.Errorf("redis indisponível: %w", err)
+	}
+	if id == "" {
+		host, _ := os.Hostname()
+		id = host + "-" + strconv.Itoa(os.Getpid())
+	}
+	switch affinity {
+	case "":
+		affinity = affinityProxy
+	case affinityProxy, affinityRedirect, affinityOff:
+	default:
+		return nil, fmt.Errorf("CLUSTER_AFFINITY inválido %q (use proxy, redirect ou off)", affinity)
+	}
+	return &Cluster{
+		redis:    client,
+		pubsub:   client.PubSub(),
+		id:       id,
+		url:      strings.TrimSuffix(replicaURL, "/"),
+		affinity: affinity,
+		prefix:   prefix,
+		ttl:      ttl,
+		changed:  make(chan struct{}),
+	}, nil
+}
+
+func (c *Cluster) key(name string) string {
+	return c.prefix + name
+}
+
+// Start registra a réplica e inicia a eleição de líder. O primeiro registro
+// é síncrono, para os tenants já serem distribuídos entre as réplicas vivas.
+func (c *Cluster) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.heartbeat()
+	go func() {
+		ticker := time.NewTicker(c.ttl / 3)
+		defer ticker.Stop()
+		lastContact := time.Now()
+		for {
+			switch err := c.heartbeat(); {
+			case err == nil:
+				lastContact = time.Now()
+			case time.Since(lastContact) > c.ttl:
+				// Redis fora por mais de uma lease: cada réplica mantém os
+				// próprios user data streams, como sem cluster
+				c.setLeader(false)
+				c.setMembers(nil)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// heartbeat renova a presença da réplica e a liderança e atualiza a lista
+// de réplicas vivas
+func (c *Cluster) heartbeat() error {
+	leader, err := c.acquire(c.key("leader"))
+	if err != nil {
+		return err
+	}
+	c.setLeader(leader)
+
+	// Réplicas vivas: conjunto ordenado pela validade do registro
+	now := time.Now()
+	members, urls := c.key("members"), c.key("member-urls")
+	expiry := strconv.FormatInt(now.Add(c.ttl).UnixMilli(), 10)
+	if _, err := c.redis.Do("ZADD", members, expiry, c.id); err != nil {
+		return err
+	}
+	if c.url != "" {
+		c.redis.Do("HSET", urls, c.id, c.url)
+	}
+	nowMs := strconv.FormatInt(now.UnixMilli(), 10)
+	if leader {
+		expired, _ := c.redis.Do("ZRANGEBYSCORE", members, "-inf", "("+nowMs)
+		if ids := redisStrings(expired); len(ids) > 0 {
+			c.redis.Do(append([]string{"ZREM", members}, ids...)...)
+			c.redis.Do(append([]string{"HDEL", urls}, ids...)...)
+		}
+	}
+	reply, err := c.redis.Do("ZRANGEBYSCORE", members, nowMs, "+inf")
+	if err != nil {
+		return err
+	}
+	ids := redisStrings(reply)
+	sort.Strings(ids)
+	reply, err = c.redis.Do(append([]string{"HMGET", urls}, ids...)...)
+	if err != nil {
+		return err
+	}
+	addrs := redisStrings(reply)
+	alive := make([]clusterMember, len(ids))
+	for i, id := range ids {
+		alive[i].ID = id
+		if i < len(addrs) {
+			alive[i].URL = addrs[i]
+		}
+	}
+	c.setMembers(alive)
+	return nil
+}
+
+// redisStrings converte uma resposta em lista (ZRANGE, HMGET, ...); itens
+// nulos viram ""
+func redisStrings(reply interface{}) []string {
+	items, _ := reply.([]interface{})
+	values := make([]string, len(items))
+	for i, item := range items {
+		data, _ := item.([]byte)
+		values[i] = string(data)
+	}
+	return values
+}
+
+// Close libera a liderança, retira a réplica da lista e fecha as conexões
+// com o Redis
+func (c *Cluster) Close() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.release(c.key("leader"))
+	c.redis.Do("ZREM", c.key("members"), c.id)
+	c.redis.Do("HDEL", c.key("member-urls"), c.id)
+	c.setLeader(false)
+	c.pubsub.Close()
+	c.redis.Close()
+}
+
+func (c *Cluster) setLeader(leader bool) {
+	if c.leader.Swap(leader) == leader {
+		return
+	}
+	// log.Printf("👑 Réplica %s: líder = %v", c.id, leader)
+}
+
+// IsLeader indica se esta réplica é a líder
+func (c *Cluster) IsLeader() bool {
+	return c.leader.Load()
+}
+
+// setMembers atualiza as réplicas vivas, avisando quem acompanha a
+// distribuição dos tenants quando ela muda
+func (c *Cluster) setMembers(members []clusterMember) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(members) == len(c.members) {
+		same := true
+		for i := range members {
+			same = same && members[i] == c.members[i]
+		}
+		if same {
+			return
+		}
+	}
+	// log.Printf("🧩 Réplicas vivas: %d", len(members))
+	c.members = members
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Members retorna as réplicas vivas
+func (c *Cluster) Members() []clusterMember {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]clusterMember(nil), c.members...)
+}
+
+// Changed retorna um canal fechado na próxima mudança das réplicas vivas
+func (c *Cluster) Changed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
+
+// TenantOwner escolhe a réplica do user data stream do tenant por rendezvous
+// hashing: a entrada ou saída de uma réplica só move os tenants dela. Sem a
+// lista de réplicas (Redis fora), o tenant fica com esta réplica.
+func (c *Cluster) TenantOwner(tenant string) clusterMember {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	owner := clusterMember{ID: c.id, URL: c.url}
+	var best uint64
+	for _, member := range c.members {
+		sum := sha256.Sum256([]byte(tenant + "\x00" + member.ID))
+		if score := binary.BigEndian.Uint64(sum[:8]); score >= best {
+			owner, best = member, score
+		}
+	}
+	return owner
+}
+
+// OwnsTenant indica se o user data stream do tenant cabe a esta réplica
+func (c *Cluster) OwnsTenant(tenant string) bool {
+	return c.TenantOwner(tenant).ID == c.id
+}
+
+// acquire obtém ou renova a lease da chave para esta réplica. Retorna false
+// se outra réplica é a dona.
+func (c *Cluster) acquire(key string) (bool, error) {
+	ttl := strconv.FormatInt(c.ttl.Milliseconds(), 10)
+	renewed, err := c.redis.Do("EVAL", leaseRenewScript, "1", key, c.id, ttl)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := renewed.(int64); n == 1 {
+		return true, nil
+	}
+	set, err := c.redis.Do("SET", key, c.id, "NX", "PX", ttl)
+	if err != nil {
+		return false, err
+	}
+	return set == "OK", nil
+}
+
+// release libera a lease se esta réplica for a dona
+func (c *Cluster) release(key string) {
+	c.redis.Do("EVAL", leaseReleaseScript, "1", key, c.id)
+}
+
+// owner retorna a réplica dona da lease ("" sem dona)
+func (c *Cluster) owner(key string) string {
+	value, _ := c.redis.Do("GET", key)
+	owner, _ := value.([]byte)
+	return string(owner)
+}
+
+func (c *Cluster) publish(channel string, data []byte) {
+	c.redis.Do("PUBLISH", channel, string(data))
+}
+
+// listenKey retorna o listenKey do tenant guardado pela réplica anterior
+func (c *Cluster) listenKey(tenant string) string {
+	return c.owner(c.key("listenkey:" + tenant))
+}
+
+func (c *Cluster) storeListenKey(tenant, listenKey string) {
+	c.redis.Do("SET", c.key("listenkey:"+tenant), listenKey, "PX", strconv.FormatInt(clusterListenKeyLifetime.Milliseconds(), 10))
+}
+
+// runShared coordena o stream entre as réplicas: a dona da lease consome a
+// Binance e publica no Redis; as demais recebem pelo canal do stream e
+// tentam assumir a lease a cada ttl/3, para cobrir a queda da dona. Sem
+// Redis, a réplica consome a Binance diretamente.
+func (h *StreamHub) runShared(ctx context.Context, us *upstreamStream) {
+	c := h.cluster
+	key := c.key("stream:" + us.name)
+	defer c.release(key)
+	for ctx.Err() == nil {
+		owner, err := c.acquire(key)
+		if owner || err != nil {
+			h.ownStream(ctx, us, key)
+		} else {
+			h.followStream(ctx, us, key)
+		}
+	}
+}
+
+// ownStream consome a Binance enquanto esta réplica mantiver a lease
+func (h *StreamHub) ownStream(ctx context.Context, us *upstreamStream, key string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	us.owner.Store(true)
+	defer us.owner.Store(false)
+	go func() {
+		ticker := time.NewTicker(h.cluster.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// Outra réplica assumiu (ex: lease expirada numa pausa longa)
+				if owner, err := h.cluster.acquire(key); !owner && err == nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	h.runUpstream(ctx, us)
+}
+
+// followStream recebe o stream pelo Redis até conseguir a lease
+func (h *StreamHub) followStream(ctx context.Context, us *upstreamStream, key string) {
+	channel := h.cluster.key("stream:" + us.name)
+	h.cluster.pubsub.Subscribe(channel, func(data []byte) { h.dispatch(us, data) })
+	defer h.cluster.pubsub.Unsubscribe(channel)
+
+	ticker := time.NewTicker(h.cluster.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if owner, err := h.cluster.acquire(key); owner || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// holdTenant renova a lease do user data stream do tenant e fecha conn
+// quando o tenant passa a outra réplica (nova réplica na lista ou lease
+// perdida), para a sessão recomeçar como seguidora
+func (s *UserStream) holdTenant(ctx context.Context, cluster *Cluster, lease string, conn interface{ Close() error }) {
+	ticker := time.NewTicker(cluster.ttl / 3)
+	defer ticker.Stop()
+	for {
+		changed := cluster.Changed()
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			if !cluster.OwnsTenant(s.tenant.Name) {
+				conn.Close()
+				return
+			}
+		case <-ticker.C:
+			if owner, err := cluster.acquire(lease); !owner && err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// TenantAffinity leva as conexões de user data stream de um tenant à réplica
+// dona do seu listenKey (CLUSTER_AFFINITY): proxy encaminha a requisição
+// (inclusive WebSocket e SSE) e redirect responde 307 para a URL da dona.
+// Sem a URL da dona, ou se ela não responde, a réplica atende localmente com
+// os eventos recebidos pelo Redis.
+func (p *ProxyServer) TenantAffinity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cluster := p.cluster
+		if cluster == nil {
+			c.Next()
+			return
+		}
+		c.Header("X-Proxy-Replica", cluster.id)
+		tenant := p.requestTenant(c.Request)
+		if tenant == nil || cluster.affinity == affinityOff || c.GetHeader(affinityHeader) != "" {
+			c.Next()
+			return
+		}
+		owner := cluster.TenantOwner(tenant.Name)
+		target, err := url.Parse(owner.URL)
+		if owner.ID == cluster.id || owner.URL == "" || err != nil {
+			c.Next()
+			return
+		}
+
+		if cluster.affinity == affinityRedirect {
+			c.Header("X-Proxy-Replica", owner.ID)
+			c.Redirect(http.StatusTemporaryRedirect, owner.URL+c.Request.URL.RequestURI())
+			c.Abort()
+			return
+		}
+
+		// A resposta da dona traz o próprio X-Proxy-Replica
+		c.Writer.Header().Del("X-Proxy-Replica")
+		failed := false
+		forward := &httputil.ReverseProxy{
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.SetURL(target)
+				r.SetXForwarded()
+				r.Out.Header.Set(affinityHeader, cluster.id)
+			},
+			FlushInterval: -1,
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				// log.Printf("[WARN] Réplica %s indisponível para %s: %v", owner.ID, tenant.Name, err)
+				failed = true
+			},
+		}
+		defer func() {
+			// Cliente desconectado no meio do stream encaminhado
+			if err := recover(); err != nil && err != http.ErrAbortHandler {
+				panic(err)
+			}
+		}()
+		// Streams longos não podem ser limitados pelo WriteTimeout do servidor
+		http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+		forward.ServeHTTP(c.Writer, c.Request)
+		if failed && !c.Writer.Written() {
+			c.Header("X-Proxy-Replica", cluster.id)
+			c.Next()
+			return
+		}
+		c.Abort()
+	}
+}
+
+// clusterTenant é um tenant em /admin/cluster
+type clusterTenant struct {
+	Tenant string `json:"tenant"`
+	Owner  string `json:"owner"`
+	Local  bool   `json:"local"`
+}
+
+// clusterStream é um stream em /admin/cluster
+type clusterStream struct {
+	Stream      string `json:"stream"`
+	Owner       string `json:"owner"`
+	Local       bool   `json:"local"`
+	Subscribers int    `json:"subscribers"`
+}
+
+// ClusterStatus mostra a coordenação entre réplicas
+// @Summary Estado do cluster
+// @Description Réplica atual, líder, réplicas vivas, a réplica dona do user data stream de cada tenant e a dona de cada stream assinado nesta réplica
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/cluster [get]
+func (p *ProxyServer) ClusterStatus(c *gin.Context) {
+	if p.cluster == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Modo cluster desabilitado (REDIS_URL)")
+		return
+	}
+	p.hub.mu.Lock()
+	streams := make([]clusterStream, 0, len(p.hub.streams))
+	for name, us := range p.hub.streams {
+		streams = append(streams, clusterStream{Stream: name, Local: us.owner.Load(), Subscribers: len(us.subscribers)})
+	}
+	p.hub.mu.Unlock()
+	for i := range streams {
+		streams[i].Owner = p.cluster.owner(p.cluster.key("stream:" + streams[i].Stream))
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].Stream < streams[j].Stream })
+
+	tenants := []clusterTenant{}
+	for _, name := range p.tenants.Names() {
+		owner := p.cluster.TenantOwner(name)
+		tenants = append(tenants, clusterTenant{Tenant: name, Owner: owner.ID, Local: owner.ID == p.cluster.id})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"replica":  p.cluster.id,
+		"url":      p.cluster.url,
+		"affinity": p.cluster.affinity,
+		"leader":   p.cluster.owner(p.cluster.key("leader")),
+		"isLeader": p.cluster.IsLeader(),
+		"members":  p.cluster.Members(),
+		"tenants":  tenants,
+		"streams":  streams,
+	})
+}
@@ -0,0 +1,1131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Camadas de compatibilidade: expõem os dados da Binance no formato de outras
+// APIs, para que aplicações escritas contra elas usem o proxy sem mudanças.
+// COMPAT_APIS lista as camadas ativas (ccxt, coinbase).
+const (
+	compatCCXT     = "ccxt"
+	compatCoinbase = "coinbase"
+
+	// Máximo de candles por chamada na API da Coinbase
+	coinbaseMaxCandles = 300
+)
+
+// coinbaseGranularities converte a granularidade da Coinbase (segundos) no
+// intervalo de klines da Binance
+var coinbaseGranularities = map[int]string{
+	60:    "1m",
+	300:   "5m",
+	900:   "15m",
+	3600:  "1h",
+	21600: "6h",
+	86400: "1d",
+}
+
+// enabledCompatAPIs lê COMPAT_APIS (ex: ccxt,coinbase); vazio desativa
+func enabledCompatAPIs() map[string]bool {
+	enabled := map[string]bool{}
+	for _, name := range strings.Split(os.Getenv("COMPAT_APIS"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			enabled[name] = true
+		}
+	}
+	return enabled
+}
+
+// registerCompatRoutes registra as camadas ativas em /compat/<api>
+func registerCompatRoutes(router *gin.Engine, proxy *ProxyServer) {
+	enabled := enabledCompatAPIs()
+	if enabled[compatCCXT] {
+		ccxt := router.Group("/compat/ccxt")
+		ccxt.GET("/markets", proxy.CCXTMarkets)
+		ccxt.GET("/ticker", proxy.CCXTTicker)
+		ccxt.GET("/tickers", proxy.CCXTTickers)
+		ccxt.GET("/ohlcv", proxy.CCXTOHLCV)
+		ccxt.GET("/orderbook", proxy.CCXTOrderBook)
+		ccxt.GET("/orders/open", proxy.CCXTOpenOrders)
+		ccxt.POST("/orders", proxy.CCXTCreateOrder)
+		ccxt.DELETE("/orders/:id", proxy.CCXTCancelOrder)
+	}
+	if enabled[compatCoinbase] {
+		coinbase := router.Group("/compat/coinbase")
+		coinbase.GET("/products", proxy.CoinbaseProducts)
+		coinbase.GET("/products/:id", proxy.CoinbaseProduct)
+		coinbase.GET("/products/:id/ticker", proxy.CoinbaseTicker)
+		coinbase.GET("/products/:id/stats", proxy.CoinbaseStats)
+		coinbase.GET("/products/:id/candles", proxy.CoinbaseCandles)
+		coinbase.GET("/products/:id/book", proxy.CoinbaseBook)
+		coinbase.GET("/orders", proxy.CoinbaseOpenOrders)
+		coinbase.POST("/orders", proxy.CoinbaseCreateOrder)
+		coinbase.DELETE("/orders/:id", proxy.CoinbaseCancelOrder)
+	}
+}
+
+// compatMarket resolve um símbolo em formato unificado (BTC/USDT), de
+// produto da Coinbase (BTC-USDT) ou da Binance (BTCUSDT), respondendo 400
+// quando ele não existe
+func (p *ProxyServer) compatMarket(c *gin.Context, raw string) (*SymbolInfo, bool) {
+	raw = strings.NewReplacer("/", "", "-", "", "_", "").Replace(raw)
+	symbols, err := normalizeSymbols([]string{raw})
+	if err != nil || len(symbols) == 0 {
+		respondError(c, http.StatusBadRequest, -1102, "Símbolo ausente ou inválido: "+raw)
+		return nil, false
+	}
+	info, err := p.market.ExchangeInfo(c.Request.Context())
+	if err != nil {
+		respondUpstreamError(c, err)
+		return nil, false
+	}
+	market, ok := info.Symbol(symbols[0])
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1121, "Símbolo inválido: "+symbols[0])
+		return nil, false
+	}
+	return market, true
+}
+
+// parseDecimal converte os decimais em string da Binance; vazio vira 0
+func parseDecimal(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+// ---- CCXT ----
+
+// ccxtMarket segue a estrutura unificada de mercado do CCXT
+type ccxtMarket struct {
+	ID        string                `json:"id"`
+	Symbol    string                `json:"symbol"`
+	Base      string                `json:"base"`
+	Quote     string                `json:"quote"`
+	BaseID    string                `json:"baseId"`
+	QuoteID   string                `json:"quoteId"`
+	Type      string                `json:"type"`
+	Spot      bool                  `json:"spot"`
+	Active    bool                  `json:"active"`
+	Precision map[string]float64    `json:"precision"`
+	Limits    map[string]ccxtMinMax `json:"limits"`
+}
+
+type ccxtMinMax struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// ccxtLimit usa null para limites que a Binance não define (zero)
+func ccxtLimit(min, max float64) ccxtMinMax {
+	var limit ccxtMinMax
+	if min > 0 {
+		limit.Min = &min
+	}
+	if max > 0 {
+		limit.Max = &max
+	}
+	return limit
+}
+
+func ccxtSymbol(info *SymbolInfo) string {
+	return info.BaseAsset + "/" + info.QuoteAsset
+}
+
+func newCCXTMarket(info *SymbolInfo) ccxtMarket {
+	f := info.ParsedFilters()
+	return ccxtMarket{
+		ID:      info.Symbol,
+		Symbol:  ccxtSymbol(info),
+		Base:    info.BaseAsset,
+		Quote:   info.QuoteAsset,
+		BaseID:  info.BaseAsset,
+		QuoteID: info.QuoteAsset,
+		Type:    "spot",
+		Spot:    true,
+		Active:  info.Status == "TRADING",
+		// Precisão no modo TICK_SIZE do CCXT (o menor incremento)
+		Precision: map[string]float64{"amount": f.StepSize, "price": f.TickSize},
+		Limits: map[string]ccxtMinMax{
+			"amount": ccxtLimit(f.MinQty, f.MaxQty),
+			"price":  ccxtLimit(f.MinPrice, f.MaxPrice),
+			"cost":   ccxtLimit(f.MinNotional, f.MaxNotional),
+		},
+	}
+}
+
+// ccxtTicker segue a estrutura unificada de ticker do CCXT
+type ccxtTicker struct {
+	Symbol        string     `json:"symbol"`
+	Timestamp     int64      `json:"timestamp"`
+	Datetime      string     `json:"datetime"`
+	High          float64    `json:"high"`
+	Low           float64    `json:"low"`
+	Bid           float64    `json:"bid"`
+	BidVolume     float64    `json:"bidVolume"`
+	Ask           float64    `json:"ask"`
+	AskVolume     float64    `json:"askVolume"`
+	VWAP          float64    `json:"vwap"`
+	Open          float64    `json:"open"`
+	Close         float64    `json:"close"`
+	Last          float64    `json:"last"`
+	PreviousClose *float64   `json:"previousClose"`
+	Change        float64    `json:"change"`
+	Percentage    float64    `json:"percentage"`
+	Average       float64    `json:"average"`
+	BaseVolume    float64    `json:"baseVolume"`
+	QuoteVolume   float64    `json:"quoteVolume"`
+	Info          *Ticker24h `json:"info"`
+}
+
+func newCCXTTicker(info *SymbolInfo, t *Ticker24h) ccxtTicker {
+	open, last := parseDecimal(t.OpenPrice), parseDecimal(t.LastPrice)
+	return ccxtTicker{
+		Symbol:      ccxtSymbol(info),
+		Timestamp:   t.CloseTime,
+		Datetime:    ccxtDatetime(t.CloseTime),
+		High:        parseDecimal(t.HighPrice),
+		Low:         parseDecimal(t.LowPrice),
+		Bid:         parseDecimal(t.BidPrice),
+		BidVolume:   parseDecimal(t.BidQty),
+		Ask:         parseDecimal(t.AskPrice),
+		AskVolume:   parseDecimal(t.AskQty),
+		VWAP:        parseDecimal(t.WeightedAvgPrice),
+		Open:        open,
+		Close:       last,
+		Last:        last,
+		Change:      parseDecimal(t.PriceChange),
+		Percentage:  parseDecimal(t.PriceChangePercent),
+		Average:     (open + last) / 2,
+		BaseVolume:  parseDecimal(t.Volume),
+		QuoteVolume: parseDecimal(t.QuoteVolume),
+		Info:        t,
+	}
+}
+
+// ccxtDatetime é o timestamp em ISO 8601 com milissegundos, como no CCXT
+func ccxtDatetime(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return time.UnixMilli(ms).UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// ccxtOrder segue a estrutura unificada de ordem do CCXT
+type ccxtOrder struct {
+	ID            string    `json:"id"`
+	ClientOrderID string    `json:"clientOrderId"`
+	Timestamp     int64     `json:"timestamp"`
+	Datetime      string    `json:"datetime"`
+	LastUpdate    int64     `json:"lastUpdateTimestamp"`
+	Symbol        string    `json:"symbol"`
+	Type          string    `json:"type"`
+	TimeInForce   string    `json:"timeInForce,omitempty"`
+	Side          string    `json:"side"`
+	Price         float64   `json:"price"`
+	StopPrice     float64   `json:"stopPrice,omitempty"`
+	Amount        float64   `json:"amount"`
+	Filled        float64   `json:"filled"`
+	Remaining     float64   `json:"remaining"`
+	Cost          float64   `json:"cost"`
+	Average       *float64  `json:"average"`
+	Status        string    `json:"status"`
+	Info          openOrder `json:"info"`
+}
+
+// ccxtOrderStatus converte o status da Binance nos estados do CCXT
+func ccxtOrderStatus(status string) string {
+	switch status {
+	case "NEW", "PARTIALLY_FILLED", "PENDING_NEW":
+		return "open"
+	case "FILLED":
+		return "closed"
+	case "CANCELED", "PENDING_CANCEL":
+		return "canceled"
+	case "REJECTED":
+		return "rejected"
+	}
+	return "expired"
+}
+
+func newCCXTOrder(info *SymbolInfo, o openOrder) ccxtOrder {
+	amount, filled := parseDecimal(o.OrigQty), parseDecimal(o.ExecutedQty)
+	cost := parseDecimal(o.CummulativeQuoteQty)
+	order := ccxtOrder{
+		ID:            strconv.FormatInt(o.OrderID, 10),
+		ClientOrderID: o.ClientOrderID,
+		Timestamp:     o.Time,
+		Datetime:      ccxtDatetime(o.Time),
+		LastUpdate:    o.UpdateTime,
+		Symbol:        o.Symbol,
+		Type:          strings.ToLower(o.Type),
+		TimeInForce:   o.TimeInForce,
+		Side:          strings.ToLower(o.Side),
+		Price:         parseDecimal(o.Price),
+		StopPrice:     parseDecimal(o.StopPrice),
+		Amount:        amount,
+		Filled:        filled,
+		Remaining:     amount - filled,
+		Cost:          cost,
+		Status:        ccxtOrderStatus(o.Status),
+		Info:          o,
+	}
+	if info != nil {
+		order.Symbol = ccxtSymbol(info)
+	}
+	if filled > 0 {
+		average := cost / filled
+		order.Average = &average
+	}
+	return order
+}
+
+// CCXTMarkets lista os mercados no formato de fetchMarkets do CCXT
+// @Summary Mercados (CCXT)
+// @Description Símbolos do exchangeInfo na estrutura unificada de mercado do CCXT (requer COMPAT_APIS com ccxt)
+// @Tags Compat
+// @Produce json
+// @Success 200 {array} map[string]interface{}
+// @Router /compat/ccxt/markets [get]
+func (p *ProxyServer) CCXTMarkets(c *gin.Context) {
+	info, err := p.market.ExchangeInfo(c.Request.Context())
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	markets := make([]ccxtMarket, 0, len(info.Symbols))
+	for i := range info.Symbols {
+		markets = append(markets, newCCXTMarket(&info.Symbols[i]))
+	}
+	c.JSON(http.StatusOK, markets)
+}
+
+// CCXTTicker retorna o ticker de 24h de um símbolo no formato do CCXT
+// @Summary Ticker (CCXT)
+// @Description Estatísticas de 24h na estrutura unificada de ticker do CCXT
+// @Tags Compat
+// @Produce json
+// @Param symbol query string true "Símbolo unificado (ex: BTC/USDT)"
+// @Success 200 {object} map[string]interface{}
+// @Router /compat/ccxt/ticker [get]
+func (p *ProxyServer) CCXTTicker(c *gin.Context) {
+	market, ok := p.compatMarket(c, c.Query("symbol"))
+	if !ok {
+		return
+	}
+	tickers, err := p.market.Tickers24h(c.Request.Context())
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	t, found := tickers[market.Symbol]
+	if !found {
+		respondError(c, http.StatusNotFound, -1121, "Sem ticker para "+market.Symbol)
+		return
+	}
+	c.JSON(http.StatusOK, newCCXTTicker(market, t))
+}
+
+// CCXTTickers retorna os tickers indexados pelo símbolo unificado, como fetchTickers
+// @Summary Tickers (CCXT)
+// @Description Tickers de 24h indexados pelo símbolo unificado; sem symbols, retorna todos
+// @Tags Compat
+// @Produce json
+// @Param symbols query string false "Símbolos separados por vírgula (ex: BTC/USDT,ETH/USDT)"
+// @Success 200 {object} map[string]interface{}
+// @Router /compat/ccxt/tickers [get]
+func (p *ProxyServer) CCXTTickers(c *gin.Context) {
+	ctx := c.Request.Context()
+	info, err := p.market.ExchangeInfo(ctx)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	tickers, err := p.market.Tickers24h(ctx)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	var markets []*SymbolInfo
+	if raw := c.Query("symbols"); raw != "" {
+		for _, symbol := range strings.Split(raw, ",") {
+			market, ok := p.compatMarket(c, symbol)
+			if !ok {
+				return
+			}
+			markets = append(markets, market)
+		}
+	} else {
+		for i := range info.Symbols {
+			markets = append(markets, &info.Symbols[i])
+		}
+	}
+
+	result := make(map[string]ccxtTicker, len(markets))
+	for _, market := range markets {
+		if t, ok := tickers[market.Symbol]; ok {
+			result[ccxtSymbol(market)] = newCCXTTicker(market, t)
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// CCXTOHLCV retorna candles no formato [timestamp, open, high, low, close, volume]
+// @Summary OHLCV (CCXT)
+// @Description Candles no formato de fetchOHLCV do CCXT; timeframe usa os intervalos da Binance
+// @Tags Compat
+// @Produce json
+// @Param symbol query string true "Símbolo unificado (ex: BTC/USDT)"
+// @Param timeframe query string false "Intervalo (padrão 1m)"
+// @Param since query int false "Início em ms"
+// @Param limit query int false "Máximo de candles"
+// @Success 200 {array} []number
+// @Router /compat/ccxt/ohlcv [get]
+func (p *ProxyServer) CCXTOHLCV(c *gin.Context) {
+	market, ok := p.compatMarket(c, c.Query("symbol"))
+	if !ok {
+		return
+	}
+	since, _ := strconv.ParseInt(c.Query("since"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	klines, err := p.market.Klines(c.Request.Context(), market.Symbol, c.DefaultQuery("timeframe", "1m"), limit, since, 0)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	rows := make([][6]float64, len(klines))
+	for i, k := range klines {
+		rows[i] = [6]float64{float64(k.OpenTime), parseDecimal(k.Open), parseDecimal(k.High),
+			parseDecimal(k.Low), parseDecimal(k.Close), parseDecimal(k.Volume)}
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// CCXTOrderBook retorna o livro de ofertas no formato de fetchOrderBook
+// @Summary Livro de ofertas (CCXT)
+// @Description Livro de ofertas com níveis [preço, quantidade] numéricos, como no CCXT
+// @Tags Compat
+// @Produce json
+// @Param symbol query string true "Símbolo unificado (ex: BTC/USDT)"
+// @Param limit query int false "Níveis por lado (padrão 100)"
+// @Success 200 {object} map[string]interface{}
+// @Router /compat/ccxt/orderbook [get]
+func (p *ProxyServer) CCXTOrderBook(c *gin.Context) {
+	market, ok := p.compatMarket(c, c.Query("symbol"))
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		respondError(c, http.StatusBadRequest, -1100, "limit inválido")
+		return
+	}
+	book, err := p.market.Depth(c.Request.Context(), market.Symbol, limit)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	now := time.Now().UnixMilli()
+	c.JSON(http.StatusOK, gin.H{
+		"symbol":    ccxtSymbol(market),
+		"bids":      book.Bids,
+		"asks":      book.Asks,
+		"timestamp": now,
+		"datetime":  ccxtDatetime(now),
+		"nonce":     book.LastUpdateID,
+	})
+}
+
+// compatOpenOrders busca as ordens abertas do tenant, opcionalmente de um símbolo
+func (p *ProxyServer) compatOpenOrders(ctx context.Context, tenant *Tenant, symbol string) ([]openOrder, error) {
+	params := url.Values{}
+	if symbol != "" {
+		params.Set("symbol", symbol)
+	}
+	body, err := p.signedRequest(ctx, tenant, http.MethodGet, "/api/v3/openOrders", params)
+	if err != nil {
+		return nil, err
+	}
+	var orders []openOrder
+	if err := json.Unmarshal(body, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// compatPlaceOrder valida a ordem e a envia em nome do tenant, respondendo o
+// erro ao cliente quando algo falha
+func (p *ProxyServer) compatPlaceOrder(c *gin.Context, tenant *Tenant, order *orderRequest) (openOrder, bool) {
+	ctx := c.Request.Context()
+	info, err := p.market.ExchangeInfo(ctx)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return openOrder{}, false
+	}
+	if verr := order.normalize(info); verr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": -1013, "msg": verr.Message, "message": verr.Message, "filterViolations": verr.FilterViolations})
+		return openOrder{}, false
+	}
+	params := order.params()
+	params.Set("newOrderRespType", "RESULT")
+	body, err := p.signedRequest(ctx, tenant, http.MethodPost, "/api/v3/order", params)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return openOrder{}, false
+	}
+	var result placedOrderResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Resposta inválida de /order: "+err.Error())
+		return openOrder{}, false
+	}
+	if result.Time == 0 {
+		result.Time = result.TransactTime
+	}
+	if result.UpdateTime == 0 {
+		result.UpdateTime = result.TransactTime
+	}
+	return result.openOrder, true
+}
+
+// compatCancelOrder cancela a ordem id do símbolo em nome do tenant
+func (p *ProxyServer) compatCancelOrder(c *gin.Context, tenant *Tenant, symbol, id string) (openOrder, bool) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "id de ordem inválido")
+		return openOrder{}, false
+	}
+	params := url.Values{"symbol": {symbol}, "orderId": {id}}
+	body, err := p.signedRequest(c.Request.Context(), tenant, http.MethodDelete, "/api/v3/order", params)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return openOrder{}, false
+	}
+	var result placedOrderResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Resposta inválida de /order: "+err.Error())
+		return openOrder{}, false
+	}
+	result.UpdateTime = result.TransactTime
+	return result.openOrder, true
+}
+
+// CCXTOpenOrders lista as ordens abertas no formato de fetchOpenOrders
+// @Summary Ordens abertas (CCXT)
+// @Description Ordens abertas do tenant na estrutura unificada de ordem do CCXT (requer token de tenant)
+// @Tags Compat
+// @Produce json
+// @Param symbol query string false "Símbolo unificado (ex: BTC/USDT)"
+// @Success 200 {array} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /compat/ccxt/orders/open [get]
+func (p *ProxyServer) CCXTOpenOrders(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+	symbol := ""
+	if raw := c.Query("symbol"); raw != "" {
+		market, ok := p.compatMarket(c, raw)
+		if !ok {
+			return
+		}
+		symbol = market.Symbol
+	}
+	orders, err := p.compatOpenOrders(c.Request.Context(), tenant, symbol)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	info, _ := p.market.ExchangeInfo(c.Request.Context())
+	result := make([]ccxtOrder, len(orders))
+	for i, o := range orders {
+		var market *SymbolInfo
+		if info != nil {
+			market, _ = info.Symbol(o.Symbol)
+		}
+		result[i] = newCCXTOrder(market, o)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ccxtOrderRequest são os argumentos de createOrder do CCXT
+type ccxtOrderRequest struct {
+	Symbol string    `json:"symbol"`
+	Type   string    `json:"type"`
+	Side   string    `json:"side"`
+	Amount flexFloat `json:"amount"`
+	Price  flexFloat `json:"price"`
+	Params struct {
+		TimeInForce   string    `json:"timeInForce"`
+		StopPrice     flexFloat `json:"stopPrice"`
+		ClientOrderID string    `json:"clientOrderId"`
+		Cost          flexFloat `json:"cost"`
+	} `json:"params"`
+}
+
+// CCXTCreateOrder envia uma ordem com os argumentos de createOrder do CCXT
+// @Summary Criar ordem (CCXT)
+// @Description Recebe symbol, type, side, amount, price e params (timeInForce, stopPrice, clientOrderId, cost) e responde a ordem no formato do CCXT (requer token de tenant)
+// @Tags Compat
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /compat/ccxt/orders [post]
+func (p *ProxyServer) CCXTCreateOrder(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+	var req ccxtOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "Corpo inválido: "+err.Error())
+		return
+	}
+	market, ok := p.compatMarket(c, req.Symbol)
+	if !ok {
+		return
+	}
+	order := &orderRequest{
+		Symbol:           market.Symbol,
+		Side:             req.Side,
+		Type:             req.Type,
+		TimeInForce:      req.Params.TimeInForce,
+		Quantity:         req.Amount,
+		Price:            req.Price,
+		StopPrice:        req.Params.StopPrice,
+		NewClientOrderID: req.Params.ClientOrderID,
+	}
+	// Ordem a mercado por valor em cotação (params.cost), como no CCXT
+	if strings.EqualFold(req.Type, "market") && req.Params.Cost > 0 {
+		order.Quantity = 0
+		order.QuoteOrderQty = req.Params.Cost
+	}
+	placed, ok := p.compatPlaceOrder(c, tenant, order)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newCCXTOrder(market, placed))
+}
+
+// CCXTCancelOrder cancela uma ordem como cancelOrder(id, symbol)
+// @Summary Cancelar ordem (CCXT)
+// @Description Cancela a ordem pelo id da Binance; symbol é obrigatório (requer token de tenant)
+// @Tags Compat
+// @Produce json
+// @Param id path string true "ID da ordem"
+// @Param symbol query string true "Símbolo unificado (ex: BTC/USDT)"
+// @Success 200 {object} map[string]interface{}
+// @Router /compat/ccxt/orders/{id} [delete]
+func (p *ProxyServer) CCXTCancelOrder(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+	market, ok := p.compatMarket(c, c.Query("symbol"))
+	if !ok {
+		return
+	}
+	canceled, ok := p.compatCancelOrder(c, tenant, market.Symbol, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newCCXTOrder(market, canceled))
+}
+
+// ---- Coinbase Exchange ----
+
+func coinbaseProductID(info *SymbolInfo) string {
+	return info.BaseAsset + "-" + info.QuoteAsset
+}
+
+// coinbaseTime formata milissegundos no formato de data da Coinbase
+func coinbaseTime(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format("2006-01-02T15:04:05.000000Z")
+}
+
+// coinbaseProduct segue o formato de GET /products da Coinbase Exchange
+type coinbaseProduct struct {
+	ID              string `json:"id"`
+	BaseCurrency    string `json:"base_currency"`
+	QuoteCurrency   string `json:"quote_currency"`
+	QuoteIncrement  string `json:"quote_increment"`
+	BaseIncrement   string `json:"base_increment"`
+	DisplayName     string `json:"display_name"`
+	MinMarketFunds  string `json:"min_market_funds"`
+	MarginEnabled   bool   `json:"margin_enabled"`
+	PostOnly        bool   `json:"post_only"`
+	LimitOnly       bool   `json:"limit_only"`
+	CancelOnly      bool   `json:"cancel_only"`
+	Status          string `json:"status"`
+	StatusMessage   string `json:"status_message"`
+	TradingDisabled bool   `json:"trading_disabled"`
+	FXStablecoin    bool   `json:"fx_stablecoin"`
+	AuctionMode     bool   `json:"auction_mode"`
+}
+
+func newCoinbaseProduct(info *SymbolInfo) coinbaseProduct {
+	f := info.ParsedFilters()
+	product := coinbaseProduct{
+		ID:             coinbaseProductID(info),
+		BaseCurrency:   info.BaseAsset,
+		QuoteCurrency:  info.QuoteAsset,
+		QuoteIncrement: formatFloat(f.TickSize),
+		BaseIncrement:  formatFloat(f.StepSize),
+		DisplayName:    info.BaseAsset + "/" + info.QuoteAsset,
+		MinMarketFunds: formatFloat(f.MinNotional),
+		MarginEnabled:  info.IsMarginAllowed,
+		Status:         "online",
+	}
+	if info.Status != "TRADING" {
+		product.Status = "offline"
+		product.StatusMessage = info.Status
+		product.TradingDisabled = true
+	}
+	return product
+}
+
+// coinbaseOrder segue o formato de ordem da Coinbase Exchange
+type coinbaseOrder struct {
+	ID            string `json:"id"`
+	ClientOID     string `json:"client_oid,omitempty"`
+	Price         string `json:"price,omitempty"`
+	Size          string `json:"size,omitempty"`
+	Funds         string `json:"funds,omitempty"`
+	ProductID     string `json:"product_id"`
+	Side          string `json:"side"`
+	Type          string `json:"type"`
+	TimeInForce   string `json:"time_in_force,omitempty"`
+	PostOnly      bool   `json:"post_only"`
+	Stop          string `json:"stop,omitempty"`
+	StopPrice     string `json:"stop_price,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	DoneAt        string `json:"done_at,omitempty"`
+	DoneReason    string `json:"done_reason,omitempty"`
+	FillFees      string `json:"fill_fees"`
+	FilledSize    string `json:"filled_size"`
+	ExecutedValue string `json:"executed_value"`
+	Status        string `json:"status"`
+	Settled       bool   `json:"settled"`
+}
+
+func newCoinbaseOrder(info *SymbolInfo, o openOrder) coinbaseOrder {
+	order := coinbaseOrder{
+		ID:            strconv.FormatInt(o.OrderID, 10),
+		ClientOID:     o.ClientOrderID,
+		ProductID:     o.Symbol,
+		Side:          strings.ToLower(o.Side),
+		Type:          "limit",
+		TimeInForce:   o.TimeInForce,
+		PostOnly:      o.Type == "LIMIT_MAKER",
+		CreatedAt:     coinbaseTime(o.Time),
+		FillFees:      "0",
+		FilledSize:    o.ExecutedQty,
+		ExecutedValue: o.CummulativeQuoteQty,
+	}
+	if info != nil {
+		order.ProductID = coinbaseProductID(info)
+	}
+	if o.Type == "MARKET" {
+		order.Type = "market"
+		if parseDecimal(o.OrigQuoteOrderQty) > 0 {
+			order.Funds = o.OrigQuoteOrderQty
+		} else {
+			order.Size = o.OrigQty
+		}
+	} else {
+		order.Price = o.Price
+		order.Size = o.OrigQty
+	}
+	if parseDecimal(o.StopPrice) > 0 {
+		order.StopPrice = o.StopPrice
+		order.Stop = "loss"
+		if strings.HasPrefix(o.Type, "TAKE_PROFIT") {
+			order.Stop = "entry"
+		}
+	}
+	switch o.Status {
+	case "NEW", "PARTIALLY_FILLED":
+		order.Status = "open"
+	case "PENDING_NEW":
+		order.Status = "pending"
+	case "REJECTED":
+		order.Status = "rejected"
+	default:
+		order.Status = "done"
+		order.Settled = true
+		order.DoneAt = coinbaseTime(o.UpdateTime)
+		order.DoneReason = "canceled"
+		if o.Status == "FILLED" {
+			order.DoneReason = "filled"
+		}
+	}
+	return order
+}
+
+// coinbaseProductParam resolve o :id de /products/:id
+func (p *ProxyServer) coinbaseProductParam(c *gin.Context) (*SymbolInfo, bool) {
+	return p.compatMarket(c, c.Param("id"))
+}
+
+// CoinbaseProducts lista os produtos no formato da Coinbase Exchange
+// @Summary Produtos (Coinbase)
+// @Description Símbolos do exchangeInfo no formato de GET /products da Coinbase Exchange (requer COMPAT_APIS com coinbase)
+// @Tags Compat
+// @Produce json
+// @Success 200 {array} map[string]interface{}
+// @Router /compat/coinbase/products [get]
+func (p *ProxyServer) CoinbaseProducts(c *gin.Context) {
+	info, err := p.market.ExchangeInfo(c.Request.Context())
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	products := make([]coinbaseProduct, 0, len(info.Symbols))
+	for i := range info.Symbols {
+		products = append(products, newCoinbaseProduct(&info.Symbols[i]))
+	}
+	c.JSON(http.StatusOK, products)
+}
+
+// CoinbaseProduct retorna um produto (ex: BTC-USDT)
+// @Summary Produto (Coinbase)
+// @Tags Compat
+// @Produce json
+// @Param id path string true "Produto (ex: BTC-USDT)"
+// @Success 200 {object} map[string]interface{}
+// @Router /compat/coinbase/products/{id} [get]
+func (p *ProxyServer) CoinbaseProduct(c *gin.Context) {
+	market, ok := p.coinbaseProductParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newCoinbaseProduct(market))
+}
+
+// coinbaseTicker24h busca o ticker de 24h do produto, respondendo 404 quando não existe
+func (p *ProxyServer) coinbaseTicker24h(c *gin.Context, market *SymbolInfo) (*Ticker24h, bool) {
+	tickers, err := p.market.Tickers24h(c.Request.Context())
+	if err != nil {
+		respondUpstreamError(c, err)
+		return nil, false
+	}
+	t, ok := tickers[market.Symbol]
+	if !ok {
+		respondError(c, http.StatusNotFound, -1121, "Sem ticker para "+market.Symbol)
+		return nil, false
+	}
+	return t, true
+}
+
+// CoinbaseTicker retorna o último negócio e o melhor bid/ask do produto
+// @Summary Ticker (Coinbase)
+// @Tags Compat
+// @Produce json
+// @Param id path string true "Produto (ex: BTC-USDT)"
+// @Success 200 {object} map[string]interface{}
+// @Router /compat/coinbase/products/{id}/ticker [get]
+func (p *ProxyServer) CoinbaseTicker(c *gin.Context) {
+	market, ok := p.coinbaseProductParam(c)
+	if !ok {
+		return
+	}
+	t, ok := p.coinbaseTicker24h(c, market)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"trade_id": t.LastID,
+		"price":    t.LastPrice,
+		"size":     t.LastQty,
+		"bid":      t.BidPrice,
+		"ask":      t.AskPrice,
+		"volume":   t.Volume,
+		"time":     coinbaseTime(t.CloseTime),
+	})
+}
+
+// CoinbaseStats retorna as estatísticas de 24h do produto
+// @Summary Estatísticas de 24h (Coinbase)
+// @Tags Compat
+// @Produce json
+// @Param id path string true "Produto (ex: BTC-USDT)"
+// @Success 200 {object} map[string]interface{}
+// @Router /compat/coinbase/products/{id}/stats [get]
+func (p *ProxyServer) CoinbaseStats(c *gin.Context) {
+	market, ok := p.coinbaseProductParam(c)
+	if !ok {
+		return
+	}
+	t, ok := p.coinbaseTicker24h(c, market)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"open":   t.OpenPrice,
+		"high":   t.HighPrice,
+		"low":    t.LowPrice,
+		"last":   t.LastPrice,
+		"volume": t.Volume,
+	})
+}
+
+// CoinbaseCandles retorna candles [time, low, high, open, close, volume], do
+// mais recente para o mais antigo, como a Coinbase
+// @Summary Candles (Coinbase)
+// @Tags Compat
+// @Produce json
+// @Param id path string true "Produto (ex: BTC-USDT)"
+// @Param granularity query int false "Segundos: 60, 300, 900, 3600, 21600 ou 86400 (padrão 60)"
+// @Param start query string false "Início (ISO 8601)"
+// @Param end query string false "Fim (ISO 8601)"
+// @Success 200 {array} []number
+// @Router /compat/coinbase/products/{id}/candles [get]
+func (p *ProxyServer) CoinbaseCandles(c *gin.Context) {
+	market, ok := p.coinbaseProductParam(c)
+	if !ok {
+		return
+	}
+	granularity, _ := strconv.Atoi(c.DefaultQuery("granularity", "60"))
+	interval, ok := coinbaseGranularities[granularity]
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1100, "granularity inválida: use 60, 300, 900, 3600, 21600 ou 86400")
+		return
+	}
+	var bounds [2]int64
+	for i, name := range []string{"start", "end"} {
+		if value := c.Query(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, -1100, name+" inválido (use ISO 8601)")
+				return
+			}
+			bounds[i] = t.UnixMilli()
+		}
+	}
+	klines, err := p.market.Klines(c.Request.Context(), market.Symbol, interval, coinbaseMaxCandles, bounds[0], bounds[1])
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	rows := make([][6]float64, 0, len(klines))
+	for i := len(klines) - 1; i >= 0; i-- {
+		k := klines[i]
+		rows = append(rows, [6]float64{float64(k.OpenTime / 1000), parseDecimal(k.Low), parseDecimal(k.High),
+			parseDecimal(k.Open), parseDecimal(k.Close), parseDecimal(k.Volume)})
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// CoinbaseBook retorna o livro no formato [preço, quantidade, número de ordens]
+// @Summary Livro de ofertas (Coinbase)
+// @Description level 1 retorna só o melhor bid/ask; level 2 os 50 melhores níveis. A Binance não informa o número de ordens por nível, reportado como 1.
+// @Tags Compat
+// @Produce json
+// @Param id path string true "Produto (ex: BTC-USDT)"
+// @Param level query int false "1 ou 2 (padrão 1)"
+// @Success 200 {object} map[string]interface{}
+// @Router /compat/coinbase/products/{id}/book [get]
+func (p *ProxyServer) CoinbaseBook(c *gin.Context) {
+	market, ok := p.coinbaseProductParam(c)
+	if !ok {
+		return
+	}
+	depth := 0
+	switch c.DefaultQuery("level", "1") {
+	case "1":
+		depth = 1
+	case "2":
+		depth = 50
+	default:
+		respondError(c, http.StatusBadRequest, -1100, "level deve ser 1 ou 2")
+		return
+	}
+	book, err := p.market.Depth(c.Request.Context(), market.Symbol, max(depth, 5))
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	levels := func(side [][2]float64) [][]interface{} {
+		side = side[:min(depth, len(side))]
+		result := make([][]interface{}, len(side))
+		for i, level := range side {
+			result[i] = []interface{}{formatFloat(level[0]), formatFloat(level[1]), 1}
+		}
+		return result
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"sequence":     book.LastUpdateID,
+		"bids":         levels(book.Bids),
+		"asks":         levels(book.Asks),
+		"auction_mode": false,
+		"time":         coinbaseTime(time.Now().UnixMilli()),
+	})
+}
+
+// CoinbaseOpenOrders lista as ordens abertas do tenant no formato da Coinbase
+// @Summary Ordens abertas (Coinbase)
+// @Description Ordens abertas do tenant, das mais recentes para as mais antigas (requer token de tenant)
+// @Tags Compat
+// @Produce json
+// @Param product_id query string false "Produto (ex: BTC-USDT)"
+// @Success 200 {array} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /compat/coinbase/orders [get]
+func (p *ProxyServer) CoinbaseOpenOrders(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+	symbol := ""
+	if raw := c.Query("product_id"); raw != "" {
+		market, ok := p.compatMarket(c, raw)
+		if !ok {
+			return
+		}
+		symbol = market.Symbol
+	}
+	orders, err := p.compatOpenOrders(c.Request.Context(), tenant, symbol)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].Time > orders[j].Time })
+	info, _ := p.market.ExchangeInfo(c.Request.Context())
+	result := make([]coinbaseOrder, len(orders))
+	for i, o := range orders {
+		var market *SymbolInfo
+		if info != nil {
+			market, _ = info.Symbol(o.Symbol)
+		}
+		result[i] = newCoinbaseOrder(market, o)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// coinbaseOrderRequest é o corpo de POST /orders da Coinbase Exchange
+type coinbaseOrderRequest struct {
+	ProductID   string    `json:"product_id"`
+	Side        string    `json:"side"`
+	Type        string    `json:"type"`
+	Size        flexFloat `json:"size"`
+	Funds       flexFloat `json:"funds"`
+	Price       flexFloat `json:"price"`
+	TimeInForce string    `json:"time_in_force"`
+	PostOnly    bool      `json:"post_only"`
+	ClientOID   string    `json:"client_oid"`
+	Stop        string    `json:"stop"`
+	StopPrice   flexFloat `json:"stop_price"`
+}
+
+// binanceOrder traduz a ordem da Coinbase para os tipos da Binance
+func (r *coinbaseOrderRequest) binanceOrder(symbol string) *orderRequest {
+	order := &orderRequest{
+		Symbol:        symbol,
+		Side:          r.Side,
+		Type:          "LIMIT",
+		TimeInForce:   r.TimeInForce,
+		Quantity:      r.Size,
+		QuoteOrderQty: r.Funds,
+		Price:         r.Price,
+		StopPrice:     r.StopPrice,
+	}
+	// GTT não existe na Binance; GTC é o mais próximo
+	if order.TimeInForce == "GTT" {
+		order.TimeInForce = "GTC"
+	}
+	market := strings.EqualFold(r.Type, "market")
+	switch {
+	case market && r.StopPrice > 0:
+		order.Type = "STOP_LOSS"
+		if r.Stop == "entry" {
+			order.Type = "TAKE_PROFIT"
+		}
+	case market:
+		order.Type = "MARKET"
+	case r.StopPrice > 0:
+		order.Type = "STOP_LOSS_LIMIT"
+		if r.Stop == "entry" {
+			order.Type = "TAKE_PROFIT_LIMIT"
+		}
+	case r.PostOnly:
+		order.Type = "LIMIT_MAKER"
+		order.TimeInForce = ""
+	}
+	if market {
+		order.Price = 0
+		order.TimeInForce = ""
+	}
+	return order
+}
+
+// CoinbaseCreateOrder envia uma ordem no formato de POST /orders da Coinbase
+// @Summary Criar ordem (Coinbase)
+// @Description Aceita product_id, side, type (limit/market), size, funds, price, time_in_force, post_only, stop, stop_price e client_oid; client_oid é repassado como newClientOrderId (requer token de tenant)
+// @Tags Compat
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /compat/coinbase/orders [post]
+func (p *ProxyServer) CoinbaseCreateOrder(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+	var req coinbaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "Corpo inválido: "+err.Error())
+		return
+	}
+	market, ok := p.compatMarket(c, req.ProductID)
+	if !ok {
+		return
+	}
+	order := req.binanceOrder(market.Symbol)
+	if req.ClientOID != "" {
+		// UUIDs da Coinbase têm 36 caracteres, o limite da Binance
+		order.NewClientOrderID = req.ClientOID
+	}
+	placed, ok := p.compatPlaceOrder(c, tenant, order)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newCoinbaseOrder(market, placed))
+}
+
+// CoinbaseCancelOrder cancela uma ordem; a Binance exige o produto, então
+// product_id é obrigatório
+// @Summary Cancelar ordem (Coinbase)
+// @Description Cancela a ordem e responde o id, como a Coinbase (requer token de tenant)
+// @Tags Compat
+// @Produce json
+// @Param id path string true "ID da ordem"
+// @Param product_id query string true "Produto (ex: BTC-USDT)"
+// @Success 200 {string} string
+// @Router /compat/coinbase/orders/{id} [delete]
+func (p *ProxyServer) CoinbaseCancelOrder(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+	market, ok := p.compatMarket(c, c.Query("product_id"))
+	if !ok {
+		return
+	}
+	canceled, ok := p.compatCancelOrder(c, tenant, market.Symbol, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, strconv.FormatInt(canceled.OrderID, 10))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// errConcurrencyLimit indica que o limite de chamadas simultâneas do path foi atingido
+var errConcurrencyLimit = errors.New("limite de chamadas simultâneas ao endpoint atingido")
+
+// pathLimit é um semáforo para os paths que casam com pattern
+type pathLimit struct {
+	pattern string
+	slots   chan struct{}
+}
+
+// ConcurrencyLimiter limita as chamadas simultâneas à Binance por padrão de
+// path (ex: /exchangeInfo=2, /ticker/*=50). O excesso é recusado na hora,
+// sem fila, para proteger o proxy e o orçamento de peso.
+type ConcurrencyLimiter struct {
+	limits []*pathLimit
+}
+
+// ParseConcurrencyLimits lê a lista "padrão=limite" separada por vírgula. Os
+// padrões seguem path.Match e são comparados com o path após /api/v3; vale o
+// primeiro que casar.
+func ParseConcurrencyLimits(spec string) (*ConcurrencyLimiter, error) {
+	l := &ConcurrencyLimiter{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, value, ok := strings.Cut(entry, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || n <= 0 {
+			return nil, fmt.Errorf("limite de concorrência inválido: %q (use /path=N)", entry)
+		}
+		pattern = strings.TrimSpace(pattern)
+		if !strings.HasPrefix(pattern, "/") {
+			pattern = "/" + pattern
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("padrão inválido %q: %w", pattern, err)
+		}
+		l.limits = append(l.limits, &pathLimit{pattern: pattern, slots: make(chan struct{}, n)})
+	}
+	return l, nil
+}
+
+func (l *ConcurrencyLimiter) match(endpoint string) *pathLimit {
+	if l == nil {
+		return nil
+	}
+	for _, limit := range l.limits {
+		if ok, _ := path.Match(limit.pattern, endpoint); ok {
+			return limit
+		}
+	}
+	return nil
+}
+
+// TryAcquire ocupa uma vaga do endpoint e retorna a função que a libera
+func (l *ConcurrencyLimiter) TryAcquire(endpoint string) (func(), error) {
+	limit := l.match(endpoint)
+	if limit == nil {
+		return func() {}, nil
+	}
+	select {
+	case limit.slots <- struct{}{}:
+		return func() { <-limit.slots }, nil
+	default:
+		return nil, errConcurrencyLimit
+	}
+}
+
+// Free retorna as vagas livres do limite que casa com o endpoint; ok é false
+// se nenhum padrão casar (endpoint sem limite)
+func (l *ConcurrencyLimiter) Free(endpoint string) (free int, ok bool) {
+	limit := l.match(endpoint)
+	if limit == nil {
+		return 0, false
+	}
+	return cap(limit.slots) - len(limit.slots), true
+}
+
+// PathLimitStatus é a ocupação de um limite de concorrência
+type PathLimitStatus struct {
+	Pattern string `json:"pattern"`
+	Limit   int    `json:"limit"`
+	InUse   int    `json:"inUse"`
+}
+
+// Status retorna a ocupação atual de cada padrão configurado
+func (l *ConcurrencyLimiter) Status() []PathLimitStatus {
+	status := []PathLimitStatus{}
+	if l == nil {
+		return status
+	}
+	for _, limit := range l.limits {
+		status = append(status, PathLimitStatus{Pattern: limit.pattern, Limit: cap(limit.slots), InUse: len(limit.slots)})
+	}
+	return status
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	conditionalBucket        = "conditional_orders"
+	conditionalAuditBucket   = "conditional_audit"
+	conditionalSubmitTimeout = 15 * time.Second
+)
+
+// Tipos de ordem condicional
+const (
+	ConditionalStopLoss   = "STOP_LOSS"
+	ConditionalTakeProfit = "TAKE_PROFIT"
+)
+
+// Estados de uma ordem condicional
+const (
+	ConditionalActive    = "ACTIVE"
+	ConditionalSubmitted = "SUBMITTED"
+	ConditionalFailed    = "FAILED"
+	ConditionalCanceled  = "CANCELED"
+)
+
+// ConditionalOrder é uma regra de stop-loss/take-profit mantida pelo proxy.
+// Quando o preço do símbolo cruza TriggerPrice, o proxy envia a ordem real
+// à Binance com as credenciais do tenant.
+type ConditionalOrder struct {
+	ID           string          `json:"id"`
+	Tenant       string          `json:"tenant"`
+	Symbol       string          `json:"symbol"`
+	Side         string          `json:"side"`
+	Type         string          `json:"type"`
+	TriggerPrice float64         `json:"triggerPrice,string"`
+	Quantity     float64         `json:"quantity,string"`
+	LimitPrice   float64         `json:"limitPrice,string,omitempty"`
+	Status       string          `json:"status"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	TriggeredAt  *time.Time      `json:"triggeredAt,omitempty"`
+	TriggerFill  float64         `json:"triggerFill,string,omitempty"`
+	Order        json.RawMessage `json:"order,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// triggered indica se o preço atual dispara a ordem. Stop-loss de venda e
+// take-profit de compra disparam com o preço caindo; os demais, subindo.
+func (o *ConditionalOrder) triggered(price float64) bool {
+	falling := (o.Type == ConditionalStopLoss) == (o.Side == "SELL")
+	if falling {
+		return price <= o.TriggerPrice
+	}
+	return price >= o.TriggerPrice
+}
+
+// ConditionalAuditEntry é um evento da trilha de auditoria das ordens condicionais
+type ConditionalAuditEntry struct {
+	Time    time.Time `json:"time"`
+	OrderID string    `json:"orderId"`
+	Tenant  string    `json:"tenant"`
+	Event   string    `json:"event"`
+	Price   float64   `json:"price,string,omitempty"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// ConditionalEngine monitora os streams de trades dos símbolos com ordens
+// condicionais ativas e dispara as ordens quando a condição é atingida
+type ConditionalEngine struct {
+	proxy *ProxyServer
+
+	mu       sync.Mutex
+	active   map[string]*ConditionalOrder
+	watchers map[string]*priceWatcher
+	auditSeq uint64
+}
+
+type priceWatcher struct {
+	sub  *Subscription
+	stop chan struct{}
+}
+
+// aggTradeEvent é o evento aggTrade dos streams da Binance
+type aggTradeEvent struct {
+	EventType    string `json:"e"`
+	EventTime    int64  `json:"E"`
+	Symbol       string `json:"s"`
+	AggTradeID   int64  `json:"a"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	TradeTime    int64  `json:"T"`
+	BuyerIsMaker bool   `json:"m"`
+}
+
+// NewConditionalEngine cria o motor e retoma as ordens ativas persistidas
+func NewConditionalEngine(proxy *ProxyServer) (*ConditionalEngine, error) {
+	e := &ConditionalEngine{
+		proxy:    proxy,
+		active:   make(map[string]*ConditionalOrder),
+		watchers: make(map[string]*priceWatcher),
+	}
+
+	err := proxy.store.ForEach(conditionalBucket, func(_ string, data []byte) error {
+		var order ConditionalOrder
+		if err := json.Unmarshal(data, &order); err != nil {
+			return err
+		}
+		if order.Status == ConditionalActive {
+			e.active[order.ID] = &order
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	for _, order := range e.active {
+		e.watchLocked(order.Symbol)
+	}
+	e.mu.Unlock()
+	return e, nil
+}
+
+// watchLocked garante um monitor de preço para o símbolo. Requer e.mu.
+func (e *ConditionalEngine) watchLocked(symbol string) {
+	if _, ok := e.watchers[symbol]; ok {
+		return
+	}
+	w := &priceWatcher{
+		sub:  e.proxy.hub.Subscribe(strings.ToLower(symbol) + "@aggTrade").Label("conditional orders"),
+		stop: make(chan struct{}),
+	}
+	e.watchers[symbol] = w
+
+	go func() {
+		for {
+			select {
+			case <-w.stop:
+				return
+			case msg := <-w.sub.C:
+				var event aggTradeEvent
+				if err := json.Unmarshal(msg.Data, &event); err != nil {
+					continue
+				}
+				if price, err := strconv.ParseFloat(event.Price, 64); err == nil {
+					e.evaluate(symbol, price)
+				}
+			}
+		}
+	}()
+}
+
+// unwatchIdleLocked encerra o monitor do símbolo se não houver mais ordens ativas. Requer e.mu.
+func (e *ConditionalEngine) unwatchIdleLocked(symbol string) {
+	for _, order := range e.active {
+		if order.Symbol == symbol {
+			return
+		}
+	}
+	if w, ok := e.watchers[symbol]; ok {
+		w.sub.Close()
+		close(w.stop)
+		delete(e.watchers, symbol)
+	}
+}
+
+// evaluate dispara as ordens ativas do símbolo cuja condição foi atingida
+func (e *ConditionalEngine) evaluate(symbol string, price float64) {
+	var fired []*ConditionalOrder
+
+	e.mu.Lock()
+	for id, order := range e.active {
+		if order.Symbol == symbol && order.triggered(price) {
+			// Remover das ativas antes de enviar evita disparos duplicados
+			delete(e.active, id)
+			fired = append(fired, order)
+		}
+	}
+	if len(fired) > 0 {
+		e.unwatchIdleLocked(symbol)
+	}
+	e.mu.Unlock()
+
+	for _, order := range fired {
+		go e.submit(order, price)
+	}
+}
+
+// submit envia a ordem real à Binance e registra o resultado
+func (e *ConditionalEngine) submit(order *ConditionalOrder, price float64) {
+	now := time.Now()
+	order.TriggeredAt = &now
+	order.TriggerFill = price
+	e.audit(order, "TRIGGERED", price, "")
+
+	tenant := e.proxy.tenants.ByName(order.Tenant)
+	if tenant == nil {
+		e.finish(order, ConditionalFailed, nil, "tenant não encontrado", price)
+		return
+	}
+
+	params := url.Values{
+		"symbol":           {order.Symbol},
+		"side":             {order.Side},
+		"quantity":         {formatFloat(order.Quantity)},
+		"newClientOrderId": {"cond-" + order.ID},
+	}
+	if order.LimitPrice > 0 {
+		params.Set("type", "LIMIT")
+		params.Set("timeInForce", "GTC")
+		params.Set("price", formatFloat(order.LimitPrice))
+	} else {
+		params.Set("type", "MARKET")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), conditionalSubmitTimeout)
+	defer cancel()
+	body, err := e.proxy.signedRequest(ctx, tenant, http.MethodPost, "/api/v3/order", params)
+	if err != nil {
+		detail := err.Error()
+		if upstream, ok := err.(*UpstreamError); ok {
+			detail = string(upstream.Body)
+		}
+		e.finish(order, ConditionalFailed, nil, detail, price)
+		return
+	}
+	e.finish(order, ConditionalSubmitted, body, "", price)
+}
+
+func (e *ConditionalEngine) finish(order *ConditionalOrder, status string, response []byte, detail string, price float64) {
+	order.Status = status
+	order.Order = response
+	order.Error = detail
+	if err := e.proxy.store.Put(conditionalBucket, order.ID, order); err != nil {
+		// log.Printf("[ERROR] Erro ao gravar ordem condicional %s: %v", order.ID, err)
+	}
+	e.audit(order, status, price, detail)
+}
+
+// audit grava um evento na trilha de auditoria. A chave ordena os eventos
+// cronologicamente.
+func (e *ConditionalEngine) audit(order *ConditionalOrder, event string, price float64, detail string) {
+	e.mu.Lock()
+	e.auditSeq++
+	seq := e.auditSeq
+	e.mu.Unlock()
+
+	entry := ConditionalAuditEntry{
+		Time:    time.Now(),
+		OrderID: order.ID,
+		Tenant:  order.Tenant,
+		Event:   event,
+		Price:   price,
+		Detail:  detail,
+	}
+	key := fmt.Sprintf("%020d-%06d", entry.Time.UnixNano(), seq%1000000)
+	if err := e.proxy.store.Put(conditionalAuditBucket, key, entry); err != nil {
+		// log.Printf("[ERROR] Erro ao gravar auditoria da ordem %s: %v", order.ID, err)
+	}
+}
+
+// Add registra e passa a monitorar uma nova ordem condicional
+func (e *ConditionalEngine) Add(order *ConditionalOrder) error {
+	if err := e.proxy.store.Put(conditionalBucket, order.ID, order); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.active[order.ID] = order
+	e.watchLocked(order.Symbol)
+	e.mu.Unlock()
+	e.audit(order, "CREATED", order.TriggerPrice, "")
+	return nil
+}
+
+// Cancel cancela uma ordem ativa. Retorna false se a ordem não está mais ativa.
+func (e *ConditionalEngine) Cancel(order *ConditionalOrder) (bool, error) {
+	e.mu.Lock()
+	active, ok := e.active[order.ID]
+	if ok {
+		delete(e.active, order.ID)
+		e.unwatchIdleLocked(order.Symbol)
+	}
+	e.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	active.Status = ConditionalCanceled
+	if err := e.proxy.store.Put(conditionalBucket, active.ID, active); err != nil {
+		return true, err
+	}
+	e.audit(active, ConditionalCanceled, 0, "")
+	*order = *active
+	return true, nil
+}
+
+func newConditionalID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+type conditionalOrderRequest struct {
+	Symbol       string    `json:"symbol"`
+	Side         string    `json:"side"`
+	Type         string    `json:"type"`
+	TriggerPrice flexFloat `json:"triggerPrice"`
+	Quantity     flexFloat `json:"quantity"`
+	LimitPrice   flexFloat `json:"limitPrice"`
+}
+
+// requireConditional autentica o tenant e garante que o motor está habilitado
+func (p *ProxyServer) requireConditional(c *gin.Context) (*Tenant, bool) {
+	if p.conditional == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Ordens condicionais desabilitadas (CONDITIONAL_ORDERS_ENABLED)")
+		return nil, false
+	}
+	return p.requireTenant(c)
+}
+
+// loadConditionalOrder busca a ordem do path, respondendo 404 se não existir
+// ou pertencer a outro tenant
+func (p *ProxyServer) loadConditionalOrder(c *gin.Context, tenant *Tenant) (*ConditionalOrder, bool) {
+	var order ConditionalOrder
+	found, err := p.store.Get(conditionalBucket, c.Param("id"), &order)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao ler ordem condicional: "+err.Error())
+		return nil, false
+	}
+	if !found || order.Tenant != tenant.Name {
+		respondError(c, http.StatusNotFound, -2013, "Ordem condicional não encontrada")
+		return nil, false
+	}
+	return &order, true
+}
+
+// CreateConditionalOrder registra uma ordem stop-loss/take-profit emulada
+// @Summary Criar ordem condicional
+// @Description Registra uma regra de stop-loss ou take-profit monitorada pelo proxy. Ao atingir o preço de disparo, a ordem real (MARKET ou LIMIT) é enviada à Binance.
+// @Tags Conditional Orders
+// @Accept json
+// @Produce json
+// @Success 201 {object} ConditionalOrder
+// @Router /local/conditional [post]
+func (p *ProxyServer) CreateConditionalOrder(c *gin.Context) {
+	tenant, ok := p.requireConditional(c)
+	if !ok {
+		return
+	}
+
+	var req conditionalOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "JSON inválido: "+err.Error())
+		return
+	}
+	symbols, err := normalizeSymbols([]string{req.Symbol})
+	if err != nil || len(symbols) == 0 {
+		respondError(c, http.StatusBadRequest, -1100, "Símbolo inválido")
+		return
+	}
+	side := strings.ToUpper(req.Side)
+	if side != "BUY" && side != "SELL" {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'side' deve ser BUY ou SELL")
+		return
+	}
+	orderType := strings.ToUpper(req.Type)
+	if orderType != ConditionalStopLoss && orderType != ConditionalTakeProfit {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'type' deve ser STOP_LOSS ou TAKE_PROFIT")
+		return
+	}
+	if req.TriggerPrice <= 0 || req.Quantity <= 0 || req.LimitPrice < 0 {
+		respondError(c, http.StatusBadRequest, -1100, "triggerPrice e quantity devem ser positivos")
+		return
+	}
+
+	info, err := p.market.ExchangeInfo(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter exchangeInfo: "+err.Error())
+		return
+	}
+	symbolInfo, ok := info.Symbol(symbols[0])
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1121, "Símbolo inválido: "+symbols[0])
+		return
+	}
+	filters := symbolInfo.ParsedFilters()
+	violations := filters.checkQuantity(float64(req.Quantity), req.LimitPrice == 0)
+	if req.LimitPrice > 0 {
+		violations = append(violations, filters.checkPrice(float64(req.LimitPrice))...)
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":             -1013,
+			"msg":              "A ordem viola filtros do símbolo",
+			"message":          "A ordem viola filtros do símbolo",
+			"filterViolations": violations,
+		})
+		return
+	}
+
+	order := &ConditionalOrder{
+		ID:           newConditionalID(),
+		Tenant:       tenant.Name,
+		Symbol:       symbols[0],
+		Side:         side,
+		Type:         orderType,
+		TriggerPrice: float64(req.TriggerPrice),
+		Quantity:     float64(req.Quantity),
+		LimitPrice:   float64(req.LimitPrice),
+		Status:       ConditionalActive,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := p.conditional.Add(order); err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao gravar ordem condicional: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, order)
+}
+
+// ListConditionalOrders lista as ordens condicionais do tenant
+// @Summary Listar ordens condicionais
+// @Tags Conditional Orders
+// @Produce json
+// @Param status query string false "Filtrar por status (ACTIVE, SUBMITTED, FAILED, CANCELED)"
+// @Success 200 {array} ConditionalOrder
+// @Router /local/conditional [get]
+func (p *ProxyServer) ListConditionalOrders(c *gin.Context) {
+	tenant, ok := p.requireConditional(c)
+	if !ok {
+		return
+	}
+	status := strings.ToUpper(c.Query("status"))
+
+	orders := []ConditionalOrder{}
+	err := p.store.ForEach(conditionalBucket, func(_ string, data []byte) error {
+		var order ConditionalOrder
+		if err := json.Unmarshal(data, &order); err != nil {
+			return err
+		}
+		if order.Tenant == tenant.Name && (status == "" || order.Status == status) {
+			orders = append(orders, order)
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao listar ordens condicionais: "+err.Error())
+		return
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CreatedAt.Before(orders[j].CreatedAt) })
+	c.JSON(http.StatusOK, orders)
+}
+
+// GetConditionalOrder retorna uma ordem condicional do tenant
+// @Summary Consultar ordem condicional
+// @Tags Conditional Orders
+// @Produce json
+// @Param id path string true "ID da ordem condicional"
+// @Success 200 {object} ConditionalOrder
+// @Router /local/conditional/{id} [get]
+func (p *ProxyServer) GetConditionalOrder(c *gin.Context) {
+	tenant, ok := p.requireConditional(c)
+	if !ok {
+		return
+	}
+	if order, ok := p.loadConditionalOrder(c, tenant); ok {
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// CancelConditionalOrder cancela uma ordem condicional ainda ativa
+// @Summary Cancelar ordem condicional
+// @Tags Conditional Orders
+// @Produce json
+// @Param id path string true "ID da ordem condicional"
+// @Success 200 {object} ConditionalOrder
+// @Router /local/conditional/{id} [delete]
+func (p *ProxyServer) CancelConditionalOrder(c *gin.Context) {
+	tenant, ok := p.requireConditional(c)
+	if !ok {
+		return
+	}
+	order, ok := p.loadConditionalOrder(c, tenant)
+	if !ok {
+		return
+	}
+	canceled, err := p.conditional.Cancel(order)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao cancelar ordem condicional: "+err.Error())
+		return
+	}
+	if !canceled {
+		respondError(c, http.StatusConflict, -2011, "Ordem condicional não está ativa (status "+order.Status+")")
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// ConditionalOrderAudit retorna a trilha de auditoria de uma ordem condicional
+// @Summary Auditoria de ordem condicional
+// @Tags Conditional Orders
+// @Produce json
+// @Param id path string true "ID da ordem condicional"
+// @Success 200 {array} ConditionalAuditEntry
+// @Router /local/conditional/{id}/audit [get]
+func (p *ProxyServer) ConditionalOrderAudit(c *gin.Context) {
+	tenant, ok := p.requireConditional(c)
+	if !ok {
+		return
+	}
+	order, ok := p.loadConditionalOrder(c, tenant)
+	if !ok {
+		return
+	}
+
+	entries := []ConditionalAuditEntry{}
+	err := p.store.ForEach(conditionalAuditBucket, func(_ string, data []byte) error {
+		var entry ConditionalAuditEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		if entry.OrderID == order.ID {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao ler auditoria: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnv retorna o valor da variável de ambiente ou o padrão informado
+func getEnv(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt lê uma variável de ambiente inteira, usando o padrão se ausente ou inválida
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvBool lê uma variável de ambiente booleana (true/false, 1/0, yes/no)
+func getEnvBool(key string, fallback bool) bool {
+	switch strings.ToLower(getEnv(key, "")) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return fallback
+}
+
+// getEnvDuration lê uma duração (ex: 5s, 1m) de uma variável de ambiente
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
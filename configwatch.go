@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultConfigWatchInterval = 5 * time.Second
+
+// envNamePattern são os nomes de arquivo de CONFIG_DIR aceitos como variável
+var envNamePattern = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// configDirEnv guarda o valor original das variáveis sobrepostas por
+// CONFIG_DIR, para restaurá-lo quando a chave sai do diretório
+var configDirEnv = struct {
+	sync.Mutex
+	original map[string]*string
+}{original: map[string]*string{}}
+
+// applyConfigDir aplica CONFIG_DIR ao ambiente: cada arquivo é uma variável
+// (nome do arquivo = nome da variável, conteúdo = valor), como as chaves de um
+// ConfigMap montado como volume. Os valores do diretório têm precedência
+// sobre o ambiente do processo.
+func applyConfigDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	values := map[string]string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !envNamePattern.MatchString(name) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		values[name] = strings.TrimSpace(string(data))
+	}
+
+	configDirEnv.Lock()
+	defer configDirEnv.Unlock()
+	for name, value := range values {
+		if _, saved := configDirEnv.original[name]; !saved {
+			var original *string
+			if current, ok := os.LookupEnv(name); ok {
+				original = &current
+			}
+			configDirEnv.original[name] = original
+		}
+		os.Setenv(name, value)
+	}
+	for name, original := range configDirEnv.original {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if original != nil {
+			os.Setenv(name, *original)
+		} else {
+			os.Unsetenv(name)
+		}
+		delete(configDirEnv.original, name)
+	}
+	return nil
+}
+
+// contentHash resume o conteúdo de um arquivo ou dos arquivos de um
+// diretório. Entradas ocultas ficam de fora (o kubelet guarda as versões do
+// ConfigMap em ..data e ..<data>).
+func contentHash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if !info.IsDir() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		hash.Write(data)
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(path, name))
+		if err != nil {
+			continue
+		}
+		hash.Write([]byte(name))
+		hash.Write([]byte{0})
+		hash.Write(data)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ConfigWatcher acompanha arquivos e diretórios de configuração montados
+// (ConfigMaps do Kubernetes) e reaplica cada um quando o conteúdo muda. A
+// comparação é por hash a cada intervalo: o kubelet atualiza o ConfigMap
+// trocando um link simbólico (..data), que eventos de arquivo no caminho
+// montado nem sempre reportam.
+type ConfigWatcher struct {
+	interval time.Duration
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	sources []*configSource
+}
+
+// configSource é um arquivo ou diretório observado
+type configSource struct {
+	Name       string     `json:"name"`
+	Path       string     `json:"path"`
+	Reloads    int        `json:"reloads"`
+	LastReload *time.Time `json:"lastReload,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+
+	apply func() error
+	hash  string
+}
+
+func NewConfigWatcher(interval time.Duration) *ConfigWatcher {
+	return &ConfigWatcher{interval: interval}
+}
+
+// Watch registra path; apply é chamada a cada mudança do conteúdo. O
+// conteúdo atual é considerado já aplicado.
+func (w *ConfigWatcher) Watch(name, path string, apply func() error) {
+	hash, _ := contentHash(path)
+	w.mu.Lock()
+	w.sources = append(w.sources, &configSource{Name: name, Path: path, apply: apply, hash: hash})
+	w.mu.Unlock()
+}
+
+func (w *ConfigWatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.check(false)
+			}
+		}
+	}()
+}
+
+// Close interrompe a observação
+func (w *ConfigWatcher) Close() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
+// check reaplica as fontes cujo conteúdo mudou (ou todas, com force). Um
+// arquivo inválido mantém a configuração anterior e o erro fica no status
+// até a próxima mudança.
+func (w *ConfigWatcher) check(force bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, source := range w.sources {
+		hash, err := contentHash(source.Path)
+		if err != nil {
+			// Arquivo ausente durante a troca do ConfigMap: tenta de novo depois
+			continue
+		}
+		if hash == source.hash && !force {
+			continue
+		}
+		source.hash = hash
+		now := time.Now()
+		source.LastReload = &now
+		source.LastError = ""
+		if err := source.apply(); err != nil {
+			source.LastError = err.Error()
+			// log.Printf("[WARN] Configuração %s inválida, mantendo a anterior: %v", source.Name, err)
+			continue
+		}
+		source.Reloads++
+		// log.Printf("🔄 Configuração %s recarregada", source.Name)
+	}
+}
+
+// Status retorna uma cópia do estado das fontes observadas
+func (w *ConfigWatcher) Status() []configSource {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := make([]configSource, len(w.sources))
+	for i, source := range w.sources {
+		status[i] = *source
+	}
+	return status
+}
+
+// watchConfig observa CONFIG_DIR e os arquivos de configuração recarregáveis
+// (tenants, tradução de símbolos e regras de parâmetros)
+func (p *ProxyServer) watchConfig(interval time.Duration) *ConfigWatcher {
+	watcher := NewConfigWatcher(interval)
+	if dir := os.Getenv("CONFIG_DIR"); dir != "" {
+		watcher.Watch("CONFIG_DIR", dir, func() error { return applyConfigDir(dir) })
+	}
+	if path := os.Getenv("TENANTS_FILE"); path != "" {
+		watcher.Watch("TENANTS_FILE", path, func() error { return p.tenants.Reload(path) })
+	}
+	if path := os.Getenv("SYMBOL_MAP_FILE"); path != "" {
+		watcher.Watch("SYMBOL_MAP_FILE", path, func() error { return p.symbols.Reload(path) })
+	}
+	if path := os.Getenv("PARAM_REWRITE_FILE"); path != "" && p.rewrites != nil {
+		watcher.Watch("PARAM_REWRITE_FILE", path, func() error { return p.rewrites.Reload(path) })
+	}
+	return watcher
+}
+
+func (p *ProxyServer) requireConfigWatch(c *gin.Context) bool {
+	if p.config == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Recarga de configuração desabilitada (CONFIG_WATCH)")
+		return false
+	}
+	return true
+}
+
+// ConfigStatus lista as configurações observadas
+// @Summary Configurações recarregáveis
+// @Description Arquivos e diretórios de configuração observados (CONFIG_DIR, TENANTS_FILE, SYMBOL_MAP_FILE, PARAM_REWRITE_FILE), com a última recarga e o último erro
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/config [get]
+func (p *ProxyServer) ConfigStatus(c *gin.Context) {
+	if !p.requireConfigWatch(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"interval": p.config.interval.String(), "sources": p.config.Status()})
+}
+
+// ReloadConfig recarrega todas as configurações observadas
+// @Summary Recarregar configuração
+// @Description Reaplica agora todos os arquivos observados, mesmo sem mudança, e retorna o estado de cada um
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/config/reload [post]
+func (p *ProxyServer) ReloadConfig(c *gin.Context) {
+	if !p.requireConfigWatch(c) {
+		return
+	}
+	p.config.check(true)
+	c.JSON(http.StatusOK, gin.H{"sources": p.config.Status()})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limite de ?maxRate= (mensagens por segundo por stream)
+const maxStreamRate = 1000
+
+// depthStreamEvent é o evento completo de um stream de diffs de depth
+// (<symbol>@depth ou <symbol>@depth@100ms)
+type depthStreamEvent struct {
+	EventType string      `json:"e"`
+	EventTime int64       `json:"E"`
+	Symbol    string      `json:"s"`
+	FirstID   int64       `json:"U"`
+	FinalID   int64       `json:"u"`
+	Bids      [][2]string `json:"b"`
+	Asks      [][2]string `json:"a"`
+}
+
+// streamConflater junta as mensagens que chegam entre dois envios: fica só a
+// última de cada stream, e diffs de depth seguidos viram um diff só
+type streamConflater struct {
+	pending map[string]StreamMessage
+	order   []string
+}
+
+func (c *streamConflater) add(msg StreamMessage) {
+	if c.pending == nil {
+		c.pending = map[string]StreamMessage{}
+	}
+	if prev, ok := c.pending[msg.Stream]; ok {
+		msg.Data = mergeStreamData(prev.Data, msg.Data)
+	} else {
+		c.order = append(c.order, msg.Stream)
+	}
+	c.pending[msg.Stream] = msg
+}
+
+// flush retorna as mensagens acumuladas, na ordem em que cada stream chegou
+func (c *streamConflater) flush() []StreamMessage {
+	msgs := make([]StreamMessage, 0, len(c.order))
+	for _, stream := range c.order {
+		msgs = append(msgs, c.pending[stream])
+		delete(c.pending, stream)
+	}
+	c.order = c.order[:0]
+	return msgs
+}
+
+// mergeStreamData combina duas mensagens do mesmo stream. Tickers e
+// bookTicker trazem o estado completo, então vale a mais nova; dois diffs de
+// depth viram um diff de U do primeiro a u do segundo, com a quantidade mais
+// recente de cada nível, que o cliente aplica ao livro como um diff normal.
+func mergeStreamData(prev, next json.RawMessage) json.RawMessage {
+	var a, b depthStreamEvent
+	if json.Unmarshal(prev, &a) != nil || json.Unmarshal(next, &b) != nil || a.EventType != "depthUpdate" || b.EventType != "depthUpdate" {
+		return next
+	}
+	b.FirstID = a.FirstID
+	b.Bids = mergeDepthLevels(a.Bids, b.Bids, true)
+	b.Asks = mergeDepthLevels(a.Asks, b.Asks, false)
+	merged, err := json.Marshal(b)
+	if err != nil {
+		return next
+	}
+	return merged
+}
+
+// mergeDepthLevels junta os níveis dos dois diffs (o segundo prevalece),
+// ordenados do melhor preço para o pior
+func mergeDepthLevels(older, newer [][2]string, bids bool) [][2]string {
+	qty := make(map[string]string, len(older)+len(newer))
+	for _, levels := range [][][2]string{older, newer} {
+		for _, level := range levels {
+			qty[level[0]] = level[1]
+		}
+	}
+	merged := make([][2]string, 0, len(qty))
+	for price, q := range qty {
+		merged = append(merged, [2]string{price, q})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		pi, _ := strconv.ParseFloat(merged[i][0], 64)
+		pj, _ := strconv.ParseFloat(merged[j][0], 64)
+		if bids {
+			return pi > pj
+		}
+		return pi < pj
+	})
+	return merged
+}
+
+// conflateMessages repassa as mensagens de in no máximo rate vezes por
+// segundo por stream, juntando as que chegam no intervalo. Para quando done
+// fechar.
+func conflateMessages(in <-chan StreamMessage, rate int, done <-chan struct{}) <-chan StreamMessage {
+	out := make(chan StreamMessage)
+	go func() {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		var conflater streamConflater
+		for {
+			select {
+			case <-done:
+				return
+			case msg := <-in:
+				conflater.add(msg)
+			case <-ticker.C:
+				for _, msg := range conflater.flush() {
+					select {
+					case out <- msg:
+					case <-done:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// parseStreamRate lê ?maxRate= (mensagens por segundo por stream); 0 = sem conflação
+func parseStreamRate(raw string) (int, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, true
+	}
+	rate, err := strconv.Atoi(raw)
+	if err != nil || rate < 1 || rate > maxStreamRate {
+		return 0, false
+	}
+	return rate, true
+}
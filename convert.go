@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bridgeAssets são os ativos intermediários usados quando não existe par direto
+var bridgeAssets = []string{"USDT", "BTC", "FDUSD", "USDC", "ETH", "BNB"}
+
+// conversionStep é um salto da conversão através de um par da Binance.
+// Inverse indica que o par está cotado no sentido contrário (to/from).
+type conversionStep struct {
+	Symbol  string `json:"symbol"`
+	Inverse bool   `json:"inverse"`
+}
+
+// findDirectStep procura um par que ligue diretamente from e to
+func findDirectStep(exists func(string) bool, from, to string) (conversionStep, bool) {
+	if exists(from + to) {
+		return conversionStep{Symbol: from + to}, true
+	}
+	if exists(to + from) {
+		return conversionStep{Symbol: to + from, Inverse: true}, true
+	}
+	return conversionStep{}, false
+}
+
+// findConversionPaths lista os caminhos possíveis de from para to: o par
+// direto (quando existe) e os caminhos de dois saltos via ativos ponte
+func findConversionPaths(exists func(string) bool, from, to string) [][]conversionStep {
+	if from == to {
+		return [][]conversionStep{{}}
+	}
+
+	var paths [][]conversionStep
+	if step, ok := findDirectStep(exists, from, to); ok {
+		paths = append(paths, []conversionStep{step})
+	}
+	for _, bridge := range bridgeAssets {
+		if bridge == from || bridge == to {
+			continue
+		}
+		first, ok := findDirectStep(exists, from, bridge)
+		if !ok {
+			continue
+		}
+		second, ok := findDirectStep(exists, bridge, to)
+		if !ok {
+			continue
+		}
+		paths = append(paths, []conversionStep{first, second})
+	}
+	return paths
+}
+
+// conversionRate calcula a taxa de um caminho usando a função de preço informada
+func conversionRate(path []conversionStep, price func(symbol string) (float64, error)) (float64, error) {
+	rate := 1.0
+	for _, step := range path {
+		p, err := price(step.Symbol)
+		if err != nil {
+			return 0, err
+		}
+		if p <= 0 {
+			return 0, fmt.Errorf("preço inválido para %s", step.Symbol)
+		}
+		if step.Inverse {
+			rate /= p
+		} else {
+			rate *= p
+		}
+	}
+	return rate, nil
+}
+
+// bestConversion retorna a taxa do primeiro caminho de from para to cujos
+// preços estão disponíveis
+func bestConversion(exists func(string) bool, price func(symbol string) (float64, error), from, to string) (float64, []conversionStep, bool) {
+	for _, path := range findConversionPaths(exists, from, to) {
+		if rate, err := conversionRate(path, price); err == nil {
+			return rate, path, true
+		}
+	}
+	return 0, nil, false
+}
+
+// pathSymbols retorna os símbolos usados em um caminho de conversão
+func pathSymbols(path []conversionStep) []string {
+	symbols := make([]string, len(path))
+	for i, step := range path {
+		symbols[i] = step.Symbol
+	}
+	return symbols
+}
+
+// HistoricalPrice retorna o preço de abertura do candle de 1 minuto que
+// contém o instante informado. Sem candle naquele minuto (par ainda não
+// listado, já retirado ou parado), retorna erro em vez do candle seguinte.
+// Candles passados não mudam, por isso o resultado fica em cache por
+// bastante tempo.
+func (m *MarketCache) HistoricalPrice(ctx context.Context, symbol string, at time.Time) (float64, error) {
+	minute := at.Truncate(time.Minute).UnixMilli()
+	query := url.Values{
+		"symbol":    {symbol},
+		"interval":  {"1m"},
+		"startTime": {strconv.FormatInt(minute, 10)},
+		"endTime":   {strconv.FormatInt(minute+time.Minute.Milliseconds()-1, 10)},
+		"limit":     {"1"},
+	}
+	value, err := m.get(ctx, "/klines", query, 24*time.Hour, func(data []byte) (interface{}, error) {
+		var klines [][]interface{}
+		if err := json.Unmarshal(data, &klines); err != nil {
+			return nil, err
+		}
+		if len(klines) == 0 || len(klines[0]) < 2 {
+			return nil, fmt.Errorf("sem candles para %s em %s", symbol, at.UTC().Format(time.RFC3339))
+		}
+		open, _ := klines[0][1].(string)
+		return strconv.ParseFloat(open, 64)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value.(float64), nil
+}
+
+// normalizeAsset normaliza o código de um ativo (ex: " eth " -> "ETH")
+func normalizeAsset(asset string) string {
+	return strings.ToUpper(strings.TrimSpace(asset))
+}
+
+// convertedStep detalha o preço usado em cada salto de uma conversão
+type convertedStep struct {
+	Symbol string `json:"symbol"`
+	Side   string `json:"side"`
+	Price  string `json:"price"`
+}
+
+type convertedPath struct {
+	Steps []convertedStep `json:"steps"`
+	Rate  string          `json:"rate"`
+	rate  float64
+}
+
+// executableRate calcula a taxa de um caminho considerando o lado do livro:
+// vender o ativo base usa o bid e comprar usa o ask. Sem book para o par, usa
+// o último preço.
+func executableRate(path []conversionStep, books map[string]bookQuote, prices map[string]float64) (convertedPath, bool) {
+	result := convertedPath{Steps: make([]convertedStep, 0, len(path))}
+	rate := 1.0
+	for _, step := range path {
+		book, hasBook := books[step.Symbol]
+		last := prices[step.Symbol]
+
+		var price float64
+		var side string
+		if step.Inverse {
+			// Temos a moeda de cotação do par e compramos o ativo base
+			side, price = "BUY", book.Ask
+			if !hasBook || price <= 0 {
+				price = last
+			}
+			if price <= 0 {
+				return result, false
+			}
+			rate /= price
+		} else {
+			// Temos o ativo base e vendemos pela moeda de cotação
+			side, price = "SELL", book.Bid
+			if !hasBook || price <= 0 {
+				price = last
+			}
+			if price <= 0 {
+				return result, false
+			}
+			rate *= price
+		}
+		result.Steps = append(result.Steps, convertedStep{Symbol: step.Symbol, Side: side, Price: formatFloat(price)})
+	}
+	result.rate = rate
+	result.Rate = formatFloat(rate)
+	return result, true
+}
+
+// Convert converte um valor entre dois ativos escolhendo o melhor caminho
+// @Summary Conversão de moedas
+// @Description Resolve o caminho de conversão (direto ou via ativos ponte) com a melhor taxa executável no cache de book tickers
+// @Tags Portfolio
+// @Produce json
+// @Param from query string true "Ativo de origem (ex: ETH)"
+// @Param to query string true "Ativo de destino (ex: BRL)"
+// @Param amount query number false "Quantidade (padrão 1)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /convert [get]
+func (p *ProxyServer) Convert(c *gin.Context) {
+	from := normalizeAsset(c.Query("from"))
+	to := normalizeAsset(c.Query("to"))
+	if from == "" || to == "" {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetros obrigatórios 'from' e 'to' não informados")
+		return
+	}
+	amount := 1.0
+	if raw := c.Query("amount"); raw != "" {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value < 0 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'amount' inválido")
+			return
+		}
+		amount = value
+	}
+
+	ctx := c.Request.Context()
+	prices, err := p.market.Prices(ctx)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter preços da Binance: "+err.Error())
+		return
+	}
+	books, err := p.market.BookTickers(ctx)
+	if err != nil {
+		// O book é opcional: sem ele a conversão usa o último preço
+		books = map[string]bookQuote{}
+	}
+
+	exists := func(symbol string) bool {
+		_, ok := prices[symbol]
+		return ok
+	}
+
+	var candidates []convertedPath
+	for _, path := range findConversionPaths(exists, from, to) {
+		if converted, ok := executableRate(path, books, prices); ok {
+			candidates = append(candidates, converted)
+		}
+	}
+	if len(candidates) == 0 {
+		respondError(c, http.StatusNotFound, -1121, fmt.Sprintf("Nenhum caminho de conversão de %s para %s", from, to))
+		return
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].rate > candidates[j].rate
+	})
+	best := candidates[0]
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":         from,
+		"to":           to,
+		"amount":       formatFloat(amount),
+		"rate":         best.Rate,
+		"result":       formatFloat(amount * best.rate),
+		"path":         best.Steps,
+		"alternatives": candidates[1:],
+	})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCorrelationInterval = "1h"
+	defaultCorrelationWindow   = 30 * 24 * time.Hour
+	maxCorrelationSymbols      = 20
+	// Candles por símbolo (window / interval); acima disso, use um intervalo maior
+	maxCorrelationCandles = 5000
+	klinesPageLimit       = 1000
+)
+
+// klineIntervals são os intervalos de /klines com duração fixa (1M varia)
+var klineIntervals = map[string]time.Duration{
+	"1s": time.Second, "1m": time.Minute, "3m": 3 * time.Minute, "5m": 5 * time.Minute,
+	"15m": 15 * time.Minute, "30m": 30 * time.Minute, "1h": time.Hour, "2h": 2 * time.Hour,
+	"4h": 4 * time.Hour, "6h": 6 * time.Hour, "8h": 8 * time.Hour, "12h": 12 * time.Hour,
+	"1d": 24 * time.Hour, "3d": 72 * time.Hour, "1w": 7 * 24 * time.Hour,
+}
+
+// parseWindow aceita durações do Go (36h) e também dias e semanas (30d, 2w)
+func parseWindow(raw string) (time.Duration, bool) {
+	unit := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if len(raw) > 1 {
+		if step, ok := unit[raw[len(raw)-1]]; ok {
+			n, err := strconv.Atoi(raw[:len(raw)-1])
+			return time.Duration(n) * step, err == nil && n > 0
+		}
+	}
+	d, err := time.ParseDuration(raw)
+	return d, err == nil && d > 0
+}
+
+// correlationMatrix é a resposta de /analytics/correlation. matrix[i][j] é a
+// correlação de Pearson dos retornos logarítmicos de symbols[i] e symbols[j]
+// (null com menos de 3 retornos em comum).
+type correlationMatrix struct {
+	Symbols      []string     `json:"symbols"`
+	Interval     string       `json:"interval"`
+	Window       string       `json:"window"`
+	Start        int64        `json:"start"`
+	End          int64        `json:"end"`
+	Matrix       [][]*float64 `json:"matrix"`
+	Observations [][]int      `json:"observations"`
+}
+
+// Correlation calcula a matriz de correlação dos retornos de vários símbolos
+// @Summary Matriz de correlação entre símbolos
+// @Description Calcula no servidor a correlação de Pearson dos retornos logarítmicos por candle, a partir dos klines em cache
+// @Tags Analytics
+// @Produce json
+// @Param symbols query string true "Símbolos separados por vírgula (2 a 20)"
+// @Param interval query string false "Intervalo dos candles (padrão: 1h)"
+// @Param window query string false "Janela (ex: 30d, 2w, 36h; padrão: 30d)"
+// @Success 200 {object} correlationMatrix
+// @Failure 400 {object} map[string]interface{}
+// @Router /analytics/correlation [get]
+func (p *ProxyServer) Correlation(c *gin.Context) {
+	symbols, err := normalizeSymbols(strings.Split(c.Query("symbols"), ","))
+	if err != nil || len(symbols) < 2 || len(symbols) > maxCorrelationSymbols {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'symbols' deve ter de 2 a "+strconv.Itoa(maxCorrelationSymbols)+" símbolos separados por vírgula")
+		return
+	}
+	interval := c.DefaultQuery("interval", defaultCorrelationInterval)
+	step, ok := klineIntervals[interval]
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'interval' inválido: "+interval)
+		return
+	}
+	window := defaultCorrelationWindow
+	if raw := c.Query("window"); raw != "" {
+		if window, ok = parseWindow(raw); !ok {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'window' inválido (ex: 30d, 2w, 36h)")
+			return
+		}
+	}
+	candles := int(window / step)
+	if candles < 3 || candles > maxCorrelationCandles {
+		respondError(c, http.StatusBadRequest, -1100, "A janela deve ter entre 3 e "+strconv.Itoa(maxCorrelationCandles)+" candles do intervalo")
+		return
+	}
+
+	// Alinha o fim ao último candle fechado: a mesma consulta reaproveita o
+	// cache de klines até o próximo candle fechar
+	stepMs := step.Milliseconds()
+	end := time.Now().UnixMilli()/stepMs*stepMs - 1
+	start := end + 1 - int64(candles)*stepMs
+
+	// Uma busca por símbolo, cada uma com as páginas da janela
+	returns := make([]map[int64]float64, len(symbols))
+	pages := (candles + klinesPageLimit - 1) / klinesPageLimit
+	weight := pages * requestWeight(http.MethodGet, "/klines", nil)
+	errs := p.planner.Run(c.Request.Context(), "/klines", len(symbols), weight, func(ctx context.Context, i int) error {
+		klines, err := p.klineRange(ctx, symbols[i], interval, start, end)
+		if err != nil {
+			return err
+		}
+		returns[i] = logReturns(klines, stepMs)
+		return nil
+	})
+	for _, err := range errs {
+		if err != nil {
+			respondUpstreamError(c, err)
+			return
+		}
+	}
+
+	result := &correlationMatrix{
+		Symbols:      symbols,
+		Interval:     interval,
+		Window:       c.DefaultQuery("window", "30d"),
+		Start:        start,
+		End:          end,
+		Matrix:       make([][]*float64, len(symbols)),
+		Observations: make([][]int, len(symbols)),
+	}
+	for i := range symbols {
+		result.Matrix[i] = make([]*float64, len(symbols))
+		result.Observations[i] = make([]int, len(symbols))
+	}
+	for i := range symbols {
+		for j := i; j < len(symbols); j++ {
+			corr, n := pearson(returns[i], returns[j])
+			result.Matrix[i][j], result.Matrix[j][i] = corr, corr
+			result.Observations[i][j], result.Observations[j][i] = n, n
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// klineRange busca os candles de [start, end] em páginas de 1000, cada uma
+// pelo cache de klines
+func (p *ProxyServer) klineRange(ctx context.Context, symbol, interval string, start, end int64) ([]Kline, error) {
+	var all []Kline
+	for start <= end {
+		page, err := p.market.Klines(ctx, symbol, interval, klinesPageLimit, start, end)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(page) < klinesPageLimit {
+			break
+		}
+		start = page[len(page)-1].OpenTime + 1
+	}
+	return all, nil
+}
+
+// logReturns calcula o retorno logarítmico de cada candle em relação ao
+// anterior, indexado pelo openTime. Candles sem o anterior (lacunas na
+// negociação) ficam de fora.
+func logReturns(klines []Kline, stepMs int64) map[int64]float64 {
+	returns := make(map[int64]float64, len(klines))
+	for i := 1; i < len(klines); i++ {
+		if klines[i].OpenTime-klines[i-1].OpenTime != stepMs {
+			continue
+		}
+		prev, errPrev := strconv.ParseFloat(klines[i-1].Close, 64)
+		curr, errCurr := strconv.ParseFloat(klines[i].Close, 64)
+		if errPrev != nil || errCurr != nil || prev <= 0 || curr <= 0 {
+			continue
+		}
+		returns[klines[i].OpenTime] = math.Log(curr / prev)
+	}
+	return returns
+}
+
+// pearson calcula a correlação entre duas séries nos instantes em comum.
+// Retorna nil com menos de 3 pontos ou variância zero.
+func pearson(a, b map[int64]float64) (*float64, int) {
+	var xs, ys []float64
+	for t, x := range a {
+		if y, ok := b[t]; ok {
+			xs = append(xs, x)
+			ys = append(ys, y)
+		}
+	}
+	n := len(xs)
+	if n < 3 {
+		return nil, n
+	}
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return nil, n
+	}
+	corr := math.Round(cov/math.Sqrt(varX*varY)*1e6) / 1e6
+	return &corr, n
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule é uma expressão cron de 5 campos (minuto hora dia mês
+// dia-da-semana) ou um intervalo fixo (@every 10m)
+type cronSchedule struct {
+	every time.Duration
+
+	minutes  [60]bool
+	hours    [24]bool
+	days     [32]bool
+	months   [13]bool
+	weekdays [7]bool
+	// Como no cron clássico, com dia e dia-da-semana restritos basta um casar
+	anyDay, anyWeekday bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// parseCron aceita "*/15 * * * *", "0 9-18 * * 1-5", "@hourly" ou "@every 30s"
+func parseCron(spec string) (*cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("intervalo inválido em %q", spec)
+		}
+		return &cronSchedule{every: every}, nil
+	}
+	if alias, ok := cronAliases[spec]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expressão cron %q deve ter 5 campos", spec)
+	}
+	s := &cronSchedule{anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	if err := parseCronField(fields[0], 0, 59, s.minutes[:]); err != nil {
+		return nil, err
+	}
+	if err := parseCronField(fields[1], 0, 23, s.hours[:]); err != nil {
+		return nil, err
+	}
+	if err := parseCronField(fields[2], 1, 31, s.days[:]); err != nil {
+		return nil, err
+	}
+	if err := parseCronField(fields[3], 1, 12, s.months[:]); err != nil {
+		return nil, err
+	}
+	// Domingo pode ser 0 ou 7
+	weekdays := make([]bool, 8)
+	if err := parseCronField(fields[4], 0, 7, weekdays); err != nil {
+		return nil, err
+	}
+	copy(s.weekdays[:], weekdays)
+	s.weekdays[0] = s.weekdays[0] || weekdays[7]
+	return s, nil
+}
+
+// parseCronField marca em set os valores de um campo: *, N, A-B, listas com
+// vírgula e passos (*/5, 10-30/10)
+func parseCronField(field string, lo, hi int, set []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("passo inválido em %q", field)
+			}
+			step = n
+		}
+		start, end := lo, hi
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			a, err := strconv.Atoi(from)
+			if err != nil {
+				return fmt.Errorf("valor inválido em %q", field)
+			}
+			start, end = a, a
+			if isRange {
+				if end, err = strconv.Atoi(to); err != nil {
+					return fmt.Errorf("valor inválido em %q", field)
+				}
+			} else if hasStep {
+				end = hi
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return fmt.Errorf("valor fora do intervalo %d-%d em %q", lo, hi, field)
+		}
+		for v := start; v <= end; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	day, weekday := s.days[t.Day()], s.weekdays[t.Weekday()]
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// Next retorna o próximo horário, estritamente depois de t, em que o job roda
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	// Quatro anos cobrem qualquer combinação válida (inclusive 29 de fevereiro)
+	limit := next.AddDate(4, 0, 0)
+	for next.Before(limit) {
+		switch {
+		case !s.months[next.Month()]:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+		case !s.dayMatches(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+		case !s.hours[next.Hour()]:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+		case !s.minutes[next.Minute()]:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestDeadlineHeader = "X-Request-Deadline-Ms"
+	// Prazo máximo aceito no header
+	maxRequestDeadline = 5 * time.Minute
+)
+
+// Etapas da requisição em que o prazo pode se esgotar
+const (
+	deadlineStageProxy     = "proxy"
+	deadlineStageQueue     = "queue"
+	deadlineStageUpstream  = "upstream"
+	deadlineStageTransform = "transform"
+)
+
+// requestDeadlineKey guarda o *requestDeadline no contexto da requisição
+type requestDeadlineKey struct{}
+
+// requestDeadline é o orçamento de tempo pedido pelo cliente e a etapa em
+// que a requisição está
+type requestDeadline struct {
+	start  time.Time
+	budget time.Duration
+	stage  atomic.Value
+}
+
+// deadlineResponse é o corpo do 504 por prazo esgotado
+type deadlineResponse struct {
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+	Msg        string `json:"msg"`
+	DeadlineMs int64  `json:"deadlineMs"`
+	ElapsedMs  int64  `json:"elapsedMs"`
+	Stage      string `json:"stage"`
+}
+
+// RequestDeadline aplica o X-Request-Deadline-Ms do cliente: o prazo vale
+// para todo o tempo da requisição no proxy (fila do orçamento de peso,
+// chamada à Binance e transformação da resposta). Esgotado, a resposta é um
+// 504 com o código -1007 da Binance.
+func RequestDeadline() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.Request.Header.Get(requestDeadlineHeader)
+		if raw == "" {
+			c.Next()
+			return
+		}
+		ms, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || ms <= 0 {
+			respondError(c, http.StatusBadRequest, -1100, "X-Request-Deadline-Ms inválido: use os milissegundos do prazo, maior que zero")
+			c.Abort()
+			return
+		}
+		budget := maxRequestDeadline
+		if ms < maxRequestDeadline.Milliseconds() {
+			budget = time.Duration(ms) * time.Millisecond
+		}
+		deadline := &requestDeadline{start: time.Now(), budget: budget}
+		deadline.stage.Store(deadlineStageProxy)
+		ctx, cancel := context.WithTimeout(context.WithValue(c.Request.Context(), requestDeadlineKey{}, deadline), deadline.budget)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		// Handler que desistiu pelo contexto sem responder
+		if !c.Writer.Written() && deadlineExceeded(ctx) {
+			respondDeadline(c)
+		}
+	}
+}
+
+// setDeadlineStage registra a etapa em que a requisição está
+func setDeadlineStage(ctx context.Context, stage string) {
+	if deadline, ok := ctx.Value(requestDeadlineKey{}).(*requestDeadline); ok {
+		deadline.stage.Store(stage)
+	}
+}
+
+// deadlineExceeded indica que o prazo do X-Request-Deadline-Ms se esgotou
+func deadlineExceeded(ctx context.Context) bool {
+	_, ok := ctx.Value(requestDeadlineKey{}).(*requestDeadline)
+	return ok && errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// respondDeadline responde o 504 do prazo esgotado, com a etapa em que ele
+// se esgotou. Esgotado depois do envio à Binance, o resultado de uma ordem é
+// desconhecido, como no -1007 da própria Binance.
+func respondDeadline(c *gin.Context) {
+	deadline, _ := c.Request.Context().Value(requestDeadlineKey{}).(*requestDeadline)
+	stage, _ := deadline.stage.Load().(string)
+	msg := "Prazo de X-Request-Deadline-Ms esgotado na etapa " + stage
+	if c.Request.Method != http.MethodGet && (stage == deadlineStageUpstream || stage == deadlineStageTransform) {
+		msg += "; a requisição chegou à Binance e o resultado de uma ordem é desconhecido"
+	}
+	c.AbortWithStatusJSON(http.StatusGatewayTimeout, deadlineResponse{
+		Code:       -1007,
+		Message:    msg,
+		Msg:        msg,
+		DeadlineMs: deadline.budget.Milliseconds(),
+		ElapsedMs:  time.Since(deadline.start).Milliseconds(),
+		Stage:      stage,
+	})
+}
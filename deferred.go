@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	deferredBucket = "deferred"
+	// Header com que o cliente aceita que a chamada fique na fila se a
+	// Binance estiver fora
+	deferHeader = "X-Defer-On-Outage"
+	// Intervalo entre as verificações da Binance enquanto há fila
+	// (DEFERRED_RETRY_INTERVAL)
+	defaultDeferredRetryInterval = 5 * time.Second
+	// Idade máxima de uma chamada na fila antes de expirar (DEFERRED_MAX_AGE)
+	defaultDeferredMaxAge = time.Hour
+	// Por quanto tempo as chamadas terminadas continuam consultáveis
+	deferredRetention = 24 * time.Hour
+	deferredTimeout   = 15 * time.Second
+)
+
+// Endpoints de ordem (relativos a /api/v3) que aceitam newClientOrderId: o
+// proxy preenche um ao adiar, para que um reenvio não crie outra ordem
+var deferredOrderPaths = map[string]bool{"/order": true, "/sor/order": true, "/order/cancelReplace": true}
+
+// Estados de uma chamada adiada
+const (
+	deferredQueued   = "queued"
+	deferredDone     = "done"
+	deferredFailed   = "failed"
+	deferredExpired  = "expired"
+	deferredCanceled = "canceled"
+)
+
+// DeferredRequest é uma escrita que falhou por falta de conexão com a Binance
+// e ficou na fila para ser reenviada quando ela voltar. A chamada é guardada
+// sem timestamp nem assinatura: o proxy assina de novo com as credenciais do
+// tenant na hora do envio.
+type DeferredRequest struct {
+	ID      string     `json:"id"`
+	Tenant  string     `json:"tenant"`
+	Method  string     `json:"method"`
+	Path    string     `json:"path"`
+	Params  url.Values `json:"params"`
+	Status  string     `json:"status"`
+	Created int64      `json:"createdAt"`
+	Updated int64      `json:"updatedAt"`
+	// Envios tentados; os que caíram por falta de conexão mantêm a chamada na fila
+	Attempts int `json:"attempts"`
+	// Resposta da Binance ao envio que terminou a chamada
+	UpstreamStatus int             `json:"upstreamStatus,omitempty"`
+	Response       json.RawMessage `json:"response,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// DeferredQueue guarda no armazenamento local as escritas não urgentes (ex:
+// cancelar todas as ordens abertas) que o cliente pediu para adiar durante
+// uma queda da Binance. Enquanto há fila, a Binance é verificada com /ping a
+// cada intervalo; quando responde, as chamadas saem na ordem em que chegaram.
+type DeferredQueue struct {
+	proxy    *ProxyServer
+	store    *Store
+	interval time.Duration
+	maxAge   time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*DeferredRequest
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewDeferredQueue carrega as chamadas gravadas
+func NewDeferredQueue(proxy *ProxyServer, store *Store, interval, maxAge time.Duration) (*DeferredQueue, error) {
+	if interval <= 0 {
+		interval = defaultDeferredRetryInterval
+	}
+	if maxAge <= 0 {
+		maxAge = defaultDeferredMaxAge
+	}
+	q := &DeferredQueue{
+		proxy:    proxy,
+		store:    store,
+		interval: interval,
+		maxAge:   maxAge,
+		pending:  map[string]*DeferredRequest{},
+		stop:     make(chan struct{}),
+	}
+	err := store.ForEach(deferredBucket, func(key string, data []byte) error {
+		var req DeferredRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return fmt.Errorf("chamada adiada %s: %w", key, err)
+		}
+		if req.Status == deferredQueued {
+			q.pending[req.ID] = &req
+		}
+		return nil
+	})
+	return q, err
+}
+
+// Start inicia o envio das chamadas na fila
+func (q *DeferredQueue) Start() {
+	q.wg.Add(1)
+	go q.loop()
+}
+
+// Close para o envio; o que está na fila continua gravado para o próximo início
+func (q *DeferredQueue) Close() {
+	close(q.stop)
+	q.wg.Wait()
+}
+
+func (q *DeferredQueue) loop() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		}
+		q.drain()
+		if time.Since(lastPurge) > time.Hour {
+			q.purge()
+			lastPurge = time.Now()
+		}
+	}
+}
+
+// Add grava a chamada na fila
+func (q *DeferredQueue) Add(req *DeferredRequest) error {
+	var id [8]byte
+	rand.Read(id[:])
+	now := time.Now().UnixMilli()
+	req.ID, req.Status, req.Created, req.Updated = hex.EncodeToString(id[:]), deferredQueued, now, now
+	if req.Method == http.MethodPost && deferredOrderPaths[req.Path] && req.Params.Get("newClientOrderId") == "" {
+		req.Params.Set("newClientOrderId", "deferred-"+req.ID)
+	}
+	if err := q.store.Put(deferredBucket, req.ID, req); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.pending[req.ID] = req
+	q.mu.Unlock()
+	return nil
+}
+
+// Cancel tira da fila uma chamada ainda não enviada
+func (q *DeferredQueue) Cancel(id string) (*DeferredRequest, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	req, ok := q.pending[id]
+	if !ok {
+		return nil, false, nil
+	}
+	delete(q.pending, id)
+	req.Status, req.Updated = deferredCanceled, time.Now().UnixMilli()
+	return req, true, q.store.Put(deferredBucket, id, req)
+}
+
+// queued retorna as chamadas na fila, da mais antiga à mais recente
+func (q *DeferredQueue) queued() []*DeferredRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	reqs := make([]*DeferredRequest, 0, len(q.pending))
+	for _, req := range q.pending {
+		reqs = append(reqs, req)
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Created < reqs[j].Created })
+	return reqs
+}
+
+// drain verifica a Binance e, se ela responder, envia a fila em ordem. Uma
+// chamada que cai de novo por falta de conexão interrompe a rodada.
+func (q *DeferredQueue) drain() {
+	reqs := q.queued()
+	if len(reqs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deferredTimeout)
+	_, err := q.proxy.fetchUpstream(ctx, "/ping", nil)
+	cancel()
+	for _, req := range reqs {
+		if time.Since(time.UnixMilli(req.Created)) > q.maxAge {
+			q.finish(req, deferredExpired, 0, nil, "Binance indisponível por mais de "+q.maxAge.String())
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		err = q.send(req)
+	}
+}
+
+// send assina e envia a chamada. Retorna erro só quando a chamada com
+// certeza não foi executada (não saiu do proxy ou levou 429) e continua na
+// fila. Sem resposta depois de enviada, ou com 5xx, o resultado é
+// desconhecido e a chamada termina como failed, sem novo envio.
+func (q *DeferredQueue) send(req *DeferredRequest) error {
+	tenant := q.proxy.tenants.ByName(req.Tenant)
+	if tenant == nil {
+		q.finish(req, deferredFailed, 0, nil, "tenant não encontrado")
+		return nil
+	}
+	q.mu.Lock()
+	if _, ok := q.pending[req.ID]; !ok {
+		// Cancelada enquanto a rodada andava
+		q.mu.Unlock()
+		return nil
+	}
+	req.Attempts++
+	q.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), deferredTimeout)
+	defer cancel()
+	ctx = withConsumer(ctx, tenant.Name)
+	root := strings.TrimPrefix(strings.TrimSuffix(q.proxy.binanceURL, "/"), q.proxy.apiRoot())
+	body, err := q.proxy.signedRequest(ctx, tenant, req.Method, root+req.Path, req.Params)
+	if err == nil {
+		q.finish(req, deferredDone, http.StatusOK, body, "")
+		return nil
+	}
+	upstreamErr, ok := err.(*UpstreamError)
+	if requestNotSent(err) || ok && upstreamErr.StatusCode == http.StatusTooManyRequests {
+		q.save(req)
+		return err
+	}
+	if !ok {
+		q.finish(req, deferredFailed, 0, nil, "sem resposta da Binance depois do envio; a chamada pode ter sido executada: "+redactSecrets(err.Error()))
+		return nil
+	}
+	detail := "Binance retornou status " + strconv.Itoa(upstreamErr.StatusCode)
+	if upstreamErr.StatusCode >= 500 {
+		detail += "; a chamada pode ter sido executada"
+	}
+	q.finish(req, deferredFailed, upstreamErr.StatusCode, upstreamErr.Body, detail)
+	return nil
+}
+
+// requestNotSent indica se a chamada com certeza não saiu do proxy: a
+// conexão não abriu (DNS, conexão recusada, rede inalcançável) ou a espera
+// foi pelo orçamento de peso. Timeouts e conexões derrubadas depois do envio
+// não contam, já que a Binance pode ter executado a chamada.
+func requestNotSent(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, errWeightExhausted):
+		return true
+	case errors.As(err, &dnsErr):
+		return true
+	case errors.As(err, &opErr):
+		return opErr.Op == "dial"
+	}
+	return false
+}
+
+// finish tira a chamada da fila com o resultado
+func (q *DeferredQueue) finish(req *DeferredRequest, status string, upstreamStatus int, body []byte, detail string) {
+	q.mu.Lock()
+	delete(q.pending, req.ID)
+	req.Status, req.UpstreamStatus, req.Error = status, upstreamStatus, redactSecrets(detail)
+	if json.Valid(body) {
+		req.Response = body
+	}
+	q.mu.Unlock()
+	q.save(req)
+}
+
+func (q *DeferredQueue) save(req *DeferredRequest) {
+	q.mu.Lock()
+	req.Updated = time.Now().UnixMilli()
+	snapshot := *req
+	q.mu.Unlock()
+	if err := q.store.Put(deferredBucket, snapshot.ID, snapshot); err != nil {
+		// log.Printf("[WARN] Erro ao gravar chamada adiada %s: %v", snapshot.ID, err)
+	}
+}
+
+// purge apaga as chamadas terminadas há mais de deferredRetention
+func (q *DeferredQueue) purge() {
+	var old []string
+	q.store.ForEach(deferredBucket, func(key string, data []byte) error {
+		var req DeferredRequest
+		if json.Unmarshal(data, &req) == nil && req.Status != deferredQueued && time.Since(time.UnixMilli(req.Updated)) > deferredRetention {
+			old = append(old, key)
+		}
+		return nil
+	})
+	for _, key := range old {
+		q.store.Delete(deferredBucket, key)
+	}
+}
+
+// deferRequest põe na fila a escrita assinada pelo proxy que não chegou à
+// Binance, se o cliente pediu com X-Defer-On-Outage, e responde 202 com o
+// ID. Só adia quando a chamada com certeza não saiu (requestNotSent): uma
+// que pode ter sido executada nunca é reenviada. Retorna false quando a
+// chamada não pode ser adiada e o erro segue.
+func (p *ProxyServer) deferRequest(c *gin.Context, tenant *Tenant, path, query string, body []byte, cause error) bool {
+	if p.deferred == nil || tenant == nil || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || !requestNotSent(cause) {
+		return false
+	}
+	if ok, _ := strconv.ParseBool(c.GetHeader(deferHeader)); !ok {
+		return false
+	}
+	// Os parâmetros sem timestamp e assinatura; o envio assina de novo
+	params, _ := url.ParseQuery(query)
+	if len(body) > 0 && isFormBody(c.Request) {
+		form, _ := url.ParseQuery(string(body))
+		for key, values := range form {
+			params[key] = append(params[key], values...)
+		}
+	}
+	params.Del("timestamp")
+	params.Del("signature")
+
+	req := &DeferredRequest{Tenant: tenant.Name, Method: c.Request.Method, Path: path, Params: params}
+	if err := p.deferred.Add(req); err != nil {
+		// log.Printf("[WARN] Erro ao adiar chamada: %v", err)
+		return false
+	}
+	location := "/local/deferred/" + req.ID
+	c.Header("Location", location)
+	resp := gin.H{
+		"id":        req.ID,
+		"status":    req.Status,
+		"statusUrl": location,
+		"msg":       "Binance indisponível; chamada adiada até ela voltar: " + redactSecrets(cause.Error()),
+	}
+	if id := req.Params.Get("newClientOrderId"); id != "" {
+		resp["newClientOrderId"] = id
+	}
+	c.JSON(http.StatusAccepted, resp)
+	return true
+}
+
+// requireDeferred autentica o tenant e garante que a fila está habilitada
+func (p *ProxyServer) requireDeferred(c *gin.Context) (*Tenant, bool) {
+	if p.deferred == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Fila de chamadas adiadas desabilitada (DEFERRED_QUEUE_ENABLED)")
+		return nil, false
+	}
+	return p.requireTenant(c)
+}
+
+// loadDeferred busca a chamada do path, respondendo 404 se não existir ou
+// pertencer a outro tenant
+func (p *ProxyServer) loadDeferred(c *gin.Context, tenant *Tenant) (*DeferredRequest, bool) {
+	var req DeferredRequest
+	found, err := p.store.Get(deferredBucket, c.Param("id"), &req)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao ler chamada adiada: "+err.Error())
+		return nil, false
+	}
+	if !found || req.Tenant != tenant.Name {
+		respondError(c, http.StatusNotFound, -1000, "Chamada adiada não encontrada")
+		return nil, false
+	}
+	return &req, true
+}
+
+// ListDeferred lista as chamadas adiadas do tenant
+// @Summary Chamadas adiadas
+// @Description Escritas adiadas com X-Defer-On-Outage durante uma queda da Binance, da mais recente à mais antiga, com estado e resposta do envio
+// @Tags Account
+// @Produce json
+// @Success 200 {array} DeferredRequest
+// @Router /local/deferred [get]
+func (p *ProxyServer) ListDeferred(c *gin.Context) {
+	tenant, ok := p.requireDeferred(c)
+	if !ok {
+		return
+	}
+	reqs := []DeferredRequest{}
+	err := p.store.ForEach(deferredBucket, func(key string, data []byte) error {
+		var req DeferredRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		if req.Tenant == tenant.Name {
+			reqs = append(reqs, req)
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao listar chamadas adiadas: "+err.Error())
+		return
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Created > reqs[j].Created })
+	c.JSON(http.StatusOK, reqs)
+}
+
+// GetDeferred mostra uma chamada adiada do tenant
+// @Summary Consultar chamada adiada
+// @Description Estado da chamada (queued, done, failed, expired ou canceled), tentativas e a resposta da Binance ao envio
+// @Tags Account
+// @Produce json
+// @Param id path string true "ID da chamada adiada"
+// @Success 200 {object} DeferredRequest
+// @Failure 404 {object} map[string]interface{}
+// @Router /local/deferred/{id} [get]
+func (p *ProxyServer) GetDeferred(c *gin.Context) {
+	tenant, ok := p.requireDeferred(c)
+	if !ok {
+		return
+	}
+	if req, ok := p.loadDeferred(c, tenant); ok {
+		c.JSON(http.StatusOK, req)
+	}
+}
+
+// CancelDeferred tira da fila uma chamada ainda não enviada
+// @Summary Cancelar chamada adiada
+// @Tags Account
+// @Produce json
+// @Param id path string true "ID da chamada adiada"
+// @Success 200 {object} DeferredRequest
+// @Failure 409 {object} map[string]interface{}
+// @Router /local/deferred/{id} [delete]
+func (p *ProxyServer) CancelDeferred(c *gin.Context) {
+	tenant, ok := p.requireDeferred(c)
+	if !ok {
+		return
+	}
+	if _, ok := p.loadDeferred(c, tenant); !ok {
+		return
+	}
+	req, canceled, err := p.deferred.Cancel(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao cancelar chamada adiada: "+err.Error())
+		return
+	}
+	if !canceled {
+		respondError(c, http.StatusConflict, -1000, "A chamada adiada não está mais na fila")
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
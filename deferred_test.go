@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRequestNotSent(t *testing.T) {
+	// Porta fechada: a conexão nem abre
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + ln.Addr().String()
+	ln.Close()
+	_, refused := http.Get(closed)
+
+	// A chamada sai e a resposta não chega
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer hang.Close()
+	_, timeout := (&http.Client{Timeout: 50 * time.Millisecond}).Post(hang.URL, "text/plain", nil)
+
+	// Conexão derrubada depois de receber a chamada
+	reset := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer reset.Close()
+	_, dropped := http.Post(reset.URL, "text/plain", nil)
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"conexão recusada", refused, true},
+		{"DNS", &url.Error{Op: "Post", URL: "https://x.invalid", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "x.invalid"}}}, true},
+		{"orçamento de peso", &url.Error{Op: "Post", Err: errWeightExhausted}, true},
+		{"timeout de leitura", timeout, false},
+		{"conexão derrubada", dropped, false},
+		{"EOF", io.ErrUnexpectedEOF, false},
+		{"resposta da Binance", &UpstreamError{StatusCode: http.StatusBadGateway}, false},
+	} {
+		if tc.err == nil {
+			t.Fatalf("%s: esperado um erro", tc.name)
+		}
+		if got := requestNotSent(tc.err); got != tc.want {
+			t.Errorf("%s: requestNotSent(%v) = %v, esperado %v", tc.name, tc.err, got, tc.want)
+		}
+	}
+	if requestNotSent(errors.New("outro")) {
+		t.Error("erro qualquer não deve ser adiado")
+	}
+}
+
+func TestDeferredOrderGetsClientOrderID(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	q, err := NewDeferredQueue(nil, store, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := &DeferredRequest{Tenant: "desk", Method: http.MethodPost, Path: "/order", Params: url.Values{"symbol": {"BTCUSDT"}}}
+	if err := q.Add(order); err != nil {
+		t.Fatal(err)
+	}
+	if got := order.Params.Get("newClientOrderId"); got != "deferred-"+order.ID {
+		t.Errorf("newClientOrderId = %q, esperado deferred-%s", got, order.ID)
+	}
+
+	own := &DeferredRequest{Tenant: "desk", Method: http.MethodPost, Path: "/order", Params: url.Values{"newClientOrderId": {"meu-id"}}}
+	cancel := &DeferredRequest{Tenant: "desk", Method: http.MethodDelete, Path: "/openOrders", Params: url.Values{"symbol": {"BTCUSDT"}}}
+	for _, req := range []*DeferredRequest{own, cancel} {
+		if err := q.Add(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := own.Params.Get("newClientOrderId"); got != "meu-id" {
+		t.Errorf("newClientOrderId do cliente trocado por %q", got)
+	}
+	if cancel.Params.Has("newClientOrderId") {
+		t.Error("cancelamento não deve receber newClientOrderId")
+	}
+}
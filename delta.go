@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	deltaHeader          = "X-Delta"
+	deltaBaseHeader      = "X-Delta-Base"
+	jsonPatchContentType = "application/json-patch+json"
+	defaultDeltaVersions = 4
+	defaultDeltaMaxKeys  = 1000
+	defaultDeltaTTL      = 5 * time.Minute
+)
+
+// deltaVersion é uma versão de resposta já entregue a um cliente
+type deltaVersion struct {
+	etag string
+	body []byte
+}
+
+// deltaSeries guarda as últimas versões de uma mesma requisição
+type deltaSeries struct {
+	versions []deltaVersion
+	touched  time.Time
+}
+
+// DeltaStore guarda as últimas respostas JSON entregues a clientes que
+// pedem X-Delta: true, para responder às próximas consultas com um JSON
+// Patch (RFC 6902) em relação à versão que o cliente já tem (If-None-Match).
+// A chave inclui os headers de credenciais, como no cache de respostas.
+type DeltaStore struct {
+	versions int
+	maxKeys  int
+	ttl      time.Duration
+
+	mu     sync.Mutex
+	series map[string]*deltaSeries
+}
+
+// NewDeltaStore cria o store com até versions versões por requisição e
+// maxKeys requisições, descartando as que não são consultadas há ttl
+func NewDeltaStore(versions, maxKeys int, ttl time.Duration) *DeltaStore {
+	if versions < 1 {
+		versions = 1
+	}
+	return &DeltaStore{
+		versions: versions,
+		maxKeys:  maxKeys,
+		ttl:      ttl,
+		series:   map[string]*deltaSeries{},
+	}
+}
+
+// responseETag é o ETag forte do corpo
+func responseETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// remember registra a versão entregue e retorna o corpo da versão base, se
+// ela ainda estiver guardada
+func (d *DeltaStore) remember(key, base, etag string, body []byte) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	series, ok := d.series[key]
+	if ok && now.Sub(series.touched) > d.ttl {
+		delete(d.series, key)
+		ok = false
+	}
+	if !ok {
+		if len(d.series) >= d.maxKeys {
+			for k, s := range d.series {
+				if now.Sub(s.touched) > d.ttl {
+					delete(d.series, k)
+				}
+			}
+			if len(d.series) >= d.maxKeys {
+				return nil, false
+			}
+		}
+		series = &deltaSeries{}
+		d.series[key] = series
+	}
+	series.touched = now
+
+	var previous []byte
+	found := false
+	for _, version := range series.versions {
+		if version.etag == base {
+			previous, found = version.body, true
+		}
+		if version.etag == etag {
+			return previous, found
+		}
+	}
+	series.versions = append(series.versions, deltaVersion{etag: etag, body: body})
+	if len(series.versions) > d.versions {
+		series.versions = series.versions[len(series.versions)-d.versions:]
+	}
+	return previous, found
+}
+
+// deltaWriter retém a resposta para que o middleware decida entre o corpo
+// completo, o patch ou 304
+type deltaWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *deltaWriter) Write(data []byte) (int, error) {
+	return w.buf.Write(data)
+}
+
+func (w *deltaWriter) WriteString(s string) (int, error) {
+	return w.buf.WriteString(s)
+}
+
+func (w *deltaWriter) Flush() {}
+
+// Middleware atende o modo X-Delta: true nas chamadas GET repassadas. A
+// resposta leva ETag; se o cliente informa em If-None-Match uma versão
+// ainda guardada, recebe 304 quando nada mudou ou 226 (IM Used) com um
+// JSON Patch, desde que o patch seja menor que o corpo completo.
+func (d *DeltaStore) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d == nil || !strings.EqualFold(c.GetHeader(deltaHeader), "true") || c.Request.Method != http.MethodGet ||
+			isHeadRequest(c.Request.Context()) || isSignedRequest(c) {
+			c.Next()
+			return
+		}
+
+		writer := &deltaWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		body := writer.buf.Bytes()
+		header := c.Writer.Header()
+		mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+		if c.Writer.Status() != http.StatusOK || mediaType != "application/json" || header.Get("Content-Encoding") != "" {
+			c.Writer.Write(body)
+			return
+		}
+
+		base := strings.TrimPrefix(strings.TrimSpace(c.GetHeader("If-None-Match")), "W/")
+		etag := responseETag(body)
+		previous, found := d.remember(requestKey(c.Request, credentialHeaderKeys), base, etag, bytes.Clone(body))
+		header.Set("ETag", etag)
+		switch {
+		case base == etag:
+			header.Del("Content-Length")
+			header.Del("Content-Type")
+			c.Writer.WriteHeader(http.StatusNotModified)
+			c.Writer.WriteHeaderNow()
+			return
+		case found:
+			if patch, err := jsonPatch(previous, body); err == nil && len(patch) < len(body) {
+				header.Set("Content-Type", jsonPatchContentType)
+				header.Set("Content-Length", strconv.Itoa(len(patch)))
+				header.Set(deltaBaseHeader, base)
+				c.Writer.WriteHeader(http.StatusIMUsed)
+				c.Writer.Write(patch)
+				return
+			}
+		}
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		c.Writer.Write(body)
+	}
+}
+
+// patchOp é uma operação de JSON Patch
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// jsonPatch gera o JSON Patch que transforma from em to. Números são
+// comparados pelo texto, para preservar a representação da Binance.
+func jsonPatch(from, to []byte) ([]byte, error) {
+	a, err := decodeJSONNumber(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := decodeJSONNumber(to)
+	if err != nil {
+		return nil, err
+	}
+	ops := []patchOp{}
+	if err := diffJSON("", a, b, &ops); err != nil {
+		return nil, err
+	}
+	return json.Marshal(ops)
+}
+
+func diffJSON(path string, a, b interface{}, ops *[]patchOp) error {
+	switch from := a.(type) {
+	case map[string]interface{}:
+		to, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(from))
+		for key := range from {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, ok := to[key]; !ok {
+				*ops = append(*ops, patchOp{Op: "remove", Path: path + "/" + pointerEscaper.Replace(key)})
+			}
+		}
+		keys = keys[:0]
+		for key := range to {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := path + "/" + pointerEscaper.Replace(key)
+			if old, ok := from[key]; ok {
+				if err := diffJSON(child, old, to[key], ops); err != nil {
+					return err
+				}
+			} else if err := appendPatchOp(ops, "add", child, to[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		to, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		common := min(len(from), len(to))
+		for i := 0; i < common; i++ {
+			if err := diffJSON(path+"/"+strconv.Itoa(i), from[i], to[i], ops); err != nil {
+				return err
+			}
+		}
+		for i := common; i < len(to); i++ {
+			if err := appendPatchOp(ops, "add", path+"/"+strconv.Itoa(i), to[i]); err != nil {
+				return err
+			}
+		}
+		// Remoções do fim para o início, para os índices continuarem válidos
+		for i := len(from) - 1; i >= common; i-- {
+			*ops = append(*ops, patchOp{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		return nil
+	}
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	return appendPatchOp(ops, "replace", path, b)
+}
+
+func appendPatchOp(ops *[]patchOp, op, path string, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	*ops = append(*ops, patchOp{Op: op, Path: path, Value: encoded})
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Famílias de endereço das conexões com a Binance (UPSTREAM_IP_FAMILY)
+const (
+	// As duas, na ordem do DNS, com Happy Eyeballs (o padrão do Go)
+	ipFamilyAuto = "auto"
+	// Só IPv4 ou só IPv6
+	ipFamilyIPv4 = "ipv4"
+	ipFamilyIPv6 = "ipv6"
+	// A família indicada primeiro e a outra só como alternativa
+	ipFamilyPreferIPv4 = "prefer-ipv4"
+	ipFamilyPreferIPv6 = "prefer-ipv6"
+)
+
+const (
+	upstreamDialTimeout   = 30 * time.Second
+	upstreamDialKeepAlive = 30 * time.Second
+	// Espera pela primeira família antes de tentar a outra em paralelo (RFC 8305)
+	defaultHappyEyeballsDelay = 300 * time.Millisecond
+)
+
+// UpstreamDialPolicy define por qual família de endereço as conexões HTTP e
+// WebSocket com a Binance são abertas. Alguns provedores têm rotas IPv6
+// degradadas até a Binance; com ipv4 ou prefer-ipv4 elas são evitadas sem
+// mexer no sistema operacional.
+type UpstreamDialPolicy struct {
+	// UPSTREAM_IP_FAMILY
+	Family string
+	// Espera pela família preferida antes de tentar a outra em paralelo
+	// (UPSTREAM_HAPPY_EYEBALLS_DELAY; 0 só tenta a outra depois que a
+	// preferida falha em todos os endereços)
+	FallbackDelay time.Duration
+
+	// Conexões abertas por família desde o início do processo
+	stats *dialStats
+}
+
+// NewUpstreamDialPolicy cria a política e confere a família e a espera
+func NewUpstreamDialPolicy(family string, fallbackDelay time.Duration) (*UpstreamDialPolicy, error) {
+	policy := &UpstreamDialPolicy{Family: family, FallbackDelay: fallbackDelay, stats: &dialStats{}}
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// validate confere a família e a espera
+func (p *UpstreamDialPolicy) validate() error {
+	switch p.Family {
+	case ipFamilyAuto, ipFamilyIPv4, ipFamilyIPv6, ipFamilyPreferIPv4, ipFamilyPreferIPv6:
+	default:
+		return fmt.Errorf("UPSTREAM_IP_FAMILY deve ser auto, ipv4, ipv6, prefer-ipv4 ou prefer-ipv6, não %q", p.Family)
+	}
+	if p.FallbackDelay < 0 {
+		return errors.New("UPSTREAM_HAPPY_EYEBALLS_DELAY não pode ser negativo")
+	}
+	return nil
+}
+
+// dial abre as conexões com a Binance pela política (DialContext do
+// transporte HTTP e NetDialContext do dialer WebSocket)
+func (p *UpstreamDialPolicy) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:       upstreamDialTimeout,
+		KeepAlive:     upstreamDialKeepAlive,
+		FallbackDelay: p.FallbackDelay,
+		// Chamado a cada endereço tentado, já com a família (tcp4 ou tcp6)
+		ControlContext: func(_ context.Context, network, _ string, _ syscall.RawConn) error {
+			p.stats.family(network == "tcp6").attempts.Add(1)
+			return nil
+		},
+	}
+	if p.FallbackDelay == 0 {
+		dialer.FallbackDelay = -1
+	}
+
+	var conn net.Conn
+	var err error
+	switch p.Family {
+	case ipFamilyIPv4:
+		conn, err = dialer.DialContext(ctx, "tcp4", address)
+	case ipFamilyIPv6:
+		conn, err = dialer.DialContext(ctx, "tcp6", address)
+	case ipFamilyPreferIPv4, ipFamilyPreferIPv6:
+		conn, err = p.dialPreferred(ctx, dialer, address)
+	default:
+		conn, err = dialer.DialContext(ctx, network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		p.stats.family(addr.IP.To4() == nil).connected.Add(1)
+	}
+	return conn, nil
+}
+
+// dialPreferred tenta os endereços da família preferida e, depois de
+// FallbackDelay (ou quando todos falham), os da outra em paralelo. A
+// primeira conexão aberta vence; a outra é fechada.
+func (p *UpstreamDialPolicy) dialPreferred(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var preferred, others []string
+	for _, addr := range addrs {
+		target := net.JoinHostPort(addr.String(), port)
+		if (addr.IP.To4() != nil) == (p.Family == ipFamilyPreferIPv4) {
+			preferred = append(preferred, target)
+		} else {
+			others = append(others, target)
+		}
+	}
+	if len(preferred) == 0 {
+		preferred, others = others, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan dialResult, 2)
+	dialAll := func(targets []string, primary bool) {
+		var err error
+		for _, target := range targets {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, "tcp", target); err == nil {
+				results <- dialResult{conn: conn, primary: primary}
+				return
+			}
+		}
+		results <- dialResult{err: err, primary: primary}
+	}
+
+	go dialAll(preferred, true)
+	started := 1
+	var fallback <-chan time.Time
+	if len(others) > 0 && p.FallbackDelay > 0 {
+		timer := time.NewTimer(p.FallbackDelay)
+		defer timer.Stop()
+		fallback = timer.C
+	}
+	startFallback := func() {
+		if len(others) > 0 && started == 1 {
+			started++
+			fallback = nil
+			go dialAll(others, false)
+		}
+	}
+	var firstErr error
+	for done := 0; done < started; {
+		select {
+		case <-fallback:
+			startFallback()
+		case result := <-results:
+			done++
+			if result.err == nil {
+				if pending := started - done; pending > 0 {
+					go func() {
+						if loser := <-results; loser.conn != nil {
+							loser.conn.Close()
+						}
+					}()
+				}
+				return result.conn, nil
+			}
+			// O erro da família preferida é o que interessa
+			if firstErr == nil || result.primary {
+				firstErr = result.err
+			}
+			startFallback()
+		}
+	}
+	return nil, firstErr
+}
+
+// dialCounters conta as tentativas e conexões abertas de uma família
+type dialCounters struct {
+	attempts  atomic.Int64
+	connected atomic.Int64
+}
+
+// dialStats conta as conexões com a Binance por família de endereço
+type dialStats struct {
+	ipv4, ipv6 dialCounters
+}
+
+func (s *dialStats) family(ipv6 bool) *dialCounters {
+	if ipv6 {
+		return &s.ipv6
+	}
+	return &s.ipv4
+}
+
+// DialFamilyStatus são as conexões de uma família em /admin/upstreams
+type DialFamilyStatus struct {
+	// Endereços tentados, inclusive os que perderam a corrida do Happy Eyeballs
+	Attempts  int64 `json:"attempts"`
+	Connected int64 `json:"connected"`
+}
+
+// DialStatus é a política de conexão com a Binance em /admin/upstreams
+type DialStatus struct {
+	Family        string           `json:"family"`
+	FallbackDelay string           `json:"fallbackDelay"`
+	IPv4          DialFamilyStatus `json:"ipv4"`
+	IPv6          DialFamilyStatus `json:"ipv6"`
+}
+
+func (p *UpstreamDialPolicy) Status() DialStatus {
+	s := p.stats
+	return DialStatus{
+		Family:        p.Family,
+		FallbackDelay: p.FallbackDelay.String(),
+		IPv4:          DialFamilyStatus{Attempts: s.ipv4.attempts.Load(), Connected: s.ipv4.connected.Load()},
+		IPv6:          DialFamilyStatus{Attempts: s.ipv6.attempts.Load(), Connected: s.ipv6.connected.Load()},
+	}
+}
+
+func (p *UpstreamDialPolicy) writeMetrics(m *metricsWriter) {
+	status := p.Status()
+	m.family("proxy_upstream_dial_attempts_total", "counter", "Endereços da Binance tentados ao abrir conexões, por família (ipv4 ou ipv6)")
+	m.sample("proxy_upstream_dial_attempts_total", float64(status.IPv4.Attempts), "family", "ipv4")
+	m.sample("proxy_upstream_dial_attempts_total", float64(status.IPv6.Attempts), "family", "ipv6")
+	m.family("proxy_upstream_dials_total", "counter", "Conexões abertas com a Binance, por família (ipv4 ou ipv6)")
+	m.sample("proxy_upstream_dials_total", float64(status.IPv4.Connected), "family", "ipv4")
+	m.sample("proxy_upstream_dials_total", float64(status.IPv6.Connected), "family", "ipv6")
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	driftBucket = "schema_baselines"
+	// Eventos de drift mantidos em memória para /admin/drift
+	maxDriftEvents = 200
+	// Respostas seguidas sem um campo até ele ser considerado removido
+	driftRemoveAfter = 3
+	// Elementos de cada array examinados por resposta
+	driftMaxArrayItems = 500
+	// Respostas maiores não são examinadas (o exchangeInfo completo tem ~15MB)
+	defaultDriftMaxBody = 32 << 20
+)
+
+// Tipos de mudança detectados
+const (
+	driftAdded       = "added"
+	driftRemoved     = "removed"
+	driftTypeChanged = "type_changed"
+	driftSpec        = "spec_mismatch"
+)
+
+// DriftEvent descreve uma mudança no formato de uma resposta da Binance
+type DriftEvent struct {
+	Time     int64  `json:"time"`
+	Endpoint string `json:"endpoint"`
+	Field    string `json:"field"`
+	Kind     string `json:"kind"`
+	Expected string `json:"expected,omitempty"`
+	Observed string `json:"observed,omitempty"`
+}
+
+// driftField é um campo do formato aprendido: tipo JSON (ou tipos, separados
+// por |) e quantas respostas seguidas vieram sem ele
+type driftField struct {
+	Type    string `json:"type"`
+	Missing int    `json:"missing,omitempty"`
+}
+
+// SchemaDriftDetector compara as respostas JSON da Binance com o formato
+// aprendido de cada endpoint (persistido no Store) e com os schemas de
+// resposta do spec OpenAPI, registrando campos novos, removidos ou com tipo
+// diferente. A análise roda fora do caminho da requisição.
+type SchemaDriftDetector struct {
+	store   *Store
+	spec    map[string]*openAPISchema
+	specRef *openAPISpec
+	maxBody int
+	queue   chan driftSample
+
+	mu        sync.Mutex
+	baselines map[string]map[string]*driftField
+	// Divergências do spec já reportadas (endpoint + campo)
+	specSeen map[string]bool
+	events   []DriftEvent
+	checked  int64
+	skipped  int64
+	counts   map[string]int64
+}
+
+type driftSample struct {
+	key      string
+	endpoint string
+	body     []byte
+	gzipped  bool
+}
+
+// NewSchemaDriftDetector carrega os formatos já aprendidos do store e os
+// schemas de resposta do spec (opcional)
+func NewSchemaDriftDetector(store *Store, spec *openAPISpec, maxBody int) *SchemaDriftDetector {
+	d := &SchemaDriftDetector{
+		store:     store,
+		specRef:   spec,
+		spec:      map[string]*openAPISchema{},
+		maxBody:   maxBody,
+		queue:     make(chan driftSample, 64),
+		baselines: map[string]map[string]*driftField{},
+		specSeen:  map[string]bool{},
+		counts:    map[string]int64{},
+	}
+	if spec != nil {
+		for _, op := range spec.binanceOperations() {
+			for _, content := range op.Responses["200"].Content {
+				if content.Schema != nil {
+					d.spec[op.method+" "+op.endpoint] = content.Schema
+				}
+			}
+		}
+	}
+	if store != nil {
+		store.ForEach(driftBucket, func(key string, data []byte) error {
+			var fields map[string]*driftField
+			if json.Unmarshal(data, &fields) == nil {
+				d.baselines[key] = fields
+			}
+			return nil
+		})
+	}
+	go d.run()
+	return d
+}
+
+// Transport envolve o transporte do cliente da Binance, copiando as
+// respostas JSON bem-sucedidas do host da Binance para análise
+func (d *SchemaDriftDetector) Transport(base http.RoundTripper, binanceURL string) http.RoundTripper {
+	host := ""
+	if u, err := url.Parse(binanceURL); err == nil {
+		host = u.Host
+	}
+	return &driftTransport{base: base, detector: d, host: host}
+}
+
+type driftTransport struct {
+	base     http.RoundTripper
+	detector *SchemaDriftDetector
+	host     string
+}
+
+func (t *driftTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || req.URL.Host != t.host || resp.StatusCode != http.StatusOK ||
+		!strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return resp, err
+	}
+	endpoint := upstreamEndpoint(req.URL.Path)
+	resp.Body = &driftBody{
+		ReadCloser: resp.Body,
+		detector:   t.detector,
+		sample: driftSample{
+			key:      driftKey(req.Method, endpoint, req.URL.Query()),
+			endpoint: req.Method + " " + endpoint,
+			gzipped:  resp.Header.Get("Content-Encoding") == "gzip",
+		},
+	}
+	return resp, nil
+}
+
+// driftKey separa formatos que dependem dos parâmetros: com e sem symbol a
+// Binance responde objeto ou array, e type=MINI omite campos
+func driftKey(method, endpoint string, query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		switch name {
+		case "timestamp", "signature", "recvWindow":
+			continue
+		case "type":
+			names = append(names, name+"="+query.Get(name))
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return method + " " + endpoint
+	}
+	return method + " " + endpoint + "?" + strings.Join(names, "&")
+}
+
+// driftBody copia o corpo enquanto o cliente o lê e o envia para análise
+// quando a leitura termina por completo
+type driftBody struct {
+	io.ReadCloser
+	detector *SchemaDriftDetector
+	sample   driftSample
+	buf      bytes.Buffer
+	overflow bool
+	done     bool
+}
+
+func (b *driftBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.overflow {
+		if b.buf.Len()+n > b.detector.maxBody {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.done {
+		b.done = true
+		b.detector.submit(b.sample, b.buf.Bytes(), b.overflow)
+	}
+	return n, err
+}
+
+func (d *SchemaDriftDetector) submit(sample driftSample, body []byte, overflow bool) {
+	if overflow {
+		d.mu.Lock()
+		d.skipped++
+		d.mu.Unlock()
+		return
+	}
+	sample.body = body
+	select {
+	case d.queue <- sample:
+	default:
+		// Fila cheia: a amostra é descartada, sem atrasar o cliente
+		d.mu.Lock()
+		d.skipped++
+		d.mu.Unlock()
+	}
+}
+
+func (d *SchemaDriftDetector) run() {
+	for sample := range d.queue {
+		d.analyze(sample)
+	}
+}
+
+func (d *SchemaDriftDetector) analyze(sample driftSample) {
+	body := sample.body
+	if sample.gzipped {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		body, err = io.ReadAll(reader)
+		if err != nil {
+			return
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return
+	}
+
+	shape := map[string]string{}
+	collectShape(value, "", shape)
+
+	var events []DriftEvent
+	now := time.Now().UnixMilli()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if schema, ok := d.spec[sample.endpoint]; ok {
+		d.checkSpec(value, schema, "", func(field, expected, observed string) {
+			// Cada divergência do spec é reportada uma vez
+			if seen := sample.key + " " + field; !d.specSeen[seen] {
+				d.specSeen[seen] = true
+				events = append(events, DriftEvent{Time: now, Endpoint: sample.key, Field: field, Kind: driftSpec, Expected: expected, Observed: observed})
+			}
+		})
+	}
+	d.checked++
+	baseline, known := d.baselines[sample.key]
+	changed := !known
+	if !known {
+		// Primeira resposta do endpoint: só aprende o formato
+		baseline = map[string]*driftField{}
+		for path, typ := range shape {
+			baseline[path] = &driftField{Type: typ}
+		}
+		d.baselines[sample.key] = baseline
+	} else {
+		for path, typ := range shape {
+			field, ok := baseline[path]
+			switch {
+			case !ok:
+				events = append(events, DriftEvent{Time: now, Endpoint: sample.key, Field: path, Kind: driftAdded, Observed: typ})
+				baseline[path] = &driftField{Type: typ}
+				changed = true
+			case !typeSubset(typ, field.Type):
+				events = append(events, DriftEvent{Time: now, Endpoint: sample.key, Field: path, Kind: driftTypeChanged, Expected: field.Type, Observed: typ})
+				field.Type = typ
+				field.Missing = 0
+				changed = true
+			case field.Missing > 0:
+				field.Missing = 0
+				changed = true
+			}
+		}
+		for path, field := range baseline {
+			// Campos dentro de arrays vazios ou objetos ausentes não contam como removidos
+			if _, ok := shape[path]; ok || !parentObserved(path, shape) {
+				continue
+			}
+			field.Missing++
+			changed = true
+			if field.Missing >= driftRemoveAfter {
+				events = append(events, DriftEvent{Time: now, Endpoint: sample.key, Field: path, Kind: driftRemoved, Expected: field.Type})
+				// Os campos internos saem junto, sem eventos próprios
+				for child := range baseline {
+					if child == path || strings.HasPrefix(child, path+".") || strings.HasPrefix(child, path+"[]") {
+						delete(baseline, child)
+					}
+				}
+			}
+		}
+	}
+
+	for _, event := range events {
+		d.counts[event.Kind]++
+		// log.Printf("[WARN] Drift no schema de %s: %s %s (%s -> %s)", event.Endpoint, event.Kind, event.Field, event.Expected, event.Observed)
+	}
+	d.events = append(d.events, events...)
+	if len(d.events) > maxDriftEvents {
+		d.events = append([]DriftEvent(nil), d.events[len(d.events)-maxDriftEvents:]...)
+	}
+	if changed && d.store != nil {
+		d.store.Put(driftBucket, sample.key, baseline)
+	}
+}
+
+// jsonType é o nome do tipo JSON de um valor decodificado com UseNumber
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// collectShape registra o tipo de cada caminho (ex: symbols[].filters[].minPrice).
+// null não é registrado: a Binance usa null em campos opcionais.
+func collectShape(value interface{}, path string, shape map[string]string) {
+	typ := jsonType(value)
+	if typ == "null" {
+		return
+	}
+	shape[path] = mergeTypes(shape[path], typ)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			collectShape(item, child, shape)
+		}
+	case []interface{}:
+		for i, item := range v {
+			if i >= driftMaxArrayItems {
+				break
+			}
+			collectShape(item, path+"[]", shape)
+		}
+	}
+}
+
+// mergeTypes junta tipos observados em um mesmo caminho (ex: number|string
+// nas linhas de /klines)
+func mergeTypes(current, typ string) string {
+	if current == "" {
+		return typ
+	}
+	types := strings.Split(current, "|")
+	for _, t := range types {
+		if t == typ {
+			return current
+		}
+	}
+	types = append(types, typ)
+	sort.Strings(types)
+	return strings.Join(types, "|")
+}
+
+// typeSubset indica se todos os tipos observados já eram esperados
+func typeSubset(observed, expected string) bool {
+	for _, t := range strings.Split(observed, "|") {
+		if mergeTypes(expected, t) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// parentObserved indica se o objeto ou array que contém path veio na
+// resposta. O tipo dos elementos de um array (a[]) só some junto com o array.
+func parentObserved(path string, shape map[string]string) bool {
+	if strings.HasSuffix(path, "[]") {
+		return false
+	}
+	parent := ""
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		parent = path[:i]
+	}
+	_, ok := shape[parent]
+	return ok
+}
+
+// checkSpec confere o valor com o schema de resposta do spec: tipos dos
+// campos declarados e campos obrigatórios
+func (d *SchemaDriftDetector) checkSpec(value interface{}, schema *openAPISchema, path string, report func(field, expected, observed string)) {
+	schema = d.resolve(schema)
+	if schema == nil || value == nil {
+		return
+	}
+	observed := jsonType(value)
+	expected := schema.Type
+	if expected == "integer" {
+		expected = "number"
+	}
+	if expected != "" && expected != observed {
+		report(path, schema.Type, observed)
+		return
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				report(joinDriftPath(path, name), "required", "")
+			}
+		}
+		for name, prop := range schema.Properties {
+			if item, ok := v[name]; ok {
+				d.checkSpec(item, prop, joinDriftPath(path, name), report)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if i >= driftMaxArrayItems {
+				break
+			}
+			d.checkSpec(item, schema.Items, path+"[]", report)
+		}
+	}
+}
+
+func joinDriftPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func (d *SchemaDriftDetector) resolve(schema *openAPISchema) *openAPISchema {
+	if schema != nil && schema.Ref != "" && d.specRef != nil {
+		return d.specRef.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// Status resume a detecção para /admin/drift
+func (d *SchemaDriftDetector) Status() gin.H {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	endpoints := make([]string, 0, len(d.baselines))
+	for key := range d.baselines {
+		endpoints = append(endpoints, key)
+	}
+	sort.Strings(endpoints)
+	counts := map[string]int64{}
+	for kind, n := range d.counts {
+		counts[kind] = n
+	}
+	events := append([]DriftEvent{}, d.events...)
+	return gin.H{
+		"checked":   d.checked,
+		"skipped":   d.skipped,
+		"drift":     counts,
+		"endpoints": endpoints,
+		"events":    events,
+	}
+}
+
+// Reset apaga os eventos e, com baselines, os formatos aprendidos (que
+// serão reaprendidos nas próximas respostas)
+func (d *SchemaDriftDetector) Reset(baselines bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.events = nil
+	d.specSeen = map[string]bool{}
+	if !baselines {
+		return
+	}
+	for key := range d.baselines {
+		if d.store != nil {
+			d.store.Delete(driftBucket, key)
+		}
+	}
+	d.baselines = map[string]map[string]*driftField{}
+}
+
+func (p *ProxyServer) requireDrift(c *gin.Context) bool {
+	if p.drift == nil {
+		respondError(c, http.StatusNotFound, -1000, "Detecção de drift desativada (SCHEMA_DRIFT)")
+		return false
+	}
+	return true
+}
+
+// SchemaDrift lista as mudanças detectadas no formato das respostas da Binance
+// @Summary Drift de schema das respostas
+// @Description Respostas examinadas, contadores por tipo de mudança (added, removed, type_changed, spec_mismatch), endpoints com formato aprendido e os últimos eventos
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/drift [get]
+func (p *ProxyServer) SchemaDrift(c *gin.Context) {
+	if !p.requireDrift(c) {
+		return
+	}
+	c.JSON(http.StatusOK, p.drift.Status())
+}
+
+// ResetSchemaDrift apaga os eventos; com baselines=true, reaprende os formatos
+// @Summary Reconhecer drift de schema
+// @Description Apaga os eventos registrados. Com baselines=true, apaga também os formatos aprendidos, que passam a ser reaprendidos nas próximas respostas.
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param baselines query bool false "Apagar também os formatos aprendidos"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/drift/reset [post]
+func (p *ProxyServer) ResetSchemaDrift(c *gin.Context) {
+	if !p.requireDrift(c) {
+		return
+	}
+	p.drift.Reset(c.Query("baselines") == "true")
+	c.JSON(http.StatusOK, p.drift.Status())
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultEstimateDepth = 500
+	maxEstimateDepth     = 5000
+	defaultTakerFee      = 0.001
+	defaultMakerFee      = 0.001
+	tradeFeeCacheTTL     = time.Hour
+)
+
+// tradeFee é a taxa de negociação (maker/taker) de um tenant para um símbolo
+type tradeFee struct {
+	Maker     float64
+	Taker     float64
+	fetchedAt time.Time
+}
+
+// tenantTradeFee consulta /sapi/v1/asset/tradeFee do tenant, com cache de 1h
+func (p *ProxyServer) tenantTradeFee(ctx context.Context, tenant *Tenant, symbol string) (tradeFee, error) {
+	tenant.feesMu.Lock()
+	defer tenant.feesMu.Unlock()
+
+	if fee, ok := tenant.fees[symbol]; ok && time.Since(fee.fetchedAt) < tradeFeeCacheTTL {
+		return fee, nil
+	}
+
+	body, err := p.signedRequest(ctx, tenant, http.MethodGet, "/sapi/v1/asset/tradeFee", url.Values{"symbol": {symbol}})
+	if err != nil {
+		return tradeFee{}, err
+	}
+	var fees []struct {
+		Symbol          string `json:"symbol"`
+		MakerCommission string `json:"makerCommission"`
+		TakerCommission string `json:"takerCommission"`
+	}
+	if err := json.Unmarshal(body, &fees); err != nil {
+		return tradeFee{}, err
+	}
+
+	fee := tradeFee{Maker: defaultMakerFee, Taker: defaultTakerFee, fetchedAt: time.Now()}
+	for _, f := range fees {
+		if f.Symbol == symbol {
+			fee.Maker, _ = strconv.ParseFloat(f.MakerCommission, 64)
+			fee.Taker, _ = strconv.ParseFloat(f.TakerCommission, 64)
+		}
+	}
+	if tenant.fees == nil {
+		tenant.fees = make(map[string]tradeFee)
+	}
+	tenant.fees[symbol] = fee
+	return fee, nil
+}
+
+// bookFill é o resultado de consumir níveis do livro
+type bookFill struct {
+	filledQty  float64
+	notional   float64
+	worstPrice float64
+	levels     int
+}
+
+// walkBook consome os níveis do livro até atingir a quantidade (qty) ou o
+// valor em cotação (quoteQty). Com limitPrice > 0, para no primeiro nível
+// além do preço limite.
+func walkBook(levels [][2]float64, qty, quoteQty, limitPrice float64, buy bool) bookFill {
+	var fill bookFill
+	for _, level := range levels {
+		price, available := level[0], level[1]
+		if limitPrice > 0 && ((buy && price > limitPrice) || (!buy && price < limitPrice)) {
+			break
+		}
+
+		take := available
+		if qty > 0 {
+			if remaining := qty - fill.filledQty; remaining < take {
+				take = remaining
+			}
+		} else if remaining := quoteQty - fill.notional; remaining < take*price {
+			take = remaining / price
+		}
+		if take <= 0 {
+			break
+		}
+
+		fill.filledQty += take
+		fill.notional += take * price
+		fill.worstPrice = price
+		fill.levels++
+
+		if (qty > 0 && fill.filledQty >= qty-1e-12) || (qty <= 0 && fill.notional >= quoteQty-1e-12) {
+			break
+		}
+	}
+	return fill
+}
+
+// percentDiff retorna a diferença percentual de value em relação a reference
+func percentDiff(value, reference float64) float64 {
+	if reference == 0 {
+		return 0
+	}
+	return (value - reference) / reference * 100
+}
+
+// OrderEstimate estima preço efetivo, slippage e taxas de uma ordem hipotética
+// @Summary Estimativa de custo de ordem
+// @Description Combina o livro de ofertas, os filtros do símbolo e a taxa do tenant (sapi tradeFee) para estimar o preço médio de execução, slippage e taxas
+// @Tags Account
+// @Produce json
+// @Param symbol query string true "Símbolo (ex: BTCUSDT)"
+// @Param side query string true "BUY ou SELL"
+// @Param quantity query number false "Quantidade no ativo base"
+// @Param quoteOrderQty query number false "Valor na moeda de cotação"
+// @Param price query number false "Preço limite (estima uma ordem LIMIT)"
+// @Success 200 {object} map[string]interface{}
+// @Router /local/order/estimate [get]
+func (p *ProxyServer) OrderEstimate(c *gin.Context) {
+	symbols, err := normalizeSymbols([]string{c.Query("symbol")})
+	if err != nil || len(symbols) == 0 {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetro obrigatório 'symbol' ausente ou inválido")
+		return
+	}
+	symbol := symbols[0]
+
+	side := strings.ToUpper(c.Query("side"))
+	if side != "BUY" && side != "SELL" {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'side' deve ser BUY ou SELL")
+		return
+	}
+	buy := side == "BUY"
+
+	parse := func(name string) (float64, bool) {
+		raw := c.Query(name)
+		if raw == "" {
+			return 0, true
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value < 0 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro '"+name+"' inválido")
+			return 0, false
+		}
+		return value, true
+	}
+	qty, ok := parse("quantity")
+	if !ok {
+		return
+	}
+	quoteQty, ok := parse("quoteOrderQty")
+	if !ok {
+		return
+	}
+	limitPrice, ok := parse("price")
+	if !ok {
+		return
+	}
+	if (qty > 0) == (quoteQty > 0) {
+		respondError(c, http.StatusBadRequest, -1102, "Informe exatamente um entre 'quantity' e 'quoteOrderQty'")
+		return
+	}
+
+	depth := defaultEstimateDepth
+	if raw := c.Query("depth"); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 && value <= maxEstimateDepth {
+			depth = value
+		}
+	}
+
+	ctx := c.Request.Context()
+	info, err := p.market.ExchangeInfo(ctx)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter exchangeInfo: "+err.Error())
+		return
+	}
+	symbolInfo, ok := info.Symbol(symbol)
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1121, "Símbolo inválido: "+symbol)
+		return
+	}
+
+	book, err := p.market.Depth(ctx, symbol, depth)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	// Taxa do tenant quando autenticado; caso contrário, a taxa padrão da Binance
+	fee := tradeFee{Maker: defaultMakerFee, Taker: defaultTakerFee}
+	feeSource := "default"
+	if tenant := p.requestTenant(c.Request); tenant != nil {
+		if tenantFee, err := p.tenantTradeFee(ctx, tenant, symbol); err == nil {
+			fee, feeSource = tenantFee, "tenant"
+		}
+	}
+
+	levels := book.Asks
+	if !buy {
+		levels = book.Bids
+	}
+	if len(book.Asks) == 0 || len(book.Bids) == 0 {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Livro de ofertas vazio para "+symbol)
+		return
+	}
+	bestBid, bestAsk := book.Bids[0][0], book.Asks[0][0]
+	bestPrice := levels[0][0]
+	mid := (bestBid + bestAsk) / 2
+
+	fill := walkBook(levels, qty, quoteQty, limitPrice, buy)
+	orderType := "MARKET"
+	if limitPrice > 0 {
+		orderType = "LIMIT"
+	}
+
+	avgPrice := 0.0
+	if fill.filledQty > 0 {
+		avgPrice = fill.notional / fill.filledQty
+	}
+	feeRate := fee.Taker
+	feeQuote := fill.notional * feeRate
+	total := fill.notional + feeQuote
+	effectivePrice := 0.0
+	if !buy {
+		total = fill.notional - feeQuote
+	}
+	if fill.filledQty > 0 {
+		effectivePrice = total / fill.filledQty
+	}
+
+	unfilledQty, unfilledQuote := 0.0, 0.0
+	if qty > 0 {
+		unfilledQty = qty - fill.filledQty
+		if unfilledQty < 1e-12 {
+			unfilledQty = 0
+		}
+	} else {
+		unfilledQuote = quoteQty - fill.notional
+		if unfilledQuote < 1e-9 {
+			unfilledQuote = 0
+		}
+	}
+
+	filters := symbolInfo.ParsedFilters()
+	// Com quoteOrderQty a Binance calcula a quantidade, então só o nocional é validado
+	var violations []filterViolation
+	if qty > 0 {
+		violations = filters.checkQuantity(qty, orderType == "MARKET")
+	}
+	notionalForCheck := fill.notional
+	if orderType == "LIMIT" && qty > 0 {
+		notionalForCheck = qty * limitPrice
+	}
+	violations = append(violations, filters.checkNotional(notionalForCheck, orderType == "MARKET")...)
+	if orderType == "LIMIT" {
+		violations = append(violations, filters.checkPrice(limitPrice)...)
+	}
+	if violations == nil {
+		violations = []filterViolation{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbol":        symbol,
+		"side":          side,
+		"orderType":     orderType,
+		"baseAsset":     symbolInfo.BaseAsset,
+		"quoteAsset":    symbolInfo.QuoteAsset,
+		"filledQty":     formatFloat(fill.filledQty),
+		"unfilledQty":   formatFloat(unfilledQty),
+		"unfilledQuote": formatFloat(unfilledQuote),
+		"notional":      formatFloat(fill.notional),
+		"avgPrice":      formatFloat(avgPrice),
+		"worstPrice":    formatFloat(fill.worstPrice),
+		"bestPrice":     formatFloat(bestPrice),
+		"midPrice":      formatFloat(mid),
+		"levelsUsed":    fill.levels,
+		"slippage": gin.H{
+			"vsBestPct": formatFloat(percentDiff(avgPrice, bestPrice)),
+			"vsMidPct":  formatFloat(percentDiff(avgPrice, mid)),
+		},
+		"fee": gin.H{
+			"rate":      formatFloat(feeRate),
+			"makerRate": formatFloat(fee.Maker),
+			"source":    feeSource,
+			"quote":     formatFloat(feeQuote),
+		},
+		"effectivePrice":        formatFloat(effectivePrice),
+		"total":                 formatFloat(total),
+		"insufficientLiquidity": unfilledQty > 0 || unfilledQuote > 0,
+		"filterViolations":      violations,
+		"bookLastUpdateId":      book.LastUpdateID,
+	})
+}
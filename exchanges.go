@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExchangeCredentials são as credenciais de um tenant em uma corretora
+type ExchangeCredentials struct {
+	APIKey     string `yaml:"api_key"`
+	SecretKey  string `yaml:"secret_key"`
+	Passphrase string `yaml:"passphrase"`
+}
+
+// ExchangeBackend adapta o proxy genérico a uma corretora: URL base,
+// assinatura das requisições privadas e formato dos símbolos
+type ExchangeBackend interface {
+	// Name é o prefixo das rotas (ex: /bybit/...)
+	Name() string
+	BaseURL() string
+	// VenueSymbol converte um símbolo no formato unificado (BTCUSDT) para o da corretora
+	VenueSymbol(symbol string) string
+	// MapPath converte símbolos embutidos no path, quando a corretora os usa
+	MapPath(path string) string
+	// Sign autentica a requisição com as credenciais do tenant. body é o
+	// corpo já lido (a requisição recebe uma cópia).
+	Sign(req *http.Request, body []byte, creds ExchangeCredentials) error
+}
+
+// exchangeSymbolParams são os parâmetros de query que carregam símbolos
+var exchangeSymbolParams = []string{"symbol", "product_id"}
+
+// knownQuoteAssets são usados para separar base e cotação de um símbolo
+// unificado (BTCUSDT -> BTC/USDT); os mais longos vêm primeiro
+var knownQuoteAssets = []string{"FDUSD", "USDT", "USDC", "TUSD", "BUSD", "USD", "EUR", "GBP", "BRL", "TRY", "BTC", "ETH", "BNB", "DAI"}
+
+func splitSymbol(symbol string) (string, string, bool) {
+	for _, quote := range knownQuoteAssets {
+		if strings.HasSuffix(symbol, quote) && len(symbol) > len(quote) {
+			return strings.TrimSuffix(symbol, quote), quote, true
+		}
+	}
+	return "", "", false
+}
+
+// binanceBackend atende a Binance e a Binance.US, que usam a mesma API
+type binanceBackend struct {
+	name    string
+	baseURL string
+}
+
+func (b *binanceBackend) Name() string                     { return b.name }
+func (b *binanceBackend) BaseURL() string                  { return b.baseURL }
+func (b *binanceBackend) VenueSymbol(symbol string) string { return symbol }
+func (b *binanceBackend) MapPath(path string) string       { return path }
+
+// Sign adiciona timestamp e signature (HMAC-SHA256 da query + corpo)
+func (b *binanceBackend) Sign(req *http.Request, body []byte, creds ExchangeCredentials) error {
+	query := req.URL.Query()
+	query.Del("signature")
+	if query.Get("timestamp") == "" {
+		query.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	}
+	if query.Get("recvWindow") == "" {
+		query.Set("recvWindow", strconv.Itoa(defaultRecvWindow))
+	}
+	payload := query.Encode()
+	mac := hmac.New(sha256.New, []byte(creds.SecretKey))
+	mac.Write([]byte(payload))
+	mac.Write(body)
+	req.URL.RawQuery = payload + "&signature=" + hex.EncodeToString(mac.Sum(nil))
+	req.Header.Set("X-MBX-APIKEY", creds.APIKey)
+	return nil
+}
+
+// bybitBackend atende a API v5 da Bybit
+type bybitBackend struct {
+	baseURL string
+}
+
+func (b *bybitBackend) Name() string                     { return "bybit" }
+func (b *bybitBackend) BaseURL() string                  { return b.baseURL }
+func (b *bybitBackend) VenueSymbol(symbol string) string { return symbol }
+func (b *bybitBackend) MapPath(path string) string       { return path }
+
+// Sign assina timestamp + apiKey + recvWindow + (query ou corpo)
+func (b *bybitBackend) Sign(req *http.Request, body []byte, creds ExchangeCredentials) error {
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	recvWindow := strconv.Itoa(defaultRecvWindow)
+	payload := req.URL.RawQuery
+	if req.Method != http.MethodGet {
+		payload = string(body)
+	}
+	mac := hmac.New(sha256.New, []byte(creds.SecretKey))
+	mac.Write([]byte(timestamp + creds.APIKey + recvWindow + payload))
+	req.Header.Set("X-BAPI-API-KEY", creds.APIKey)
+	req.Header.Set("X-BAPI-TIMESTAMP", timestamp)
+	req.Header.Set("X-BAPI-RECV-WINDOW", recvWindow)
+	req.Header.Set("X-BAPI-SIGN", hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// coinbaseBackend atende a Coinbase Exchange, que usa símbolos BASE-QUOTE
+type coinbaseBackend struct {
+	baseURL string
+}
+
+func (b *coinbaseBackend) Name() string    { return "coinbase" }
+func (b *coinbaseBackend) BaseURL() string { return b.baseURL }
+
+func (b *coinbaseBackend) VenueSymbol(symbol string) string {
+	if strings.Contains(symbol, "-") {
+		return symbol
+	}
+	if base, quote, ok := splitSymbol(strings.ToUpper(symbol)); ok {
+		return base + "-" + quote
+	}
+	return symbol
+}
+
+// MapPath converte o produto em /products/<symbol>/...
+func (b *coinbaseBackend) MapPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "products" && parts[i+1] != "" {
+			parts[i+1] = b.VenueSymbol(parts[i+1])
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Sign assina timestamp + método + path (com query) + corpo com a chave
+// secreta decodificada de base64
+func (b *coinbaseBackend) Sign(req *http.Request, body []byte, creds ExchangeCredentials) error {
+	secret, err := base64.StdEncoding.DecodeString(creds.SecretKey)
+	if err != nil {
+		return fmt.Errorf("secret_key da Coinbase deve estar em base64: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	requestPath := req.URL.EscapedPath()
+	if req.URL.RawQuery != "" {
+		requestPath += "?" + req.URL.RawQuery
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + req.Method + requestPath))
+	mac.Write(body)
+	req.Header.Set("CB-ACCESS-KEY", creds.APIKey)
+	req.Header.Set("CB-ACCESS-SIGN", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("CB-ACCESS-TIMESTAMP", timestamp)
+	req.Header.Set("CB-ACCESS-PASSPHRASE", creds.Passphrase)
+	return nil
+}
+
+// defaultExchangeBackends retorna as corretoras suportadas. A URL base de
+// cada uma pode ser trocada com EXCHANGE_<NOME>_URL (ex: EXCHANGE_BYBIT_URL).
+func defaultExchangeBackends() []ExchangeBackend {
+	baseURL := func(name, fallback string) string {
+		return getEnv("EXCHANGE_"+strings.ToUpper(name)+"_URL", fallback)
+	}
+	return []ExchangeBackend{
+		&binanceBackend{name: "binance", baseURL: baseURL("binance", "https://api.binance.com")},
+		&binanceBackend{name: "binanceus", baseURL: baseURL("binanceus", "https://api.binance.us")},
+		&binanceBackend{name: "futures", baseURL: baseURL("futures", "https://fapi.binance.com")},
+		&bybitBackend{baseURL: baseURL("bybit", "https://api.bybit.com")},
+		&coinbaseBackend{baseURL: baseURL("coinbase", "https://api.exchange.coinbase.com")},
+	}
+}
+
+// enabledExchangeBackends filtra as corretoras pela lista EXCHANGES
+// (separada por vírgula); vazia habilita todas
+func enabledExchangeBackends() []ExchangeBackend {
+	all := defaultExchangeBackends()
+	list := os.Getenv("EXCHANGES")
+	if list == "" {
+		return all
+	}
+	enabled := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		enabled[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	var backends []ExchangeBackend
+	for _, b := range all {
+		if enabled[b.Name()] {
+			backends = append(backends, b)
+		}
+	}
+	return backends
+}
+
+// exchangeCredentials retorna as credenciais do tenant para a corretora. Na
+// Binance (spot e futuros), as chaves principais do tenant são usadas por padrão.
+func (t *Tenant) exchangeCredentials(exchange string) (ExchangeCredentials, bool) {
+	if creds, ok := t.Exchanges[exchange]; ok && creds.APIKey != "" {
+		return creds, true
+	}
+	if exchange == "binance" || exchange == "futures" {
+		return ExchangeCredentials{APIKey: t.APIKey, SecretKey: t.SecretKey}, true
+	}
+	return ExchangeCredentials{}, false
+}
+
+// exchangeRequestSymbols lista os símbolos de uma chamada às corretoras no
+// formato enviado pelo cliente: symbol, symbols e product_id na query ou no
+// corpo form, e symbol e symbols num corpo JSON (ordens da Bybit)
+func exchangeRequestSymbols(r *http.Request, body []byte) []string {
+	params := bodyParams(r, body)
+	symbols := append(querySymbols(params), params["product_id"]...)
+	var fields map[string]json.RawMessage
+	if len(body) > 0 && json.Unmarshal(body, &fields) == nil {
+		symbols = append(symbols, wsAPISymbols(fields)...)
+	}
+	return symbols
+}
+
+// ExchangeProxy repassa /<corretora>/<path> para a corretora, convertendo
+// símbolos e assinando a requisição quando o cliente envia token de tenant
+func (p *ProxyServer) ExchangeProxy(backend ExchangeBackend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := backend.MapPath(c.Param("path"))
+		query := c.Request.URL.Query()
+		for _, key := range exchangeSymbolParams {
+			if value := query.Get(key); value != "" {
+				query.Set(key, backend.VenueSymbol(strings.ToUpper(value)))
+			}
+		}
+		if backend.Name() == "futures" && c.Request.Method == http.MethodGet && futuresSentimentPaths[path] {
+			p.serveSentimentData(c, backend, path, query)
+			return
+		}
+
+		body, err := readBody(c)
+		if err != nil {
+			respondBodyError(c, err)
+			return
+		}
+		target := backend.BaseURL() + path
+		if encoded := encodeQuery(c.Request.URL.RawQuery, query); encoded != "" {
+			target += "?" + encoded
+		}
+		method := c.Request.Method
+		if isHeadRequest(c.Request.Context()) {
+			method = http.MethodHead
+		}
+		req, err := http.NewRequestWithContext(c.Request.Context(), method, target, bytes.NewReader(body))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, -1000, fmt.Sprintf("Erro ao criar requisição: %v", err))
+			return
+		}
+		for _, key := range []string{"Content-Type", "Accept"} {
+			if value := c.Request.Header.Get(key); value != "" {
+				req.Header.Set(key, value)
+			}
+		}
+		req.Header.Set("User-Agent", "Binance-Proxy/1.0")
+
+		// Com token de tenant a requisição é assinada pelo proxy; sem token,
+		// os headers de autenticação do cliente são repassados
+		if tenant := p.requestTenant(c.Request); tenant != nil {
+			creds, ok := tenant.exchangeCredentials(backend.Name())
+			if !ok {
+				respondError(c, http.StatusForbidden, -2015, "Tenant sem credenciais para "+backend.Name())
+				return
+			}
+			// A política do tenant vale aqui como na raiz: sobre o path na
+			// corretora (/api/v3/order, /fapi/v1/order) e os símbolos pedidos
+			if err := tenant.Policy.Allow(c.Request.Method, upstreamPath(backend.BaseURL(), path), exchangeRequestSymbols(c.Request, body)); err != nil {
+				// log.Printf("[WARN] Chamada de %s recusada pela política: %v", tenant.Name, err)
+				respondUpstreamError(c, policyError(err))
+				return
+			}
+			if err := backend.Sign(req, body, creds); err != nil {
+				respondError(c, http.StatusInternalServerError, -1000, err.Error())
+				return
+			}
+		} else {
+			for key, values := range c.Request.Header {
+				upper := strings.ToUpper(key)
+				if upper == "AUTHORIZATION" || upper == "X-MBX-APIKEY" || strings.HasPrefix(upper, "X-BAPI-") || strings.HasPrefix(upper, "CB-ACCESS-") {
+					req.Header[key] = values
+				}
+			}
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			respondError(c, http.StatusBadGateway, -1000, fmt.Sprintf("Erro ao conectar com %s: %v", backend.Name(), err))
+			return
+		}
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			respondError(c, http.StatusBadGateway, -1001, fmt.Sprintf("Erro ao ler resposta de %s: %v", backend.Name(), err))
+			return
+		}
+
+		// Headers de limite de uso das corretoras seguem para o cliente
+		for key, values := range resp.Header {
+			upper := strings.ToUpper(key)
+			if strings.HasPrefix(upper, "X-MBX-") || strings.HasPrefix(upper, "X-BAPI-") || strings.HasPrefix(upper, "CB-") || upper == "RETRY-AFTER" {
+				c.Writer.Header()[key] = values
+			}
+		}
+		contentType := resp.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		c.Header("X-Proxy-Exchange", backend.Name())
+		c.Data(resp.StatusCode, contentType, respBody)
+	}
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	exportsBucket       = "exports"
+	defaultExportPeriod = "@hourly"
+	maxExportHistory    = 100
+)
+
+// Fontes de dados exportáveis
+const (
+	exportSourceSnapshots = "snapshots"
+	exportSourceAudit     = "audit"
+)
+
+// ExportConfig é um destino de EXPORT_FILE: um bucket S3 (ou compatível) ou GCS
+type ExportConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// s3 (padrão) ou gcs; o GCS usa a API XML com chaves HMAC
+	Provider  string `yaml:"provider" json:"provider"`
+	Endpoint  string `yaml:"endpoint" json:"endpoint"`
+	Region    string `yaml:"region" json:"region"`
+	Bucket    string `yaml:"bucket" json:"bucket"`
+	AccessKey string `yaml:"access_key" json:"-"`
+	SecretKey string `yaml:"secret_key" json:"-"`
+	PathStyle bool   `yaml:"path_style" json:"pathStyle"`
+	Prefix    string `yaml:"prefix" json:"prefix"`
+	// snapshots (jobs agendados) e/ou audit (trilha das ordens condicionais)
+	Sources  []string `yaml:"sources" json:"sources"`
+	Schedule string   `yaml:"schedule" json:"schedule"`
+	// Objetos do prefixo mais antigos que isso são apagados do bucket (ex: 720h)
+	Retention string `yaml:"retention" json:"retention,omitempty"`
+	// Remove os snapshots locais depois de enviados
+	DeleteLocal bool `yaml:"delete_local" json:"deleteLocal"`
+}
+
+type exportsFile struct {
+	Exports []ExportConfig `yaml:"exports"`
+}
+
+// ExportRun é uma execução de exportação
+type ExportRun struct {
+	StartedAt  int64  `json:"startedAt"`
+	DurationMs int64  `json:"durationMs"`
+	Trigger    string `json:"trigger"`
+	Status     string `json:"status"`
+	Uploaded   int    `json:"uploaded"`
+	Bytes      int    `json:"bytes"`
+	Expired    int    `json:"expired"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Export é um destino carregado, com cliente, agendamento e histórico
+type Export struct {
+	config    ExportConfig
+	client    *S3Client
+	schedule  *cronSchedule
+	retention time.Duration
+
+	mu      sync.Mutex
+	running bool
+	nextRun time.Time
+	history []ExportRun
+	// Chaves já enviadas quando não há armazenamento local para guardar o estado
+	sent map[string]bool
+}
+
+// Exporter envia snapshots e trilhas de auditoria para buckets externos
+type Exporter struct {
+	proxy   *ProxyServer
+	exports []*Export
+	byName  map[string]*Export
+	cancel  context.CancelFunc
+}
+
+// LoadExports lê e valida EXPORT_FILE
+func LoadExports(path string, proxy *ProxyServer) (*Exporter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file exportsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+
+	e := &Exporter{proxy: proxy, byName: map[string]*Export{}}
+	for _, config := range file.Exports {
+		if err := proxy.secrets.openFields(&config.AccessKey, &config.SecretKey); err != nil {
+			return nil, fmt.Errorf("export %s: %w", config.Name, err)
+		}
+		if config.Name == "" || config.Bucket == "" || config.AccessKey == "" || config.SecretKey == "" {
+			return nil, fmt.Errorf("export incompleto em %s: name, bucket, access_key e secret_key são obrigatórios", path)
+		}
+		if _, exists := e.byName[config.Name]; exists {
+			return nil, fmt.Errorf("export duplicado: %s", config.Name)
+		}
+		switch config.Provider {
+		case "", "s3":
+			config.Provider = "s3"
+			if config.Region == "" {
+				config.Region = "us-east-1"
+			}
+			if config.Endpoint == "" {
+				config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+			}
+		case "gcs":
+			if config.Region == "" {
+				config.Region = "auto"
+			}
+			if config.Endpoint == "" {
+				config.Endpoint = "https://storage.googleapis.com"
+			}
+		default:
+			return nil, fmt.Errorf("export %s: provider deve ser s3 ou gcs", config.Name)
+		}
+		if len(config.Sources) == 0 {
+			config.Sources = []string{exportSourceSnapshots, exportSourceAudit}
+		}
+		for _, source := range config.Sources {
+			if source != exportSourceSnapshots && source != exportSourceAudit {
+				return nil, fmt.Errorf("export %s: fonte desconhecida %q (use snapshots ou audit)", config.Name, source)
+			}
+		}
+		if config.Prefix != "" && !strings.HasSuffix(config.Prefix, "/") {
+			config.Prefix += "/"
+		}
+		if config.Schedule == "" {
+			config.Schedule = defaultExportPeriod
+		}
+		schedule, err := parseCron(config.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", config.Name, err)
+		}
+		var retention time.Duration
+		if config.Retention != "" {
+			if retention, err = time.ParseDuration(config.Retention); err != nil || retention <= 0 {
+				return nil, fmt.Errorf("export %s: retention inválida %q", config.Name, config.Retention)
+			}
+		}
+		client, err := NewS3Client(config.Endpoint, config.Region, config.Bucket, config.AccessKey, config.SecretKey, config.PathStyle)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", config.Name, err)
+		}
+		export := &Export{config: config, client: client, schedule: schedule, retention: retention, sent: map[string]bool{}}
+		e.exports = append(e.exports, export)
+		e.byName[config.Name] = export
+	}
+	return e, nil
+}
+
+// Start agenda todas as exportações
+func (e *Exporter) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	for _, export := range e.exports {
+		go e.loop(ctx, export)
+	}
+}
+
+func (e *Exporter) Close() {
+	if e.cancel != nil {
+		e.cancel()
+	}
+}
+
+func (e *Exporter) loop(ctx context.Context, export *Export) {
+	for {
+		next := export.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		export.mu.Lock()
+		export.nextRun = next
+		export.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		e.Run(ctx, export, "schedule")
+	}
+}
+
+// Run envia o que ainda não foi exportado e aplica a retenção no bucket
+func (e *Exporter) Run(ctx context.Context, export *Export, trigger string) ExportRun {
+	export.mu.Lock()
+	if export.running {
+		export.mu.Unlock()
+		return ExportRun{StartedAt: time.Now().UnixMilli(), Trigger: trigger, Status: "skipped", Error: "execução anterior ainda em andamento"}
+	}
+	export.running = true
+	export.mu.Unlock()
+
+	started := time.Now()
+	run := ExportRun{StartedAt: started.UnixMilli(), Trigger: trigger, Status: "ok"}
+	var err error
+	for _, source := range export.config.Sources {
+		switch source {
+		case exportSourceSnapshots:
+			err = e.exportSnapshots(ctx, export, &run)
+		case exportSourceAudit:
+			err = e.exportAudit(ctx, export, &run)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil && export.retention > 0 {
+		err = e.expire(ctx, export, &run)
+	}
+	run.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+		// log.Printf("[WARN] Exportação %s falhou: %v", export.config.Name, err)
+	}
+
+	export.mu.Lock()
+	defer export.mu.Unlock()
+	export.running = false
+	export.history = append(export.history, run)
+	if len(export.history) > maxExportHistory {
+		export.history = export.history[len(export.history)-maxExportHistory:]
+	}
+	return run
+}
+
+// wasSent e markSent guardam as chaves já enviadas no armazenamento local
+// (ou em memória, sem ele), para não reenviar após reinícios
+func (e *Exporter) wasSent(export *Export, key string) bool {
+	if e.proxy.store != nil {
+		var sentAt int64
+		found, _ := e.proxy.store.Get(exportsBucket, export.config.Name+"|"+key, &sentAt)
+		return found
+	}
+	export.mu.Lock()
+	defer export.mu.Unlock()
+	return export.sent[key]
+}
+
+func (e *Exporter) markSent(export *Export, key string) {
+	if e.proxy.store != nil {
+		e.proxy.store.Put(exportsBucket, export.config.Name+"|"+key, time.Now().UnixMilli())
+		return
+	}
+	export.mu.Lock()
+	export.sent[key] = true
+	export.mu.Unlock()
+}
+
+// snapshotDirs retorna os diretórios dos jobs que gravam snapshots em arquivo
+func (e *Exporter) snapshotDirs() map[string]string {
+	dirs := map[string]string{}
+	if e.proxy.jobs == nil {
+		return dirs
+	}
+	for _, job := range e.proxy.jobs.jobs {
+		if job.config.Output == "file" {
+			dirs[job.config.Name] = filepath.Join(job.config.Dir, job.config.Name)
+		}
+	}
+	return dirs
+}
+
+// exportSnapshots envia cada snapshot como <prefix>snapshots/<job>/<timestamp>.json
+func (e *Exporter) exportSnapshots(ctx context.Context, export *Export, run *ExportRun) error {
+	upload := func(name string, body []byte) error {
+		key := export.config.Prefix + exportSourceSnapshots + "/" + name
+		if err := export.client.Put(ctx, key, body, "application/json"); err != nil {
+			return err
+		}
+		e.markSent(export, exportSourceSnapshots+"/"+name)
+		run.Uploaded++
+		run.Bytes += len(body)
+		return nil
+	}
+
+	for job, dir := range e.snapshotDirs() {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			name := job + "/" + filepath.Base(file)
+			if e.wasSent(export, exportSourceSnapshots+"/"+name) {
+				continue
+			}
+			body, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if err := upload(name, body); err != nil {
+				return err
+			}
+			if export.config.DeleteLocal {
+				os.Remove(file)
+			}
+		}
+	}
+
+	if e.proxy.store == nil {
+		return nil
+	}
+	type pending struct {
+		key  string
+		body []byte
+	}
+	var items []pending
+	err := e.proxy.store.ForEach(snapshotsBucket, func(key string, data []byte) error {
+		items = append(items, pending{key, append([]byte(nil), data...)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if e.wasSent(export, exportSourceSnapshots+"/"+item.key+".json") {
+			continue
+		}
+		if err := upload(item.key+".json", item.body); err != nil {
+			return err
+		}
+		if export.config.DeleteLocal {
+			e.proxy.store.Delete(snapshotsBucket, item.key)
+		}
+	}
+	return nil
+}
+
+// exportAudit envia os eventos novos da trilha de auditoria das ordens
+// condicionais em um arquivo NDJSON por execução
+func (e *Exporter) exportAudit(ctx context.Context, export *Export, run *ExportRun) error {
+	if e.proxy.store == nil {
+		return nil
+	}
+	cursorKey := export.config.Name + "|audit-cursor"
+	var cursor string
+	e.proxy.store.Get(exportsBucket, cursorKey, &cursor)
+
+	var buf bytes.Buffer
+	last := cursor
+	err := e.proxy.store.ForEach(conditionalAuditBucket, func(key string, data []byte) error {
+		if key <= cursor {
+			return nil
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+		last = key
+		return nil
+	})
+	if err != nil || buf.Len() == 0 {
+		return err
+	}
+	key := export.config.Prefix + exportSourceAudit + "/" + time.Now().UTC().Format("20060102T150405Z") + ".ndjson"
+	if err := export.client.Put(ctx, key, buf.Bytes(), "application/x-ndjson"); err != nil {
+		return err
+	}
+	run.Uploaded++
+	run.Bytes += buf.Len()
+	return e.proxy.store.Put(exportsBucket, cursorKey, last)
+}
+
+// expire apaga do bucket os objetos do prefixo mais antigos que a retenção
+func (e *Exporter) expire(ctx context.Context, export *Export, run *ExportRun) error {
+	objects, err := export.client.List(ctx, export.config.Prefix)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-export.retention)
+	for _, object := range objects {
+		if object.LastModified.Before(cutoff) {
+			if err := export.client.Delete(ctx, object.Key); err != nil {
+				return err
+			}
+			run.Expired++
+		}
+	}
+	return nil
+}
+
+// ExportStatus é a visão de um destino em /admin/exports
+type ExportStatus struct {
+	ExportConfig
+	NextRun int64      `json:"nextRun"`
+	Running bool       `json:"running"`
+	LastRun *ExportRun `json:"lastRun,omitempty"`
+}
+
+func (export *Export) status() ExportStatus {
+	export.mu.Lock()
+	defer export.mu.Unlock()
+	status := ExportStatus{ExportConfig: export.config, NextRun: export.nextRun.UnixMilli(), Running: export.running}
+	if len(export.history) > 0 {
+		last := export.history[len(export.history)-1]
+		status.LastRun = &last
+	}
+	return status
+}
+
+// requireExports responde 503 quando não há exportações configuradas
+func (p *ProxyServer) requireExports(c *gin.Context) bool {
+	if p.exporter == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Exportação desabilitada (EXPORT_FILE)")
+		return false
+	}
+	return true
+}
+
+// ListExports lista os destinos de exportação
+// @Summary Listar exportações
+// @Description Lista os destinos S3/GCS com fontes, agendamento, próxima e última execução
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/exports [get]
+func (p *ProxyServer) ListExports(c *gin.Context) {
+	if !p.requireExports(c) {
+		return
+	}
+	exports := make([]ExportStatus, 0, len(p.exporter.exports))
+	for _, export := range p.exporter.exports {
+		exports = append(exports, export.status())
+	}
+	c.JSON(http.StatusOK, gin.H{"exports": exports})
+}
+
+// RunExport executa uma exportação imediatamente
+// @Summary Executar exportação
+// @Description Envia agora o que ainda não foi exportado e aplica a retenção
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param name path string true "Nome do destino"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/exports/{name}/run [post]
+func (p *ProxyServer) RunExport(c *gin.Context) {
+	if !p.requireExports(c) {
+		return
+	}
+	export, ok := p.exporter.byName[c.Param("name")]
+	if !ok {
+		respondError(c, http.StatusNotFound, -1000, "Destino de exportação não encontrado")
+		return
+	}
+	c.JSON(http.StatusOK, p.exporter.Run(c.Request.Context(), export, "manual"))
+}
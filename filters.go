@@ -0,0 +1,167 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+// symbolFilters reúne os filtros de negociação de um símbolo já convertidos
+type symbolFilters struct {
+	TickSize       float64
+	MinPrice       float64
+	MaxPrice       float64
+	StepSize       float64
+	MinQty         float64
+	MaxQty         float64
+	MarketStepSize float64
+	MarketMinQty   float64
+	MarketMaxQty   float64
+	MinNotional    float64
+	MaxNotional    float64
+	// ApplyMinToMarket indica se minNotional também vale para ordens a mercado
+	ApplyMinToMarket bool
+}
+
+// filterNumber lê um campo numérico (string na Binance) de um filtro
+func filterNumber(filter map[string]interface{}, key string) float64 {
+	switch v := filter[key].(type) {
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// ParsedFilters converte os filtros do símbolo para symbolFilters
+func (s *SymbolInfo) ParsedFilters() symbolFilters {
+	f := symbolFilters{ApplyMinToMarket: true}
+	for _, filter := range s.Filters {
+		switch filter["filterType"] {
+		case "PRICE_FILTER":
+			f.TickSize = filterNumber(filter, "tickSize")
+			f.MinPrice = filterNumber(filter, "minPrice")
+			f.MaxPrice = filterNumber(filter, "maxPrice")
+		case "LOT_SIZE":
+			f.StepSize = filterNumber(filter, "stepSize")
+			f.MinQty = filterNumber(filter, "minQty")
+			f.MaxQty = filterNumber(filter, "maxQty")
+		case "MARKET_LOT_SIZE":
+			f.MarketStepSize = filterNumber(filter, "stepSize")
+			f.MarketMinQty = filterNumber(filter, "minQty")
+			f.MarketMaxQty = filterNumber(filter, "maxQty")
+		case "MIN_NOTIONAL":
+			f.MinNotional = filterNumber(filter, "minNotional")
+			if apply, ok := filter["applyToMarket"].(bool); ok {
+				f.ApplyMinToMarket = apply
+			}
+		case "NOTIONAL":
+			f.MinNotional = filterNumber(filter, "minNotional")
+			f.MaxNotional = filterNumber(filter, "maxNotional")
+			if apply, ok := filter["applyMinToMarket"].(bool); ok {
+				f.ApplyMinToMarket = apply
+			}
+		}
+	}
+	return f
+}
+
+// roundDown arredonda value para baixo no múltiplo de step mais próximo
+func roundDown(value, step float64) float64 {
+	if step <= 0 {
+		return value
+	}
+	return math.Floor(value/step+1e-9) * step
+}
+
+// stepDecimals retorna a quantidade de casas decimais de um step (ex: 0.001 -> 3)
+func stepDecimals(step float64) int {
+	if step <= 0 {
+		return 8
+	}
+	decimals := 0
+	for step < 1-1e-12 && decimals < 16 {
+		step *= 10
+		decimals++
+	}
+	return decimals
+}
+
+// roundToStep arredonda value no múltiplo de step conforme o modo: "down"
+// (padrão, como a Binance trunca), "up" ou "nearest"
+func roundToStep(value, step float64, mode string) float64 {
+	if step <= 0 {
+		return value
+	}
+	switch mode {
+	case "up":
+		return math.Ceil(value/step-1e-9) * step
+	case "nearest":
+		return math.Round(value/step) * step
+	}
+	return roundDown(value, step)
+}
+
+// formatStep formata value com as casas decimais de step (ex: 0.01 -> "123.45")
+func formatStep(value, step float64) string {
+	if step <= 0 {
+		return formatFloat(value)
+	}
+	return strconv.FormatFloat(value, 'f', stepDecimals(step), 64)
+}
+
+// filterViolation descreve um filtro da Binance que a ordem violaria
+type filterViolation struct {
+	Filter  string `json:"filter"`
+	Message string `json:"message"`
+}
+
+// checkQuantity valida a quantidade contra LOT_SIZE (ou MARKET_LOT_SIZE, para ordens a mercado)
+func (f symbolFilters) checkQuantity(qty float64, market bool) []filterViolation {
+	var violations []filterViolation
+	minQty, maxQty, step, name := f.MinQty, f.MaxQty, f.StepSize, "LOT_SIZE"
+	if market && (f.MarketMinQty > 0 || f.MarketMaxQty > 0) {
+		minQty, maxQty, name = f.MarketMinQty, f.MarketMaxQty, "MARKET_LOT_SIZE"
+		if f.MarketStepSize > 0 {
+			step = f.MarketStepSize
+		}
+	}
+	if minQty > 0 && qty < minQty {
+		violations = append(violations, filterViolation{name, "quantidade abaixo de minQty " + formatFloat(minQty)})
+	}
+	if maxQty > 0 && qty > maxQty {
+		violations = append(violations, filterViolation{name, "quantidade acima de maxQty " + formatFloat(maxQty)})
+	}
+	if step > 0 && math.Abs(roundDown(qty, step)-qty) > step*1e-6 {
+		violations = append(violations, filterViolation{name, "quantidade não é múltiplo de stepSize " + formatFloat(step)})
+	}
+	return violations
+}
+
+// checkPrice valida o preço de uma ordem limitada contra PRICE_FILTER
+func (f symbolFilters) checkPrice(price float64) []filterViolation {
+	var violations []filterViolation
+	if f.MinPrice > 0 && price < f.MinPrice {
+		violations = append(violations, filterViolation{"PRICE_FILTER", "preço abaixo de minPrice " + formatFloat(f.MinPrice)})
+	}
+	if f.MaxPrice > 0 && price > f.MaxPrice {
+		violations = append(violations, filterViolation{"PRICE_FILTER", "preço acima de maxPrice " + formatFloat(f.MaxPrice)})
+	}
+	if f.TickSize > 0 && math.Abs(roundDown(price, f.TickSize)-price) > f.TickSize*1e-6 {
+		violations = append(violations, filterViolation{"PRICE_FILTER", "preço não é múltiplo de tickSize " + formatFloat(f.TickSize)})
+	}
+	return violations
+}
+
+// checkNotional valida o valor nocional (preço * quantidade) contra NOTIONAL/MIN_NOTIONAL
+func (f symbolFilters) checkNotional(notional float64, market bool) []filterViolation {
+	var violations []filterViolation
+	if f.MinNotional > 0 && notional < f.MinNotional && (!market || f.ApplyMinToMarket) {
+		violations = append(violations, filterViolation{"NOTIONAL", "valor nocional abaixo de minNotional " + formatFloat(f.MinNotional)})
+	}
+	if f.MaxNotional > 0 && notional > f.MaxNotional {
+		violations = append(violations, filterViolation{"NOTIONAL", "valor nocional acima de maxNotional " + formatFloat(f.MaxNotional)})
+	}
+	return violations
+}
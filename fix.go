@@ -0,0 +1,749 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fixBeginString       = "FIX.4.4"
+	fixDefaultCompID     = "BINANCEPROXY"
+	fixDefaultHeartBtInt = 30
+	fixLogonTimeout      = 10 * time.Second
+	fixRequestTimeout    = 15 * time.Second
+	fixMaxBodyLength     = 64 * 1024
+	fixSOH               = '\x01'
+)
+
+// Tags FIX usadas pelo gateway
+const (
+	fixTagAvgPx                = 6
+	fixTagClOrdID              = 11
+	fixTagCumQty               = 14
+	fixTagExecID               = 17
+	fixTagLastPx               = 31
+	fixTagLastQty              = 32
+	fixTagMsgSeqNum            = 34
+	fixTagMsgType              = 35
+	fixTagOrderID              = 37
+	fixTagOrderQty             = 38
+	fixTagOrdStatus            = 39
+	fixTagOrdType              = 40
+	fixTagOrigClOrdID          = 41
+	fixTagPrice                = 44
+	fixTagRefSeqNum            = 45
+	fixTagSenderCompID         = 49
+	fixTagSendingTime          = 52
+	fixTagSide                 = 54
+	fixTagSymbol               = 55
+	fixTagTargetCompID         = 56
+	fixTagText                 = 58
+	fixTagTimeInForce          = 59
+	fixTagTransactTime         = 60
+	fixTagEncryptMethod        = 98
+	fixTagStopPx               = 99
+	fixTagCxlRejReason         = 102
+	fixTagOrdRejReason         = 103
+	fixTagHeartBtInt           = 108
+	fixTagTestReqID            = 112
+	fixTagResetSeqNumFlag      = 141
+	fixTagExecType             = 150
+	fixTagLeavesQty            = 151
+	fixTagCashOrderQty         = 152
+	fixTagRefMsgType           = 372
+	fixTagBusinessRejectReason = 380
+	fixTagCxlRejResponseTo     = 434
+	fixTagUsername             = 553
+	fixTagPassword             = 554
+)
+
+// Tipos de mensagem FIX suportados
+const (
+	fixMsgHeartbeat             = "0"
+	fixMsgTestRequest           = "1"
+	fixMsgReject                = "3"
+	fixMsgLogout                = "5"
+	fixMsgExecutionReport       = "8"
+	fixMsgOrderCancelReject     = "9"
+	fixMsgLogon                 = "A"
+	fixMsgNewOrderSingle        = "D"
+	fixMsgOrderCancelRequest    = "F"
+	fixMsgBusinessMessageReject = "j"
+)
+
+type fixField struct {
+	Tag   int
+	Value string
+}
+
+// fixMessage é uma mensagem FIX com os campos na ordem de chegada/envio
+type fixMessage []fixField
+
+func (m fixMessage) get(tag int) string {
+	for _, f := range m {
+		if f.Tag == tag {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+func (m fixMessage) has(tag int) bool {
+	for _, f := range m {
+		if f.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *fixMessage) set(tag int, value string) {
+	if tag == fixTagText {
+		value = redactSecrets(value)
+	}
+	*m = append(*m, fixField{tag, value})
+}
+
+func fixChecksum(data []byte) string {
+	sum := 0
+	for _, b := range data {
+		sum += int(b)
+	}
+	return fmt.Sprintf("%03d", sum%256)
+}
+
+// readFIXMessage lê uma mensagem completa (BeginString até CheckSum),
+// validando BodyLength e CheckSum
+func readFIXMessage(r *bufio.Reader) (fixMessage, error) {
+	begin, err := r.ReadString(fixSOH)
+	if err != nil {
+		return nil, err
+	}
+	if begin != "8="+fixBeginString+string(fixSOH) {
+		return nil, fmt.Errorf("BeginString inválido: %q", strings.TrimSuffix(begin, string(fixSOH)))
+	}
+	lengthField, err := r.ReadString(fixSOH)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(lengthField, "9=") {
+		return nil, errors.New("BodyLength ausente")
+	}
+	length, err := strconv.Atoi(strings.TrimSuffix(lengthField[2:], string(fixSOH)))
+	if err != nil || length <= 0 || length > fixMaxBodyLength {
+		return nil, errors.New("BodyLength inválido")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	checksumField, err := r.ReadString(fixSOH)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(checksumField, "10=") {
+		return nil, errors.New("CheckSum ausente")
+	}
+	if expected := fixChecksum([]byte(begin + lengthField + string(body))); strings.TrimSuffix(checksumField[3:], string(fixSOH)) != expected {
+		return nil, errors.New("CheckSum inválido")
+	}
+
+	msg := fixMessage{}
+	for _, field := range bytes.Split(bytes.TrimSuffix(body, []byte{fixSOH}), []byte{fixSOH}) {
+		tag, value, ok := strings.Cut(string(field), "=")
+		n, err := strconv.Atoi(tag)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("campo inválido: %q", field)
+		}
+		msg.set(n, value)
+	}
+	return msg, nil
+}
+
+// FIXGateway aceita sessões FIX 4.4 de tenants e traduz NewOrderSingle e
+// OrderCancelRequest em chamadas REST da Binance
+type FIXGateway struct {
+	proxy    *ProxyServer
+	compID   string
+	listener net.Listener
+
+	mu       sync.Mutex
+	sessions map[*fixSession]struct{}
+}
+
+// startFIXGateway inicia o acceptor FIX na porta informada, em segundo plano
+func startFIXGateway(proxy *ProxyServer, port, compID string) (*FIXGateway, error) {
+	lis, err := listenSocket("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	gw := &FIXGateway{proxy: proxy, compID: compID, listener: lis, sessions: make(map[*fixSession]struct{})}
+	go gw.accept()
+	return gw, nil
+}
+
+func (gw *FIXGateway) accept() {
+	for {
+		conn, err := gw.listener.Accept()
+		if err != nil {
+			return
+		}
+		s := &fixSession{gw: gw, conn: conn, orders: make(map[int64]*fixOrder)}
+		gw.mu.Lock()
+		gw.sessions[s] = struct{}{}
+		gw.mu.Unlock()
+		go func() {
+			s.run()
+			gw.mu.Lock()
+			delete(gw.sessions, s)
+			gw.mu.Unlock()
+		}()
+	}
+}
+
+// Close para de aceitar conexões e encerra as sessões com Logout
+func (gw *FIXGateway) Close() {
+	gw.listener.Close()
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	for s := range gw.sessions {
+		s.logout("Gateway encerrado")
+		s.conn.Close()
+	}
+}
+
+// fixOrder acompanha uma ordem enviada pela sessão, para montar os
+// ExecutionReports e não repetir estados já reportados
+type fixOrder struct {
+	orderID     int64
+	clOrdID     string
+	origClOrdID string
+	symbol      string
+	side        string
+	ordType     string
+	orderQty    string
+	price       string
+	cumQty      string
+	cumQuote    string
+	status      string
+	execSeq     int
+}
+
+type fixSession struct {
+	gw     *FIXGateway
+	conn   net.Conn
+	tenant *Tenant
+
+	targetCompID string
+	heartBtInt   int
+
+	mu        sync.Mutex
+	outSeq    int
+	lastWrite time.Time
+	orders    map[int64]*fixOrder
+}
+
+// send completa o cabeçalho e o trailer e escreve a mensagem na conexão
+func (s *fixSession) send(msgType string, body fixMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outSeq++
+	var b bytes.Buffer
+	write := func(tag int, value string) {
+		b.WriteString(strconv.Itoa(tag))
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte(fixSOH)
+	}
+	write(fixTagMsgType, msgType)
+	write(fixTagSenderCompID, s.gw.compID)
+	write(fixTagTargetCompID, s.targetCompID)
+	write(fixTagMsgSeqNum, strconv.Itoa(s.outSeq))
+	write(fixTagSendingTime, fixTimestamp(time.Now()))
+	for _, f := range body {
+		write(f.Tag, f.Value)
+	}
+
+	msg := fmt.Sprintf("8=%s%c9=%d%c", fixBeginString, fixSOH, b.Len(), fixSOH) + b.String()
+	msg += "10=" + fixChecksum([]byte(msg)) + string(fixSOH)
+	s.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	_, err := io.WriteString(s.conn, msg)
+	s.lastWrite = time.Now()
+	return err
+}
+
+func fixTimestamp(t time.Time) string {
+	return t.UTC().Format("20060102-15:04:05.000")
+}
+
+func (s *fixSession) logout(text string) {
+	body := fixMessage{}
+	if text != "" {
+		body.set(fixTagText, text)
+	}
+	s.send(fixMsgLogout, body)
+}
+
+func (s *fixSession) reject(ref fixMessage, text string) {
+	body := fixMessage{}
+	body.set(fixTagRefSeqNum, ref.get(fixTagMsgSeqNum))
+	body.set(fixTagText, text)
+	s.send(fixMsgReject, body)
+}
+
+func (s *fixSession) run() {
+	defer s.conn.Close()
+	r := bufio.NewReader(s.conn)
+
+	// A primeira mensagem deve ser o Logon
+	s.conn.SetReadDeadline(time.Now().Add(fixLogonTimeout))
+	logon, err := readFIXMessage(r)
+	if err != nil {
+		return
+	}
+	s.targetCompID = logon.get(fixTagSenderCompID)
+	if logon.get(fixTagMsgType) != fixMsgLogon {
+		s.logout("A primeira mensagem deve ser Logon (35=A)")
+		return
+	}
+	if logon.get(fixTagTargetCompID) != s.gw.compID {
+		s.logout("TargetCompID deve ser " + s.gw.compID)
+		return
+	}
+	if s.tenant = s.gw.proxy.tenants.Lookup(logon.get(fixTagPassword)); s.tenant == nil {
+		s.logout("Token de tenant inválido ou ausente (Password, tag 554)")
+		return
+	}
+	if user := logon.get(fixTagUsername); user != "" && user != s.tenant.Name {
+		s.logout("Username não corresponde ao tenant")
+		return
+	}
+	s.heartBtInt, _ = strconv.Atoi(logon.get(fixTagHeartBtInt))
+	if s.heartBtInt <= 0 {
+		s.heartBtInt = fixDefaultHeartBtInt
+	}
+
+	// Sem armazenamento de mensagens: toda sessão começa na sequência 1
+	reply := fixMessage{}
+	reply.set(fixTagEncryptMethod, "0")
+	reply.set(fixTagHeartBtInt, strconv.Itoa(s.heartBtInt))
+	reply.set(fixTagResetSeqNumFlag, "Y")
+	if err := s.send(fixMsgLogon, reply); err != nil {
+		return
+	}
+	// log.Printf("[FIX] Sessão %s iniciada (tenant %s)", s.targetCompID, s.tenant.Name)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.heartbeats(ctx)
+	go s.forwardExecutionReports(ctx)
+
+	interval := time.Duration(s.heartBtInt) * time.Second
+	testRequestSent := false
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(interval + interval/5))
+		msg, err := readFIXMessage(r)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !testRequestSent {
+				// Sem tráfego do cliente: enviar TestRequest antes de desconectar
+				testRequestSent = true
+				body := fixMessage{}
+				body.set(fixTagTestReqID, strconv.FormatInt(time.Now().UnixMilli(), 10))
+				s.send(fixMsgTestRequest, body)
+				continue
+			}
+			return
+		}
+		testRequestSent = false
+
+		switch msg.get(fixTagMsgType) {
+		case fixMsgHeartbeat:
+		case fixMsgTestRequest:
+			body := fixMessage{}
+			body.set(fixTagTestReqID, msg.get(fixTagTestReqID))
+			s.send(fixMsgHeartbeat, body)
+		case fixMsgLogout:
+			s.logout("")
+			return
+		case fixMsgNewOrderSingle:
+			s.newOrderSingle(msg)
+		case fixMsgOrderCancelRequest:
+			s.orderCancelRequest(msg)
+		case fixMsgLogon:
+			s.reject(msg, "Sessão já autenticada")
+		default:
+			body := fixMessage{}
+			body.set(fixTagRefSeqNum, msg.get(fixTagMsgSeqNum))
+			body.set(fixTagRefMsgType, msg.get(fixTagMsgType))
+			body.set(fixTagBusinessRejectReason, "3")
+			body.set(fixTagText, "Tipo de mensagem não suportado")
+			s.send(fixMsgBusinessMessageReject, body)
+		}
+	}
+}
+
+// heartbeats envia Heartbeat quando a sessão fica HeartBtInt sem enviar nada
+func (s *fixSession) heartbeats(ctx context.Context) {
+	interval := time.Duration(s.heartBtInt) * time.Second
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			idle := time.Since(s.lastWrite)
+			s.mu.Unlock()
+			if idle >= interval {
+				s.send(fixMsgHeartbeat, nil)
+			}
+		}
+	}
+}
+
+// forwardExecutionReports converte os eventos executionReport do user data
+// stream do tenant em ExecutionReports FIX para as ordens desta sessão
+func (s *fixSession) forwardExecutionReports(ctx context.Context) {
+	sub := s.gw.proxy.userStreams.Get(s.tenant).Subscribe()
+	defer sub.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-sub.C:
+			if msg.Stream != "executionReport" {
+				continue
+			}
+			var event executionReport
+			if err := json.Unmarshal(msg.Data, &event); err != nil {
+				continue
+			}
+			s.mu.Lock()
+			order, ok := s.orders[event.OrderID]
+			s.mu.Unlock()
+			if !ok {
+				continue
+			}
+			s.report(order, event.Status, event.CumulativeQty, event.CumulativeQuote, event.LastQty, event.LastPrice)
+		}
+	}
+}
+
+var fixSides = map[string]string{"1": "BUY", "2": "SELL"}
+
+var fixOrdTypes = map[string]string{"1": "MARKET", "2": "LIMIT", "3": "STOP_LOSS", "4": "STOP_LOSS_LIMIT"}
+
+var fixTimeInForces = map[string]string{"0": "GTC", "1": "GTC", "3": "IOC", "4": "FOK"}
+
+var fixOrdStatuses = map[string]string{
+	"NEW":              "0",
+	"PARTIALLY_FILLED": "1",
+	"FILLED":           "2",
+	"CANCELED":         "4",
+	"PENDING_CANCEL":   "6",
+	"REJECTED":         "8",
+	"EXPIRED":          "C",
+	"EXPIRED_IN_MATCH": "C",
+}
+
+func fixCode(values map[string]string, binance string) string {
+	for code, value := range values {
+		if value == binance {
+			return code
+		}
+	}
+	return ""
+}
+
+func (s *fixSession) newOrderSingle(msg fixMessage) {
+	order := &fixOrder{
+		clOrdID:  msg.get(fixTagClOrdID),
+		symbol:   msg.get(fixTagSymbol),
+		side:     msg.get(fixTagSide),
+		ordType:  msg.get(fixTagOrdType),
+		orderQty: msg.get(fixTagOrderQty),
+		price:    msg.get(fixTagPrice),
+	}
+	if order.clOrdID == "" {
+		s.reject(msg, "ClOrdID (11) é obrigatório")
+		return
+	}
+
+	req := orderRequest{
+		Symbol:           order.symbol,
+		Side:             fixSides[order.side],
+		Type:             fixOrdTypes[order.ordType],
+		TimeInForce:      fixTimeInForces[msg.get(fixTagTimeInForce)],
+		NewClientOrderID: order.clOrdID,
+	}
+	if req.Side == "" || req.Type == "" {
+		s.rejectOrder(order, "Side (54) ou OrdType (40) não suportado")
+		return
+	}
+	for _, field := range []struct {
+		tag int
+		dst *flexFloat
+	}{
+		{fixTagOrderQty, &req.Quantity},
+		{fixTagCashOrderQty, &req.QuoteOrderQty},
+		{fixTagPrice, &req.Price},
+		{fixTagStopPx, &req.StopPrice},
+	} {
+		if !msg.has(field.tag) {
+			continue
+		}
+		value, err := strconv.ParseFloat(msg.get(field.tag), 64)
+		if err != nil || value < 0 {
+			s.rejectOrder(order, fmt.Sprintf("valor inválido na tag %d", field.tag))
+			return
+		}
+		*field.dst = flexFloat(value)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fixRequestTimeout)
+	defer cancel()
+	info, err := s.gw.proxy.market.ExchangeInfo(ctx)
+	if err != nil {
+		s.rejectOrder(order, err.Error())
+		return
+	}
+	if verr := req.normalize(info); verr != nil {
+		text := verr.Message
+		for _, v := range verr.FilterViolations {
+			text += "; " + v.Filter + ": " + v.Message
+		}
+		s.rejectOrder(order, text)
+		return
+	}
+	order.symbol = req.Symbol
+
+	params := req.params()
+	params.Set("newOrderRespType", "RESULT")
+	body, err := s.gw.proxy.signedRequest(ctx, s.tenant, http.MethodPost, "/api/v3/order", params)
+	if err != nil {
+		s.rejectOrder(order, fixErrorText(err))
+		return
+	}
+	var result placedOrderResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		s.rejectOrder(order, err.Error())
+		return
+	}
+
+	order.orderID = result.OrderID
+	if order.orderQty == "" {
+		order.orderQty = result.OrigQty
+	}
+	s.mu.Lock()
+	s.orders[order.orderID] = order
+	s.mu.Unlock()
+
+	// O ack New é sempre enviado; execuções imediatas seguem como Trade
+	s.report(order, "NEW", "0", "0", "", "")
+	if result.Status != "NEW" {
+		s.report(order, result.Status, result.ExecutedQty, result.CummulativeQuoteQty, "", "")
+	}
+}
+
+func (s *fixSession) orderCancelRequest(msg fixMessage) {
+	clOrdID, origClOrdID := msg.get(fixTagClOrdID), msg.get(fixTagOrigClOrdID)
+	symbol := strings.ToUpper(msg.get(fixTagSymbol))
+	cancelReject := func(reason, text string) {
+		body := fixMessage{}
+		orderID := msg.get(fixTagOrderID)
+		if orderID == "" {
+			orderID = "NONE"
+		}
+		body.set(fixTagOrderID, orderID)
+		body.set(fixTagClOrdID, clOrdID)
+		body.set(fixTagOrigClOrdID, origClOrdID)
+		body.set(fixTagOrdStatus, "8")
+		body.set(fixTagCxlRejResponseTo, "1")
+		body.set(fixTagCxlRejReason, reason)
+		body.set(fixTagText, text)
+		s.send(fixMsgOrderCancelReject, body)
+	}
+	if clOrdID == "" || symbol == "" || (origClOrdID == "" && msg.get(fixTagOrderID) == "") {
+		cancelReject("99", "ClOrdID (11), Symbol (55) e OrigClOrdID (41) ou OrderID (37) são obrigatórios")
+		return
+	}
+
+	params := url.Values{"symbol": {symbol}, "newClientOrderId": {clOrdID}}
+	if orderID := msg.get(fixTagOrderID); orderID != "" {
+		params.Set("orderId", orderID)
+	} else {
+		params.Set("origClientOrderId", origClOrdID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fixRequestTimeout)
+	defer cancel()
+	body, err := s.gw.proxy.signedRequest(ctx, s.tenant, http.MethodDelete, "/api/v3/order", params)
+	if err != nil {
+		reason := "99"
+		if upstreamErr, ok := err.(*UpstreamError); ok && bytes.Contains(upstreamErr.Body, []byte("-2011")) {
+			reason = "1"
+		}
+		cancelReject(reason, fixErrorText(err))
+		return
+	}
+	var result placedOrderResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		cancelReject("99", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	order, ok := s.orders[result.OrderID]
+	if !ok {
+		// Ordem de outra sessão: passa a ser acompanhada por esta
+		order = &fixOrder{
+			orderID:  result.OrderID,
+			symbol:   result.Symbol,
+			side:     fixCode(fixSides, result.Side),
+			ordType:  fixCode(fixOrdTypes, result.Type),
+			orderQty: result.OrigQty,
+			price:    result.Price,
+		}
+		s.orders[result.OrderID] = order
+	}
+	order.origClOrdID = origClOrdID
+	if order.origClOrdID == "" {
+		order.origClOrdID = order.clOrdID
+	}
+	order.clOrdID = clOrdID
+	s.mu.Unlock()
+	s.report(order, result.Status, result.ExecutedQty, result.CummulativeQuoteQty, "", "")
+}
+
+// fixErrorText resume erros da Binance para a tag Text (58)
+func fixErrorText(err error) string {
+	if upstreamErr, ok := err.(*UpstreamError); ok {
+		var body struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		if json.Unmarshal(upstreamErr.Body, &body) == nil && body.Msg != "" {
+			return fmt.Sprintf("%d: %s", body.Code, body.Msg)
+		}
+	}
+	return err.Error()
+}
+
+// rejectOrder envia um ExecutionReport Rejected para uma ordem não aceita
+func (s *fixSession) rejectOrder(order *fixOrder, text string) {
+	body := fixMessage{}
+	body.set(fixTagOrderID, "NONE")
+	body.set(fixTagClOrdID, order.clOrdID)
+	body.set(fixTagExecID, "REJ-"+order.clOrdID)
+	body.set(fixTagExecType, "8")
+	body.set(fixTagOrdStatus, "8")
+	body.set(fixTagOrdRejReason, "99")
+	body.set(fixTagSymbol, order.symbol)
+	body.set(fixTagSide, order.side)
+	body.set(fixTagOrdType, order.ordType)
+	body.set(fixTagOrderQty, order.orderQty)
+	body.set(fixTagLeavesQty, "0")
+	body.set(fixTagCumQty, "0")
+	body.set(fixTagAvgPx, "0")
+	body.set(fixTagText, text)
+	body.set(fixTagTransactTime, fixTimestamp(time.Now()))
+	s.send(fixMsgExecutionReport, body)
+}
+
+// report envia um ExecutionReport quando a ordem avança (mais quantidade
+// executada ou status posterior); estados já reportados pela resposta REST ou
+// pelo user data stream são ignorados
+func (s *fixSession) report(order *fixOrder, status, cumQty, cumQuote, lastQty, lastPx string) {
+	s.mu.Lock()
+	cum, _ := strconv.ParseFloat(cumQty, 64)
+	prevCum, _ := strconv.ParseFloat(order.cumQty, 64)
+	if fixStatusRank(order.status) == 2 || cum < prevCum || (cum == prevCum && fixStatusRank(status) <= fixStatusRank(order.status)) {
+		s.mu.Unlock()
+		return
+	}
+	execType := fixOrdStatuses[status]
+	switch {
+	case cum > prevCum:
+		execType = "F"
+		if lastQty == "" {
+			lastQty = formatFloat(cum - prevCum)
+		}
+		if lastPx == "" {
+			prevQuote, _ := strconv.ParseFloat(order.cumQuote, 64)
+			quote, _ := strconv.ParseFloat(cumQuote, 64)
+			lastPx = formatFloat((quote - prevQuote) / (cum - prevCum))
+		}
+	case status == "PARTIALLY_FILLED" || status == "FILLED":
+		execType = "F"
+	}
+	order.status = status
+	order.cumQty = formatFloat(cum)
+	order.cumQuote = cumQuote
+	order.execSeq++
+	snapshot := *order
+	s.mu.Unlock()
+
+	qty, _ := strconv.ParseFloat(snapshot.orderQty, 64)
+	leaves := qty - cum
+	if leaves < 0 || !orderIsOpen(status) {
+		leaves = 0
+	}
+	avgPx := "0"
+	if quote, _ := strconv.ParseFloat(cumQuote, 64); cum > 0 {
+		avgPx = formatFloat(quote / cum)
+	}
+
+	body := fixMessage{}
+	body.set(fixTagOrderID, strconv.FormatInt(snapshot.orderID, 10))
+	body.set(fixTagClOrdID, snapshot.clOrdID)
+	if snapshot.origClOrdID != "" {
+		body.set(fixTagOrigClOrdID, snapshot.origClOrdID)
+	}
+	body.set(fixTagExecID, fmt.Sprintf("%d-%d", snapshot.orderID, snapshot.execSeq))
+	body.set(fixTagExecType, execType)
+	body.set(fixTagOrdStatus, fixOrdStatuses[status])
+	body.set(fixTagSymbol, snapshot.symbol)
+	body.set(fixTagSide, snapshot.side)
+	body.set(fixTagOrdType, snapshot.ordType)
+	body.set(fixTagOrderQty, snapshot.orderQty)
+	if snapshot.price != "" {
+		body.set(fixTagPrice, snapshot.price)
+	}
+	if execType == "F" && lastQty != "" {
+		body.set(fixTagLastQty, lastQty)
+		body.set(fixTagLastPx, lastPx)
+	}
+	body.set(fixTagLeavesQty, formatFloat(leaves))
+	body.set(fixTagCumQty, snapshot.cumQty)
+	body.set(fixTagAvgPx, avgPx)
+	body.set(fixTagTransactTime, fixTimestamp(time.Now()))
+	s.send(fixMsgExecutionReport, body)
+}
+
+// fixStatusRank ordena os status de uma ordem; estados finais têm o maior valor
+func fixStatusRank(status string) int {
+	switch status {
+	case "":
+		return -1
+	case "NEW", "PENDING_NEW":
+		return 0
+	case "PARTIALLY_FILLED", "PENDING_CANCEL":
+		return 1
+	}
+	return 2
+}
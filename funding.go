@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultFundingCacheTTL   = 30 * time.Second
+	defaultFundingLimit      = 30
+	defaultOpenInterestLimit = 24
+	defaultOpenInterestStep  = "1h"
+	// Intervalo padrão entre pagamentos de funding, usado quando o
+	// histórico não permite medir
+	defaultFundingInterval = 8 * time.Hour
+)
+
+// openInterestPeriods são os períodos aceitos por /futures/data/openInterestHist
+var openInterestPeriods = map[string]bool{
+	"5m": true, "15m": true, "30m": true, "1h": true, "2h": true, "4h": true, "6h": true, "12h": true, "1d": true,
+}
+
+// premiumIndex é a resposta de /fapi/v1/premiumIndex
+type premiumIndex struct {
+	Symbol          string `json:"symbol"`
+	MarkPrice       string `json:"markPrice"`
+	IndexPrice      string `json:"indexPrice"`
+	LastFundingRate string `json:"lastFundingRate"`
+	InterestRate    string `json:"interestRate"`
+	NextFundingTime int64  `json:"nextFundingTime"`
+	Time            int64  `json:"time"`
+}
+
+// fundingRatePoint é um item de /fapi/v1/fundingRate
+type fundingRatePoint struct {
+	FundingTime int64  `json:"fundingTime"`
+	FundingRate string `json:"fundingRate"`
+	MarkPrice   string `json:"markPrice"`
+}
+
+// openInterestPoint é um item de /futures/data/openInterestHist
+type openInterestPoint struct {
+	Timestamp            int64  `json:"timestamp"`
+	SumOpenInterest      string `json:"sumOpenInterest"`
+	SumOpenInterestValue string `json:"sumOpenInterestValue"`
+}
+
+// fundingReport é a resposta de /local/funding/{symbol}
+type fundingReport struct {
+	Symbol            string              `json:"symbol"`
+	MarkPrice         string              `json:"markPrice"`
+	IndexPrice        string              `json:"indexPrice"`
+	FundingRate       string              `json:"fundingRate"`
+	InterestRate      string              `json:"interestRate"`
+	NextFundingTime   int64               `json:"nextFundingTime"`
+	OpenInterest      string              `json:"openInterest"`
+	OpenInterestValue string              `json:"openInterestValue"`
+	Funding           fundingSummary      `json:"funding"`
+	OpenInterestHist  openInterestSummary `json:"openInterestHistory"`
+	UpdatedAt         int64               `json:"updatedAt"`
+}
+
+type fundingSummary struct {
+	Count      int                `json:"count"`
+	Average    string             `json:"average"`
+	Min        string             `json:"min"`
+	Max        string             `json:"max"`
+	Interval   string             `json:"interval"`
+	Annualized string             `json:"annualized"`
+	History    []fundingRatePoint `json:"history"`
+}
+
+type openInterestSummary struct {
+	Period        string              `json:"period"`
+	ChangePercent string              `json:"changePercent"`
+	History       []openInterestPoint `json:"history"`
+}
+
+// futuresGet busca um endpoint da API de futuros com o cache de mercado
+// (FUNDING_CACHE_TTL), decodificando o JSON em out
+func (p *ProxyServer) futuresGet(c *gin.Context, baseURL, path string, query url.Values, out interface{}) bool {
+	ttl := getEnvDuration("FUNDING_CACHE_TTL", defaultFundingCacheTTL)
+	value, err := p.market.getFrom(c.Request.Context(), baseURL, path, query, ttl, func(data []byte) (interface{}, error) {
+		return data, nil
+	})
+	if err != nil {
+		respondUpstreamError(c, err)
+		return false
+	}
+	if err := json.Unmarshal(value.([]byte), out); err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Resposta inválida de "+path+": "+err.Error())
+		return false
+	}
+	return true
+}
+
+// LocalFunding reúne funding rate, mark price e open interest de um contrato
+// perpétuo, com o histórico agregado
+// @Summary Funding e open interest (futuros)
+// @Description Combina premiumIndex, openInterest, fundingRate e openInterestHist da API de futuros em uma resposta em cache, com média, extremos e taxa anualizada do funding
+// @Tags Market Data
+// @Produce json
+// @Param symbol path string true "Contrato (ex: BTCUSDT)"
+// @Param limit query integer false "Pagamentos de funding no histórico (máx. 1000)"
+// @Param period query string false "Período do histórico de open interest (5m a 1d)"
+// @Param oiLimit query integer false "Pontos do histórico de open interest (máx. 500)"
+// @Success 200 {object} fundingReport
+// @Failure 400 {object} map[string]interface{}
+// @Router /local/funding/{symbol} [get]
+func (p *ProxyServer) LocalFunding(backend ExchangeBackend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		symbol := strings.ToUpper(c.Param("symbol"))
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultFundingLimit)))
+		if err != nil || limit < 1 || limit > 1000 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'limit' deve estar entre 1 e 1000")
+			return
+		}
+		period := c.DefaultQuery("period", defaultOpenInterestStep)
+		if !openInterestPeriods[period] {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'period' inválido (use 5m, 15m, 30m, 1h, 2h, 4h, 6h, 12h ou 1d)")
+			return
+		}
+		oiLimit, err := strconv.Atoi(c.DefaultQuery("oiLimit", strconv.Itoa(defaultOpenInterestLimit)))
+		if err != nil || oiLimit < 1 || oiLimit > 500 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'oiLimit' deve estar entre 1 e 500")
+			return
+		}
+
+		baseURL := backend.BaseURL()
+		var (
+			index        premiumIndex
+			openInterest struct {
+				OpenInterest flexFloat `json:"openInterest"`
+			}
+			rates  []fundingRatePoint
+			oiHist []openInterestPoint
+		)
+		if !p.futuresGet(c, baseURL, "/fapi/v1/premiumIndex", url.Values{"symbol": {symbol}}, &index) ||
+			!p.futuresGet(c, baseURL, "/fapi/v1/openInterest", url.Values{"symbol": {symbol}}, &openInterest) ||
+			!p.futuresGet(c, baseURL, "/fapi/v1/fundingRate", url.Values{"symbol": {symbol}, "limit": {strconv.Itoa(limit)}}, &rates) ||
+			!p.futuresGet(c, baseURL, "/futures/data/openInterestHist", url.Values{"symbol": {symbol}, "period": {period}, "limit": {strconv.Itoa(oiLimit)}}, &oiHist) {
+			return
+		}
+
+		markPrice, _ := strconv.ParseFloat(index.MarkPrice, 64)
+		report := &fundingReport{
+			Symbol:            symbol,
+			MarkPrice:         index.MarkPrice,
+			IndexPrice:        index.IndexPrice,
+			FundingRate:       index.LastFundingRate,
+			InterestRate:      index.InterestRate,
+			NextFundingTime:   index.NextFundingTime,
+			OpenInterest:      formatFloat(float64(openInterest.OpenInterest)),
+			OpenInterestValue: formatFloat(float64(openInterest.OpenInterest) * markPrice),
+			Funding:           summarizeFunding(rates),
+			OpenInterestHist:  openInterestSummary{Period: period, History: oiHist},
+			UpdatedAt:         index.Time,
+		}
+		if oiHist == nil {
+			report.OpenInterestHist.History = []openInterestPoint{}
+		}
+		if len(oiHist) > 1 {
+			first, _ := strconv.ParseFloat(oiHist[0].SumOpenInterest, 64)
+			last, _ := strconv.ParseFloat(oiHist[len(oiHist)-1].SumOpenInterest, 64)
+			if first > 0 {
+				report.OpenInterestHist.ChangePercent = formatFloat((last - first) / first * 100)
+			}
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// summarizeFunding calcula média, extremos e a taxa anualizada do histórico.
+// O intervalo entre pagamentos (8h na maioria dos contratos) é medido pela
+// mediana das diferenças entre fundingTime.
+func summarizeFunding(rates []fundingRatePoint) fundingSummary {
+	summary := fundingSummary{Count: len(rates), History: rates, Interval: formatHours(defaultFundingInterval)}
+	if summary.History == nil {
+		summary.History = []fundingRatePoint{}
+	}
+	if len(rates) == 0 {
+		return summary
+	}
+
+	sum, low, high := 0.0, math.Inf(1), math.Inf(-1)
+	var gaps []int64
+	for i, point := range rates {
+		rate, _ := strconv.ParseFloat(point.FundingRate, 64)
+		sum += rate
+		low, high = math.Min(low, rate), math.Max(high, rate)
+		if i > 0 {
+			gaps = append(gaps, point.FundingTime-rates[i-1].FundingTime)
+		}
+	}
+	interval := defaultFundingInterval
+	if len(gaps) > 0 {
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+		// Arredonda para a hora: fundingTime pode variar alguns milissegundos
+		if measured := time.Duration(gaps[len(gaps)/2]) * time.Millisecond; measured >= time.Hour {
+			interval = measured.Round(time.Hour)
+		}
+	}
+
+	average := sum / float64(len(rates))
+	summary.Average = formatFloat(average)
+	summary.Min = formatFloat(low)
+	summary.Max = formatFloat(high)
+	summary.Interval = formatHours(interval)
+	summary.Annualized = formatFloat(average * float64(365*24*time.Hour/interval))
+	return summary
+}
+
+// formatHours formata um intervalo em horas inteiras (ex: 8h)
+func formatHours(d time.Duration) string {
+	return strconv.Itoa(int(d.Hours())) + "h"
+}
@@ -4,8 +4,17 @@ go 1.23
 
 require (
 	github.com/gin-gonic/gin v1.10.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/graph-gophers/graphql-go v1.5.0
+	github.com/mattn/go-sqlite3 v1.14.32
 	github.com/swaggo/files v1.0.1
 	github.com/swaggo/gin-swagger v1.3.3
+	github.com/tetratelabs/wazero v1.8.2
+	go.etcd.io/bbolt v1.3.11
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	golang.org/x/net v0.30.0
+	google.golang.org/grpc v1.67.1
+	google.golang.org/protobuf v1.36.10
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -40,11 +49,10 @@ require (
 	github.com/ugorji/go/codec v1.3.1 // indirect
 	golang.org/x/arch v0.8.0 // indirect
 	golang.org/x/crypto v0.28.0 // indirect
-	golang.org/x/net v0.30.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
 	golang.org/x/text v0.19.0 // indirect
 	golang.org/x/tools v0.26.0 // indirect
-	google.golang.org/protobuf v1.36.10 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
 )
 
 exclude (
@@ -0,0 +1,619 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+const (
+	graphqlMaxDepth       = 8
+	graphqlMaxParallelism = 10
+	graphqlDefaultFirst   = 100
+	// Símbolos por subscription (um stream da Binance por símbolo)
+	graphqlMaxStreamSymbols = 50
+)
+
+// graphqlSchema descreve o grafo exposto em /graphql. Timestamps são Float
+// (milissegundos), já que Int no GraphQL tem 32 bits. As subscriptions
+// chegam por WebSocket no mesmo path (graphql_ws.go).
+const graphqlSchema = `
+schema {
+	query: Query
+	subscription: Subscription
+}
+
+type Query {
+	# Símbolos do exchangeInfo, com filtros opcionais
+	symbols(quoteAsset: String, baseAsset: String, status: String, first: Int): [Symbol!]!
+	symbol(symbol: String!): Symbol
+	ticker(symbol: String!): Ticker
+	tickers(symbols: [String!]): [Ticker!]!
+	klines(symbol: String!, interval: String!, limit: Int): [Kline!]!
+	orderBook(symbol: String!, limit: Int): OrderBook
+}
+
+type Subscription {
+	# Ticker de 24h a cada atualização do stream <symbol>@ticker
+	tickerUpdates(symbols: [String!]!): Ticker!
+	# Negócios do stream <symbol>@trade
+	trades(symbols: [String!]!): Trade!
+}
+
+type Trade {
+	symbol: String!
+	tradeId: Float!
+	price: String!
+	quantity: String!
+	tradeTime: Float!
+	buyerIsMaker: Boolean!
+}
+
+type Symbol {
+	symbol: String!
+	status: String!
+	baseAsset: String!
+	quoteAsset: String!
+	orderTypes: [String!]!
+	filters: Filters!
+	price: String
+	ticker: Ticker
+	orderBook(limit: Int): OrderBook
+	klines(interval: String!, limit: Int): [Kline!]!
+}
+
+type Filters {
+	tickSize: String!
+	minPrice: String!
+	maxPrice: String!
+	stepSize: String!
+	minQty: String!
+	maxQty: String!
+	minNotional: String!
+	maxNotional: String!
+}
+
+type Ticker {
+	symbol: String!
+	lastPrice: String!
+	priceChange: String!
+	priceChangePercent: String!
+	weightedAvgPrice: String!
+	openPrice: String!
+	highPrice: String!
+	lowPrice: String!
+	bidPrice: String!
+	askPrice: String!
+	volume: String!
+	quoteVolume: String!
+	count: Float!
+	closeTime: Float!
+}
+
+type Kline {
+	openTime: Float!
+	open: String!
+	high: String!
+	low: String!
+	close: String!
+	volume: String!
+	closeTime: Float!
+	quoteVolume: String!
+	trades: Float!
+}
+
+type BookLevel {
+	price: String!
+	quantity: String!
+}
+
+type OrderBook {
+	symbol: String!
+	lastUpdateId: Float!
+	bids(first: Int): [BookLevel!]!
+	asks(first: Int): [BookLevel!]!
+	bestBid: String
+	bestAsk: String
+	spread: String
+	midPrice: String
+}
+`
+
+// newGraphQLSchema cria o schema com os resolvers ligados aos caches do proxy
+func newGraphQLSchema(proxy *ProxyServer) *graphql.Schema {
+	return graphql.MustParseSchema(graphqlSchema, &graphqlQuery{proxy: proxy},
+		graphql.UseFieldResolvers(),
+		graphql.MaxDepth(graphqlMaxDepth),
+		graphql.MaxParallelism(graphqlMaxParallelism),
+	)
+}
+
+type graphqlQuery struct {
+	proxy *ProxyServer
+}
+
+func (q *graphqlQuery) Symbols(ctx context.Context, args struct {
+	QuoteAsset *string
+	BaseAsset  *string
+	Status     *string
+	First      *int32
+}) ([]*graphqlSymbol, error) {
+	info, err := q.proxy.market.ExchangeInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	first := graphqlDefaultFirst
+	if args.First != nil && *args.First > 0 {
+		first = int(*args.First)
+	}
+
+	symbols := []*graphqlSymbol{}
+	for i := range info.Symbols {
+		s := &info.Symbols[i]
+		if args.QuoteAsset != nil && !strings.EqualFold(s.QuoteAsset, *args.QuoteAsset) {
+			continue
+		}
+		if args.BaseAsset != nil && !strings.EqualFold(s.BaseAsset, *args.BaseAsset) {
+			continue
+		}
+		if args.Status != nil && !strings.EqualFold(s.Status, *args.Status) {
+			continue
+		}
+		symbols = append(symbols, &graphqlSymbol{proxy: q.proxy, info: s})
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].info.Symbol < symbols[j].info.Symbol })
+	if len(symbols) > first {
+		symbols = symbols[:first]
+	}
+	return symbols, nil
+}
+
+func (q *graphqlQuery) Symbol(ctx context.Context, args struct{ Symbol string }) (*graphqlSymbol, error) {
+	info, err := q.proxy.market.ExchangeInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := info.Symbol(strings.ToUpper(args.Symbol))
+	if !ok {
+		return nil, nil
+	}
+	return &graphqlSymbol{proxy: q.proxy, info: s}, nil
+}
+
+func (q *graphqlQuery) Ticker(ctx context.Context, args struct{ Symbol string }) (*graphqlTicker, error) {
+	return resolveTicker(ctx, q.proxy, strings.ToUpper(args.Symbol))
+}
+
+func (q *graphqlQuery) Tickers(ctx context.Context, args struct{ Symbols *[]string }) ([]*graphqlTicker, error) {
+	tickers, err := q.proxy.market.Tickers24h(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []string
+	if args.Symbols != nil {
+		if symbols, err = normalizeSymbols(*args.Symbols); err != nil {
+			return nil, err
+		}
+	} else {
+		for symbol := range tickers {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+	}
+
+	result := []*graphqlTicker{}
+	for _, symbol := range symbols {
+		if t, ok := tickers[symbol]; ok {
+			result = append(result, &graphqlTicker{t})
+		}
+	}
+	return result, nil
+}
+
+func (q *graphqlQuery) Klines(ctx context.Context, args struct {
+	Symbol   string
+	Interval string
+	Limit    *int32
+}) ([]*graphqlKline, error) {
+	return resolveKlines(ctx, q.proxy, strings.ToUpper(args.Symbol), args.Interval, args.Limit)
+}
+
+func (q *graphqlQuery) OrderBook(ctx context.Context, args struct {
+	Symbol string
+	Limit  *int32
+}) (*graphqlOrderBook, error) {
+	return resolveOrderBook(ctx, q.proxy, strings.ToUpper(args.Symbol), args.Limit)
+}
+
+// TickerUpdates e Trades são as subscriptions: cada uma assina os streams
+// no hub e entrega os eventos até o cliente encerrar a operação
+func (q *graphqlQuery) TickerUpdates(ctx context.Context, args struct{ Symbols []string }) (<-chan *graphqlTicker, error) {
+	sub, err := q.subscribe(args.Symbols, "@ticker")
+	if err != nil {
+		return nil, err
+	}
+	return graphqlStream(ctx, sub, func(data []byte) (*graphqlTicker, bool) {
+		var event tickerStreamEvent
+		if err := json.Unmarshal(data, &event); err != nil || event.Symbol == "" {
+			return nil, false
+		}
+		return &graphqlTicker{event.ticker()}, true
+	}), nil
+}
+
+func (q *graphqlQuery) Trades(ctx context.Context, args struct{ Symbols []string }) (<-chan *graphqlTrade, error) {
+	sub, err := q.subscribe(args.Symbols, "@trade")
+	if err != nil {
+		return nil, err
+	}
+	return graphqlStream(ctx, sub, func(data []byte) (*graphqlTrade, bool) {
+		var event tradeEvent
+		if err := json.Unmarshal(data, &event); err != nil || event.Symbol == "" {
+			return nil, false
+		}
+		return &graphqlTrade{event}, true
+	}), nil
+}
+
+func (q *graphqlQuery) subscribe(symbols []string, suffix string) (*Subscription, error) {
+	symbols, err := normalizeSymbols(symbols)
+	if err != nil {
+		return nil, err
+	}
+	if len(symbols) == 0 {
+		return nil, errors.New("informe ao menos um símbolo")
+	}
+	if len(symbols) > graphqlMaxStreamSymbols {
+		return nil, fmt.Errorf("no máximo %d símbolos por subscription", graphqlMaxStreamSymbols)
+	}
+	streams := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		streams[i] = strings.ToLower(symbol) + suffix
+	}
+	return q.proxy.hub.SubscribeClient(streams...).Label("graphql"), nil
+}
+
+// graphqlStream converte as mensagens da assinatura em eventos da
+// subscription. O canal é fechado (e a assinatura encerrada) junto com ctx.
+func graphqlStream[T any](ctx context.Context, sub *Subscription, convert func(data []byte) (T, bool)) <-chan T {
+	events := make(chan T)
+	go func() {
+		defer close(events)
+		defer sub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.Done():
+				// Consumidor lento desconectado: a subscription termina
+				return
+			case msg := <-sub.C:
+				event, ok := convert(msg.Data)
+				if !ok {
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// tickerStreamEvent é o evento do stream <symbol>@ticker
+type tickerStreamEvent struct {
+	Symbol             string `json:"s"`
+	PriceChange        string `json:"p"`
+	PriceChangePercent string `json:"P"`
+	WeightedAvgPrice   string `json:"w"`
+	LastPrice          string `json:"c"`
+	LastQty            string `json:"Q"`
+	BidPrice           string `json:"b"`
+	BidQty             string `json:"B"`
+	AskPrice           string `json:"a"`
+	AskQty             string `json:"A"`
+	OpenPrice          string `json:"o"`
+	HighPrice          string `json:"h"`
+	LowPrice           string `json:"l"`
+	Volume             string `json:"v"`
+	QuoteVolume        string `json:"q"`
+	OpenTime           int64  `json:"O"`
+	CloseTime          int64  `json:"C"`
+	LastID             int64  `json:"L"`
+	Count              int64  `json:"n"`
+}
+
+func (e *tickerStreamEvent) ticker() *Ticker24h {
+	return &Ticker24h{
+		Symbol:             e.Symbol,
+		PriceChange:        e.PriceChange,
+		PriceChangePercent: e.PriceChangePercent,
+		WeightedAvgPrice:   e.WeightedAvgPrice,
+		LastPrice:          e.LastPrice,
+		LastQty:            e.LastQty,
+		BidPrice:           e.BidPrice,
+		BidQty:             e.BidQty,
+		AskPrice:           e.AskPrice,
+		AskQty:             e.AskQty,
+		OpenPrice:          e.OpenPrice,
+		HighPrice:          e.HighPrice,
+		LowPrice:           e.LowPrice,
+		Volume:             e.Volume,
+		QuoteVolume:        e.QuoteVolume,
+		OpenTime:           e.OpenTime,
+		CloseTime:          e.CloseTime,
+		LastID:             e.LastID,
+		Count:              e.Count,
+	}
+}
+
+type graphqlTrade struct {
+	t tradeEvent
+}
+
+func (t *graphqlTrade) Symbol() string     { return t.t.Symbol }
+func (t *graphqlTrade) TradeId() float64   { return float64(t.t.TradeID) }
+func (t *graphqlTrade) Price() string      { return t.t.Price }
+func (t *graphqlTrade) Quantity() string   { return t.t.Quantity }
+func (t *graphqlTrade) TradeTime() float64 { return float64(t.t.TradeTime) }
+func (t *graphqlTrade) BuyerIsMaker() bool { return t.t.BuyerIsMaker }
+
+// graphqlSymbol resolve um símbolo; campos caros (preço, ticker, livro,
+// candles) só são buscados quando selecionados na consulta
+type graphqlSymbol struct {
+	proxy *ProxyServer
+	info  *SymbolInfo
+}
+
+func (s *graphqlSymbol) Symbol() string       { return s.info.Symbol }
+func (s *graphqlSymbol) Status() string       { return s.info.Status }
+func (s *graphqlSymbol) BaseAsset() string    { return s.info.BaseAsset }
+func (s *graphqlSymbol) QuoteAsset() string   { return s.info.QuoteAsset }
+func (s *graphqlSymbol) OrderTypes() []string { return append([]string{}, s.info.OrderTypes...) }
+
+func (s *graphqlSymbol) Filters() *graphqlFilters {
+	f := s.info.ParsedFilters()
+	return &graphqlFilters{
+		TickSize:    formatFloat(f.TickSize),
+		MinPrice:    formatFloat(f.MinPrice),
+		MaxPrice:    formatFloat(f.MaxPrice),
+		StepSize:    formatFloat(f.StepSize),
+		MinQty:      formatFloat(f.MinQty),
+		MaxQty:      formatFloat(f.MaxQty),
+		MinNotional: formatFloat(f.MinNotional),
+		MaxNotional: formatFloat(f.MaxNotional),
+	}
+}
+
+func (s *graphqlSymbol) Price(ctx context.Context) (*string, error) {
+	prices, err := s.proxy.market.Prices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	price, ok := prices[s.info.Symbol]
+	if !ok {
+		return nil, nil
+	}
+	formatted := formatFloat(price)
+	return &formatted, nil
+}
+
+func (s *graphqlSymbol) Ticker(ctx context.Context) (*graphqlTicker, error) {
+	return resolveTicker(ctx, s.proxy, s.info.Symbol)
+}
+
+func (s *graphqlSymbol) OrderBook(ctx context.Context, args struct{ Limit *int32 }) (*graphqlOrderBook, error) {
+	return resolveOrderBook(ctx, s.proxy, s.info.Symbol, args.Limit)
+}
+
+func (s *graphqlSymbol) Klines(ctx context.Context, args struct {
+	Interval string
+	Limit    *int32
+}) ([]*graphqlKline, error) {
+	return resolveKlines(ctx, s.proxy, s.info.Symbol, args.Interval, args.Limit)
+}
+
+// graphqlFilters usa resolvers de campo (UseFieldResolvers)
+type graphqlFilters struct {
+	TickSize    string
+	MinPrice    string
+	MaxPrice    string
+	StepSize    string
+	MinQty      string
+	MaxQty      string
+	MinNotional string
+	MaxNotional string
+}
+
+type graphqlTicker struct {
+	t *Ticker24h
+}
+
+func resolveTicker(ctx context.Context, proxy *ProxyServer, symbol string) (*graphqlTicker, error) {
+	tickers, err := proxy.market.Tickers24h(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := tickers[symbol]
+	if !ok {
+		return nil, nil
+	}
+	return &graphqlTicker{t}, nil
+}
+
+func (t *graphqlTicker) Symbol() string             { return t.t.Symbol }
+func (t *graphqlTicker) LastPrice() string          { return t.t.LastPrice }
+func (t *graphqlTicker) PriceChange() string        { return t.t.PriceChange }
+func (t *graphqlTicker) PriceChangePercent() string { return t.t.PriceChangePercent }
+func (t *graphqlTicker) WeightedAvgPrice() string   { return t.t.WeightedAvgPrice }
+func (t *graphqlTicker) OpenPrice() string          { return t.t.OpenPrice }
+func (t *graphqlTicker) HighPrice() string          { return t.t.HighPrice }
+func (t *graphqlTicker) LowPrice() string           { return t.t.LowPrice }
+func (t *graphqlTicker) BidPrice() string           { return t.t.BidPrice }
+func (t *graphqlTicker) AskPrice() string           { return t.t.AskPrice }
+func (t *graphqlTicker) Volume() string             { return t.t.Volume }
+func (t *graphqlTicker) QuoteVolume() string        { return t.t.QuoteVolume }
+func (t *graphqlTicker) Count() float64             { return float64(t.t.Count) }
+func (t *graphqlTicker) CloseTime() float64         { return float64(t.t.CloseTime) }
+
+type graphqlKline struct {
+	k Kline
+}
+
+func resolveKlines(ctx context.Context, proxy *ProxyServer, symbol, interval string, limit *int32) ([]*graphqlKline, error) {
+	n := 0
+	if limit != nil {
+		n = int(*limit)
+	}
+	klines, err := proxy.market.Klines(ctx, symbol, interval, n, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*graphqlKline, len(klines))
+	for i := range klines {
+		result[i] = &graphqlKline{klines[i]}
+	}
+	return result, nil
+}
+
+func (k *graphqlKline) OpenTime() float64   { return float64(k.k.OpenTime) }
+func (k *graphqlKline) Open() string        { return k.k.Open }
+func (k *graphqlKline) High() string        { return k.k.High }
+func (k *graphqlKline) Low() string         { return k.k.Low }
+func (k *graphqlKline) Close() string       { return k.k.Close }
+func (k *graphqlKline) Volume() string      { return k.k.Volume }
+func (k *graphqlKline) CloseTime() float64  { return float64(k.k.CloseTime) }
+func (k *graphqlKline) QuoteVolume() string { return k.k.QuoteVolume }
+func (k *graphqlKline) Trades() float64     { return float64(k.k.Trades) }
+
+type graphqlBookLevel struct {
+	level [2]float64
+}
+
+func (l *graphqlBookLevel) Price() string    { return formatFloat(l.level[0]) }
+func (l *graphqlBookLevel) Quantity() string { return formatFloat(l.level[1]) }
+
+type graphqlOrderBook struct {
+	symbol string
+	book   *OrderBook
+}
+
+func resolveOrderBook(ctx context.Context, proxy *ProxyServer, symbol string, limit *int32) (*graphqlOrderBook, error) {
+	n := defaultGRPCBookLimit
+	if limit != nil && *limit > 0 {
+		n = int(*limit)
+	}
+	book, err := proxy.market.Depth(ctx, symbol, n)
+	if err != nil {
+		return nil, err
+	}
+	return &graphqlOrderBook{symbol: symbol, book: book}, nil
+}
+
+func graphqlLevels(levels [][2]float64, first *int32) []*graphqlBookLevel {
+	if first != nil && int(*first) >= 0 && int(*first) < len(levels) {
+		levels = levels[:*first]
+	}
+	result := make([]*graphqlBookLevel, len(levels))
+	for i, level := range levels {
+		result[i] = &graphqlBookLevel{level}
+	}
+	return result
+}
+
+func (b *graphqlOrderBook) Symbol() string        { return b.symbol }
+func (b *graphqlOrderBook) LastUpdateId() float64 { return float64(b.book.LastUpdateID) }
+
+func (b *graphqlOrderBook) Bids(args struct{ First *int32 }) []*graphqlBookLevel {
+	return graphqlLevels(b.book.Bids, args.First)
+}
+
+func (b *graphqlOrderBook) Asks(args struct{ First *int32 }) []*graphqlBookLevel {
+	return graphqlLevels(b.book.Asks, args.First)
+}
+
+func (b *graphqlOrderBook) BestBid() *string {
+	if len(b.book.Bids) == 0 {
+		return nil
+	}
+	price := formatFloat(b.book.Bids[0][0])
+	return &price
+}
+
+func (b *graphqlOrderBook) BestAsk() *string {
+	if len(b.book.Asks) == 0 {
+		return nil
+	}
+	price := formatFloat(b.book.Asks[0][0])
+	return &price
+}
+
+func (b *graphqlOrderBook) Spread() *string {
+	if len(b.book.Bids) == 0 || len(b.book.Asks) == 0 {
+		return nil
+	}
+	spread := formatFloat(b.book.Asks[0][0] - b.book.Bids[0][0])
+	return &spread
+}
+
+func (b *graphqlOrderBook) MidPrice() *string {
+	if len(b.book.Bids) == 0 || len(b.book.Asks) == 0 {
+		return nil
+	}
+	mid := formatFloat((b.book.Asks[0][0] + b.book.Bids[0][0]) / 2)
+	return &mid
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQL executa consultas GraphQL sobre os dados de mercado em cache
+// @Summary GraphQL
+// @Description Consulta símbolos, tickers, candles e livro de ofertas com seleção de campos. Aceita POST (JSON com query, operationName e variables) ou GET (?query=). Subscriptions (tickerUpdates, trades) por WebSocket no mesmo path, com os subprotocolos graphql-transport-ws ou graphql-ws.
+// @Tags Market Data
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /graphql [post]
+func (p *ProxyServer) GraphQL(c *gin.Context) {
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		p.graphQLWebSocket(c)
+		return
+	}
+
+	var req graphqlRequest
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if raw := c.Query("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				respondError(c, http.StatusBadRequest, -1100, "variables inválido: "+err.Error())
+				return
+			}
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "JSON inválido: "+err.Error())
+		return
+	}
+	if req.Query == "" {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetro obrigatório 'query' ausente")
+		return
+	}
+
+	resp := p.graphql.Exec(c.Request.Context(), req.Query, req.OperationName, req.Variables)
+	c.JSON(http.StatusOK, resp)
+}
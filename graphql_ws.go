@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocolos de subscriptions GraphQL aceitos em /graphql: o
+// graphql-transport-ws da biblioteca graphql-ws e o graphql-ws do antigo
+// subscriptions-transport-ws (Apollo)
+const (
+	graphqlTransportWS = "graphql-transport-ws"
+	graphqlLegacyWS    = "graphql-ws"
+)
+
+const (
+	graphqlInitTimeout      = 10 * time.Second
+	graphqlMaxSubscriptions = 20
+)
+
+// Códigos de fechamento do graphql-transport-ws
+const (
+	graphqlCloseBadRequest     = 4400
+	graphqlCloseUnauthorized   = 4401
+	graphqlCloseInitTimeout    = 4408
+	graphqlCloseDuplicateID    = 4409
+	graphqlCloseTooManyInits   = 4429
+	graphqlCloseTooManyStreams = 4403
+)
+
+var graphqlUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	Subprotocols:    []string{graphqlTransportWS, graphqlLegacyWS},
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// graphqlWSMessage é uma mensagem dos dois subprotocolos
+type graphqlWSMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// graphqlWSConn é uma conexão de subscriptions GraphQL
+type graphqlWSConn struct {
+	proxy  *ProxyServer
+	conn   *websocket.Conn
+	legacy bool
+
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	acknowledged  bool
+	subscriptions map[string]context.CancelFunc
+}
+
+func (w *graphqlWSConn) send(msg graphqlWSMessage) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	w.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return w.conn.WriteJSON(msg)
+}
+
+func (w *graphqlWSConn) sendPayload(id, kind string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return w.send(graphqlWSMessage{ID: id, Type: kind, Payload: data})
+}
+
+func (w *graphqlWSConn) close(code int, reason string) {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(streamWriteTimeout))
+}
+
+// graphQLWebSocket atende subscriptions GraphQL por WebSocket em /graphql.
+// Cada operação vira uma assinatura no hub de streams; os eventos seguem
+// como next (data no protocolo antigo) até o cliente mandar complete/stop.
+func (p *ProxyServer) graphQLWebSocket(c *gin.Context) {
+	conn, err := graphqlUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	w := &graphqlWSConn{
+		proxy:         p,
+		conn:          conn,
+		legacy:        conn.Subprotocol() == graphqlLegacyWS,
+		subscriptions: map[string]context.CancelFunc{},
+	}
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	// Sem connection_init no prazo, a conexão é fechada
+	initTimer := time.AfterFunc(graphqlInitTimeout, func() {
+		w.mu.Lock()
+		acknowledged := w.acknowledged
+		w.mu.Unlock()
+		if !acknowledged {
+			w.close(graphqlCloseInitTimeout, "Connection initialisation timeout")
+			conn.Close()
+		}
+	})
+	defer initTimer.Stop()
+
+	// O protocolo antigo espera keep-alives (ka) periódicos do servidor
+	if w.legacy {
+		keepAlive := time.NewTicker(streamKeepAliveInterval)
+		defer keepAlive.Stop()
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-keepAlive.C:
+					if w.send(graphqlWSMessage{Type: "ka"}) != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	alive := wsKeepAlive(conn, p.hub.heartbeat.ClientPing, p.hub.heartbeat.ClientTimeout, ctx.Done())
+	for {
+		var msg graphqlWSMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		alive()
+		if !w.handle(ctx, msg) {
+			return
+		}
+	}
+}
+
+// handle trata uma mensagem do cliente. Retorna false para encerrar a conexão.
+func (w *graphqlWSConn) handle(ctx context.Context, msg graphqlWSMessage) bool {
+	switch msg.Type {
+	case "connection_init":
+		w.mu.Lock()
+		repeated := w.acknowledged
+		w.acknowledged = true
+		w.mu.Unlock()
+		if repeated {
+			w.close(graphqlCloseTooManyInits, "Too many initialisation requests")
+			return false
+		}
+		if w.send(graphqlWSMessage{Type: "connection_ack"}) != nil {
+			return false
+		}
+		if w.legacy {
+			return w.send(graphqlWSMessage{Type: "ka"}) == nil
+		}
+		return true
+	case "ping":
+		return w.send(graphqlWSMessage{Type: "pong", Payload: msg.Payload}) == nil
+	case "pong":
+		return true
+	case "subscribe", "start":
+		return w.start(ctx, msg)
+	case "complete", "stop":
+		w.mu.Lock()
+		if cancel, ok := w.subscriptions[msg.ID]; ok {
+			cancel()
+			delete(w.subscriptions, msg.ID)
+		}
+		w.mu.Unlock()
+		return true
+	case "connection_terminate":
+		return false
+	}
+	w.close(graphqlCloseBadRequest, "Invalid message type: "+msg.Type)
+	return false
+}
+
+// start executa a operação e repassa as respostas ao cliente
+func (w *graphqlWSConn) start(ctx context.Context, msg graphqlWSMessage) bool {
+	var req graphqlRequest
+	if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil || req.Query == "" {
+		w.close(graphqlCloseBadRequest, "Invalid subscribe message")
+		return false
+	}
+
+	w.mu.Lock()
+	acknowledged := w.acknowledged
+	_, duplicate := w.subscriptions[msg.ID]
+	active := len(w.subscriptions)
+	w.mu.Unlock()
+	switch {
+	case !acknowledged:
+		w.close(graphqlCloseUnauthorized, "Unauthorized")
+		return false
+	case duplicate:
+		w.close(graphqlCloseDuplicateID, "Subscriber for "+msg.ID+" already exists")
+		return false
+	case active >= graphqlMaxSubscriptions:
+		w.close(graphqlCloseTooManyStreams, "Too many subscriptions")
+		return false
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	responses, err := w.proxy.graphql.Subscribe(subCtx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		cancel()
+		return w.sendPayload(msg.ID, "error", graphqlErrorPayload(err.Error(), w.legacy)) == nil
+	}
+	w.mu.Lock()
+	w.subscriptions[msg.ID] = cancel
+	w.mu.Unlock()
+
+	next := "next"
+	if w.legacy {
+		next = "data"
+	}
+	go func() {
+		defer func() {
+			w.mu.Lock()
+			_, active := w.subscriptions[msg.ID]
+			delete(w.subscriptions, msg.ID)
+			w.mu.Unlock()
+			cancel()
+			// Libera o executor, que pode estar bloqueado entregando um evento
+			go func() {
+				for range responses {
+				}
+			}()
+			// complete só quando o fim parte do servidor
+			if active {
+				w.send(graphqlWSMessage{ID: msg.ID, Type: "complete"})
+			}
+		}()
+		for {
+			select {
+			case <-subCtx.Done():
+				return
+			case response, ok := <-responses:
+				if !ok {
+					return
+				}
+				if w.sendPayload(msg.ID, next, response) != nil {
+					return
+				}
+			}
+		}
+	}()
+	return true
+}
+
+// graphqlErrorPayload monta o payload de error: uma lista de erros no
+// graphql-transport-ws, um único erro no protocolo antigo
+func graphqlErrorPayload(message string, legacy bool) interface{} {
+	payload := gin.H{"message": message}
+	if legacy {
+		return payload
+	}
+	return []gin.H{payload}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	proxypb "proxy_binance/proto"
+)
+
+const defaultGRPCBookLimit = 100
+
+// grpcMarketData implementa o serviço MarketData sobre os caches do proxy
+type grpcMarketData struct {
+	proxypb.UnimplementedMarketDataServer
+	proxy *ProxyServer
+}
+
+// grpcTrading implementa o serviço Trading com as credenciais do tenant
+type grpcTrading struct {
+	proxypb.UnimplementedTradingServer
+	proxy *ProxyServer
+}
+
+// startGRPCServer inicia o servidor gRPC na porta informada, em segundo plano
+func startGRPCServer(proxy *ProxyServer, port string) (*grpc.Server, error) {
+	lis, err := listenSocket("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(grpcRedactUnary), grpc.ChainStreamInterceptor(grpcRedactStream))
+	proxypb.RegisterMarketDataServer(server, &grpcMarketData{proxy: proxy})
+	proxypb.RegisterTradingServer(server, &grpcTrading{proxy: proxy})
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			// log.Printf("[ERROR] Servidor gRPC encerrado: %v", err)
+		}
+	}()
+	return server, nil
+}
+
+// grpcError converte erros da Binance/proxy em status gRPC
+func grpcError(err error) error {
+	upstreamErr, ok := err.(*UpstreamError)
+	if !ok {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	code := codes.Unknown
+	switch {
+	case upstreamErr.StatusCode == http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case upstreamErr.StatusCode == http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case upstreamErr.StatusCode == http.StatusForbidden:
+		code = codes.PermissionDenied
+	case upstreamErr.StatusCode == http.StatusNotFound:
+		code = codes.NotFound
+	case upstreamErr.StatusCode == http.StatusTooManyRequests || upstreamErr.StatusCode == http.StatusTeapot:
+		code = codes.ResourceExhausted
+	case upstreamErr.StatusCode >= 500:
+		code = codes.Unavailable
+	}
+	return status.Error(code, string(upstreamErr.Body))
+}
+
+// grpcSymbols normaliza a lista de símbolos de uma requisição gRPC
+func grpcSymbols(symbols []string) ([]string, error) {
+	normalized, err := normalizeSymbols(symbols)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return normalized, nil
+}
+
+func grpcSymbol(symbol string) (string, error) {
+	symbols, err := grpcSymbols([]string{symbol})
+	if err != nil {
+		return "", err
+	}
+	if len(symbols) == 0 {
+		return "", status.Error(codes.InvalidArgument, "symbol é obrigatório")
+	}
+	return symbols[0], nil
+}
+
+func (s *grpcMarketData) GetPrices(ctx context.Context, req *proxypb.GetPricesRequest) (*proxypb.GetPricesResponse, error) {
+	symbols, err := grpcSymbols(req.GetSymbols())
+	if err != nil {
+		return nil, err
+	}
+	prices, err := s.proxy.market.Prices(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	if len(symbols) == 0 {
+		for symbol := range prices {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+	}
+	resp := &proxypb.GetPricesResponse{}
+	for _, symbol := range symbols {
+		price, ok := prices[symbol]
+		if !ok {
+			return nil, status.Error(codes.NotFound, "símbolo sem preço: "+symbol)
+		}
+		resp.Prices = append(resp.Prices, &proxypb.Price{Symbol: symbol, Price: formatFloat(price)})
+	}
+	return resp, nil
+}
+
+func (s *grpcMarketData) GetOrderBook(ctx context.Context, req *proxypb.GetOrderBookRequest) (*proxypb.OrderBook, error) {
+	symbol, err := grpcSymbol(req.GetSymbol())
+	if err != nil {
+		return nil, err
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultGRPCBookLimit
+	}
+	book, err := s.proxy.market.Depth(ctx, symbol, limit)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	levels := func(in [][2]float64) []*proxypb.BookLevel {
+		out := make([]*proxypb.BookLevel, len(in))
+		for i, level := range in {
+			out[i] = &proxypb.BookLevel{Price: formatFloat(level[0]), Quantity: formatFloat(level[1])}
+		}
+		return out
+	}
+	return &proxypb.OrderBook{
+		Symbol:       symbol,
+		LastUpdateId: book.LastUpdateID,
+		Bids:         levels(book.Bids),
+		Asks:         levels(book.Asks),
+	}, nil
+}
+
+func (s *grpcMarketData) GetKlines(ctx context.Context, req *proxypb.GetKlinesRequest) (*proxypb.GetKlinesResponse, error) {
+	symbol, err := grpcSymbol(req.GetSymbol())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetInterval() == "" {
+		return nil, status.Error(codes.InvalidArgument, "interval é obrigatório")
+	}
+	klines, err := s.proxy.market.Klines(ctx, symbol, req.GetInterval(), int(req.GetLimit()), req.GetStartTime(), req.GetEndTime())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &proxypb.GetKlinesResponse{Klines: make([]*proxypb.Kline, len(klines))}
+	for i, k := range klines {
+		resp.Klines[i] = &proxypb.Kline{
+			OpenTime:    k.OpenTime,
+			Open:        k.Open,
+			High:        k.High,
+			Low:         k.Low,
+			Close:       k.Close,
+			Volume:      k.Volume,
+			CloseTime:   k.CloseTime,
+			QuoteVolume: k.QuoteVolume,
+			Trades:      k.Trades,
+		}
+	}
+	return resp, nil
+}
+
+func (s *grpcMarketData) GetSymbol(ctx context.Context, req *proxypb.GetSymbolRequest) (*proxypb.SymbolInfo, error) {
+	symbol, err := grpcSymbol(req.GetSymbol())
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.proxy.market.ExchangeInfo(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	symbolInfo, ok := info.Symbol(symbol)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "símbolo inválido: "+symbol)
+	}
+
+	filters := symbolInfo.ParsedFilters()
+	return &proxypb.SymbolInfo{
+		Symbol:      symbolInfo.Symbol,
+		Status:      symbolInfo.Status,
+		BaseAsset:   symbolInfo.BaseAsset,
+		QuoteAsset:  symbolInfo.QuoteAsset,
+		OrderTypes:  symbolInfo.OrderTypes,
+		TickSize:    formatFloat(filters.TickSize),
+		StepSize:    formatFloat(filters.StepSize),
+		MinQty:      formatFloat(filters.MinQty),
+		MinNotional: formatFloat(filters.MinNotional),
+	}, nil
+}
+
+// StreamTickers repassa os eventos miniTicker dos símbolos pedidos. Sem
+// símbolos, usa o stream agregado de todos os tickers.
+func (s *grpcMarketData) StreamTickers(req *proxypb.StreamTickersRequest, stream grpc.ServerStreamingServer[proxypb.Ticker]) error {
+	symbols, err := grpcSymbols(req.GetSymbols())
+	if err != nil {
+		return err
+	}
+	streams := []string{miniTickerArrStream}
+	if len(symbols) > 0 {
+		streams = make([]string, len(symbols))
+		for i, symbol := range symbols {
+			streams[i] = strings.ToLower(symbol) + "@miniTicker"
+		}
+	}
+
+	sub := s.proxy.hub.SubscribeClient(streams...).Label("grpc")
+	defer sub.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-sub.Done():
+			return status.Error(codes.ResourceExhausted, "consumidor lento: o stream foi encerrado por não acompanhar as mensagens")
+		case msg := <-sub.C:
+			var tickers []miniTicker
+			if msg.Stream == miniTickerArrStream {
+				if err := json.Unmarshal(msg.Data, &tickers); err != nil {
+					continue
+				}
+			} else {
+				var ticker miniTicker
+				if err := json.Unmarshal(msg.Data, &ticker); err != nil {
+					continue
+				}
+				tickers = append(tickers, ticker)
+			}
+			for _, t := range tickers {
+				err := stream.Send(&proxypb.Ticker{
+					Symbol:      t.Symbol,
+					EventTime:   t.EventTime,
+					Open:        t.Open,
+					High:        t.High,
+					Low:         t.Low,
+					Close:       t.Close,
+					Volume:      t.Volume,
+					QuoteVolume: t.QuoteVolume,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// tradeEvent é o evento trade dos streams da Binance
+type tradeEvent struct {
+	EventType    string `json:"e"`
+	EventTime    int64  `json:"E"`
+	Symbol       string `json:"s"`
+	TradeID      int64  `json:"t"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	TradeTime    int64  `json:"T"`
+	BuyerIsMaker bool   `json:"m"`
+	Ignore       bool   `json:"M"`
+}
+
+// StreamTrades repassa os trades dos símbolos pedidos
+func (s *grpcMarketData) StreamTrades(req *proxypb.StreamTradesRequest, stream grpc.ServerStreamingServer[proxypb.Trade]) error {
+	symbols, err := grpcSymbols(req.GetSymbols())
+	if err != nil {
+		return err
+	}
+	if len(symbols) == 0 {
+		return status.Error(codes.InvalidArgument, "informe ao menos um símbolo")
+	}
+	streams := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		streams[i] = strings.ToLower(symbol) + "@trade"
+	}
+
+	sub := s.proxy.hub.SubscribeClient(streams...).Label("grpc")
+	defer sub.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-sub.Done():
+			return status.Error(codes.ResourceExhausted, "consumidor lento: o stream foi encerrado por não acompanhar as mensagens")
+		case msg := <-sub.C:
+			var trade tradeEvent
+			if err := json.Unmarshal(msg.Data, &trade); err != nil {
+				continue
+			}
+			err := stream.Send(&proxypb.Trade{
+				Symbol:       trade.Symbol,
+				TradeId:      trade.TradeID,
+				Price:        trade.Price,
+				Quantity:     trade.Quantity,
+				TradeTime:    trade.TradeTime,
+				BuyerIsMaker: trade.BuyerIsMaker,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcTenant autentica o tenant pelo metadata x-proxy-token ou authorization
+func (s *grpcTrading) grpcTenant(ctx context.Context) (*Tenant, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := ""
+	if values := md.Get("x-proxy-token"); len(values) > 0 {
+		token = values[0]
+	} else if values := md.Get("authorization"); len(values) > 0 && strings.HasPrefix(values[0], "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(values[0], "Bearer "))
+	}
+	tenant := s.proxy.tenants.Lookup(token)
+	if tenant == nil {
+		return nil, status.Error(codes.Unauthenticated, "token de tenant inválido ou ausente")
+	}
+	return tenant, nil
+}
+
+// placedOrderResult é a resposta de POST /api/v3/order (newOrderRespType=RESULT)
+type placedOrderResult struct {
+	openOrder
+	TransactTime int64 `json:"transactTime"`
+}
+
+func grpcOrder(o openOrder) *proxypb.Order {
+	return &proxypb.Order{
+		Symbol:              o.Symbol,
+		OrderId:             o.OrderID,
+		ClientOrderId:       o.ClientOrderID,
+		Price:               o.Price,
+		OrigQty:             o.OrigQty,
+		ExecutedQty:         o.ExecutedQty,
+		CummulativeQuoteQty: o.CummulativeQuoteQty,
+		Status:              o.Status,
+		TimeInForce:         o.TimeInForce,
+		Type:                o.Type,
+		Side:                o.Side,
+		StopPrice:           o.StopPrice,
+		Time:                o.Time,
+		UpdateTime:          o.UpdateTime,
+	}
+}
+
+// grpcDecimal converte um decimal em string da requisição gRPC
+func grpcDecimal(name, value string) (flexFloat, error) {
+	if value == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		return 0, status.Error(codes.InvalidArgument, name+" inválido")
+	}
+	return flexFloat(f), nil
+}
+
+func (s *grpcTrading) PlaceOrder(ctx context.Context, req *proxypb.PlaceOrderRequest) (*proxypb.Order, error) {
+	tenant, err := s.grpcTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order := orderRequest{
+		Symbol:           req.GetSymbol(),
+		Side:             req.GetSide(),
+		Type:             req.GetType(),
+		TimeInForce:      req.GetTimeInForce(),
+		NewClientOrderID: req.GetNewClientOrderId(),
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+		dst   *flexFloat
+	}{
+		{"quantity", req.GetQuantity(), &order.Quantity},
+		{"quote_order_qty", req.GetQuoteOrderQty(), &order.QuoteOrderQty},
+		{"price", req.GetPrice(), &order.Price},
+		{"stop_price", req.GetStopPrice(), &order.StopPrice},
+	} {
+		if *field.dst, err = grpcDecimal(field.name, field.value); err != nil {
+			return nil, err
+		}
+	}
+
+	info, err := s.proxy.market.ExchangeInfo(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if verr := order.normalize(info); verr != nil {
+		msg := verr.Message
+		for _, v := range verr.FilterViolations {
+			msg += "; " + v.Filter + ": " + v.Message
+		}
+		return nil, status.Error(codes.InvalidArgument, msg)
+	}
+
+	params := order.params()
+	params.Set("newOrderRespType", "RESULT")
+	body, err := s.proxy.signedRequest(ctx, tenant, http.MethodPost, "/api/v3/order", params)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	var result placedOrderResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if result.Time == 0 {
+		result.Time = result.TransactTime
+	}
+	if result.UpdateTime == 0 {
+		result.UpdateTime = result.TransactTime
+	}
+	return grpcOrder(result.openOrder), nil
+}
+
+func (s *grpcTrading) CancelOrder(ctx context.Context, req *proxypb.CancelOrderRequest) (*proxypb.Order, error) {
+	tenant, err := s.grpcTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := grpcSymbol(req.GetSymbol())
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{"symbol": {symbol}}
+	switch {
+	case req.GetOrderId() > 0:
+		params.Set("orderId", strconv.FormatInt(req.GetOrderId(), 10))
+	case req.GetOrigClientOrderId() != "":
+		params.Set("origClientOrderId", req.GetOrigClientOrderId())
+	default:
+		return nil, status.Error(codes.InvalidArgument, "informe order_id ou orig_client_order_id")
+	}
+
+	body, err := s.proxy.signedRequest(ctx, tenant, http.MethodDelete, "/api/v3/order", params)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	var result placedOrderResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	result.UpdateTime = result.TransactTime
+	return grpcOrder(result.openOrder), nil
+}
+
+func (s *grpcTrading) ListOpenOrders(ctx context.Context, req *proxypb.ListOpenOrdersRequest) (*proxypb.ListOpenOrdersResponse, error) {
+	tenant, err := s.grpcTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	symbol := ""
+	if req.GetSymbol() != "" {
+		if symbol, err = grpcSymbol(req.GetSymbol()); err != nil {
+			return nil, err
+		}
+	}
+	orders, _, err := s.proxy.tenantOpenOrders(ctx, tenant, symbol)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &proxypb.ListOpenOrdersResponse{Orders: make([]*proxypb.Order, len(orders))}
+	for i, order := range orders {
+		resp.Orders[i] = grpcOrder(order)
+	}
+	return resp, nil
+}
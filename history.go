@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	defaultHistoryRetention = 7 * 24 * time.Hour
+	defaultHistoryLimit     = 100
+	maxHistoryLimit         = 1000
+	// Registros pendentes de gravação; acima disso novos registros são descartados
+	historyQueueSize  = 4096
+	historyBatchSize  = 200
+	historyFlushEvery = 500 * time.Millisecond
+)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS requests (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	ts         INTEGER NOT NULL,
+	method     TEXT    NOT NULL,
+	path       TEXT    NOT NULL,
+	query      TEXT    NOT NULL,
+	status     INTEGER NOT NULL,
+	latency_ms REAL    NOT NULL,
+	weight     INTEGER NOT NULL,
+	tenant     TEXT    NOT NULL,
+	priority   TEXT    NOT NULL,
+	client_ip  TEXT    NOT NULL,
+	protocol   TEXT    NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS requests_ts ON requests (ts);
+CREATE INDEX IF NOT EXISTS requests_path_ts ON requests (path, ts);
+`
+
+// historyMigrations são aplicadas em bancos criados por versões anteriores;
+// o erro de coluna já existente é ignorado
+var historyMigrations = []string{
+	`ALTER TABLE requests ADD COLUMN protocol TEXT NOT NULL DEFAULT ''`,
+}
+
+// HistoryEntry é o resumo de uma requisição atendida pelo proxy
+type HistoryEntry struct {
+	ID        int64   `json:"id"`
+	Time      int64   `json:"time"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Query     string  `json:"query,omitempty"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Weight    int     `json:"weight"`
+	Tenant    string  `json:"tenant"`
+	Priority  string  `json:"priority"`
+	ClientIP  string  `json:"clientIp"`
+	Protocol  string  `json:"protocol"`
+}
+
+// requestStats acumula o peso gasto na Binance durante uma requisição do cliente
+type requestStats struct {
+	weight atomic.Int64
+}
+
+type requestStatsKey struct{}
+
+// addRequestWeight soma weight à requisição do cliente que originou a chamada
+func addRequestWeight(ctx context.Context, weight int) {
+	if stats, ok := ctx.Value(requestStatsKey{}).(*requestStats); ok {
+		stats.weight.Add(int64(weight))
+	}
+}
+
+// RequestHistory grava o resumo de cada requisição em um SQLite embutido.
+// A gravação é assíncrona e em lotes, fora do caminho da requisição.
+type RequestHistory struct {
+	db        *sql.DB
+	retention time.Duration
+	queue     chan HistoryEntry
+	dropped   atomic.Int64
+	done      chan struct{}
+}
+
+// OpenRequestHistory abre (ou cria) o banco e inicia a gravação e a limpeza
+// dos registros mais antigos que retention
+func OpenRequestHistory(path string, retention time.Duration) (*RequestHistory, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, migration := range historyMigrations {
+		db.Exec(migration)
+	}
+	h := &RequestHistory{
+		db:        db,
+		retention: retention,
+		queue:     make(chan HistoryEntry, historyQueueSize),
+		done:      make(chan struct{}),
+	}
+	go h.writer()
+	return h, nil
+}
+
+// Close grava o que estiver pendente e fecha o banco
+func (h *RequestHistory) Close() {
+	close(h.queue)
+	<-h.done
+	h.db.Close()
+}
+
+func (h *RequestHistory) writer() {
+	defer close(h.done)
+	flush := time.NewTicker(historyFlushEvery)
+	defer flush.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	h.prune()
+
+	var batch []HistoryEntry
+	for {
+		select {
+		case entry, ok := <-h.queue:
+			if !ok {
+				h.insert(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= historyBatchSize {
+				h.insert(batch)
+				batch = batch[:0]
+			}
+		case <-flush.C:
+			h.insert(batch)
+			batch = batch[:0]
+		case <-prune.C:
+			h.prune()
+		}
+	}
+}
+
+func (h *RequestHistory) insert(batch []HistoryEntry) {
+	if len(batch) == 0 {
+		return
+	}
+	tx, err := h.db.Begin()
+	if err != nil {
+		return
+	}
+	stmt, err := tx.Prepare(`INSERT INTO requests (ts, method, path, query, status, latency_ms, weight, tenant, priority, client_ip, protocol) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	defer stmt.Close()
+	for _, e := range batch {
+		if _, err := stmt.Exec(e.Time, e.Method, e.Path, e.Query, e.Status, e.LatencyMs, e.Weight, e.Tenant, e.Priority, e.ClientIP, e.Protocol); err != nil {
+			// log.Printf("[WARN] Erro ao gravar histórico: %v", err)
+		}
+	}
+	tx.Commit()
+}
+
+func (h *RequestHistory) prune() {
+	if h.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-h.retention).UnixMilli()
+	if _, err := h.db.Exec(`DELETE FROM requests WHERE ts < ?`, cutoff); err != nil {
+		// log.Printf("[WARN] Erro ao aplicar retenção do histórico: %v", err)
+	}
+}
+
+// Middleware registra cada requisição (exceto Swagger) depois de atendida
+func (h *RequestHistory) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h == nil || strings.HasPrefix(c.Request.URL.Path, "/swagger/") {
+			c.Next()
+			return
+		}
+		stats := &requestStats{}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestStatsKey{}, stats))
+		start := time.Now()
+		c.Next()
+
+		ctx := c.Request.Context()
+		tenant := consumerAnonymous
+		if name, ok := ctx.Value(consumerKey{}).(string); ok {
+			tenant = name
+		}
+		method := c.Request.Method
+		if isHeadRequest(ctx) {
+			method = http.MethodHead
+		}
+		entry := HistoryEntry{
+			Time:      start.UnixMilli(),
+			Method:    method,
+			Path:      c.Request.URL.Path,
+			Query:     redactSecrets(c.Request.URL.RawQuery),
+			Status:    c.Writer.Status(),
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			Weight:    int(stats.weight.Load()),
+			Tenant:    tenant,
+			Priority:  priorityFrom(ctx).String(),
+			ClientIP:  c.ClientIP(),
+			Protocol:  c.Request.Proto,
+		}
+		select {
+		case h.queue <- entry:
+		default:
+			h.dropped.Add(1)
+		}
+	}
+}
+
+// parseHistoryTime aceita milissegundos Unix ou RFC3339
+func parseHistoryTime(value string) (int64, bool) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UnixMilli(), true
+	}
+	return 0, false
+}
+
+// RequestHistoryQuery consulta o histórico de requisições
+// @Summary Histórico de requisições
+// @Description Consulta o histórico de requisições gravado em SQLite (HISTORY_DB), da mais recente para a mais antiga
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param path query string false "Prefixo do path (ex: /klines)"
+// @Param since query string false "Início (ms ou RFC3339)"
+// @Param until query string false "Fim (ms ou RFC3339)"
+// @Param tenant query string false "Tenant (anonymous para chamadas sem token)"
+// @Param protocol query string false "Protocolo (HTTP/1.1, HTTP/2.0)"
+// @Param status query string false "Status HTTP exato; 4xx/5xx filtram a faixa"
+// @Param minLatencyMs query number false "Latência mínima"
+// @Param limit query int false "Máximo de registros (padrão 100, máx. 1000)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/history [get]
+func (p *ProxyServer) RequestHistoryQuery(c *gin.Context) {
+	if p.history == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Histórico de requisições desabilitado (HISTORY_DB)")
+		return
+	}
+
+	var where []string
+	var args []interface{}
+	if path := c.Query("path"); path != "" {
+		where = append(where, "path LIKE ? ESCAPE '\\'")
+		args = append(args, strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(path)+"%")
+	}
+	for _, bound := range []struct{ param, op string }{{"since", ">="}, {"until", "<="}} {
+		if raw := c.Query(bound.param); raw != "" {
+			ts, ok := parseHistoryTime(raw)
+			if !ok {
+				respondError(c, http.StatusBadRequest, -1100, bound.param+" inválido (use ms ou RFC3339)")
+				return
+			}
+			where = append(where, "ts "+bound.op+" ?")
+			args = append(args, ts)
+		}
+	}
+	if tenant := c.Query("tenant"); tenant != "" {
+		where = append(where, "tenant = ?")
+		args = append(args, tenant)
+	}
+	if protocol := c.Query("protocol"); protocol != "" {
+		where = append(where, "protocol = ?")
+		args = append(args, protocol)
+	}
+	if status := strings.ToLower(c.Query("status")); status != "" {
+		if len(status) == 3 && strings.HasSuffix(status, "xx") && status[0] >= '1' && status[0] <= '5' {
+			base := int(status[0]-'0') * 100
+			where = append(where, "status >= ? AND status < ?")
+			args = append(args, base, base+100)
+		} else if code, err := strconv.Atoi(status); err == nil {
+			where = append(where, "status = ?")
+			args = append(args, code)
+		} else {
+			respondError(c, http.StatusBadRequest, -1100, "status inválido")
+			return
+		}
+	}
+	if raw := c.Query("minLatencyMs"); raw != "" {
+		latency, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, -1100, "minLatencyMs inválido")
+			return
+		}
+		where = append(where, "latency_ms >= ?")
+		args = append(args, latency)
+	}
+	limit := defaultHistoryLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, -1100, "limit inválido")
+			return
+		}
+		limit = min(n, maxHistoryLimit)
+	}
+
+	query := `SELECT id, ts, method, path, query, status, latency_ms, weight, tenant, priority, client_ip, protocol FROM requests`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY ts DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := p.history.db.QueryContext(c.Request.Context(), query, args...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao consultar histórico: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	entries := []HistoryEntry{}
+	for rows.Next() {
+		var e HistoryEntry
+		if err := rows.Scan(&e.ID, &e.Time, &e.Method, &e.Path, &e.Query, &e.Status, &e.LatencyMs, &e.Weight, &e.Tenant, &e.Priority, &e.ClientIP, &e.Protocol); err != nil {
+			respondError(c, http.StatusInternalServerError, -1000, "Erro ao ler histórico: "+err.Error())
+			return
+		}
+		entries = append(entries, e)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"count":   len(entries),
+		"dropped": p.history.dropped.Load(),
+		"entries": entries,
+	})
+}
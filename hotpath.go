@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// Valores de header fixos, compartilhados entre as respostas das rotas mais
+// chamadas: atribuí-los direto no mapa (com o nome na forma canônica) evita
+// a fatia que Header.Set aloca a cada requisição. Set e Add trocam a fatia
+// em vez de alterá-la, então quem muda o header depois não afeta as demais
+// respostas.
+var (
+	headerValueAny     = []string{"*"}
+	headerValueNoStore = []string{"no-store"}
+	headerValueJSON    = []string{"application/json"}
+
+	corsAllowMethods = []string{"GET, POST, PUT, DELETE, OPTIONS"}
+	corsAllowHeaders = []string{"Content-Type, Authorization"}
+	corsMaxAge       = []string{"3600"}
+)
+
+// smallIntHeaderValues são os valores de 0 a 59 (ex: Age do cache de respostas)
+var smallIntHeaderValues = func() [][]string {
+	values := make([][]string, 60)
+	for i := range values {
+		values[i] = []string{strconv.Itoa(i)}
+	}
+	return values
+}()
+
+// intHeaderValue é o valor de header de n, sem alocar para valores pequenos
+func intHeaderValue(n int) []string {
+	if n >= 0 && n < len(smallIntHeaderValues) {
+		return smallIntHeaderValues[n]
+	}
+	return []string{strconv.Itoa(n)}
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString acrescenta s a dst como string JSON, com o mesmo escape de
+// encoding/json (inclusive <, > e &), sem reflexão nem alocações
+func appendJSONString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
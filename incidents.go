@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Na forma canônica, para ler e escrever o header sem alocar
+	requestIDHeader = "X-Request-Id"
+	// Incidentes guardados em memória para /admin/incidents
+	maxRecentIncidents  = 100
+	incidentWebhookWait = 10 * time.Second
+)
+
+// validRequestID aceita o X-Request-ID do cliente (ou do balanceador) quando
+// ele é curto e sem caracteres que poderiam sujar logs e headers
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// Incident é o registro de um pânico num handler ou plugin
+type Incident struct {
+	RequestID string `json:"requestId"`
+	Time      int64  `json:"time"`
+	Method    string `json:"method"`
+	// Rota registrada no gin (vazia nos paths repassados à Binance)
+	Route  string `json:"route"`
+	Path   string `json:"path"`
+	Tenant string `json:"tenant"`
+	// Plugin em que o pânico começou, se foi num plugin
+	Plugin string `json:"plugin,omitempty"`
+	Panic  string `json:"panic"`
+	Stack  string `json:"stack"`
+}
+
+// pluginPanic carrega o pânico de um plugin até o middleware de recuperação,
+// com a pilha de onde ele começou
+type pluginPanic struct {
+	plugin string
+	value  interface{}
+	stack  []byte
+}
+
+func (e *pluginPanic) Error() string {
+	return fmt.Sprintf("plugin %s: %v", e.plugin, e.value)
+}
+
+// callPlugin executa um gancho de plugin identificando-o se ele entrar em pânico
+func callPlugin(name string, hook func()) {
+	defer func() {
+		if value := recover(); value != nil {
+			if value == http.ErrAbortHandler {
+				panic(value)
+			}
+			panic(&pluginPanic{plugin: name, value: value, stack: debug.Stack()})
+		}
+	}()
+	hook()
+}
+
+// IncidentReporter grava os incidentes: na saída de erro (JSON por linha),
+// em INCIDENT_LOG, no webhook de INCIDENT_WEBHOOK e em memória
+type IncidentReporter struct {
+	out     io.Writer
+	file    string
+	webhook string
+	client  *http.Client
+
+	mu     sync.Mutex
+	recent []Incident
+}
+
+// NewIncidentReporter cria o registro de incidentes; file e webhook são opcionais
+func NewIncidentReporter(out io.Writer, file, webhook string) *IncidentReporter {
+	return &IncidentReporter{out: out, file: file, webhook: webhook, client: &http.Client{Timeout: incidentWebhookWait}}
+}
+
+// Report grava o incidente em todos os destinos. Falhas de gravação não
+// afetam a resposta ao cliente.
+func (r *IncidentReporter) Report(incident Incident) {
+	line, err := json.Marshal(incident)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	r.recent = append(r.recent, incident)
+	if len(r.recent) > maxRecentIncidents {
+		r.recent = r.recent[len(r.recent)-maxRecentIncidents:]
+	}
+	if r.out != nil {
+		r.out.Write(line)
+	}
+	if r.file != "" {
+		if f, err := os.OpenFile(r.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600); err == nil {
+			f.Write(line)
+			f.Close()
+		} else {
+			// log.Printf("[WARN] Erro ao gravar incidente em %s: %v", r.file, err)
+		}
+	}
+	r.mu.Unlock()
+
+	if r.webhook != "" {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), incidentWebhookWait)
+			defer cancel()
+			if err := postWebhook(ctx, r.client, r.webhook, line); err != nil {
+				// log.Printf("[WARN] Erro ao enviar incidente ao webhook: %v", err)
+			}
+		}()
+	}
+}
+
+// Recent lista os incidentes guardados, do mais recente ao mais antigo
+func (r *IncidentReporter) Recent() []Incident {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	incidents := make([]Incident, len(r.recent))
+	for i, incident := range r.recent {
+		incidents[len(r.recent)-1-i] = incident
+	}
+	return incidents
+}
+
+// requestID usa o X-Request-ID recebido, se válido, ou gera um novo
+func requestID(c *gin.Context) string {
+	if id := c.Request.Header.Get(requestIDHeader); id != "" && validRequestID.MatchString(id) {
+		return id
+	}
+	var b [12]byte
+	var id [24]byte
+	rand.Read(b[:])
+	hex.Encode(id[:], b[:])
+	return string(id[:])
+}
+
+// isBrokenPipe indica um pânico por conexão fechada pelo cliente no meio da
+// resposta, que não é um erro do proxy
+func isBrokenPipe(value interface{}) bool {
+	err, ok := value.(error)
+	if !ok {
+		return false
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	msg := strings.ToLower(opErr.Err.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
+
+// Recovery dá um X-Request-ID a cada requisição e transforma pânicos em
+// handlers e plugins em um 500 limpo com esse ID, gravando o incidente
+// (pilha, rota, tenant) no registro de incidentes
+func (p *ProxyServer) Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := requestID(c)
+		c.Writer.Header()[requestIDHeader] = []string{id}
+		writer := c.Writer
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			// Middlewares que bufferizam a resposta (plugins, cache, delta) não
+			// chegaram a restaurar o writer original
+			c.Writer = writer
+			if value == http.ErrAbortHandler || isBrokenPipe(value) {
+				c.Abort()
+				return
+			}
+
+			incident := Incident{
+				RequestID: id,
+				Time:      time.Now().UnixMilli(),
+				Method:    c.Request.Method,
+				Route:     c.FullPath(),
+				Path:      c.Request.URL.Path,
+				Tenant:    p.consumerName(c.Request),
+			}
+			stack := debug.Stack()
+			if plugin, ok := value.(*pluginPanic); ok {
+				incident.Plugin, value, stack = plugin.plugin, plugin.value, plugin.stack
+			}
+			incident.Panic = redactSecrets(fmt.Sprint(value))
+			incident.Stack = redactSecrets(string(stack))
+			if p.incidents != nil {
+				p.incidents.Report(incident)
+			}
+
+			// Com a resposta já começada, só resta encerrá-la
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			msg := "Erro interno do proxy (request ID " + id + ")"
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": -1000, "msg": msg, "message": msg, "requestId": id})
+		}()
+		c.Next()
+	}
+}
+
+// ListIncidents lista os incidentes recentes
+// @Summary Incidentes (pânicos)
+// @Description Últimos 100 pânicos recuperados em handlers e plugins, do mais recente ao mais antigo, com request ID, rota, tenant, plugin e pilha
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/incidents [get]
+func (p *ProxyServer) ListIncidents(c *gin.Context) {
+	incidents := []Incident{}
+	if p.incidents != nil {
+		incidents = p.incidents.Recent()
+	}
+	c.JSON(http.StatusOK, gin.H{"incidents": incidents})
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	snapshotsBucket   = "snapshots"
+	defaultJobTimeout = time.Minute
+	// Execuções guardadas por job para /admin/jobs/:name/history
+	maxJobHistory = 100
+)
+
+// JobConfig é um job de JOBS_FILE: busca path periodicamente e grava o
+// resultado como snapshot
+type JobConfig struct {
+	Name     string            `yaml:"name" json:"name"`
+	Schedule string            `yaml:"schedule" json:"schedule"`
+	Path     string            `yaml:"path" json:"path"`
+	Query    map[string]string `yaml:"query" json:"query,omitempty"`
+	// Com tenant a chamada é assinada e path parte da raiz do host (/api/v3/account)
+	Tenant string `yaml:"tenant" json:"tenant,omitempty"`
+	// file (padrão) grava em Dir/<job>/; store grava no armazenamento local
+	Output string `yaml:"output" json:"output"`
+	Dir    string `yaml:"dir" json:"dir,omitempty"`
+	// Falhas seguidas até o job entrar em /admin/jobs/alerts (padrão 1)
+	AlertAfter int `yaml:"alert_after" json:"alertAfter"`
+}
+
+type jobsFile struct {
+	Jobs []JobConfig `yaml:"jobs"`
+}
+
+// JobRun é uma execução de um job
+type JobRun struct {
+	StartedAt  int64  `json:"startedAt"`
+	DurationMs int64  `json:"durationMs"`
+	Trigger    string `json:"trigger"`
+	Status     string `json:"status"`
+	Bytes      int    `json:"bytes,omitempty"`
+	Location   string `json:"location,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Job é um job carregado, com seu agendamento e histórico
+type Job struct {
+	config   JobConfig
+	schedule *cronSchedule
+
+	mu                  sync.Mutex
+	running             bool
+	nextRun             time.Time
+	history             []JobRun
+	consecutiveFailures int
+	failingSince        int64
+}
+
+// JobStatus é a visão de um job em /admin/jobs
+type JobStatus struct {
+	JobConfig
+	NextRun             int64   `json:"nextRun"`
+	Running             bool    `json:"running"`
+	LastRun             *JobRun `json:"lastRun,omitempty"`
+	ConsecutiveFailures int     `json:"consecutiveFailures"`
+}
+
+// JobAlert indica um job que falhou alert_after vezes seguidas
+type JobAlert struct {
+	Job                 string `json:"job"`
+	Since               int64  `json:"since"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	LastError           string `json:"lastError"`
+}
+
+// JobScheduler executa os jobs de snapshot agendados
+type JobScheduler struct {
+	proxy  *ProxyServer
+	jobs   []*Job
+	byName map[string]*Job
+	cancel context.CancelFunc
+}
+
+// LoadJobs lê e valida JOBS_FILE. Snapshots em arquivo vão para dataDir/snapshots
+// quando o job não define dir.
+func LoadJobs(path, dataDir string, proxy *ProxyServer) (*JobScheduler, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file jobsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+
+	s := &JobScheduler{proxy: proxy, byName: map[string]*Job{}}
+	for _, config := range file.Jobs {
+		if config.Name == "" || config.Path == "" || config.Schedule == "" {
+			return nil, fmt.Errorf("job incompleto em %s: name, schedule e path são obrigatórios", path)
+		}
+		if _, exists := s.byName[config.Name]; exists {
+			return nil, fmt.Errorf("job duplicado: %s", config.Name)
+		}
+		schedule, err := parseCron(config.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", config.Name, err)
+		}
+		switch config.Output {
+		case "":
+			config.Output = "file"
+		case "file", "store":
+		default:
+			return nil, fmt.Errorf("job %s: output deve ser file ou store", config.Name)
+		}
+		if config.Output == "file" && config.Dir == "" {
+			config.Dir = filepath.Join(dataDir, "snapshots")
+		}
+		if config.Tenant != "" && proxy.tenants.ByName(config.Tenant) == nil {
+			return nil, fmt.Errorf("job %s: tenant %s não encontrado", config.Name, config.Tenant)
+		}
+		if config.AlertAfter <= 0 {
+			config.AlertAfter = 1
+		}
+		job := &Job{config: config, schedule: schedule}
+		s.jobs = append(s.jobs, job)
+		s.byName[config.Name] = job
+	}
+	return s, nil
+}
+
+// Start agenda todos os jobs
+func (s *JobScheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	for _, job := range s.jobs {
+		go s.loop(ctx, job)
+	}
+}
+
+// Close interrompe o agendamento (execuções em andamento terminam sozinhas)
+func (s *JobScheduler) Close() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+func (s *JobScheduler) loop(ctx context.Context, job *Job) {
+	for {
+		next := job.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		job.mu.Lock()
+		job.nextRun = next
+		job.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.Run(job, "schedule")
+	}
+}
+
+// Run executa o job uma vez. Execuções sobrepostas do mesmo job são puladas.
+func (s *JobScheduler) Run(job *Job, trigger string) JobRun {
+	job.mu.Lock()
+	if job.running {
+		job.mu.Unlock()
+		return JobRun{StartedAt: time.Now().UnixMilli(), Trigger: trigger, Status: "skipped", Error: "execução anterior ainda em andamento"}
+	}
+	job.running = true
+	job.mu.Unlock()
+
+	started := time.Now()
+	run := JobRun{StartedAt: started.UnixMilli(), Trigger: trigger, Status: "ok"}
+	location, size, err := s.execute(job)
+	run.DurationMs = time.Since(started).Milliseconds()
+	run.Location, run.Bytes = location, size
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+		// log.Printf("[WARN] Job %s falhou: %v", job.config.Name, err)
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.running = false
+	job.history = append(job.history, run)
+	if len(job.history) > maxJobHistory {
+		job.history = job.history[len(job.history)-maxJobHistory:]
+	}
+	if err != nil {
+		if job.consecutiveFailures == 0 {
+			job.failingSince = run.StartedAt
+		}
+		job.consecutiveFailures++
+	} else {
+		job.consecutiveFailures = 0
+	}
+	return run
+}
+
+// execute busca o endpoint e grava o snapshot, retornando onde foi gravado.
+// Jobs usam prioridade baixa no agendador de peso e aparecem como job:<nome>
+// em /ratelimit/status.
+func (s *JobScheduler) execute(job *Job) (string, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultJobTimeout)
+	defer cancel()
+	ctx = withConsumer(withPriority(ctx, PriorityLow), "job:"+job.config.Name)
+
+	query := url.Values{}
+	for key, value := range job.config.Query {
+		query.Set(key, value)
+	}
+	var body []byte
+	var err error
+	if job.config.Tenant != "" {
+		body, err = s.proxy.signedRequest(ctx, s.proxy.tenants.ByName(job.config.Tenant), http.MethodGet, job.config.Path, query)
+	} else {
+		body, err = s.proxy.fetchUpstream(ctx, job.config.Path, query)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	if job.config.Output == "store" {
+		if s.proxy.store == nil {
+			return "", 0, fmt.Errorf("armazenamento local indisponível")
+		}
+		key := job.config.Name + "/" + stamp
+		if err := s.proxy.store.Put(snapshotsBucket, key, json.RawMessage(body)); err != nil {
+			return "", 0, err
+		}
+		return "store:" + snapshotsBucket + "/" + key, len(body), nil
+	}
+
+	dir := filepath.Join(job.config.Dir, job.config.Name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(dir, stamp+".json")
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return "", 0, err
+	}
+	return path, len(body), nil
+}
+
+func (job *Job) status() JobStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	status := JobStatus{
+		JobConfig:           job.config,
+		NextRun:             job.nextRun.UnixMilli(),
+		Running:             job.running,
+		ConsecutiveFailures: job.consecutiveFailures,
+	}
+	if len(job.history) > 0 {
+		last := job.history[len(job.history)-1]
+		status.LastRun = &last
+	}
+	return status
+}
+
+// Alerts retorna os jobs que falharam alert_after vezes seguidas
+func (s *JobScheduler) Alerts() []JobAlert {
+	alerts := []JobAlert{}
+	for _, job := range s.jobs {
+		job.mu.Lock()
+		if job.consecutiveFailures >= job.config.AlertAfter {
+			alerts = append(alerts, JobAlert{
+				Job:                 job.config.Name,
+				Since:               job.failingSince,
+				ConsecutiveFailures: job.consecutiveFailures,
+				LastError:           job.history[len(job.history)-1].Error,
+			})
+		}
+		job.mu.Unlock()
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Since < alerts[j].Since })
+	return alerts
+}
+
+// requireJobs responde 503 quando não há jobs configurados
+func (p *ProxyServer) requireJobs(c *gin.Context) bool {
+	if p.jobs == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Jobs agendados desabilitados (JOBS_FILE)")
+		return false
+	}
+	return true
+}
+
+// loadJob busca o job do path, respondendo 404 se não existir
+func (p *ProxyServer) loadJob(c *gin.Context) (*Job, bool) {
+	if !p.requireJobs(c) {
+		return nil, false
+	}
+	job, ok := p.jobs.byName[c.Param("name")]
+	if !ok {
+		respondError(c, http.StatusNotFound, -1000, "Job não encontrado")
+		return nil, false
+	}
+	return job, true
+}
+
+// ListJobs lista os jobs agendados
+// @Summary Listar jobs
+// @Description Lista os jobs de snapshot com agendamento, próxima execução, última execução e falhas seguidas
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/jobs [get]
+func (p *ProxyServer) ListJobs(c *gin.Context) {
+	if !p.requireJobs(c) {
+		return
+	}
+	jobs := make([]JobStatus, 0, len(p.jobs.jobs))
+	for _, job := range p.jobs.jobs {
+		jobs = append(jobs, job.status())
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// JobHistory retorna as últimas execuções de um job
+// @Summary Histórico do job
+// @Description Últimas execuções do job (até 100), da mais recente para a mais antiga
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param name path string true "Nome do job"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/jobs/{name}/history [get]
+func (p *ProxyServer) JobHistory(c *gin.Context) {
+	job, ok := p.loadJob(c)
+	if !ok {
+		return
+	}
+	job.mu.Lock()
+	runs := make([]JobRun, 0, len(job.history))
+	for i := len(job.history) - 1; i >= 0; i-- {
+		runs = append(runs, job.history[i])
+	}
+	job.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"job": job.config.Name, "runs": runs})
+}
+
+// RunJob executa um job imediatamente
+// @Summary Executar job
+// @Description Executa o job agora, fora do agendamento, e retorna o resultado da execução
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param name path string true "Nome do job"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/jobs/{name}/run [post]
+func (p *ProxyServer) RunJob(c *gin.Context) {
+	job, ok := p.loadJob(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, p.jobs.Run(job, "manual"))
+}
+
+// JobAlerts lista os jobs em falha
+// @Summary Alertas de jobs
+// @Description Jobs cujas últimas execuções falharam (alert_after vezes seguidas). O alerta some na próxima execução bem-sucedida.
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/jobs/alerts [get]
+func (p *ProxyServer) JobAlerts(c *gin.Context) {
+	if !p.requireJobs(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alerts": p.jobs.Alerts()})
+}
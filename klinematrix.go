@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultKlineMatrixLimit = 100
+	maxKlineMatrixSymbols   = 100
+)
+
+// klineMatrix é a resposta de /local/klines/matrix. closes[i][t] é o
+// fechamento de symbols[i] no candle openTimes[t] (null se o símbolo não
+// negociou no candle). O último candle é o atual, ainda aberto.
+type klineMatrix struct {
+	Symbols   []string     `json:"symbols"`
+	Interval  string       `json:"interval"`
+	OpenTimes []int64      `json:"openTimes"`
+	Closes    [][]*float64 `json:"closes"`
+	// Símbolos cuja busca falhou (a série deles vem toda null)
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// KlineMatrix retorna as séries de fechamento de vários símbolos alinhadas
+// @Summary Matriz de fechamentos de vários símbolos
+// @Description Séries de fechamento dos últimos candles de vários símbolos, alinhadas pelo openTime, buscadas em paralelo pelo cache de klines, com a concorrência definida pelo planejador de buscas
+// @Tags Market Data
+// @Produce json
+// @Param symbols query string true "Símbolos separados por vírgula (até 100)"
+// @Param interval query string false "Intervalo dos candles (padrão: 1h)"
+// @Param limit query int false "Candles por símbolo (padrão: 100, máximo: 1000)"
+// @Success 200 {object} klineMatrix
+// @Failure 400 {object} map[string]interface{}
+// @Router /local/klines/matrix [get]
+func (p *ProxyServer) KlineMatrix(c *gin.Context) {
+	symbols, err := normalizeSymbols(strings.Split(c.Query("symbols"), ","))
+	if err != nil || len(symbols) == 0 || len(symbols) > maxKlineMatrixSymbols {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'symbols' deve ter de 1 a "+strconv.Itoa(maxKlineMatrixSymbols)+" símbolos separados por vírgula")
+		return
+	}
+	interval := c.DefaultQuery("interval", "1h")
+	step, ok := klineIntervals[interval]
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'interval' inválido: "+interval)
+		return
+	}
+	limit := defaultKlineMatrixLimit
+	if raw := c.Query("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > klinesPageLimit {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'limit' deve ser de 1 a "+strconv.Itoa(klinesPageLimit))
+			return
+		}
+	}
+
+	// Grade comum a todos os símbolos: os limit candles até o atual. Todos
+	// pedem o mesmo startTime, então as séries saem alinhadas e a mesma
+	// consulta reaproveita o cache de klines até o próximo candle abrir.
+	stepMs := step.Milliseconds()
+	start := time.Now().UnixMilli()/stepMs*stepMs - int64(limit-1)*stepMs
+	result := &klineMatrix{
+		Symbols:   symbols,
+		Interval:  interval,
+		OpenTimes: make([]int64, limit),
+		Closes:    make([][]*float64, len(symbols)),
+	}
+	for t := range result.OpenTimes {
+		result.OpenTimes[t] = start + int64(t)*stepMs
+	}
+
+	errs := p.fetchKlineMatrix(c.Request.Context(), result, start, stepMs)
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if result.Errors == nil {
+			result.Errors = map[string]string{}
+		}
+		result.Errors[symbols[i]] = err.Error()
+	}
+	// Sem nenhuma série, o erro da Binance (ou do orçamento de peso) vale
+	// para a requisição inteira
+	if len(result.Errors) == len(symbols) {
+		respondUpstreamError(c, firstErr)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// fetchKlineMatrix busca os klines de cada símbolo pelo planejador e
+// preenche result.Closes, retornando o erro de cada símbolo
+func (p *ProxyServer) fetchKlineMatrix(ctx context.Context, result *klineMatrix, start, stepMs int64) []error {
+	limit := len(result.OpenTimes)
+	for i := range result.Closes {
+		result.Closes[i] = make([]*float64, limit)
+	}
+	weight := requestWeight(http.MethodGet, "/klines", nil)
+	return p.planner.Run(ctx, "/klines", len(result.Symbols), weight, func(ctx context.Context, i int) error {
+		klines, err := p.market.Klines(ctx, result.Symbols[i], result.Interval, limit, start, 0)
+		if err != nil {
+			return err
+		}
+		for _, k := range klines {
+			t := (k.OpenTime - start) / stepMs
+			if k.OpenTime < start || t >= int64(limit) {
+				continue
+			}
+			if price, err := strconv.ParseFloat(k.Close, 64); err == nil {
+				result.Closes[i][t] = &price
+			}
+		}
+		return nil
+	})
+}
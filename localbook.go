@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	localBookSnapshotLimit   = 1000
+	localBookReadyWait       = 5 * time.Second
+	localBookPruneInterval   = time.Second
+	defaultLocalBookIdle     = 5 * time.Minute
+	defaultLocalBookRetained = 5 * time.Minute
+)
+
+var (
+	errLocalBookIdle = errors.New("livro local sem uso")
+	errLocalBookGap  = errors.New("evento de depth fora de sequência")
+)
+
+// depthUpdateEvent é o evento do stream <symbol>@depth@100ms
+type depthUpdateEvent struct {
+	FirstUpdateID int64       `json:"U"`
+	FinalUpdateID int64       `json:"u"`
+	Bids          [][2]string `json:"b"`
+	Asks          [][2]string `json:"a"`
+}
+
+// bookLevel é um nível do livro local. Níveis removidos continuam no mapa
+// (removed) até passar a retenção, para que os diffs os incluam.
+type bookLevel struct {
+	rawPrice string
+	price    float64
+	qty      string
+	updateID int64
+	removed  bool
+}
+
+// bookUpdateMark registra quando cada update foi aplicado (para a poda)
+type bookUpdateMark struct {
+	id int64
+	at time.Time
+}
+
+// LocalBookManager mantém sob demanda um livro de ofertas local por símbolo,
+// sincronizado pelo stream de depth. Livros sem consultas por
+// LOCAL_BOOK_IDLE_TIMEOUT são encerrados.
+type LocalBookManager struct {
+	proxy     *ProxyServer
+	idle      time.Duration
+	retention time.Duration
+
+	mu    sync.Mutex
+	books map[string]*LocalBook
+}
+
+func NewLocalBookManager(proxy *ProxyServer) *LocalBookManager {
+	return &LocalBookManager{
+		proxy:     proxy,
+		idle:      getEnvDuration("LOCAL_BOOK_IDLE_TIMEOUT", defaultLocalBookIdle),
+		retention: getEnvDuration("LOCAL_BOOK_DIFF_RETENTION", defaultLocalBookRetained),
+		books:     make(map[string]*LocalBook),
+	}
+}
+
+// Get retorna o livro do símbolo, iniciando-o no primeiro uso
+func (m *LocalBookManager) Get(symbol string) *LocalBook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	book, ok := m.books[symbol]
+	if !ok {
+		book = &LocalBook{
+			manager: m,
+			symbol:  symbol,
+			ready:   make(chan struct{}),
+		}
+		m.books[symbol] = book
+		go book.run()
+	}
+	book.lastUsed = time.Now()
+	return book
+}
+
+// releaseIfIdle remove o livro se ele não foi consultado dentro do tempo de
+// inatividade. A verificação é feita sob m.mu para não concorrer com Get.
+func (m *LocalBookManager) releaseIfIdle(book *LocalBook) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(book.lastUsed) < m.idle {
+		return false
+	}
+	delete(m.books, book.symbol)
+	return true
+}
+
+// LocalBook é o livro de ofertas de um símbolo: snapshot de /depth mais os
+// eventos do stream, com o updateId da última mudança de cada nível
+type LocalBook struct {
+	manager *LocalBookManager
+	symbol  string
+	// Protegido por manager.mu
+	lastUsed time.Time
+
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	mu           sync.RWMutex
+	synced       bool
+	lastUpdateID int64
+	// Diffs a partir deste updateId estão completos (snapshot ou última poda)
+	baseUpdateID int64
+	bids         map[string]*bookLevel
+	asks         map[string]*bookLevel
+	updates      []bookUpdateMark
+}
+
+// WaitReady aguarda o primeiro snapshot, até o timeout. Retorna se o livro
+// está sincronizado com a Binance.
+func (b *LocalBook) WaitReady(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-b.ready:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.synced
+}
+
+// run mantém o livro sincronizado, refazendo o snapshot com backoff
+// exponencial quando o stream cai ou perde eventos
+func (b *LocalBook) run() {
+	backoff := streamReconnectMin
+	for {
+		connected, err := b.session()
+		// log.Printf("[WARN] Livro local de %s dessincronizado: %v", b.symbol, err)
+
+		b.mu.Lock()
+		b.synced = false
+		b.mu.Unlock()
+
+		if errors.Is(err, errLocalBookIdle) || b.manager.releaseIfIdle(b) {
+			return
+		}
+		if connected {
+			backoff = streamReconnectMin
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > streamReconnectMax {
+			backoff = streamReconnectMax
+		}
+	}
+}
+
+// session assina o stream de depth, carrega o snapshot e aplica os eventos
+// até perder a sequência ou ficar sem uso
+func (b *LocalBook) session() (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// O snapshot é carregado depois de assinar: eventos que chegarem nesse
+	// intervalo ficam no buffer da assinatura e são aplicados em seguida
+	sub := b.manager.proxy.hub.Subscribe(strings.ToLower(b.symbol) + "@depth@100ms").Label("local book")
+	defer sub.Close()
+	if err := b.loadSnapshot(ctx); err != nil {
+		return false, err
+	}
+
+	ticker := time.NewTicker(localBookPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if b.manager.releaseIfIdle(b) {
+				return true, errLocalBookIdle
+			}
+			b.prune()
+		case msg := <-sub.C:
+			var event depthUpdateEvent
+			if err := json.Unmarshal(msg.Data, &event); err != nil {
+				continue
+			}
+			if err := b.apply(event); err != nil {
+				return true, err
+			}
+		}
+	}
+}
+
+func (b *LocalBook) loadSnapshot(ctx context.Context) error {
+	query := url.Values{"symbol": {b.symbol}, "limit": {strconv.Itoa(localBookSnapshotLimit)}}
+	data, err := b.manager.proxy.fetchUpstream(ctx, "/depth", query)
+	if err != nil {
+		return err
+	}
+	var snapshot struct {
+		LastUpdateID int64       `json:"lastUpdateId"`
+		Bids         [][2]string `json:"bids"`
+		Asks         [][2]string `json:"asks"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bids = make(map[string]*bookLevel, len(snapshot.Bids))
+	b.asks = make(map[string]*bookLevel, len(snapshot.Asks))
+	for _, level := range snapshot.Bids {
+		setBookLevel(b.bids, level, snapshot.LastUpdateID)
+	}
+	for _, level := range snapshot.Asks {
+		setBookLevel(b.asks, level, snapshot.LastUpdateID)
+	}
+	b.lastUpdateID = snapshot.LastUpdateID
+	b.baseUpdateID = snapshot.LastUpdateID
+	b.updates = nil
+	b.synced = true
+	b.readyOnce.Do(func() { close(b.ready) })
+	return nil
+}
+
+// apply aplica um evento de depth, descartando os já incluídos no snapshot.
+// Um evento que não continua a sequência força um novo snapshot.
+func (b *LocalBook) apply(event depthUpdateEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if event.FinalUpdateID <= b.lastUpdateID {
+		return nil
+	}
+	if event.FirstUpdateID > b.lastUpdateID+1 {
+		return errLocalBookGap
+	}
+	for _, level := range event.Bids {
+		setBookLevel(b.bids, level, event.FinalUpdateID)
+	}
+	for _, level := range event.Asks {
+		setBookLevel(b.asks, level, event.FinalUpdateID)
+	}
+	b.lastUpdateID = event.FinalUpdateID
+	b.updates = append(b.updates, bookUpdateMark{id: event.FinalUpdateID, at: time.Now()})
+	return nil
+}
+
+// setBookLevel grava o nível [preço, quantidade]; quantidade zero o marca
+// como removido
+func setBookLevel(levels map[string]*bookLevel, raw [2]string, updateID int64) {
+	qty, err := strconv.ParseFloat(raw[1], 64)
+	if err != nil {
+		return
+	}
+	level, ok := levels[raw[0]]
+	if !ok {
+		if qty == 0 {
+			return
+		}
+		price, err := strconv.ParseFloat(raw[0], 64)
+		if err != nil {
+			return
+		}
+		level = &bookLevel{rawPrice: raw[0], price: price}
+		levels[raw[0]] = level
+	}
+	level.qty = raw[1]
+	level.updateID = updateID
+	level.removed = qty == 0
+}
+
+// prune descarta os níveis removidos há mais tempo que a retenção. Clientes
+// com updateId anterior à poda passam a receber o livro completo.
+func (b *LocalBook) prune() {
+	cutoff := time.Now().Add(-b.manager.retention)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	expired := 0
+	for expired < len(b.updates) && b.updates[expired].at.Before(cutoff) {
+		expired++
+	}
+	if expired == 0 {
+		return
+	}
+	pruneID := b.updates[expired-1].id
+	b.updates = b.updates[expired:]
+	for _, levels := range []map[string]*bookLevel{b.bids, b.asks} {
+		for key, level := range levels {
+			if level.removed && level.updateID <= pruneID {
+				delete(levels, key)
+			}
+		}
+	}
+	b.baseUpdateID = max(b.baseUpdateID, pruneID)
+}
+
+// depthDiff é a resposta de /local/depth/{symbol}/diff. Quantidade "0"
+// significa nível removido; com snapshot=true a resposta é o livro completo.
+type depthDiff struct {
+	Symbol       string      `json:"symbol"`
+	Since        int64       `json:"since"`
+	LastUpdateID int64       `json:"lastUpdateId"`
+	Snapshot     bool        `json:"snapshot"`
+	Bids         [][2]string `json:"bids"`
+	Asks         [][2]string `json:"asks"`
+}
+
+// Diff retorna os níveis alterados depois de since. Se since é anterior ao
+// que o livro ainda consegue reconstruir, retorna o livro completo.
+func (b *LocalBook) Diff(since int64) *depthDiff {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.diffLocked(since)
+}
+
+// Snapshot retorna o livro completo, se ele está sincronizado
+func (b *LocalBook) Snapshot() (*depthDiff, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.synced {
+		return nil, false
+	}
+	return b.diffLocked(-1), true
+}
+
+func (b *LocalBook) diffLocked(since int64) *depthDiff {
+	diff := &depthDiff{
+		Symbol:       b.symbol,
+		Since:        since,
+		LastUpdateID: b.lastUpdateID,
+		Snapshot:     since < b.baseUpdateID,
+	}
+	collect := func(levels map[string]*bookLevel, descending bool) [][2]string {
+		var changed []*bookLevel
+		for _, level := range levels {
+			if diff.Snapshot && !level.removed || !diff.Snapshot && level.updateID > since {
+				changed = append(changed, level)
+			}
+		}
+		sort.Slice(changed, func(i, j int) bool {
+			if descending {
+				return changed[i].price > changed[j].price
+			}
+			return changed[i].price < changed[j].price
+		})
+		out := make([][2]string, len(changed))
+		for i, level := range changed {
+			out[i] = [2]string{level.rawPrice, level.qty}
+		}
+		return out
+	}
+	diff.Bids = collect(b.bids, true)
+	diff.Asks = collect(b.asks, false)
+	return diff
+}
+
+// LocalDepthDiff retorna as mudanças do livro de ofertas desde um updateId
+// @Summary Diff do livro de ofertas
+// @Description Servido do livro local (snapshot + stream de depth): só os níveis alterados desde since, ou o livro completo quando since é antigo demais
+// @Tags Market Data
+// @Produce json
+// @Param symbol path string true "Símbolo (ex: BTCUSDT)"
+// @Param since query integer false "lastUpdateId já aplicado pelo cliente"
+// @Success 200 {object} depthDiff
+// @Failure 503 {object} map[string]interface{}
+// @Router /local/depth/{symbol}/diff [get]
+func (p *ProxyServer) LocalDepthDiff(c *gin.Context) {
+	symbols, err := normalizeSymbols([]string{c.Param("symbol")})
+	if err != nil || len(symbols) == 0 {
+		respondError(c, http.StatusBadRequest, -1100, "Símbolo inválido")
+		return
+	}
+	symbol := symbols[0]
+
+	since := int64(-1)
+	if raw := c.Query("since"); raw != "" {
+		if since, err = strconv.ParseInt(raw, 10, 64); err != nil || since < 0 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'since' deve ser um updateId")
+			return
+		}
+	}
+
+	if !p.requireKnownSymbol(c, symbol) {
+		return
+	}
+
+	book := p.books.Get(symbol)
+	if !book.WaitReady(c.Request.Context(), localBookReadyWait) {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Livro local de "+symbol+" ainda não sincronizado")
+		return
+	}
+	c.JSON(http.StatusOK, book.Diff(since))
+}
+
+// LocalDepthStream envia os diffs do livro de ofertas via WebSocket ou SSE
+// @Summary Stream de diffs do livro de ofertas
+// @Description Eventos do stream <symbol>@depth@100ms da Binance, sem alteração. Com maxRate, os diffs que chegam no intervalo são juntados em um só (U do primeiro, u do último, quantidade mais recente de cada nível), aplicável ao livro como um diff normal. Com snapshot=true, a primeira mensagem é o livro completo do livro local e as seguintes só os diffs que o continuam, num envelope com seq; se um diff se perder, um novo snapshot é enviado.
+// @Tags Market Data
+// @Produce text/event-stream
+// @Param symbol path string true "Símbolo (ex: BTCUSDT)"
+// @Param maxRate query integer false "Máximo de mensagens por segundo (1 a 1000), com conflação"
+// @Param normalize query bool false "Nomes descritivos e números no lugar dos campos curtos da Binance"
+// @Param replay query string false "Gravação (RECORDINGS_FILE) reproduzida no lugar do stream ao vivo"
+// @Param speed query string false "Velocidade do replay (ex: 1, 10x, max)"
+// @Param snapshot query bool false "Enviar o livro completo antes dos diffs, com seq"
+// @Failure 503 {object} map[string]interface{}
+// @Router /local/depth/{symbol}/stream [get]
+func (p *ProxyServer) LocalDepthStream(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+	withSnapshot, ok := wantsStreamSnapshot(c)
+	if !ok || !p.requireKnownSymbol(c, symbol) {
+		return
+	}
+
+	// Assinar antes do snapshot: os diffs que chegarem nesse intervalo ficam
+	// no buffer e os já incluídos no livro são descartados pelo u
+	sub, ok := p.subscribeStreams(c, strings.ToLower(symbol)+"@depth@100ms")
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	if !withSnapshot {
+		p.serveSubscription(c, sub, func(msg StreamMessage) (interface{}, bool) {
+			return msg.Data, true
+		})
+		return
+	}
+
+	if !p.books.Get(symbol).WaitReady(c.Request.Context(), localBookReadyWait) {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Livro local de "+symbol+" ainda não sincronizado")
+		return
+	}
+	sub.send(StreamMessage{Stream: streamSnapshotEvent})
+
+	// Último updateId entregue ao cliente; -1 até o primeiro snapshot
+	last := int64(-1)
+	resync := func() (interface{}, bool) {
+		snapshot, ok := p.books.Get(symbol).Snapshot()
+		if !ok {
+			last = -1
+			return nil, false
+		}
+		last = snapshot.LastUpdateID
+		return newStreamSnapshot(snapshot), true
+	}
+	p.serveSubscription(c, sub, func(msg StreamMessage) (interface{}, bool) {
+		if msg.Stream == streamSnapshotEvent {
+			return resync()
+		}
+		var event depthStreamEvent
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return nil, false
+		}
+		if last >= 0 && event.FinalID <= last {
+			return nil, false
+		}
+		// Diff que não continua o que o cliente tem (descartado por ser um
+		// consumidor lento, ou livro ressincronizando): recomeça do livro
+		// local, que acompanha o mesmo stream
+		if last < 0 || event.FirstID > last+1 {
+			return resync()
+		}
+		last = event.FinalID
+		return newStreamUpdate(msg.Data), true
+	})
+}
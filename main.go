@@ -6,12 +6,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	graphql "github.com/graph-gophers/graphql-go"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"gopkg.in/yaml.v3"
@@ -32,18 +35,107 @@ func min(a, b int) int {
 	return b
 }
 
+// respondError responde com o formato de erro compatível com a Binance (code/msg)
+func respondError(c *gin.Context, status, code int, msg string) {
+	// Falha causada pelo prazo do cliente (X-Request-Deadline-Ms) vira 504
+	if status >= http.StatusInternalServerError && deadlineExceeded(c.Request.Context()) {
+		respondDeadline(c)
+		return
+	}
+	c.JSON(status, errorResponse{Code: code, Message: msg, Msg: msg})
+}
+
+// errorResponse é o corpo de respondError. Os campos seguem a ordem
+// alfabética do JSON que gin.H gerava (code, message, msg), sem o mapa.
+type errorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Msg     string `json:"msg"`
+}
+
 type ProxyServer struct {
-	binanceURL string
-	client     *http.Client
+	binanceURL  string
+	client      *http.Client
+	market      *MarketCache
+	hub         *StreamHub
+	store       *Store
+	tenants     *TenantRegistry
+	conditional *ConditionalEngine
+	deferred    *DeferredQueue
+	userStreams *UserStreamManager
+	books       *LocalBookManager
+	bbo         *BBOCache
+	tape        *TapeAggregator
+	graphql     *graphql.Schema
+	wsAPIURL    string
+	symbols     *SymbolMapper
+	weights     *WeightScheduler
+	concurrency *ConcurrencyLimiter
+	planner     *FetchPlanner
+	jobs        *JobScheduler
+	backfills   *BackfillManager
+	exporter    *Exporter
+	recorder    *Recorder
+	history     *RequestHistory
+	snapshots   *MarketHistory
+	plugins     *PluginChain
+	rewrites    *ParamRewriter
+	validator   *RequestValidator
+	drift       *SchemaDriftDetector
+	upstreams   map[string]bool
+	config      *ConfigWatcher
+	cluster     *Cluster
+	warmup      *Warmup
+	withdrawals bool
+	nonces      NonceStore
+	secrets     *SecretBox
+	maxBody     int64
+	responses   *ResponseCache
+	deltas      *DeltaStore
+	polls       *PollHub
+	slos        *SLOMonitor
+	incidents   *IncidentReporter
+	prewarm     *ConnWarmer
+	maintenance *MaintenanceMonitor
+	router      *gin.Engine
+	routes      *routeMethods
+	adminToken  string
+
+	// Família de endereço e TLS das conexões HTTP e WebSocket com a Binance
+	upstreamDial *UpstreamDialPolicy
+	upstreamTLS  *UpstreamTLSPolicy
+	// Indisponibilidades da Binance (OUTAGE_WEBHOOKS); nil desliga a detecção
+	outages *OutageNotifier
 }
 
 func NewProxyServer() *ProxyServer {
-	return &ProxyServer{
+	proxy := &ProxyServer{
 		binanceURL: binanceAPIBaseURL,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		rewrites:   &ParamRewriter{rules: defaultParamRewrites},
+		weights:    NewWeightScheduler(defaultWeightLimit, defaultWeightMaxWait),
+		maxBody:    defaultMaxRequestBody,
 	}
+	proxy.upstreamDial, _ = NewUpstreamDialPolicy(ipFamilyAuto, defaultHappyEyeballsDelay)
+	proxy.upstreamTLS, _ = ParseUpstreamTLSPolicy("", "", "")
+	proxy.client = newUpstreamClient(proxy, nil)
+	proxy.planner = NewFetchPlanner(proxy.weights, nil, defaultUpstreamIdleConns, defaultPlannerMarginPct)
+	proxy.market = NewMarketCache(proxy)
+	proxy.hub = NewStreamHub(StreamHubConfig{
+		BaseURL:   binanceStreamBaseURL,
+		Dial:      proxy.upstreamDial,
+		TLS:       proxy.upstreamTLS,
+		Reconnect: defaultReconnectPolicy(),
+		Heartbeat: defaultWSHeartbeat(),
+	})
+	proxy.userStreams = NewUserStreamManager(proxy)
+	proxy.books = NewLocalBookManager(proxy)
+	proxy.bbo = NewBBOCache(proxy)
+	proxy.tape = NewTapeAggregator(proxy)
+	proxy.graphql = newGraphQLSchema(proxy)
+	proxy.wsAPIURL = binanceWSAPIURL
+	proxy.symbols, _ = LoadSymbolMapper("", proxy.market)
+	proxy.incidents = NewIncidentReporter(gin.DefaultErrorWriter, "", "")
+	return proxy
 }
 
 // ProxyRequest faz o proxy da requisição para a API da Binance
@@ -53,20 +145,14 @@ func NewProxyServer() *ProxyServer {
 // @Accept json
 // @Produce json
 // @Param path path string true "Caminho da API da Binance (ex: /ticker/24hr)"
+// @Param X-Request-Deadline-Ms header int false "Prazo total da requisição no proxy, em ms"
 // @Success 200 {object} map[string]interface{}
 // @Failure 502 {object} map[string]interface{}
+// @Failure 504 {object} deadlineResponse
 // @Router /{path} [get]
 // @Router /{path} [post]
 func (p *ProxyServer) ProxyRequest(c *gin.Context) {
-	// Tratar requisições OPTIONS (preflight CORS)
-	if c.Request.Method == "OPTIONS" {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Header("Access-Control-Max-Age", "3600")
-		c.Status(http.StatusOK)
-		return
-	}
+	// OPTIONS não chega aqui: o middleware CORS responde com o Allow da rota
 
 	// Obter o path da requisição (ex: /ticker/24hr, /klines, etc.)
 	path := c.Request.URL.Path
@@ -81,40 +167,66 @@ func (p *ProxyServer) ProxyRequest(c *gin.Context) {
 		path = "/" + path
 	}
 
-	// Construir a URL completa da Binance
-	targetURL := fmt.Sprintf("%s%s", p.binanceURL, path)
-
-	// Processar query parameters e converter symbols se necessário
+	// Processar query parameters com as regras de reescrita (symbols
+	// separado por vírgula vira array JSON, mais as de PARAM_REWRITE_FILE)
 	queryParams := c.Request.URL.Query()
-	if symbolsParam, exists := queryParams["symbols"]; exists && len(symbolsParam) > 0 {
-		// A Binance espera symbols como array JSON: ["BTCUSDT","ETHUSDT"]
-		// Mas pode vir como string separada por vírgulas: BTCUSDT,ETHUSDT
-		symbolsValue := symbolsParam[0]
-		
-		// Verificar se já está no formato JSON array
-		if !strings.HasPrefix(symbolsValue, "[") {
-			// Converter string separada por vírgulas para array JSON
-			symbolsList := strings.Split(symbolsValue, ",")
-			// Limpar espaços em branco
-			for i := range symbolsList {
-				symbolsList[i] = strings.TrimSpace(symbolsList[i])
-			}
-			// Criar array JSON
-			symbolsJSON, err := json.Marshal(symbolsList)
-			if err == nil {
-				// Substituir o valor do parâmetro
-				queryParams.Set("symbols", string(symbolsJSON))
-				// log.Printf("[DEBUG] Convertido symbols de '%s' para '%s'", symbolsValue, string(symbolsJSON))
-			} else {
-				// log.Printf("[WARN] Erro ao converter symbols para JSON: %v", err)
-			}
+
+	// Construir a URL completa da Binance (ou da URL base pedida pelo
+	// cliente, se permitida)
+	baseURL, ok := p.upstreamBase(c, queryParams)
+	if !ok {
+		return
+	}
+	targetURL := fmt.Sprintf("%s%s", baseURL, path)
+
+	// Chamadas assinadas pelo cliente seguem byte a byte: qualquer mudança
+	// na query ou no corpo invalidaria a assinatura
+	signed := isSignedRequest(c)
+	if !signed {
+		if err := p.rewrites.Apply(c.Request.Method, path, queryParams); err != nil {
+			respondError(c, http.StatusBadRequest, -1100, err.Error())
+			return
 		}
 	}
 
-	// Construir query string corrigida
-	var queryString string
-	if len(queryParams) > 0 {
-		queryString = queryParams.Encode()
+	// Validar os parâmetros contra o spec OpenAPI antes de gastar peso na Binance
+	if verr := p.validator.Validate(c.Request.Method, path, queryParams); verr != nil {
+		respondError(c, http.StatusBadRequest, verr.Code, verr.Message)
+		return
+	}
+
+	// Trades em NDJSON: pagina a Binance e envia as linhas conforme chegam
+	if pager, ok := ndjsonPagers[path]; ok && baseURL == p.binanceURL && c.Request.Method == http.MethodGet && wantsNDJSON(c) {
+		p.StreamTrades(c, path, pager, queryParams)
+		return
+	}
+
+	// Construir query string corrigida, preservando a ordem e a codificação
+	// dos parâmetros que não mudaram
+	queryString := encodeQuery(c.Request.URL.RawQuery, queryParams)
+	if signed {
+		queryString = stripRawParam(c.Request.URL.RawQuery, upstreamBaseParam)
+	}
+
+	// Corpo lido uma vez e relível (retries do cliente HTTP, assinatura)
+	reqBody, err := readBody(c)
+	if err != nil {
+		respondBodyError(c, err)
+		return
+	}
+
+	// Token de tenant com timestamp e sem assinatura: o proxy assina a
+	// chamada, inclusive os parâmetros enviados em corpo form
+	tenant, queryString, reqBody, err := p.signProxyRequest(c, baseURL, path, queryString, reqBody)
+	if err != nil {
+		if _, ok := err.(*UpstreamError); ok {
+			respondUpstreamError(c, err)
+		} else {
+			respondError(c, http.StatusBadRequest, -1100, "Corpo form inválido: "+err.Error())
+		}
+		return
+	}
+	if queryString != "" {
 		targetURL += "?" + queryString
 	}
 
@@ -127,8 +239,15 @@ func (p *ProxyServer) ProxyRequest(c *gin.Context) {
 	// 	return ""
 	// }(), targetURL)
 
-	// Criar a requisição para a Binance
-	req, err := http.NewRequest(c.Request.Method, targetURL, c.Request.Body)
+	// Criar a requisição para a Binance (HEAD segue como HEAD, ver HeadHandler)
+	method := c.Request.Method
+	head := isHeadRequest(c.Request.Context())
+	if head {
+		method = http.MethodHead
+	}
+	// Com SERVER_TIMING, as etapas da chamada vão no header Server-Timing
+	timing := serverTimingFrom(c.Request.Context())
+	req, err := http.NewRequestWithContext(timing.trace(c.Request.Context()), method, targetURL, bytes.NewReader(reqBody))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    -1000,
@@ -142,7 +261,7 @@ func (p *ProxyServer) ProxyRequest(c *gin.Context) {
 	for key, values := range c.Request.Header {
 		keyLower := strings.ToLower(key)
 		// Ignorar headers que não devem ser repassados
-		if keyLower == "host" || keyLower == "connection" || keyLower == "keep-alive" {
+		if keyLower == "host" || keyLower == "connection" || keyLower == "keep-alive" || keyLower == "x-upstream-base" || keyLower == "x-request-deadline-ms" || keyLower == "x-defer-on-outage" {
 			continue
 		}
 		// Modificar Accept-Encoding para evitar compressão desnecessária
@@ -155,6 +274,15 @@ func (p *ProxyServer) ProxyRequest(c *gin.Context) {
 		}
 	}
 
+	// Chamada assinada pelo proxy: a API key é a do tenant e as credenciais
+	// do cliente no proxy não seguem para a Binance
+	if tenant != nil {
+		req.Header.Set("X-MBX-APIKEY", tenant.APIKey)
+		for _, key := range []string{"X-Proxy-Token", "Authorization", clientTenantHeader, clientTimestampHeader, clientNonceHeader, clientSignatureHeader} {
+			req.Header.Del(key)
+		}
+	}
+
 	// Garantir que temos um User-Agent
 	if req.Header.Get("User-Agent") == "" {
 		req.Header.Set("User-Agent", "Binance-Proxy/1.0")
@@ -162,8 +290,21 @@ func (p *ProxyServer) ProxyRequest(c *gin.Context) {
 
 	// Fazer a requisição para a Binance
 	resp, err := p.client.Do(req)
+	if respondLimitError(c, err) {
+		return
+	}
 	if err != nil {
 		// log.Printf("Erro ao fazer requisição para Binance: %v", err)
+		timing.setHeader(c)
+		if deadlineExceeded(c.Request.Context()) {
+			respondDeadline(c)
+			return
+		}
+		// Escrita não urgente assinada pelo proxy que não chegou a sair: com
+		// X-Defer-On-Outage, vai para a fila em vez de falhar
+		if baseURL == p.binanceURL && p.deferRequest(c, tenant, path, queryString, reqBody, err) {
+			return
+		}
 		c.JSON(http.StatusBadGateway, gin.H{
 			"code":    -1000,
 			"msg":     fmt.Sprintf("Erro ao conectar com Binance: %v", err),
@@ -174,9 +315,14 @@ func (p *ProxyServer) ProxyRequest(c *gin.Context) {
 	defer resp.Body.Close()
 
 	// Ler o corpo da resposta
+	readStart := time.Now()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		// log.Printf("Erro ao ler resposta da Binance: %v", err)
+		if deadlineExceeded(c.Request.Context()) {
+			respondDeadline(c)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    -1001,
 			"msg":     "Erro ao ler resposta da Binance",
@@ -185,6 +331,10 @@ func (p *ProxyServer) ProxyRequest(c *gin.Context) {
 		return
 	}
 
+	timing.since("read", readStart)
+	transformStart := time.Now()
+	setDeadlineStage(c.Request.Context(), deadlineStageTransform)
+
 	// Log de debug do response
 	// log.Printf("[DEBUG] Response Status: %d %s", resp.StatusCode, resp.Status)
 
@@ -233,6 +383,12 @@ func (p *ProxyServer) ProxyRequest(c *gin.Context) {
 		// log.Printf("[DEBUG] Response Body (raw): %s", bodyStr)
 	}
 
+	// Prazo do cliente esgotado na transformação, antes de copiar os headers
+	if deadlineExceeded(c.Request.Context()) {
+		respondDeadline(c)
+		return
+	}
+
 	// Copiar headers importantes, mas remover Content-Encoding se descomprimimos
 	for key, values := range resp.Header {
 		keyLower := strings.ToLower(key)
@@ -271,11 +427,14 @@ func (p *ProxyServer) ProxyRequest(c *gin.Context) {
 	c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 	c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
-	// Definir Content-Length correto
-	if contentEncoding == "gzip" || c.Writer.Header().Get("Content-Length") == "" {
+	// Definir Content-Length correto (em HEAD, vale o informado pela Binance)
+	if !head && (contentEncoding == "gzip" || c.Writer.Header().Get("Content-Length") == "") {
 		c.Header("Content-Length", fmt.Sprintf("%d", len(bodyToSend)))
 	}
 
+	timing.since("transform", transformStart)
+	timing.setHeader(c)
+
 	// Escrever status code e body
 	c.Data(resp.StatusCode, responseContentType, bodyToSend)
 }
@@ -328,26 +487,211 @@ func (p *ProxyServer) TestConnection(c *gin.Context) {
 func setupRouter(proxy *ProxyServer) *gin.Engine {
 	// Configurar Gin
 	gin.SetMode(gin.ReleaseMode)
-	router := gin.Default()
+	router := gin.New()
+	// Pânicos viram 500 com o X-Request-ID e um registro de incidente
+	router.Use(gin.LoggerWithFormatter(accessLogFormatter), proxy.Recovery())
+
+	// Etapas das requisições repassadas no header Server-Timing
+	if getEnvBool("SERVER_TIMING", false) {
+		router.Use(ServerTiming())
+	}
+
+	// Prazo do cliente (X-Request-Deadline-Ms), antes de filas e transformações
+	router.Use(RequestDeadline())
+
+	// Assinaturas, API keys e listenKeys fora das respostas de erro
+	router.Use(RedactErrors())
+
+	// Limite do corpo das requisições (MAX_REQUEST_BODY)
+	router.Use(BodyLimit(proxy.maxBody))
+
+	// X-Upstream-Status: maintenance durante a manutenção da Binance
+	if proxy.maintenance != nil {
+		router.Use(proxy.maintenance.Middleware())
+	}
+
+	// Métodos de cada rota, preenchidos depois de registrar todas elas
+	var routes *routeMethods
 
 	// Middleware CORS
 	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Header("Access-Control-Max-Age", "3600")
+		header := c.Writer.Header()
+		header["Access-Control-Allow-Origin"] = headerValueAny
+		header["Access-Control-Allow-Methods"] = corsAllowMethods
+		header["Access-Control-Allow-Headers"] = corsAllowHeaders
+		header["Access-Control-Max-Age"] = corsMaxAge
 
+		// OPTIONS responde os métodos que a rota (ou a Binance) aceita
 		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusOK)
+			allowed := strings.Join(proxy.allowedMethods(routes, c.Request.URL.Path), ", ")
+			c.Header("Allow", allowed)
+			c.Header("Access-Control-Allow-Methods", allowed)
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
 		c.Next()
 	})
 
+	// Histórico de requisições em SQLite (HISTORY_DB)
+	if proxy.history != nil {
+		router.Use(proxy.history.Middleware())
+	}
+
+	// SLOs de latência e erro por rota (SLO_FILE)
+	if proxy.slos != nil {
+		router.Use(proxy.slos.Middleware())
+	}
+
+	// Requisições assinadas pelo cliente (X-Proxy-Signature), conferidas
+	// antes de qualquer transformação, com proteção contra replay
+	router.Use(proxy.ClientAuth(getEnvDuration("CLIENT_AUTH_WINDOW", defaultClientAuthWindow)))
+
+	// Plugins (PLUGINS_FILE), antes dos demais middlewares para que as
+	// transformações da requisição valham para todo o proxy
+	if proxy.plugins != nil {
+		router.Use(proxy.plugins.Middleware())
+	}
+
+	// Tradução de símbolos nos parâmetros e nas respostas
+	router.Use(proxy.symbols.Middleware())
+
+	// Prioridade das chamadas à Binance (header X-Priority ou do tenant)
+	router.Use(proxy.PriorityMiddleware())
+
+	// Saques: desligados por padrão, com confirmação e auditoria
+	router.Use(proxy.WithdrawGuard())
+
 	// Rotas do proxy
 	router.GET("/health", proxy.HealthCheck)
+	router.GET("/readyz", proxy.Readiness)
 	router.GET("/test", proxy.TestConnection)
+	router.GET("/ratelimit/status", proxy.RateLimitStatus)
+	router.GET("/metrics", proxy.Metrics)
+
+	// Watchlists
+	router.GET("/watchlists", proxy.ListWatchlists)
+	router.POST("/watchlists", proxy.CreateWatchlist)
+	router.GET("/watchlists/:name", proxy.GetWatchlist)
+	router.PUT("/watchlists/:name", proxy.UpdateWatchlist)
+	router.DELETE("/watchlists/:name", proxy.DeleteWatchlist)
+	router.GET("/watchlists/:name/prices", proxy.WatchlistPrices)
+	router.GET("/watchlists/:name/stream", proxy.WatchlistStream)
+
+	// Carteira
+	router.POST("/portfolio/value", proxy.PortfolioValue)
+
+	router.GET("/convert", proxy.Convert)
+
+	// Screener e rankings sobre o ticker de 24h em cache
+	router.GET("/screener", proxy.Screener)
+	router.GET("/local/top/gainers", proxy.TopSymbols("gainers"))
+	router.GET("/local/top/losers", proxy.TopSymbols("losers"))
+	router.GET("/local/top/volume", proxy.TopSymbols("volume"))
+
+	// Análises calculadas sobre os klines em cache
+	router.GET("/analytics/correlation", proxy.Correlation)
+	router.GET("/analytics/patterns/:symbol", proxy.Patterns)
+
+	// Busca de símbolos e exchangeInfo filtrado (cache)
+	router.GET("/symbols/search", proxy.SymbolSearch)
+	router.GET("/local/exchangeInfo", proxy.LocalExchangeInfo)
+	router.GET("/local/round", proxy.LocalRound)
+	router.GET("/local/klines/matrix", proxy.KlineMatrix)
+
+	// Ticker e livro em cache, ao vivo ou de um instante passado (?asOf=)
+	router.GET("/local/ticker", proxy.LocalTicker)
+	router.GET("/local/depth", proxy.LocalDepth)
+
+	// GraphQL sobre os dados de mercado em cache
+	router.GET("/graphql", proxy.GraphQL)
+	router.POST("/graphql", proxy.GraphQL)
+
+	// JSON-RPC 2.0 mapeado para chamadas da Binance
+	router.POST("/rpc", proxy.JSONRPC)
+
+	// WebSocket API da Binance (ws-api) com assinatura pelo tenant
+	router.GET("/ws-api", proxy.WSAPI)
+
+	// Endpoints locais agregados (requerem token de tenant)
+	router.GET("/local/account/summary", proxy.AccountSummary)
+	router.GET("/local/pnl", proxy.PnL)
+	router.GET("/local/trades", proxy.LocalTrades)
+	router.GET("/local/depth/:symbol/diff", proxy.LocalDepthDiff)
+	router.GET("/local/depth/:symbol/stream", proxy.LocalDepthStream)
+	router.GET("/local/bbo/:symbol", proxy.LocalBBO)
+	router.GET("/local/bbo/:symbol/stream", proxy.LocalBBOStream)
+	router.GET("/local/tape/:symbol", proxy.LocalTape)
+	router.GET("/local/tape/:symbol/stream", proxy.LocalTapeStream)
+	router.GET("/local/openOrders", proxy.LocalOpenOrders)
+	router.GET("/local/balances/stream", proxy.TenantAffinity(), proxy.BalancesStream)
+	router.GET("/local/order/estimate", proxy.OrderEstimate)
+	router.POST("/local/order/oco", proxy.OCOOrder)
+	router.POST("/local/order/batch", proxy.BatchOrders)
+
+	// Ordens condicionais emuladas (requerem token de tenant)
+	router.POST("/local/conditional", proxy.CreateConditionalOrder)
+	router.GET("/local/conditional", proxy.ListConditionalOrders)
+	router.GET("/local/conditional/:id", proxy.GetConditionalOrder)
+	router.DELETE("/local/conditional/:id", proxy.CancelConditionalOrder)
+	router.GET("/local/conditional/:id/audit", proxy.ConditionalOrderAudit)
+
+	// Escritas adiadas durante quedas da Binance (requerem token de tenant)
+	router.GET("/local/deferred", proxy.ListDeferred)
+	router.GET("/local/deferred/:id", proxy.GetDeferred)
+	router.DELETE("/local/deferred/:id", proxy.CancelDeferred)
+
+	// Long-polling de endpoints públicos
+	router.GET("/poll/*endpoint", proxy.Poll)
+
+	// Backfills retomáveis de klines e aggTrades (requer ADMIN_TOKEN)
+	backfills := router.Group("/jobs", AdminAuth(proxy.adminToken))
+	backfills.POST("", proxy.CreateBackfill)
+	backfills.GET("", proxy.ListBackfills)
+	backfills.GET("/:id", proxy.GetBackfill)
+	backfills.DELETE("/:id", proxy.DeleteBackfill)
+	backfills.GET("/:id/data", proxy.BackfillData)
+	backfills.POST("/:id/pause", proxy.PauseBackfill)
+	backfills.POST("/:id/resume", proxy.ResumeBackfill)
+
+	// Painel do hub: a página pede o token e consulta /admin/streams
+	router.GET("/admin/streams/dashboard", StreamHubDashboard)
+
+	// API admin (requer ADMIN_TOKEN)
+	admin := router.Group("/admin", AdminAuth(proxy.adminToken))
+	admin.GET("/jobs", proxy.ListJobs)
+	admin.GET("/jobs/alerts", proxy.JobAlerts)
+	admin.GET("/jobs/:name/history", proxy.JobHistory)
+	admin.POST("/jobs/:name/run", proxy.RunJob)
+	admin.GET("/exports", proxy.ListExports)
+	admin.POST("/exports/:name/run", proxy.RunExport)
+	admin.GET("/history", proxy.RequestHistoryQuery)
+	admin.GET("/plugins", proxy.ListPlugins)
+	admin.GET("/drift", proxy.SchemaDrift)
+	admin.POST("/drift/reset", proxy.ResetSchemaDrift)
+	admin.GET("/config", proxy.ConfigStatus)
+	admin.GET("/cluster", proxy.ClusterStatus)
+	admin.GET("/withdrawals", proxy.WithdrawAudit)
+	admin.GET("/vault/tenants", proxy.ListVaultTenants)
+	admin.PUT("/vault/tenants/:name", proxy.PutVaultTenant)
+	admin.DELETE("/vault/tenants/:name", proxy.DeleteVaultTenant)
+	admin.POST("/vault/encrypt", proxy.EncryptSecret)
+	admin.GET("/cache", proxy.ResponseCacheStatus)
+	admin.DELETE("/cache", proxy.PurgeResponseCache)
+	admin.POST("/bench", proxy.Bench)
+	admin.GET("/slo", proxy.SLOStatusList)
+	admin.GET("/upstreams", proxy.UpstreamStatus)
+	admin.GET("/incidents", proxy.ListIncidents)
+	admin.GET("/recordings", proxy.ListRecordings)
+	admin.GET("/recordings/:name", proxy.GetRecording)
+	admin.GET("/recordings/:name/files/:file", proxy.DownloadRecording)
+	admin.GET("/streams", proxy.StreamHubStatus)
+	admin.GET("/maintenance", proxy.MaintenanceStatusHandler)
+	admin.GET("/outages", proxy.OutageStatusHandler)
+	admin.POST("/config/reload", proxy.ReloadConfig)
+
+	// Camadas de compatibilidade com outras APIs (COMPAT_APIS)
+	registerCompatRoutes(router, proxy)
 
 	// Handler customizado para Swagger que trata doc.json internamente
 	swaggerHandler := func(c *gin.Context) {
@@ -400,13 +744,45 @@ func setupRouter(proxy *ProxyServer) *gin.Engine {
 	// Swagger UI - rota única com wildcard que trata tudo
 	router.GET("/swagger/*filepath", swaggerHandler)
 
+	// Modo multi-corretora: /<corretora>/<path> (ex: /bybit/v5/market/tickers)
+	for _, backend := range enabledExchangeBackends() {
+		router.Any("/"+backend.Name()+"/*path", proxy.ExchangeProxy(backend))
+		if backend.Name() == "futures" {
+			router.GET("/local/funding/:symbol", proxy.LocalFunding(backend))
+			router.GET("/local/sentiment/:symbol", proxy.LocalSentiment(backend))
+		}
+	}
+
 	// Proxy para todas as rotas da API da Binance (deve ser a última rota)
-	router.NoRoute(proxy.ProxyRequest)
+	router.NoRoute(proxy.deltas.Middleware(), proxy.responses.Middleware(), proxy.ProxyRequest)
 
+	routes = newRouteMethods(router.Routes())
+	proxy.router, proxy.routes = router, routes
 	return router
 }
 
 func main() {
+	// Todo log (do processo, de acesso e de pânico do gin) passa pela
+	// remoção de assinaturas, API keys, listenKeys e tokens
+	log.SetOutput(newRedactingWriter(os.Stderr))
+	gin.DefaultWriter = newRedactingWriter(os.Stdout)
+	gin.DefaultErrorWriter = newRedactingWriter(os.Stderr)
+
+	// Configuração montada como diretório (ConfigMap do Kubernetes): cada
+	// arquivo é uma variável de ambiente
+	if configDir := os.Getenv("CONFIG_DIR"); configDir != "" {
+		if err := applyConfigDir(configDir); err != nil {
+			log.Fatalf("Erro ao ler CONFIG_DIR: %v", err)
+		}
+	}
+
+	// proxy replay: reproduz tráfego gravado contra outro proxy e sai
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:], os.Stdout))
+	}
+
+	selfTestFormat, selfTest := selfTestFlag(os.Args[1:])
+
 	// Obter porta do ambiente ou usar padrão
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -419,22 +795,412 @@ func main() {
 		binanceURL = binanceAPIBaseURL
 	}
 
+	// Família de endereço (IPv4/IPv6) das conexões com a Binance
+	dialPolicy, err := NewUpstreamDialPolicy(getEnv("UPSTREAM_IP_FAMILY", ipFamilyAuto),
+		getEnvDuration("UPSTREAM_HAPPY_EYEBALLS_DELAY", defaultHappyEyeballsDelay))
+	if err != nil {
+		log.Fatalf("Configuração de conexão inválida: %v", err)
+	}
+	// TLS das conexões com a Binance: versão mínima, cipher suites e pins
+	tlsPolicy, err := ParseUpstreamTLSPolicy(os.Getenv("UPSTREAM_TLS_MIN_VERSION"), os.Getenv("UPSTREAM_TLS_CIPHER_SUITES"), os.Getenv("UPSTREAM_TLS_PINS"))
+	if err != nil {
+		log.Fatalf("Configuração TLS inválida: %v", err)
+	}
+	if err := tlsPolicy.LoadRootCAs(os.Getenv("UPSTREAM_CA_FILE")); err != nil {
+		log.Fatalf("Erro ao ler UPSTREAM_CA_FILE: %v", err)
+	}
+	if tlsPolicy.InsecureSkipVerify = getEnvBool("UPSTREAM_TLS_INSECURE_SKIP_VERIFY", false); tlsPolicy.InsecureSkipVerify {
+		log.Printf("[WARN] ==============================================================")
+		log.Printf("[WARN] UPSTREAM_TLS_INSECURE_SKIP_VERIFY=true: os certificados da Binance NÃO são verificados.")
+		log.Printf("[WARN] Qualquer um no caminho pode ler e alterar as chamadas, inclusive API keys e ordens.")
+		log.Printf("[WARN] Prefira UPSTREAM_CA_FILE com a CA do proxy de inspeção TLS.")
+		log.Printf("[WARN] ==============================================================")
+	}
+
 	proxy := &ProxyServer{
-		binanceURL: binanceURL,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
+		binanceURL:   binanceURL,
+		weights:      NewWeightScheduler(getEnvInt("WEIGHT_LIMIT", defaultWeightLimit), getEnvDuration("WEIGHT_MAX_WAIT", defaultWeightMaxWait)),
+		upstreamDial: dialPolicy,
+		upstreamTLS:  tlsPolicy,
+		// Indisponibilidades da Binance, avisadas em OUTAGE_WEBHOOKS
+		outages: NewOutageNotifier(gin.DefaultErrorWriter, os.Getenv("OUTAGE_WEBHOOKS"), getEnvInt("OUTAGE_FAILURE_THRESHOLD", defaultOutageFailureThreshold)),
+	}
+	defer proxy.outages.Close()
+
+	// Limites de chamadas simultâneas por path (ex: /exchangeInfo=2,/ticker/*=50)
+	limits, err := ParseConcurrencyLimits(os.Getenv("PATH_CONCURRENCY_LIMITS"))
+	if err != nil {
+		log.Fatalf("Erro ao ler PATH_CONCURRENCY_LIMITS: %v", err)
+	}
+	proxy.concurrency = limits
+	proxy.client = newUpstreamClient(proxy, limits)
+	// Buscas em lote: no máximo as conexões ociosas mantidas com a Binance
+	// ao mesmo tempo, deixando FETCH_PLANNER_MARGIN_PCT% de cada classe livre
+	proxy.planner = NewFetchPlanner(proxy.weights, limits,
+		getEnvInt("FETCH_PLANNER_MAX_CONNS", max(defaultUpstreamIdleConns, getEnvInt("PREWARM_CONNS", 0))),
+		getEnvInt("FETCH_PLANNER_MARGIN_PCT", defaultPlannerMarginPct))
+	proxy.weights.SetThrottle(getEnvInt("WEIGHT_THROTTLE_START_PCT", defaultThrottleStartPct),
+		getEnvDuration("WEIGHT_THROTTLE_MAX_DELAY", defaultThrottleMaxDelay))
+	proxy.market = NewMarketCache(proxy)
+	// Pings e reconexão das conexões WebSocket
+	defaultHeartbeat, defaultReconnect := defaultWSHeartbeat(), defaultReconnectPolicy()
+	reconnect := ReconnectPolicy{
+		Initial:    getEnvDuration("WS_RECONNECT_INITIAL_DELAY", defaultReconnect.Initial),
+		Max:        getEnvDuration("WS_RECONNECT_MAX_DELAY", defaultReconnect.Max),
+		JitterPct:  getEnvInt("WS_RECONNECT_JITTER_PCT", defaultReconnect.JitterPct),
+		AlertAfter: getEnvInt("WS_RECONNECT_ALERT_AFTER", defaultReconnect.AlertAfter),
+		MaxAge:     getEnvDuration("WS_UPSTREAM_MAX_AGE", defaultReconnect.MaxAge),
+	}
+	if err := reconnect.validate(); err != nil {
+		log.Fatalf("Política de reconexão inválida: %v", err)
+	}
+	proxy.hub = NewStreamHub(StreamHubConfig{
+		BaseURL: getEnv("BINANCE_STREAM_URL", binanceStreamBaseURL),
+		Dial:    proxy.upstreamDial,
+		TLS:     proxy.upstreamTLS,
+		Heartbeat: wsHeartbeat{
+			UpstreamPing:    getEnvDuration("WS_UPSTREAM_PING_INTERVAL", defaultHeartbeat.UpstreamPing),
+			UpstreamTimeout: getEnvDuration("WS_UPSTREAM_READ_TIMEOUT", defaultHeartbeat.UpstreamTimeout),
+			ClientPing:      getEnvDuration("WS_CLIENT_PING_INTERVAL", defaultHeartbeat.ClientPing),
+			ClientTimeout:   getEnvDuration("WS_CLIENT_READ_TIMEOUT", defaultHeartbeat.ClientTimeout),
 		},
+		Reconnect: reconnect,
+		Outages:   proxy.outages,
+	})
+	slow, err := ParseSlowConsumerPolicies(os.Getenv("STREAM_SLOW_CONSUMER_POLICY"), os.Getenv("STREAM_SLOW_CONSUMER_RULES"))
+	if err != nil {
+		log.Fatalf("Erro ao ler STREAM_SLOW_CONSUMER_RULES: %v", err)
+	}
+	proxy.hub.slow = slow
+	proxy.hub.eventsOut = gin.DefaultErrorWriter
+	proxy.userStreams = NewUserStreamManager(proxy)
+	proxy.books = NewLocalBookManager(proxy)
+	proxy.bbo = NewBBOCache(proxy)
+	proxy.tape = NewTapeAggregator(proxy)
+	proxy.graphql = newGraphQLSchema(proxy)
+	proxy.wsAPIURL = getEnv("BINANCE_WS_API_URL", binanceWSAPIURL)
+	proxy.adminToken = os.Getenv("ADMIN_TOKEN")
+	proxy.maxBody = int64(getEnvInt("MAX_REQUEST_BODY", defaultMaxRequestBody))
+	proxy.incidents = NewIncidentReporter(gin.DefaultErrorWriter, os.Getenv("INCIDENT_LOG"), os.Getenv("INCIDENT_WEBHOOK"))
+
+	// Cache das respostas repassadas (só as rotas de RESPONSE_CACHE_ROUTES)
+	responses, err := ParseResponseCache(os.Getenv("RESPONSE_CACHE_ROUTES"), os.Getenv("RESPONSE_CACHE_NEVER"), os.Getenv("RESPONSE_CACHE_VARY"))
+	if err != nil {
+		log.Fatalf("Erro ao ler RESPONSE_CACHE_ROUTES: %v", err)
+	}
+	proxy.responses = responses
+	proxy.deltas = NewDeltaStore(getEnvInt("DELTA_VERSIONS", defaultDeltaVersions), getEnvInt("DELTA_MAX_KEYS", defaultDeltaMaxKeys),
+		getEnvDuration("DELTA_TTL", defaultDeltaTTL))
+	proxy.polls = NewPollHub(proxy, getEnvDuration("POLL_INTERVAL", defaultPollInterval))
+	proxy.upstreams = parseUpstreamAllowlist(os.Getenv("UPSTREAM_BASE_ALLOWLIST"))
+
+	// Várias réplicas: streams e user data streams coordenados pelo Redis
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		cluster, err := NewCluster(redisURL, os.Getenv("REPLICA_ID"), os.Getenv("REPLICA_URL"), os.Getenv("CLUSTER_AFFINITY"),
+			getEnv("REDIS_KEY_PREFIX", defaultClusterKeyPrefix), getEnvDuration("CLUSTER_LEASE_TTL", defaultClusterLeaseTTL))
+		if err != nil {
+			log.Fatalf("Erro ao conectar ao Redis: %v", err)
+		}
+		proxy.cluster = cluster
+		// No autoteste a instância não entra no cluster e conecta direto
+		// aos streams
+		if !selfTest {
+			proxy.hub.cluster = cluster
+			cluster.Start()
+			defer cluster.Close()
+		}
+	}
+
+	// Abrir armazenamento local (watchlists, etc.)
+	store, err := OpenStore(filepath.Join(getEnv("DATA_DIR", defaultDataDir), "proxy.db"))
+	if err != nil {
+		// log.Printf("[WARN] Armazenamento local indisponível: %v", err)
+	} else {
+		proxy.store = store
+		defer store.Close()
+	}
+
+	// Saques só com WITHDRAW_ENABLED, confirmação por requisição e auditoria
+	// gravada; chamadas internas ao endpoint são sempre recusadas
+	proxy.withdrawals = getEnvBool("WITHDRAW_ENABLED", false)
+	if proxy.withdrawals && proxy.store == nil {
+		log.Fatalf("WITHDRAW_ENABLED requer o armazenamento local (DATA_DIR) para a auditoria de saques")
+	}
+	proxy.client.Transport = &withdrawTransport{base: proxy.client.Transport, proxy: proxy}
+
+	// Chave mestra das credenciais cifradas (enc:v1:... e cofre de tenants),
+	// retirada do ambiente depois de lida
+	secrets, err := LoadSecretBox(os.Getenv("CREDENTIALS_KEY"), os.Getenv("CREDENTIALS_KEY_FILE"))
+	if err != nil {
+		log.Fatalf("Erro ao ler a chave mestra: %v", err)
+	}
+	os.Unsetenv("CREDENTIALS_KEY")
+	proxy.secrets = secrets
+
+	// Carregar tenants (credenciais da Binance por cliente)
+	tenants, err := LoadTenants(os.Getenv("TENANTS_FILE"), secrets)
+	if err != nil {
+		log.Fatalf("Erro ao carregar tenants: %v", err)
+	}
+	proxy.tenants = tenants
+	if secrets != nil && proxy.store != nil {
+		if err := tenants.SetVault(NewTenantVault(proxy.store, secrets)); err != nil {
+			log.Fatalf("Erro ao carregar o cofre de tenants: %v", err)
+		}
+	}
+
+	// Nonces da autenticação HMAC do cliente: no Redis com várias réplicas,
+	// para que um replay não passe por outra instância
+	switch getEnv("NONCE_STORE", "") {
+	case "memory":
+		proxy.nonces = NewMemoryNonceStore()
+	case "redis":
+		if proxy.cluster == nil {
+			log.Fatalf("NONCE_STORE=redis requer REDIS_URL")
+		}
+		proxy.nonces = NewRedisNonceStore(proxy.cluster)
+	case "":
+		proxy.nonces = NewMemoryNonceStore()
+		if proxy.cluster != nil {
+			proxy.nonces = NewRedisNonceStore(proxy.cluster)
+		}
+	default:
+		log.Fatalf("NONCE_STORE inválido: %s (use memory ou redis)", os.Getenv("NONCE_STORE"))
+	}
+
+	// Tabela de tradução de símbolos (BTC-USD -> BTCUSDT, aliases de ativos)
+	symbols, err := LoadSymbolMapper(os.Getenv("SYMBOL_MAP_FILE"), proxy.market)
+	if err != nil {
+		log.Fatalf("Erro ao carregar tabela de símbolos: %v", err)
+	}
+	proxy.symbols = symbols
+
+	// --self-test: confere os caminhos críticos e sai com o relatório, sem
+	// iniciar os servidores (health gate do container, smoke test)
+	if selfTest {
+		report := proxy.RunSelfTest(getEnvDuration("SELF_TEST_TIMEOUT", defaultSelfTestTimeout), getEnv("SELF_TEST_STREAM", defaultSelfTestStream))
+		report.Write(os.Stdout, selfTestFormat)
+		if proxy.store != nil {
+			proxy.store.Close()
+		}
+		if !report.OK {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Motor de ordens condicionais (stop-loss/take-profit emulados)
+	if getEnvBool("CONDITIONAL_ORDERS_ENABLED", false) && proxy.store != nil {
+		engine, err := NewConditionalEngine(proxy)
+		if err != nil {
+			log.Fatalf("Erro ao carregar ordens condicionais: %v", err)
+		}
+		proxy.conditional = engine
+	}
+
+	// Fila de escritas adiadas enquanto a Binance está fora
+	if getEnvBool("DEFERRED_QUEUE_ENABLED", false) && proxy.store != nil {
+		deferred, err := NewDeferredQueue(proxy, proxy.store,
+			getEnvDuration("DEFERRED_RETRY_INTERVAL", defaultDeferredRetryInterval),
+			getEnvDuration("DEFERRED_MAX_AGE", defaultDeferredMaxAge))
+		if err != nil {
+			log.Fatalf("Erro ao carregar chamadas adiadas: %v", err)
+		}
+		proxy.deferred = deferred
+		deferred.Start()
+		defer deferred.Close()
+	}
+
+	// Jobs agendados de snapshot (cron)
+	if jobsFile := os.Getenv("JOBS_FILE"); jobsFile != "" {
+		jobs, err := LoadJobs(jobsFile, getEnv("DATA_DIR", defaultDataDir), proxy)
+		if err != nil {
+			log.Fatalf("Erro ao carregar jobs: %v", err)
+		}
+		proxy.jobs = jobs
+		jobs.Start()
+		defer jobs.Close()
+	}
+
+	// Gravação de streams em NDJSON com gzip
+	if recordingsFile := os.Getenv("RECORDINGS_FILE"); recordingsFile != "" {
+		recorder, err := LoadRecordings(recordingsFile, getEnv("DATA_DIR", defaultDataDir), proxy)
+		if err != nil {
+			log.Fatalf("Erro ao carregar gravações: %v", err)
+		}
+		proxy.recorder = recorder
+		recorder.Start()
+		defer recorder.Close()
+	}
+
+	// Backfills retomáveis (checkpoint no armazenamento local)
+	if proxy.store != nil {
+		backfills, err := NewBackfillManager(proxy, proxy.store, filepath.Join(getEnv("DATA_DIR", defaultDataDir), "backfills"), getEnvInt("BACKFILL_CONCURRENCY", defaultBackfillConcurrency))
+		if err != nil {
+			log.Fatalf("Erro ao carregar backfills: %v", err)
+		}
+		proxy.backfills = backfills
+		backfills.Start()
+		defer backfills.Close()
+	}
+
+	// Exportação de snapshots e auditoria para S3/GCS
+	if exportFile := os.Getenv("EXPORT_FILE"); exportFile != "" {
+		exporter, err := LoadExports(exportFile, proxy)
+		if err != nil {
+			log.Fatalf("Erro ao carregar exportações: %v", err)
+		}
+		proxy.exporter = exporter
+		exporter.Start()
+		defer exporter.Close()
+	}
+
+	// Histórico de requisições (SQLite embutido)
+	if historyDB := os.Getenv("HISTORY_DB"); historyDB != "" {
+		history, err := OpenRequestHistory(historyDB, getEnvDuration("HISTORY_RETENTION", defaultHistoryRetention))
+		if err != nil {
+			log.Fatalf("Erro ao abrir histórico de requisições: %v", err)
+		}
+		proxy.history = history
+		defer history.Close()
+	}
+
+	// Snapshots de ticker e livro para consultas com ?asOf= (SQLite embutido)
+	if marketDB := os.Getenv("MARKET_HISTORY_DB"); marketDB != "" {
+		symbols, err := normalizeSymbols(strings.Split(os.Getenv("MARKET_HISTORY_SYMBOLS"), ","))
+		if err != nil || len(symbols) == 0 {
+			log.Fatalf("MARKET_HISTORY_DB requer MARKET_HISTORY_SYMBOLS (ex: BTCUSDT,ETHUSDT)")
+		}
+		snapshots, err := OpenMarketHistory(marketDB, proxy, symbols,
+			getEnvDuration("MARKET_HISTORY_INTERVAL", defaultMarketHistoryInterval),
+			getEnvInt("MARKET_HISTORY_DEPTH", defaultMarketHistoryDepth),
+			getEnvDuration("MARKET_HISTORY_RETENTION", defaultMarketHistoryRetention))
+		if err != nil {
+			log.Fatalf("Erro ao abrir histórico de mercado: %v", err)
+		}
+		proxy.snapshots = snapshots
+		snapshots.Start()
+		defer snapshots.Close()
+	}
+
+	// SLOs por rota, com alertas de burn rate por webhook
+	if sloFile := os.Getenv("SLO_FILE"); sloFile != "" {
+		slos, err := LoadSLOs(sloFile)
+		if err != nil {
+			log.Fatalf("Erro ao carregar SLOs: %v", err)
+		}
+		proxy.slos = slos
+		slos.Start()
+		defer slos.Close()
+	}
+
+	// Manutenção programada da Binance (/sapi/v1/system/status)
+	if interval := getEnvDuration("MAINTENANCE_POLL_INTERVAL", defaultMaintenancePollInterval); interval > 0 {
+		maintenance, err := NewMaintenanceMonitor(proxy, binanceURL, os.Getenv("MAINTENANCE_ANNOUNCEMENTS_URL"), interval)
+		if err != nil {
+			log.Fatalf("Erro ao configurar o monitor de manutenção: %v", err)
+		}
+		proxy.maintenance = maintenance
+		proxy.hub.maintenance = maintenance.Active
+		if proxy.responses != nil {
+			proxy.responses.serveStale = maintenance.Active
+		}
+		maintenance.Start()
+		defer maintenance.Close()
+	}
+
+	// Conexões TLS aquecidas com a Binance, mantidas por pings periódicos
+	if conns := getEnvInt("PREWARM_CONNS", 0); conns > 0 {
+		proxy.prewarm = NewConnWarmer(proxy.client, getEnv("PREWARM_URLS", binanceURL), conns, getEnvDuration("PREWARM_INTERVAL", defaultPrewarmInterval))
+		proxy.prewarm.Start()
+		defer proxy.prewarm.Close()
+	}
+
+	// Regras de reescrita de parâmetros para a Binance
+	if rewriteFile := os.Getenv("PARAM_REWRITE_FILE"); rewriteFile != "" {
+		rewrites, err := LoadParamRewrites(rewriteFile)
+		if err != nil {
+			log.Fatalf("Erro ao carregar regras de parâmetros: %v", err)
+		}
+		proxy.rewrites = rewrites
+	}
+
+	// Validação das requisições repassadas contra o spec OpenAPI
+	if getEnvBool("OPENAPI_VALIDATION", false) {
+		validator, err := LoadRequestValidator(getEnv("OPENAPI_SPEC_FILE", defaultOpenAPISpecFile))
+		if err != nil {
+			log.Fatalf("Erro ao carregar spec OpenAPI: %v", err)
+		}
+		proxy.validator = validator
+	}
+
+	// Detecção de mudanças no formato das respostas da Binance
+	if getEnvBool("SCHEMA_DRIFT", false) {
+		// Sem o spec, só os formatos aprendidos são comparados
+		spec, _ := loadOpenAPISpec(getEnv("OPENAPI_SPEC_FILE", defaultOpenAPISpecFile))
+		proxy.drift = NewSchemaDriftDetector(proxy.store, spec, getEnvInt("SCHEMA_DRIFT_MAX_BODY", defaultDriftMaxBody))
+		proxy.client.Transport = proxy.drift.Transport(proxy.client.Transport, binanceURL)
+	}
+
+	// Plugins de requisição/resposta (registrados no binário ou arquivos .so)
+	if pluginsFile := os.Getenv("PLUGINS_FILE"); pluginsFile != "" {
+		plugins, err := LoadPlugins(pluginsFile, proxy.consumerName)
+		if err != nil {
+			log.Fatalf("Erro ao carregar plugins: %v", err)
+		}
+		proxy.plugins = plugins
+	}
+
+	// Recarga das configurações montadas sem reiniciar o processo
+	if getEnvBool("CONFIG_WATCH", false) {
+		proxy.config = proxy.watchConfig(getEnvDuration("CONFIG_WATCH_INTERVAL", defaultConfigWatchInterval))
+		proxy.config.Start()
+		defer proxy.config.Close()
+	}
+
+	// Servidor gRPC opcional, em porta separada
+	if grpcPort := os.Getenv("GRPC_PORT"); grpcPort != "" {
+		grpcServer, err := startGRPCServer(proxy, grpcPort)
+		if err != nil {
+			log.Fatalf("Erro ao iniciar servidor gRPC: %v", err)
+		}
+		defer grpcServer.GracefulStop()
+		// log.Printf("🔌 Servidor gRPC iniciado na porta %s", grpcPort)
+	}
+
+	// Gateway FIX 4.4 opcional, em porta separada
+	if fixPort := os.Getenv("FIX_PORT"); fixPort != "" {
+		fixGateway, err := startFIXGateway(proxy, fixPort, getEnv("FIX_COMP_ID", fixDefaultCompID))
+		if err != nil {
+			log.Fatalf("Erro ao iniciar gateway FIX: %v", err)
+		}
+		defer fixGateway.Close()
+		// log.Printf("🔌 Gateway FIX iniciado na porta %s", fixPort)
+	}
+
+	// Publicação multicast de top-of-book e trades na rede local
+	if group := os.Getenv("MULTICAST_ADDR"); group != "" {
+		publisher, err := startMulticastPublisher(proxy.hub, group, os.Getenv("MULTICAST_INTERFACE"),
+			getEnvInt("MULTICAST_TTL", defaultMulticastTTL), strings.Split(os.Getenv("MULTICAST_SYMBOLS"), ","))
+		if err != nil {
+			log.Fatalf("Erro ao iniciar publicação multicast: %v", err)
+		}
+		defer publisher.Close()
+		// log.Printf("📡 Publicando multicast em %s", group)
 	}
 
 	// Configurar router
 	router := setupRouter(proxy)
 
 	// Configurar servidor HTTP
-	server := &http.Server{
-		Addr:         ":" + port,
-		Handler:      router,
-		ReadTimeout:  readTimeout,
-		WriteTimeout: writeTimeout,
+	// Listeners: PORT ou os endereços de LISTENERS_FILE (TCP e sockets Unix)
+	listeners, err := LoadListeners(os.Getenv("LISTENERS_FILE"), ":"+port)
+	if err != nil {
+		log.Fatalf("Erro ao carregar listeners: %v", err)
+	}
+	// Rotas operacionais (/admin, /metrics, /debug) em porta interna separada
+	if adminPort := os.Getenv("ADMIN_PORT"); adminPort != "" {
+		listeners = withAdminListener(listeners, getEnv("ADMIN_ADDR", "127.0.0.1")+":"+adminPort)
 	}
 
 	// log.Printf("🚀 Proxy Binance iniciado na porta %s", port)
@@ -446,7 +1212,13 @@ func main() {
 	// log.Printf("   - GET  /* - Proxy para API da Binance")
 	// log.Printf("   - POST /* - Proxy para API da Binance")
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	// Aquecimento dos caches e streams antes de /readyz ficar verde
+	if getEnvBool("WARMUP", false) {
+		proxy.warmup = NewWarmup(getEnvDuration("WARMUP_TIMEOUT", defaultWarmupTimeout), strings.Split(os.Getenv("WARMUP_STREAMS"), ","))
+		proxy.warmup.Start(proxy)
+	}
+
+	if err := serveListeners(HeadHandler(router), listeners, proxy.warmup.Done()); err != nil && err != http.ErrServerClosed {
 		// log.Fatalf("Erro ao iniciar servidor: %v", err)
 	}
 }
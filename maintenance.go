@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Header das respostas enquanto a Binance está em manutenção
+	upstreamStatusHeader = "X-Upstream-Status"
+	// Intervalo das consultas a /sapi/v1/system/status (MAINTENANCE_POLL_INTERVAL)
+	defaultMaintenancePollInterval = time.Minute
+	maintenanceFetchTimeout        = 10 * time.Second
+	// Comunicados de manutenção guardados para /admin/maintenance
+	maxMaintenanceAnnouncements = 10
+)
+
+// Valor de X-Upstream-Status, compartilhado entre as respostas
+var upstreamMaintenanceValue = []string{"maintenance"}
+
+// MaintenanceAnnouncement é um comunicado da Binance sobre manutenção
+type MaintenanceAnnouncement struct {
+	Title       string `json:"title"`
+	ReleaseDate int64  `json:"releaseDate,omitempty"`
+}
+
+// MaintenanceStatus é o estado em /admin/maintenance
+type MaintenanceStatus struct {
+	Active bool `json:"active"`
+	// Início da manutenção, pela primeira consulta que a viu
+	Since int64 `json:"since,omitempty"`
+	// msg de /sapi/v1/system/status (normal ou system_maintenance)
+	Message   string `json:"message,omitempty"`
+	CheckedAt int64  `json:"checkedAt,omitempty"`
+	// Última consulta com erro; o estado anterior é mantido
+	Error         string                    `json:"error,omitempty"`
+	Announcements []MaintenanceAnnouncement `json:"announcements"`
+}
+
+// MaintenanceMonitor consulta o status do sistema da Binance e, opcionalmente,
+// a lista de comunicados. Durante a manutenção, as respostas levam
+// X-Upstream-Status: maintenance, os caches servem o que têm mesmo vencido e
+// os streams reconectam no intervalo máximo, sem alertas.
+type MaintenanceMonitor struct {
+	proxy            *ProxyServer
+	statusURL        string
+	announcementsURL string
+	interval         time.Duration
+	client           *http.Client
+
+	active atomic.Bool
+	mu     sync.Mutex
+	status MaintenanceStatus
+	cancel context.CancelFunc
+}
+
+// NewMaintenanceMonitor prepara as consultas. O status é lido em
+// /sapi/v1/system/status no host de baseURL; as duas consultas saem pelo
+// mesmo transporte das chamadas à Binance (dialer, TLS, CAs, pinning e
+// HTTPS_PROXY).
+func NewMaintenanceMonitor(proxy *ProxyServer, baseURL, announcementsURL string, interval time.Duration) (*MaintenanceMonitor, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = defaultMaintenancePollInterval
+	}
+	return &MaintenanceMonitor{
+		proxy:            proxy,
+		statusURL:        base.Scheme + "://" + base.Host + "/sapi/v1/system/status",
+		announcementsURL: announcementsURL,
+		interval:         interval,
+		client:           &http.Client{Timeout: maintenanceFetchTimeout, Transport: newUpstreamTransport(proxy.upstreamDial, proxy.upstreamTLS, proxy.outages)},
+		status:           MaintenanceStatus{Announcements: []MaintenanceAnnouncement{}},
+	}, nil
+}
+
+// Start faz a primeira consulta e segue consultando até Close
+func (m *MaintenanceMonitor) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			m.check(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close interrompe as consultas
+func (m *MaintenanceMonitor) Close() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+// Active indica se a Binance está em manutenção. Um monitor nil nunca está.
+func (m *MaintenanceMonitor) Active() bool {
+	return m != nil && m.active.Load()
+}
+
+// Status retorna o último estado consultado
+func (m *MaintenanceMonitor) Status() MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := m.status
+	status.Announcements = append([]MaintenanceAnnouncement{}, m.status.Announcements...)
+	return status
+}
+
+// check consulta o status (e os comunicados). Uma consulta com erro não muda
+// o estado: a Binance fora do ar não é, por si só, manutenção.
+func (m *MaintenanceMonitor) check(ctx context.Context) {
+	fetchCtx, cancel := context.WithTimeout(withConsumer(withPriority(ctx, PriorityLow), "maintenance"), maintenanceFetchTimeout)
+	defer cancel()
+
+	var system struct {
+		Status int    `json:"status"`
+		Msg    string `json:"msg"`
+	}
+	data, err := m.proxy.fetchURL(fetchCtx, m.statusURL, nil)
+	if err == nil {
+		err = json.Unmarshal(data, &system)
+	}
+	var announcements []MaintenanceAnnouncement
+	if m.announcementsURL != "" {
+		announcements, _ = m.fetchAnnouncements(fetchCtx)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UnixMilli()
+	m.status.CheckedAt = now
+	if announcements != nil {
+		m.status.Announcements = announcements
+	}
+	if err != nil {
+		m.status.Error = redactSecrets(err.Error())
+		return
+	}
+	m.status.Error = ""
+	m.status.Message = system.Msg
+	active := system.Status == 1
+	if active && !m.status.Active {
+		m.status.Since = now
+		m.proxy.outages.Fire(outageMaintenance, "binance", system.Msg)
+	} else if !active {
+		m.status.Since = 0
+		m.proxy.outages.Resolve(outageMaintenance, "binance")
+	}
+	m.status.Active = active
+	m.active.Store(active)
+}
+
+// fetchAnnouncements lê a lista de comunicados (MAINTENANCE_ANNOUNCEMENTS_URL)
+// no formato do CMS da Binance e fica com os que falam de manutenção
+func (m *MaintenanceMonitor) fetchAnnouncements(ctx context.Context) ([]MaintenanceAnnouncement, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.announcementsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Binance-Proxy/1.0")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &UpstreamError{StatusCode: resp.StatusCode}
+	}
+
+	type article struct {
+		Title       string `json:"title"`
+		ReleaseDate int64  `json:"releaseDate"`
+	}
+	var page struct {
+		Data struct {
+			Articles []article `json:"articles"`
+			Catalogs []struct {
+				Articles []article `json:"articles"`
+			} `json:"catalogs"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+	articles := page.Data.Articles
+	for _, catalog := range page.Data.Catalogs {
+		articles = append(articles, catalog.Articles...)
+	}
+	found := []MaintenanceAnnouncement{}
+	for _, a := range articles {
+		if strings.Contains(strings.ToLower(a.Title), "maintenance") && len(found) < maxMaintenanceAnnouncements {
+			found = append(found, MaintenanceAnnouncement{Title: a.Title, ReleaseDate: a.ReleaseDate})
+		}
+	}
+	return found, nil
+}
+
+// Middleware marca as respostas com X-Upstream-Status: maintenance durante
+// a manutenção
+func (m *MaintenanceMonitor) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.Active() {
+			c.Writer.Header()[upstreamStatusHeader] = upstreamMaintenanceValue
+		}
+		c.Next()
+	}
+}
+
+func (m *MaintenanceMonitor) writeMetrics(w *metricsWriter) {
+	active := 0.0
+	if m.Active() {
+		active = 1
+	}
+	w.family("proxy_upstream_maintenance", "gauge", "Binance em manutenção (1) ou não (0), por /sapi/v1/system/status")
+	w.sample("proxy_upstream_maintenance", active)
+}
+
+// MaintenanceStatusHandler mostra o estado de manutenção da Binance
+// @Summary Manutenção da Binance
+// @Description Último status de /sapi/v1/system/status (ativo, desde quando, mensagem, última consulta e erro) e os comunicados de manutenção de MAINTENANCE_ANNOUNCEMENTS_URL
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} MaintenanceStatus
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/maintenance [get]
+func (p *ProxyServer) MaintenanceStatusHandler(c *gin.Context) {
+	if p.maintenance == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Monitor de manutenção desabilitado (MAINTENANCE_POLL_INTERVAL=0)")
+		return
+	}
+	c.JSON(http.StatusOK, p.maintenance.Status())
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPriceCacheTTL        = 5 * time.Second
+	defaultExchangeInfoCacheTTL = time.Hour
+	defaultMarketCacheMaxBytes  = 128 << 20
+	// Os valores decodificados (mapas e structs) ocupam em média cerca do
+	// dobro do JSON de origem
+	marketValueSizeFactor = 2
+)
+
+// MarketCache mantém em memória as respostas de mercado mais usadas pelos
+// endpoints locais, evitando uma chamada à Binance por requisição de cliente.
+// O tamanho estimado das entradas fica dentro de MARKET_CACHE_MAX_BYTES: as
+// menos usadas recentemente saem para dar lugar às novas.
+type MarketCache struct {
+	proxy           *ProxyServer
+	priceTTL        time.Duration
+	exchangeInfoTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*marketCacheEntry
+	budget  *cacheBudget
+}
+
+type marketCacheEntry struct {
+	mu        sync.Mutex
+	value     interface{}
+	fetchedAt time.Time
+}
+
+// PriceTicker é o formato retornado por /ticker/price
+type PriceTicker struct {
+	Symbol string `json:"symbol"`
+	Price  string `json:"price"`
+}
+
+func NewMarketCache(proxy *ProxyServer) *MarketCache {
+	return &MarketCache{
+		proxy:           proxy,
+		priceTTL:        getEnvDuration("PRICE_CACHE_TTL", defaultPriceCacheTTL),
+		exchangeInfoTTL: getEnvDuration("EXCHANGE_INFO_CACHE_TTL", defaultExchangeInfoCacheTTL),
+		entries:         make(map[string]*marketCacheEntry),
+		budget:          newCacheBudget(int64(getEnvInt("MARKET_CACHE_MAX_BYTES", defaultMarketCacheMaxBytes))),
+	}
+}
+
+// SymbolInfo é a descrição de um símbolo em /exchangeInfo
+type SymbolInfo struct {
+	Symbol             string                   `json:"symbol"`
+	Status             string                   `json:"status"`
+	BaseAsset          string                   `json:"baseAsset"`
+	BaseAssetPrecision int                      `json:"baseAssetPrecision"`
+	QuoteAsset         string                   `json:"quoteAsset"`
+	QuotePrecision     int                      `json:"quotePrecision"`
+	OrderTypes         []string                 `json:"orderTypes"`
+	IsSpotAllowed      bool                     `json:"isSpotTradingAllowed"`
+	IsMarginAllowed    bool                     `json:"isMarginTradingAllowed"`
+	Permissions        []string                 `json:"permissions"`
+	PermissionSets     [][]string               `json:"permissionSets"`
+	Filters            []map[string]interface{} `json:"filters"`
+}
+
+// RateLimit é um limite de uso anunciado no exchangeInfo (REQUEST_WEIGHT, ORDERS...)
+type RateLimit struct {
+	RateLimitType string `json:"rateLimitType"`
+	Interval      string `json:"interval"`
+	IntervalNum   int    `json:"intervalNum"`
+	Limit         int    `json:"limit"`
+}
+
+// ExchangeInfo é a resposta de /exchangeInfo indexada por símbolo
+type ExchangeInfo struct {
+	Timezone   string       `json:"timezone"`
+	ServerTime int64        `json:"serverTime"`
+	RateLimits []RateLimit  `json:"rateLimits"`
+	Symbols    []SymbolInfo `json:"symbols"`
+
+	bySymbol map[string]*SymbolInfo
+}
+
+// Symbol retorna a descrição do símbolo, se existir
+func (e *ExchangeInfo) Symbol(symbol string) (*SymbolInfo, bool) {
+	info, ok := e.bySymbol[symbol]
+	return info, ok
+}
+
+// ExchangeInfo retorna o /exchangeInfo completo em cache (o documento é
+// grande e muda raramente)
+func (m *MarketCache) ExchangeInfo(ctx context.Context) (*ExchangeInfo, error) {
+	value, err := m.get(ctx, "/exchangeInfo", nil, m.exchangeInfoTTL, func(data []byte) (interface{}, error) {
+		var info ExchangeInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, err
+		}
+		info.bySymbol = make(map[string]*SymbolInfo, len(info.Symbols))
+		for i := range info.Symbols {
+			info.bySymbol[info.Symbols[i].Symbol] = &info.Symbols[i]
+		}
+		return &info, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*ExchangeInfo), nil
+}
+
+// get retorna o valor em cache para path+query, buscando na Binance quando expirado.
+// Requisições concorrentes para a mesma chave aguardam uma única busca upstream.
+// Se a busca falhar e houver um valor anterior, o valor antigo é servido.
+func (m *MarketCache) get(ctx context.Context, path string, query url.Values, ttl time.Duration, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	return m.getFrom(ctx, "", path, query, ttl, parse)
+}
+
+// getFrom é o get para outra URL base (vazia = API spot configurada)
+func (m *MarketCache) getFrom(ctx context.Context, baseURL, path string, query url.Values, ttl time.Duration, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	key := baseURL + path + "?" + query.Encode()
+
+	m.mu.Lock()
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &marketCacheEntry{}
+		m.entries[key] = entry
+	}
+	m.budget.touch(key)
+	m.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	// Durante a manutenção da Binance, o que há em cache é servido sem consultá-la
+	if entry.value != nil && (time.Since(entry.fetchedAt) < ttl || m.proxy.maintenance.Active()) {
+		return entry.value, nil
+	}
+
+	if baseURL == "" {
+		baseURL = m.proxy.binanceURL
+	}
+	data, err := m.proxy.fetchURL(ctx, baseURL+path, query)
+	if err == nil {
+		var value interface{}
+		value, err = parse(data)
+		if err == nil {
+			entry.value = value
+			entry.fetchedAt = time.Now()
+			m.account(key, entry, int64(len(data))*marketValueSizeFactor)
+			return value, nil
+		}
+	}
+
+	if entry.value != nil {
+		// log.Printf("[WARN] Servindo cache antigo de %s: %v", key, err)
+		return entry.value, nil
+	}
+	m.mu.Lock()
+	if m.entries[key] == entry {
+		delete(m.entries, key)
+	}
+	m.mu.Unlock()
+	return nil, err
+}
+
+// account registra o tamanho da entrada no orçamento, descartando as menos
+// usadas. Uma entrada maior que o orçamento inteiro é usada só nesta chamada.
+func (m *MarketCache) account(key string, entry *marketCacheEntry, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries[key] != entry {
+		// Já descartada enquanto era buscada
+		return
+	}
+	evicted, ok := m.budget.set(key, size)
+	for _, old := range evicted {
+		delete(m.entries, old)
+	}
+	if !ok {
+		delete(m.entries, key)
+	}
+}
+
+// Usage retorna o tamanho e as remoções do cache
+func (m *MarketCache) Usage() cacheUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.budget.usage("market")
+}
+
+// Prices retorna o preço atual de todos os símbolos, indexado por símbolo
+func (m *MarketCache) Prices(ctx context.Context) (map[string]float64, error) {
+	value, err := m.get(ctx, "/ticker/price", nil, m.priceTTL, func(data []byte) (interface{}, error) {
+		var tickers []PriceTicker
+		if err := json.Unmarshal(data, &tickers); err != nil {
+			return nil, err
+		}
+		prices := make(map[string]float64, len(tickers))
+		for _, t := range tickers {
+			if price, err := strconv.ParseFloat(t.Price, 64); err == nil {
+				prices[t.Symbol] = price
+			}
+		}
+		return prices, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(map[string]float64), nil
+}
+
+// formatFloat formata um valor numérico sem notação científica
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9]{2,20}$`)
+
+// normalizeSymbols converte os símbolos para maiúsculas, remove duplicados e
+// valida o formato aceito pela Binance
+func normalizeSymbols(symbols []string) ([]string, error) {
+	seen := make(map[string]bool, len(symbols))
+	normalized := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if symbol == "" || seen[symbol] {
+			continue
+		}
+		if !symbolPattern.MatchString(symbol) {
+			return nil, fmt.Errorf("símbolo inválido: %q", symbol)
+		}
+		seen[symbol] = true
+		normalized = append(normalized, symbol)
+	}
+	return normalized, nil
+}
+
+// flexFloat aceita valores numéricos em JSON tanto como número quanto como
+// string ("1.5"), o formato usado pela própria Binance
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	value, err := strconv.ParseFloat(strings.Trim(string(data), `"`), 64)
+	if err != nil {
+		return fmt.Errorf("número inválido: %s", data)
+	}
+	*f = flexFloat(value)
+	return nil
+}
+
+// OrderBook é a resposta de /depth com os níveis já convertidos para float
+type OrderBook struct {
+	LastUpdateID int64
+	Bids         [][2]float64
+	Asks         [][2]float64
+}
+
+// Depth retorna o livro de ofertas do símbolo com cache curto (1s)
+func (m *MarketCache) Depth(ctx context.Context, symbol string, limit int) (*OrderBook, error) {
+	query := url.Values{"symbol": {symbol}, "limit": {strconv.Itoa(limit)}}
+	value, err := m.get(ctx, "/depth", query, time.Second, func(data []byte) (interface{}, error) {
+		var raw struct {
+			LastUpdateID int64       `json:"lastUpdateId"`
+			Bids         [][2]string `json:"bids"`
+			Asks         [][2]string `json:"asks"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		return &OrderBook{
+			LastUpdateID: raw.LastUpdateID,
+			Bids:         parseBookLevels(raw.Bids),
+			Asks:         parseBookLevels(raw.Asks),
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*OrderBook), nil
+}
+
+// parseBookLevels converte níveis [preço, quantidade] de string para float
+func parseBookLevels(levels [][2]string) [][2]float64 {
+	parsed := make([][2]float64, 0, len(levels))
+	for _, level := range levels {
+		price, errPrice := strconv.ParseFloat(level[0], 64)
+		qty, errQty := strconv.ParseFloat(level[1], 64)
+		if errPrice == nil && errQty == nil {
+			parsed = append(parsed, [2]float64{price, qty})
+		}
+	}
+	return parsed
+}
+
+// BookTicker é o melhor preço de compra/venda de um símbolo (/ticker/bookTicker)
+type BookTicker struct {
+	Symbol   string `json:"symbol"`
+	BidPrice string `json:"bidPrice"`
+	BidQty   string `json:"bidQty"`
+	AskPrice string `json:"askPrice"`
+	AskQty   string `json:"askQty"`
+}
+
+// bookQuote é o melhor bid/ask já convertido para float
+type bookQuote struct {
+	Bid float64
+	Ask float64
+}
+
+// BookTickers retorna o melhor bid/ask de todos os símbolos, indexado por símbolo
+func (m *MarketCache) BookTickers(ctx context.Context) (map[string]bookQuote, error) {
+	value, err := m.get(ctx, "/ticker/bookTicker", nil, m.priceTTL, func(data []byte) (interface{}, error) {
+		var tickers []BookTicker
+		if err := json.Unmarshal(data, &tickers); err != nil {
+			return nil, err
+		}
+		books := make(map[string]bookQuote, len(tickers))
+		for _, t := range tickers {
+			bid, errBid := strconv.ParseFloat(t.BidPrice, 64)
+			ask, errAsk := strconv.ParseFloat(t.AskPrice, 64)
+			if errBid == nil && errAsk == nil {
+				books[t.Symbol] = bookQuote{Bid: bid, Ask: ask}
+			}
+		}
+		return books, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(map[string]bookQuote), nil
+}
+
+// Kline é um candle de /klines com os campos nomeados
+type Kline struct {
+	OpenTime    int64  `json:"openTime"`
+	Open        string `json:"open"`
+	High        string `json:"high"`
+	Low         string `json:"low"`
+	Close       string `json:"close"`
+	Volume      string `json:"volume"`
+	CloseTime   int64  `json:"closeTime"`
+	QuoteVolume string `json:"quoteVolume"`
+	Trades      int64  `json:"trades"`
+}
+
+// Klines retorna candles do símbolo com cache curto (mesma validade dos preços).
+// startTime/endTime são opcionais (0 = não informado).
+func (m *MarketCache) Klines(ctx context.Context, symbol, interval string, limit int, startTime, endTime int64) ([]Kline, error) {
+	query := url.Values{"symbol": {symbol}, "interval": {interval}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if startTime > 0 {
+		query.Set("startTime", strconv.FormatInt(startTime, 10))
+	}
+	if endTime > 0 {
+		query.Set("endTime", strconv.FormatInt(endTime, 10))
+	}
+	value, err := m.get(ctx, "/klines", query, m.priceTTL, func(data []byte) (interface{}, error) {
+		var rows [][]interface{}
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, err
+		}
+		klines := make([]Kline, 0, len(rows))
+		for _, row := range rows {
+			if len(row) < 9 {
+				continue
+			}
+			str := func(i int) string { s, _ := row[i].(string); return s }
+			num := func(i int) int64 { f, _ := row[i].(float64); return int64(f) }
+			klines = append(klines, Kline{
+				OpenTime:    num(0),
+				Open:        str(1),
+				High:        str(2),
+				Low:         str(3),
+				Close:       str(4),
+				Volume:      str(5),
+				CloseTime:   num(6),
+				QuoteVolume: str(7),
+				Trades:      num(8),
+			})
+		}
+		return klines, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]Kline), nil
+}
+
+// Ticker24h é a estatística de 24h de um símbolo (/ticker/24hr)
+type Ticker24h struct {
+	Symbol             string `json:"symbol"`
+	PriceChange        string `json:"priceChange"`
+	PriceChangePercent string `json:"priceChangePercent"`
+	WeightedAvgPrice   string `json:"weightedAvgPrice"`
+	LastPrice          string `json:"lastPrice"`
+	LastQty            string `json:"lastQty"`
+	BidPrice           string `json:"bidPrice"`
+	BidQty             string `json:"bidQty"`
+	AskPrice           string `json:"askPrice"`
+	AskQty             string `json:"askQty"`
+	OpenPrice          string `json:"openPrice"`
+	HighPrice          string `json:"highPrice"`
+	LowPrice           string `json:"lowPrice"`
+	Volume             string `json:"volume"`
+	QuoteVolume        string `json:"quoteVolume"`
+	OpenTime           int64  `json:"openTime"`
+	CloseTime          int64  `json:"closeTime"`
+	LastID             int64  `json:"lastId"`
+	Count              int64  `json:"count"`
+}
+
+// Tickers24h retorna as estatísticas de 24h de todos os símbolos, indexadas por símbolo
+func (m *MarketCache) Tickers24h(ctx context.Context) (map[string]*Ticker24h, error) {
+	value, err := m.get(ctx, "/ticker/24hr", nil, m.priceTTL, func(data []byte) (interface{}, error) {
+		var tickers []Ticker24h
+		if err := json.Unmarshal(data, &tickers); err != nil {
+			return nil, err
+		}
+		bySymbol := make(map[string]*Ticker24h, len(tickers))
+		for i := range tickers {
+			bySymbol[tickers[i].Symbol] = &tickers[i]
+		}
+		return bySymbol, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(map[string]*Ticker24h), nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMarketHistoryInterval  = time.Minute
+	defaultMarketHistoryRetention = 30 * 24 * time.Hour
+	// Níveis gravados por lado do livro
+	defaultMarketHistoryDepth = 100
+	defaultLocalDepthLimit    = 100
+	marketHistoryTimeout      = 30 * time.Second
+
+	snapshotKindTicker = "ticker"
+	snapshotKindDepth  = "depth"
+
+	snapshotTimeHeader = "X-Snapshot-Time"
+)
+
+const marketHistorySchema = `
+CREATE TABLE IF NOT EXISTS market_snapshots (
+	kind   TEXT    NOT NULL,
+	symbol TEXT    NOT NULL,
+	ts     INTEGER NOT NULL,
+	data   BLOB    NOT NULL,
+	PRIMARY KEY (kind, symbol, ts)
+);
+`
+
+// depthSnapshot é o livro de /local/depth, no formato do /depth da Binance
+type depthSnapshot struct {
+	LastUpdateID int64       `json:"lastUpdateId"`
+	Bids         [][2]string `json:"bids"`
+	Asks         [][2]string `json:"asks"`
+}
+
+func newDepthSnapshot(book *OrderBook, limit int) *depthSnapshot {
+	levels := func(book [][2]float64) [][2]string {
+		out := make([][2]string, 0, min(limit, len(book)))
+		for _, level := range book[:min(limit, len(book))] {
+			out = append(out, [2]string{formatFloat(level[0]), formatFloat(level[1])})
+		}
+		return out
+	}
+	return &depthSnapshot{LastUpdateID: book.LastUpdateID, Bids: levels(book.Bids), Asks: levels(book.Asks)}
+}
+
+var errNoSnapshot = errors.New("nenhum snapshot gravado")
+
+// MarketHistory grava periodicamente o ticker de 24h e o livro de ofertas
+// dos símbolos de MARKET_HISTORY_SYMBOLS em SQLite, para que /local/ticker e
+// /local/depth respondam com o estado de um instante passado (?asOf=)
+type MarketHistory struct {
+	db        *sql.DB
+	proxy     *ProxyServer
+	symbols   []string
+	interval  time.Duration
+	depth     int
+	retention time.Duration
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// OpenMarketHistory abre (ou cria) o banco de snapshots de mercado
+func OpenMarketHistory(path string, proxy *ProxyServer, symbols []string, interval time.Duration, depth int, retention time.Duration) (*MarketHistory, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(marketHistorySchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &MarketHistory{
+		db:        db,
+		proxy:     proxy,
+		symbols:   symbols,
+		interval:  interval,
+		depth:     depth,
+		retention: retention,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Start passa a gravar um snapshot a cada intervalo
+func (h *MarketHistory) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	go func() {
+		defer close(h.done)
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		prune := time.NewTicker(time.Hour)
+		defer prune.Stop()
+		h.prune()
+		h.record(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.record(ctx)
+			case <-prune.C:
+				h.prune()
+			}
+		}
+	}()
+}
+
+// Close interrompe a gravação e fecha o banco
+func (h *MarketHistory) Close() {
+	if h.cancel != nil {
+		h.cancel()
+		<-h.done
+	}
+	h.db.Close()
+}
+
+// record grava o ticker e o livro de cada símbolo, pelo cache de mercado e
+// com prioridade baixa no agendador de peso
+func (h *MarketHistory) record(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(withConsumer(withPriority(ctx, PriorityLow), "market-history"), marketHistoryTimeout)
+	defer cancel()
+	now := time.Now().UnixMilli()
+
+	tickers, err := h.proxy.market.Tickers24h(ctx)
+	if err != nil {
+		// log.Printf("[WARN] Erro ao gravar snapshot de tickers: %v", err)
+	}
+	for _, symbol := range h.symbols {
+		if ticker, ok := tickers[symbol]; ok {
+			h.insert(snapshotKindTicker, symbol, now, ticker)
+		}
+		book, err := h.proxy.market.Depth(ctx, symbol, h.depth)
+		if err != nil {
+			// log.Printf("[WARN] Erro ao gravar snapshot do livro de %s: %v", symbol, err)
+			continue
+		}
+		h.insert(snapshotKindDepth, symbol, now, newDepthSnapshot(book, h.depth))
+	}
+}
+
+func (h *MarketHistory) insert(kind, symbol string, ts int64, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	if _, err := h.db.Exec(`INSERT OR REPLACE INTO market_snapshots (kind, symbol, ts, data) VALUES (?, ?, ?, ?)`, kind, symbol, ts, data); err != nil {
+		// log.Printf("[WARN] Erro ao gravar snapshot de mercado: %v", err)
+	}
+}
+
+func (h *MarketHistory) prune() {
+	if h.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-h.retention).UnixMilli()
+	if _, err := h.db.Exec(`DELETE FROM market_snapshots WHERE ts < ?`, cutoff); err != nil {
+		// log.Printf("[WARN] Erro ao aplicar retenção dos snapshots de mercado: %v", err)
+	}
+}
+
+// Lookup retorna o snapshot mais próximo de asOf ou, com before, o último
+// gravado até asOf (sem olhar o futuro, como num backtest)
+func (h *MarketHistory) Lookup(ctx context.Context, kind, symbol string, asOf int64, before bool) (int64, []byte, error) {
+	var ts int64
+	var data []byte
+	err := h.db.QueryRowContext(ctx, `SELECT ts, data FROM market_snapshots WHERE kind = ? AND symbol = ? AND ts <= ? ORDER BY ts DESC LIMIT 1`, kind, symbol, asOf).Scan(&ts, &data)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, nil, err
+	}
+	if before {
+		if err == sql.ErrNoRows {
+			return 0, nil, errNoSnapshot
+		}
+		return ts, data, nil
+	}
+
+	var nextTs int64
+	var next []byte
+	errNext := h.db.QueryRowContext(ctx, `SELECT ts, data FROM market_snapshots WHERE kind = ? AND symbol = ? AND ts > ? ORDER BY ts ASC LIMIT 1`, kind, symbol, asOf).Scan(&nextTs, &next)
+	if errNext != nil && errNext != sql.ErrNoRows {
+		return 0, nil, errNext
+	}
+	switch {
+	case err == sql.ErrNoRows && errNext == sql.ErrNoRows:
+		return 0, nil, errNoSnapshot
+	case err == sql.ErrNoRows, errNext == nil && nextTs-asOf < asOf-ts:
+		return nextTs, next, nil
+	}
+	return ts, data, nil
+}
+
+// serveSnapshot responde com o snapshot de ?asOf=, se pedido. Retorna false
+// quando a requisição é pela versão ao vivo.
+func (p *ProxyServer) serveSnapshot(c *gin.Context, kind, symbol string, trim func([]byte) ([]byte, error)) bool {
+	raw, ok := c.GetQuery("asOf")
+	if !ok {
+		return false
+	}
+	if p.snapshots == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Histórico de mercado desabilitado (MARKET_HISTORY_DB)")
+		return true
+	}
+	asOf, ok := parseHistoryTime(raw)
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'asOf' inválido (use ms ou RFC3339)")
+		return true
+	}
+	var before bool
+	switch c.DefaultQuery("asOfMatch", "nearest") {
+	case "nearest":
+	case "before":
+		before = true
+	default:
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'asOfMatch' deve ser nearest ou before")
+		return true
+	}
+
+	ts, data, err := p.snapshots.Lookup(c.Request.Context(), kind, symbol, asOf, before)
+	if errors.Is(err, errNoSnapshot) {
+		respondError(c, http.StatusNotFound, -1121, "Sem snapshot de "+symbol+" gravado para esse instante (MARKET_HISTORY_SYMBOLS)")
+		return true
+	}
+	if err == nil && trim != nil {
+		data, err = trim(data)
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao ler o histórico de mercado: "+err.Error())
+		return true
+	}
+	c.Header(snapshotTimeHeader, strconv.FormatInt(ts, 10))
+	c.Data(http.StatusOK, "application/json", data)
+	return true
+}
+
+// LocalTicker retorna o ticker de 24h do símbolo, ao vivo ou de um instante passado
+// @Summary Ticker de 24h (ao vivo ou histórico)
+// @Description Ticker de 24h do símbolo a partir do cache, no formato do /ticker/24hr. Com asOf (e MARKET_HISTORY_DB), responde o snapshot gravado mais próximo do instante, indicado no header X-Snapshot-Time.
+// @Tags Market Data
+// @Produce json
+// @Param symbol query string true "Símbolo (ex: BTCUSDT)"
+// @Param asOf query string false "Instante (ms ou RFC3339)"
+// @Param asOfMatch query string false "nearest (padrão) ou before (último snapshot até asOf)"
+// @Success 200 {object} Ticker24h
+// @Failure 404 {object} map[string]interface{}
+// @Router /local/ticker [get]
+func (p *ProxyServer) LocalTicker(c *gin.Context) {
+	symbol := strings.ToUpper(c.Query("symbol"))
+	if symbol == "" {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetro obrigatório 'symbol' ausente")
+		return
+	}
+	if p.serveSnapshot(c, snapshotKindTicker, symbol, nil) {
+		return
+	}
+	tickers, err := p.market.Tickers24h(c.Request.Context())
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	ticker, ok := tickers[symbol]
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1121, "Invalid symbol.")
+		return
+	}
+	c.JSON(http.StatusOK, ticker)
+}
+
+// LocalDepth retorna o livro de ofertas do símbolo, ao vivo ou de um instante passado
+// @Summary Livro de ofertas (ao vivo ou histórico)
+// @Description Livro de ofertas do símbolo a partir do cache, no formato do /depth. Com asOf (e MARKET_HISTORY_DB), responde o snapshot gravado mais próximo do instante (até MARKET_HISTORY_DEPTH níveis), indicado no header X-Snapshot-Time.
+// @Tags Market Data
+// @Produce json
+// @Param symbol query string true "Símbolo (ex: BTCUSDT)"
+// @Param limit query int false "Níveis por lado (padrão: 100)"
+// @Param asOf query string false "Instante (ms ou RFC3339)"
+// @Param asOfMatch query string false "nearest (padrão) ou before (último snapshot até asOf)"
+// @Success 200 {object} depthSnapshot
+// @Failure 404 {object} map[string]interface{}
+// @Router /local/depth [get]
+func (p *ProxyServer) LocalDepth(c *gin.Context) {
+	symbol := strings.ToUpper(c.Query("symbol"))
+	if symbol == "" {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetro obrigatório 'symbol' ausente")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLocalDepthLimit)))
+	if err != nil || limit < 1 || limit > 5000 {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'limit' deve estar entre 1 e 5000")
+		return
+	}
+	trim := func(data []byte) ([]byte, error) {
+		var book depthSnapshot
+		if err := json.Unmarshal(data, &book); err != nil {
+			return nil, err
+		}
+		book.Bids, book.Asks = book.Bids[:min(limit, len(book.Bids))], book.Asks[:min(limit, len(book.Asks))]
+		return json.Marshal(&book)
+	}
+	if p.serveSnapshot(c, snapshotKindDepth, symbol, trim) {
+		return
+	}
+	book, err := p.market.Depth(c.Request.Context(), symbol, limit)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newDepthSnapshot(book, limit))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultProxyMethods são os métodos aceitos em paths da Binance que o spec
+// não descreve
+var defaultProxyMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}
+
+// methodOrder ordena os métodos no header Allow
+var methodOrder = map[string]int{
+	http.MethodGet: 0, http.MethodHead: 1, http.MethodPost: 2, http.MethodPut: 3,
+	http.MethodPatch: 4, http.MethodDelete: 5, http.MethodOptions: 6,
+}
+
+// routeMethods indexa os métodos de cada rota local do gin, para que OPTIONS
+// responda o que a rota realmente aceita
+type routeMethods struct {
+	routes []routePattern
+}
+
+type routePattern struct {
+	segments []string
+	methods  map[string]bool
+}
+
+func newRouteMethods(routes gin.RoutesInfo) *routeMethods {
+	index := map[string]*routePattern{}
+	r := &routeMethods{}
+	for _, route := range routes {
+		if _, ok := methodOrder[route.Method]; !ok {
+			continue
+		}
+		pattern, ok := index[route.Path]
+		if !ok {
+			pattern = &routePattern{segments: strings.Split(strings.Trim(route.Path, "/"), "/"), methods: map[string]bool{}}
+			index[route.Path] = pattern
+		}
+		pattern.methods[route.Method] = true
+	}
+	for _, pattern := range index {
+		r.routes = append(r.routes, *pattern)
+	}
+	return r
+}
+
+// Lookup retorna os métodos da rota local que atende o path. Segmentos
+// fixos têm precedência sobre :param e *wildcard, como no roteador do gin.
+func (r *routeMethods) Lookup(path string) (map[string]bool, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	best, bestScore := -1, -1
+	for i, route := range r.routes {
+		if score, ok := route.match(segments); ok && score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return nil, false
+	}
+	return r.routes[best].methods, true
+}
+
+// match confere os segmentos do path; o score conta os segmentos fixos
+func (p routePattern) match(segments []string) (int, bool) {
+	score := 0
+	for i, segment := range p.segments {
+		if strings.HasPrefix(segment, "*") {
+			return score, true
+		}
+		if i >= len(segments) {
+			return 0, false
+		}
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			if segments[i] == "" {
+				return 0, false
+			}
+		case segment == segments[i]:
+			score++
+		default:
+			return 0, false
+		}
+	}
+	return score, len(segments) == len(p.segments)
+}
+
+// allowedMethods lista os métodos aceitos no path: os da rota local ou, nos
+// paths repassados à Binance, os do spec OpenAPI. GET implica HEAD.
+func (p *ProxyServer) allowedMethods(routes *routeMethods, path string) []string {
+	methods := map[string]bool{}
+	if local, ok := routes.Lookup(path); ok {
+		for method := range local {
+			methods[method] = true
+		}
+	} else if spec := p.validator.Methods(strings.TrimPrefix(path, "/api")); len(spec) > 0 {
+		for _, method := range spec {
+			methods[method] = true
+		}
+	} else {
+		for _, method := range defaultProxyMethods {
+			methods[method] = true
+		}
+	}
+	if methods[http.MethodGet] {
+		methods[http.MethodHead] = true
+	}
+	methods[http.MethodOptions] = true
+
+	list := make([]string, 0, len(methods))
+	for method := range methods {
+		list = append(list, method)
+	}
+	sort.Slice(list, func(i, j int) bool { return methodOrder[list[i]] < methodOrder[list[j]] })
+	return list
+}
+
+// headRequestKey marca no contexto uma requisição HEAD atendida como GET
+type headRequestKey struct{}
+
+// isHeadRequest indica se o cliente pediu HEAD (ver HeadHandler)
+func isHeadRequest(ctx context.Context) bool {
+	head, _ := ctx.Value(headRequestKey{}).(bool)
+	return head
+}
+
+// HeadHandler atende HEAD pelas rotas GET: a requisição segue como GET e o
+// net/http descarta o corpo, mantendo os mesmos headers. O proxy repassa à
+// Binance como HEAD (isHeadRequest). Streams são encerrados no primeiro
+// flush, quando os headers já foram enviados.
+func HeadHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithCancel(context.WithValue(r.Context(), headRequestKey{}, true))
+		defer cancel()
+		r = r.Clone(ctx)
+		r.Method = http.MethodGet
+		next.ServeHTTP(&headWriter{ResponseWriter: w, cancel: cancel}, r)
+	})
+}
+
+type headWriter struct {
+	http.ResponseWriter
+	cancel context.CancelFunc
+}
+
+func (w *headWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	w.cancel()
+}
+
+func (w *headWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOptionsAllowPerRoute(t *testing.T) {
+	p := NewProxyServer()
+	router := setupRouter(p)
+
+	for path, want := range map[string]string{
+		"/health":           "GET, HEAD, OPTIONS",
+		"/watchlists/minha": "GET, HEAD, PUT, DELETE, OPTIONS",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, path, nil))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("OPTIONS %s: status %d, esperado 204", path, w.Code)
+		}
+		if got := w.Header().Get("Allow"); got != want {
+			t.Errorf("OPTIONS %s: Allow %q, esperado %q", path, got, want)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Methods"); got != want {
+			t.Errorf("OPTIONS %s: Access-Control-Allow-Methods %q, esperado %q", path, got, want)
+		}
+	}
+
+	// Paths repassados à Binance seguem o mesmo Allow de allowedMethods
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/api/v3/someUndocumentedPath", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("OPTIONS em path repassado: status %d, esperado 204", w.Code)
+	}
+	if got, want := w.Header().Get("Allow"), "GET, HEAD, POST, PUT, DELETE, OPTIONS"; got != want {
+		t.Errorf("OPTIONS em path repassado: Allow %q, esperado %q", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsWriter escreve métricas no formato texto do Prometheus
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+// family abre uma família de métricas (HELP e TYPE)
+func (m *metricsWriter) family(name, kind, help string) {
+	m.buf.WriteString("# HELP " + name + " " + help + "\n")
+	m.buf.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// sample escreve uma amostra; labels são pares nome, valor
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.buf.WriteString(name)
+	if len(labels) > 0 {
+		m.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.buf.WriteByte(',')
+			}
+			m.buf.WriteString(labels[i] + `="` + metricLabelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		m.buf.WriteByte('}')
+	}
+	m.buf.WriteByte(' ')
+	switch {
+	case math.IsInf(value, 1):
+		m.buf.WriteString("+Inf")
+	case math.IsInf(value, -1):
+		m.buf.WriteString("-Inf")
+	default:
+		m.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	m.buf.WriteByte('\n')
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Metrics expõe as métricas do proxy para o Prometheus
+// @Summary Métricas (Prometheus)
+// @Description Métricas no formato texto do Prometheus: latência e erros das chamadas à Binance por espelho, conexões abertas por família (IPv4/IPv6), vencimento e trocas dos certificados TLS, memória e remoções LRU dos caches, mensagens descartadas e desconexões de clientes lentos dos streams, reconexões e estado das conexões com a Binance, manutenção e indisponibilidades ativas da Binance e conformidade, orçamento de erro e burn rate dos SLOs de SLO_FILE. Rota operacional: com ADMIN_PORT, fica só na porta interna.
+// @Tags Admin
+// @Produce plain
+// @Success 200 {string} string
+// @Router /metrics [get]
+func (p *ProxyServer) Metrics(c *gin.Context) {
+	m := &metricsWriter{}
+	mirrorMetrics.writeMetrics(m)
+	p.upstreamDial.writeMetrics(m)
+	p.upstreamTLS.writeMetrics(m)
+	caches := []cacheUsage{p.market.Usage()}
+	if p.responses != nil {
+		caches = append(caches, p.responses.Usage())
+	}
+	writeCacheMetrics(m, caches)
+	p.hub.slow.writeMetrics(m)
+	p.hub.writeMetrics(m)
+	if p.maintenance != nil {
+		p.maintenance.writeMetrics(m)
+	}
+	if p.outages != nil {
+		p.outages.writeMetrics(m)
+	}
+	if p.slos != nil {
+		p.slos.writeMetrics(m)
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", m.buf.Bytes())
+}
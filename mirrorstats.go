@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limites (em segundos) dos buckets do histograma de latência da Binance
+var mirrorLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Minutos cobertos pela visão recente de /admin/upstreams
+const mirrorRecentMinutes = 5
+
+// Tipos de erro contados por espelho
+const (
+	mirrorErrorTimeout = "timeout"
+	mirrorErrorNetwork = "network"
+	mirrorError5xx     = "5xx"
+	mirrorError429     = "429"
+	mirrorError418     = "418"
+)
+
+// mirrorHistogram conta as respostas por bucket de latência
+type mirrorHistogram struct {
+	buckets []int64
+	count   int64
+	sum     float64
+}
+
+func (h *mirrorHistogram) observe(seconds float64) {
+	if h.buckets == nil {
+		h.buckets = make([]int64, len(mirrorLatencyBuckets))
+	}
+	for i, bound := range mirrorLatencyBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// quantile estima o quantil pelo limite do bucket em que ele cai (o último
+// limite quando passa de todos)
+func (h *mirrorHistogram) quantile(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := max(int64(q*float64(h.count)+0.5), 1)
+	for i, n := range h.buckets {
+		if n >= rank {
+			return mirrorLatencyBuckets[i]
+		}
+	}
+	return mirrorLatencyBuckets[len(mirrorLatencyBuckets)-1]
+}
+
+// mirrorMinute são as chamadas de um espelho num minuto
+type mirrorMinute struct {
+	minute int64
+	ok     mirrorHistogram
+	failed mirrorHistogram
+	errors map[string]int64
+}
+
+// mirrorStats acumula as chamadas de um espelho: histogramas desde o início
+// do processo (para o Prometheus) e por minuto (visão recente)
+type mirrorStats struct {
+	ok, failed mirrorHistogram
+	errors     map[string]int64
+	recent     [mirrorRecentMinutes]mirrorMinute
+}
+
+// MirrorMetrics mede a latência e os erros das chamadas HTTP por espelho
+// da Binance (api, api1..api4, gcp) ou host de destino
+type MirrorMetrics struct {
+	mu      sync.Mutex
+	mirrors map[string]*mirrorStats
+}
+
+// mirrorMetrics registra todas as chamadas do cliente da Binance
+var mirrorMetrics = &MirrorMetrics{mirrors: map[string]*mirrorStats{}}
+
+// mirrorName identifica o espelho pelo host: api1.binance.com vira api1,
+// api-gcp.binance.com vira gcp; outros hosts aparecem como estão
+func mirrorName(host string) string {
+	hostname := strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = h
+	}
+	if name, ok := strings.CutSuffix(hostname, ".binance.com"); ok && !strings.Contains(name, ".") {
+		return strings.TrimPrefix(name, "api-")
+	}
+	return hostname
+}
+
+// mirrorErrorKind classifica a chamada; vazio quando ela não é um erro
+func mirrorErrorKind(resp *http.Response, err error) string {
+	var netErr net.Error
+	switch {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return mirrorErrorTimeout
+	case errors.Is(err, context.Canceled):
+		// O cliente desistiu: não diz nada sobre o espelho
+		return ""
+	default:
+		return mirrorErrorNetwork
+	}
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return mirrorError5xx
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return mirrorError429
+	case resp.StatusCode == http.StatusTeapot:
+		return mirrorError418
+	}
+	return ""
+}
+
+// Observe registra uma chamada ao host
+func (m *MirrorMetrics) Observe(host string, elapsed time.Duration, kind string) {
+	name := mirrorName(host)
+	minute := time.Now().Unix() / 60
+	seconds := elapsed.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats, ok := m.mirrors[name]
+	if !ok {
+		stats = &mirrorStats{errors: map[string]int64{}}
+		m.mirrors[name] = stats
+	}
+	recent := &stats.recent[minute%mirrorRecentMinutes]
+	if recent.minute != minute {
+		*recent = mirrorMinute{minute: minute, errors: map[string]int64{}}
+	}
+	if kind == "" {
+		stats.ok.observe(seconds)
+		recent.ok.observe(seconds)
+		return
+	}
+	stats.failed.observe(seconds)
+	recent.failed.observe(seconds)
+	stats.errors[kind]++
+	recent.errors[kind]++
+}
+
+// mirrorTransport mede cada chamada até a chegada dos headers da resposta
+type mirrorTransport struct {
+	base    http.RoundTripper
+	metrics *MirrorMetrics
+	// Falhas seguidas, 429 e 418 viram eventos de indisponibilidade
+	outages *OutageNotifier
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if kind := mirrorErrorKind(resp, err); kind != "" || err == nil {
+		t.metrics.Observe(req.URL.Host, time.Since(start), kind)
+		t.outages.observeUpstream(req.URL.Host, resp, kind)
+	}
+	return resp, err
+}
+
+// MirrorStatus é a visão de um espelho em /admin/upstreams
+type MirrorStatus struct {
+	Mirror   string           `json:"mirror"`
+	Requests int64            `json:"requests"`
+	Errors   map[string]int64 `json:"errors"`
+	// Fração das chamadas com erro
+	ErrorRate float64 `json:"errorRate"`
+	// Limites do bucket do histograma em que cai cada quantil
+	P50Ms float64 `json:"p50Ms"`
+	P90Ms float64 `json:"p90Ms"`
+	P99Ms float64 `json:"p99Ms"`
+}
+
+func newMirrorStatus(name string, ok, failed *mirrorHistogram, kinds map[string]int64) MirrorStatus {
+	all := mirrorHistogram{buckets: make([]int64, len(mirrorLatencyBuckets)), count: ok.count + failed.count}
+	for i := range all.buckets {
+		if ok.buckets != nil {
+			all.buckets[i] += ok.buckets[i]
+		}
+		if failed.buckets != nil {
+			all.buckets[i] += failed.buckets[i]
+		}
+	}
+	s := MirrorStatus{Mirror: name, Requests: all.count, Errors: map[string]int64{},
+		P50Ms: all.quantile(0.50) * 1000, P90Ms: all.quantile(0.90) * 1000, P99Ms: all.quantile(0.99) * 1000}
+	for kind, n := range kinds {
+		s.Errors[kind] = n
+	}
+	if all.count > 0 {
+		s.ErrorRate = roundRatio(float64(failed.count) / float64(all.count))
+	}
+	return s
+}
+
+// Status resume cada espelho nos últimos minutos e desde o início
+func (m *MirrorMetrics) Status() (recent, total []MirrorStatus) {
+	minute := time.Now().Unix() / 60
+	recent, total = []MirrorStatus{}, []MirrorStatus{}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.names() {
+		stats := m.mirrors[name]
+		var ok, failed mirrorHistogram
+		kinds := map[string]int64{}
+		for _, slot := range stats.recent {
+			if minute-slot.minute >= mirrorRecentMinutes {
+				continue
+			}
+			for _, part := range []struct{ from, to *mirrorHistogram }{{&slot.ok, &ok}, {&slot.failed, &failed}} {
+				for i, n := range part.from.buckets {
+					if part.to.buckets == nil {
+						part.to.buckets = make([]int64, len(mirrorLatencyBuckets))
+					}
+					part.to.buckets[i] += n
+				}
+				part.to.count += part.from.count
+				part.to.sum += part.from.sum
+			}
+			for kind, n := range slot.errors {
+				kinds[kind] += n
+			}
+		}
+		recent = append(recent, newMirrorStatus(name, &ok, &failed, kinds))
+		total = append(total, newMirrorStatus(name, &stats.ok, &stats.failed, stats.errors))
+	}
+	return recent, total
+}
+
+// names lista os espelhos em ordem; chamar com m.mu
+func (m *MirrorMetrics) names() []string {
+	names := make([]string, 0, len(m.mirrors))
+	for name := range m.mirrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeMetrics escreve os histogramas e os contadores de erro por espelho
+func (m *MirrorMetrics) writeMetrics(w *metricsWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := m.names()
+
+	const duration = "proxy_upstream_request_duration_seconds"
+	w.family(duration, "histogram", "Latência das chamadas à Binance até os headers da resposta, por espelho e resultado.")
+	for _, name := range names {
+		stats := m.mirrors[name]
+		for _, part := range []struct {
+			outcome string
+			h       *mirrorHistogram
+		}{{"ok", &stats.ok}, {"error", &stats.failed}} {
+			for i, bound := range mirrorLatencyBuckets {
+				n := int64(0)
+				if part.h.buckets != nil {
+					n = part.h.buckets[i]
+				}
+				w.sample(duration+"_bucket", float64(n), "mirror", name, "outcome", part.outcome, "le", strconv.FormatFloat(bound, 'g', -1, 64))
+			}
+			w.sample(duration+"_bucket", float64(part.h.count), "mirror", name, "outcome", part.outcome, "le", "+Inf")
+			w.sample(duration+"_sum", part.h.sum, "mirror", name, "outcome", part.outcome)
+			w.sample(duration+"_count", float64(part.h.count), "mirror", name, "outcome", part.outcome)
+		}
+	}
+
+	w.family("proxy_upstream_errors_total", "counter", "Chamadas à Binance com erro por espelho e tipo (timeout, network, 5xx, 429, 418).")
+	for _, name := range names {
+		stats := m.mirrors[name]
+		for _, kind := range []string{mirrorErrorTimeout, mirrorErrorNetwork, mirrorError5xx, mirrorError429, mirrorError418} {
+			w.sample("proxy_upstream_errors_total", float64(stats.errors[kind]), "mirror", name, "kind", kind)
+		}
+	}
+}
+
+// UpstreamStatus mostra latência e erros por espelho da Binance
+// @Summary Latência e erros por espelho
+// @Description Chamadas à Binance por espelho (api, api1..api4, gcp ou o host de destino): quantidade, erros por tipo (timeout, network, 5xx, 429, 418), taxa de erro e quantis de latência, nos últimos 5 minutos e desde o início do processo, e as conexões aquecidas por PREWARM_CONNS e abertas por família de endereço (UPSTREAM_IP_FAMILY), e a configuração TLS com o certificado de cada host
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/upstreams [get]
+func (p *ProxyServer) UpstreamStatus(c *gin.Context) {
+	recent, total := mirrorMetrics.Status()
+	prewarm := []PrewarmStatus{}
+	if p.prewarm != nil {
+		prewarm = p.prewarm.Status()
+	}
+	c.JSON(http.StatusOK, gin.H{"recent": recent, "total": total, "recentWindow": (mirrorRecentMinutes * time.Minute).String(), "prewarm": prewarm, "dial": p.upstreamDial.Status(), "tls": p.upstreamTLS.Status()})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+const defaultMulticastTTL = 1
+
+// bookTickerEvent é o evento do stream <symbol>@bookTicker
+type bookTickerEvent struct {
+	UpdateID int64  `json:"u"`
+	Symbol   string `json:"s"`
+	BidPrice string `json:"b"`
+	BidQty   string `json:"B"`
+	AskPrice string `json:"a"`
+	AskQty   string `json:"A"`
+}
+
+// MulticastMessage é o datagrama publicado na rede local: um objeto JSON por
+// pacote. Type é "bbo" (melhor compra/venda) ou "trade"; Seq é contínuo por
+// publicador, para os consumidores detectarem perdas.
+type MulticastMessage struct {
+	Type      string `json:"type"`
+	Seq       uint64 `json:"seq"`
+	Symbol    string `json:"symbol"`
+	Timestamp int64  `json:"ts"`
+
+	// bbo
+	BidPrice string `json:"bidPrice,omitempty"`
+	BidQty   string `json:"bidQty,omitempty"`
+	AskPrice string `json:"askPrice,omitempty"`
+	AskQty   string `json:"askQty,omitempty"`
+	UpdateID int64  `json:"updateId,omitempty"`
+
+	// trade
+	Price     string `json:"price,omitempty"`
+	Quantity  string `json:"qty,omitempty"`
+	Side      string `json:"side,omitempty"`
+	TradeID   int64  `json:"tradeId,omitempty"`
+	TradeTime int64  `json:"tradeTime,omitempty"`
+}
+
+// MulticastPublisher republica top-of-book e trades dos streams compartilhados
+// em um grupo UDP multicast, para vários processos locais consumirem um único feed
+type MulticastPublisher struct {
+	hub     *StreamHub
+	conn    *net.UDPConn
+	symbols []string
+	cancel  context.CancelFunc
+	seq     uint64
+}
+
+// startMulticastPublisher abre o socket para o grupo (ex: 239.1.1.1:5000) e
+// começa a publicar os símbolos informados
+func startMulticastPublisher(hub *StreamHub, group, iface string, ttl int, symbols []string) (*MulticastPublisher, error) {
+	addr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, err
+	}
+	if !addr.IP.IsMulticast() {
+		return nil, fmt.Errorf("%s não é um endereço multicast", addr.IP)
+	}
+	symbols, err = normalizeSymbols(symbols)
+	if err != nil {
+		return nil, err
+	}
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("informe ao menos um símbolo")
+	}
+
+	conn, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetMulticastTTL(ttl); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if iface != "" {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := pc.SetMulticastInterface(ifi); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &MulticastPublisher{hub: hub, conn: conn, symbols: symbols, cancel: cancel}
+	go m.run(ctx)
+	return m, nil
+}
+
+// Close para a publicação e fecha o socket
+func (m *MulticastPublisher) Close() {
+	m.cancel()
+	m.conn.Close()
+}
+
+func (m *MulticastPublisher) run(ctx context.Context) {
+	streams := make([]string, 0, 2*len(m.symbols))
+	for _, symbol := range m.symbols {
+		lower := strings.ToLower(symbol)
+		streams = append(streams, lower+"@bookTicker", lower+"@trade")
+	}
+	sub := m.hub.Subscribe(streams...).Label("multicast")
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-sub.C:
+			out, ok := normalizeMulticast(msg)
+			if !ok {
+				continue
+			}
+			m.seq++
+			out.Seq = m.seq
+			out.Timestamp = time.Now().UnixMilli()
+			data, err := json.Marshal(out)
+			if err != nil {
+				continue
+			}
+			if _, err := m.conn.Write(data); err != nil {
+				// log.Printf("[WARN] Falha ao publicar multicast: %v", err)
+			}
+		}
+	}
+}
+
+// normalizeMulticast converte eventos bookTicker e trade da Binance no
+// formato publicado
+func normalizeMulticast(msg StreamMessage) (*MulticastMessage, bool) {
+	switch {
+	case strings.HasSuffix(msg.Stream, "@bookTicker"):
+		var event bookTickerEvent
+		if err := json.Unmarshal(msg.Data, &event); err != nil || event.Symbol == "" {
+			return nil, false
+		}
+		return &MulticastMessage{
+			Type:     "bbo",
+			Symbol:   event.Symbol,
+			BidPrice: event.BidPrice,
+			BidQty:   event.BidQty,
+			AskPrice: event.AskPrice,
+			AskQty:   event.AskQty,
+			UpdateID: event.UpdateID,
+		}, true
+	case strings.HasSuffix(msg.Stream, "@trade"):
+		var event tradeEvent
+		if err := json.Unmarshal(msg.Data, &event); err != nil || event.Symbol == "" {
+			return nil, false
+		}
+		// Lado do agressor: se o comprador é o maker, quem agrediu foi a venda
+		side := "BUY"
+		if event.BuyerIsMaker {
+			side = "SELL"
+		}
+		return &MulticastMessage{
+			Type:      "trade",
+			Symbol:    event.Symbol,
+			Price:     event.Price,
+			Quantity:  event.Quantity,
+			Side:      side,
+			TradeID:   event.TradeID,
+			TradeTime: event.TradeTime,
+		}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	// Linhas por página na Binance (máximo de /aggTrades e /historicalTrades)
+	tradePageLimit = 1000
+	// Janela máxima entre startTime e endTime aceita por /aggTrades
+	aggTradesWindow = time.Hour
+	// Janelas vazias percorridas a partir de startTime antes de desistir
+	maxEmptyWindows = 24
+	// Máximo de linhas por resposta NDJSON (NDJSON_MAX_ROWS)
+	defaultNDJSONMaxRows = 100_000
+)
+
+// tradePager descreve como paginar um endpoint de trades por fromId
+type tradePager struct {
+	idField   string
+	timeField string
+	// Aceita startTime/endTime (só /aggTrades)
+	timeRange bool
+}
+
+// ndjsonPagers são os endpoints da Binance que podem ser servidos como NDJSON
+var ndjsonPagers = map[string]tradePager{
+	"/aggTrades":        {idField: "a", timeField: "T", timeRange: true},
+	"/historicalTrades": {idField: "id", timeField: "time"},
+}
+
+// wantsNDJSON indica se o cliente pediu a resposta em NDJSON
+func wantsNDJSON(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), ndjsonContentType)
+}
+
+// ndjsonStream escreve linhas NDJSON, enviando o cabeçalho só na primeira
+// escrita: até lá, erros ainda podem ser respondidos com o status correto
+type ndjsonStream struct {
+	c       *gin.Context
+	started bool
+	rows    int
+}
+
+func (s *ndjsonStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.c.Header("Content-Type", ndjsonContentType)
+	s.c.Header("X-Content-Type-Options", "nosniff")
+	s.c.Status(http.StatusOK)
+}
+
+// writeRows escreve as linhas (JSON compacto) e envia o que já está pronto
+func (s *ndjsonStream) writeRows(rows []json.RawMessage) error {
+	s.start()
+	var buf bytes.Buffer
+	for _, row := range rows {
+		if err := json.Compact(&buf, row); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+	}
+	if _, err := s.c.Writer.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	s.rows += len(rows)
+	s.c.Writer.Flush()
+	return nil
+}
+
+// finish encerra a resposta. Um erro depois do início do stream vira uma
+// última linha {"code", "msg"}; antes dele, a resposta de erro normal.
+func (s *ndjsonStream) finish(err error) {
+	if err == nil {
+		s.start()
+		return
+	}
+	if !s.started {
+		respondUpstreamError(s.c, err)
+		return
+	}
+	line := gin.H{"code": -1000, "msg": redactSecrets(err.Error())}
+	if upstreamErr, ok := err.(*UpstreamError); ok && json.Valid(upstreamErr.Body) {
+		line = gin.H{"code": -1000, "msg": "Erro da Binance durante a paginação", "upstream": json.RawMessage(upstreamErr.Body)}
+	}
+	data, _ := json.Marshal(line)
+	s.c.Writer.Write(append(data, '\n'))
+}
+
+// truncate avisa em uma última linha que o limite de linhas foi atingido e
+// de onde continuar
+func (s *ndjsonStream) truncate(nextFromID int64) {
+	data, _ := json.Marshal(gin.H{"truncated": true, "nextFromId": nextFromID})
+	s.c.Writer.Write(append(data, '\n'))
+}
+
+// fetchRows busca uma página de trades, repassando a API key do cliente
+// (exigida por /historicalTrades)
+func (p *ProxyServer) fetchRows(ctx context.Context, endpoint string, query url.Values, apiKey string) ([]json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.binanceURL+endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Binance-Proxy/1.0")
+	if apiKey != "" {
+		req.Header.Set("X-MBX-APIKEY", apiKey)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &UpstreamError{StatusCode: resp.StatusCode, Body: body}
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, fmt.Errorf("resposta inválida de %s: %w", endpoint, err)
+	}
+	return rows, nil
+}
+
+// findFirstTrades procura a primeira página com trades a partir de start em
+// janelas de window (a Binance limita a distância entre startTime e endTime),
+// até end (0 = sem fim) ou maxWindows janelas vazias
+func findFirstTrades(fetch func(params url.Values) ([]json.RawMessage, error), start, end int64, window time.Duration, maxWindows int) ([]json.RawMessage, error) {
+	now := time.Now().UnixMilli()
+	for i := 0; i < maxWindows && start <= now && (end <= 0 || start <= end); i++ {
+		windowEnd := start + window.Milliseconds() - 1
+		if end > 0 && windowEnd > end {
+			windowEnd = end
+		}
+		rows, err := fetch(url.Values{
+			"startTime": {strconv.FormatInt(start, 10)},
+			"endTime":   {strconv.FormatInt(windowEnd, 10)},
+		})
+		if err != nil || len(rows) > 0 {
+			return rows, err
+		}
+		start = windowEnd + 1
+	}
+	return nil, nil
+}
+
+// rowField lê um campo numérico (id ou horário) de uma linha
+func rowField(row json.RawMessage, field string) int64 {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(row, &fields) != nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(string(fields[field]), 10, 64)
+	return n
+}
+
+// StreamTrades responde o endpoint de trades como NDJSON, paginando a Binance
+// por fromId e enviando cada página assim que ela chega.
+//
+// limit passa a ser o total de linhas (até NDJSON_MAX_ROWS). O início vem de
+// fromId ou, em /aggTrades, de startTime; sem nenhum dos dois, são enviados os
+// últimos limit trades. A paginação para em endTime, em limit ou no fim do
+// histórico.
+func (p *ProxyServer) StreamTrades(c *gin.Context, endpoint string, pager tradePager, query url.Values) {
+	ctx := c.Request.Context()
+	apiKey := c.GetHeader("X-MBX-APIKEY")
+	stream := &ndjsonStream{c: c}
+	maxRows := getEnvInt("NDJSON_MAX_ROWS", defaultNDJSONMaxRows)
+
+	total := tradePageLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'limit' inválido")
+			return
+		}
+		total = n
+	} else if query.Get("endTime") != "" || query.Get("fromId") != "" || query.Get("startTime") != "" {
+		// Com um intervalo, o padrão é percorrer tudo (até NDJSON_MAX_ROWS)
+		total = maxRows
+	}
+	truncated := total > maxRows
+	total = min(total, maxRows)
+
+	var endTime int64
+	if raw := query.Get("endTime"); raw != "" {
+		endTime, _ = strconv.ParseInt(raw, 10, 64)
+	}
+	base := url.Values{"symbol": {query.Get("symbol")}}
+	page := func(params url.Values, limit int) ([]json.RawMessage, error) {
+		for key, values := range base {
+			params[key] = values
+		}
+		params.Set("limit", strconv.Itoa(limit))
+		return p.fetchRows(ctx, endpoint, params, apiKey)
+	}
+
+	// Ponto de partida: fromId, a primeira página a partir de startTime ou os
+	// últimos total trades
+	var rows []json.RawMessage
+	var err error
+	fromID := int64(-1)
+	// A página de uma janela de tempo pode vir curta sem que o histórico
+	// tenha acabado: a paginação segue por fromId
+	windowed := false
+	switch {
+	case query.Get("fromId") != "":
+		fromID, err = strconv.ParseInt(query.Get("fromId"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'fromId' inválido")
+			return
+		}
+	case pager.timeRange && query.Get("startTime") != "":
+		start, err := strconv.ParseInt(query.Get("startTime"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'startTime' inválido")
+			return
+		}
+		rows, err = findFirstTrades(func(params url.Values) ([]json.RawMessage, error) {
+			return page(params, min(total, tradePageLimit))
+		}, start, endTime, aggTradesWindow, maxEmptyWindows)
+		if err != nil || len(rows) == 0 {
+			stream.finish(err)
+			return
+		}
+		windowed = true
+	case total <= tradePageLimit:
+		rows, err = page(url.Values{}, total)
+		if err != nil {
+			stream.finish(err)
+			return
+		}
+		if err := stream.writeRows(rows); err == nil {
+			stream.finish(nil)
+		}
+		return
+	default:
+		latest, err := page(url.Values{}, 1)
+		if err != nil {
+			stream.finish(err)
+			return
+		}
+		if len(latest) == 0 {
+			stream.finish(nil)
+			return
+		}
+		fromID = max(rowField(latest[0], pager.idField)-int64(total)+1, 0)
+	}
+
+	for {
+		if rows == nil {
+			rows, err = page(url.Values{"fromId": {strconv.FormatInt(fromID, 10)}}, min(total-stream.rows, tradePageLimit))
+			if err != nil {
+				stream.finish(err)
+				return
+			}
+		}
+		full := windowed || len(rows) == min(total-stream.rows, tradePageLimit)
+		windowed = false
+		if endTime > 0 {
+			// Corta as linhas depois de endTime
+			for i, row := range rows {
+				if rowField(row, pager.timeField) > endTime {
+					rows, full = rows[:i], false
+					break
+				}
+			}
+		}
+		if len(rows) > 0 {
+			if err := stream.writeRows(rows); err != nil {
+				return
+			}
+			fromID = rowField(rows[len(rows)-1], pager.idField) + 1
+		}
+		if stream.rows >= total {
+			if truncated {
+				stream.truncate(fromID)
+			}
+			stream.finish(nil)
+			return
+		}
+		if !full || ctx.Err() != nil {
+			stream.finish(nil)
+			return
+		}
+		rows = nil
+	}
+}
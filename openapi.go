@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultOpenAPISpecFile = "./swagger.yaml"
+
+// openAPISpec é o subconjunto do OpenAPI 3 usado na validação de requisições
+type openAPISpec struct {
+	Paths      map[string]openAPIPathItem `yaml:"paths"`
+	Components struct {
+		Parameters map[string]*openAPIParameter `yaml:"parameters"`
+		Schemas    map[string]*openAPISchema    `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+type openAPIPathItem struct {
+	Parameters []*openAPIParameter `yaml:"parameters"`
+	Get        *openAPIOperation   `yaml:"get"`
+	Post       *openAPIOperation   `yaml:"post"`
+	Put        *openAPIOperation   `yaml:"put"`
+	Delete     *openAPIOperation   `yaml:"delete"`
+}
+
+type openAPIOperation struct {
+	Parameters []*openAPIParameter `yaml:"parameters"`
+	Responses  map[string]struct {
+		Content map[string]struct {
+			Schema *openAPISchema `yaml:"schema"`
+		} `yaml:"content"`
+	} `yaml:"responses"`
+}
+
+type openAPIParameter struct {
+	Ref      string         `yaml:"$ref"`
+	Name     string         `yaml:"name"`
+	In       string         `yaml:"in"`
+	Required bool           `yaml:"required"`
+	Schema   *openAPISchema `yaml:"schema"`
+}
+
+type openAPISchema struct {
+	Ref       string        `yaml:"$ref"`
+	Type      string        `yaml:"type"`
+	Enum      []interface{} `yaml:"enum"`
+	Minimum   *float64      `yaml:"minimum"`
+	Maximum   *float64      `yaml:"maximum"`
+	MinLength *int          `yaml:"minLength"`
+	MaxLength *int          `yaml:"maxLength"`
+	Pattern   string        `yaml:"pattern"`
+	// Usados na validação das respostas (drift.go)
+	Properties map[string]*openAPISchema `yaml:"properties"`
+	Items      *openAPISchema            `yaml:"items"`
+	Required   []string                  `yaml:"required"`
+
+	pattern *regexp.Regexp
+}
+
+// queryRule é um parâmetro de query já resolvido ($ref) e compilado
+type queryRule struct {
+	name     string
+	required bool
+	schema   *openAPISchema
+}
+
+// RequestValidator valida a query das requisições repassadas à Binance
+// contra o spec OpenAPI, recusando localmente chamadas que a Binance
+// rejeitaria (e que ainda consumiriam peso)
+type RequestValidator struct {
+	// método + path da Binance (sem /api/v3) -> parâmetros
+	operations map[string][]queryRule
+}
+
+// LoadRequestValidator lê o spec (o swagger.yaml do proxy ou o spec oficial
+// da Binance)
+func LoadRequestValidator(file string) (*RequestValidator, error) {
+	spec, err := loadOpenAPISpec(file)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &RequestValidator{operations: map[string][]queryRule{}}
+	for _, op := range spec.binanceOperations() {
+		var rules []queryRule
+		for _, param := range op.parameters {
+			rule, err := spec.queryRule(param)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", op.method, op.endpoint, err)
+			}
+			if rule != nil {
+				rules = append(rules, *rule)
+			}
+		}
+		v.operations[op.method+" "+op.endpoint] = rules
+	}
+	return v, nil
+}
+
+func loadOpenAPISpec(file string) (*openAPISpec, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var spec openAPISpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", file, err)
+	}
+	return &spec, nil
+}
+
+// specOperation é uma operação da API da Binance no spec, com o path sem
+// /api/v3 e os parâmetros do path e da operação
+type specOperation struct {
+	method     string
+	endpoint   string
+	parameters []*openAPIParameter
+	*openAPIOperation
+}
+
+// binanceOperations lista as operações da API da Binance no spec. Caminhos
+// com parâmetros no path ficam de fora: a API spot não os usa, e os que
+// existem no swagger.yaml são rotas locais.
+func (s *openAPISpec) binanceOperations() []specOperation {
+	var ops []specOperation
+	for specPath, item := range s.Paths {
+		if strings.Contains(specPath, "{") {
+			continue
+		}
+		for method, op := range map[string]*openAPIOperation{"GET": item.Get, "POST": item.Post, "PUT": item.Put, "DELETE": item.Delete} {
+			if op == nil {
+				continue
+			}
+			ops = append(ops, specOperation{
+				method:           method,
+				endpoint:         strings.TrimPrefix(specPath, "/api/v3"),
+				parameters:       append(append([]*openAPIParameter{}, item.Parameters...), op.Parameters...),
+				openAPIOperation: op,
+			})
+		}
+	}
+	return ops
+}
+
+// queryRule resolve $ref e compila o pattern; parâmetros fora da query são ignorados
+func (s *openAPISpec) queryRule(param *openAPIParameter) (*queryRule, error) {
+	if param.Ref != "" {
+		resolved, ok := s.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+		if !ok {
+			return nil, fmt.Errorf("referência não encontrada: %s", param.Ref)
+		}
+		param = resolved
+	}
+	if param.In != "query" {
+		return nil, nil
+	}
+	schema := param.Schema
+	if schema != nil && schema.Ref != "" {
+		resolved, ok := s.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return nil, fmt.Errorf("referência não encontrada: %s", schema.Ref)
+		}
+		schema = resolved
+	}
+	if schema != nil && schema.Pattern != "" && schema.pattern == nil {
+		pattern, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("parâmetro %s: pattern inválido: %w", param.Name, err)
+		}
+		schema.pattern = pattern
+	}
+	return &queryRule{name: param.Name, required: param.Required, schema: schema}, nil
+}
+
+// RequestValidationError descreve um parâmetro recusado, com o código de erro
+// equivalente da Binance (-1102 obrigatório ausente, -1100 valor inválido)
+type RequestValidationError struct {
+	Code    int
+	Message string
+}
+
+func (e *RequestValidationError) Error() string { return e.Message }
+
+// Methods lista os métodos que o spec descreve para o path da Binance
+func (v *RequestValidator) Methods(endpoint string) []string {
+	if v == nil {
+		return nil
+	}
+	endpoint = strings.TrimPrefix(endpoint, "/v3")
+	var methods []string
+	for key := range v.operations {
+		if method, path, _ := strings.Cut(key, " "); path == endpoint {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// Validate confere a query da chamada method endpoint (path da Binance).
+// Endpoints que não estão no spec passam sem validação, assim como
+// parâmetros não declarados (timestamp, signature...).
+func (v *RequestValidator) Validate(method, endpoint string, query url.Values) *RequestValidationError {
+	if v == nil {
+		return nil
+	}
+	rules, ok := v.operations[method+" "+strings.TrimPrefix(endpoint, "/v3")]
+	if !ok {
+		return nil
+	}
+	for _, rule := range rules {
+		values, present := query[rule.name]
+		if !present || (len(values) == 1 && values[0] == "") {
+			if rule.required {
+				return &RequestValidationError{Code: -1102, Message: fmt.Sprintf("Parâmetro obrigatório '%s' não foi enviado", rule.name)}
+			}
+			continue
+		}
+		if rule.schema == nil {
+			continue
+		}
+		for _, value := range values {
+			if reason := rule.schema.check(value); reason != "" {
+				return &RequestValidationError{Code: -1100, Message: fmt.Sprintf("Parâmetro '%s' inválido: %s", rule.name, reason)}
+			}
+		}
+	}
+	return nil
+}
+
+// check retorna o motivo da recusa de value, ou "" se ele é válido
+func (s *openAPISchema) check(value string) string {
+	var number float64
+	switch s.Type {
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Sprintf("%q não é um inteiro", value)
+		}
+		number = float64(n)
+	case "number":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Sprintf("%q não é um número", value)
+		}
+		number = f
+	case "boolean":
+		if value != "true" && value != "false" {
+			return fmt.Sprintf("%q não é true ou false", value)
+		}
+	}
+	if s.Type == "integer" || s.Type == "number" {
+		if s.Minimum != nil && number < *s.Minimum {
+			return fmt.Sprintf("%s é menor que o mínimo %s", value, formatFloat(*s.Minimum))
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			return fmt.Sprintf("%s é maior que o máximo %s", value, formatFloat(*s.Maximum))
+		}
+	}
+	if len(s.Enum) > 0 {
+		allowed := make([]string, len(s.Enum))
+		for i, item := range s.Enum {
+			allowed[i] = fmt.Sprint(item)
+			if allowed[i] == value {
+				return ""
+			}
+		}
+		if len(allowed) > 20 {
+			sort.Strings(allowed)
+			allowed = append(allowed[:20], "...")
+		}
+		return fmt.Sprintf("%q não é um dos valores aceitos (%s)", value, strings.Join(allowed, ", "))
+	}
+	if s.MinLength != nil && len(value) < *s.MinLength {
+		return fmt.Sprintf("%q tem menos de %d caracteres", value, *s.MinLength)
+	}
+	if s.MaxLength != nil && len(value) > *s.MaxLength {
+		return fmt.Sprintf("%q tem mais de %d caracteres", value, *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		return fmt.Sprintf("%q não segue o formato %s", value, s.Pattern)
+	}
+	return ""
+}
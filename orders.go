@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxBatchOrders = 20
+
+// orderRequest é uma ordem spot no formato aceito pelos helpers locais
+type orderRequest struct {
+	Symbol           string    `json:"symbol"`
+	Side             string    `json:"side"`
+	Type             string    `json:"type"`
+	TimeInForce      string    `json:"timeInForce,omitempty"`
+	Quantity         flexFloat `json:"quantity,omitempty"`
+	QuoteOrderQty    flexFloat `json:"quoteOrderQty,omitempty"`
+	Price            flexFloat `json:"price,omitempty"`
+	StopPrice        flexFloat `json:"stopPrice,omitempty"`
+	NewClientOrderID string    `json:"newClientOrderId,omitempty"`
+}
+
+// orderValidationError descreve por que uma ordem foi rejeitada localmente
+type orderValidationError struct {
+	Message          string            `json:"message"`
+	FilterViolations []filterViolation `json:"filterViolations,omitempty"`
+}
+
+// normalize valida a ordem contra o exchangeInfo e os filtros do símbolo,
+// normalizando símbolo, lado, tipo e timeInForce
+func (o *orderRequest) normalize(info *ExchangeInfo) *orderValidationError {
+	symbols, err := normalizeSymbols([]string{o.Symbol})
+	if err != nil || len(symbols) == 0 {
+		return &orderValidationError{Message: "símbolo inválido"}
+	}
+	o.Symbol = symbols[0]
+	symbolInfo, ok := info.Symbol(o.Symbol)
+	if !ok {
+		return &orderValidationError{Message: "símbolo inválido: " + o.Symbol}
+	}
+	if symbolInfo.Status != "" && symbolInfo.Status != "TRADING" {
+		return &orderValidationError{Message: "símbolo não está em negociação (status " + symbolInfo.Status + ")"}
+	}
+
+	o.Side = strings.ToUpper(o.Side)
+	if o.Side != "BUY" && o.Side != "SELL" {
+		return &orderValidationError{Message: "side deve ser BUY ou SELL"}
+	}
+	o.Type = strings.ToUpper(o.Type)
+	allowed := false
+	for _, t := range symbolInfo.OrderTypes {
+		if t == o.Type {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return &orderValidationError{Message: "tipo de ordem não suportado pelo símbolo: " + o.Type}
+	}
+
+	limit := o.Type == "LIMIT" || o.Type == "STOP_LOSS_LIMIT" || o.Type == "TAKE_PROFIT_LIMIT" || o.Type == "LIMIT_MAKER"
+	stop := strings.HasPrefix(o.Type, "STOP_LOSS") || strings.HasPrefix(o.Type, "TAKE_PROFIT")
+	if limit && o.Price <= 0 {
+		return &orderValidationError{Message: "price é obrigatório para ordens " + o.Type}
+	}
+	if stop && o.StopPrice <= 0 {
+		return &orderValidationError{Message: "stopPrice é obrigatório para ordens " + o.Type}
+	}
+	if limit && o.Type != "LIMIT_MAKER" && o.TimeInForce == "" {
+		o.TimeInForce = "GTC"
+	}
+	o.TimeInForce = strings.ToUpper(o.TimeInForce)
+
+	if o.Type == "MARKET" {
+		if (o.Quantity > 0) == (o.QuoteOrderQty > 0) {
+			return &orderValidationError{Message: "informe exatamente um entre quantity e quoteOrderQty"}
+		}
+	} else if o.Quantity <= 0 {
+		return &orderValidationError{Message: "quantity é obrigatório"}
+	}
+
+	filters := symbolInfo.ParsedFilters()
+	market := !limit
+	var violations []filterViolation
+	if o.Quantity > 0 {
+		violations = append(violations, filters.checkQuantity(float64(o.Quantity), market)...)
+	}
+	if limit {
+		violations = append(violations, filters.checkPrice(float64(o.Price))...)
+		violations = append(violations, filters.checkNotional(float64(o.Quantity*o.Price), false)...)
+	} else if o.QuoteOrderQty > 0 {
+		violations = append(violations, filters.checkNotional(float64(o.QuoteOrderQty), true)...)
+	}
+	if stop {
+		violations = append(violations, filters.checkPrice(float64(o.StopPrice))...)
+	}
+	if len(violations) > 0 {
+		return &orderValidationError{Message: "a ordem viola filtros do símbolo", FilterViolations: violations}
+	}
+	return nil
+}
+
+// params converte a ordem nos parâmetros de POST /api/v3/order
+func (o *orderRequest) params() url.Values {
+	params := url.Values{
+		"symbol": {o.Symbol},
+		"side":   {o.Side},
+		"type":   {o.Type},
+	}
+	set := func(key string, value flexFloat) {
+		if value > 0 {
+			params.Set(key, formatFloat(float64(value)))
+		}
+	}
+	set("quantity", o.Quantity)
+	set("quoteOrderQty", o.QuoteOrderQty)
+	set("price", o.Price)
+	set("stopPrice", o.StopPrice)
+	if o.TimeInForce != "" {
+		params.Set("timeInForce", o.TimeInForce)
+	}
+	if o.NewClientOrderID != "" {
+		params.Set("newClientOrderId", o.NewClientOrderID)
+	}
+	return params
+}
+
+// upstreamErrorDetail retorna o corpo do erro da Binance como JSON, quando
+// possível, para ser embutido nas respostas locais
+func upstreamErrorDetail(err error) interface{} {
+	if upstreamErr, ok := err.(*UpstreamError); ok && json.Valid(upstreamErr.Body) {
+		return json.RawMessage(upstreamErr.Body)
+	}
+	return err.Error()
+}
+
+type ocoRequest struct {
+	Symbol         string    `json:"symbol"`
+	Side           string    `json:"side"`
+	Quantity       flexFloat `json:"quantity"`
+	Price          flexFloat `json:"price"`
+	StopPrice      flexFloat `json:"stopPrice"`
+	StopLimitPrice flexFloat `json:"stopLimitPrice,omitempty"`
+	ListClientID   string    `json:"listClientOrderId,omitempty"`
+}
+
+// OCOOrder envia uma ordem OCO (alvo + stop) validando os filtros localmente
+// @Summary Ordem OCO
+// @Description Envia um par One-Cancels-the-Other via /api/v3/orderList/oco: uma ordem LIMIT_MAKER no preço alvo e uma STOP_LOSS (ou STOP_LOSS_LIMIT, com stopLimitPrice) no stop. Requer token de tenant.
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /local/order/oco [post]
+func (p *ProxyServer) OCOOrder(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+	var req ocoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "JSON inválido: "+err.Error())
+		return
+	}
+
+	info, err := p.market.ExchangeInfo(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter exchangeInfo: "+err.Error())
+		return
+	}
+
+	// As duas pernas são validadas como ordens independentes
+	target := orderRequest{Symbol: req.Symbol, Side: req.Side, Type: "LIMIT_MAKER", Quantity: req.Quantity, Price: req.Price}
+	stop := orderRequest{Symbol: req.Symbol, Side: req.Side, Type: "STOP_LOSS", Quantity: req.Quantity, StopPrice: req.StopPrice}
+	if req.StopLimitPrice > 0 {
+		stop.Type = "STOP_LOSS_LIMIT"
+		stop.Price = req.StopLimitPrice
+	}
+	for _, leg := range []*orderRequest{&target, &stop} {
+		if verr := leg.normalize(info); verr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":             -1013,
+				"msg":              leg.Type + ": " + verr.Message,
+				"message":          leg.Type + ": " + verr.Message,
+				"filterViolations": verr.FilterViolations,
+			})
+			return
+		}
+	}
+
+	// Venda: alvo acima do preço atual e stop abaixo; compra: o inverso
+	sell := target.Side == "SELL"
+	if (sell && req.Price <= req.StopPrice) || (!sell && req.Price >= req.StopPrice) {
+		respondError(c, http.StatusBadRequest, -1106, "Para SELL price deve ser maior que stopPrice; para BUY, menor")
+		return
+	}
+
+	above, below := &target, &stop
+	if !sell {
+		above, below = &stop, &target
+	}
+	params := url.Values{
+		"symbol":    {target.Symbol},
+		"side":      {target.Side},
+		"quantity":  {formatFloat(float64(req.Quantity))},
+		"aboveType": {above.Type},
+		"belowType": {below.Type},
+	}
+	legParams := func(prefix string, leg *orderRequest) {
+		if leg.Price > 0 {
+			params.Set(prefix+"Price", formatFloat(float64(leg.Price)))
+		}
+		if leg.StopPrice > 0 {
+			params.Set(prefix+"StopPrice", formatFloat(float64(leg.StopPrice)))
+		}
+		if leg.TimeInForce != "" {
+			params.Set(prefix+"TimeInForce", leg.TimeInForce)
+		}
+	}
+	legParams("above", above)
+	legParams("below", below)
+	if req.ListClientID != "" {
+		params.Set("listClientOrderId", req.ListClientID)
+	}
+
+	body, err := p.signedRequest(c.Request.Context(), tenant, http.MethodPost, "/api/v3/orderList/oco", params)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// batchOrderResult é o resultado de uma ordem do lote
+type batchOrderResult struct {
+	Index  int             `json:"index"`
+	Status string          `json:"status"`
+	Order  json.RawMessage `json:"order,omitempty"`
+	Error  interface{}     `json:"error,omitempty"`
+	// Rollback descreve o desfazimento da ordem quando outra ordem do lote falha
+	Rollback string `json:"rollback,omitempty"`
+}
+
+// placedOrder é o subconjunto da resposta de POST /api/v3/order usado no rollback
+type placedOrder struct {
+	Symbol  string `json:"symbol"`
+	OrderID int64  `json:"orderId"`
+	Status  string `json:"status"`
+}
+
+// BatchOrders valida um lote de ordens localmente e as envia em sequência,
+// cancelando as já enviadas se alguma falhar
+// @Summary Lote de ordens
+// @Description Valida todas as ordens contra o exchangeInfo e os filtros antes de enviar qualquer uma. As ordens são enviadas em sequência; se uma falhar, as ordens anteriores ainda abertas são canceladas (rollback). Ordens já executadas não podem ser desfeitas e são reportadas. Requer token de tenant.
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /local/order/batch [post]
+func (p *ProxyServer) BatchOrders(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Orders []orderRequest `json:"orders"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "JSON inválido: "+err.Error())
+		return
+	}
+	if len(req.Orders) == 0 || len(req.Orders) > maxBatchOrders {
+		respondError(c, http.StatusBadRequest, -1100, "O lote deve ter entre 1 e "+strconv.Itoa(maxBatchOrders)+" ordens")
+		return
+	}
+
+	info, err := p.market.ExchangeInfo(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter exchangeInfo: "+err.Error())
+		return
+	}
+
+	// Validação local de todo o lote antes de qualquer envio
+	results := make([]batchOrderResult, len(req.Orders))
+	invalid := false
+	for i := range req.Orders {
+		results[i] = batchOrderResult{Index: i, Status: "VALID"}
+		if verr := req.Orders[i].normalize(info); verr != nil {
+			results[i].Status = "INVALID"
+			results[i].Error = verr
+			invalid = true
+		}
+	}
+	if invalid {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "REJECTED", "results": results})
+		return
+	}
+
+	// O envio não usa o contexto da requisição: uma desconexão do cliente no
+	// meio do lote não deve impedir o rollback
+	ctx := context.Background()
+	failed := -1
+	placed := make([]placedOrder, len(req.Orders))
+	for i := range req.Orders {
+		body, err := p.signedRequest(ctx, tenant, http.MethodPost, "/api/v3/order", req.Orders[i].params())
+		if err != nil {
+			results[i].Status = "FAILED"
+			results[i].Error = upstreamErrorDetail(err)
+			failed = i
+			break
+		}
+		results[i].Status = "SUBMITTED"
+		results[i].Order = body
+		json.Unmarshal(body, &placed[i])
+	}
+
+	if failed < 0 {
+		c.JSON(http.StatusOK, gin.H{"status": "OK", "results": results})
+		return
+	}
+
+	for i := failed + 1; i < len(results); i++ {
+		results[i].Status = "SKIPPED"
+	}
+	// Rollback: cancelar as ordens anteriores ainda abertas
+	status := "ROLLED_BACK"
+	for i := 0; i < failed; i++ {
+		order := placed[i]
+		if order.Status != "NEW" && order.Status != "PARTIALLY_FILLED" {
+			results[i].Rollback = "NOT_POSSIBLE"
+			status = "PARTIAL"
+			continue
+		}
+		params := url.Values{"symbol": {order.Symbol}, "orderId": {strconv.FormatInt(order.OrderID, 10)}}
+		if _, err := p.signedRequest(ctx, tenant, http.MethodDelete, "/api/v3/order", params); err != nil {
+			results[i].Rollback = "FAILED"
+			results[i].Error = upstreamErrorDetail(err)
+			status = "PARTIAL"
+			continue
+		}
+		results[i].Rollback = "CANCELED"
+		if order.Status == "PARTIALLY_FILLED" {
+			status = "PARTIAL"
+		}
+	}
+	c.JSON(http.StatusMultiStatus, gin.H{"status": status, "failedIndex": failed, "results": results})
+}
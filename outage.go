@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Falhas seguidas (timeout, rede, 5xx) até o espelho ser dado como fora
+	// (OUTAGE_FAILURE_THRESHOLD)
+	defaultOutageFailureThreshold = 5
+	// Eventos guardados em memória para /admin/outages
+	maxRecentOutageEvents = 100
+	// Eventos na fila dos webhooks; com a fila cheia, os novos são descartados
+	outageQueueSize     = 256
+	outageWebhookWait   = 10 * time.Second
+	outageWebhookTrials = 3
+)
+
+// Tipos de OutageEvent
+const (
+	// Chamadas a um espelho da Binance falhando seguidamente
+	outageUpstreamDown = "upstream_down"
+	// Conexão WebSocket de um stream sem conseguir reconectar
+	// (WS_RECONNECT_ALERT_AFTER)
+	outageStreamDown = "stream_down"
+	// A Binance respondeu 429, ou o orçamento de peso do proxy esgotou
+	outageWeightExhausted = "weight_exhausted"
+	// A Binance respondeu 418: o IP está banido
+	outageIPBanned = "ip_banned"
+	// Manutenção anunciada em /sapi/v1/system/status
+	outageMaintenance = "maintenance"
+	// Certificado de um host fora de UPSTREAM_TLS_PINS
+	outageTLSPinMismatch = "tls_pin_mismatch"
+	// Certificado de um host assinado por um emissor nunca visto (pontual)
+	outageCertificateChanged = "certificate_changed"
+)
+
+// Estados de OutageEvent
+const (
+	outageFiring   = "firing"
+	outageResolved = "resolved"
+	// Acontecimento pontual, sem início e fim
+	outageNotice = "notice"
+)
+
+// OutageEvent é o início ou o fim de um problema do lado da Binance
+type OutageEvent struct {
+	Type string `json:"type"`
+	// Espelho (api, api1, fapi.binance.com...), stream, "proxy" ou "binance"
+	Subject string `json:"subject"`
+	Status  string `json:"status"`
+	Time    int64  `json:"time"`
+	// Início do problema; no resolved, junto com a duração
+	Since    int64  `json:"since"`
+	Duration string `json:"duration,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+type outageKey struct {
+	kind, subject string
+}
+
+// outageState é um problema ativo
+type outageState struct {
+	event OutageEvent
+	// Sinais de recuperação antes disso são ignorados (ex: Retry-After da
+	// Binance, virada da janela de peso), para o evento não oscilar
+	holdUntil time.Time
+}
+
+// OutageNotifier acompanha os problemas da Binance vistos pelo proxy e avisa
+// os webhooks de OUTAGE_WEBHOOKS uma vez no início e outra no fim de cada
+// um: um problema que já está ativo não é avisado de novo. Os eventos também
+// saem em JSON por linha na saída de erro e ficam em /admin/outages.
+type OutageNotifier struct {
+	out       io.Writer
+	webhooks  []string
+	threshold int
+	client    *http.Client
+	queue     chan OutageEvent
+	done      chan struct{}
+
+	// Problemas ativos, para que o caminho sem nenhum não pegue o mutex
+	active atomic.Int64
+
+	mu           sync.Mutex
+	firing       map[outageKey]*outageState
+	failures     map[string]int
+	recent       []OutageEvent
+	webhookError string
+}
+
+// NewOutageNotifier cria o notificador e inicia o envio aos webhooks
+// (separados por vírgula; os do Slack recebem uma mensagem de texto)
+func NewOutageNotifier(out io.Writer, webhooks string, threshold int) *OutageNotifier {
+	if threshold <= 0 {
+		threshold = defaultOutageFailureThreshold
+	}
+	n := &OutageNotifier{
+		out:       out,
+		threshold: threshold,
+		client:    &http.Client{Timeout: outageWebhookWait},
+		queue:     make(chan OutageEvent, outageQueueSize),
+		done:      make(chan struct{}),
+		firing:    map[outageKey]*outageState{},
+		failures:  map[string]int{},
+	}
+	for _, hook := range strings.Split(webhooks, ",") {
+		if hook = strings.TrimSpace(hook); hook != "" {
+			n.webhooks = append(n.webhooks, hook)
+		}
+	}
+	go n.send()
+	return n
+}
+
+// Close entrega os eventos que ainda estão na fila e para o envio
+func (n *OutageNotifier) Close() {
+	close(n.queue)
+	<-n.done
+}
+
+// Fire marca o problema como ativo, avisando só se ele ainda não estava
+func (n *OutageNotifier) Fire(kind, subject, detail string) {
+	n.FireUntil(kind, subject, detail, time.Time{})
+}
+
+// FireUntil é o Fire com um prazo antes do qual o problema não é dado como
+// resolvido. Repetido com o problema ativo, só estende o prazo.
+func (n *OutageNotifier) FireUntil(kind, subject, detail string, holdUntil time.Time) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := outageKey{kind, subject}
+	if state, ok := n.firing[key]; ok {
+		if holdUntil.After(state.holdUntil) {
+			state.holdUntil = holdUntil
+		}
+		return
+	}
+	now := time.Now().UnixMilli()
+	event := OutageEvent{Type: kind, Subject: subject, Status: outageFiring, Time: now, Since: now, Detail: redactSecrets(detail)}
+	n.firing[key] = &outageState{event: event, holdUntil: holdUntil}
+	n.active.Add(1)
+	n.emit(event)
+}
+
+// Resolve encerra o problema, avisando com a duração se ele estava ativo
+func (n *OutageNotifier) Resolve(kind, subject string) {
+	if n == nil || n.active.Load() == 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := outageKey{kind, subject}
+	state, ok := n.firing[key]
+	now := time.Now()
+	if !ok || now.Before(state.holdUntil) {
+		return
+	}
+	delete(n.firing, key)
+	n.active.Add(-1)
+	since := state.event.Since
+	n.emit(OutageEvent{
+		Type: kind, Subject: subject, Status: outageResolved, Time: now.UnixMilli(), Since: since,
+		Duration: now.Sub(time.UnixMilli(since)).Round(time.Second).String(),
+	})
+}
+
+// Notify avisa um acontecimento pontual, que não fica ativo
+func (n *OutageNotifier) Notify(kind, subject, detail string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now().UnixMilli()
+	n.emit(OutageEvent{Type: kind, Subject: subject, Status: outageNotice, Time: now, Since: now, Detail: redactSecrets(detail)})
+}
+
+// emit guarda, escreve e enfileira o evento para os webhooks. Chamado com n.mu.
+func (n *OutageNotifier) emit(event OutageEvent) {
+	n.recent = append(n.recent, event)
+	if len(n.recent) > maxRecentOutageEvents {
+		n.recent = n.recent[len(n.recent)-maxRecentOutageEvents:]
+	}
+	if n.out != nil {
+		if line, err := json.Marshal(event); err == nil {
+			n.out.Write(append(line, '\n'))
+		}
+	}
+	if len(n.webhooks) == 0 {
+		return
+	}
+	select {
+	case n.queue <- event:
+	default:
+		// log.Printf("[WARN] Fila de webhooks de indisponibilidade cheia")
+	}
+}
+
+// send entrega os eventos na ordem em que aconteceram
+func (n *OutageNotifier) send() {
+	defer close(n.done)
+	for event := range n.queue {
+		for _, hook := range n.webhooks {
+			body, err := outageWebhookBody(hook, event)
+			if err != nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), outageWebhookWait*outageWebhookTrials)
+			for attempt := 0; attempt < outageWebhookTrials; attempt++ {
+				if attempt > 0 {
+					time.Sleep(time.Duration(attempt) * time.Second)
+				}
+				if err = postWebhook(ctx, n.client, hook, body); err == nil {
+					break
+				}
+			}
+			cancel()
+			n.mu.Lock()
+			n.webhookError = ""
+			if err != nil {
+				n.webhookError = redactSecrets(err.Error())
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+// outageWebhookBody é o evento em JSON ou, para os webhooks do Slack, uma
+// mensagem de texto
+func outageWebhookBody(hook string, event OutageEvent) ([]byte, error) {
+	if u, err := url.Parse(hook); err != nil || u.Host != "hooks.slack.com" {
+		return json.Marshal(event)
+	}
+	text := fmt.Sprintf(":red_circle: Binance: %s em %s", event.Type, event.Subject)
+	switch event.Status {
+	case outageResolved:
+		text = fmt.Sprintf(":large_green_circle: Binance: %s em %s resolvido depois de %s", event.Type, event.Subject, event.Duration)
+	case outageNotice:
+		text = fmt.Sprintf(":warning: Binance: %s em %s", event.Type, event.Subject)
+	}
+	if event.Detail != "" {
+		text += " (" + event.Detail + ")"
+	}
+	return json.Marshal(map[string]string{"text": text})
+}
+
+// observeUpstream acompanha as respostas da Binance por espelho: falhas
+// seguidas derrubam o espelho, 429 e 418 disparam os eventos de peso e de
+// banimento, e uma resposta boa encerra os três
+func (n *OutageNotifier) observeUpstream(host string, resp *http.Response, kind string) {
+	if n == nil {
+		return
+	}
+	mirror := mirrorName(host)
+	switch kind {
+	case "":
+		n.mu.Lock()
+		delete(n.failures, mirror)
+		n.mu.Unlock()
+		n.Resolve(outageUpstreamDown, mirror)
+		n.Resolve(outageWeightExhausted, mirror)
+		n.Resolve(outageIPBanned, mirror)
+	case mirrorError429:
+		detail, until := retryAfter(resp)
+		n.FireUntil(outageWeightExhausted, mirror, "Binance respondeu 429"+detail, until)
+	case mirrorError418:
+		detail, until := retryAfter(resp)
+		n.FireUntil(outageIPBanned, mirror, "Binance respondeu 418"+detail, until)
+	default:
+		n.mu.Lock()
+		n.failures[mirror]++
+		down := n.failures[mirror] >= n.threshold
+		n.mu.Unlock()
+		if down {
+			n.Fire(outageUpstreamDown, mirror, fmt.Sprintf("%d falhas seguidas, a última %s", n.threshold, kind))
+		}
+	}
+}
+
+// retryAfter lê o Retry-After (em segundos) da recusa da Binance
+func retryAfter(resp *http.Response) (string, time.Time) {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return "", time.Time{}
+	}
+	return ", Retry-After " + strconv.Itoa(seconds) + "s", time.Now().Add(time.Duration(seconds) * time.Second)
+}
+
+// OutageStatus é a resposta de /admin/outages
+type OutageStatus struct {
+	Active       []OutageEvent `json:"active"`
+	Recent       []OutageEvent `json:"recent"`
+	Webhooks     int           `json:"webhooks"`
+	WebhookError string        `json:"webhookError,omitempty"`
+}
+
+// Status lista os problemas ativos e os eventos recentes, do mais novo ao
+// mais antigo
+func (n *OutageNotifier) Status() OutageStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	status := OutageStatus{Active: []OutageEvent{}, Recent: make([]OutageEvent, len(n.recent)), Webhooks: len(n.webhooks), WebhookError: n.webhookError}
+	for _, state := range n.firing {
+		status.Active = append(status.Active, state.event)
+	}
+	sort.Slice(status.Active, func(i, j int) bool { return status.Active[i].Since > status.Active[j].Since })
+	for i, event := range n.recent {
+		status.Recent[len(n.recent)-1-i] = event
+	}
+	return status
+}
+
+func (n *OutageNotifier) writeMetrics(w *metricsWriter) {
+	status := n.Status()
+	w.family("proxy_outage_active", "gauge", "Problemas da Binance ativos, por tipo e alvo (espelho, stream ou proxy)")
+	for _, event := range status.Active {
+		w.sample("proxy_outage_active", 1, "type", event.Type, "subject", event.Subject)
+	}
+}
+
+// OutageStatusHandler mostra os problemas da Binance vistos pelo proxy
+// @Summary Indisponibilidades da Binance
+// @Description Problemas ativos (upstream_down, stream_down, weight_exhausted, ip_banned, maintenance, tls_pin_mismatch) e os últimos 100 eventos de início e fim (e os avisos pontuais certificate_changed), do mais novo ao mais antigo, com o último erro dos webhooks de OUTAGE_WEBHOOKS
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} OutageStatus
+// @Router /admin/outages [get]
+func (p *ProxyServer) OutageStatusHandler(c *gin.Context) {
+	if p.outages == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Detecção de indisponibilidades desabilitada")
+		return
+	}
+	c.JSON(http.StatusOK, p.outages.Status())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func outageStatus(t *testing.T, p *ProxyServer) (int, OutageStatus) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/admin/outages", nil)
+	p.OutageStatusHandler(c)
+	var status OutageStatus
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, status
+}
+
+// As falhas chegam só ao notificador do proxy que fez as chamadas; um proxy
+// sem notificador segue funcionando com a detecção desligada
+func TestOutageNotifierPerProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	watched := NewProxyServer()
+	watched.binanceURL = upstream.URL + "/api/v3"
+	watched.outages = NewOutageNotifier(io.Discard, "", 2)
+	defer watched.outages.Close()
+	watched.client = newUpstreamClient(watched, nil)
+
+	unwatched := NewProxyServer()
+	unwatched.binanceURL = upstream.URL + "/api/v3"
+	unwatched.client = newUpstreamClient(unwatched, nil)
+
+	for _, p := range []*ProxyServer{watched, watched, unwatched, unwatched} {
+		resp, err := p.client.Get(p.binanceURL + "/ping")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	code, status := outageStatus(t, watched)
+	if code != http.StatusOK || len(status.Active) != 1 || status.Active[0].Type != outageUpstreamDown {
+		t.Fatalf("proxy com notificador: status %d, ativos %+v, esperado upstream_down", code, status.Active)
+	}
+	if code, _ := outageStatus(t, unwatched); code != http.StatusServiceUnavailable {
+		t.Fatalf("proxy sem notificador: status %d, esperado 503", code)
+	}
+}
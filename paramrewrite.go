@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParamRule descreve o tratamento de um parâmetro de query antes do envio à
+// Binance. As operações são aplicadas nesta ordem: rename, default, list,
+// type e remove.
+type ParamRule struct {
+	Name string `yaml:"name" json:"name"`
+	// Novo nome do parâmetro (ex: pair -> symbol)
+	Rename string `yaml:"rename" json:"rename,omitempty"`
+	// Valor usado quando o cliente não envia o parâmetro
+	Default string `yaml:"default" json:"default,omitempty"`
+	// Formato de listas: json (["A","B"]) ou csv (A,B). Aceita na entrada
+	// JSON, valores separados por vírgula ou o parâmetro repetido.
+	List string `yaml:"list" json:"list,omitempty"`
+	// Conversão: int, decimal, bool, upper, lower ou timestamp_ms (aceita
+	// RFC3339, segundos ou milissegundos)
+	Type   string `yaml:"type" json:"type,omitempty"`
+	Remove bool   `yaml:"remove" json:"remove,omitempty"`
+}
+
+// RouteRewrite aplica regras de parâmetros às rotas que casam com Paths
+// (path.Match sobre o path da Binance, ex: /ticker/*) e Methods
+type RouteRewrite struct {
+	Paths   []string    `yaml:"paths" json:"paths,omitempty"`
+	Methods []string    `yaml:"methods" json:"methods,omitempty"`
+	Params  []ParamRule `yaml:"params" json:"params"`
+}
+
+type paramRewriteFile struct {
+	Rules []RouteRewrite `yaml:"rules"`
+}
+
+// defaultParamRewrites reproduz o comportamento histórico do proxy: symbols
+// separado por vírgula vira array JSON, como a Binance espera
+var defaultParamRewrites = []RouteRewrite{
+	{Params: []ParamRule{{Name: "symbols", List: "json"}}},
+}
+
+// ParamRewriter aplica as regras na ordem: as padrão e depois as de
+// PARAM_REWRITE_FILE
+type ParamRewriter struct {
+	mu    sync.RWMutex
+	rules []RouteRewrite
+}
+
+// LoadParamRewrites lê PARAM_REWRITE_FILE; sem arquivo, só as regras padrão valem
+func LoadParamRewrites(file string) (*ParamRewriter, error) {
+	r := &ParamRewriter{rules: append([]RouteRewrite{}, defaultParamRewrites...)}
+	if file == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var parsed paramRewriteFile
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", file, err)
+	}
+	for i, rule := range parsed.Rules {
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("regra %d: path inválido %q", i+1, pattern)
+			}
+		}
+		for j := range rule.Methods {
+			rule.Methods[j] = strings.ToUpper(rule.Methods[j])
+		}
+		for _, param := range rule.Params {
+			if param.Name == "" {
+				return nil, fmt.Errorf("regra %d: parâmetro sem name", i+1)
+			}
+			switch param.List {
+			case "", "json", "csv":
+			default:
+				return nil, fmt.Errorf("regra %d, %s: list deve ser json ou csv", i+1, param.Name)
+			}
+			switch param.Type {
+			case "", "int", "decimal", "bool", "upper", "lower", "timestamp_ms":
+			default:
+				return nil, fmt.Errorf("regra %d, %s: type desconhecido %q", i+1, param.Name, param.Type)
+			}
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// Reload relê PARAM_REWRITE_FILE. Com erro, as regras atuais são mantidas.
+func (r *ParamRewriter) Reload(file string) error {
+	fresh, err := LoadParamRewrites(file)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.rules = fresh.rules
+	r.mu.Unlock()
+	return nil
+}
+
+func (rule *RouteRewrite) matches(method, endpoint string) bool {
+	if len(rule.Methods) > 0 && !slices.Contains(rule.Methods, method) {
+		return false
+	}
+	if len(rule.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Paths {
+		if ok, _ := path.Match(pattern, endpoint); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply reescreve query para a chamada method endpoint (path da Binance).
+// Erros de conversão são do cliente e viram 400.
+func (r *ParamRewriter) Apply(method, endpoint string, query url.Values) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	rules := r.rules
+	r.mu.RUnlock()
+	for i := range rules {
+		if !rules[i].matches(method, endpoint) {
+			continue
+		}
+		for _, param := range rules[i].Params {
+			if err := param.apply(query); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p ParamRule) apply(query url.Values) error {
+	name := p.Name
+	if p.Rename != "" {
+		if values, ok := query[name]; ok {
+			delete(query, name)
+			query[p.Rename] = values
+		}
+		name = p.Rename
+	}
+	if p.Default != "" && query.Get(name) == "" {
+		query.Set(name, p.Default)
+	}
+	values, ok := query[name]
+	if !ok {
+		return nil
+	}
+	if p.Remove {
+		delete(query, name)
+		return nil
+	}
+
+	if p.List != "" {
+		items := splitListParam(values)
+		if p.Type != "" {
+			for i := range items {
+				converted, err := coerceParam(p.Type, items[i])
+				if err != nil {
+					return fmt.Errorf("parâmetro %s inválido: %w", name, err)
+				}
+				items[i] = converted
+			}
+		}
+		if p.List == "json" {
+			encoded, _ := json.Marshal(items)
+			query.Set(name, string(encoded))
+		} else {
+			query.Set(name, strings.Join(items, ","))
+		}
+		return nil
+	}
+
+	if p.Type != "" {
+		for i := range values {
+			converted, err := coerceParam(p.Type, values[i])
+			if err != nil {
+				return fmt.Errorf("parâmetro %s inválido: %w", name, err)
+			}
+			values[i] = converted
+		}
+	}
+	return nil
+}
+
+// splitListParam junta as formas de lista aceitas: array JSON, valores
+// separados por vírgula ou o parâmetro repetido
+func splitListParam(values []string) []string {
+	var items []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		var list []string
+		if strings.HasPrefix(value, "[") && json.Unmarshal([]byte(value), &list) == nil {
+			items = append(items, list...)
+			continue
+		}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+func coerceParam(kind, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case "int":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f != float64(int64(f)) {
+			return "", fmt.Errorf("%q não é inteiro", value)
+		}
+		return strconv.FormatInt(int64(f), 10), nil
+	case "decimal":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q não é número", value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case "bool":
+		b, err := strconv.ParseBool(strings.ToLower(value))
+		if err != nil {
+			return "", fmt.Errorf("%q não é booleano", value)
+		}
+		return strconv.FormatBool(b), nil
+	case "upper":
+		return strings.ToUpper(value), nil
+	case "lower":
+		return strings.ToLower(value), nil
+	case "timestamp_ms":
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return strconv.FormatInt(t.UnixMilli(), 10), nil
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q não é data (RFC3339, segundos ou ms)", value)
+		}
+		// Até 10 dígitos são segundos
+		if n < 1e11 {
+			n *= 1000
+		}
+		return strconv.FormatInt(n, 10), nil
+	}
+	return value, nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPatternInterval = "4h"
+	defaultPatternLimit    = 100
+	// Candles anteriores usados para medir a tendência antes do padrão
+	patternTrendCandles = 5
+)
+
+// candle é um kline com os preços já convertidos
+type candle struct {
+	openTime, closeTime    int64
+	open, high, low, close float64
+}
+
+func (k candle) body() float64      { return math.Abs(k.close - k.open) }
+func (k candle) rng() float64       { return k.high - k.low }
+func (k candle) upper() float64     { return k.high - math.Max(k.open, k.close) }
+func (k candle) lower() float64     { return math.Min(k.open, k.close) - k.low }
+func (k candle) bullish() bool      { return k.close > k.open }
+func (k candle) bearish() bool      { return k.close < k.open }
+func (k candle) midpoint() float64  { return (k.open + k.close) / 2 }
+func (k candle) bodyRatio() float64 { return k.body() / k.rng() }
+
+// patternMatch é um padrão encontrado em /analytics/patterns
+type patternMatch struct {
+	Pattern    string  `json:"pattern"`
+	Direction  string  `json:"direction"`
+	OpenTime   int64   `json:"openTime"`
+	CloseTime  int64   `json:"closeTime"`
+	Candles    int     `json:"candles"`
+	Confidence float64 `json:"confidence"`
+}
+
+// candlePattern detecta um padrão terminando no candle i. trend é a variação
+// relativa dos candles anteriores (negativa em queda). Retorna a confiança,
+// entre 0 e 1, ou 0 quando o padrão não aparece.
+type candlePattern struct {
+	name      string
+	direction string
+	candles   int
+	detect    func(ks []candle, i int, trend float64) float64
+}
+
+// candlePatterns são os padrões reconhecidos, na ordem da resposta
+var candlePatterns = []candlePattern{
+	{"doji", "neutral", 1, func(ks []candle, i int, trend float64) float64 {
+		k := ks[i]
+		if k.rng() == 0 || k.bodyRatio() > 0.1 {
+			return 0
+		}
+		return 1 - k.bodyRatio()/0.1*0.5
+	}},
+	{"hammer", "bullish", 1, func(ks []candle, i int, trend float64) float64 {
+		if trend >= 0 {
+			return 0
+		}
+		return hammerShape(ks[i].lower(), ks[i].upper(), ks[i], trend)
+	}},
+	{"hanging_man", "bearish", 1, func(ks []candle, i int, trend float64) float64 {
+		if trend <= 0 {
+			return 0
+		}
+		return hammerShape(ks[i].lower(), ks[i].upper(), ks[i], trend)
+	}},
+	{"inverted_hammer", "bullish", 1, func(ks []candle, i int, trend float64) float64 {
+		if trend >= 0 {
+			return 0
+		}
+		return hammerShape(ks[i].upper(), ks[i].lower(), ks[i], trend)
+	}},
+	{"shooting_star", "bearish", 1, func(ks []candle, i int, trend float64) float64 {
+		if trend <= 0 {
+			return 0
+		}
+		return hammerShape(ks[i].upper(), ks[i].lower(), ks[i], trend)
+	}},
+	{"bullish_engulfing", "bullish", 2, func(ks []candle, i int, trend float64) float64 {
+		prev, curr := ks[i-1], ks[i]
+		if !prev.bearish() || !curr.bullish() || curr.open > prev.close || curr.close < prev.open {
+			return 0
+		}
+		return engulfingConfidence(prev, curr, -trend)
+	}},
+	{"bearish_engulfing", "bearish", 2, func(ks []candle, i int, trend float64) float64 {
+		prev, curr := ks[i-1], ks[i]
+		if !prev.bullish() || !curr.bearish() || curr.open < prev.close || curr.close > prev.open {
+			return 0
+		}
+		return engulfingConfidence(prev, curr, trend)
+	}},
+	{"morning_star", "bullish", 3, func(ks []candle, i int, trend float64) float64 {
+		first, star, last := ks[i-2], ks[i-1], ks[i]
+		if !first.bearish() || !last.bullish() || star.body() > first.body()*0.3 || last.close < first.midpoint() {
+			return 0
+		}
+		return starConfidence(first, star, last, -trend)
+	}},
+	{"evening_star", "bearish", 3, func(ks []candle, i int, trend float64) float64 {
+		first, star, last := ks[i-2], ks[i-1], ks[i]
+		if !first.bullish() || !last.bearish() || star.body() > first.body()*0.3 || last.close > first.midpoint() {
+			return 0
+		}
+		return starConfidence(first, star, last, trend)
+	}},
+}
+
+// hammerShape mede um candle de corpo pequeno com uma sombra longa (long) e a
+// outra curta (short), como o martelo e a estrela cadente
+func hammerShape(long, short float64, k candle, trend float64) float64 {
+	body := k.body()
+	if k.rng() == 0 || long < 2*math.Max(body, k.rng()*0.05) || short > math.Max(body*0.5, k.rng()*0.1) {
+		return 0
+	}
+	shape := math.Min(long/k.rng(), 1)
+	return 0.5 + 0.3*shape + trendWeight(math.Abs(trend))
+}
+
+// engulfingConfidence cresce com o quanto o corpo atual supera o anterior e
+// com a tendência contrária ao padrão (against > 0)
+func engulfingConfidence(prev, curr candle, against float64) float64 {
+	if prev.body() == 0 {
+		return 0
+	}
+	size := math.Min(curr.body()/prev.body()-1, 1)
+	confidence := 0.5 + 0.3*size
+	if against > 0 {
+		confidence += trendWeight(against)
+	}
+	return confidence
+}
+
+// starConfidence cresce com a recuperação do último candle sobre o primeiro
+// e com a tendência contrária ao padrão
+func starConfidence(first, star, last candle, against float64) float64 {
+	if first.body() == 0 {
+		return 0
+	}
+	recovery := math.Min(last.body()/first.body(), 1)
+	confidence := 0.5 + 0.2*recovery + 0.1*(1-star.body()/first.body())
+	if against > 0 {
+		confidence += trendWeight(against)
+	}
+	return confidence
+}
+
+// trendWeight converte a força da tendência anterior em até 0,2 de confiança
+// (variação de 5% ou mais conta como tendência plena)
+func trendWeight(change float64) float64 {
+	return 0.2 * math.Min(change/0.05, 1)
+}
+
+// Patterns procura padrões de candlestick nos klines recentes do símbolo
+// @Summary Padrões de candlestick
+// @Description Procura engolfo, doji, martelo, estrela cadente, estrela da manhã/noite e outros nos últimos candles fechados, com a confiança de cada ocorrência
+// @Tags Analytics
+// @Produce json
+// @Param symbol path string true "Símbolo (ex: BTCUSDT)"
+// @Param interval query string false "Intervalo dos candles (padrão: 4h)"
+// @Param limit query integer false "Candles analisados (máx. 1000)"
+// @Param patterns query string false "Padrões desejados, separados por vírgula"
+// @Param minConfidence query number false "Confiança mínima (0 a 1)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /analytics/patterns/{symbol} [get]
+func (p *ProxyServer) Patterns(c *gin.Context) {
+	symbols, err := normalizeSymbols([]string{c.Param("symbol")})
+	if err != nil || len(symbols) == 0 {
+		respondError(c, http.StatusBadRequest, -1100, "Símbolo inválido")
+		return
+	}
+	symbol := symbols[0]
+	interval := c.DefaultQuery("interval", defaultPatternInterval)
+	if _, ok := klineIntervals[interval]; !ok {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'interval' inválido: "+interval)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPatternLimit)))
+	if err != nil || limit < 1 || limit > klinesPageLimit {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'limit' deve estar entre 1 e 1000")
+		return
+	}
+	minConfidence, err := strconv.ParseFloat(c.DefaultQuery("minConfidence", "0"), 64)
+	if err != nil || minConfidence < 0 || minConfidence > 1 {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'minConfidence' deve estar entre 0 e 1")
+		return
+	}
+	wanted := map[string]bool{}
+	if raw := c.Query("patterns"); raw != "" {
+		known := map[string]bool{}
+		for _, pattern := range candlePatterns {
+			known[pattern.name] = true
+		}
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !known[name] {
+				respondError(c, http.StatusBadRequest, -1100, "Padrão desconhecido: "+name)
+				return
+			}
+			wanted[name] = true
+		}
+	}
+
+	// Um candle a mais: o último ainda está em andamento e é descartado
+	klines, err := p.market.Klines(c.Request.Context(), symbol, interval, min(limit+1, klinesPageLimit), 0, 0)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	now := time.Now().UnixMilli()
+	candles := make([]candle, 0, len(klines))
+	for _, k := range klines {
+		if k.CloseTime >= now {
+			continue
+		}
+		var values [4]float64
+		for i, raw := range []string{k.Open, k.High, k.Low, k.Close} {
+			values[i], _ = strconv.ParseFloat(raw, 64)
+		}
+		candles = append(candles, candle{k.OpenTime, k.CloseTime, values[0], values[1], values[2], values[3]})
+	}
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	matches := []patternMatch{}
+	for i := range candles {
+		trend := 0.0
+		if start := i - patternTrendCandles; start >= 0 && candles[start].close > 0 {
+			trend = (candles[i-1].close - candles[start].close) / candles[start].close
+		}
+		for _, pattern := range candlePatterns {
+			if i+1 < pattern.candles || len(wanted) > 0 && !wanted[pattern.name] {
+				continue
+			}
+			confidence := pattern.detect(candles, i, trend)
+			if confidence <= 0 || confidence < minConfidence {
+				continue
+			}
+			matches = append(matches, patternMatch{
+				Pattern:    pattern.name,
+				Direction:  pattern.direction,
+				OpenTime:   candles[i-pattern.candles+1].openTime,
+				CloseTime:  candles[i].closeTime,
+				Candles:    pattern.candles,
+				Confidence: math.Round(math.Min(confidence, 1)*100) / 100,
+			})
+		}
+	}
+
+	result := gin.H{
+		"symbol":   symbol,
+		"interval": interval,
+		"candles":  len(candles),
+		"patterns": matches,
+	}
+	if len(candles) > 0 {
+		result["from"] = candles[0].openTime
+		result["to"] = candles[len(candles)-1].closeTime
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// Parte do orçamento de cada classe que os lotes deixam livre para as
+	// requisições dos clientes que chegam no meio deles
+	defaultPlannerMarginPct = 10
+	// Reavaliação da folga quando ela acaba antes de a janela virar (outra
+	// classe pode ter liberado a fila)
+	plannerRecheck = time.Second
+)
+
+// FetchPlanner planeja as buscas em lote à Binance (matriz de klines,
+// correlação, backfills): quantas saem ao mesmo tempo e quando cada uma sai.
+// A concorrência é limitada pelas conexões mantidas com a Binance, pelas
+// vagas do limite de concorrência do endpoint e pelo peso que a classe ainda
+// tem na janela, descontada a margem de segurança. Uma busca só sai quando o
+// peso dela cabe abaixo da margem; sem folga, espera a próxima janela aqui em
+// vez de disputar o orçamento no agendador de peso com os clientes.
+type FetchPlanner struct {
+	weights   *WeightScheduler
+	limits    *ConcurrencyLimiter
+	maxConns  int
+	marginPct int
+	margin    float64
+
+	mu sync.Mutex
+	// Peso das buscas liberadas que ainda não terminaram: conta contra a
+	// folga até a resposta chegar, para que buscas liberadas juntas não
+	// passem da margem antes de o agendador registrá-las
+	inflight int
+	running  int
+	waiting  int
+}
+
+// NewFetchPlanner cria o planejador. maxConns é o teto de buscas simultâneas
+// (as conexões ociosas mantidas por host) e marginPct, a parte de cada classe
+// que fica livre.
+func NewFetchPlanner(weights *WeightScheduler, limits *ConcurrencyLimiter, maxConns, marginPct int) *FetchPlanner {
+	if maxConns <= 0 {
+		maxConns = defaultUpstreamIdleConns
+	}
+	marginPct = max(0, marginPct)
+	if marginPct >= 100 {
+		marginPct = defaultPlannerMarginPct
+	}
+	return &FetchPlanner{
+		weights:   weights,
+		limits:    limits,
+		maxConns:  maxConns,
+		marginPct: marginPct,
+		margin:    float64(marginPct) / 100,
+	}
+}
+
+// FetchPlan é a decisão do planejador para um lote
+type FetchPlan struct {
+	Endpoint    string `json:"endpoint"`
+	Tasks       int    `json:"tasks"`
+	Weight      int    `json:"weight"`
+	Headroom    int    `json:"headroom"`
+	Concurrency int    `json:"concurrency"`
+}
+
+// headroom é a folga da classe descontado o peso das buscas em andamento
+func (f *FetchPlanner) headroom(p Priority) (int, time.Duration) {
+	available, reset := f.weights.Headroom(p, f.margin)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return max(0, available-f.inflight), reset
+}
+
+// Plan calcula a concorrência de tasks buscas de weight cada ao endpoint
+// (path após /api/v3). Nunca é menor que 1: sem folga, as buscas saem uma a
+// uma conforme Wait libera.
+func (f *FetchPlanner) Plan(p Priority, endpoint string, tasks, weight int) FetchPlan {
+	weight = max(1, weight)
+	headroom, _ := f.headroom(p)
+	concurrency := min(tasks, f.maxConns)
+	if free, ok := f.limits.Free(endpoint); ok {
+		// O limite por path recusa o excesso na hora, sem fila
+		concurrency = min(concurrency, free)
+	}
+	concurrency = max(1, min(concurrency, headroom/weight))
+	return FetchPlan{Endpoint: endpoint, Tasks: tasks, Weight: weight, Headroom: headroom, Concurrency: concurrency}
+}
+
+// Wait espera até o peso caber na folga da classe do contexto e o reserva;
+// a função retornada libera a reserva quando a busca termina
+func (f *FetchPlanner) Wait(ctx context.Context, weight int) (func(), error) {
+	p := priorityFrom(ctx)
+	f.mu.Lock()
+	f.waiting++
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.waiting--
+		f.mu.Unlock()
+	}()
+	for {
+		available, reset := f.weights.Headroom(p, f.margin)
+		f.mu.Lock()
+		// Uma busca maior que a folga inteira da classe sai sozinha
+		if weight <= available-f.inflight || (f.inflight == 0 && available == f.capacity(p)) {
+			f.inflight += weight
+			f.running++
+			f.mu.Unlock()
+			return func() {
+				f.mu.Lock()
+				f.inflight -= weight
+				f.running--
+				f.mu.Unlock()
+			}, nil
+		}
+		f.mu.Unlock()
+		wait := plannerRecheck
+		if reset < wait {
+			wait = reset + time.Millisecond
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// capacity é a parte da classe descontada a margem
+func (f *FetchPlanner) capacity(p Priority) int {
+	return int(float64(f.weights.limit) * priorityShares[p] * (1 - f.margin))
+}
+
+// Run executa tasks buscas de weight cada ao endpoint com a concorrência do
+// plano, liberando cada uma por Wait, e retorna o erro de cada busca
+func (f *FetchPlanner) Run(ctx context.Context, endpoint string, tasks, weight int, fetch func(ctx context.Context, i int) error) []error {
+	errs := make([]error, tasks)
+	plan := f.Plan(priorityFrom(ctx), endpoint, tasks, weight)
+	next := make(chan int, tasks)
+	for i := 0; i < tasks; i++ {
+		next <- i
+	}
+	close(next)
+	var wg sync.WaitGroup
+	for w := 0; w < plan.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				release, err := f.Wait(ctx, plan.Weight)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				errs[i] = fetch(ctx, i)
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// PlannerStatus é a fotografia do planejador em /ratelimit/status
+type PlannerStatus struct {
+	MaxConns  int `json:"maxConns"`
+	MarginPct int `json:"marginPct"`
+	Inflight  int `json:"inflightWeight"`
+	Running   int `json:"running"`
+	Waiting   int `json:"waiting"`
+}
+
+// Status retorna a ocupação atual do planejador
+func (f *FetchPlanner) Status() PlannerStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return PlannerStatus{
+		MaxConns:  f.maxConns,
+		MarginPct: f.marginPct,
+		Inflight:  f.inflight,
+		Running:   f.running,
+		Waiting:   f.waiting,
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"plugin"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// Plugin é uma extensão do proxy. Implementa RequestHook, ResponseHook ou os
+// dois. As assinaturas usam só tipos do gin e da biblioteca padrão para que
+// plugins compilados à parte (go build -buildmode=plugin) possam implementá-las.
+type Plugin interface {
+	Name() string
+}
+
+// RequestHook roda antes do handler. Pode alterar c.Request (query, headers)
+// ou responder e chamar c.Abort(); um erro vira 400 com a mensagem do erro.
+type RequestHook interface {
+	BeforeRequest(c *gin.Context) error
+}
+
+// ResponseHook recebe o status e o corpo de respostas JSON já completas e
+// retorna os que serão enviados. Headers podem ser alterados em c.Writer.Header().
+type ResponseHook interface {
+	AfterResponse(c *gin.Context, status int, body []byte) (int, []byte, error)
+}
+
+// DoneHook é chamado ao fim de toda requisição em que o plugin atuou, mesmo
+// quando a resposta não passou por AfterResponse; serve para liberar recursos
+type DoneHook interface {
+	Done(c *gin.Context)
+}
+
+// pluginTenantKey guarda no gin.Context o tenant da requisição (ou anonymous)
+const pluginTenantKey = "plugin.tenant"
+
+// PluginFactory cria um plugin a partir do bloco config de PLUGINS_FILE
+type PluginFactory func(config map[string]interface{}) (Plugin, error)
+
+// pluginSymbol é o símbolo NewPlugin exportado pelos arquivos .so
+type pluginSymbol = func(config map[string]interface{}) (interface{}, error)
+
+var (
+	pluginRegistryMu sync.RWMutex
+	pluginRegistry   = map[string]PluginFactory{}
+)
+
+// RegisterPlugin registra um plugin em tempo de compilação, em geral no init()
+// de um arquivo do próprio pacote
+func RegisterPlugin(name string, factory PluginFactory) {
+	pluginRegistryMu.Lock()
+	defer pluginRegistryMu.Unlock()
+	if _, exists := pluginRegistry[name]; exists {
+		panic("plugin registrado duas vezes: " + name)
+	}
+	pluginRegistry[name] = factory
+}
+
+func registeredPlugin(name string) (PluginFactory, bool) {
+	pluginRegistryMu.RLock()
+	defer pluginRegistryMu.RUnlock()
+	factory, ok := pluginRegistry[name]
+	return factory, ok
+}
+
+// PluginConfig é um plugin de PLUGINS_FILE. Sem file, type (ou name, se
+// type for vazio) se refere a um plugin registrado com RegisterPlugin.
+type PluginConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Plugin registrado a instanciar; permite várias instâncias do mesmo tipo
+	Type string `yaml:"type" json:"type,omitempty"`
+	// Arquivo .so compilado com -buildmode=plugin, exportando NewPlugin
+	File string `yaml:"file" json:"file,omitempty"`
+	// Paths (path.Match, ex: /ticker/*) em que o plugin atua; vazio = todos
+	Paths []string `yaml:"paths" json:"paths,omitempty"`
+	// Tenants em que o plugin atua (anonymous = sem token); vazio = todos
+	Tenants []string               `yaml:"tenants" json:"tenants,omitempty"`
+	Config  map[string]interface{} `yaml:"config" json:"-"`
+}
+
+type pluginsFile struct {
+	Plugins []PluginConfig `yaml:"plugins"`
+}
+
+type loadedPlugin struct {
+	config   PluginConfig
+	plugin   Plugin
+	request  RequestHook
+	response ResponseHook
+	done     DoneHook
+}
+
+func (p *loadedPlugin) matches(requestPath, tenant string) bool {
+	if len(p.config.Tenants) > 0 && !slices.Contains(p.config.Tenants, tenant) {
+		return false
+	}
+	if len(p.config.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range p.config.Paths {
+		if ok, _ := path.Match(pattern, requestPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PluginChain aplica os plugins na ordem de PLUGINS_FILE: os ganchos de
+// requisição na ordem do arquivo e os de resposta na ordem inversa
+type PluginChain struct {
+	plugins []*loadedPlugin
+	// tenantOf identifica o tenant da requisição para o filtro tenants
+	tenantOf func(*http.Request) string
+}
+
+// LoadPlugins lê PLUGINS_FILE e instancia cada plugin, do registro ou do .so
+func LoadPlugins(file string, tenantOf func(*http.Request) string) (*PluginChain, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var parsed pluginsFile
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", file, err)
+	}
+
+	chain := &PluginChain{tenantOf: tenantOf}
+	seen := map[string]bool{}
+	for _, config := range parsed.Plugins {
+		if config.Name == "" {
+			return nil, fmt.Errorf("plugin sem name em %s", file)
+		}
+		if seen[config.Name] {
+			return nil, fmt.Errorf("plugin duplicado: %s", config.Name)
+		}
+		seen[config.Name] = true
+		for _, pattern := range config.Paths {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("plugin %s: path inválido %q", config.Name, pattern)
+			}
+		}
+		instance, err := newPlugin(config)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", config.Name, err)
+		}
+		loaded := &loadedPlugin{config: config, plugin: instance}
+		loaded.request, _ = instance.(RequestHook)
+		loaded.response, _ = instance.(ResponseHook)
+		loaded.done, _ = instance.(DoneHook)
+		if loaded.request == nil && loaded.response == nil {
+			return nil, fmt.Errorf("plugin %s não implementa BeforeRequest nem AfterResponse", config.Name)
+		}
+		chain.plugins = append(chain.plugins, loaded)
+	}
+	return chain, nil
+}
+
+func newPlugin(config PluginConfig) (Plugin, error) {
+	if config.File == "" {
+		kind := config.Type
+		if kind == "" {
+			kind = config.Name
+		}
+		factory, ok := registeredPlugin(kind)
+		if !ok {
+			return nil, fmt.Errorf("plugin %s não registrado (disponíveis: %s)", kind, strings.Join(registeredPluginNames(), ", "))
+		}
+		return factory(config.Config)
+	}
+
+	lib, err := plugin.Open(config.File)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := lib.Lookup("NewPlugin")
+	if err != nil {
+		return nil, err
+	}
+	constructor, ok := symbol.(pluginSymbol)
+	if !ok {
+		return nil, fmt.Errorf("%s: NewPlugin deve ser func(map[string]interface{}) (interface{}, error)", config.File)
+	}
+	value, err := constructor(config.Config)
+	if err != nil {
+		return nil, err
+	}
+	instance, ok := value.(Plugin)
+	if !ok {
+		return nil, fmt.Errorf("%s: NewPlugin não retornou um Plugin (falta Name() string)", config.File)
+	}
+	return instance, nil
+}
+
+func registeredPluginNames() []string {
+	pluginRegistryMu.RLock()
+	defer pluginRegistryMu.RUnlock()
+	names := make([]string, 0, len(pluginRegistry))
+	for name := range pluginRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Middleware aplica os plugins às rotas do proxy; Swagger, /admin e
+// conexões WebSocket ficam de fora
+func (pc *PluginChain) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestPath := c.Request.URL.Path
+		if strings.HasPrefix(requestPath, "/swagger/") || strings.HasPrefix(requestPath, "/admin/") || c.IsWebsocket() {
+			c.Next()
+			return
+		}
+
+		tenant := pc.tenantOf(c.Request)
+		c.Set(pluginTenantKey, tenant)
+
+		var responseHooks []*loadedPlugin
+		for _, p := range pc.plugins {
+			if !p.matches(requestPath, tenant) {
+				continue
+			}
+			if p.done != nil {
+				defer p.done.Done(c)
+			}
+			if p.request != nil {
+				var err error
+				callPlugin(p.config.Name, func() { err = p.request.BeforeRequest(c) })
+				if err != nil {
+					respondError(c, http.StatusBadRequest, -1100, err.Error())
+					c.Abort()
+					return
+				}
+				if c.IsAborted() {
+					return
+				}
+			}
+			if p.response != nil {
+				responseHooks = append(responseHooks, p)
+			}
+		}
+		if len(responseHooks) == 0 {
+			c.Next()
+			return
+		}
+
+		writer := &jsonBufferWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if !writer.decided {
+			writer.ResponseWriter.WriteHeader(writer.status)
+			return
+		}
+		if !writer.buffering {
+			return
+		}
+		status, body := writer.status, writer.buf.Bytes()
+		for i := len(responseHooks) - 1; i >= 0; i-- {
+			var err error
+			hook := responseHooks[i]
+			callPlugin(hook.config.Name, func() { status, body, err = hook.response.AfterResponse(c, status, body) })
+			if err != nil {
+				msg := "plugin " + responseHooks[i].config.Name + ": " + err.Error()
+				writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+				status = http.StatusBadGateway
+				body, _ = json.Marshal(gin.H{"code": -1000, "msg": msg, "message": msg})
+				break
+			}
+		}
+		writer.Header().Del("Content-Length")
+		writer.ResponseWriter.WriteHeader(status)
+		writer.ResponseWriter.Write(body)
+	}
+}
+
+// PluginStatus é a visão de um plugin em /admin/plugins
+type PluginStatus struct {
+	PluginConfig
+	Source string   `json:"source"`
+	Hooks  []string `json:"hooks"`
+}
+
+// ListPlugins lista os plugins carregados
+// @Summary Plugins carregados
+// @Description Lista os plugins de PLUGINS_FILE na ordem de execução, com origem e ganchos
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/plugins [get]
+func (p *ProxyServer) ListPlugins(c *gin.Context) {
+	plugins := []PluginStatus{}
+	if p.plugins != nil {
+		for _, loaded := range p.plugins.plugins {
+			status := PluginStatus{PluginConfig: loaded.config, Source: "builtin"}
+			if loaded.config.File != "" {
+				status.Source = "file"
+			}
+			if loaded.request != nil {
+				status.Hooks = append(status.Hooks, "request")
+			}
+			if loaded.response != nil {
+				status.Hooks = append(status.Hooks, "response")
+			}
+			plugins = append(plugins, status)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"plugins":   plugins,
+		"available": registeredPluginNames(),
+	})
+}
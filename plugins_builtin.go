@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// Plugins que já vêm no binário; servem também de exemplo para RegisterPlugin
+func init() {
+	RegisterPlugin("headers", newHeadersPlugin)
+	RegisterPlugin("deny-symbols", newDenySymbolsPlugin)
+}
+
+// decodePluginConfig converte o bloco config do YAML na struct do plugin
+func decodePluginConfig(config map[string]interface{}, out interface{}) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("config inválido: %w", err)
+	}
+	return nil
+}
+
+// headersPlugin define headers na requisição recebida, antes dos handlers
+// (ex: X-Priority), e na resposta ao cliente
+type headersPlugin struct {
+	Request        map[string]string `yaml:"request"`
+	Response       map[string]string `yaml:"response"`
+	RemoveResponse []string          `yaml:"remove_response"`
+}
+
+func newHeadersPlugin(config map[string]interface{}) (Plugin, error) {
+	p := &headersPlugin{}
+	if err := decodePluginConfig(config, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *headersPlugin) Name() string { return "headers" }
+
+func (p *headersPlugin) BeforeRequest(c *gin.Context) error {
+	for name, value := range p.Request {
+		c.Request.Header.Set(name, value)
+	}
+	return nil
+}
+
+func (p *headersPlugin) AfterResponse(c *gin.Context, status int, body []byte) (int, []byte, error) {
+	for name, value := range p.Response {
+		c.Writer.Header().Set(name, value)
+	}
+	for _, name := range p.RemoveResponse {
+		c.Writer.Header().Del(name)
+	}
+	return status, body, nil
+}
+
+// denySymbolsPlugin recusa requisições com símbolos fora da política
+// (symbol ou symbols na query)
+type denySymbolsPlugin struct {
+	Symbols []string `yaml:"symbols"`
+	// Com allow, só os símbolos listados são aceitos
+	Allow bool `yaml:"allow"`
+	list  map[string]bool
+}
+
+func newDenySymbolsPlugin(config map[string]interface{}) (Plugin, error) {
+	p := &denySymbolsPlugin{}
+	if err := decodePluginConfig(config, p); err != nil {
+		return nil, err
+	}
+	if len(p.Symbols) == 0 {
+		return nil, fmt.Errorf("symbols é obrigatório")
+	}
+	p.list = map[string]bool{}
+	for _, symbol := range p.Symbols {
+		p.list[strings.ToUpper(symbol)] = true
+	}
+	return p, nil
+}
+
+func (p *denySymbolsPlugin) Name() string { return "deny-symbols" }
+
+func (p *denySymbolsPlugin) BeforeRequest(c *gin.Context) error {
+	var symbols []string
+	if symbol := c.Query("symbol"); symbol != "" {
+		symbols = append(symbols, symbol)
+	}
+	if raw := c.Query("symbols"); raw != "" {
+		for _, symbol := range strings.Split(strings.Trim(raw, "[]"), ",") {
+			symbols = append(symbols, strings.Trim(strings.TrimSpace(symbol), `"`))
+		}
+	}
+	for _, symbol := range symbols {
+		if p.list[strings.ToUpper(symbol)] != p.Allow {
+			return fmt.Errorf("símbolo %s não permitido neste proxy", symbol)
+		}
+	}
+	return nil
+}
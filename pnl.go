@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	myTradesPageLimit  = 1000
+	defaultPnLMaxPages = 50
+	pnlMethodFIFO      = "fifo"
+	pnlMethodAverage   = "average"
+)
+
+// myTrade é um item da resposta de /api/v3/myTrades
+type myTrade struct {
+	ID              int64  `json:"id"`
+	OrderID         int64  `json:"orderId"`
+	Price           string `json:"price"`
+	Qty             string `json:"qty"`
+	QuoteQty        string `json:"quoteQty"`
+	Commission      string `json:"commission"`
+	CommissionAsset string `json:"commissionAsset"`
+	Time            int64  `json:"time"`
+	IsBuyer         bool   `json:"isBuyer"`
+	IsMaker         bool   `json:"isMaker"`
+}
+
+// pnlLot é um lote de compra ainda em posição (custo unitário na moeda de cotação)
+type pnlLot struct {
+	qty  float64
+	cost float64
+}
+
+// pnlReport é o relatório de lucro/prejuízo de um símbolo
+type pnlReport struct {
+	Symbol           string            `json:"symbol"`
+	BaseAsset        string            `json:"baseAsset"`
+	QuoteAsset       string            `json:"quoteAsset"`
+	Method           string            `json:"method"`
+	Since            int64             `json:"since,omitempty"`
+	TradesCount      int               `json:"tradesCount"`
+	FirstTradeTime   int64             `json:"firstTradeTime,omitempty"`
+	LastTradeTime    int64             `json:"lastTradeTime,omitempty"`
+	BuyQty           string            `json:"buyQty"`
+	SellQty          string            `json:"sellQty"`
+	Position         string            `json:"position"`
+	AvgCost          string            `json:"avgCost"`
+	CurrentPrice     string            `json:"currentPrice"`
+	RealizedPnL      string            `json:"realizedPnl"`
+	UnrealizedPnL    string            `json:"unrealizedPnl"`
+	OtherFeesQuote   string            `json:"otherFeesQuote"`
+	TotalPnL         string            `json:"totalPnl"`
+	Fees             map[string]string `json:"fees"`
+	UnmatchedSellQty string            `json:"unmatchedSellQty"`
+	Truncated        bool              `json:"truncated"`
+}
+
+// fetchMyTrades pagina /myTrades do tenant. Com since, localiza o primeiro
+// trade usando janelas de 24h (limite da Binance para startTime/endTime) e
+// depois segue paginando por fromId. Retorna truncated=true se o limite de
+// páginas foi atingido antes do fim do histórico.
+func (p *ProxyServer) fetchMyTrades(ctx context.Context, tenant *Tenant, symbol string, since time.Time, maxPages int) ([]myTrade, bool, error) {
+	pages := 0
+	fetch := func(params url.Values) ([]myTrade, error) {
+		pages++
+		params.Set("symbol", symbol)
+		params.Set("limit", strconv.Itoa(myTradesPageLimit))
+		body, err := p.signedRequest(ctx, tenant, http.MethodGet, "/api/v3/myTrades", params)
+		if err != nil {
+			return nil, err
+		}
+		var page []myTrade
+		err = json.Unmarshal(body, &page)
+		return page, err
+	}
+
+	fromID := int64(0)
+	if !since.IsZero() {
+		fromID = -1
+		now := time.Now()
+		for start := since; start.Before(now) && pages < maxPages; start = start.Add(24 * time.Hour) {
+			page, err := fetch(url.Values{
+				"startTime": {strconv.FormatInt(start.UnixMilli(), 10)},
+				"endTime":   {strconv.FormatInt(start.Add(24*time.Hour).UnixMilli()-1, 10)},
+			})
+			if err != nil {
+				return nil, false, err
+			}
+			if len(page) > 0 {
+				fromID = page[0].ID
+				break
+			}
+		}
+		if fromID < 0 {
+			return nil, pages >= maxPages, nil
+		}
+	}
+
+	var trades []myTrade
+	for pages < maxPages {
+		page, err := fetch(url.Values{"fromId": {strconv.FormatInt(fromID, 10)}})
+		if err != nil {
+			return nil, false, err
+		}
+		trades = append(trades, page...)
+		if len(page) < myTradesPageLimit {
+			return trades, false, nil
+		}
+		fromID = page[len(page)-1].ID + 1
+	}
+	return trades, true, nil
+}
+
+// computePnL calcula PnL realizado e não realizado pelo método FIFO ou custo
+// médio. Comissões no ativo base ou de cotação entram no custo/receita; as
+// pagas em outros ativos (ex: BNB) são convertidas com toQuote e reportadas à parte.
+func computePnL(report *pnlReport, trades []myTrade, currentPrice float64, toQuote func(asset string, amount float64) (float64, bool)) {
+	var (
+		lots                []pnlLot
+		position, avgCost   float64
+		buyQty, sellQty     float64
+		realized, otherFees float64
+		unmatched           float64
+		fees                = make(map[string]float64)
+		fifo                = report.Method == pnlMethodFIFO
+		base, quote         = report.BaseAsset, report.QuoteAsset
+	)
+
+	for _, t := range trades {
+		qty, _ := strconv.ParseFloat(t.Qty, 64)
+		quoteQty, _ := strconv.ParseFloat(t.QuoteQty, 64)
+		commission, _ := strconv.ParseFloat(t.Commission, 64)
+		if qty <= 0 {
+			continue
+		}
+		if commission > 0 {
+			fees[t.CommissionAsset] += commission
+		}
+
+		baseFee, quoteFee := 0.0, 0.0
+		switch t.CommissionAsset {
+		case base:
+			baseFee = commission
+		case quote:
+			quoteFee = commission
+		default:
+			if converted, ok := toQuote(t.CommissionAsset, commission); ok {
+				otherFees += converted
+			}
+		}
+
+		if t.IsBuyer {
+			buyQty += qty
+			acquired := qty - baseFee
+			if acquired <= 0 {
+				continue
+			}
+			unitCost := (quoteQty + quoteFee) / acquired
+			if fifo {
+				lots = append(lots, pnlLot{qty: acquired, cost: unitCost})
+			} else {
+				avgCost = (avgCost*position + unitCost*acquired) / (position + acquired)
+			}
+			position += acquired
+			continue
+		}
+
+		sellQty += qty
+		unitProceeds := (quoteQty - quoteFee) / qty
+		remaining := qty + baseFee
+		if fifo {
+			for remaining > 0 && len(lots) > 0 {
+				take := remaining
+				if lots[0].qty < take {
+					take = lots[0].qty
+				}
+				realized += (unitProceeds - lots[0].cost) * take
+				lots[0].qty -= take
+				remaining -= take
+				position -= take
+				if lots[0].qty <= 1e-12 {
+					lots = lots[1:]
+				}
+			}
+		} else {
+			take := remaining
+			if position < take {
+				take = position
+			}
+			realized += (unitProceeds - avgCost) * take
+			position -= take
+			remaining -= take
+		}
+		// Vendas sem compra correspondente no período (posição anterior a since)
+		unmatched += remaining
+	}
+
+	if fifo {
+		cost := 0.0
+		for _, lot := range lots {
+			cost += lot.qty * lot.cost
+		}
+		if position > 0 {
+			avgCost = cost / position
+		} else {
+			avgCost = 0
+		}
+	}
+	if position < 1e-12 {
+		position = 0
+	}
+
+	unrealized := 0.0
+	if currentPrice > 0 {
+		unrealized = (currentPrice - avgCost) * position
+	}
+
+	report.BuyQty = formatFloat(buyQty)
+	report.SellQty = formatFloat(sellQty)
+	report.Position = formatFloat(position)
+	report.AvgCost = formatFloat(avgCost)
+	report.CurrentPrice = formatFloat(currentPrice)
+	report.RealizedPnL = formatFloat(realized)
+	report.UnrealizedPnL = formatFloat(unrealized)
+	report.OtherFeesQuote = formatFloat(otherFees)
+	report.TotalPnL = formatFloat(realized + unrealized - otherFees)
+	report.UnmatchedSellQty = formatFloat(unmatched)
+	report.Fees = make(map[string]string, len(fees))
+	for asset, amount := range fees {
+		report.Fees[asset] = formatFloat(amount)
+	}
+}
+
+// PnL calcula o lucro/prejuízo realizado e não realizado a partir do histórico de trades
+// @Summary PnL por símbolo
+// @Description Pagina /myTrades do tenant e calcula PnL realizado/não realizado (FIFO ou custo médio)
+// @Tags Account
+// @Produce json
+// @Param symbol query string true "Símbolo (ex: BTCUSDT)"
+// @Param since query integer false "Timestamp inicial (ms)"
+// @Param method query string false "fifo ou average"
+// @Success 200 {object} pnlReport
+// @Failure 401 {object} map[string]interface{}
+// @Router /local/pnl [get]
+func (p *ProxyServer) PnL(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+
+	symbols, err := normalizeSymbols([]string{c.Query("symbol")})
+	if err != nil || len(symbols) == 0 {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetro obrigatório 'symbol' ausente ou inválido")
+		return
+	}
+	symbol := symbols[0]
+
+	method := strings.ToLower(c.DefaultQuery("method", getEnv("PNL_METHOD", pnlMethodFIFO)))
+	if method != pnlMethodFIFO && method != pnlMethodAverage {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'method' deve ser 'fifo' ou 'average'")
+		return
+	}
+
+	var since time.Time
+	if raw := c.Query("since"); raw != "" {
+		ms, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || ms <= 0 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'since' deve ser um timestamp em milissegundos")
+			return
+		}
+		since = time.UnixMilli(ms)
+	}
+
+	ctx := c.Request.Context()
+	info, err := p.market.ExchangeInfo(ctx)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter exchangeInfo: "+err.Error())
+		return
+	}
+	symbolInfo, ok := info.Symbol(symbol)
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1121, "Símbolo inválido: "+symbol)
+		return
+	}
+
+	trades, truncated, err := p.fetchMyTrades(ctx, tenant, symbol, since, getEnvInt("PNL_MAX_PAGES", defaultPnLMaxPages))
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	prices, err := p.market.Prices(ctx)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter preços da Binance: "+err.Error())
+		return
+	}
+	exists := func(s string) bool {
+		_, ok := prices[s]
+		return ok
+	}
+	toQuote := func(asset string, amount float64) (float64, bool) {
+		for _, path := range findConversionPaths(exists, asset, symbolInfo.QuoteAsset) {
+			rate, err := conversionRate(path, func(s string) (float64, error) { return prices[s], nil })
+			if err == nil {
+				return amount * rate, true
+			}
+		}
+		return 0, false
+	}
+
+	report := &pnlReport{
+		Symbol:      symbol,
+		BaseAsset:   symbolInfo.BaseAsset,
+		QuoteAsset:  symbolInfo.QuoteAsset,
+		Method:      method,
+		TradesCount: len(trades),
+		Truncated:   truncated,
+	}
+	if !since.IsZero() {
+		report.Since = since.UnixMilli()
+	}
+	if len(trades) > 0 {
+		report.FirstTradeTime = trades[0].Time
+		report.LastTradeTime = trades[len(trades)-1].Time
+	}
+	computePnL(report, trades, prices[symbol], toQuote)
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultPollTimeout  = 30 * time.Second
+	maxPollTimeout      = 5 * time.Minute
+)
+
+// pollWatch acompanha uma consulta (endpoint + query) enquanto houver
+// clientes esperando por ela em /poll. Uma única goroutine consulta a
+// Binance e acorda os clientes quando a resposta muda.
+type pollWatch struct {
+	mu      sync.Mutex
+	fetched bool
+	etag    string
+	body    []byte
+	err     error
+	// changed é fechado (e trocado) a cada nova versão
+	changed chan struct{}
+
+	waiters int
+	stop    chan struct{}
+}
+
+// PollHub mantém os pollWatch ativos, um por consulta
+type PollHub struct {
+	proxy    *ProxyServer
+	interval time.Duration
+
+	mu      sync.Mutex
+	watches map[string]*pollWatch
+}
+
+// NewPollHub cria o hub. As consultas à Binance acontecem a cada interval,
+// ou na validade da rota em RESPONSE_CACHE_ROUTES, quando houver.
+func NewPollHub(proxy *ProxyServer, interval time.Duration) *PollHub {
+	return &PollHub{proxy: proxy, interval: interval, watches: map[string]*pollWatch{}}
+}
+
+// acquire registra um cliente na consulta, iniciando o monitor se preciso
+func (h *PollHub) acquire(endpoint string, query url.Values) (string, *pollWatch) {
+	key := endpoint + "?" + query.Encode()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.watches[key]
+	if !ok {
+		w = &pollWatch{changed: make(chan struct{}), stop: make(chan struct{})}
+		h.watches[key] = w
+		go h.run(w, endpoint, query)
+	}
+	w.waiters++
+	return key, w
+}
+
+// release retira o cliente; sem clientes, o monitor para
+func (h *PollHub) release(key string, w *pollWatch) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if w.waiters--; w.waiters == 0 {
+		close(w.stop)
+		delete(h.watches, key)
+	}
+}
+
+func (h *PollHub) run(w *pollWatch, endpoint string, query url.Values) {
+	interval := h.interval
+	if rc := h.proxy.responses; rc != nil {
+		if ttl := rc.ttlFor(endpoint); ttl > 0 {
+			interval = ttl
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval+writeTimeout)
+		body, err := h.proxy.fetchUpstream(ctx, endpoint, query)
+		cancel()
+		w.update(body, err)
+
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update registra o resultado da consulta, acordando os clientes se a
+// resposta mudou
+func (w *pollWatch) update(body []byte, err error) {
+	etag := ""
+	if err == nil {
+		etag = responseETag(body)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fetched && etag == w.etag && (err == nil) == (w.err == nil) {
+		return
+	}
+	w.fetched, w.etag, w.body, w.err = true, etag, body, err
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// parsePollTimeout aceita duração (30s) ou segundos (30), até maxPollTimeout
+func parsePollTimeout(value string) (time.Duration, bool) {
+	if value == "" {
+		return defaultPollTimeout, true
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, false
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if timeout <= 0 || timeout > maxPollTimeout {
+		return 0, false
+	}
+	return timeout, true
+}
+
+// Poll segura a requisição até a resposta do endpoint mudar em relação à
+// versão since (o ETag recebido antes) ou o timeout expirar
+// @Summary Long-polling de um endpoint
+// @Description Responde assim que a resposta do endpoint público (ex: ticker/price) tiver um ETag diferente de since; sem mudança até o timeout, responde 304. Sem since, responde a versão atual. Os demais parâmetros vão para a Binance.
+// @Tags Market Data
+// @Produce json
+// @Param endpoint path string true "Endpoint após /api/v3 (ex: ticker/price)"
+// @Param since query string false "ETag da última versão recebida"
+// @Param timeout query string false "Tempo máximo de espera (padrão 30s, máximo 5m)"
+// @Success 200 {object} interface{}
+// @Router /poll/{endpoint} [get]
+func (p *ProxyServer) Poll(c *gin.Context) {
+	endpoint := "/" + strings.Trim(c.Param("endpoint"), "/")
+	for _, prefix := range privateEndpointPrefixes {
+		if strings.HasPrefix(endpoint, prefix) {
+			respondError(c, http.StatusBadRequest, -1100, "Endpoint privado não pode ser acompanhado por /poll: "+endpoint)
+			return
+		}
+	}
+	query := c.Request.URL.Query()
+	since := query.Get("since")
+	if since == "" {
+		since = c.GetHeader("If-None-Match")
+	}
+	since = strings.Trim(strings.TrimPrefix(strings.TrimSpace(since), "W/"), `"`)
+	timeout, ok := parsePollTimeout(query.Get("timeout"))
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'timeout' inválido (máximo "+maxPollTimeout.String()+")")
+		return
+	}
+	query.Del("since")
+	query.Del("timeout")
+
+	// A resposta pode demorar mais que o WriteTimeout do servidor
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(timeout + writeTimeout))
+
+	key, w := p.polls.acquire(endpoint, query)
+	defer p.polls.release(key, w)
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		w.mu.Lock()
+		fetched, etag, body, err, changed := w.fetched, w.etag, w.body, w.err, w.changed
+		w.mu.Unlock()
+
+		switch {
+		case fetched && err != nil:
+			respondUpstreamError(c, err)
+			return
+		case fetched && strings.Trim(etag, `"`) != since:
+			c.Header("ETag", etag)
+			c.Data(http.StatusOK, "application/json", body)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			if etag != "" {
+				c.Header("ETag", etag)
+			}
+			c.Status(http.StatusNotModified)
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPortfolioQuote = "USDT"
+	maxPortfolioHoldings  = 200
+)
+
+type portfolioHolding struct {
+	Asset  string    `json:"asset"`
+	Amount flexFloat `json:"amount"`
+}
+
+type portfolioRequest struct {
+	Holdings []portfolioHolding `json:"holdings"`
+	Quote    string             `json:"quote"`
+	// Timestamp opcional (ms) para avaliar a carteira em um instante passado
+	Timestamp int64 `json:"timestamp"`
+}
+
+// historicalQuote é o preço de um símbolo no instante pedido, ou o motivo
+// de não haver preço
+type historicalQuote struct {
+	price float64
+	err   error
+}
+
+type portfolioAssetValue struct {
+	Asset  string   `json:"asset"`
+	Amount string   `json:"amount"`
+	Price  string   `json:"price"`
+	Value  string   `json:"value"`
+	Share  string   `json:"share"`
+	Path   []string `json:"path"`
+	value  float64
+}
+
+// PortfolioValue calcula o valor de uma carteira na moeda de cotação escolhida
+// @Summary Avaliação de carteira
+// @Description Avalia uma lista de ativos usando o cache de preços (ou candles históricos quando timestamp é informado)
+// @Tags Portfolio
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /portfolio/value [post]
+func (p *ProxyServer) PortfolioValue(c *gin.Context) {
+	var req portfolioRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "JSON inválido: "+err.Error())
+		return
+	}
+	if len(req.Holdings) == 0 {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetro obrigatório 'holdings' não informado")
+		return
+	}
+	if len(req.Holdings) > maxPortfolioHoldings {
+		respondError(c, http.StatusBadRequest, -1100, fmt.Sprintf("Máximo de %d ativos por carteira", maxPortfolioHoldings))
+		return
+	}
+
+	quote := normalizeAsset(req.Quote)
+	if quote == "" {
+		quote = defaultPortfolioQuote
+	}
+
+	ctx := c.Request.Context()
+	prices, err := p.market.Prices(ctx)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter preços da Binance: "+err.Error())
+		return
+	}
+	exists := func(symbol string) bool {
+		_, ok := prices[symbol]
+		return ok
+	}
+
+	// Preço atual (cache) ou preço histórico no timestamp solicitado
+	price := func(symbol string) (float64, error) {
+		return prices[symbol], nil
+	}
+	var (
+		at     time.Time
+		traded func(symbol string) bool
+	)
+	if req.Timestamp > 0 {
+		at = time.UnixMilli(req.Timestamp)
+		if at.After(time.Now()) {
+			respondError(c, http.StatusBadRequest, -1100, "timestamp não pode estar no futuro")
+			return
+		}
+		// Um par retirado de negociação depois de at não está na lista atual
+		// de preços, mas tinha candle naquele instante: é isso que decide se
+		// ele existia. O resultado de cada símbolo vale para toda a carteira.
+		candles := map[string]historicalQuote{}
+		price = func(symbol string) (float64, error) {
+			cached, ok := candles[symbol]
+			if !ok {
+				cached.price, cached.err = p.market.HistoricalPrice(ctx, symbol, at)
+				candles[symbol] = cached
+			}
+			return cached.price, cached.err
+		}
+		traded = func(symbol string) bool {
+			_, err := price(symbol)
+			return err == nil
+		}
+	}
+
+	// Agregar quantidades do mesmo ativo
+	amounts := make(map[string]float64)
+	order := []string{}
+	for _, h := range req.Holdings {
+		asset := normalizeAsset(h.Asset)
+		if asset == "" {
+			respondError(c, http.StatusBadRequest, -1102, "Ativo sem nome em 'holdings'")
+			return
+		}
+		if _, seen := amounts[asset]; !seen {
+			order = append(order, asset)
+		}
+		amounts[asset] += float64(h.Amount)
+	}
+
+	assets := make([]*portfolioAssetValue, 0, len(order))
+	unpriced := []string{}
+	total := 0.0
+	for _, asset := range order {
+		amount := amounts[asset]
+		// Primeiro pelos pares listados hoje; no histórico, sem caminho por
+		// eles, procura os pares que tinham candle no instante pedido
+		rate, path, found := bestConversion(exists, price, asset, quote)
+		if !found && traded != nil {
+			rate, path, found = bestConversion(traded, price, asset, quote)
+		}
+		if !found {
+			unpriced = append(unpriced, asset)
+			continue
+		}
+
+		value := amount * rate
+		total += value
+		assets = append(assets, &portfolioAssetValue{
+			Asset:  asset,
+			Amount: formatFloat(amount),
+			Price:  formatFloat(rate),
+			Value:  formatFloat(value),
+			Path:   pathSymbols(path),
+			value:  value,
+		})
+	}
+
+	for _, a := range assets {
+		share := 0.0
+		if total > 0 {
+			share = a.value / total * 100
+		}
+		a.Share = strconv.FormatFloat(share, 'f', 2, 64)
+	}
+
+	response := gin.H{
+		"quote":    quote,
+		"total":    formatFloat(total),
+		"assets":   assets,
+		"unpriced": unpriced,
+	}
+	if !at.IsZero() {
+		response["timestamp"] = at.UnixMilli()
+	}
+	c.JSON(http.StatusOK, response)
+}
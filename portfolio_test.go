@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newPortfolioTestProxy aponta o proxy para um upstream falso em que
+// LUNAUSDT já foi retirado (fora de /ticker/price, mas com candles antigos)
+// e NEWUSDT só foi listado depois do instante avaliado
+func newPortfolioTestProxy(t *testing.T, at time.Time) *ProxyServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	minute := at.Truncate(time.Minute).UnixMilli()
+	candles := map[string]string{"ETHUSDT": "2000", "LUNAUSDT": "80"}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/api/v3/ticker/price":
+			w.Write([]byte(`[{"symbol":"ETHUSDT","price":"3000"},{"symbol":"NEWUSDT","price":"5"}]`))
+		case "/api/v3/klines":
+			symbol := query.Get("symbol")
+			start, _ := strconv.ParseInt(query.Get("startTime"), 10, 64)
+			end, _ := strconv.ParseInt(query.Get("endTime"), 10, 64)
+			switch {
+			case symbol == "NEWUSDT":
+				// Listado depois: só há candles após o intervalo pedido
+				if end == 0 {
+					fmt.Fprintf(w, `[[%d,"5","5","5","5"]]`, minute+int64(time.Hour/time.Millisecond))
+					return
+				}
+				w.Write([]byte(`[]`))
+			case candles[symbol] != "" && start <= minute && (end == 0 || minute <= end):
+				fmt.Fprintf(w, `[[%d,"%s","1","1","1"]]`, minute, candles[symbol])
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	p := NewProxyServer()
+	p.binanceURL = upstream.URL + "/api/v3"
+	p.client = newUpstreamClient(p, nil)
+	return p
+}
+
+func postPortfolio(t *testing.T, p *ProxyServer, body string) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/portfolio/value", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	p.PortfolioValue(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestPortfolioHistoricalValuesDelistedPairs(t *testing.T) {
+	at := time.Now().Add(-24 * time.Hour)
+	p := newPortfolioTestProxy(t, at)
+
+	resp := postPortfolio(t, p, fmt.Sprintf(`{"holdings":[{"asset":"LUNA","amount":"2"},{"asset":"ETH","amount":1},{"asset":"NEW","amount":"10"}],"timestamp":%d}`, at.UnixMilli()))
+
+	values := map[string]string{}
+	for _, raw := range resp["assets"].([]interface{}) {
+		asset := raw.(map[string]interface{})
+		values[asset["asset"].(string)] = asset["value"].(string)
+	}
+	if values["LUNA"] != "160" {
+		t.Errorf("LUNA (par retirado) = %q, esperado 160", values["LUNA"])
+	}
+	if values["ETH"] != "2000" {
+		t.Errorf("ETH = %q, esperado o candle histórico 2000", values["ETH"])
+	}
+	unpriced := resp["unpriced"].([]interface{})
+	if len(unpriced) != 1 || unpriced[0] != "NEW" {
+		t.Errorf("unpriced = %v, esperado [NEW] (sem candle no instante pedido)", unpriced)
+	}
+	if resp["total"] != "2160" {
+		t.Errorf("total = %v, esperado 2160", resp["total"])
+	}
+}
+
+func TestPortfolioCurrentUsesPriceList(t *testing.T) {
+	p := newPortfolioTestProxy(t, time.Now())
+
+	resp := postPortfolio(t, p, `{"holdings":[{"asset":"ETH","amount":"1"},{"asset":"LUNA","amount":"2"}]}`)
+	if resp["total"] != "3000" {
+		t.Errorf("total = %v, esperado 3000", resp["total"])
+	}
+	unpriced := resp["unpriced"].([]interface{})
+	if len(unpriced) != 1 || unpriced[0] != "LUNA" {
+		t.Errorf("unpriced = %v, esperado [LUNA] fora do histórico", unpriced)
+	}
+}
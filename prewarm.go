@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPrewarmInterval = 30 * time.Second
+	prewarmPingTimeout     = 10 * time.Second
+	// Conexões ociosas mantidas por host da Binance (o http.DefaultTransport
+	// mantém só 2 e fecha as demais a cada pico de chamadas simultâneas)
+	defaultUpstreamIdleConns = 16
+	upstreamIdleConnTimeout  = 90 * time.Second
+)
+
+// newUpstreamTransport cria o transporte HTTP das chamadas à Binance, com
+// mais conexões ociosas por host que o padrão: pelo menos as PREWARM_CONNS
+// aquecidas, conectando pela política de família de endereço e com a
+// política TLS do proxy, que avisa em outages os pins recusados e os
+// certificados trocados
+func newUpstreamTransport(dial *UpstreamDialPolicy, tlsPolicy *UpstreamTLSPolicy, outages *OutageNotifier) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = max(defaultUpstreamIdleConns, getEnvInt("PREWARM_CONNS", 0))
+	transport.IdleConnTimeout = upstreamIdleConnTimeout
+	transport.DialContext = dial.dial
+	transport.TLSClientConfig = tlsPolicy.Config(outages)
+	return transport
+}
+
+// ConnWarmer mantém conexões TLS aquecidas com cada URL base da Binance
+// (PREWARM_URLS): a cada PREWARM_INTERVAL, dispara PREWARM_CONNS pings
+// simultâneos pelo cliente da Binance. Os pings reaproveitam as conexões
+// ociosas, o que as mantém vivas, e as que caíram são reabertas ali mesmo,
+// então a primeira ordem depois de um período parado não paga o handshake.
+type ConnWarmer struct {
+	client   *http.Client
+	conns    int
+	interval time.Duration
+	targets  []*prewarmTarget
+	cancel   context.CancelFunc
+}
+
+// PrewarmStatus é uma URL aquecida em /admin/upstreams
+type PrewarmStatus struct {
+	URL string `json:"url"`
+	// Conexões mantidas e as que responderam ao último ping
+	Conns int `json:"conns"`
+	Warm  int `json:"warm"`
+	// Conexões abertas pelo aquecimento (as que tinham caído ou expirado)
+	Opened int64 `json:"opened"`
+	// Momento do último ping (ms) e a maior latência dele
+	LastPing  int64   `json:"lastPing"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type prewarmTarget struct {
+	url    string
+	mu     sync.Mutex
+	status PrewarmStatus
+}
+
+// NewConnWarmer prepara o aquecimento das URLs base, separadas por vírgula
+func NewConnWarmer(client *http.Client, urls string, conns int, interval time.Duration) *ConnWarmer {
+	w := &ConnWarmer{client: client, conns: conns, interval: interval}
+	for _, base := range strings.Split(urls, ",") {
+		if base = strings.TrimRight(strings.TrimSpace(base), "/"); base != "" {
+			w.targets = append(w.targets, &prewarmTarget{url: base, status: PrewarmStatus{URL: base, Conns: conns}})
+		}
+	}
+	return w
+}
+
+// Start abre as conexões e passa a mantê-las até Close
+func (w *ConnWarmer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			w.warm(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close interrompe os pings; as conexões seguem no transporte até expirarem
+func (w *ConnWarmer) Close() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
+// warm pinga todas as URLs em paralelo
+func (w *ConnWarmer) warm(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, target := range w.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.warmTarget(ctx, target)
+		}()
+	}
+	wg.Wait()
+}
+
+// warmTarget dispara os pings da URL ao mesmo tempo e só fecha as respostas
+// quando todas chegaram: cada ping ocupa uma conexão diferente, então o
+// transporte fica com conns conexões ociosas ao final
+func (w *ConnWarmer) warmTarget(ctx context.Context, target *prewarmTarget) {
+	ctx, cancel := context.WithTimeout(withConsumer(withPriority(ctx, PriorityLow), "prewarm"), prewarmPingTimeout)
+	defer cancel()
+
+	type result struct {
+		resp    *http.Response
+		elapsed time.Duration
+		opened  bool
+		err     error
+	}
+	results := make([]result, w.conns)
+	var received sync.WaitGroup
+	for i := range results {
+		received.Add(1)
+		go func() {
+			defer received.Done()
+			r := &results[i]
+			trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) { r.opened = !info.Reused }}
+			req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, target.url+"/ping", nil)
+			if err != nil {
+				r.err = err
+				return
+			}
+			req.Header.Set("User-Agent", "Binance-Proxy/1.0")
+			start := time.Now()
+			r.resp, r.err = w.client.Do(req)
+			r.elapsed = time.Since(start)
+			if r.err == nil && r.resp.StatusCode != http.StatusOK {
+				r.err = fmt.Errorf("ping respondeu %d", r.resp.StatusCode)
+			}
+		}()
+	}
+	received.Wait()
+
+	status := PrewarmStatus{URL: target.url, Conns: w.conns, LastPing: time.Now().UnixMilli()}
+	var opened int64
+	for _, r := range results {
+		if r.resp != nil {
+			// Corpo lido até o fim: a conexão volta para o pool
+			io.Copy(io.Discard, r.resp.Body)
+			r.resp.Body.Close()
+		}
+		if r.opened {
+			opened++
+		}
+		if r.err != nil {
+			status.Error = r.err.Error()
+			continue
+		}
+		status.Warm++
+		status.LatencyMs = max(status.LatencyMs, float64(r.elapsed.Microseconds())/1000)
+	}
+	if status.Error != "" {
+		// log.Printf("[WARN] Aquecimento de conexões com %s: %s", target.url, status.Error)
+	}
+
+	target.mu.Lock()
+	status.Opened = target.status.Opened + opened
+	target.status = status
+	target.mu.Unlock()
+}
+
+// Status retorna o estado de cada URL aquecida
+func (w *ConnWarmer) Status() []PrewarmStatus {
+	statuses := make([]PrewarmStatus, 0, len(w.targets))
+	for _, target := range w.targets {
+		target.mu.Lock()
+		statuses = append(statuses, target.status)
+		target.mu.Unlock()
+	}
+	return statuses
+}
@@ -0,0 +1,4 @@
+// Package proxypb contém o código gerado a partir de proxy.proto.
+package proxypb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative proxy.proto
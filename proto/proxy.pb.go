@@ -0,0 +1,1617 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: proxy.proto
+
+// API gRPC do proxy Binance. Os valores decimais são strings, como na API
+// REST da Binance, para não perder precisão.
+
+package proxypb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetPricesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbols       []string               `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPricesRequest) Reset() {
+	*x = GetPricesRequest{}
+	mi := &file_proxy_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPricesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPricesRequest) ProtoMessage() {}
+
+func (x *GetPricesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPricesRequest.ProtoReflect.Descriptor instead.
+func (*GetPricesRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetPricesRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+type Price struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Price         string                 `protobuf:"bytes,2,opt,name=price,proto3" json:"price,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Price) Reset() {
+	*x = Price{}
+	mi := &file_proxy_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Price) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Price) ProtoMessage() {}
+
+func (x *Price) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Price.ProtoReflect.Descriptor instead.
+func (*Price) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Price) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Price) GetPrice() string {
+	if x != nil {
+		return x.Price
+	}
+	return ""
+}
+
+type GetPricesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prices        []*Price               `protobuf:"bytes,1,rep,name=prices,proto3" json:"prices,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPricesResponse) Reset() {
+	*x = GetPricesResponse{}
+	mi := &file_proxy_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPricesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPricesResponse) ProtoMessage() {}
+
+func (x *GetPricesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPricesResponse.ProtoReflect.Descriptor instead.
+func (*GetPricesResponse) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetPricesResponse) GetPrices() []*Price {
+	if x != nil {
+		return x.Prices
+	}
+	return nil
+}
+
+type GetOrderBookRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Symbol string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	// Número de níveis (padrão 100)
+	Limit         int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrderBookRequest) Reset() {
+	*x = GetOrderBookRequest{}
+	mi := &file_proxy_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrderBookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrderBookRequest) ProtoMessage() {}
+
+func (x *GetOrderBookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrderBookRequest.ProtoReflect.Descriptor instead.
+func (*GetOrderBookRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetOrderBookRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *GetOrderBookRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type BookLevel struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Price         string                 `protobuf:"bytes,1,opt,name=price,proto3" json:"price,omitempty"`
+	Quantity      string                 `protobuf:"bytes,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BookLevel) Reset() {
+	*x = BookLevel{}
+	mi := &file_proxy_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BookLevel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BookLevel) ProtoMessage() {}
+
+func (x *BookLevel) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BookLevel.ProtoReflect.Descriptor instead.
+func (*BookLevel) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BookLevel) GetPrice() string {
+	if x != nil {
+		return x.Price
+	}
+	return ""
+}
+
+func (x *BookLevel) GetQuantity() string {
+	if x != nil {
+		return x.Quantity
+	}
+	return ""
+}
+
+type OrderBook struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	LastUpdateId  int64                  `protobuf:"varint,2,opt,name=last_update_id,json=lastUpdateId,proto3" json:"last_update_id,omitempty"`
+	Bids          []*BookLevel           `protobuf:"bytes,3,rep,name=bids,proto3" json:"bids,omitempty"`
+	Asks          []*BookLevel           `protobuf:"bytes,4,rep,name=asks,proto3" json:"asks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrderBook) Reset() {
+	*x = OrderBook{}
+	mi := &file_proxy_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrderBook) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderBook) ProtoMessage() {}
+
+func (x *OrderBook) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderBook.ProtoReflect.Descriptor instead.
+func (*OrderBook) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *OrderBook) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *OrderBook) GetLastUpdateId() int64 {
+	if x != nil {
+		return x.LastUpdateId
+	}
+	return 0
+}
+
+func (x *OrderBook) GetBids() []*BookLevel {
+	if x != nil {
+		return x.Bids
+	}
+	return nil
+}
+
+func (x *OrderBook) GetAsks() []*BookLevel {
+	if x != nil {
+		return x.Asks
+	}
+	return nil
+}
+
+type GetKlinesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Interval      string                 `protobuf:"bytes,2,opt,name=interval,proto3" json:"interval,omitempty"`
+	Limit         int32                  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	StartTime     int64                  `protobuf:"varint,4,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	EndTime       int64                  `protobuf:"varint,5,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetKlinesRequest) Reset() {
+	*x = GetKlinesRequest{}
+	mi := &file_proxy_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetKlinesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetKlinesRequest) ProtoMessage() {}
+
+func (x *GetKlinesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetKlinesRequest.ProtoReflect.Descriptor instead.
+func (*GetKlinesRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetKlinesRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *GetKlinesRequest) GetInterval() string {
+	if x != nil {
+		return x.Interval
+	}
+	return ""
+}
+
+func (x *GetKlinesRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *GetKlinesRequest) GetStartTime() int64 {
+	if x != nil {
+		return x.StartTime
+	}
+	return 0
+}
+
+func (x *GetKlinesRequest) GetEndTime() int64 {
+	if x != nil {
+		return x.EndTime
+	}
+	return 0
+}
+
+type Kline struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OpenTime      int64                  `protobuf:"varint,1,opt,name=open_time,json=openTime,proto3" json:"open_time,omitempty"`
+	Open          string                 `protobuf:"bytes,2,opt,name=open,proto3" json:"open,omitempty"`
+	High          string                 `protobuf:"bytes,3,opt,name=high,proto3" json:"high,omitempty"`
+	Low           string                 `protobuf:"bytes,4,opt,name=low,proto3" json:"low,omitempty"`
+	Close         string                 `protobuf:"bytes,5,opt,name=close,proto3" json:"close,omitempty"`
+	Volume        string                 `protobuf:"bytes,6,opt,name=volume,proto3" json:"volume,omitempty"`
+	CloseTime     int64                  `protobuf:"varint,7,opt,name=close_time,json=closeTime,proto3" json:"close_time,omitempty"`
+	QuoteVolume   string                 `protobuf:"bytes,8,opt,name=quote_volume,json=quoteVolume,proto3" json:"quote_volume,omitempty"`
+	Trades        int64                  `protobuf:"varint,9,opt,name=trades,proto3" json:"trades,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Kline) Reset() {
+	*x = Kline{}
+	mi := &file_proxy_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Kline) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Kline) ProtoMessage() {}
+
+func (x *Kline) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Kline.ProtoReflect.Descriptor instead.
+func (*Kline) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Kline) GetOpenTime() int64 {
+	if x != nil {
+		return x.OpenTime
+	}
+	return 0
+}
+
+func (x *Kline) GetOpen() string {
+	if x != nil {
+		return x.Open
+	}
+	return ""
+}
+
+func (x *Kline) GetHigh() string {
+	if x != nil {
+		return x.High
+	}
+	return ""
+}
+
+func (x *Kline) GetLow() string {
+	if x != nil {
+		return x.Low
+	}
+	return ""
+}
+
+func (x *Kline) GetClose() string {
+	if x != nil {
+		return x.Close
+	}
+	return ""
+}
+
+func (x *Kline) GetVolume() string {
+	if x != nil {
+		return x.Volume
+	}
+	return ""
+}
+
+func (x *Kline) GetCloseTime() int64 {
+	if x != nil {
+		return x.CloseTime
+	}
+	return 0
+}
+
+func (x *Kline) GetQuoteVolume() string {
+	if x != nil {
+		return x.QuoteVolume
+	}
+	return ""
+}
+
+func (x *Kline) GetTrades() int64 {
+	if x != nil {
+		return x.Trades
+	}
+	return 0
+}
+
+type GetKlinesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Klines        []*Kline               `protobuf:"bytes,1,rep,name=klines,proto3" json:"klines,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetKlinesResponse) Reset() {
+	*x = GetKlinesResponse{}
+	mi := &file_proxy_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetKlinesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetKlinesResponse) ProtoMessage() {}
+
+func (x *GetKlinesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetKlinesResponse.ProtoReflect.Descriptor instead.
+func (*GetKlinesResponse) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetKlinesResponse) GetKlines() []*Kline {
+	if x != nil {
+		return x.Klines
+	}
+	return nil
+}
+
+type GetSymbolRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSymbolRequest) Reset() {
+	*x = GetSymbolRequest{}
+	mi := &file_proxy_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSymbolRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSymbolRequest) ProtoMessage() {}
+
+func (x *GetSymbolRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSymbolRequest.ProtoReflect.Descriptor instead.
+func (*GetSymbolRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetSymbolRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+type SymbolInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	BaseAsset     string                 `protobuf:"bytes,3,opt,name=base_asset,json=baseAsset,proto3" json:"base_asset,omitempty"`
+	QuoteAsset    string                 `protobuf:"bytes,4,opt,name=quote_asset,json=quoteAsset,proto3" json:"quote_asset,omitempty"`
+	OrderTypes    []string               `protobuf:"bytes,5,rep,name=order_types,json=orderTypes,proto3" json:"order_types,omitempty"`
+	TickSize      string                 `protobuf:"bytes,6,opt,name=tick_size,json=tickSize,proto3" json:"tick_size,omitempty"`
+	StepSize      string                 `protobuf:"bytes,7,opt,name=step_size,json=stepSize,proto3" json:"step_size,omitempty"`
+	MinQty        string                 `protobuf:"bytes,8,opt,name=min_qty,json=minQty,proto3" json:"min_qty,omitempty"`
+	MinNotional   string                 `protobuf:"bytes,9,opt,name=min_notional,json=minNotional,proto3" json:"min_notional,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SymbolInfo) Reset() {
+	*x = SymbolInfo{}
+	mi := &file_proxy_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SymbolInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SymbolInfo) ProtoMessage() {}
+
+func (x *SymbolInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SymbolInfo.ProtoReflect.Descriptor instead.
+func (*SymbolInfo) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SymbolInfo) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *SymbolInfo) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *SymbolInfo) GetBaseAsset() string {
+	if x != nil {
+		return x.BaseAsset
+	}
+	return ""
+}
+
+func (x *SymbolInfo) GetQuoteAsset() string {
+	if x != nil {
+		return x.QuoteAsset
+	}
+	return ""
+}
+
+func (x *SymbolInfo) GetOrderTypes() []string {
+	if x != nil {
+		return x.OrderTypes
+	}
+	return nil
+}
+
+func (x *SymbolInfo) GetTickSize() string {
+	if x != nil {
+		return x.TickSize
+	}
+	return ""
+}
+
+func (x *SymbolInfo) GetStepSize() string {
+	if x != nil {
+		return x.StepSize
+	}
+	return ""
+}
+
+func (x *SymbolInfo) GetMinQty() string {
+	if x != nil {
+		return x.MinQty
+	}
+	return ""
+}
+
+func (x *SymbolInfo) GetMinNotional() string {
+	if x != nil {
+		return x.MinNotional
+	}
+	return ""
+}
+
+type StreamTickersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Símbolos monitorados (vazio = todos)
+	Symbols       []string `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamTickersRequest) Reset() {
+	*x = StreamTickersRequest{}
+	mi := &file_proxy_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamTickersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamTickersRequest) ProtoMessage() {}
+
+func (x *StreamTickersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamTickersRequest.ProtoReflect.Descriptor instead.
+func (*StreamTickersRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *StreamTickersRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+type Ticker struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	EventTime     int64                  `protobuf:"varint,2,opt,name=event_time,json=eventTime,proto3" json:"event_time,omitempty"`
+	Open          string                 `protobuf:"bytes,3,opt,name=open,proto3" json:"open,omitempty"`
+	High          string                 `protobuf:"bytes,4,opt,name=high,proto3" json:"high,omitempty"`
+	Low           string                 `protobuf:"bytes,5,opt,name=low,proto3" json:"low,omitempty"`
+	Close         string                 `protobuf:"bytes,6,opt,name=close,proto3" json:"close,omitempty"`
+	Volume        string                 `protobuf:"bytes,7,opt,name=volume,proto3" json:"volume,omitempty"`
+	QuoteVolume   string                 `protobuf:"bytes,8,opt,name=quote_volume,json=quoteVolume,proto3" json:"quote_volume,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ticker) Reset() {
+	*x = Ticker{}
+	mi := &file_proxy_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ticker) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ticker) ProtoMessage() {}
+
+func (x *Ticker) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ticker.ProtoReflect.Descriptor instead.
+func (*Ticker) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Ticker) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Ticker) GetEventTime() int64 {
+	if x != nil {
+		return x.EventTime
+	}
+	return 0
+}
+
+func (x *Ticker) GetOpen() string {
+	if x != nil {
+		return x.Open
+	}
+	return ""
+}
+
+func (x *Ticker) GetHigh() string {
+	if x != nil {
+		return x.High
+	}
+	return ""
+}
+
+func (x *Ticker) GetLow() string {
+	if x != nil {
+		return x.Low
+	}
+	return ""
+}
+
+func (x *Ticker) GetClose() string {
+	if x != nil {
+		return x.Close
+	}
+	return ""
+}
+
+func (x *Ticker) GetVolume() string {
+	if x != nil {
+		return x.Volume
+	}
+	return ""
+}
+
+func (x *Ticker) GetQuoteVolume() string {
+	if x != nil {
+		return x.QuoteVolume
+	}
+	return ""
+}
+
+type StreamTradesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbols       []string               `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamTradesRequest) Reset() {
+	*x = StreamTradesRequest{}
+	mi := &file_proxy_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamTradesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamTradesRequest) ProtoMessage() {}
+
+func (x *StreamTradesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamTradesRequest.ProtoReflect.Descriptor instead.
+func (*StreamTradesRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *StreamTradesRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+type Trade struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	TradeId       int64                  `protobuf:"varint,2,opt,name=trade_id,json=tradeId,proto3" json:"trade_id,omitempty"`
+	Price         string                 `protobuf:"bytes,3,opt,name=price,proto3" json:"price,omitempty"`
+	Quantity      string                 `protobuf:"bytes,4,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	TradeTime     int64                  `protobuf:"varint,5,opt,name=trade_time,json=tradeTime,proto3" json:"trade_time,omitempty"`
+	BuyerIsMaker  bool                   `protobuf:"varint,6,opt,name=buyer_is_maker,json=buyerIsMaker,proto3" json:"buyer_is_maker,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Trade) Reset() {
+	*x = Trade{}
+	mi := &file_proxy_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Trade) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Trade) ProtoMessage() {}
+
+func (x *Trade) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Trade.ProtoReflect.Descriptor instead.
+func (*Trade) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Trade) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Trade) GetTradeId() int64 {
+	if x != nil {
+		return x.TradeId
+	}
+	return 0
+}
+
+func (x *Trade) GetPrice() string {
+	if x != nil {
+		return x.Price
+	}
+	return ""
+}
+
+func (x *Trade) GetQuantity() string {
+	if x != nil {
+		return x.Quantity
+	}
+	return ""
+}
+
+func (x *Trade) GetTradeTime() int64 {
+	if x != nil {
+		return x.TradeTime
+	}
+	return 0
+}
+
+func (x *Trade) GetBuyerIsMaker() bool {
+	if x != nil {
+		return x.BuyerIsMaker
+	}
+	return false
+}
+
+type PlaceOrderRequest struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Symbol           string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Side             string                 `protobuf:"bytes,2,opt,name=side,proto3" json:"side,omitempty"`
+	Type             string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	TimeInForce      string                 `protobuf:"bytes,4,opt,name=time_in_force,json=timeInForce,proto3" json:"time_in_force,omitempty"`
+	Quantity         string                 `protobuf:"bytes,5,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	QuoteOrderQty    string                 `protobuf:"bytes,6,opt,name=quote_order_qty,json=quoteOrderQty,proto3" json:"quote_order_qty,omitempty"`
+	Price            string                 `protobuf:"bytes,7,opt,name=price,proto3" json:"price,omitempty"`
+	StopPrice        string                 `protobuf:"bytes,8,opt,name=stop_price,json=stopPrice,proto3" json:"stop_price,omitempty"`
+	NewClientOrderId string                 `protobuf:"bytes,9,opt,name=new_client_order_id,json=newClientOrderId,proto3" json:"new_client_order_id,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *PlaceOrderRequest) Reset() {
+	*x = PlaceOrderRequest{}
+	mi := &file_proxy_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlaceOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlaceOrderRequest) ProtoMessage() {}
+
+func (x *PlaceOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlaceOrderRequest.ProtoReflect.Descriptor instead.
+func (*PlaceOrderRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *PlaceOrderRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetSide() string {
+	if x != nil {
+		return x.Side
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetTimeInForce() string {
+	if x != nil {
+		return x.TimeInForce
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetQuantity() string {
+	if x != nil {
+		return x.Quantity
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetQuoteOrderQty() string {
+	if x != nil {
+		return x.QuoteOrderQty
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetPrice() string {
+	if x != nil {
+		return x.Price
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetStopPrice() string {
+	if x != nil {
+		return x.StopPrice
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetNewClientOrderId() string {
+	if x != nil {
+		return x.NewClientOrderId
+	}
+	return ""
+}
+
+type CancelOrderRequest struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Symbol            string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	OrderId           int64                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	OrigClientOrderId string                 `protobuf:"bytes,3,opt,name=orig_client_order_id,json=origClientOrderId,proto3" json:"orig_client_order_id,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *CancelOrderRequest) Reset() {
+	*x = CancelOrderRequest{}
+	mi := &file_proxy_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelOrderRequest) ProtoMessage() {}
+
+func (x *CancelOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelOrderRequest.ProtoReflect.Descriptor instead.
+func (*CancelOrderRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *CancelOrderRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *CancelOrderRequest) GetOrderId() int64 {
+	if x != nil {
+		return x.OrderId
+	}
+	return 0
+}
+
+func (x *CancelOrderRequest) GetOrigClientOrderId() string {
+	if x != nil {
+		return x.OrigClientOrderId
+	}
+	return ""
+}
+
+type Order struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Symbol              string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	OrderId             int64                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	ClientOrderId       string                 `protobuf:"bytes,3,opt,name=client_order_id,json=clientOrderId,proto3" json:"client_order_id,omitempty"`
+	Price               string                 `protobuf:"bytes,4,opt,name=price,proto3" json:"price,omitempty"`
+	OrigQty             string                 `protobuf:"bytes,5,opt,name=orig_qty,json=origQty,proto3" json:"orig_qty,omitempty"`
+	ExecutedQty         string                 `protobuf:"bytes,6,opt,name=executed_qty,json=executedQty,proto3" json:"executed_qty,omitempty"`
+	CummulativeQuoteQty string                 `protobuf:"bytes,7,opt,name=cummulative_quote_qty,json=cummulativeQuoteQty,proto3" json:"cummulative_quote_qty,omitempty"`
+	Status              string                 `protobuf:"bytes,8,opt,name=status,proto3" json:"status,omitempty"`
+	TimeInForce         string                 `protobuf:"bytes,9,opt,name=time_in_force,json=timeInForce,proto3" json:"time_in_force,omitempty"`
+	Type                string                 `protobuf:"bytes,10,opt,name=type,proto3" json:"type,omitempty"`
+	Side                string                 `protobuf:"bytes,11,opt,name=side,proto3" json:"side,omitempty"`
+	StopPrice           string                 `protobuf:"bytes,12,opt,name=stop_price,json=stopPrice,proto3" json:"stop_price,omitempty"`
+	Time                int64                  `protobuf:"varint,13,opt,name=time,proto3" json:"time,omitempty"`
+	UpdateTime          int64                  `protobuf:"varint,14,opt,name=update_time,json=updateTime,proto3" json:"update_time,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *Order) Reset() {
+	*x = Order{}
+	mi := &file_proxy_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Order) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Order) ProtoMessage() {}
+
+func (x *Order) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Order.ProtoReflect.Descriptor instead.
+func (*Order) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *Order) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Order) GetOrderId() int64 {
+	if x != nil {
+		return x.OrderId
+	}
+	return 0
+}
+
+func (x *Order) GetClientOrderId() string {
+	if x != nil {
+		return x.ClientOrderId
+	}
+	return ""
+}
+
+func (x *Order) GetPrice() string {
+	if x != nil {
+		return x.Price
+	}
+	return ""
+}
+
+func (x *Order) GetOrigQty() string {
+	if x != nil {
+		return x.OrigQty
+	}
+	return ""
+}
+
+func (x *Order) GetExecutedQty() string {
+	if x != nil {
+		return x.ExecutedQty
+	}
+	return ""
+}
+
+func (x *Order) GetCummulativeQuoteQty() string {
+	if x != nil {
+		return x.CummulativeQuoteQty
+	}
+	return ""
+}
+
+func (x *Order) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Order) GetTimeInForce() string {
+	if x != nil {
+		return x.TimeInForce
+	}
+	return ""
+}
+
+func (x *Order) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Order) GetSide() string {
+	if x != nil {
+		return x.Side
+	}
+	return ""
+}
+
+func (x *Order) GetStopPrice() string {
+	if x != nil {
+		return x.StopPrice
+	}
+	return ""
+}
+
+func (x *Order) GetTime() int64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+func (x *Order) GetUpdateTime() int64 {
+	if x != nil {
+		return x.UpdateTime
+	}
+	return 0
+}
+
+type ListOpenOrdersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListOpenOrdersRequest) Reset() {
+	*x = ListOpenOrdersRequest{}
+	mi := &file_proxy_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListOpenOrdersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOpenOrdersRequest) ProtoMessage() {}
+
+func (x *ListOpenOrdersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOpenOrdersRequest.ProtoReflect.Descriptor instead.
+func (*ListOpenOrdersRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *ListOpenOrdersRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+type ListOpenOrdersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Orders        []*Order               `protobuf:"bytes,1,rep,name=orders,proto3" json:"orders,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListOpenOrdersResponse) Reset() {
+	*x = ListOpenOrdersResponse{}
+	mi := &file_proxy_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListOpenOrdersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOpenOrdersResponse) ProtoMessage() {}
+
+func (x *ListOpenOrdersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOpenOrdersResponse.ProtoReflect.Descriptor instead.
+func (*ListOpenOrdersResponse) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ListOpenOrdersResponse) GetOrders() []*Order {
+	if x != nil {
+		return x.Orders
+	}
+	return nil
+}
+
+var File_proxy_proto protoreflect.FileDescriptor
+
+const file_proxy_proto_rawDesc = "" +
+	"\n" +
+	"\vproxy.proto\x12\x0fproxybinance.v1\",\n" +
+	"\x10GetPricesRequest\x12\x18\n" +
+	"\asymbols\x18\x01 \x03(\tR\asymbols\"5\n" +
+	"\x05Price\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x14\n" +
+	"\x05price\x18\x02 \x01(\tR\x05price\"C\n" +
+	"\x11GetPricesResponse\x12.\n" +
+	"\x06prices\x18\x01 \x03(\v2\x16.proxybinance.v1.PriceR\x06prices\"C\n" +
+	"\x13GetOrderBookRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"=\n" +
+	"\tBookLevel\x12\x14\n" +
+	"\x05price\x18\x01 \x01(\tR\x05price\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\tR\bquantity\"\xa9\x01\n" +
+	"\tOrderBook\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12$\n" +
+	"\x0elast_update_id\x18\x02 \x01(\x03R\flastUpdateId\x12.\n" +
+	"\x04bids\x18\x03 \x03(\v2\x1a.proxybinance.v1.BookLevelR\x04bids\x12.\n" +
+	"\x04asks\x18\x04 \x03(\v2\x1a.proxybinance.v1.BookLevelR\x04asks\"\x96\x01\n" +
+	"\x10GetKlinesRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x1a\n" +
+	"\binterval\x18\x02 \x01(\tR\binterval\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\x12\x1d\n" +
+	"\n" +
+	"start_time\x18\x04 \x01(\x03R\tstartTime\x12\x19\n" +
+	"\bend_time\x18\x05 \x01(\x03R\aendTime\"\xe6\x01\n" +
+	"\x05Kline\x12\x1b\n" +
+	"\topen_time\x18\x01 \x01(\x03R\bopenTime\x12\x12\n" +
+	"\x04open\x18\x02 \x01(\tR\x04open\x12\x12\n" +
+	"\x04high\x18\x03 \x01(\tR\x04high\x12\x10\n" +
+	"\x03low\x18\x04 \x01(\tR\x03low\x12\x14\n" +
+	"\x05close\x18\x05 \x01(\tR\x05close\x12\x16\n" +
+	"\x06volume\x18\x06 \x01(\tR\x06volume\x12\x1d\n" +
+	"\n" +
+	"close_time\x18\a \x01(\x03R\tcloseTime\x12!\n" +
+	"\fquote_volume\x18\b \x01(\tR\vquoteVolume\x12\x16\n" +
+	"\x06trades\x18\t \x01(\x03R\x06trades\"C\n" +
+	"\x11GetKlinesResponse\x12.\n" +
+	"\x06klines\x18\x01 \x03(\v2\x16.proxybinance.v1.KlineR\x06klines\"*\n" +
+	"\x10GetSymbolRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\"\x93\x02\n" +
+	"\n" +
+	"SymbolInfo\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x1d\n" +
+	"\n" +
+	"base_asset\x18\x03 \x01(\tR\tbaseAsset\x12\x1f\n" +
+	"\vquote_asset\x18\x04 \x01(\tR\n" +
+	"quoteAsset\x12\x1f\n" +
+	"\vorder_types\x18\x05 \x03(\tR\n" +
+	"orderTypes\x12\x1b\n" +
+	"\ttick_size\x18\x06 \x01(\tR\btickSize\x12\x1b\n" +
+	"\tstep_size\x18\a \x01(\tR\bstepSize\x12\x17\n" +
+	"\amin_qty\x18\b \x01(\tR\x06minQty\x12!\n" +
+	"\fmin_notional\x18\t \x01(\tR\vminNotional\"0\n" +
+	"\x14StreamTickersRequest\x12\x18\n" +
+	"\asymbols\x18\x01 \x03(\tR\asymbols\"\xca\x01\n" +
+	"\x06Ticker\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x1d\n" +
+	"\n" +
+	"event_time\x18\x02 \x01(\x03R\teventTime\x12\x12\n" +
+	"\x04open\x18\x03 \x01(\tR\x04open\x12\x12\n" +
+	"\x04high\x18\x04 \x01(\tR\x04high\x12\x10\n" +
+	"\x03low\x18\x05 \x01(\tR\x03low\x12\x14\n" +
+	"\x05close\x18\x06 \x01(\tR\x05close\x12\x16\n" +
+	"\x06volume\x18\a \x01(\tR\x06volume\x12!\n" +
+	"\fquote_volume\x18\b \x01(\tR\vquoteVolume\"/\n" +
+	"\x13StreamTradesRequest\x12\x18\n" +
+	"\asymbols\x18\x01 \x03(\tR\asymbols\"\xb1\x01\n" +
+	"\x05Trade\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x19\n" +
+	"\btrade_id\x18\x02 \x01(\x03R\atradeId\x12\x14\n" +
+	"\x05price\x18\x03 \x01(\tR\x05price\x12\x1a\n" +
+	"\bquantity\x18\x04 \x01(\tR\bquantity\x12\x1d\n" +
+	"\n" +
+	"trade_time\x18\x05 \x01(\x03R\ttradeTime\x12$\n" +
+	"\x0ebuyer_is_maker\x18\x06 \x01(\bR\fbuyerIsMaker\"\x9f\x02\n" +
+	"\x11PlaceOrderRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x12\n" +
+	"\x04side\x18\x02 \x01(\tR\x04side\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\"\n" +
+	"\rtime_in_force\x18\x04 \x01(\tR\vtimeInForce\x12\x1a\n" +
+	"\bquantity\x18\x05 \x01(\tR\bquantity\x12&\n" +
+	"\x0fquote_order_qty\x18\x06 \x01(\tR\rquoteOrderQty\x12\x14\n" +
+	"\x05price\x18\a \x01(\tR\x05price\x12\x1d\n" +
+	"\n" +
+	"stop_price\x18\b \x01(\tR\tstopPrice\x12-\n" +
+	"\x13new_client_order_id\x18\t \x01(\tR\x10newClientOrderId\"x\n" +
+	"\x12CancelOrderRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\x03R\aorderId\x12/\n" +
+	"\x14orig_client_order_id\x18\x03 \x01(\tR\x11origClientOrderId\"\xa2\x03\n" +
+	"\x05Order\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\x03R\aorderId\x12&\n" +
+	"\x0fclient_order_id\x18\x03 \x01(\tR\rclientOrderId\x12\x14\n" +
+	"\x05price\x18\x04 \x01(\tR\x05price\x12\x19\n" +
+	"\borig_qty\x18\x05 \x01(\tR\aorigQty\x12!\n" +
+	"\fexecuted_qty\x18\x06 \x01(\tR\vexecutedQty\x122\n" +
+	"\x15cummulative_quote_qty\x18\a \x01(\tR\x13cummulativeQuoteQty\x12\x16\n" +
+	"\x06status\x18\b \x01(\tR\x06status\x12\"\n" +
+	"\rtime_in_force\x18\t \x01(\tR\vtimeInForce\x12\x12\n" +
+	"\x04type\x18\n" +
+	" \x01(\tR\x04type\x12\x12\n" +
+	"\x04side\x18\v \x01(\tR\x04side\x12\x1d\n" +
+	"\n" +
+	"stop_price\x18\f \x01(\tR\tstopPrice\x12\x12\n" +
+	"\x04time\x18\r \x01(\x03R\x04time\x12\x1f\n" +
+	"\vupdate_time\x18\x0e \x01(\x03R\n" +
+	"updateTime\"/\n" +
+	"\x15ListOpenOrdersRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\"H\n" +
+	"\x16ListOpenOrdersResponse\x12.\n" +
+	"\x06orders\x18\x01 \x03(\v2\x16.proxybinance.v1.OrderR\x06orders2\xf6\x03\n" +
+	"\n" +
+	"MarketData\x12R\n" +
+	"\tGetPrices\x12!.proxybinance.v1.GetPricesRequest\x1a\".proxybinance.v1.GetPricesResponse\x12P\n" +
+	"\fGetOrderBook\x12$.proxybinance.v1.GetOrderBookRequest\x1a\x1a.proxybinance.v1.OrderBook\x12R\n" +
+	"\tGetKlines\x12!.proxybinance.v1.GetKlinesRequest\x1a\".proxybinance.v1.GetKlinesResponse\x12K\n" +
+	"\tGetSymbol\x12!.proxybinance.v1.GetSymbolRequest\x1a\x1b.proxybinance.v1.SymbolInfo\x12Q\n" +
+	"\rStreamTickers\x12%.proxybinance.v1.StreamTickersRequest\x1a\x17.proxybinance.v1.Ticker0\x01\x12N\n" +
+	"\fStreamTrades\x12$.proxybinance.v1.StreamTradesRequest\x1a\x16.proxybinance.v1.Trade0\x012\x82\x02\n" +
+	"\aTrading\x12H\n" +
+	"\n" +
+	"PlaceOrder\x12\".proxybinance.v1.PlaceOrderRequest\x1a\x16.proxybinance.v1.Order\x12J\n" +
+	"\vCancelOrder\x12#.proxybinance.v1.CancelOrderRequest\x1a\x16.proxybinance.v1.Order\x12a\n" +
+	"\x0eListOpenOrders\x12&.proxybinance.v1.ListOpenOrdersRequest\x1a'.proxybinance.v1.ListOpenOrdersResponseB\x1dZ\x1bproxy_binance/proto;proxypbb\x06proto3"
+
+var (
+	file_proxy_proto_rawDescOnce sync.Once
+	file_proxy_proto_rawDescData []byte
+)
+
+func file_proxy_proto_rawDescGZIP() []byte {
+	file_proxy_proto_rawDescOnce.Do(func() {
+		file_proxy_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proxy_proto_rawDesc), len(file_proxy_proto_rawDesc)))
+	})
+	return file_proxy_proto_rawDescData
+}
+
+var file_proxy_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
+var file_proxy_proto_goTypes = []any{
+	(*GetPricesRequest)(nil),       // 0: proxybinance.v1.GetPricesRequest
+	(*Price)(nil),                  // 1: proxybinance.v1.Price
+	(*GetPricesResponse)(nil),      // 2: proxybinance.v1.GetPricesResponse
+	(*GetOrderBookRequest)(nil),    // 3: proxybinance.v1.GetOrderBookRequest
+	(*BookLevel)(nil),              // 4: proxybinance.v1.BookLevel
+	(*OrderBook)(nil),              // 5: proxybinance.v1.OrderBook
+	(*GetKlinesRequest)(nil),       // 6: proxybinance.v1.GetKlinesRequest
+	(*Kline)(nil),                  // 7: proxybinance.v1.Kline
+	(*GetKlinesResponse)(nil),      // 8: proxybinance.v1.GetKlinesResponse
+	(*GetSymbolRequest)(nil),       // 9: proxybinance.v1.GetSymbolRequest
+	(*SymbolInfo)(nil),             // 10: proxybinance.v1.SymbolInfo
+	(*StreamTickersRequest)(nil),   // 11: proxybinance.v1.StreamTickersRequest
+	(*Ticker)(nil),                 // 12: proxybinance.v1.Ticker
+	(*StreamTradesRequest)(nil),    // 13: proxybinance.v1.StreamTradesRequest
+	(*Trade)(nil),                  // 14: proxybinance.v1.Trade
+	(*PlaceOrderRequest)(nil),      // 15: proxybinance.v1.PlaceOrderRequest
+	(*CancelOrderRequest)(nil),     // 16: proxybinance.v1.CancelOrderRequest
+	(*Order)(nil),                  // 17: proxybinance.v1.Order
+	(*ListOpenOrdersRequest)(nil),  // 18: proxybinance.v1.ListOpenOrdersRequest
+	(*ListOpenOrdersResponse)(nil), // 19: proxybinance.v1.ListOpenOrdersResponse
+}
+var file_proxy_proto_depIdxs = []int32{
+	1,  // 0: proxybinance.v1.GetPricesResponse.prices:type_name -> proxybinance.v1.Price
+	4,  // 1: proxybinance.v1.OrderBook.bids:type_name -> proxybinance.v1.BookLevel
+	4,  // 2: proxybinance.v1.OrderBook.asks:type_name -> proxybinance.v1.BookLevel
+	7,  // 3: proxybinance.v1.GetKlinesResponse.klines:type_name -> proxybinance.v1.Kline
+	17, // 4: proxybinance.v1.ListOpenOrdersResponse.orders:type_name -> proxybinance.v1.Order
+	0,  // 5: proxybinance.v1.MarketData.GetPrices:input_type -> proxybinance.v1.GetPricesRequest
+	3,  // 6: proxybinance.v1.MarketData.GetOrderBook:input_type -> proxybinance.v1.GetOrderBookRequest
+	6,  // 7: proxybinance.v1.MarketData.GetKlines:input_type -> proxybinance.v1.GetKlinesRequest
+	9,  // 8: proxybinance.v1.MarketData.GetSymbol:input_type -> proxybinance.v1.GetSymbolRequest
+	11, // 9: proxybinance.v1.MarketData.StreamTickers:input_type -> proxybinance.v1.StreamTickersRequest
+	13, // 10: proxybinance.v1.MarketData.StreamTrades:input_type -> proxybinance.v1.StreamTradesRequest
+	15, // 11: proxybinance.v1.Trading.PlaceOrder:input_type -> proxybinance.v1.PlaceOrderRequest
+	16, // 12: proxybinance.v1.Trading.CancelOrder:input_type -> proxybinance.v1.CancelOrderRequest
+	18, // 13: proxybinance.v1.Trading.ListOpenOrders:input_type -> proxybinance.v1.ListOpenOrdersRequest
+	2,  // 14: proxybinance.v1.MarketData.GetPrices:output_type -> proxybinance.v1.GetPricesResponse
+	5,  // 15: proxybinance.v1.MarketData.GetOrderBook:output_type -> proxybinance.v1.OrderBook
+	8,  // 16: proxybinance.v1.MarketData.GetKlines:output_type -> proxybinance.v1.GetKlinesResponse
+	10, // 17: proxybinance.v1.MarketData.GetSymbol:output_type -> proxybinance.v1.SymbolInfo
+	12, // 18: proxybinance.v1.MarketData.StreamTickers:output_type -> proxybinance.v1.Ticker
+	14, // 19: proxybinance.v1.MarketData.StreamTrades:output_type -> proxybinance.v1.Trade
+	17, // 20: proxybinance.v1.Trading.PlaceOrder:output_type -> proxybinance.v1.Order
+	17, // 21: proxybinance.v1.Trading.CancelOrder:output_type -> proxybinance.v1.Order
+	19, // 22: proxybinance.v1.Trading.ListOpenOrders:output_type -> proxybinance.v1.ListOpenOrdersResponse
+	14, // [14:23] is the sub-list for method output_type
+	5,  // [5:14] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_proxy_proto_init() }
+func file_proxy_proto_init() {
+	if File_proxy_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proxy_proto_rawDesc), len(file_proxy_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   20,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_proxy_proto_goTypes,
+		DependencyIndexes: file_proxy_proto_depIdxs,
+		MessageInfos:      file_proxy_proto_msgTypes,
+	}.Build()
+	File_proxy_proto = out.File
+	file_proxy_proto_goTypes = nil
+	file_proxy_proto_depIdxs = nil
+}
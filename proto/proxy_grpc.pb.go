@@ -0,0 +1,521 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: proxy.proto
+
+// API gRPC do proxy Binance. Os valores decimais são strings, como na API
+// REST da Binance, para não perder precisão.
+
+package proxypb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	MarketData_GetPrices_FullMethodName     = "/proxybinance.v1.MarketData/GetPrices"
+	MarketData_GetOrderBook_FullMethodName  = "/proxybinance.v1.MarketData/GetOrderBook"
+	MarketData_GetKlines_FullMethodName     = "/proxybinance.v1.MarketData/GetKlines"
+	MarketData_GetSymbol_FullMethodName     = "/proxybinance.v1.MarketData/GetSymbol"
+	MarketData_StreamTickers_FullMethodName = "/proxybinance.v1.MarketData/StreamTickers"
+	MarketData_StreamTrades_FullMethodName  = "/proxybinance.v1.MarketData/StreamTrades"
+)
+
+// MarketDataClient is the client API for MarketData service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// MarketData expõe os dados de mercado servidos pelos caches do proxy
+type MarketDataClient interface {
+	// GetPrices retorna o preço atual dos símbolos (todos, se vazio)
+	GetPrices(ctx context.Context, in *GetPricesRequest, opts ...grpc.CallOption) (*GetPricesResponse, error)
+	// GetOrderBook retorna o livro de ofertas do símbolo
+	GetOrderBook(ctx context.Context, in *GetOrderBookRequest, opts ...grpc.CallOption) (*OrderBook, error)
+	// GetKlines retorna candles do símbolo
+	GetKlines(ctx context.Context, in *GetKlinesRequest, opts ...grpc.CallOption) (*GetKlinesResponse, error)
+	// GetSymbol retorna a descrição do símbolo em /exchangeInfo
+	GetSymbol(ctx context.Context, in *GetSymbolRequest, opts ...grpc.CallOption) (*SymbolInfo, error)
+	// StreamTickers envia os tickers de 24h (miniTicker) dos símbolos em tempo real
+	StreamTickers(ctx context.Context, in *StreamTickersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Ticker], error)
+	// StreamTrades envia os trades dos símbolos em tempo real
+	StreamTrades(ctx context.Context, in *StreamTradesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Trade], error)
+}
+
+type marketDataClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMarketDataClient(cc grpc.ClientConnInterface) MarketDataClient {
+	return &marketDataClient{cc}
+}
+
+func (c *marketDataClient) GetPrices(ctx context.Context, in *GetPricesRequest, opts ...grpc.CallOption) (*GetPricesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetPricesResponse)
+	err := c.cc.Invoke(ctx, MarketData_GetPrices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marketDataClient) GetOrderBook(ctx context.Context, in *GetOrderBookRequest, opts ...grpc.CallOption) (*OrderBook, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OrderBook)
+	err := c.cc.Invoke(ctx, MarketData_GetOrderBook_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marketDataClient) GetKlines(ctx context.Context, in *GetKlinesRequest, opts ...grpc.CallOption) (*GetKlinesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetKlinesResponse)
+	err := c.cc.Invoke(ctx, MarketData_GetKlines_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marketDataClient) GetSymbol(ctx context.Context, in *GetSymbolRequest, opts ...grpc.CallOption) (*SymbolInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SymbolInfo)
+	err := c.cc.Invoke(ctx, MarketData_GetSymbol_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marketDataClient) StreamTickers(ctx context.Context, in *StreamTickersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Ticker], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MarketData_ServiceDesc.Streams[0], MarketData_StreamTickers_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamTickersRequest, Ticker]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_StreamTickersClient = grpc.ServerStreamingClient[Ticker]
+
+func (c *marketDataClient) StreamTrades(ctx context.Context, in *StreamTradesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Trade], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MarketData_ServiceDesc.Streams[1], MarketData_StreamTrades_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamTradesRequest, Trade]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_StreamTradesClient = grpc.ServerStreamingClient[Trade]
+
+// MarketDataServer is the server API for MarketData service.
+// All implementations must embed UnimplementedMarketDataServer
+// for forward compatibility.
+//
+// MarketData expõe os dados de mercado servidos pelos caches do proxy
+type MarketDataServer interface {
+	// GetPrices retorna o preço atual dos símbolos (todos, se vazio)
+	GetPrices(context.Context, *GetPricesRequest) (*GetPricesResponse, error)
+	// GetOrderBook retorna o livro de ofertas do símbolo
+	GetOrderBook(context.Context, *GetOrderBookRequest) (*OrderBook, error)
+	// GetKlines retorna candles do símbolo
+	GetKlines(context.Context, *GetKlinesRequest) (*GetKlinesResponse, error)
+	// GetSymbol retorna a descrição do símbolo em /exchangeInfo
+	GetSymbol(context.Context, *GetSymbolRequest) (*SymbolInfo, error)
+	// StreamTickers envia os tickers de 24h (miniTicker) dos símbolos em tempo real
+	StreamTickers(*StreamTickersRequest, grpc.ServerStreamingServer[Ticker]) error
+	// StreamTrades envia os trades dos símbolos em tempo real
+	StreamTrades(*StreamTradesRequest, grpc.ServerStreamingServer[Trade]) error
+	mustEmbedUnimplementedMarketDataServer()
+}
+
+// UnimplementedMarketDataServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMarketDataServer struct{}
+
+func (UnimplementedMarketDataServer) GetPrices(context.Context, *GetPricesRequest) (*GetPricesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPrices not implemented")
+}
+func (UnimplementedMarketDataServer) GetOrderBook(context.Context, *GetOrderBookRequest) (*OrderBook, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrderBook not implemented")
+}
+func (UnimplementedMarketDataServer) GetKlines(context.Context, *GetKlinesRequest) (*GetKlinesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetKlines not implemented")
+}
+func (UnimplementedMarketDataServer) GetSymbol(context.Context, *GetSymbolRequest) (*SymbolInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSymbol not implemented")
+}
+func (UnimplementedMarketDataServer) StreamTickers(*StreamTickersRequest, grpc.ServerStreamingServer[Ticker]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTickers not implemented")
+}
+func (UnimplementedMarketDataServer) StreamTrades(*StreamTradesRequest, grpc.ServerStreamingServer[Trade]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTrades not implemented")
+}
+func (UnimplementedMarketDataServer) mustEmbedUnimplementedMarketDataServer() {}
+func (UnimplementedMarketDataServer) testEmbeddedByValue()                    {}
+
+// UnsafeMarketDataServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MarketDataServer will
+// result in compilation errors.
+type UnsafeMarketDataServer interface {
+	mustEmbedUnimplementedMarketDataServer()
+}
+
+func RegisterMarketDataServer(s grpc.ServiceRegistrar, srv MarketDataServer) {
+	// If the following call pancis, it indicates UnimplementedMarketDataServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MarketData_ServiceDesc, srv)
+}
+
+func _MarketData_GetPrices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPricesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarketDataServer).GetPrices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MarketData_GetPrices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarketDataServer).GetPrices(ctx, req.(*GetPricesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MarketData_GetOrderBook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrderBookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarketDataServer).GetOrderBook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MarketData_GetOrderBook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarketDataServer).GetOrderBook(ctx, req.(*GetOrderBookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MarketData_GetKlines_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetKlinesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarketDataServer).GetKlines(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MarketData_GetKlines_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarketDataServer).GetKlines(ctx, req.(*GetKlinesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MarketData_GetSymbol_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSymbolRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarketDataServer).GetSymbol(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MarketData_GetSymbol_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarketDataServer).GetSymbol(ctx, req.(*GetSymbolRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MarketData_StreamTickers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamTickersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MarketDataServer).StreamTickers(m, &grpc.GenericServerStream[StreamTickersRequest, Ticker]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_StreamTickersServer = grpc.ServerStreamingServer[Ticker]
+
+func _MarketData_StreamTrades_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamTradesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MarketDataServer).StreamTrades(m, &grpc.GenericServerStream[StreamTradesRequest, Trade]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_StreamTradesServer = grpc.ServerStreamingServer[Trade]
+
+// MarketData_ServiceDesc is the grpc.ServiceDesc for MarketData service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MarketData_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proxybinance.v1.MarketData",
+	HandlerType: (*MarketDataServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPrices",
+			Handler:    _MarketData_GetPrices_Handler,
+		},
+		{
+			MethodName: "GetOrderBook",
+			Handler:    _MarketData_GetOrderBook_Handler,
+		},
+		{
+			MethodName: "GetKlines",
+			Handler:    _MarketData_GetKlines_Handler,
+		},
+		{
+			MethodName: "GetSymbol",
+			Handler:    _MarketData_GetSymbol_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTickers",
+			Handler:       _MarketData_StreamTickers_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamTrades",
+			Handler:       _MarketData_StreamTrades_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proxy.proto",
+}
+
+const (
+	Trading_PlaceOrder_FullMethodName     = "/proxybinance.v1.Trading/PlaceOrder"
+	Trading_CancelOrder_FullMethodName    = "/proxybinance.v1.Trading/CancelOrder"
+	Trading_ListOpenOrders_FullMethodName = "/proxybinance.v1.Trading/ListOpenOrders"
+)
+
+// TradingClient is the client API for Trading service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Trading envia e consulta ordens do tenant. Requer o token do tenant no
+// metadata "x-proxy-token" (ou "authorization: Bearer <token>").
+type TradingClient interface {
+	PlaceOrder(ctx context.Context, in *PlaceOrderRequest, opts ...grpc.CallOption) (*Order, error)
+	CancelOrder(ctx context.Context, in *CancelOrderRequest, opts ...grpc.CallOption) (*Order, error)
+	ListOpenOrders(ctx context.Context, in *ListOpenOrdersRequest, opts ...grpc.CallOption) (*ListOpenOrdersResponse, error)
+}
+
+type tradingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTradingClient(cc grpc.ClientConnInterface) TradingClient {
+	return &tradingClient{cc}
+}
+
+func (c *tradingClient) PlaceOrder(ctx context.Context, in *PlaceOrderRequest, opts ...grpc.CallOption) (*Order, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Order)
+	err := c.cc.Invoke(ctx, Trading_PlaceOrder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tradingClient) CancelOrder(ctx context.Context, in *CancelOrderRequest, opts ...grpc.CallOption) (*Order, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Order)
+	err := c.cc.Invoke(ctx, Trading_CancelOrder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tradingClient) ListOpenOrders(ctx context.Context, in *ListOpenOrdersRequest, opts ...grpc.CallOption) (*ListOpenOrdersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListOpenOrdersResponse)
+	err := c.cc.Invoke(ctx, Trading_ListOpenOrders_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TradingServer is the server API for Trading service.
+// All implementations must embed UnimplementedTradingServer
+// for forward compatibility.
+//
+// Trading envia e consulta ordens do tenant. Requer o token do tenant no
+// metadata "x-proxy-token" (ou "authorization: Bearer <token>").
+type TradingServer interface {
+	PlaceOrder(context.Context, *PlaceOrderRequest) (*Order, error)
+	CancelOrder(context.Context, *CancelOrderRequest) (*Order, error)
+	ListOpenOrders(context.Context, *ListOpenOrdersRequest) (*ListOpenOrdersResponse, error)
+	mustEmbedUnimplementedTradingServer()
+}
+
+// UnimplementedTradingServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTradingServer struct{}
+
+func (UnimplementedTradingServer) PlaceOrder(context.Context, *PlaceOrderRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PlaceOrder not implemented")
+}
+func (UnimplementedTradingServer) CancelOrder(context.Context, *CancelOrderRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelOrder not implemented")
+}
+func (UnimplementedTradingServer) ListOpenOrders(context.Context, *ListOpenOrdersRequest) (*ListOpenOrdersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListOpenOrders not implemented")
+}
+func (UnimplementedTradingServer) mustEmbedUnimplementedTradingServer() {}
+func (UnimplementedTradingServer) testEmbeddedByValue()                 {}
+
+// UnsafeTradingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TradingServer will
+// result in compilation errors.
+type UnsafeTradingServer interface {
+	mustEmbedUnimplementedTradingServer()
+}
+
+func RegisterTradingServer(s grpc.ServiceRegistrar, srv TradingServer) {
+	// If the following call pancis, it indicates UnimplementedTradingServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Trading_ServiceDesc, srv)
+}
+
+func _Trading_PlaceOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlaceOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TradingServer).PlaceOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trading_PlaceOrder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TradingServer).PlaceOrder(ctx, req.(*PlaceOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Trading_CancelOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TradingServer).CancelOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trading_CancelOrder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TradingServer).CancelOrder(ctx, req.(*CancelOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Trading_ListOpenOrders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListOpenOrdersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TradingServer).ListOpenOrders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trading_ListOpenOrders_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TradingServer).ListOpenOrders(ctx, req.(*ListOpenOrdersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Trading_ServiceDesc is the grpc.ServiceDesc for Trading service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Trading_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proxybinance.v1.Trading",
+	HandlerType: (*TradingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PlaceOrder",
+			Handler:    _Trading_PlaceOrder_Handler,
+		},
+		{
+			MethodName: "CancelOrder",
+			Handler:    _Trading_CancelOrder_Handler,
+		},
+		{
+			MethodName: "ListOpenOrders",
+			Handler:    _Trading_ListOpenOrders_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proxy.proto",
+}
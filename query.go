@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rawParam é um parâmetro da query como o cliente o enviou
+type rawParam struct {
+	key     string
+	value   string
+	encoded string
+}
+
+// parseRawQuery separa a query mantendo a ordem, as repetições e a
+// codificação original de cada par. Pares com escape inválido são
+// descartados, como em url.ParseQuery.
+func parseRawQuery(raw string) []rawParam {
+	var params []rawParam
+	for _, pair := range strings.Split(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			continue
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			continue
+		}
+		params = append(params, rawParam{key: key, value: value, encoded: pair})
+	}
+	return params
+}
+
+// encodeQuery codifica params preservando o que veio em raw, a query
+// original: parâmetros que não mudaram saem exatamente como o cliente os
+// mandou (ordem, repetições e codificação, que entram na assinatura da
+// Binance), os alterados ficam na posição original e os novos vão no fim,
+// em ordem alfabética. Ao contrário de url.Values.Encode, a query não é
+// reordenada nem recodificada.
+func encodeQuery(raw string, params url.Values) string {
+	original := parseRawQuery(raw)
+	before := url.Values{}
+	for _, param := range original {
+		before[param.key] = append(before[param.key], param.value)
+	}
+
+	var parts []string
+	emitted := map[string]bool{}
+	for _, param := range original {
+		values, ok := params[param.key]
+		switch {
+		case !ok:
+			// Removido
+		case slices.Equal(values, before[param.key]):
+			parts = append(parts, param.encoded)
+		case !emitted[param.key]:
+			for _, value := range values {
+				parts = append(parts, url.QueryEscape(param.key)+"="+url.QueryEscape(value))
+			}
+		}
+		emitted[param.key] = true
+	}
+
+	var added []string
+	for key := range params {
+		if !emitted[key] {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(added)
+	for _, key := range added {
+		for _, value := range params[key] {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// rawQueryGet retorna o primeiro valor de key na query crua, como
+// url.Values.Get, mas sem montar o mapa: não aloca quando a chave e o valor
+// não têm escapes
+func rawQueryGet(raw, key string) (string, bool) {
+	for raw != "" {
+		var pair string
+		pair, raw, _ = strings.Cut(raw, "&")
+		if strings.Contains(pair, ";") {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		k, err := url.QueryUnescape(k)
+		if err != nil || k != key {
+			continue
+		}
+		if v, err = url.QueryUnescape(v); err != nil {
+			continue
+		}
+		return v, true
+	}
+	return "", false
+}
+
+// queryPair é um parâmetro decodificado da query
+type queryPair struct {
+	key, value string
+}
+
+var queryPairPool = sync.Pool{New: func() any { return new([]queryPair) }}
+
+// appendSortedQuery acrescenta a dst a query normalizada como em
+// url.Values.Encode (chaves em ordem, valores na ordem original, tudo
+// reescapado), sem montar o url.Values. É a query das chaves de cache.
+func appendSortedQuery(dst []byte, raw string) []byte {
+	pooled := queryPairPool.Get().(*[]queryPair)
+	pairs := (*pooled)[:0]
+	for raw != "" {
+		var pair string
+		pair, raw, _ = strings.Cut(raw, "&")
+		if pair == "" || strings.Contains(pair, ";") {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			continue
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			continue
+		}
+		pairs = append(pairs, queryPair{key, value})
+	}
+	slices.SortStableFunc(pairs, func(a, b queryPair) int { return strings.Compare(a.key, b.key) })
+	for i, pair := range pairs {
+		if i > 0 {
+			dst = append(dst, '&')
+		}
+		dst = append(dst, url.QueryEscape(pair.key)...)
+		dst = append(dst, '=')
+		dst = append(dst, url.QueryEscape(pair.value)...)
+	}
+	// Sem guardar no pool referências à query da requisição
+	clear(pairs)
+	*pooled = pairs[:0]
+	queryPairPool.Put(pooled)
+	return dst
+}
+
+// stripRawParam remove da query crua os pares de name, sem tocar nos demais
+func stripRawParam(raw, name string) string {
+	if !strings.Contains(raw, name) {
+		return raw
+	}
+	var parts []string
+	for _, pair := range strings.Split(raw, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if decoded, err := url.QueryUnescape(key); err == nil && decoded == name {
+			continue
+		}
+		parts = append(parts, pair)
+	}
+	return strings.Join(parts, "&")
+}
+
+// isSignedRequest indica uma chamada já assinada pelo cliente, com
+// signature na query ou no corpo form. A assinatura cobre a query e o corpo
+// exatamente como foram enviados, então eles seguem byte a byte para a
+// Binance, sem tradução de símbolos, regras de parâmetros ou recodificação.
+func isSignedRequest(c *gin.Context) bool {
+	if _, ok := rawQueryGet(c.Request.URL.RawQuery, "signature"); ok {
+		return true
+	}
+	if !isFormBody(c.Request) {
+		return false
+	}
+	body, err := readBody(c)
+	if err != nil {
+		return false
+	}
+	form, _ := url.ParseQuery(string(body))
+	return form.Has("signature")
+}
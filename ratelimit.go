@@ -0,0 +1,596 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Limite de REQUEST_WEIGHT por minuto da API spot da Binance
+	defaultWeightLimit   = 6000
+	defaultWeightMaxWait = 10 * time.Second
+
+	// A partir deste uso (% do limite) o tráfego de baixa prioridade é
+	// atrasado, até defaultThrottleMaxDelay quando chega à parte da classe
+	defaultThrottleStartPct = 50
+	defaultThrottleMaxDelay = 2 * time.Second
+)
+
+// errWeightExhausted indica que a requisição esperaria demais pelo orçamento de peso
+var errWeightExhausted = errors.New("orçamento de peso da Binance esgotado")
+
+// Priority é a classe de prioridade de uma requisição no agendador de peso
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// priorityShares é a fração do limite por minuto que cada classe pode
+// consumir; o restante fica reservado para as classes acima
+var priorityShares = [...]float64{
+	PriorityLow:    0.7,
+	PriorityNormal: 0.9,
+	PriorityHigh:   1.0,
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+// parsePriority aceita low/normal/high ou 0/1/2
+func parsePriority(value string) (Priority, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "low", "0":
+		return PriorityLow, true
+	case "normal", "1":
+		return PriorityNormal, true
+	case "high", "2":
+		return PriorityHigh, true
+	}
+	return PriorityNormal, false
+}
+
+type priorityKey struct{}
+
+// consumerKey identifica no contexto quem originou a chamada (nome do tenant)
+type consumerKey struct{}
+
+const (
+	consumerAnonymous = "anonymous"
+	consumerInternal  = "internal"
+)
+
+func withPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priorityFrom retorna a prioridade do contexto; tarefas internas sem
+// prioridade definida (caches, keepalives) são normais
+func priorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+func withConsumer(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, consumerKey{}, name)
+}
+
+// consumerFrom retorna quem originou a chamada; tarefas internas do proxy
+// (caches, keepalives, ordens condicionais) aparecem como "internal"
+func consumerFrom(ctx context.Context) string {
+	if name, ok := ctx.Value(consumerKey{}).(string); ok {
+		return name
+	}
+	return consumerInternal
+}
+
+// consumerUsage é o consumo de um tenant (ou dos anônimos) no orçamento
+type consumerUsage struct {
+	WindowWeight int            `json:"windowWeight"`
+	TotalWeight  int            `json:"totalWeight"`
+	Requests     int            `json:"requests"`
+	OrderCount   map[string]int `json:"orderCount,omitempty"`
+}
+
+// WeightScheduler controla o peso gasto na janela de um minuto da Binance.
+// Quando o orçamento aperta, classes mais baixas esperam a próxima janela e
+// nenhuma requisição passa na frente de outra de prioridade maior que já
+// esteja aguardando.
+type WeightScheduler struct {
+	mu      sync.Mutex
+	limit   int
+	maxWait time.Duration
+	used    int
+	window  time.Time
+	waiting [3]int
+	// wake é fechado (e recriado) quando quem aguarda deve reavaliar
+	wake chan struct{}
+
+	// Atraso adaptativo das requisições de baixa prioridade
+	throttleStart    float64
+	throttleMaxDelay time.Duration
+	// Último X-MBX-USED-WEIGHT-<intervalo> recebido, por intervalo (1M, 1S...)
+	observed map[string]int
+	// Requisições sendo atrasadas pelo throttling
+	throttled int
+	consumers map[string]*consumerUsage
+}
+
+func NewWeightScheduler(limit int, maxWait time.Duration) *WeightScheduler {
+	if limit <= 0 {
+		limit = defaultWeightLimit
+	}
+	return &WeightScheduler{
+		limit:            limit,
+		maxWait:          maxWait,
+		window:           time.Now().Truncate(time.Minute),
+		wake:             make(chan struct{}),
+		throttleStart:    defaultThrottleStartPct / 100.0,
+		throttleMaxDelay: defaultThrottleMaxDelay,
+		observed:         map[string]int{},
+		consumers:        map[string]*consumerUsage{},
+	}
+}
+
+// SetThrottle configura o atraso adaptativo: a partir de startPct% do limite,
+// requisições de baixa prioridade esperam até maxDelay (0 desativa)
+func (s *WeightScheduler) SetThrottle(startPct int, maxDelay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttleStart = float64(startPct) / 100
+	s.throttleMaxDelay = maxDelay
+}
+
+// throttleDelay cresce linearmente de 0 (uso em throttleStart) a
+// throttleMaxDelay (uso na parte da classe baixa), para que o tráfego em
+// massa desacelere antes de a Binance responder 429
+func (s *WeightScheduler) throttleDelay(p Priority) time.Duration {
+	if p != PriorityLow || s.throttleMaxDelay <= 0 {
+		return 0
+	}
+	usage := float64(s.used) / float64(s.limit)
+	end := priorityShares[PriorityLow]
+	if usage <= s.throttleStart || s.throttleStart >= end {
+		return 0
+	}
+	fraction := math.Min(1, (usage-s.throttleStart)/(end-s.throttleStart))
+	return time.Duration(fraction * float64(s.throttleMaxDelay))
+}
+
+func (s *WeightScheduler) broadcast() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// roll inicia uma nova janela quando o minuto vira (como na Binance)
+func (s *WeightScheduler) roll(now time.Time) {
+	if window := now.Truncate(time.Minute); window.After(s.window) {
+		s.window = window
+		s.used = 0
+		for _, usage := range s.consumers {
+			usage.WindowWeight = 0
+		}
+		s.broadcast()
+	}
+}
+
+func (s *WeightScheduler) admit(p Priority, weight int) bool {
+	for higher := p + 1; higher <= PriorityHigh; higher++ {
+		if s.waiting[higher] > 0 {
+			return false
+		}
+	}
+	return float64(s.used+weight) <= float64(s.limit)*priorityShares[p]
+}
+
+// Acquire reserva weight para a requisição, esperando a próxima janela se a
+// classe já esgotou sua parte. Desiste com errWeightExhausted se a espera
+// passar de maxWait.
+func (s *WeightScheduler) Acquire(ctx context.Context, p Priority, weight int) error {
+	s.mu.Lock()
+	s.roll(time.Now())
+	if delay := s.throttleDelay(p); delay > 0 {
+		s.throttled++
+		s.mu.Unlock()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		s.mu.Lock()
+		s.throttled--
+		if err := ctx.Err(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	registered := false
+	leave := func() {
+		if registered {
+			s.waiting[p]--
+			s.broadcast()
+		}
+	}
+	deadline := time.Now().Add(s.maxWait)
+	for {
+		now := time.Now()
+		s.roll(now)
+		if s.admit(p, weight) {
+			leave()
+			s.used += weight
+			s.consumer(consumerFrom(ctx)).charge(weight)
+			s.mu.Unlock()
+			return nil
+		}
+		nextWindow := s.window.Add(time.Minute)
+		if nextWindow.After(deadline) {
+			leave()
+			s.mu.Unlock()
+			return errWeightExhausted
+		}
+		if !registered {
+			s.waiting[p]++
+			registered = true
+		}
+		wake := s.wake
+		s.mu.Unlock()
+
+		timer := time.NewTimer(nextWindow.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.mu.Lock()
+			leave()
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+		s.mu.Lock()
+	}
+}
+
+func (s *WeightScheduler) consumer(name string) *consumerUsage {
+	usage, ok := s.consumers[name]
+	if !ok {
+		usage = &consumerUsage{}
+		s.consumers[name] = usage
+	}
+	return usage
+}
+
+func (u *consumerUsage) charge(weight int) {
+	u.WindowWeight += weight
+	u.TotalWeight += weight
+	u.Requests++
+}
+
+// Observe atualiza o peso usado com os headers X-MBX-USED-WEIGHT-<intervalo>
+// da Binance, que também contam chamadas de fora do proxy. A janela de 1
+// minuto alimenta o agendador; as demais ficam para consulta. Os contadores
+// de ordens (X-MBX-ORDER-COUNT-*), que são por conta, ficam com o tenant.
+func (s *WeightScheduler) Observe(resp *http.Response) {
+	limited := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roll(time.Now())
+	used := -1
+	for key, values := range resp.Header {
+		if len(values) == 0 {
+			continue
+		}
+		n, err := strconv.Atoi(values[0])
+		if err != nil {
+			continue
+		}
+		key = strings.ToUpper(key)
+		if interval, ok := strings.CutPrefix(key, "X-MBX-USED-WEIGHT-"); ok {
+			s.observed[interval] = n
+			if interval == "1M" {
+				used = n
+			}
+		} else if interval, ok := strings.CutPrefix(key, "X-MBX-ORDER-COUNT-"); ok && resp.Request != nil {
+			usage := s.consumer(consumerFrom(resp.Request.Context()))
+			if usage.OrderCount == nil {
+				usage.OrderCount = map[string]int{}
+			}
+			usage.OrderCount[interval] = n
+		}
+	}
+	if limited {
+		// A Binance já recusou: nada mais passa até a próxima janela
+		s.used = s.limit
+	} else if used > s.used {
+		s.used = used
+	}
+}
+
+// Headroom retorna quanto peso a classe ainda pode gastar na janela atual
+// deixando livre a fração margin da parte dela, e quanto falta para a janela
+// virar. Com uma classe mais alta na fila, a classe não tem folga.
+func (s *WeightScheduler) Headroom(p Priority, margin float64) (int, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.roll(now)
+	reset := s.window.Add(time.Minute).Sub(now)
+	for higher := p + 1; higher <= PriorityHigh; higher++ {
+		if s.waiting[higher] > 0 {
+			return 0, reset
+		}
+	}
+	budget := int(float64(s.limit) * priorityShares[p] * (1 - margin))
+	return max(0, budget-s.used), reset
+}
+
+// WeightStatus é uma fotografia do agendador de peso
+type WeightStatus struct {
+	WindowStart     int64                     `json:"windowStart"`
+	ResetInMs       int64                     `json:"resetInMs"`
+	Limit           int                       `json:"limit"`
+	Used            int                       `json:"used"`
+	UsedPct         string                    `json:"usedPct"`
+	ClassCaps       map[string]int            `json:"classCaps"`
+	ThrottleDelayMs int64                     `json:"throttleDelayMs"`
+	UpstreamWeight  map[string]int            `json:"upstreamUsedWeight"`
+	Queue           map[string]int            `json:"queue"`
+	Consumers       map[string]*consumerUsage `json:"consumers"`
+}
+
+// Status retorna o uso da janela atual, a fila de espera e o consumo por tenant
+func (s *WeightScheduler) Status() WeightStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.roll(now)
+	status := WeightStatus{
+		WindowStart:     s.window.UnixMilli(),
+		ResetInMs:       s.window.Add(time.Minute).Sub(now).Milliseconds(),
+		Limit:           s.limit,
+		Used:            s.used,
+		UsedPct:         strconv.FormatFloat(100*float64(s.used)/float64(s.limit), 'f', 2, 64),
+		ClassCaps:       map[string]int{},
+		ThrottleDelayMs: s.throttleDelay(PriorityLow).Milliseconds(),
+		UpstreamWeight:  map[string]int{},
+		Queue:           map[string]int{"throttled": s.throttled},
+		Consumers:       map[string]*consumerUsage{},
+	}
+	total := s.throttled
+	for p := PriorityLow; p <= PriorityHigh; p++ {
+		status.ClassCaps[p.String()] = int(float64(s.limit) * priorityShares[p])
+		status.Queue[p.String()] = s.waiting[p]
+		total += s.waiting[p]
+	}
+	status.Queue["total"] = total
+	for interval, used := range s.observed {
+		status.UpstreamWeight[interval] = used
+	}
+	for name, usage := range s.consumers {
+		copied := *usage
+		if usage.OrderCount != nil {
+			copied.OrderCount = map[string]int{}
+			for interval, n := range usage.OrderCount {
+				copied.OrderCount[interval] = n
+			}
+		}
+		status.Consumers[name] = &copied
+	}
+	return status
+}
+
+// RateLimitStatus mostra quem está consumindo o orçamento da Binance
+// @Summary Uso do limite de peso
+// @Description Peso usado na janela atual (local e informado pela Binance), limites do exchangeInfo, contadores de ordens e consumo por tenant, fila do agendador, ocupação dos limites de concorrência e buscas em lote do planejador
+// @Tags Proxy
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /ratelimit/status [get]
+func (p *ProxyServer) RateLimitStatus(c *gin.Context) {
+	response := gin.H{
+		"weight":      p.weights.Status(),
+		"concurrency": p.concurrency.Status(),
+		"planner":     p.planner.Status(),
+	}
+	// Os limites anunciados vêm do exchangeInfo em cache; sem ele, ficam de fora
+	if info, err := p.market.ExchangeInfo(c.Request.Context()); err == nil && info.RateLimits != nil {
+		response["limits"] = info.RateLimits
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// upstreamEndpoint retorna o path após /api/v3 (ex: /ticker/price)
+func upstreamEndpoint(path string) string {
+	if i := strings.Index(path, "/v3/"); i >= 0 {
+		return path[i+3:]
+	}
+	return path
+}
+
+// requestWeight estima o peso de uma chamada pela tabela de pesos da API
+// spot; endpoints não listados valem 1
+func requestWeight(method, path string, query url.Values) int {
+	path = upstreamEndpoint(path)
+	hasSymbol := query.Get("symbol") != ""
+	switch path {
+	case "/exchangeInfo", "/account", "/allOrders", "/myTrades", "/allOrderList":
+		return 20
+	case "/depth":
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		switch {
+		case limit <= 100:
+			return 5
+		case limit <= 500:
+			return 25
+		case limit <= 1000:
+			return 50
+		}
+		return 250
+	case "/trades", "/historicalTrades":
+		return 25
+	case "/aggTrades", "/avgPrice":
+		return 2
+	case "/klines", "/uiKlines":
+		return 2
+	case "/ticker/24hr", "/ticker":
+		if hasSymbol {
+			return 2
+		}
+		if query.Get("symbols") != "" {
+			return 40
+		}
+		return 80
+	case "/ticker/price", "/ticker/bookTicker":
+		if hasSymbol {
+			return 2
+		}
+		return 4
+	case "/openOrders":
+		if hasSymbol || method == http.MethodDelete {
+			return 6
+		}
+		return 80
+	case "/order":
+		if method == http.MethodGet {
+			return 4
+		}
+	}
+	return 1
+}
+
+// weightTransport passa as chamadas à Binance pelos limites de concorrência
+// por path e pelo agendador de peso. Chamadas a outros hosts (modo
+// multi-corretora) não são controladas.
+type weightTransport struct {
+	base      http.RoundTripper
+	scheduler *WeightScheduler
+	limits    *ConcurrencyLimiter
+	host      string
+	outages   *OutageNotifier
+}
+
+// releaseBody libera a vaga de concorrência quando o corpo é fechado
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
+
+func (t *weightTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		setDeadlineStage(req.Context(), deadlineStageUpstream)
+		return t.base.RoundTrip(req)
+	}
+	setDeadlineStage(req.Context(), deadlineStageQueue)
+	release, err := t.limits.TryAcquire(upstreamEndpoint(req.URL.Path))
+	if err != nil {
+		return nil, err
+	}
+	weight := requestWeight(req.Method, req.URL.Path, req.URL.Query())
+	if err := t.scheduler.Acquire(req.Context(), priorityFrom(req.Context()), weight); err != nil {
+		release()
+		if errors.Is(err, errWeightExhausted) {
+			// Só volta ao normal na próxima janela de peso
+			t.outages.FireUntil(outageWeightExhausted, "proxy", "orçamento de peso do proxy esgotado", time.Now().Truncate(time.Minute).Add(time.Minute))
+		}
+		return nil, err
+	}
+	t.outages.Resolve(outageWeightExhausted, "proxy")
+	setDeadlineStage(req.Context(), deadlineStageUpstream)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	t.scheduler.Observe(resp)
+	addRequestWeight(req.Context(), weight)
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// newUpstreamClient cria o cliente HTTP da Binance com o agendador de peso,
+// as políticas de conexão do proxy, os limites de concorrência e a detecção
+// de indisponibilidades
+func newUpstreamClient(proxy *ProxyServer, limits *ConcurrencyLimiter) *http.Client {
+	host := ""
+	if u, err := url.Parse(proxy.binanceURL); err == nil {
+		host = u.Host
+	}
+	mirror := &mirrorTransport{base: newUpstreamTransport(proxy.upstreamDial, proxy.upstreamTLS, proxy.outages), metrics: mirrorMetrics, outages: proxy.outages}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &weightTransport{base: mirror, scheduler: proxy.weights, limits: limits, host: host, outages: proxy.outages},
+	}
+}
+
+// respondLimitError responde 429 quando a chamada foi recusada pelo próprio
+// proxy (orçamento de peso ou limite de concorrência), ou 403 para um saque
+// bloqueado, sem chegar à Binance
+func respondLimitError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, errWeightExhausted):
+		respondError(c, http.StatusTooManyRequests, -1003, "Orçamento de peso da Binance esgotado nesta janela; tente novamente em instantes")
+	case errors.Is(err, errConcurrencyLimit):
+		respondError(c, http.StatusTooManyRequests, -1003, "Muitas chamadas simultâneas a este endpoint; tente novamente em instantes")
+	case errors.Is(err, errWithdrawBlocked):
+		respondError(c, http.StatusForbidden, -1002, "Saque recusado: use o endpoint de saque com "+withdrawConfirmHeader)
+	default:
+		return false
+	}
+	return true
+}
+
+// requestPriority define a prioridade: header X-Priority, depois a do
+// tenant; sem nenhum dos dois, envio e cancelamento de ordens são de alta
+// prioridade e o restante é normal
+func (p *ProxyServer) requestPriority(c *gin.Context) Priority {
+	if priority, ok := parsePriority(c.GetHeader("X-Priority")); ok {
+		return priority
+	}
+	if tenant := p.requestTenant(c.Request); tenant != nil {
+		if priority, ok := parsePriority(tenant.Priority); ok {
+			return priority
+		}
+	}
+	if c.Request.Method != http.MethodGet && strings.Contains(c.Request.URL.Path, "/order") {
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+// PriorityMiddleware guarda a prioridade e o consumidor (tenant) no contexto
+// da requisição, de onde o agendador de peso os lê nas chamadas à Binance
+func (p *ProxyServer) PriorityMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := withConsumer(withPriority(c.Request.Context(), p.requestPriority(c)), p.consumerName(c.Request))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
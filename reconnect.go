@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Eventos de reconexão guardados em memória para /admin/streams
+	maxStreamEvents = 100
+	// Nova tentativa de troca quando a conexão substituta não abre
+	streamRotateRetry = time.Minute
+)
+
+// Tipos de StreamEvent
+const (
+	// A conexão caiu e será refeita depois de delay
+	streamEventReconnect = "reconnect"
+	// Troca programada antes do limite de 24h da Binance, sem interrupção
+	streamEventRotation = "rotation"
+	// WS_RECONNECT_ALERT_AFTER tentativas seguidas sem conectar
+	streamEventAlert = "alert"
+	// O stream voltou a conectar depois de um alerta
+	streamEventRecovered = "recovered"
+)
+
+// ReconnectPolicy define como as conexões WebSocket com a Binance são
+// refeitas: a espera começa em Initial e dobra a cada falha seguida até Max,
+// com até JitterPct% a menos sorteados para que os streams não reconectem
+// todos juntos depois de uma queda
+type ReconnectPolicy struct {
+	// WS_RECONNECT_INITIAL_DELAY
+	Initial time.Duration
+	// WS_RECONNECT_MAX_DELAY
+	Max time.Duration
+	// WS_RECONNECT_JITTER_PCT
+	JitterPct int
+	// Falhas seguidas até o alerta (WS_RECONNECT_ALERT_AFTER; 0 desliga)
+	AlertAfter int
+	// A Binance derruba as conexões com 24h; antes disso o proxy abre outra e
+	// troca sem perder o stream (WS_UPSTREAM_MAX_AGE; 0 desliga)
+	MaxAge time.Duration
+}
+
+// defaultReconnectPolicy é a política sem as variáveis WS_RECONNECT_*
+func defaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		Initial:    streamReconnectMin,
+		Max:        streamReconnectMax,
+		JitterPct:  20,
+		AlertAfter: 10,
+		MaxAge:     23*time.Hour + 30*time.Minute,
+	}
+}
+
+// validate confere os limites da política
+func (p ReconnectPolicy) validate() error {
+	switch {
+	case p.Initial <= 0 || p.Max < p.Initial:
+		return errors.New("WS_RECONNECT_INITIAL_DELAY deve ser positivo e no máximo WS_RECONNECT_MAX_DELAY")
+	case p.JitterPct < 0 || p.JitterPct > 100:
+		return errors.New("WS_RECONNECT_JITTER_PCT deve ser de 0 a 100")
+	case p.AlertAfter < 0:
+		return errors.New("WS_RECONNECT_ALERT_AFTER não pode ser negativo")
+	case p.MaxAge < 0 || p.MaxAge > 0 && p.MaxAge < time.Minute:
+		return errors.New("WS_UPSTREAM_MAX_AGE deve ser 0 ou pelo menos 1m")
+	}
+	return nil
+}
+
+// delay é a espera antes da tentativa attempt (1 = primeira depois da queda)
+func (p ReconnectPolicy) delay(attempt int) time.Duration {
+	d := p.Initial
+	for i := 1; i < attempt && d < p.Max; i++ {
+		d *= 2
+	}
+	if d > p.Max {
+		d = p.Max
+	}
+	if p.JitterPct > 0 {
+		d -= time.Duration(rand.Int63n(int64(d)*int64(p.JitterPct)/100 + 1))
+	}
+	return d
+}
+
+// StreamEvent é uma reconexão, troca programada ou alerta de um stream
+type StreamEvent struct {
+	Time   int64  `json:"time"`
+	Stream string `json:"stream"`
+	Type   string `json:"type"`
+	// Tentativas seguidas sem conectar, contando esta
+	Attempt int    `json:"attempt,omitempty"`
+	Delay   string `json:"delay,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// A queda aconteceu durante a manutenção da Binance
+	Maintenance bool `json:"maintenance,omitempty"`
+}
+
+type streamReconnectKey struct {
+	stream, reason string
+}
+
+// recordEvent guarda o evento e o escreve (JSON por linha) na saída de
+// eventos do hub. Chamado com h.mu.
+func (h *StreamHub) recordEvent(event StreamEvent) {
+	event.Time = time.Now().UnixMilli()
+	h.events = append(h.events, event)
+	if len(h.events) > maxStreamEvents {
+		h.events = h.events[len(h.events)-maxStreamEvents:]
+	}
+	if event.Type == streamEventReconnect || event.Type == streamEventRotation {
+		if h.reconnects == nil {
+			h.reconnects = make(map[streamReconnectKey]uint64)
+		}
+		h.reconnects[streamReconnectKey{event.Stream, event.Type}]++
+	}
+	if h.eventsOut != nil {
+		if line, err := json.Marshal(event); err == nil {
+			h.eventsOut.Write(append(line, '\n'))
+		}
+	}
+}
+
+// disconnected registra a queda da conexão upstream e retorna a espera até
+// a próxima tentativa
+func (h *StreamHub) disconnected(us *upstreamStream, connected bool, err error) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if connected {
+		us.failures = 0
+	}
+	us.failures++
+	us.connected = false
+	us.reconnects++
+	event := StreamEvent{Stream: us.name, Type: streamEventReconnect, Attempt: us.failures}
+	if err != nil {
+		us.lastError = redactSecrets(err.Error())
+		event.Error = us.lastError
+	}
+	delay := h.reconnect.delay(us.failures)
+	if h.maintenance != nil && h.maintenance() {
+		// Sem insistir numa Binance que avisou que está fora
+		event.Maintenance = true
+		delay = h.reconnect.delay(math.MaxInt32)
+	}
+	event.Delay = delay.Round(time.Millisecond).String()
+	h.recordEvent(event)
+	if alert := h.reconnect.AlertAfter; alert > 0 && us.failures >= alert && !us.alerting && !event.Maintenance {
+		us.alerting = true
+		h.recordEvent(StreamEvent{Stream: us.name, Type: streamEventAlert, Attempt: us.failures, Error: event.Error})
+		h.outages.Fire(outageStreamDown, us.name, event.Error)
+	}
+	return delay
+}
+
+// connectedUpstream marca a conexão upstream como aberta
+func (h *StreamHub) connectedUpstream(us *upstreamStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	us.connected, us.connectedAt = true, time.Now()
+	if us.alerting {
+		us.alerting = false
+		h.recordEvent(StreamEvent{Stream: us.name, Type: streamEventRecovered, Attempt: us.failures})
+		h.outages.Resolve(outageStreamDown, us.name)
+	}
+}
+
+// rotate abre a conexão que substitui conn depois de MaxAge e a entrega em
+// next, fechando conn para que a leitura passe para ela. Se a nova conexão
+// não abre, tenta de novo a cada streamRotateRetry enquanto conn durar.
+func (h *StreamHub) rotate(ctx context.Context, us *upstreamStream, conn *websocket.Conn, next chan<- *websocket.Conn, done <-chan struct{}) {
+	if h.reconnect.MaxAge <= 0 {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+		return
+	}
+	timer := time.NewTimer(h.reconnect.MaxAge)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return
+		case <-done:
+			return
+		case <-timer.C:
+			replacement, _, err := h.dialer.DialContext(ctx, h.baseURL+"/ws/"+us.name, nil)
+			if err != nil {
+				timer.Reset(streamRotateRetry)
+				continue
+			}
+			next <- replacement
+			conn.Close()
+			return
+		}
+	}
+}
+
+// rotated registra a troca programada da conexão upstream
+func (h *StreamHub) rotated(us *upstreamStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	us.connectedAt = time.Now()
+	us.reconnects++
+	h.recordEvent(StreamEvent{Stream: us.name, Type: streamEventRotation})
+}
+
+// Events lista os eventos de reconexão guardados, do mais recente ao mais antigo
+func (h *StreamHub) Events() []StreamEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events := make([]StreamEvent, len(h.events))
+	for i, event := range h.events {
+		events[len(h.events)-1-i] = event
+	}
+	return events
+}
+
+func (h *StreamHub) writeMetrics(m *metricsWriter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]streamReconnectKey, 0, len(h.reconnects))
+	for key := range h.reconnects {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].stream != keys[j].stream {
+			return keys[i].stream < keys[j].stream
+		}
+		return keys[i].reason < keys[j].reason
+	})
+	m.family("proxy_stream_reconnects_total", "counter", "Reconexões das conexões WebSocket com a Binance, por stream e motivo (reconnect ou rotation)")
+	for _, key := range keys {
+		m.sample("proxy_stream_reconnects_total", float64(h.reconnects[key]), "stream", key.stream, "reason", key.reason)
+	}
+
+	// No cluster, só os streams de que esta réplica é dona conectam na Binance
+	names := make([]string, 0, len(h.streams))
+	for name, us := range h.streams {
+		if h.cluster == nil || us.owner.Load() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	m.family("proxy_stream_upstream_connected", "gauge", "Conexão com a Binance aberta (1) ou não (0), por stream")
+	for _, name := range names {
+		connected := 0.0
+		if h.streams[name].connected {
+			connected = 1
+		}
+		m.sample("proxy_stream_upstream_connected", connected, "stream", name)
+	}
+	m.family("proxy_stream_reconnect_failures", "gauge", "Tentativas seguidas de reconexão sem sucesso, por stream")
+	for _, name := range names {
+		failures := 0
+		if !h.streams[name].connected {
+			failures = h.streams[name].failures
+		}
+		m.sample("proxy_stream_reconnect_failures", float64(failures), "stream", name)
+	}
+}
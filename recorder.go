@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultRecordingRotate = time.Hour
+	// Intervalo entre os flushes do gzip: um encerramento abrupto perde no
+	// máximo isso
+	recordingFlushInterval = time.Second
+	recordingExt           = ".ndjson.gz"
+	// Sufixo do arquivo em gravação, renomeado ao rotacionar
+	recordingPartExt = ".part"
+	// Formato do início da janela no nome do arquivo
+	recordingStampLayout = "20060102T150405Z"
+)
+
+// RecordingConfig é uma gravação de RECORDINGS_FILE: os streams gravados e
+// a rotação dos arquivos
+type RecordingConfig struct {
+	Name    string   `yaml:"name" json:"name"`
+	Streams []string `yaml:"streams" json:"streams"`
+	// Duração de cada arquivo; os arquivos começam em múltiplos dela (padrão 1h)
+	Rotate time.Duration `yaml:"rotate" json:"rotate"`
+	// Arquivos mais antigos que isso são apagados (0 = manter todos)
+	Retention time.Duration `yaml:"retention" json:"retention,omitempty"`
+	Dir       string        `yaml:"dir" json:"dir"`
+}
+
+type recordingsFile struct {
+	Recordings []RecordingConfig `yaml:"recordings"`
+}
+
+// recordedMessage é uma linha do NDJSON: o envelope dos streams combinados
+// da Binance mais o instante em que o proxy recebeu a mensagem
+type recordedMessage struct {
+	Stream     string          `json:"stream"`
+	ReceivedAt int64           `json:"receivedAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// RecordingFile é um arquivo concluído de uma gravação
+type RecordingFile struct {
+	Name  string `json:"name"`
+	Start int64  `json:"start"`
+	End   int64  `json:"end"`
+	Size  int64  `json:"size"`
+}
+
+// RecordingStatus é a visão de uma gravação em /admin/recordings
+type RecordingStatus struct {
+	RecordingConfig
+	Rotate      string          `json:"rotate"`
+	Retention   string          `json:"retention,omitempty"`
+	CurrentFile string          `json:"currentFile,omitempty"`
+	Messages    uint64          `json:"messages"`
+	LastMessage int64           `json:"lastMessageAt,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Files       []RecordingFile `json:"files"`
+}
+
+// Recording grava os streams de uma configuração em arquivos NDJSON com gzip,
+// um por janela de rotate, em <dir>/<nome>/<início>.ndjson.gz
+type Recording struct {
+	config RecordingConfig
+	proxy  *ProxyServer
+
+	mu          sync.Mutex
+	current     string
+	messages    uint64
+	lastMessage int64
+	err         string
+}
+
+// Recorder executa as gravações de RECORDINGS_FILE
+type Recorder struct {
+	recordings []*Recording
+	byName     map[string]*Recording
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// LoadRecordings lê e valida RECORDINGS_FILE. Sem dir, os arquivos vão para
+// dataDir/recordings.
+func LoadRecordings(path, dataDir string, proxy *ProxyServer) (*Recorder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file recordingsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+
+	r := &Recorder{byName: map[string]*Recording{}, done: make(chan struct{})}
+	for _, config := range file.Recordings {
+		if config.Name == "" || len(config.Streams) == 0 {
+			return nil, fmt.Errorf("gravação incompleta em %s: name e streams são obrigatórios", path)
+		}
+		if filepath.Base(config.Name) != config.Name || strings.HasPrefix(config.Name, ".") {
+			return nil, fmt.Errorf("gravação %s: nome inválido", config.Name)
+		}
+		if _, exists := r.byName[config.Name]; exists {
+			return nil, fmt.Errorf("gravação duplicada: %s", config.Name)
+		}
+		for i, stream := range config.Streams {
+			config.Streams[i] = strings.TrimSpace(stream)
+			if config.Streams[i] == "" {
+				return nil, fmt.Errorf("gravação %s: stream vazio", config.Name)
+			}
+		}
+		if config.Rotate == 0 {
+			config.Rotate = defaultRecordingRotate
+		}
+		if config.Rotate < time.Minute {
+			return nil, fmt.Errorf("gravação %s: rotate deve ser de pelo menos 1m", config.Name)
+		}
+		if config.Retention < 0 {
+			return nil, fmt.Errorf("gravação %s: retention inválido", config.Name)
+		}
+		if config.Dir == "" {
+			config.Dir = filepath.Join(dataDir, "recordings")
+		}
+		recording := &Recording{config: config, proxy: proxy}
+		r.recordings = append(r.recordings, recording)
+		r.byName[config.Name] = recording
+	}
+	return r, nil
+}
+
+// Start inicia as gravações
+func (r *Recorder) Start() {
+	for _, recording := range r.recordings {
+		r.wg.Add(1)
+		go func(recording *Recording) {
+			defer r.wg.Done()
+			recording.run(r.done)
+		}(recording)
+	}
+}
+
+// Close encerra as gravações, fechando os arquivos em andamento
+func (r *Recorder) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+func (rec *Recording) dir() string {
+	return filepath.Join(rec.config.Dir, rec.config.Name)
+}
+
+// recordingWriter é o arquivo da janela atual
+type recordingWriter struct {
+	file  *os.File
+	buf   *bufio.Writer
+	gz    *gzip.Writer
+	path  string
+	start time.Time
+}
+
+func (w *recordingWriter) flush() error {
+	if err := w.gz.Flush(); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+// close termina o gzip e dá ao arquivo o nome final
+func (w *recordingWriter) close() error {
+	err := w.gz.Close()
+	if ferr := w.buf.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := os.Rename(w.path, strings.TrimSuffix(w.path, recordingPartExt)); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// run assina os streams e grava as mensagens até done fechar. Erros de
+// escrita ficam no status e a gravação tenta de novo na mensagem seguinte.
+func (rec *Recording) run(done <-chan struct{}) {
+	sub := rec.proxy.hub.Subscribe(rec.config.Streams...).Label("recording " + rec.config.Name)
+	defer sub.Close()
+
+	ticker := time.NewTicker(recordingFlushInterval)
+	defer ticker.Stop()
+	var w *recordingWriter
+	closeWriter := func() {
+		if w == nil {
+			return
+		}
+		if err := w.close(); err != nil {
+			rec.setError(err)
+		}
+		w = nil
+		rec.mu.Lock()
+		rec.current = ""
+		rec.mu.Unlock()
+	}
+	defer closeWriter()
+
+	lastPrune := time.Time{}
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if w != nil && !now.Before(w.start.Add(rec.config.Rotate)) {
+				closeWriter()
+			}
+			if w != nil {
+				if err := w.flush(); err != nil {
+					rec.setError(err)
+					closeWriter()
+				}
+			}
+			if rec.config.Retention > 0 && now.Sub(lastPrune) >= time.Minute {
+				lastPrune = now
+				rec.prune(now)
+			}
+		case msg := <-sub.C:
+			now := time.Now()
+			if w != nil && !now.Before(w.start.Add(rec.config.Rotate)) {
+				closeWriter()
+			}
+			if w == nil {
+				var err error
+				if w, err = rec.open(now); err != nil {
+					rec.setError(err)
+					continue
+				}
+			}
+			line, err := json.Marshal(recordedMessage{Stream: msg.Stream, ReceivedAt: now.UnixMilli(), Data: msg.Data})
+			if err != nil {
+				continue
+			}
+			line = append(line, '\n')
+			if _, err := w.gz.Write(line); err != nil {
+				rec.setError(err)
+				closeWriter()
+				continue
+			}
+			rec.mu.Lock()
+			rec.messages++
+			rec.lastMessage = now.UnixMilli()
+			rec.err = ""
+			rec.mu.Unlock()
+		}
+	}
+}
+
+// open cria o arquivo da janela que contém now. Se ele já existe (o proxy
+// reiniciou no meio da janela), o novo arquivo ganha o instante atual no nome.
+func (rec *Recording) open(now time.Time) (*recordingWriter, error) {
+	if err := os.MkdirAll(rec.dir(), 0o755); err != nil {
+		return nil, err
+	}
+	start := now.UTC().Truncate(rec.config.Rotate)
+	name := start.Format(recordingStampLayout) + recordingExt
+	if _, err := os.Stat(filepath.Join(rec.dir(), name)); err == nil {
+		name = now.UTC().Format(recordingStampLayout) + recordingExt
+	}
+	path := filepath.Join(rec.dir(), name+recordingPartExt)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(file, 64*1024)
+	rec.mu.Lock()
+	rec.current = name
+	rec.mu.Unlock()
+	return &recordingWriter{file: file, buf: buf, gz: gzip.NewWriter(buf), path: path, start: start}, nil
+}
+
+func (rec *Recording) setError(err error) {
+	rec.mu.Lock()
+	rec.err = err.Error()
+	rec.mu.Unlock()
+}
+
+// prune apaga os arquivos concluídos que terminaram antes da retenção
+func (rec *Recording) prune(now time.Time) {
+	files, err := rec.files()
+	if err != nil {
+		return
+	}
+	cutoff := now.Add(-rec.config.Retention).UnixMilli()
+	for _, file := range files {
+		if file.End < cutoff {
+			os.Remove(filepath.Join(rec.dir(), file.Name))
+		}
+	}
+}
+
+// files lista os arquivos concluídos, do mais antigo ao mais recente. O fim
+// de cada arquivo é o fim da sua janela.
+func (rec *Recording) files() ([]RecordingFile, error) {
+	entries, err := os.ReadDir(rec.dir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []RecordingFile{}, nil
+		}
+		return nil, err
+	}
+	files := []RecordingFile{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, recordingExt) {
+			continue
+		}
+		start, err := time.Parse(recordingStampLayout, strings.TrimSuffix(name, recordingExt))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		end := start.Truncate(rec.config.Rotate).Add(rec.config.Rotate)
+		files = append(files, RecordingFile{Name: name, Start: start.UnixMilli(), End: end.UnixMilli(), Size: info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Start < files[j].Start })
+	return files, nil
+}
+
+func (rec *Recording) status() RecordingStatus {
+	files, err := rec.files()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	status := RecordingStatus{
+		RecordingConfig: rec.config,
+		Rotate:          rec.config.Rotate.String(),
+		CurrentFile:     rec.current,
+		Messages:        rec.messages,
+		LastMessage:     rec.lastMessage,
+		Error:           rec.err,
+		Files:           files,
+	}
+	if rec.config.Retention > 0 {
+		status.Retention = rec.config.Retention.String()
+	}
+	if err != nil && status.Error == "" {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// requireRecorder responde 503 quando não há gravações configuradas
+func (p *ProxyServer) requireRecorder(c *gin.Context) bool {
+	if p.recorder == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Gravação de streams desabilitada (RECORDINGS_FILE)")
+		return false
+	}
+	return true
+}
+
+// loadRecording busca a gravação do path, respondendo 404 se não existir
+func (p *ProxyServer) loadRecording(c *gin.Context) (*Recording, bool) {
+	if !p.requireRecorder(c) {
+		return nil, false
+	}
+	recording, ok := p.recorder.byName[c.Param("name")]
+	if !ok {
+		respondError(c, http.StatusNotFound, -1000, "Gravação não encontrada")
+		return nil, false
+	}
+	return recording, true
+}
+
+// ListRecordings lista as gravações de streams e seus arquivos
+// @Summary Listar gravações de streams
+// @Description Gravações de RECORDINGS_FILE com os streams, o arquivo em andamento, as mensagens gravadas desde o início do proxy e os arquivos concluídos
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/recordings [get]
+func (p *ProxyServer) ListRecordings(c *gin.Context) {
+	if !p.requireRecorder(c) {
+		return
+	}
+	recordings := make([]RecordingStatus, 0, len(p.recorder.recordings))
+	for _, recording := range p.recorder.recordings {
+		recordings = append(recordings, recording.status())
+	}
+	c.JSON(http.StatusOK, gin.H{"recordings": recordings})
+}
+
+// GetRecording retorna uma gravação e seus arquivos
+// @Summary Consultar gravação de streams
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param name path string true "Nome da gravação"
+// @Success 200 {object} RecordingStatus
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/recordings/{name} [get]
+func (p *ProxyServer) GetRecording(c *gin.Context) {
+	recording, ok := p.loadRecording(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, recording.status())
+}
+
+// DownloadRecording baixa um arquivo concluído de uma gravação
+// @Summary Baixar arquivo de gravação
+// @Description Arquivo NDJSON com gzip; cada linha é {"stream", "receivedAt", "data"}. O arquivo em andamento só fica disponível depois da rotação.
+// @Tags Admin
+// @Produce application/gzip
+// @Param X-Admin-Token header string true "Token admin"
+// @Param name path string true "Nome da gravação"
+// @Param file path string true "Nome do arquivo (ex: 20240101T150000Z.ndjson.gz)"
+// @Success 200 {string} string
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/recordings/{name}/files/{file} [get]
+func (p *ProxyServer) DownloadRecording(c *gin.Context) {
+	recording, ok := p.loadRecording(c)
+	if !ok {
+		return
+	}
+	name := c.Param("file")
+	if filepath.Base(name) != name || !strings.HasSuffix(name, recordingExt) {
+		respondError(c, http.StatusNotFound, -1000, "Arquivo não encontrado")
+		return
+	}
+	path := filepath.Join(recording.dir(), name)
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		respondError(c, http.StatusNotFound, -1000, "Arquivo não encontrado")
+		return
+	}
+	c.Header("Content-Type", "application/gzip")
+	c.FileAttachment(path, recording.config.Name+"-"+name)
+}
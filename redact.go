@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const redacted = "REDACTED"
+
+// secretPatterns reconhece segredos em qualquer texto que sai do proxy:
+// parâmetros de query e form, campos JSON, headers (em dumps e mensagens de
+// erro do cliente HTTP, que trazem a URL assinada) e listenKeys
+var secretPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	// signature=..., listenKey=..., apiKey=... em queries e corpos form
+	{regexp.MustCompile(`(?i)\b((?:signature|listenKey|apiKey|api_key|secretKey|secret_key|client_secret)=)[^&\s"'\\]+`), "${1}" + redacted},
+	// "signature": "...", "listenKey": "..." em JSON
+	{regexp.MustCompile(`(?i)("(?:signature|listenKey|apiKey|api_key|secretKey|secret_key|client_secret|token)"\s*:\s*")(?:[^"\\]|\\.)*"`), "${1}" + redacted + `"`},
+	// Headers de credenciais, com ou sem o esquema (Bearer, Basic)
+	{regexp.MustCompile(`(?i)\b((?:X-MBX-APIKEY|Authorization|X-Proxy-Token|X-Proxy-Signature|X-Admin-Token)"?\s*[:=]\s*"?)(?:(?:Bearer|Basic)\s+)?[^\s,"&\\]+`), "${1}" + redacted},
+	// listenKeys e API keys da Binance soltos (paths /ws/<listenKey>, logs),
+	// sequências alfanuméricas longas que não aparecem em dados de mercado
+	{regexp.MustCompile(`\b[A-Za-z0-9]{60,}\b`), redacted},
+}
+
+// redactSecrets remove assinaturas, API keys, listenKeys e tokens do texto
+func redactSecrets(text string) string {
+	for _, pattern := range secretPatterns {
+		text = pattern.re.ReplaceAllString(text, pattern.replacement)
+	}
+	return text
+}
+
+// redactingWriter aplica redactSecrets a tudo que é escrito: o log do
+// processo e os logs de acesso e de pânico do gin passam por ele
+type redactingWriter struct {
+	w io.Writer
+}
+
+func newRedactingWriter(w io.Writer) io.Writer {
+	return &redactingWriter{w: w}
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redactSecrets(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redactErrorWriter aplica redactSecrets às respostas de erro (status >=
+// 400), qualquer que seja o handler que as escreveu. O Content-Length é
+// descartado porque o corpo muda de tamanho.
+type redactErrorWriter struct {
+	gin.ResponseWriter
+}
+
+func (w *redactErrorWriter) Write(data []byte) (int, error) {
+	if w.Status() < http.StatusBadRequest {
+		return w.ResponseWriter.Write(data)
+	}
+	if !w.Written() {
+		w.Header().Del("Content-Length")
+	}
+	if _, err := w.ResponseWriter.WriteString(redactSecrets(string(data))); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *redactErrorWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// RedactErrors remove segredos das respostas de erro: mensagens do cliente
+// HTTP trazem a URL assinada e erros repassados podem ecoar parâmetros
+func RedactErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &redactErrorWriter{ResponseWriter: c.Writer}
+		c.Next()
+	}
+}
+
+// redactStatus remove segredos da mensagem de um erro gRPC
+func redactStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return status.Error(status.Code(err), redactSecrets(err.Error()))
+	}
+	if message := redactSecrets(st.Message()); message != st.Message() {
+		return status.Error(st.Code(), message)
+	}
+	return err
+}
+
+// grpcRedactUnary e grpcRedactStream aplicam redactStatus aos erros de
+// todos os métodos gRPC
+func grpcRedactUnary(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	return resp, redactStatus(err)
+}
+
+func grpcRedactStream(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return redactStatus(handler(srv, ss))
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	redisDialTimeout = 5 * time.Second
+	redisIOTimeout   = 5 * time.Second
+)
+
+// redisError é uma resposta de erro do Redis (-ERR ...)
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// RedisClient é um cliente mínimo do protocolo RESP, suficiente para a
+// coordenação entre réplicas: comandos simples numa conexão compartilhada e
+// pub/sub numa conexão própria (ver RedisPubSub)
+type RedisClient struct {
+	addr     string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewRedisClient interpreta REDIS_URL (redis://[:senha@]host:porta[/db])
+func NewRedisClient(rawURL string) (*RedisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("REDIS_URL inválida (use redis://[:senha@]host:porta[/db])")
+	}
+	client := &RedisClient{addr: u.Host}
+	if !strings.Contains(u.Host, ":") {
+		client.addr += ":6379"
+	}
+	if u.User != nil {
+		client.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if client.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("REDIS_URL: banco inválido %q", db)
+		}
+	}
+	return client, nil
+}
+
+// dial abre uma conexão autenticada e com o banco selecionado
+func (r *RedisClient) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", r.addr, redisDialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	rd := bufio.NewReader(conn)
+	var setup [][]string
+	if r.password != "" {
+		setup = append(setup, []string{"AUTH", r.password})
+	}
+	if r.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	for _, args := range setup {
+		conn.SetDeadline(time.Now().Add(redisIOTimeout))
+		if err := writeRedisCommand(conn, args); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		if _, err := readRedisReply(rd); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, rd, nil
+}
+
+// Do executa um comando e retorna a resposta: string (+OK), int64, []byte
+// (bulk), nil, []interface{} ou redisError. Uma conexão caída é reaberta
+// uma vez.
+func (r *RedisClient) Do(args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if r.conn == nil {
+			conn, rd, err := r.dial()
+			if err != nil {
+				return nil, err
+			}
+			r.conn, r.rd = conn, rd
+		}
+		r.conn.SetDeadline(time.Now().Add(redisIOTimeout))
+		err := writeRedisCommand(r.conn, args)
+		var reply interface{}
+		if err == nil {
+			reply, err = readRedisReply(r.rd)
+		}
+		var replyErr redisError
+		if err == nil || errors.As(err, &replyErr) {
+			return reply, err
+		}
+		r.conn.Close()
+		r.conn = nil
+		if attempt > 0 {
+			return nil, err
+		}
+	}
+}
+
+// Close fecha a conexão de comandos
+func (r *RedisClient) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
+
+func writeRedisCommand(w io.Writer, args []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func readRedisReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("resposta vazia do Redis")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readRedisReply(rd); err != nil {
+				var replyErr redisError
+				if !errors.As(err, &replyErr) {
+					return nil, err
+				}
+				items[i] = replyErr
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("resposta inesperada do Redis: %q", line)
+}
+
+// RedisPubSub mantém uma conexão dedicada às assinaturas de canais,
+// reconectando e reassinando os canais quando ela cai
+type RedisPubSub struct {
+	client *RedisClient
+	done   chan struct{}
+
+	mu       sync.Mutex
+	conn     net.Conn
+	handlers map[string]func(data []byte)
+}
+
+// PubSub inicia a conexão de assinaturas em segundo plano
+func (r *RedisClient) PubSub() *RedisPubSub {
+	ps := &RedisPubSub{client: r, done: make(chan struct{}), handlers: map[string]func([]byte){}}
+	go ps.run()
+	return ps
+}
+
+// Subscribe entrega a handler as mensagens publicadas no canal. handler
+// roda na goroutine de leitura e não deve bloquear.
+func (ps *RedisPubSub) Subscribe(channel string, handler func(data []byte)) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.handlers[channel] = handler
+	if ps.conn != nil {
+		writeRedisCommand(ps.conn, []string{"SUBSCRIBE", channel})
+	}
+}
+
+func (ps *RedisPubSub) Unsubscribe(channel string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.handlers, channel)
+	if ps.conn != nil {
+		writeRedisCommand(ps.conn, []string{"UNSUBSCRIBE", channel})
+	}
+}
+
+func (ps *RedisPubSub) Close() {
+	close(ps.done)
+	ps.mu.Lock()
+	if ps.conn != nil {
+		ps.conn.Close()
+	}
+	ps.mu.Unlock()
+}
+
+func (ps *RedisPubSub) run() {
+	backoff := streamReconnectMin
+	for {
+		connected, _ := ps.session()
+		// log.Printf("[WARN] Conexão pub/sub com o Redis caiu: %v", err)
+		if connected {
+			backoff = streamReconnectMin
+		}
+		select {
+		case <-ps.done:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > streamReconnectMax {
+			backoff = streamReconnectMax
+		}
+	}
+}
+
+// session assina os canais registrados e entrega as mensagens até a conexão cair
+func (ps *RedisPubSub) session() (bool, error) {
+	conn, rd, err := ps.client.dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	ps.mu.Lock()
+	select {
+	case <-ps.done:
+		ps.mu.Unlock()
+		return false, nil
+	default:
+	}
+	ps.conn = conn
+	for channel := range ps.handlers {
+		writeRedisCommand(conn, []string{"SUBSCRIBE", channel})
+	}
+	ps.mu.Unlock()
+	defer func() {
+		ps.mu.Lock()
+		ps.conn = nil
+		ps.mu.Unlock()
+	}()
+
+	for {
+		reply, err := readRedisReply(rd)
+		if err != nil {
+			return true, err
+		}
+		// Mensagens: ["message", canal, payload]
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 3 {
+			continue
+		}
+		kind, _ := items[0].([]byte)
+		channel, _ := items[1].([]byte)
+		data, _ := items[2].([]byte)
+		if string(kind) != "message" {
+			continue
+		}
+		ps.mu.Lock()
+		handler := ps.handlers[string(channel)]
+		ps.mu.Unlock()
+		if handler != nil {
+			handler(data)
+		}
+	}
+}
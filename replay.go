@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReplayConcurrency = 64
+	defaultReplayTimeout     = 30 * time.Second
+)
+
+// replayEntry é uma requisição gravada a ser reproduzida
+type replayEntry struct {
+	time      time.Time
+	method    string
+	target    string
+	latencyMs float64
+}
+
+// accessLogLine reconhece as linhas do log de acesso (accessLogFormatter)
+var accessLogLine = regexp.MustCompile(`^\[GIN\] (\d{4}/\d{2}/\d{2} - \d{2}:\d{2}:\d{2}) \| *(\d+) \| *(\S+) \| *\S* \| *\S+ *\| (\S+) +(".*")$`)
+
+// readHistoryEntries lê as requisições do histórico (HISTORY_DB) no
+// intervalo, em ordem cronológica
+func readHistoryEntries(path, prefix string, since, until int64, limit int) ([]replayEntry, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `SELECT ts, method, path, query, latency_ms FROM requests WHERE path LIKE ? ESCAPE '\'`
+	args := []interface{}{strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"}
+	if since > 0 {
+		query += " AND ts >= ?"
+		args = append(args, since)
+	}
+	if until > 0 {
+		query += " AND ts <= ?"
+		args = append(args, until)
+	}
+	query += " ORDER BY ts, id"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []replayEntry
+	for rows.Next() {
+		var (
+			ts        int64
+			method    string
+			path, raw string
+			latencyMs float64
+		)
+		if err := rows.Scan(&ts, &method, &path, &raw, &latencyMs); err != nil {
+			return nil, err
+		}
+		target := path
+		if raw != "" {
+			target += "?" + raw
+		}
+		entries = append(entries, replayEntry{time: time.UnixMilli(ts), method: method, target: target, latencyMs: latencyMs})
+	}
+	return entries, rows.Err()
+}
+
+// readAccessLogEntries lê as requisições do log de acesso do gin. Linhas
+// que não são de acesso (erros, logs do processo) são ignoradas.
+func readAccessLogEntries(r io.Reader, prefix string, since, until int64, limit int) ([]replayEntry, error) {
+	var entries []replayEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		match := accessLogLine.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		ts, err := time.ParseInLocation("2006/01/02 - 15:04:05", match[1], time.Local)
+		if err != nil {
+			continue
+		}
+		target, err := strconv.Unquote(match[5])
+		if err != nil || !strings.HasPrefix(target, prefix) {
+			continue
+		}
+		if since > 0 && ts.UnixMilli() < since || until > 0 && ts.UnixMilli() > until {
+			continue
+		}
+		latency, _ := time.ParseDuration(match[3])
+		entries = append(entries, replayEntry{
+			time:      ts,
+			method:    match[4],
+			target:    target,
+			latencyMs: float64(latency.Microseconds()) / 1000,
+		})
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].time.Before(entries[j].time) })
+	return entries, scanner.Err()
+}
+
+// replayable indica se a requisição pode ser reproduzida: só GET e HEAD
+// (ordens e outras escritas nunca são repetidas) e sem assinatura, que foi
+// removida da gravação e não seria aceita de novo
+func replayable(entry replayEntry) bool {
+	if entry.method != http.MethodGet && entry.method != http.MethodHead {
+		return false
+	}
+	return !strings.Contains(entry.target, redacted) && !strings.Contains(entry.target, "signature=")
+}
+
+// replayResult é o resultado de uma requisição reproduzida
+type replayResult struct {
+	status  int
+	latency time.Duration
+	err     error
+}
+
+// replayHeaders acumula os -header NOME:VALOR da linha de comando
+type replayHeaders http.Header
+
+func (h replayHeaders) String() string { return "" }
+
+func (h replayHeaders) Set(value string) error {
+	name, content, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return errors.New("use NOME:VALOR")
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(content))
+	return nil
+}
+
+// runReplay implementa o comando replay: reproduz contra target o tráfego
+// gravado no histórico (HISTORY_DB) ou no log de acesso, no ritmo original
+// multiplicado por speed (0 = o mais rápido possível), e imprime latência e
+// status comparados aos gravados. Retorna o código de saída do processo.
+func runReplay(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(out)
+	var (
+		historyPath = flags.String("history", "", "banco SQLite do histórico (HISTORY_DB)")
+		logPath     = flags.String("log", "", "log de acesso do proxy (- para a entrada padrão)")
+		target      = flags.String("target", "", "URL base do proxy sob teste (ex: http://localhost:8080)")
+		speed       = flags.Float64("speed", 1, "multiplicador do ritmo original (0 = o mais rápido possível)")
+		prefix      = flags.String("path", "/", "só paths com este prefixo")
+		sinceRaw    = flags.String("since", "", "início (ms ou RFC3339)")
+		untilRaw    = flags.String("until", "", "fim (ms ou RFC3339)")
+		limit       = flags.Int("limit", 0, "máximo de requisições (0 = todas)")
+		concurrency = flags.Int("concurrency", defaultReplayConcurrency, "máximo de requisições simultâneas")
+		timeout     = flags.Duration("timeout", defaultReplayTimeout, "timeout de cada requisição")
+		headers     = replayHeaders{}
+	)
+	flags.Var(headers, "header", "header enviado em todas as requisições, NOME:VALOR (repetível)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *target == "" || (*historyPath == "") == (*logPath == "") || *speed < 0 || *concurrency <= 0 {
+		fmt.Fprintln(out, "uso: replay -target URL (-history arquivo.db | -log arquivo) [-speed N] [-path /prefixo] [-since T] [-until T] [-limit N] [-concurrency N] [-header NOME:VALOR]")
+		return 2
+	}
+	var since, until int64
+	for _, bound := range []struct {
+		raw string
+		out *int64
+	}{{*sinceRaw, &since}, {*untilRaw, &until}} {
+		if bound.raw == "" {
+			continue
+		}
+		ts, ok := parseHistoryTime(bound.raw)
+		if !ok {
+			fmt.Fprintf(out, "data inválida %q (use ms ou RFC3339)\n", bound.raw)
+			return 2
+		}
+		*bound.out = ts
+	}
+
+	var entries []replayEntry
+	var err error
+	switch {
+	case *historyPath != "":
+		entries, err = readHistoryEntries(*historyPath, *prefix, since, until, *limit)
+	case *logPath == "-":
+		entries, err = readAccessLogEntries(os.Stdin, *prefix, since, until, *limit)
+	default:
+		var file *os.File
+		if file, err = os.Open(*logPath); err == nil {
+			entries, err = readAccessLogEntries(file, *prefix, since, until, *limit)
+			file.Close()
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(out, "erro ao ler o tráfego gravado: %v\n", err)
+		return 1
+	}
+
+	var selected []replayEntry
+	for _, entry := range entries {
+		if replayable(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	skipped := len(entries) - len(selected)
+	if len(selected) == 0 {
+		fmt.Fprintf(out, "nenhuma requisição reproduzível (%d ignoradas)\n", skipped)
+		return 1
+	}
+
+	results := replay(selected, strings.TrimRight(*target, "/"), http.Header(headers), *speed, *concurrency, *timeout)
+	// Falhas de conexão indicam um alvo fora do ar ou saturado
+	if failures := writeReplayReport(out, selected, results, skipped); failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+// replay dispara as requisições respeitando os intervalos gravados
+func replay(entries []replayEntry, target string, headers http.Header, speed float64, concurrency int, timeout time.Duration) []replayResult {
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: concurrency},
+		// Redirecionamentos (afinidade de tenant no cluster) contam como resposta
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	results := make([]replayResult, len(entries))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	start, first := time.Now(), entries[0].time
+	for i, entry := range entries {
+		if speed > 0 {
+			offset := time.Duration(float64(entry.time.Sub(first)) / speed)
+			if wait := time.Until(start.Add(offset)); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, entry replayEntry) {
+			defer func() { <-slots; wg.Done() }()
+			req, err := http.NewRequestWithContext(context.Background(), entry.method, target+entry.target, nil)
+			if err != nil {
+				results[i] = replayResult{err: err}
+				return
+			}
+			for key, values := range headers {
+				req.Header[key] = values
+			}
+			began := time.Now()
+			resp, err := client.Do(req)
+			if err != nil {
+				results[i] = replayResult{err: err, latency: time.Since(began)}
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			results[i] = replayResult{status: resp.StatusCode, latency: time.Since(began)}
+		}(i, entry)
+	}
+	wg.Wait()
+	return results
+}
+
+// writeReplayReport imprime o resumo: status, falhas de conexão e
+// percentis de latência da reprodução ao lado dos gravados. Retorna o
+// número de falhas de conexão.
+func writeReplayReport(out io.Writer, entries []replayEntry, results []replayResult, skipped int) int {
+	var replayed, recorded []time.Duration
+	status := map[int]int{}
+	failures := 0
+	var firstErr error
+	for i, result := range results {
+		if result.err != nil {
+			failures++
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+		status[result.status]++
+		replayed = append(replayed, result.latency)
+		recorded = append(recorded, time.Duration(entries[i].latencyMs*float64(time.Millisecond)))
+	}
+	sort.Slice(replayed, func(i, j int) bool { return replayed[i] < replayed[j] })
+	sort.Slice(recorded, func(i, j int) bool { return recorded[i] < recorded[j] })
+
+	span := entries[len(entries)-1].time.Sub(entries[0].time)
+	fmt.Fprintf(out, "requisições: %d reproduzidas, %d ignoradas (escritas ou assinadas), %d falhas de conexão\n", len(results), skipped, failures)
+	fmt.Fprintf(out, "período gravado: %s\n", span)
+	codes := make([]int, 0, len(status))
+	for code := range status {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(out, "status %d: %d\n", code, status[code])
+	}
+	fmt.Fprintf(out, "%-10s %10s %10s\n", "latência", "gravada", "replay")
+	for _, q := range []struct {
+		name string
+		q    float64
+	}{{"p50", 0.50}, {"p90", 0.90}, {"p99", 0.99}, {"max", 1}} {
+		fmt.Fprintf(out, "%-10s %8.2fms %8.2fms\n", q.name, benchPercentile(recorded, q.q), benchPercentile(replayed, q.q))
+	}
+	if firstErr != nil {
+		fmt.Fprintf(out, "primeira falha: %v\n", redactSecrets(firstErr.Error()))
+	}
+	return failures
+}
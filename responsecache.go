@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultResponseCacheMaxEntries = 1000
+	defaultResponseCacheMaxBody    = 1 << 20
+	defaultResponseCacheMaxBytes   = 64 << 20
+	responseCacheHeader            = "X-Proxy-Cache"
+)
+
+// credentialHeaders entram sempre na chave do cache: a mesma rota chamada
+// com credenciais diferentes nunca compartilha a resposta
+var credentialHeaders = []string{"X-MBX-APIKEY", "Authorization", "X-Proxy-Token", clientTenantHeader, upstreamBaseHeader}
+
+// credentialHeaderKeys é credentialHeaders na forma canônica, a usada nas
+// chaves (r.Header[nome] não aloca como r.Header.Values)
+var credentialHeaderKeys = canonicalHeaders(credentialHeaders)
+
+func canonicalHeaders(headers []string) []string {
+	keys := make([]string, len(headers))
+	for i, header := range headers {
+		keys[i] = http.CanonicalHeaderKey(header)
+	}
+	return keys
+}
+
+// perRequestHeaders não são guardados com a resposta: cada requisição tem os
+// seus
+var perRequestHeaders = []string{responseCacheHeader, requestIDHeader, "Server-Timing"}
+
+// Valores de X-Proxy-Cache, compartilhados entre as respostas
+var (
+	cacheHitValue    = []string{"HIT"}
+	cacheMissValue   = []string{"MISS"}
+	cacheBypassValue = []string{"BYPASS"}
+	cacheStaleValue  = []string{"STALE"}
+)
+
+// privateEndpointPrefixes nunca são guardados, mesmo que uma regra os cubra:
+// conta, ordens, user data stream e toda a /sapi
+var privateEndpointPrefixes = []string{
+	"/account", "/myTrades", "/myPreventedMatches", "/myAllocations", "/order", "/openOrder",
+	"/allOrder", "/userDataStream", "/rateLimit/order", "/sor/order", "/sapi/",
+}
+
+// cacheRule é uma rota cacheável (padrão de path.Match no endpoint após
+// /api/v3) com a validade das respostas
+type cacheRule struct {
+	pattern string
+	ttl     time.Duration
+}
+
+// cachedResponse é uma resposta guardada
+type cachedResponse struct {
+	status   int
+	header   http.Header
+	body     []byte
+	storedAt time.Time
+	expires  time.Time
+}
+
+// size estima a memória ocupada pela resposta: corpo e headers
+func (e *cachedResponse) size() int64 {
+	n := int64(len(e.body))
+	for key, values := range e.header {
+		n += int64(len(key))
+		for _, value := range values {
+			n += int64(len(value))
+		}
+	}
+	return n
+}
+
+// ResponseCache guarda respostas da Binance repassadas na raiz do proxy,
+// só nas rotas de RESPONSE_CACHE_ROUTES. A chave inclui método, endpoint,
+// query normalizada, os headers de credenciais (API key, token do tenant),
+// os de RESPONSE_CACHE_VARY e os que a Binance listar em Vary, para que uma
+// resposta privada não seja servida a outro cliente. Chamadas assinadas,
+// endpoints de conta e respostas com Cache-Control private/no-store nunca
+// são guardados. Com RESPONSE_CACHE_MAX_ENTRIES respostas ou
+// RESPONSE_CACHE_MAX_BYTES ocupados, as menos usadas recentemente saem.
+type ResponseCache struct {
+	rules []cacheRule
+	never []string
+	vary  []string
+	// varyKeys é vary na forma canônica, usada nas chaves
+	varyKeys   []string
+	maxEntries int
+	maxBody    int
+
+	// As chaves dos mapas são o cacheKey como string(key[:])
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+	budget  *cacheBudget
+	// varyIndex guarda, por chave primária, os headers do Vary da Binance
+	varyIndex map[string][]string
+
+	hits, misses, bypassed atomic.Int64
+	// Com true (manutenção da Binance), respostas vencidas são servidas
+	serveStale func() bool
+	stale      atomic.Int64
+}
+
+// ParseResponseCache lê as regras (ex: /depth=1s,/ticker/*=2s) e as rotas
+// nunca cacheadas (ex: /historicalTrades). Sem regras, retorna nil.
+func ParseResponseCache(routes, never, vary string) (*ResponseCache, error) {
+	cache := &ResponseCache{
+		maxEntries: getEnvInt("RESPONSE_CACHE_MAX_ENTRIES", defaultResponseCacheMaxEntries),
+		maxBody:    getEnvInt("RESPONSE_CACHE_MAX_BODY", defaultResponseCacheMaxBody),
+		entries:    map[string]*cachedResponse{},
+		budget:     newCacheBudget(int64(getEnvInt("RESPONSE_CACHE_MAX_BYTES", defaultResponseCacheMaxBytes))),
+		varyIndex:  map[string][]string{},
+	}
+	for _, entry := range strings.Split(routes, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, value, ok := strings.Cut(entry, "=")
+		ttl, err := time.ParseDuration(strings.TrimSpace(value))
+		if !ok || err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("regra de cache inválida: %q (use /path=duração)", entry)
+		}
+		pattern = normalizePattern(pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("padrão inválido %q: %w", pattern, err)
+		}
+		cache.rules = append(cache.rules, cacheRule{pattern: pattern, ttl: ttl})
+	}
+	if len(cache.rules) == 0 {
+		return nil, nil
+	}
+	for _, pattern := range strings.Split(never, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			pattern = normalizePattern(pattern)
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("padrão inválido %q: %w", pattern, err)
+			}
+			cache.never = append(cache.never, pattern)
+		}
+	}
+	cache.vary = append(cache.vary, credentialHeaders...)
+	for _, header := range strings.Split(vary, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			cache.vary = append(cache.vary, http.CanonicalHeaderKey(header))
+		}
+	}
+	cache.varyKeys = canonicalHeaders(cache.vary)
+	return cache, nil
+}
+
+func normalizePattern(pattern string) string {
+	pattern = strings.TrimSpace(pattern)
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+	return pattern
+}
+
+// ttlFor retorna a validade da rota, ou zero se ela não pode ser guardada
+func (rc *ResponseCache) ttlFor(endpoint string) time.Duration {
+	for _, prefix := range privateEndpointPrefixes {
+		if strings.HasPrefix(endpoint, prefix) {
+			return 0
+		}
+	}
+	for _, pattern := range rc.never {
+		if ok, _ := path.Match(pattern, endpoint); ok {
+			return 0
+		}
+	}
+	for _, rule := range rc.rules {
+		if ok, _ := path.Match(rule.pattern, endpoint); ok {
+			return rule.ttl
+		}
+	}
+	return 0
+}
+
+// primaryKey identifica a requisição: método, path, query normalizada e os
+// headers fixos de variação
+func (rc *ResponseCache) primaryKey(r *http.Request) cacheKey {
+	return requestKeySum(r, rc.varyKeys)
+}
+
+// cacheKey é o sha256 que identifica uma requisição no cache
+type cacheKey [sha256.Size]byte
+
+// keyBufferPool guarda os buffers em que as chaves são montadas: numa
+// consulta ao cache, calcular a chave não aloca
+var keyBufferPool = sync.Pool{New: func() any { return new([]byte) }}
+
+// requestKeySum resume método, path, query normalizada e os headers
+// indicados, na forma canônica
+func requestKeySum(r *http.Request, headers []string) cacheKey {
+	buf := keyBufferPool.Get().(*[]byte)
+	key := append((*buf)[:0], r.Method...)
+	key = append(key, ' ')
+	key = append(key, r.URL.Path...)
+	key = append(key, '?')
+	key = appendSortedQuery(key, r.URL.RawQuery)
+	key = appendHeaderValues(key, r, headers)
+	sum := sha256.Sum256(key)
+	*buf = key
+	keyBufferPool.Put(buf)
+	return sum
+}
+
+// requestKey é o requestKeySum em hexadecimal
+func requestKey(r *http.Request, headers []string) string {
+	sum := requestKeySum(r, headers)
+	return hex.EncodeToString(sum[:])
+}
+
+// appendHeaderValues acrescenta a dst os valores dos headers, um por linha
+func appendHeaderValues(dst []byte, r *http.Request, headers []string) []byte {
+	for _, header := range headers {
+		dst = append(dst, '\n')
+		dst = append(dst, header...)
+		dst = append(dst, ": "...)
+		for i, value := range r.Header[header] {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(dst, value...)
+		}
+	}
+	return dst
+}
+
+// variantKey acrescenta à chave primária os headers do Vary da resposta
+func variantKey(primary cacheKey, r *http.Request, vary []string) cacheKey {
+	if len(vary) == 0 {
+		return primary
+	}
+	buf := keyBufferPool.Get().(*[]byte)
+	key := appendHeaderValues(append((*buf)[:0], primary[:]...), r, vary)
+	sum := sha256.Sum256(key)
+	*buf = key
+	keyBufferPool.Put(buf)
+	return sum
+}
+
+// responseVary lista os headers do Vary da resposta. Vary: * impede o cache.
+func responseVary(header http.Header) ([]string, bool) {
+	var vary []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				vary = append(vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(vary)
+	return vary, true
+}
+
+// storable confere se a resposta pode ser guardada
+func storable(status int, header http.Header) bool {
+	if status != http.StatusOK || header.Get("Set-Cookie") != "" {
+		return false
+	}
+	cacheControl := strings.ToLower(header.Get("Cache-Control"))
+	if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") {
+		return false
+	}
+	return !strings.Contains(header.Get("Content-Type"), ndjsonContentType)
+}
+
+// lookup busca a resposta guardada; com allowStale, uma vencida também serve
+// (fresh false)
+func (rc *ResponseCache) lookup(primary cacheKey, r *http.Request, allowStale bool) (*cachedResponse, bool, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	variant := variantKey(primary, r, rc.varyIndex[string(primary[:])])
+	entry, ok := rc.entries[string(variant[:])]
+	if !ok {
+		return nil, false, false
+	}
+	fresh := !time.Now().After(entry.expires)
+	if !fresh && !allowStale {
+		return nil, false, false
+	}
+	rc.budget.touch(string(variant[:]))
+	return entry, fresh, true
+}
+
+func (rc *ResponseCache) store(primary cacheKey, r *http.Request, vary []string, entry *cachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	variant := variantKey(primary, r, vary)
+	key := string(variant[:])
+	if _, exists := rc.entries[key]; !exists && len(rc.entries) >= rc.maxEntries {
+		now := time.Now()
+		for stale, stored := range rc.entries {
+			if now.After(stored.expires) {
+				delete(rc.entries, stale)
+				rc.budget.remove(stale)
+			}
+		}
+		for len(rc.entries) >= rc.maxEntries {
+			oldest, ok := rc.budget.oldest()
+			if !ok {
+				break
+			}
+			delete(rc.entries, oldest)
+			rc.budget.evict(oldest)
+		}
+	}
+	evicted, ok := rc.budget.set(key, entry.size())
+	for _, old := range evicted {
+		delete(rc.entries, old)
+	}
+	if !ok {
+		delete(rc.entries, key)
+		return
+	}
+	rc.varyIndex[string(primary[:])] = vary
+	rc.entries[key] = entry
+}
+
+// cacheWriter copia a resposta enquanto ela é enviada ao cliente
+type cacheWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	overflow bool
+	limit    int
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	if !w.overflow {
+		if w.buf.Len()+len(data) > w.limit {
+			w.overflow = true
+			w.buf.Reset()
+		} else {
+			w.buf.Write(data)
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Middleware serve do cache as rotas cacheáveis e guarda as respostas que
+// podem ser compartilhadas. X-Proxy-Cache informa HIT, MISS ou BYPASS.
+func (rc *ResponseCache) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rc == nil {
+			c.Next()
+			return
+		}
+		ttl := rc.ttlFor(upstreamEndpoint(c.Request.URL.Path))
+		if ttl == 0 || c.Request.Method != http.MethodGet || isHeadRequest(c.Request.Context()) || isSignedRequest(c) {
+			if ttl > 0 {
+				rc.bypassed.Add(1)
+				c.Writer.Header()[responseCacheHeader] = cacheBypassValue
+			}
+			c.Next()
+			return
+		}
+
+		primary := rc.primaryKey(c.Request)
+		allowStale := rc.serveStale != nil && rc.serveStale()
+		if entry, fresh, ok := rc.lookup(primary, c.Request, allowStale); ok {
+			header := c.Writer.Header()
+			for key, values := range entry.header {
+				header[key] = values
+			}
+			if fresh {
+				rc.hits.Add(1)
+				header[responseCacheHeader] = cacheHitValue
+			} else {
+				rc.stale.Add(1)
+				header[responseCacheHeader] = cacheStaleValue
+			}
+			header["Age"] = intHeaderValue(int(time.Since(entry.storedAt).Seconds()))
+			// O Content-Type veio com os headers guardados
+			c.Status(entry.status)
+			c.Writer.Write(entry.body)
+			c.Abort()
+			return
+		}
+		rc.misses.Add(1)
+		c.Writer.Header()[responseCacheHeader] = cacheMissValue
+
+		writer := &cacheWriter{ResponseWriter: c.Writer, limit: rc.maxBody}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		header := writer.Header()
+		vary, ok := responseVary(header)
+		if !ok || writer.overflow || !storable(writer.Status(), header) {
+			return
+		}
+		stored := header.Clone()
+		// Headers desta requisição, não da resposta
+		for _, name := range perRequestHeaders {
+			stored.Del(name)
+		}
+		now := time.Now()
+		rc.store(primary, c.Request, vary, &cachedResponse{
+			status:   writer.Status(),
+			header:   stored,
+			body:     bytes.Clone(writer.buf.Bytes()),
+			storedAt: now,
+			expires:  now.Add(ttl),
+		})
+	}
+}
+
+// Purge esvazia o cache
+func (rc *ResponseCache) Purge() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	n := len(rc.entries)
+	rc.entries = map[string]*cachedResponse{}
+	rc.varyIndex = map[string][]string{}
+	rc.budget.reset()
+	return n
+}
+
+// Usage retorna o tamanho e as remoções do cache
+func (rc *ResponseCache) Usage() cacheUsage {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.budget.usage("response")
+}
+
+// ResponseCacheStatus mostra as regras e os contadores do cache de respostas
+// @Summary Cache de respostas
+// @Description Regras de RESPONSE_CACHE_ROUTES, rotas nunca cacheadas, headers que entram na chave, contadores de HIT/MISS/BYPASS e memória ocupada (bytes, orçamento, remoções LRU)
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/cache [get]
+func (p *ProxyServer) ResponseCacheStatus(c *gin.Context) {
+	rc := p.responses
+	if rc == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	rules := make([]gin.H, len(rc.rules))
+	for i, rule := range rc.rules {
+		rules[i] = gin.H{"pattern": rule.pattern, "ttl": rule.ttl.String()}
+	}
+	usage := rc.Usage()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":    true,
+		"rules":      rules,
+		"never":      append(append([]string{}, privateEndpointPrefixes...), rc.never...),
+		"vary":       rc.vary,
+		"entries":    usage.Entries,
+		"maxEntries": rc.maxEntries,
+		"bytes":      usage.Bytes,
+		"maxBytes":   usage.MaxBytes,
+		"evictions":  usage.Evictions,
+		"rejected":   usage.Rejected,
+		"hits":       rc.hits.Load(),
+		"misses":     rc.misses.Load(),
+		"bypassed":   rc.bypassed.Load(),
+		"stale":      rc.stale.Load(),
+	})
+}
+
+// PurgeResponseCache esvazia o cache de respostas
+// @Summary Esvaziar o cache de respostas
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/cache [delete]
+func (p *ProxyServer) PurgeResponseCache(c *gin.Context) {
+	purged := 0
+	if p.responses != nil {
+		purged = p.responses.Purge()
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
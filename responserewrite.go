@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	RegisterPlugin("response-rewrite", newResponseRewritePlugin)
+}
+
+// errPatchTest indica que uma operação test do patch não casou; a resposta
+// segue sem alteração
+var errPatchTest = errors.New("test do patch não casou")
+
+// jsonPatchOp é uma operação JSON Patch (RFC 6902). Como extensão, um
+// segmento * no path (ou no from) percorre todos os itens de um array ou
+// todas as chaves de um objeto, ex: /*/price.
+type jsonPatchOp struct {
+	Op    string      `yaml:"op"`
+	Path  string      `yaml:"path"`
+	From  string      `yaml:"from"`
+	Value interface{} `yaml:"value"`
+}
+
+// responseRewritePlugin reescreve o corpo JSON das rotas configuradas com
+// JSON Patch e/ou um template Go (type: response-rewrite em PLUGINS_FILE)
+type responseRewritePlugin struct {
+	patch    []jsonPatchOp
+	template *template.Template
+	// Status HTTP reescritos; vazio = só 2xx
+	status []int
+}
+
+type responseRewriteConfig struct {
+	Patch    []jsonPatchOp `yaml:"patch"`
+	Template string        `yaml:"template"`
+	Status   []int         `yaml:"status"`
+}
+
+// responseTemplateData é o valor de "." nos templates
+type responseTemplateData struct {
+	Body   interface{}
+	Status int
+	Method string
+	Path   string
+	Query  url.Values
+}
+
+var responseTemplateFuncs = template.FuncMap{
+	// json serializa um valor (objetos, arrays, strings com aspas)
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// now é o horário atual em milissegundos
+	"now": func() int64 { return time.Now().UnixMilli() },
+}
+
+func newResponseRewritePlugin(config map[string]interface{}) (Plugin, error) {
+	var cfg responseRewriteConfig
+	if err := decodePluginConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Patch) == 0 && cfg.Template == "" {
+		return nil, fmt.Errorf("defina patch e/ou template")
+	}
+	p := &responseRewritePlugin{status: cfg.Status}
+	for i, op := range cfg.Patch {
+		switch op.Op {
+		case "add", "replace", "remove", "test":
+		case "move", "copy":
+			if op.From == "" {
+				return nil, fmt.Errorf("patch %d: %s exige from", i+1, op.Op)
+			}
+		default:
+			return nil, fmt.Errorf("patch %d: op desconhecida %q", i+1, op.Op)
+		}
+		if op.Path != "" && !strings.HasPrefix(op.Path, "/") {
+			return nil, fmt.Errorf("patch %d: path deve começar com /", i+1)
+		}
+		// Normaliza o valor do YAML para os mesmos tipos do corpo decodificado
+		if op.Value != nil {
+			data, err := json.Marshal(op.Value)
+			if err != nil {
+				return nil, fmt.Errorf("patch %d: value inválido: %w", i+1, err)
+			}
+			cfg.Patch[i].Value, _ = decodeJSONNumber(data)
+		}
+	}
+	p.patch = cfg.Patch
+	if cfg.Template != "" {
+		tmpl, err := template.New("response").Funcs(responseTemplateFuncs).Option("missingkey=zero").Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("template inválido: %w", err)
+		}
+		p.template = tmpl
+	}
+	return p, nil
+}
+
+func (p *responseRewritePlugin) Name() string { return "response-rewrite" }
+
+func decodeJSONNumber(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	err := decoder.Decode(&v)
+	return v, err
+}
+
+func (p *responseRewritePlugin) rewrites(status int) bool {
+	if len(p.status) == 0 {
+		return status >= 200 && status <= 299
+	}
+	return slices.Contains(p.status, status)
+}
+
+func (p *responseRewritePlugin) AfterResponse(c *gin.Context, status int, body []byte) (int, []byte, error) {
+	if !p.rewrites(status) {
+		return status, body, nil
+	}
+	doc, err := decodeJSONNumber(body)
+	if err != nil {
+		return status, body, nil
+	}
+	for _, op := range p.patch {
+		if doc, err = applyPatchOp(doc, op); err != nil {
+			if errors.Is(err, errPatchTest) {
+				return status, body, nil
+			}
+			return status, body, err
+		}
+	}
+	if p.template == nil {
+		out, err := json.Marshal(doc)
+		return status, out, err
+	}
+
+	var buf bytes.Buffer
+	data := responseTemplateData{Body: doc, Status: status, Method: c.Request.Method, Path: c.Request.URL.Path, Query: c.Request.URL.Query()}
+	if err := p.template.Execute(&buf, data); err != nil {
+		return status, body, fmt.Errorf("template: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return status, body, fmt.Errorf("template não gerou JSON válido")
+	}
+	return status, buf.Bytes(), nil
+}
+
+// JSON Pointer (RFC 6901)
+
+func splitPointer(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens
+}
+
+func pointerGet(node interface{}, tokens []string) (interface{}, bool) {
+	for _, token := range tokens {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, false
+			}
+			node = value
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(container) {
+				return nil, false
+			}
+			node = container[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// expandWildcards troca cada * pelas chaves existentes, retornando todos os
+// caminhos concretos e, para cada um, os valores usados nos curingas
+func expandWildcards(node interface{}, tokens []string) ([][]string, [][]string) {
+	index := slices.Index(tokens, "*")
+	if index < 0 {
+		return [][]string{tokens}, [][]string{nil}
+	}
+	parent, ok := pointerGet(node, tokens[:index])
+	if !ok {
+		return nil, nil
+	}
+	var keys []string
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		for key := range container {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+	case []interface{}:
+		for i := range container {
+			keys = append(keys, strconv.Itoa(i))
+		}
+	}
+	var paths, bindings [][]string
+	for _, key := range keys {
+		concrete := append(append(append([]string{}, tokens[:index]...), key), tokens[index+1:]...)
+		subPaths, subBindings := expandWildcards(node, concrete)
+		for i := range subPaths {
+			paths = append(paths, subPaths[i])
+			bindings = append(bindings, append([]string{key}, subBindings[i]...))
+		}
+	}
+	return paths, bindings
+}
+
+// bindWildcards troca os * de tokens pelos valores de binding, em ordem
+func bindWildcards(tokens, binding []string) []string {
+	bound := append([]string{}, tokens...)
+	for i := range bound {
+		if bound[i] == "*" && len(binding) > 0 {
+			bound[i], binding = binding[0], binding[1:]
+		}
+	}
+	return bound
+}
+
+// pointerUpdate aplica fn ao contêiner pai do último token e devolve o
+// documento, já que remover ou inserir em arrays cria uma nova fatia
+func pointerUpdate(node interface{}, tokens []string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("path vazio")
+	}
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+	child, ok := pointerGet(node, tokens[:1])
+	if !ok {
+		return nil, fmt.Errorf("path inexistente: /%s", strings.Join(tokens, "/"))
+	}
+	updated, err := pointerUpdate(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch container := node.(type) {
+	case map[string]interface{}:
+		container[tokens[0]] = updated
+	case []interface{}:
+		i, _ := strconv.Atoi(tokens[0])
+		container[i] = updated
+	}
+	return node, nil
+}
+
+func patchAdd(doc interface{}, tokens []string, value interface{}, replace bool) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if _, exists := container[key]; replace && !exists {
+				return nil, fmt.Errorf("chave inexistente: %s", key)
+			}
+			container[key] = value
+			return container, nil
+		case []interface{}:
+			if key == "-" && !replace {
+				return append(container, value), nil
+			}
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i > len(container) || replace && i == len(container) {
+				return nil, fmt.Errorf("índice inválido: %s", key)
+			}
+			if replace {
+				container[i] = value
+				return container, nil
+			}
+			return slices.Insert(container, i, value), nil
+		}
+		return nil, fmt.Errorf("path não aponta para objeto ou array")
+	})
+}
+
+func patchRemove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			delete(container, key)
+			return container, nil
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(container) {
+				return nil, fmt.Errorf("índice inválido: %s", key)
+			}
+			return slices.Delete(container, i, i+1), nil
+		}
+		return nil, fmt.Errorf("path não aponta para objeto ou array")
+	})
+}
+
+// applyPatchOp aplica a operação a cada caminho concreto. Caminhos que não
+// existem no corpo são ignorados, para que respostas com formato diferente
+// (listas vazias, campos opcionais) passem sem erro.
+func applyPatchOp(doc interface{}, op jsonPatchOp) (interface{}, error) {
+	pathTokens, fromTokens := splitPointer(op.Path), splitPointer(op.From)
+	source := pathTokens
+	if op.Op == "move" || op.Op == "copy" {
+		source = fromTokens
+	}
+	// Para add, os curingas percorrem o pai do path
+	expandOn := source
+	if op.Op == "add" && len(source) > 0 {
+		expandOn = source[:len(source)-1]
+	}
+	_, bindings := expandWildcards(doc, expandOn)
+	// Remoções em arrays de trás para frente, para os índices continuarem válidos
+	if op.Op == "remove" || op.Op == "move" {
+		slices.Reverse(bindings)
+	}
+
+	var err error
+	for _, binding := range bindings {
+		target := bindWildcards(pathTokens, binding)
+		switch op.Op {
+		case "add", "replace":
+			check := target
+			if op.Op == "add" && len(target) > 0 {
+				check = target[:len(target)-1]
+			}
+			if _, ok := pointerGet(doc, check); !ok {
+				continue
+			}
+			doc, err = patchAdd(doc, target, deepCopyJSON(op.Value), op.Op == "replace")
+		case "remove":
+			if _, ok := pointerGet(doc, target); !ok {
+				continue
+			}
+			doc, err = patchRemove(doc, target)
+		case "move", "copy":
+			from := bindWildcards(fromTokens, binding)
+			value, ok := pointerGet(doc, from)
+			if _, parentOK := pointerGet(doc, target[:max(len(target)-1, 0)]); !ok || !parentOK {
+				continue
+			}
+			if op.Op == "move" {
+				if doc, err = patchRemove(doc, from); err != nil {
+					return nil, err
+				}
+			} else {
+				value = deepCopyJSON(value)
+			}
+			doc, err = patchAdd(doc, target, value, false)
+		case "test":
+			value, ok := pointerGet(doc, target)
+			if !ok || !reflect.DeepEqual(value, op.Value) {
+				return doc, errPatchTest
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("patch %s %s: %w", op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func deepCopyJSON(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			copied[k] = deepCopyJSON(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = deepCopyJSON(item)
+		}
+		return copied
+	}
+	return v
+}
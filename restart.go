@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Variáveis de ambiente com que um processo passa os sockets ao seguinte
+const (
+	// Sockets herdados, na ordem dos descritores a partir do 3
+	// (rede/endereço separados por vírgula)
+	envInheritedSockets = "PROXY_INHERITED_SOCKETS"
+	// Descritor do pipe em que o novo processo avisa que está atendendo
+	envReadyFD = "PROXY_READY_FD"
+
+	defaultRestartDrainTimeout = 30 * time.Second
+	defaultRestartReadyTimeout = time.Minute
+)
+
+// socketRegistry guarda os sockets abertos pelo processo (HTTP, gRPC, FIX),
+// para repassá-los ao novo binário num restart, e os herdados do processo
+// anterior, ainda não reabertos
+type socketRegistry struct {
+	mu        sync.Mutex
+	inherited map[string]*os.File
+	open      []registeredSocket
+}
+
+type registeredSocket struct {
+	key      string
+	listener net.Listener
+}
+
+var sockets = loadInheritedSockets()
+
+// loadInheritedSockets lê os sockets passados pelo processo anterior
+func loadInheritedSockets() *socketRegistry {
+	registry := &socketRegistry{inherited: map[string]*os.File{}}
+	list := os.Getenv(envInheritedSockets)
+	if list == "" {
+		return registry
+	}
+	for i, key := range strings.Split(list, ",") {
+		registry.inherited[key] = os.NewFile(uintptr(3+i), key)
+	}
+	return registry
+}
+
+func socketKey(network, address string) string {
+	return network + "/" + address
+}
+
+// inheritedSocket retorna o socket herdado do processo anterior para o
+// endereço, se houver
+func inheritedSocket(network, address string) (net.Listener, bool) {
+	key := socketKey(network, address)
+	sockets.mu.Lock()
+	defer sockets.mu.Unlock()
+	file, ok := sockets.inherited[key]
+	if !ok {
+		return nil, false
+	}
+	delete(sockets.inherited, key)
+	listener, err := net.FileListener(file)
+	file.Close()
+	if err != nil {
+		return nil, false
+	}
+	sockets.open = append(sockets.open, registeredSocket{key, listener})
+	return listener, true
+}
+
+// listenSocket abre um socket de escuta, reaproveitando o herdado do
+// processo anterior quando existe
+func listenSocket(network, address string) (net.Listener, error) {
+	if listener, ok := inheritedSocket(network, address); ok {
+		return listener, nil
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	sockets.mu.Lock()
+	sockets.open = append(sockets.open, registeredSocket{socketKey(network, address), listener})
+	sockets.mu.Unlock()
+	return listener, nil
+}
+
+// notifyReady avisa o processo anterior que este já atende, para que ele
+// comece a drenar. Sockets herdados que a configuração nova não usa são
+// fechados.
+func notifyReady() {
+	sockets.mu.Lock()
+	for key, file := range sockets.inherited {
+		file.Close()
+		delete(sockets.inherited, key)
+	}
+	sockets.mu.Unlock()
+
+	fd, err := strconv.Atoi(os.Getenv(envReadyFD))
+	if err != nil {
+		return
+	}
+	ready := os.NewFile(uintptr(fd), "ready")
+	ready.Write([]byte{1})
+	ready.Close()
+	os.Unsetenv(envReadyFD)
+	os.Unsetenv(envInheritedSockets)
+}
+
+// startUpgrade executa o binário atual (que pode ter sido substituído em
+// disco) com os mesmos argumentos, passando os sockets abertos, e espera ele
+// avisar que está atendendo
+func startUpgrade() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	sockets.mu.Lock()
+	var files []*os.File
+	var keys []string
+	var listeners []net.Listener
+	for _, socket := range sockets.open {
+		filer, ok := socket.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		file, err := filer.File()
+		if err != nil {
+			continue
+		}
+		// O socket Unix continua no disco para o novo processo
+		if unix, ok := socket.listener.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(false)
+		}
+		files = append(files, file)
+		keys = append(keys, socket.key)
+		listeners = append(listeners, socket.listener)
+	}
+	sockets.mu.Unlock()
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+		// File() e o exec deixam o socket em modo bloqueante, e o modo vale
+		// para todas as cópias do descritor: sem isso o Accept deste processo
+		// não retorna quando o listener é fechado
+		for _, listener := range listeners {
+			setNonblock(listener)
+		}
+	}()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, envInheritedSockets+"=") && !strings.HasPrefix(kv, envReadyFD+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env,
+		envInheritedSockets+"="+strings.Join(keys, ","),
+		envReadyFD+"="+strconv.Itoa(3+len(files)),
+	)
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = env
+	cmd.ExtraFiles = append(files, readyW)
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	// EOF no pipe: o novo processo terminou antes de ficar pronto
+	readyR.SetReadDeadline(time.Now().Add(getEnvDuration("RESTART_READY_TIMEOUT", defaultRestartReadyTimeout)))
+	if _, err := readyR.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		<-exited
+		return fmt.Errorf("novo processo não ficou pronto: %w", err)
+	}
+	return nil
+}
+
+// serverGroup são os servidores HTTP de serveListeners, com o necessário
+// para drená-los sem perder requisições
+type serverGroup struct {
+	servers   []*http.Server
+	listeners []net.Listener
+	// Termina quando todos os Serve retornam
+	serving  sync.WaitGroup
+	draining atomic.Bool
+
+	mu sync.Mutex
+	// Conexões aceitas que ainda não enviaram a primeira requisição
+	fresh map[net.Conn]bool
+}
+
+func newServerGroup() *serverGroup {
+	return &serverGroup{fresh: map[net.Conn]bool{}}
+}
+
+func (g *serverGroup) add(server *http.Server, listener net.Listener) {
+	server.ConnState = g.trackConn
+	g.servers = append(g.servers, server)
+	g.listeners = append(g.listeners, listener)
+	g.serving.Add(1)
+}
+
+func (g *serverGroup) trackConn(conn net.Conn, state http.ConnState) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if state == http.StateNew {
+		g.fresh[conn] = true
+	} else {
+		delete(g.fresh, conn)
+	}
+}
+
+func (g *serverGroup) freshConns() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.fresh)
+}
+
+// drain para de aceitar conexões e espera as requisições em andamento até
+// timeout; as que restarem (streams) são encerradas. O Shutdown do net/http
+// descarta sem resposta a requisição que chega durante ele, então antes os
+// listeners são fechados, o keep-alive é desligado e as conexões recém
+// aceitas são atendidas normalmente.
+func (g *serverGroup) drain(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	g.draining.Store(true)
+	for _, server := range g.servers {
+		server.SetKeepAlivesEnabled(false)
+	}
+	for _, listener := range g.listeners {
+		listener.Close()
+	}
+	g.serving.Wait()
+	for g.freshConns() > 0 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	for _, server := range g.servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				server.Close()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// handleSignals atende os sinais de ciclo de vida: SIGUSR2 inicia o restart
+// sem queda (o novo processo herda os sockets e este drena as conexões
+// abertas) e SIGTERM/SIGINT encerram drenando. Retorna depois de parar os
+// servidores.
+func handleSignals(group *serverGroup) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	if restartSignal != nil {
+		signal.Notify(signals, restartSignal)
+	}
+	defer signal.Stop(signals)
+	for sig := range signals {
+		if sig == restartSignal {
+			// log.Printf("🔄 Iniciando novo processo (pid %d)", os.Getpid())
+			if err := startUpgrade(); err != nil {
+				// log.Printf("[ERROR] Restart cancelado, seguindo no processo atual: %v", err)
+				continue
+			}
+		}
+		// log.Printf("⏳ Drenando conexões (sinal %v)", sig)
+		group.drain(getEnvDuration("RESTART_DRAIN_TIMEOUT", defaultRestartDrainTimeout))
+		return http.ErrServerClosed
+	}
+	return nil
+}
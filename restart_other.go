@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// Fora do Unix não há restart sem queda, só o encerramento com drenagem
+var restartSignal os.Signal
+
+func setNonblock(listener net.Listener) {}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// restartSignal inicia o restart sem queda (ver handleSignals)
+var restartSignal os.Signal = syscall.SIGUSR2
+
+// setNonblock devolve o socket ao modo não bloqueante usado pelo runtime
+func setNonblock(listener net.Listener) {
+	conn, ok := listener.(syscall.Conn)
+	if !ok {
+		return
+	}
+	if raw, err := conn.SyscallConn(); err == nil {
+		raw.Control(func(fd uintptr) { syscall.SetNonblock(int(fd), true) })
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxRPCBatch = 50
+
+// Códigos de erro JSON-RPC 2.0 (os de -32000 a -32099 são do servidor)
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	rpcUpstreamError  = -32000
+	rpcUnauthorized   = -32001
+)
+
+// rpcMethod mapeia um método JSON-RPC para uma chamada da Binance. Métodos
+// assinados exigem token de tenant e path é relativo à raiz do host; os
+// públicos são GETs relativos a /api/v3.
+type rpcMethod struct {
+	httpMethod string
+	path       string
+	signed     bool
+}
+
+var rpcMethods = map[string]rpcMethod{
+	"ping":              {http.MethodGet, "/ping", false},
+	"time":              {http.MethodGet, "/time", false},
+	"exchangeInfo":      {http.MethodGet, "/exchangeInfo", false},
+	"depth":             {http.MethodGet, "/depth", false},
+	"trades":            {http.MethodGet, "/trades", false},
+	"aggTrades":         {http.MethodGet, "/aggTrades", false},
+	"klines":            {http.MethodGet, "/klines", false},
+	"uiKlines":          {http.MethodGet, "/uiKlines", false},
+	"avgPrice":          {http.MethodGet, "/avgPrice", false},
+	"ticker.24hr":       {http.MethodGet, "/ticker/24hr", false},
+	"ticker.price":      {http.MethodGet, "/ticker/price", false},
+	"ticker.bookTicker": {http.MethodGet, "/ticker/bookTicker", false},
+	"account":           {http.MethodGet, "/api/v3/account", true},
+	"myTrades":          {http.MethodGet, "/api/v3/myTrades", true},
+	"openOrders":        {http.MethodGet, "/api/v3/openOrders", true},
+	"allOrders":         {http.MethodGet, "/api/v3/allOrders", true},
+	"order.status":      {http.MethodGet, "/api/v3/order", true},
+	"order.place":       {http.MethodPost, "/api/v3/order", true},
+	"order.test":        {http.MethodPost, "/api/v3/order/test", true},
+	"order.cancel":      {http.MethodDelete, "/api/v3/order", true},
+	"openOrders.cancel": {http.MethodDelete, "/api/v3/openOrders", true},
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+func newRPCError(id json.RawMessage, code int, message string, data interface{}) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: code, Message: redactSecrets(message), Data: data}, ID: id}
+}
+
+// rpcParams converte params nomeados em query string. Arrays viram JSON
+// (ex: symbols=["BTCUSDT","ETHUSDT"]), como a Binance espera.
+func rpcParams(raw json.RawMessage) (url.Values, bool) {
+	values := url.Values{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return values, true
+	}
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, false
+	}
+	for key, value := range params {
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			values.Set(key, s)
+			continue
+		}
+		var v interface{}
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err != nil {
+			return nil, false
+		}
+		switch v := v.(type) {
+		case json.Number:
+			values.Set(key, v.String())
+		case bool:
+			values.Set(key, strconv.FormatBool(v))
+		case nil:
+			// null equivale a omitir o parâmetro
+		case []interface{}:
+			values.Set(key, string(value))
+		default:
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// rpcCall executa uma requisição JSON-RPC. Retorna nil para notificações (sem id).
+func (p *ProxyServer) rpcCall(ctx context.Context, tenant *Tenant, req rpcRequest) *rpcResponse {
+	resp := p.rpcExecute(ctx, tenant, req)
+	if req.ID == nil {
+		return nil
+	}
+	return resp
+}
+
+func (p *ProxyServer) rpcExecute(ctx context.Context, tenant *Tenant, req rpcRequest) *rpcResponse {
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return newRPCError(req.ID, rpcInvalidRequest, "Invalid Request", nil)
+	}
+	method, ok := rpcMethods[req.Method]
+	if !ok {
+		return newRPCError(req.ID, rpcMethodNotFound, "Método não encontrado: "+req.Method, nil)
+	}
+	params, ok := rpcParams(req.Params)
+	if !ok {
+		return newRPCError(req.ID, rpcInvalidParams, "params deve ser um objeto com valores escalares ou arrays", nil)
+	}
+
+	var body []byte
+	var err error
+	if method.signed {
+		if tenant == nil {
+			return newRPCError(req.ID, rpcUnauthorized, "Token de tenant inválido ou ausente", nil)
+		}
+		body, err = p.signedRequest(ctx, tenant, method.httpMethod, method.path, params)
+	} else {
+		body, err = p.fetchUpstream(ctx, method.path, params)
+	}
+	if err != nil {
+		if upstreamErr, ok := err.(*UpstreamError); ok {
+			data := map[string]interface{}{"status": upstreamErr.StatusCode}
+			if json.Valid(upstreamErr.Body) {
+				data["body"] = json.RawMessage(upstreamErr.Body)
+			} else {
+				data["body"] = string(upstreamErr.Body)
+			}
+			return newRPCError(req.ID, rpcUpstreamError, "Binance retornou status "+strconv.Itoa(upstreamErr.StatusCode), data)
+		}
+		return newRPCError(req.ID, rpcInternalError, "Erro ao conectar com Binance: "+err.Error(), nil)
+	}
+	if !json.Valid(body) {
+		return newRPCError(req.ID, rpcInternalError, "Resposta inválida da Binance", nil)
+	}
+	return &rpcResponse{JSONRPC: "2.0", Result: body, ID: req.ID}
+}
+
+// JSONRPC atende chamadas JSON-RPC 2.0 (individuais ou em lote)
+// @Summary JSON-RPC 2.0
+// @Description Mapeia métodos JSON-RPC (ticker.price, depth, klines, account, order.place...) para chamadas à Binance. Aceita lotes de até 50 chamadas: lotes só de métodos públicos são buscados em paralelo pelo planejador, os demais em ordem; métodos assinados requerem token de tenant.
+// @Tags Proxy
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /rpc [post]
+func (p *ProxyServer) JSONRPC(c *gin.Context) {
+	raw, err := readBody(c)
+	if err != nil {
+		c.JSON(http.StatusOK, newRPCError(nil, rpcParseError, "Parse error", nil))
+		return
+	}
+	raw = bytes.TrimSpace(raw)
+	tenant := p.requestTenant(c.Request)
+	ctx := c.Request.Context()
+
+	// Chamada individual
+	if len(raw) == 0 || raw[0] != '[' {
+		var req rpcRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			c.JSON(http.StatusOK, newRPCError(nil, rpcParseError, "Parse error", nil))
+			return
+		}
+		resp := p.rpcCall(ctx, tenant, req)
+		if resp == nil {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	// Lote: chamadas assinadas saem em ordem, uma por vez; um lote só de
+	// chamadas públicas sai em paralelo pelo planejador de buscas
+	var batch []json.RawMessage
+	if err := json.Unmarshal(raw, &batch); err != nil {
+		c.JSON(http.StatusOK, newRPCError(nil, rpcParseError, "Parse error", nil))
+		return
+	}
+	if len(batch) == 0 {
+		c.JSON(http.StatusOK, newRPCError(nil, rpcInvalidRequest, "Invalid Request", nil))
+		return
+	}
+	if len(batch) > maxRPCBatch {
+		c.JSON(http.StatusOK, newRPCError(nil, rpcInvalidRequest, "O lote deve ter no máximo "+strconv.Itoa(maxRPCBatch)+" chamadas", nil))
+		return
+	}
+
+	results := make([]*rpcResponse, len(batch))
+	requests := make([]*rpcRequest, len(batch))
+	public := true
+	weight := 1
+	for i, item := range batch {
+		var req rpcRequest
+		if err := json.Unmarshal(item, &req); err != nil {
+			results[i] = newRPCError(nil, rpcInvalidRequest, "Invalid Request", nil)
+			continue
+		}
+		requests[i] = &req
+		if method, ok := rpcMethods[req.Method]; ok {
+			public = public && !method.signed
+			params, _ := rpcParams(req.Params)
+			weight = max(weight, requestWeight(method.httpMethod, method.path, params))
+		}
+	}
+	call := func(ctx context.Context, i int) error {
+		if requests[i] != nil {
+			results[i] = p.rpcCall(ctx, tenant, *requests[i])
+		}
+		return nil
+	}
+	if public {
+		p.planner.Run(ctx, "", len(batch), weight, call)
+	} else {
+		for i := range batch {
+			call(ctx, i)
+		}
+	}
+
+	responses := []*rpcResponse{}
+	for _, resp := range results {
+		if resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, responses)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Client fala o protocolo do S3 (assinatura SigV4) e atende também
+// MinIO, R2 e o GCS pela API XML interoperável com chaves HMAC
+type S3Client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	// pathStyle usa endpoint/bucket/key em vez de bucket.endpoint/key (MinIO)
+	pathStyle bool
+	client    *http.Client
+}
+
+// S3Object é um item da listagem do bucket
+type S3Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	Size         int64     `xml:"Size"`
+}
+
+type s3ListResult struct {
+	Contents              []S3Object `xml:"Contents"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+}
+
+func NewS3Client(endpoint, region, bucket, accessKey, secretKey string, pathStyle bool) (*S3Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("endpoint inválido: %q", endpoint)
+	}
+	return &S3Client{
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		pathStyle: pathStyle,
+		client:    &http.Client{Timeout: 2 * time.Minute},
+	}, nil
+}
+
+// s3Escape codifica como o SigV4 exige (RFC 3986, "/" preservada em paths)
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// authorization calcula o header Authorization do SigV4, assinando host,
+// x-amz-content-sha256 e x-amz-date
+func (s *S3Client) authorization(method, host, escapedPath, canonicalQuery, payloadHex string, now time.Time) string {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + host + "\nx-amz-content-sha256:" + payloadHex + "\nx-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{method, escapedPath, canonicalQuery, canonicalHeaders, signedHeaders, payloadHex}, "\n")
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature)
+}
+
+// do monta, assina e envia a requisição para a chave (vazia = o bucket)
+func (s *S3Client) do(ctx context.Context, method, key string, query url.Values, body []byte, contentType string) ([]byte, error) {
+	host := s.endpoint.Host
+	path := s.endpoint.Path + "/"
+	if s.pathStyle {
+		path += s.bucket + "/"
+	} else {
+		host = s.bucket + "." + host
+	}
+	path += key
+	escapedPath := s3Escape(path, true)
+
+	// Query canônica: chaves e valores codificados, em ordem
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, s3Escape(k, false)+"="+s3Escape(query.Get(k), false))
+	}
+	canonicalQuery := strings.Join(pairs, "&")
+
+	target := s.endpoint.Scheme + "://" + host + escapedPath
+	if canonicalQuery != "" {
+		target += "?" + canonicalQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	payloadHash := sha256.Sum256(body)
+	payloadHex := hex.EncodeToString(payloadHash[:])
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHex)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", s.authorization(method, host, escapedPath, canonicalQuery, payloadHex, now))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: status %d: %s", method, key, resp.StatusCode, string(data[:min(300, len(data))]))
+	}
+	return data, nil
+}
+
+// Put grava o objeto na chave
+func (s *S3Client) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	_, err := s.do(ctx, http.MethodPut, key, nil, body, contentType)
+	return err
+}
+
+// Delete remove o objeto
+func (s *S3Client) Delete(ctx context.Context, key string) error {
+	_, err := s.do(ctx, http.MethodDelete, key, nil, nil, "")
+	return err
+}
+
+// List retorna todos os objetos com o prefixo (ListObjectsV2, paginado)
+func (s *S3Client) List(ctx context.Context, prefix string) ([]S3Object, error) {
+	var objects []S3Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		data, err := s.do(ctx, http.MethodGet, "", query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("listagem inválida: %w", err)
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
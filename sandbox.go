@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// TenantPolicy restringe os símbolos e endpoints que um tenant pode usar nas
+// chamadas assinadas com as credenciais dele, para que, num deploy com
+// várias equipes, o token de uma não negocie os mercados restritos de
+// outra. Listas vazias não restringem e as listas deny têm precedência.
+// Padrões aceitam * (qualquer sequência); endpoints podem ter o método HTTP
+// na frente ("POST /api/v3/order") e também valem para os métodos da
+// WebSocket API ("order.*").
+type TenantPolicy struct {
+	Symbols       []string `yaml:"symbols"`
+	DenySymbols   []string `yaml:"deny_symbols"`
+	Endpoints     []string `yaml:"endpoints"`
+	DenyEndpoints []string `yaml:"deny_endpoints"`
+
+	symbols, denySymbols     []*regexp.Regexp
+	endpoints, denyEndpoints []endpointPattern
+}
+
+// endpointPattern é um padrão de endpoint com o método opcional
+type endpointPattern struct {
+	method string
+	path   *regexp.Regexp
+}
+
+// globPattern converte um padrão com * numa expressão ancorada
+func globPattern(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(strings.TrimSpace(pattern))
+	return regexp.MustCompile("^" + strings.ReplaceAll(quoted, `\*`, ".*") + "$")
+}
+
+// compile prepara os padrões da política
+func (p *TenantPolicy) compile() error {
+	for _, list := range []struct {
+		patterns []string
+		target   *[]*regexp.Regexp
+	}{{p.Symbols, &p.symbols}, {p.DenySymbols, &p.denySymbols}} {
+		for _, pattern := range list.patterns {
+			*list.target = append(*list.target, globPattern(strings.ToUpper(pattern)))
+		}
+	}
+	for _, list := range []struct {
+		patterns []string
+		target   *[]endpointPattern
+	}{{p.Endpoints, &p.endpoints}, {p.DenyEndpoints, &p.denyEndpoints}} {
+		for _, pattern := range list.patterns {
+			var entry endpointPattern
+			if method, rest, ok := strings.Cut(strings.TrimSpace(pattern), " "); ok {
+				entry.method, pattern = strings.ToUpper(method), rest
+			}
+			if pattern == "" {
+				return fmt.Errorf("endpoint vazio na política")
+			}
+			entry.path = globPattern(pattern)
+			*list.target = append(*list.target, entry)
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchEndpoint(patterns []endpointPattern, method, endpoint string) bool {
+	for _, pattern := range patterns {
+		if (pattern.method == "" || pattern.method == method) && pattern.path.MatchString(endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow confere uma chamada do tenant: method e endpoint (path da API ou
+// método da WebSocket API, com method vazio) e os símbolos referenciados.
+// O path é normalizado antes (segmentos . e .., barras repetidas ou no
+// fim), para que /api/v3/../../sapi/... caia nas regras de /sapi/*.
+func (p *TenantPolicy) Allow(method, endpoint string, symbols []string) error {
+	if p == nil {
+		return nil
+	}
+	if strings.HasPrefix(endpoint, "/") {
+		endpoint = path.Clean(endpoint)
+	}
+	if matchEndpoint(p.denyEndpoints, method, endpoint) || len(p.endpoints) > 0 && !matchEndpoint(p.endpoints, method, endpoint) {
+		return fmt.Errorf("endpoint %s não permitido para o tenant", strings.TrimSpace(method+" "+endpoint))
+	}
+	for _, symbol := range symbols {
+		symbol = strings.ToUpper(symbol)
+		if matchAny(p.denySymbols, symbol) || len(p.symbols) > 0 && !matchAny(p.symbols, symbol) {
+			return fmt.Errorf("símbolo %s não permitido para o tenant", symbol)
+		}
+	}
+	return nil
+}
+
+// policyError é a recusa da política no formato de erro da Binance, para
+// os chamadores de signedRequest a tratarem como uma resposta de erro
+func policyError(err error) error {
+	body, _ := json.Marshal(map[string]interface{}{"code": -1002, "msg": err.Error()})
+	return &UpstreamError{StatusCode: http.StatusForbidden, Body: body}
+}
+
+// paramSymbols extrai os símbolos de symbol e symbols (lista JSON, como em
+// /ticker/price?symbols=["BTCUSDT","BNBUSDT"])
+func paramSymbols(symbol, symbols string) []string {
+	var list []string
+	if symbol != "" {
+		list = append(list, symbol)
+	}
+	if symbols != "" {
+		var parsed []string
+		if err := json.Unmarshal([]byte(symbols), &parsed); err != nil {
+			// Lista malformada: conferida como um símbolo só, que a política recusa
+			parsed = []string{symbols}
+		}
+		list = append(list, parsed...)
+	}
+	return list
+}
+
+// querySymbols extrai os símbolos dos parâmetros de uma chamada REST
+func querySymbols(params url.Values) []string {
+	return paramSymbols(params.Get("symbol"), params.Get("symbols"))
+}
+
+// wsAPISymbols extrai os símbolos dos parâmetros de uma requisição da
+// WebSocket API (symbol como string, symbols como lista)
+func wsAPISymbols(params map[string]json.RawMessage) []string {
+	var symbol string
+	var symbols []string
+	json.Unmarshal(params["symbol"], &symbol)
+	json.Unmarshal(params["symbols"], &symbols)
+	if symbol != "" {
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
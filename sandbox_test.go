@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTenantPolicyAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   TenantPolicy
+		method   string
+		endpoint string
+		symbols  []string
+		allowed  bool
+	}{
+		{"política vazia", TenantPolicy{}, "POST", "/api/v3/order", []string{"BTCUSDT"}, true},
+
+		// Endpoints: deny vence o allow
+		{"allow de endpoint", TenantPolicy{Endpoints: []string{"/api/v3/order"}}, "POST", "/api/v3/order", nil, true},
+		{"fora do allow de endpoint", TenantPolicy{Endpoints: []string{"/api/v3/order"}}, "GET", "/api/v3/account", nil, false},
+		{"deny vence allow de endpoint", TenantPolicy{Endpoints: []string{"/api/v3/*"}, DenyEndpoints: []string{"/api/v3/order"}}, "POST", "/api/v3/order", nil, false},
+		{"allow com glob", TenantPolicy{Endpoints: []string{"/api/v3/*"}}, "GET", "/api/v3/openOrders", nil, true},
+		{"glob ancorado", TenantPolicy{Endpoints: []string{"/api/v3/*"}}, "GET", "/sapi/v1/api/v3/x", nil, false},
+
+		// Padrões com método na frente
+		{"deny com método bloqueia o método", TenantPolicy{DenyEndpoints: []string{"DELETE /api/v3/openOrders"}}, "DELETE", "/api/v3/openOrders", nil, false},
+		{"deny com método libera outro método", TenantPolicy{DenyEndpoints: []string{"DELETE /api/v3/openOrders"}}, "GET", "/api/v3/openOrders", nil, true},
+		{"método em minúsculas", TenantPolicy{DenyEndpoints: []string{"delete /api/v3/openOrders"}}, "DELETE", "/api/v3/openOrders", nil, false},
+		{"allow com método", TenantPolicy{Endpoints: []string{"GET /api/v3/*"}}, "POST", "/api/v3/order", nil, false},
+		{"método da WebSocket API", TenantPolicy{DenyEndpoints: []string{"order.*"}}, "", "order.place", nil, false},
+		{"padrão com método não vale na WebSocket API", TenantPolicy{DenyEndpoints: []string{"POST order.*"}}, "", "order.place", nil, true},
+
+		// Símbolos: globs, maiúsculas e deny vence o allow
+		{"allow de símbolo", TenantPolicy{Symbols: []string{"BTC*"}}, "POST", "/api/v3/order", []string{"BTCUSDT"}, true},
+		{"fora do allow de símbolo", TenantPolicy{Symbols: []string{"BTC*"}}, "POST", "/api/v3/order", []string{"ETHUSDT"}, false},
+		{"símbolo em minúsculas", TenantPolicy{Symbols: []string{"btc*"}}, "POST", "/api/v3/order", []string{"btcusdt"}, true},
+		{"deny vence allow de símbolo", TenantPolicy{Symbols: []string{"*USDT"}, DenySymbols: []string{"DOGE*"}}, "POST", "/api/v3/order", []string{"DOGEUSDT"}, false},
+		{"glob de sufixo", TenantPolicy{Symbols: []string{"*USDT"}}, "POST", "/api/v3/order", []string{"BTCBRL"}, false},
+		{"qualquer símbolo negado recusa a lista", TenantPolicy{DenySymbols: []string{"ETH*"}}, "GET", "/api/v3/ticker/price", []string{"BTCUSDT", "ETHUSDT"}, false},
+		{"sem símbolos na chamada", TenantPolicy{Symbols: []string{"BTC*"}}, "GET", "/api/v3/account", nil, true},
+
+		// Paths normalizados antes da comparação
+		{"deny com segmentos ..", TenantPolicy{DenyEndpoints: []string{"/sapi/*"}}, "POST", "/api/v3/../../sapi/v1/asset/transfer", nil, false},
+		{"deny com segmento .", TenantPolicy{DenyEndpoints: []string{"/sapi/*"}}, "POST", "/./sapi/v1/asset/transfer", nil, false},
+		{"deny com barras repetidas", TenantPolicy{DenyEndpoints: []string{"/sapi/*"}}, "POST", "//sapi//v1/asset/transfer", nil, false},
+		{"deny com barra final", TenantPolicy{DenyEndpoints: []string{"DELETE /api/v3/openOrders"}}, "DELETE", "/api/v3/openOrders/", nil, false},
+		{"allow não escapa com ..", TenantPolicy{Endpoints: []string{"/api/v3/*"}}, "POST", "/api/v3/../../sapi/v1/asset/transfer", nil, false},
+
+		// Endpoint e símbolo combinados
+		{"endpoint negado antes do símbolo", TenantPolicy{Symbols: []string{"BTC*"}, DenyEndpoints: []string{"POST /api/v3/order"}}, "POST", "/api/v3/order", []string{"BTCUSDT"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			if err := policy.compile(); err != nil {
+				t.Fatal(err)
+			}
+			err := policy.Allow(tt.method, tt.endpoint, tt.symbols)
+			if (err == nil) != tt.allowed {
+				t.Fatalf("Allow(%q, %q, %v) = %v, permitido esperado %v", tt.method, tt.endpoint, tt.symbols, err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestTenantPolicyNil(t *testing.T) {
+	var policy *TenantPolicy
+	if err := policy.Allow("POST", "/api/v3/order", []string{"BTCUSDT"}); err != nil {
+		t.Fatalf("política nil deveria permitir tudo: %v", err)
+	}
+}
+
+func TestTenantPolicyCompileRejectsEmptyEndpoint(t *testing.T) {
+	policy := TenantPolicy{Endpoints: []string{""}}
+	if err := policy.compile(); err == nil {
+		t.Fatalf("endpoint vazio deveria ser recusado")
+	}
+}
+
+func TestQuerySymbols(t *testing.T) {
+	params := url.Values{"symbol": {"BTCUSDT"}, "symbols": {`["ETHUSDT","BNBUSDT"]`}}
+	got := querySymbols(params)
+	want := []string{"BTCUSDT", "ETHUSDT", "BNBUSDT"}
+	if len(got) != len(want) {
+		t.Fatalf("querySymbols = %v, esperado %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("querySymbols = %v, esperado %v", got, want)
+		}
+	}
+	// Lista malformada vira um símbolo só, que a política recusa
+	if got := paramSymbols("", "BTCUSDT,ETHUSDT"); len(got) != 1 || got[0] != "BTCUSDT,ETHUSDT" {
+		t.Fatalf("paramSymbols com lista malformada = %v", got)
+	}
+}
+
+// newPolicyRouter monta o roteador com um tenant restrito a BTCUSDT e sem
+// cancelamento em massa, com spot e futuros apontados para um upstream falso
+func newPolicyRouter(t *testing.T) (*gin.Engine, *atomic.Int64) {
+	t.Helper()
+	var hits atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(upstream.Close)
+	t.Setenv("EXCHANGES", "binance,futures")
+	t.Setenv("EXCHANGE_BINANCE_URL", upstream.URL)
+	t.Setenv("EXCHANGE_FUTURES_URL", upstream.URL)
+
+	file := filepath.Join(t.TempDir(), "tenants.yaml")
+	config := `tenants:
+  - name: desk
+    token: desk-token
+    api_key: KEY
+    secret_key: SECRET
+    policy:
+      symbols: ["BTCUSDT"]
+      deny_endpoints: ["DELETE /api/v3/openOrders"]
+`
+	if err := os.WriteFile(file, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := LoadTenants(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxyServer()
+	p.binanceURL = upstream.URL + "/api/v3"
+	p.client = newUpstreamClient(p, nil)
+	p.tenants = tenants
+	return setupRouter(p), &hits
+}
+
+func TestTenantPolicyOnPrefixedRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		form    string
+		allowed bool
+	}{
+		{"raiz com símbolo permitido", "POST", "/api/order?symbol=BTCUSDT&timestamp=1", "", true},
+		{"raiz com símbolo fora da política", "POST", "/api/order?symbol=ETHUSDT&timestamp=1", "", false},
+		{"spot com símbolo permitido", "POST", "/binance/api/v3/order?symbol=BTCUSDT", "", true},
+		{"spot com símbolo fora da política", "POST", "/binance/api/v3/order?symbol=ETHUSDT", "", false},
+		{"spot com símbolo no corpo form", "POST", "/binance/api/v3/order", "symbol=ETHUSDT&side=BUY", false},
+		{"spot com lista de símbolos", "GET", `/binance/api/v3/ticker/price?symbols=["BTCUSDT","ETHUSDT"]`, "", false},
+		{"spot com endpoint negado", "DELETE", "/binance/api/v3/openOrders?symbol=BTCUSDT", "", false},
+		{"futuros com símbolo permitido", "POST", "/futures/fapi/v1/order?symbol=BTCUSDT", "", true},
+		{"futuros com símbolo fora da política", "POST", "/futures/fapi/v1/order?symbol=ETHUSDT", "", false},
+		{"raiz com segmentos ..", "DELETE", "/api/x/../openOrders?symbol=BTCUSDT&timestamp=1", "", false},
+		{"raiz com .. codificado", "DELETE", "/api/x/%2e%2e/openOrders?symbol=BTCUSDT&timestamp=1", "", false},
+		{"spot com segmentos ..", "DELETE", "/binance/api/v3/x/../openOrders?symbol=BTCUSDT", "", false},
+		{"spot com barra final", "DELETE", "/binance/api/v3/openOrders/?symbol=BTCUSDT", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, hits := newPolicyRouter(t)
+			var req *http.Request
+			if tt.form != "" {
+				req = httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.form))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(tt.method, tt.target, nil)
+			}
+			req.Header.Set("X-Proxy-Token", "desk-token")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if tt.allowed {
+				if w.Code != http.StatusOK || hits.Load() != 1 {
+					t.Fatalf("status %d, %d chamadas ao upstream; esperado 200 e 1 (%s)", w.Code, hits.Load(), w.Body)
+				}
+				return
+			}
+			if w.Code != http.StatusForbidden || hits.Load() != 0 {
+				t.Fatalf("status %d, %d chamadas ao upstream; esperado 403 e 0 (%s)", w.Code, hits.Load(), w.Body)
+			}
+			if !strings.Contains(w.Body.String(), `"code":-1002`) {
+				t.Fatalf("resposta sem o erro da política: %s", w.Body)
+			}
+		})
+	}
+}
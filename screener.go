@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultScreenerLimit = 50
+	maxScreenerLimit     = 500
+	defaultScreenerSort  = "-volume"
+)
+
+// screenerRow é um símbolo do screener, com os números do ticker de 24h já
+// convertidos
+type screenerRow struct {
+	Symbol     string  `json:"symbol"`
+	BaseAsset  string  `json:"baseAsset"`
+	QuoteAsset string  `json:"quoteAsset"`
+	Price      float64 `json:"price"`
+	// Variação de 24h em %
+	Change24h float64 `json:"change24h"`
+	// Volume de 24h no ativo de cotação e no ativo base
+	Volume     float64 `json:"volume"`
+	BaseVolume float64 `json:"baseVolume"`
+	High       float64 `json:"high"`
+	Low        float64 `json:"low"`
+	// Amplitude de 24h ((high-low)/low) em %
+	Range float64 `json:"range"`
+	Bid   float64 `json:"bid"`
+	Ask   float64 `json:"ask"`
+	// Spread em % do preço médio; null sem bid e ask
+	Spread *float64 `json:"spread"`
+	Trades int64    `json:"trades"`
+}
+
+// screenerFields são os campos numéricos que aceitam filtro e ordenação
+var screenerFields = map[string]func(*screenerRow) (float64, bool){
+	"price":      func(r *screenerRow) (float64, bool) { return r.Price, true },
+	"change24h":  func(r *screenerRow) (float64, bool) { return r.Change24h, true },
+	"volume":     func(r *screenerRow) (float64, bool) { return r.Volume, true },
+	"baseVolume": func(r *screenerRow) (float64, bool) { return r.BaseVolume, true },
+	"range":      func(r *screenerRow) (float64, bool) { return r.Range, true },
+	"trades":     func(r *screenerRow) (float64, bool) { return float64(r.Trades), true },
+	"spread": func(r *screenerRow) (float64, bool) {
+		if r.Spread == nil {
+			return 0, false
+		}
+		return *r.Spread, true
+	},
+}
+
+// screenerFilter é uma condição sobre um campo: change24h=>5, spread=<0.1,
+// price=10..20 ou os atalhos minVolume=1000000 e maxSpread=0.1
+type screenerFilter struct {
+	field string
+	value func(*screenerRow) (float64, bool)
+	op    string
+	a, b  float64
+}
+
+func (f *screenerFilter) match(row *screenerRow) bool {
+	v, ok := f.value(row)
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case ">":
+		return v > f.a
+	case ">=":
+		return v >= f.a
+	case "<":
+		return v < f.a
+	case "<=":
+		return v <= f.a
+	case "..":
+		return v >= f.a && v <= f.b
+	}
+	return v == f.a
+}
+
+// parseScreenerCondition lê a condição de um campo: >5, >=5, <5, <=5, =5, 5
+// (igual) ou 5..10 (intervalo fechado)
+func parseScreenerCondition(field, raw string) (*screenerFilter, error) {
+	f := &screenerFilter{field: field, value: screenerFields[field]}
+	raw = strings.TrimSpace(raw)
+	if lo, hi, ok := strings.Cut(raw, ".."); ok {
+		a, errA := strconv.ParseFloat(lo, 64)
+		b, errB := strconv.ParseFloat(hi, 64)
+		if errA != nil || errB != nil || a > b {
+			return nil, fmt.Errorf("Intervalo inválido em '%s': %s", field, raw)
+		}
+		f.op, f.a, f.b = "..", a, b
+		return f, nil
+	}
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(raw, op) {
+			f.op, raw = op, raw[len(op):]
+			break
+		}
+	}
+	a, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || math.IsNaN(a) {
+		return nil, fmt.Errorf("Condição inválida em '%s': use >5, <=0.1, =3 ou 5..10", field)
+	}
+	f.a = a
+	return f, nil
+}
+
+// parseScreenerFilters lê as condições da query: cada campo aceita a
+// condição completa (change24h=>5) e os atalhos min/max (minVolume=1000000)
+func parseScreenerFilters(c *gin.Context) ([]*screenerFilter, error) {
+	fields := make([]string, 0, len(screenerFields))
+	for field := range screenerFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var filters []*screenerFilter
+	for _, field := range fields {
+		if raw, ok := c.GetQuery(field); ok {
+			f, err := parseScreenerCondition(field, raw)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, f)
+		}
+		suffix := strings.ToUpper(field[:1]) + field[1:]
+		for _, bound := range [][2]string{{"min", ">="}, {"max", "<="}} {
+			if raw, ok := c.GetQuery(bound[0] + suffix); ok {
+				f, err := parseScreenerCondition(field, bound[1]+raw)
+				if err != nil {
+					return nil, err
+				}
+				filters = append(filters, f)
+			}
+		}
+	}
+	return filters, nil
+}
+
+// newScreenerRow converte o ticker de 24h do símbolo
+func newScreenerRow(s *SymbolInfo, t *Ticker24h) screenerRow {
+	num := func(raw string) float64 { v, _ := strconv.ParseFloat(raw, 64); return v }
+	row := screenerRow{
+		Symbol:     s.Symbol,
+		BaseAsset:  s.BaseAsset,
+		QuoteAsset: s.QuoteAsset,
+		Price:      num(t.LastPrice),
+		Change24h:  num(t.PriceChangePercent),
+		Volume:     num(t.QuoteVolume),
+		BaseVolume: num(t.Volume),
+		High:       num(t.HighPrice),
+		Low:        num(t.LowPrice),
+		Bid:        num(t.BidPrice),
+		Ask:        num(t.AskPrice),
+		Trades:     t.Count,
+	}
+	if row.Low > 0 {
+		row.Range = math.Round((row.High-row.Low)/row.Low*100*1e4) / 1e4
+	}
+	if row.Bid > 0 && row.Ask >= row.Bid {
+		spread := math.Round((row.Ask-row.Bid)/((row.Ask+row.Bid)/2)*100*1e6) / 1e6
+		row.Spread = &spread
+	}
+	return row
+}
+
+// Screener filtra, ordena e pagina o ticker de 24h em cache
+// @Summary Screener de mercado
+// @Description Filtra o ticker de 24h em cache no servidor por ativo de cotação, volume, variação, spread, amplitude e outros campos, com ordenação e paginação, em vez de baixar o array completo de tickers
+// @Tags Market Data
+// @Produce json
+// @Param quote query string false "Ativos de cotação (ex: USDT,FDUSD)"
+// @Param status query string false "Status do símbolo (padrão: TRADING; all = todos)"
+// @Param change24h query string false "Condição sobre a variação de 24h em % (ex: >5, <=-3, 2..8)"
+// @Param minVolume query number false "Volume mínimo de 24h no ativo de cotação"
+// @Param sort query string false "Campo de ordenação, com - para decrescente (padrão: -volume)"
+// @Param limit query int false "Resultados por página (padrão: 50, máximo: 500)"
+// @Param offset query int false "Resultados a pular"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /screener [get]
+func (p *ProxyServer) Screener(c *gin.Context) {
+	filters, err := parseScreenerFilters(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, -1100, err.Error())
+		return
+	}
+	sortBy := c.DefaultQuery("sort", defaultScreenerSort)
+	field := strings.TrimPrefix(sortBy, "-")
+	if _, ok := screenerFields[field]; !ok && field != "symbol" {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'sort' inválido: "+sortBy)
+		return
+	}
+	limit, offset := defaultScreenerLimit, 0
+	if raw := c.Query("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > maxScreenerLimit {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'limit' deve ser de 1 a "+strconv.Itoa(maxScreenerLimit))
+			return
+		}
+	}
+	if raw := c.Query("offset"); raw != "" {
+		if offset, err = strconv.Atoi(raw); err != nil || offset < 0 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'offset' inválido")
+			return
+		}
+	}
+
+	rows, ok := p.screenRows(c, queryList(c, "quote"), filters)
+	if !ok {
+		return
+	}
+	sortScreenerRows(rows, field, strings.HasPrefix(sortBy, "-"))
+	total := len(rows)
+	rows = rows[min(offset, total):min(offset+limit, total)]
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"offset":  offset,
+		"limit":   limit,
+		"sort":    sortBy,
+		"results": rows,
+	})
+}
+
+// screenRows monta as linhas dos símbolos dos ativos de cotação (todos, se
+// quotes vier vazio) e do status pedidos que passam pelos filtros. Em caso de
+// erro, já respondeu.
+func (p *ProxyServer) screenRows(c *gin.Context, quotes map[string]bool, filters []*screenerFilter) ([]screenerRow, bool) {
+	status := strings.ToUpper(c.DefaultQuery("status", "TRADING"))
+
+	info, err := p.market.ExchangeInfo(c.Request.Context())
+	if err != nil {
+		respondUpstreamError(c, err)
+		return nil, false
+	}
+	tickers, err := p.market.Tickers24h(c.Request.Context())
+	if err != nil {
+		respondUpstreamError(c, err)
+		return nil, false
+	}
+
+	rows := []screenerRow{}
+	for i := range info.Symbols {
+		s := &info.Symbols[i]
+		if (len(quotes) > 0 && !quotes[s.QuoteAsset]) || (status != "ALL" && s.Status != status) {
+			continue
+		}
+		ticker, ok := tickers[s.Symbol]
+		if !ok {
+			continue
+		}
+		row := newScreenerRow(s, ticker)
+		matched := true
+		for _, f := range filters {
+			if matched = f.match(&row); !matched {
+				break
+			}
+		}
+		if matched {
+			rows = append(rows, row)
+		}
+	}
+	return rows, true
+}
+
+// sortScreenerRows ordena pelo campo (ou symbol). Sem o campo (spread sem
+// bid e ask), o símbolo vai para o fim; empates em ordem alfabética.
+func sortScreenerRows(rows []screenerRow, field string, desc bool) {
+	value := screenerFields[field]
+	sort.SliceStable(rows, func(i, j int) bool {
+		if value != nil {
+			a, okA := value(&rows[i])
+			b, okB := value(&rows[j])
+			if okA != okB {
+				return okA
+			}
+			if a != b {
+				return (a > b) == desc
+			}
+			return rows[i].Symbol < rows[j].Symbol
+		}
+		return (rows[i].Symbol < rows[j].Symbol) != desc
+	})
+}
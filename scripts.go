@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Passos de execução por chamada do script, para que um laço infinito não
+// prenda a requisição
+const defaultScriptMaxSteps = 1_000_000
+
+func init() {
+	RegisterPlugin("starlark", newStarlarkPlugin)
+}
+
+// starlarkPlugin roda um script Starlark como plugin (type: starlark em
+// PLUGINS_FILE). O script define on_request(req) e/ou on_response(resp):
+//
+//	req  = {"method", "path", "query": {nome: valor}, "headers": {nome: valor}}
+//	resp = {"method", "path", "query", "status", "body"}
+//
+// on_request altera req["query"] e req["headers"] ou chama fail("motivo") para
+// recusar a chamada; on_response altera resp["body"] (JSON já decodificado) e
+// resp["status"], ou retorna o novo corpo.
+type starlarkPlugin struct {
+	name       string
+	maxSteps   uint64
+	onRequest  starlark.Callable
+	onResponse starlark.Callable
+}
+
+type starlarkConfig struct {
+	Script   string `yaml:"script"`
+	MaxSteps uint64 `yaml:"max_steps"`
+}
+
+var scriptPredeclared = starlark.StringDict{
+	"json":   json.Module,
+	"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+}
+
+func newStarlarkPlugin(config map[string]interface{}) (Plugin, error) {
+	var cfg starlarkConfig
+	if err := decodePluginConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Script == "" {
+		return nil, fmt.Errorf("script é obrigatório")
+	}
+	src, err := os.ReadFile(cfg.Script)
+	if err != nil {
+		return nil, err
+	}
+	p := &starlarkPlugin{name: cfg.Script, maxSteps: cfg.MaxSteps}
+	if p.maxSteps == 0 {
+		p.maxSteps = defaultScriptMaxSteps
+	}
+
+	thread := p.thread()
+	globals, err := starlark.ExecFile(thread, cfg.Script, src, scriptPredeclared)
+	if err != nil {
+		return nil, fmt.Errorf("erro no script: %w", err)
+	}
+	// Globais congeladas podem ser lidas por várias requisições ao mesmo tempo
+	globals.Freeze()
+	for name, target := range map[string]*starlark.Callable{"on_request": &p.onRequest, "on_response": &p.onResponse} {
+		if value, ok := globals[name]; ok {
+			fn, ok := value.(starlark.Callable)
+			if !ok {
+				return nil, fmt.Errorf("%s deve ser uma função", name)
+			}
+			*target = fn
+		}
+	}
+	if p.onRequest == nil && p.onResponse == nil {
+		return nil, fmt.Errorf("%s não define on_request nem on_response", cfg.Script)
+	}
+	return p, nil
+}
+
+func (p *starlarkPlugin) Name() string { return "starlark:" + p.name }
+
+func (p *starlarkPlugin) thread() *starlark.Thread {
+	thread := &starlark.Thread{Name: p.name}
+	thread.SetMaxExecutionSteps(p.maxSteps)
+	return thread
+}
+
+// scriptError tira o prefixo "fail: " das mensagens de fail()
+func scriptError(err error) error {
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%s", strings.TrimPrefix(evalErr.Msg, "fail: "))
+	}
+	return err
+}
+
+// valuesToDict converte query/headers em dict; nomes repetidos viram lista
+func valuesToDict(values map[string][]string) *starlark.Dict {
+	dict := starlark.NewDict(len(values))
+	for name, list := range values {
+		if len(list) == 1 {
+			dict.SetKey(starlark.String(name), starlark.String(list[0]))
+			continue
+		}
+		items := make([]starlark.Value, len(list))
+		for i, v := range list {
+			items[i] = starlark.String(v)
+		}
+		dict.SetKey(starlark.String(name), starlark.NewList(items))
+	}
+	return dict
+}
+
+// dictToValues faz o caminho inverso de valuesToDict; None remove o nome
+func dictToValues(value starlark.Value, field string) (map[string][]string, error) {
+	dict, ok := value.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("%s deve ser um dict", field)
+	}
+	values := map[string][]string{}
+	for _, item := range dict.Items() {
+		name, ok := starlark.AsString(item[0])
+		if !ok {
+			return nil, fmt.Errorf("%s: nomes devem ser strings", field)
+		}
+		switch v := item[1].(type) {
+		case starlark.NoneType:
+		case *starlark.List:
+			for i := 0; i < v.Len(); i++ {
+				values[name] = append(values[name], scriptString(v.Index(i)))
+			}
+		default:
+			values[name] = []string{scriptString(v)}
+		}
+	}
+	return values, nil
+}
+
+func scriptString(v starlark.Value) string {
+	if s, ok := starlark.AsString(v); ok {
+		return s
+	}
+	return v.String()
+}
+
+func (p *starlarkPlugin) BeforeRequest(c *gin.Context) error {
+	if p.onRequest == nil {
+		return nil
+	}
+	req := starlark.NewDict(4)
+	req.SetKey(starlark.String("method"), starlark.String(c.Request.Method))
+	req.SetKey(starlark.String("path"), starlark.String(c.Request.URL.Path))
+	req.SetKey(starlark.String("query"), valuesToDict(c.Request.URL.Query()))
+	req.SetKey(starlark.String("headers"), valuesToDict(c.Request.Header))
+
+	if _, err := starlark.Call(p.thread(), p.onRequest, starlark.Tuple{req}, nil); err != nil {
+		return scriptError(err)
+	}
+
+	query, _, _ := req.Get(starlark.String("query"))
+	values, err := dictToValues(query, "query")
+	if err != nil {
+		return err
+	}
+	// Só reescreve a query se o script mudou algo: a ordem original importa
+	// para chamadas assinadas
+	if !reflect.DeepEqual(url.Values(values), c.Request.URL.Query()) {
+		c.Request.URL.RawQuery = url.Values(values).Encode()
+	}
+	headers, _, _ := req.Get(starlark.String("headers"))
+	header, err := dictToValues(headers, "headers")
+	if err != nil {
+		return err
+	}
+	for name := range c.Request.Header {
+		if _, kept := header[name]; !kept {
+			c.Request.Header.Del(name)
+		}
+	}
+	for name, list := range header {
+		c.Request.Header[http.CanonicalHeaderKey(name)] = list
+	}
+	return nil
+}
+
+func (p *starlarkPlugin) AfterResponse(c *gin.Context, status int, body []byte) (int, []byte, error) {
+	if p.onResponse == nil {
+		return status, body, nil
+	}
+	thread := p.thread()
+	decoded, err := starlark.Call(thread, json.Module.Members["decode"], starlark.Tuple{starlark.String(body)}, nil)
+	if err != nil {
+		// Corpo que não é JSON válido segue sem alteração
+		return status, body, nil
+	}
+	resp := starlark.NewDict(5)
+	resp.SetKey(starlark.String("method"), starlark.String(c.Request.Method))
+	resp.SetKey(starlark.String("path"), starlark.String(c.Request.URL.Path))
+	resp.SetKey(starlark.String("query"), valuesToDict(c.Request.URL.Query()))
+	resp.SetKey(starlark.String("status"), starlark.MakeInt(status))
+	resp.SetKey(starlark.String("body"), decoded)
+
+	result, err := starlark.Call(thread, p.onResponse, starlark.Tuple{resp}, nil)
+	if err != nil {
+		return status, body, scriptError(err)
+	}
+	if result == starlark.None {
+		result, _, _ = resp.Get(starlark.String("body"))
+	}
+	if value, _, _ := resp.Get(starlark.String("status")); value != nil {
+		if code, ok := value.(starlark.Int); ok {
+			if n, ok := code.Int64(); ok && n >= 100 && n <= 599 {
+				status = int(n)
+			}
+		}
+	}
+	encoded, err := starlark.Call(thread, json.Module.Members["encode"], starlark.Tuple{result}, nil)
+	if err != nil {
+		return status, body, scriptError(err)
+	}
+	return status, []byte(encoded.(starlark.String)), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSelfTestTimeout = 10 * time.Second
+	defaultSelfTestStream  = "btcusdt@bookTicker"
+	selfTestBucket         = "self_test"
+)
+
+// Exemplo de assinatura da documentação da Binance (HMAC SHA256)
+const (
+	selfTestSecret    = "NhqPtmdSJYdKjVHjA7PZj4Mge3R5YNiP1e3UZjInClVN65XAbvqqM6A7H5fATj0j"
+	selfTestPayload   = "symbol=LTCBTC&side=BUY&type=LIMIT&timeInForce=GTC&quantity=1&price=0.1&recvWindow=5000&timestamp=1499827319559"
+	selfTestSignature = "c8db56825ae71d6d79447849e617115f4a920fa2acdcab2b053c4b2838bd6b71"
+)
+
+// Estados de uma etapa do autoteste
+const (
+	selfTestOK      = "OK"
+	selfTestFailed  = "FAIL"
+	selfTestSkipped = "SKIP"
+)
+
+// errSelfTestSkip marca uma etapa que não se aplica à configuração
+type errSelfTestSkip string
+
+func (e errSelfTestSkip) Error() string { return string(e) }
+
+// SelfTestStep é o resultado de uma etapa do autoteste
+type SelfTestStep struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// SelfTestReport é o relatório de --self-test
+type SelfTestReport struct {
+	OK    bool           `json:"ok"`
+	Steps []SelfTestStep `json:"steps"`
+}
+
+// selfTestCheck é uma etapa do autoteste
+type selfTestCheck struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// selfTestChecks são os caminhos críticos conferidos por --self-test, em ordem
+func (p *ProxyServer) selfTestChecks(stream string) []selfTestCheck {
+	return []selfTestCheck{
+		{"ping", p.pingUpstream},
+		{"exchangeInfo", func(ctx context.Context) error {
+			info, err := p.market.ExchangeInfo(ctx)
+			if err != nil {
+				return err
+			}
+			if len(info.Symbols) == 0 {
+				return errors.New("exchangeInfo sem símbolos")
+			}
+			// A segunda leitura tem de vir do cache
+			if _, err := p.market.ExchangeInfo(ctx); err != nil {
+				return fmt.Errorf("leitura do cache: %w", err)
+			}
+			return nil
+		}},
+		{"store", func(ctx context.Context) error {
+			if p.store == nil {
+				return errors.New("armazenamento local indisponível (DATA_DIR)")
+			}
+			value := time.Now().UTC().Format(time.RFC3339Nano)
+			if err := p.store.Put(selfTestBucket, "probe", value); err != nil {
+				return fmt.Errorf("gravação: %w", err)
+			}
+			var read string
+			if found, err := p.store.Get(selfTestBucket, "probe", &read); err != nil || !found || read != value {
+				return fmt.Errorf("leitura não confere (%v)", err)
+			}
+			_, err := p.store.Delete(selfTestBucket, "probe")
+			return err
+		}},
+		{"signing", func(ctx context.Context) error {
+			tenant := &Tenant{SecretKey: selfTestSecret}
+			if signature := tenant.sign(selfTestPayload); signature != selfTestSignature {
+				return fmt.Errorf("assinatura %s difere da esperada", signature)
+			}
+			return nil
+		}},
+		{"credentials", func(ctx context.Context) error {
+			if p.secrets == nil {
+				return errSelfTestSkip("CREDENTIALS_KEY não configurada")
+			}
+			sealed, err := p.secrets.Seal([]byte("self-test"))
+			if err != nil {
+				return err
+			}
+			opened, err := p.secrets.Open(sealed)
+			if err != nil || string(opened) != "self-test" {
+				return fmt.Errorf("decifragem não confere (%v)", err)
+			}
+			return nil
+		}},
+		{"redis", func(ctx context.Context) error {
+			if p.cluster == nil {
+				return errSelfTestSkip("REDIS_URL não configurado")
+			}
+			_, err := p.cluster.redis.Do("PING")
+			return err
+		}},
+		{"websocket", func(ctx context.Context) error {
+			return waitFirstMessage(ctx, p.hub, stream)
+		}},
+	}
+}
+
+// RunSelfTest executa as etapas em ordem, cada uma com o seu timeout
+func (p *ProxyServer) RunSelfTest(timeout time.Duration, stream string) *SelfTestReport {
+	report := &SelfTestReport{OK: true, Steps: []SelfTestStep{}}
+	for _, step := range p.selfTestChecks(stream) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		err := step.run(ctx)
+		cancel()
+
+		result := SelfTestStep{Name: step.name, Status: selfTestOK, Duration: time.Since(start).Round(time.Millisecond).String()}
+		var skip errSelfTestSkip
+		switch {
+		case errors.As(err, &skip):
+			result.Status, result.Detail = selfTestSkipped, skip.Error()
+		case err != nil:
+			result.Status, result.Detail = selfTestFailed, redactSecrets(err.Error())
+			report.OK = false
+		}
+		report.Steps = append(report.Steps, result)
+	}
+	return report
+}
+
+// Write imprime o relatório em texto ou, com format json, em JSON
+func (r *SelfTestReport) Write(w io.Writer, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	var out strings.Builder
+	for _, step := range r.Steps {
+		fmt.Fprintf(&out, "%-4s  %-12s  %8s  %s\n", step.Status, step.Name, step.Duration, step.Detail)
+	}
+	if r.OK {
+		out.WriteString("self-test: OK\n")
+	} else {
+		out.WriteString("self-test: FAIL\n")
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// selfTestFlag procura --self-test (ou --self-test=json) nos argumentos e
+// retorna o formato do relatório
+func selfTestFlag(args []string) (string, bool) {
+	for _, arg := range args {
+		if arg == "--self-test" {
+			return "text", true
+		}
+		if format, ok := strings.CutPrefix(arg, "--self-test="); ok {
+			return format, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSentimentCacheTTL = time.Minute
+	defaultSentimentLimit    = 30
+	defaultSentimentPeriod   = "5m"
+)
+
+// futuresSentimentPaths são os endpoints de long/short da API de futuros
+// servidos pelo cache em /futures/<path>. Todos aceitam symbol, period e
+// limit e têm limite de uso próprio, bem mais baixo que o resto da API.
+var futuresSentimentPaths = map[string]bool{
+	"/futures/data/topLongShortAccountRatio":    true,
+	"/futures/data/topLongShortPositionRatio":   true,
+	"/futures/data/globalLongShortAccountRatio": true,
+	"/futures/data/takerlongshortRatio":         true,
+}
+
+// sentimentRow é uma linha dos endpoints de long/short com o timestamp já
+// convertido; os demais campos seguem como vieram
+type sentimentRow struct {
+	timestamp int64
+	fields    map[string]json.RawMessage
+}
+
+// sentimentData busca um endpoint de long/short pelo cache de mercado
+// (SENTIMENT_CACHE_TTL), com timestamp normalizado para milissegundos
+// numéricos e as linhas em ordem cronológica
+func (p *ProxyServer) sentimentData(ctx context.Context, baseURL, path string, query url.Values) ([]byte, error) {
+	ttl := getEnvDuration("SENTIMENT_CACHE_TTL", defaultSentimentCacheTTL)
+	value, err := p.market.getFrom(ctx, baseURL, path, query, ttl, normalizeSentimentRows)
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+// normalizeSentimentRows converte o timestamp de cada linha (número ou
+// string, conforme o endpoint) para número e ordena as linhas por ele
+func normalizeSentimentRows(data []byte) (interface{}, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	rows := make([]sentimentRow, len(raw))
+	for i, fields := range raw {
+		var ts flexFloat
+		if err := json.Unmarshal(fields["timestamp"], &ts); err != nil {
+			return nil, fmt.Errorf("timestamp inválido: %w", err)
+		}
+		fields["timestamp"] = json.RawMessage(strconv.FormatInt(int64(ts), 10))
+		rows[i] = sentimentRow{timestamp: int64(ts), fields: fields}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].timestamp < rows[j].timestamp })
+	for i, row := range rows {
+		raw[i] = row.fields
+	}
+	return json.Marshal(raw)
+}
+
+// serveSentimentData responde um GET de /futures/futures/data/<endpoint> de
+// long/short pelo cache, em vez de repassar cada consulta
+func (p *ProxyServer) serveSentimentData(c *gin.Context, backend ExchangeBackend, path string, query url.Values) {
+	data, err := p.sentimentData(c.Request.Context(), backend.BaseURL(), path, query)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	c.Header("X-Proxy-Exchange", backend.Name())
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// sentimentPoint é um período da visão combinada: razão long/short das
+// contas top traders e volume taker de compra/venda
+type sentimentPoint struct {
+	Timestamp      int64  `json:"timestamp"`
+	LongShortRatio string `json:"longShortRatio,omitempty"`
+	LongAccount    string `json:"longAccount,omitempty"`
+	ShortAccount   string `json:"shortAccount,omitempty"`
+	BuySellRatio   string `json:"buySellRatio,omitempty"`
+	BuyVol         string `json:"buyVol,omitempty"`
+	SellVol        string `json:"sellVol,omitempty"`
+}
+
+// sentimentReport é a resposta de /local/sentiment/{symbol}
+type sentimentReport struct {
+	Symbol  string           `json:"symbol"`
+	Period  string           `json:"period"`
+	Latest  *sentimentPoint  `json:"latest"`
+	History []sentimentPoint `json:"history"`
+}
+
+// LocalSentiment combina a razão long/short dos top traders e o volume taker
+// de um contrato perpétuo em uma série por período
+// @Summary Sentimento de futuros (long/short)
+// @Description Junta topLongShortAccountRatio e takerlongshortRatio da API de futuros por timestamp, servidos do cache
+// @Tags Market Data
+// @Produce json
+// @Param symbol path string true "Contrato (ex: BTCUSDT)"
+// @Param period query string false "Período (5m a 1d)"
+// @Param limit query integer false "Períodos no histórico (máx. 500)"
+// @Success 200 {object} sentimentReport
+// @Failure 400 {object} map[string]interface{}
+// @Router /local/sentiment/{symbol} [get]
+func (p *ProxyServer) LocalSentiment(backend ExchangeBackend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		symbol := strings.ToUpper(c.Param("symbol"))
+		period := c.DefaultQuery("period", defaultSentimentPeriod)
+		if !openInterestPeriods[period] {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'period' inválido (use 5m, 15m, 30m, 1h, 2h, 4h, 6h, 12h ou 1d)")
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSentimentLimit)))
+		if err != nil || limit < 1 || limit > 500 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'limit' deve estar entre 1 e 500")
+			return
+		}
+
+		query := url.Values{"symbol": {symbol}, "period": {period}, "limit": {strconv.Itoa(limit)}}
+		var (
+			accounts []struct {
+				Timestamp      int64  `json:"timestamp"`
+				LongShortRatio string `json:"longShortRatio"`
+				LongAccount    string `json:"longAccount"`
+				ShortAccount   string `json:"shortAccount"`
+			}
+			takers []struct {
+				Timestamp    int64  `json:"timestamp"`
+				BuySellRatio string `json:"buySellRatio"`
+				BuyVol       string `json:"buyVol"`
+				SellVol      string `json:"sellVol"`
+			}
+		)
+		for path, out := range map[string]interface{}{
+			"/futures/data/topLongShortAccountRatio": &accounts,
+			"/futures/data/takerlongshortRatio":      &takers,
+		} {
+			data, err := p.sentimentData(c.Request.Context(), backend.BaseURL(), path, query)
+			if err != nil {
+				respondUpstreamError(c, err)
+				return
+			}
+			if err := json.Unmarshal(data, out); err != nil {
+				respondError(c, http.StatusBadGateway, -1000, "Resposta inválida de "+path+": "+err.Error())
+				return
+			}
+		}
+
+		points := make(map[int64]*sentimentPoint)
+		point := func(ts int64) *sentimentPoint {
+			if _, ok := points[ts]; !ok {
+				points[ts] = &sentimentPoint{Timestamp: ts}
+			}
+			return points[ts]
+		}
+		for _, row := range accounts {
+			item := point(row.Timestamp)
+			item.LongShortRatio, item.LongAccount, item.ShortAccount = row.LongShortRatio, row.LongAccount, row.ShortAccount
+		}
+		for _, row := range takers {
+			item := point(row.Timestamp)
+			item.BuySellRatio, item.BuyVol, item.SellVol = row.BuySellRatio, row.BuyVol, row.SellVol
+		}
+
+		report := &sentimentReport{Symbol: symbol, Period: period, History: make([]sentimentPoint, 0, len(points))}
+		for _, item := range points {
+			report.History = append(report.History, *item)
+		}
+		sort.Slice(report.History, func(i, j int) bool { return report.History[i].Timestamp < report.History[j].Timestamp })
+		if n := len(report.History); n > 0 {
+			report.Latest = &report.History[n-1]
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"gopkg.in/yaml.v3"
+)
+
+// newHTTPServer configura o servidor HTTP. No listener TLS o HTTP/2 é
+// negociado por ALPN (desligável com HTTP2=false); em texto puro, H2C=true
+// aceita HTTP/2 sem TLS (prior knowledge ou Upgrade: h2c).
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	if getEnvBool("H2C", false) {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}
+	if !getEnvBool("HTTP2", true) {
+		// Mapa vazio (não nil) desliga o HTTP/2 automático do net/http
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return server
+}
+
+// Escopos de rotas de um listener
+const (
+	listenerRoutesAll    = "all"
+	listenerRoutesPublic = "public"
+	listenerRoutesAdmin  = "admin"
+)
+
+// listenerConfig é um endereço em que o proxy atende. address é host:porta
+// ou unix:/caminho/do.sock; routes limita as rotas servidas (all, public =
+// tudo menos as operacionais, admin = só as operacionais e /health).
+type listenerConfig struct {
+	Address string `yaml:"address"`
+	Routes  string `yaml:"routes"`
+	// Permissões do arquivo do socket Unix (ex: "0660")
+	Mode string `yaml:"mode"`
+	// TLS com TLS_CERT_FILE/TLS_KEY_FILE (padrão: sim em TCP quando os
+	// arquivos estão definidos, não em sockets Unix)
+	TLS *bool `yaml:"tls"`
+}
+
+type listenersFile struct {
+	Listeners []listenerConfig `yaml:"listeners"`
+}
+
+// LoadListeners lê LISTENERS_FILE. Sem arquivo, o proxy atende só em
+// defaultAddr (PORT), com todas as rotas.
+func LoadListeners(path, defaultAddr string) ([]listenerConfig, error) {
+	if path == "" {
+		return []listenerConfig{{Address: defaultAddr, Routes: listenerRoutesAll}}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file listenersFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+	if len(file.Listeners) == 0 {
+		return nil, fmt.Errorf("nenhum listener em %s", path)
+	}
+	for i := range file.Listeners {
+		listener := &file.Listeners[i]
+		if listener.Address == "" {
+			return nil, fmt.Errorf("listener sem address em %s", path)
+		}
+		if listener.Routes == "" {
+			listener.Routes = listenerRoutesAll
+		}
+		if listener.Routes != listenerRoutesAll && listener.Routes != listenerRoutesPublic && listener.Routes != listenerRoutesAdmin {
+			return nil, fmt.Errorf("listener %s: routes deve ser all, public ou admin", listener.Address)
+		}
+	}
+	return file.Listeners, nil
+}
+
+// withAdminListener separa as rotas operacionais em ADMIN_PORT: os
+// listeners com todas as rotas passam a servir só as públicas
+func withAdminListener(listeners []listenerConfig, addr string) []listenerConfig {
+	for i := range listeners {
+		if listeners[i].Routes == listenerRoutesAll {
+			listeners[i].Routes = listenerRoutesPublic
+		}
+	}
+	plain := false
+	return append(listeners, listenerConfig{Address: addr, Routes: listenerRoutesAdmin, TLS: &plain})
+}
+
+// isOperationalPath indica as rotas operacionais (/admin, /jobs, /metrics e
+// /debug), que ficam fora dos listeners públicos
+func isOperationalPath(path string) bool {
+	for _, prefix := range []string{"/admin", "/jobs", "/metrics", "/debug"} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isProbePath indica as rotas de health check, atendidas também nos
+// listeners admin
+func isProbePath(path string) bool {
+	return path == "/health" || path == "/readyz"
+}
+
+// listen abre o socket do listener (TCP ou Unix)
+func (l listenerConfig) listen() (net.Listener, error) {
+	socket, ok := strings.CutPrefix(l.Address, "unix:")
+	if !ok {
+		return listenSocket("tcp", l.Address)
+	}
+	// Herdado num restart: o arquivo já está no lugar, com as permissões
+	if listener, ok := inheritedSocket("unix", socket); ok {
+		return listener, nil
+	}
+	// Socket deixado por uma execução anterior
+	if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(socket)
+	}
+	listener, err := listenSocket("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if l.Mode != "" {
+		mode, err := strconv.ParseUint(l.Mode, 8, 32)
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("mode inválido em %s: %w", l.Address, err)
+		}
+		if err := os.Chmod(socket, os.FileMode(mode)); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// scopedHandler recusa com 404 as rotas fora do escopo do listener, como se
+// elas não existissem nele. Os listeners admin também servem o pprof em
+// /debug/pprof/.
+func scopedHandler(handler http.Handler, routes string) http.Handler {
+	if routes == listenerRoutesAll {
+		return handler
+	}
+	debug := http.NewServeMux()
+	debug.HandleFunc("/debug/pprof/", pprof.Index)
+	debug.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	debug.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	debug.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	debug.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operational := isOperationalPath(r.URL.Path)
+		if routes == listenerRoutesPublic && operational || routes == listenerRoutesAdmin && !operational && !isProbePath(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		if routes == listenerRoutesAdmin && strings.HasPrefix(r.URL.Path, "/debug/pprof/") {
+			debug.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// serveListeners atende handler em todos os listeners ao mesmo tempo e
+// retorna quando algum deles para ou, num restart/encerramento por sinal,
+// depois de drenar as conexões (ver handleSignals). Num restart, o processo
+// anterior só é liberado depois de ready (fim do aquecimento).
+func serveListeners(handler http.Handler, configs []listenerConfig, ready <-chan struct{}) error {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	errs := make(chan error, len(configs))
+	group := newServerGroup()
+	for _, config := range configs {
+		listener, err := config.listen()
+		if err != nil {
+			return fmt.Errorf("erro ao abrir %s: %w", config.Address, err)
+		}
+		useTLS := certFile != "" && keyFile != "" && !strings.HasPrefix(config.Address, "unix:")
+		if config.TLS != nil {
+			useTLS = *config.TLS
+		}
+		server := newHTTPServer(config.Address, scopedHandler(handler, config.Routes))
+		group.add(server, listener)
+		go func() {
+			defer group.serving.Done()
+			if useTLS {
+				errs <- server.ServeTLS(listener, certFile, keyFile)
+				return
+			}
+			errs <- server.Serve(listener)
+		}()
+		// log.Printf("🚀 Atendendo em %s (rotas: %s)", config.Address, config.Routes)
+	}
+	drained := make(chan error, 1)
+	go func() { drained <- handleSignals(group) }()
+	go func() {
+		<-ready
+		notifyReady()
+	}()
+	select {
+	case err := <-errs:
+		// Durante a drenagem os listeners são fechados de propósito
+		if group.draining.Load() {
+			return <-drained
+		}
+		return err
+	case err := <-drained:
+		return err
+	}
+}
+
+// accessLogFormatter é o formato de log do gin com o protocolo da requisição
+// (HTTP/1.1, HTTP/2.0). A linha é a mesma do fmt.Sprintf
+// "[GIN] %v | %3d | %13v | %15s | %-8s | %-7s %#v\n%s", montada num buffer
+// do pool: o log de acesso roda em toda requisição.
+func accessLogFormatter(param gin.LogFormatterParams) string {
+	if isHeadRequest(param.Request.Context()) {
+		param.Method = http.MethodHead
+	}
+	buf := logBufferPool.Get().(*[]byte)
+	line := append((*buf)[:0], "[GIN] "...)
+	line = param.TimeStamp.AppendFormat(line, "2006/01/02 - 15:04:05")
+	line = append(line, " | "...)
+	line = appendPadded(line, strconv.Itoa(param.StatusCode), 3, false)
+	line = append(line, " | "...)
+	line = appendPadded(line, param.Latency.Round(time.Microsecond).String(), 13, false)
+	line = append(line, " | "...)
+	line = appendPadded(line, param.ClientIP, 15, false)
+	line = append(line, " | "...)
+	line = appendPadded(line, param.Request.Proto, 8, true)
+	line = append(line, " | "...)
+	line = appendPadded(line, param.Method, 7, true)
+	line = append(line, ' ')
+	line = strconv.AppendQuote(line, param.Path)
+	line = append(line, '\n')
+	line = append(line, param.ErrorMessage...)
+	formatted := string(line)
+	*buf = line
+	logBufferPool.Put(buf)
+	return formatted
+}
+
+var logBufferPool = sync.Pool{New: func() any { return new([]byte) }}
+
+// appendPadded acrescenta s completado com espaços até width caracteres, à
+// direita (left) ou à esquerda, como %-*s e %*s
+func appendPadded(dst []byte, s string, width int, left bool) []byte {
+	pad := width - utf8.RuneCountInString(s)
+	if left {
+		dst = append(dst, s...)
+	}
+	for ; pad > 0; pad-- {
+		dst = append(dst, ' ')
+	}
+	if !left {
+		dst = append(dst, s...)
+	}
+	return dst
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScopedHandlerOperationalRoutes(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	public := scopedHandler(handler, listenerRoutesPublic)
+	admin := scopedHandler(handler, listenerRoutesAdmin)
+
+	for path, operational := range map[string]bool{
+		"/admin/tenants":  true,
+		"/jobs":           true,
+		"/jobs/abc/data":  true,
+		"/metrics":        true,
+		"/api/v3/ticker":  false,
+		"/jobsfoo":        false,
+		"/local/deferred": false,
+	} {
+		for name, scoped := range map[string]http.Handler{"public": public, "admin": admin} {
+			w := httptest.NewRecorder()
+			scoped.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			served := w.Code == http.StatusOK
+			if want := operational == (name == "admin"); served != want {
+				t.Errorf("%s %s: status %d, atendido esperado %v", name, path, w.Code, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serverTimingKey guarda o *serverTiming no contexto da requisição
+type serverTimingKey struct{}
+
+// serverTimingPhase é uma etapa do header Server-Timing
+type serverTimingPhase struct {
+	name string
+	dur  time.Duration
+}
+
+// serverTimingOrder é a ordem das etapas no header
+var serverTimingOrder = []string{"queue", "dns", "connect", "tls", "ttfb", "read", "transform"}
+
+// serverTiming acumula as etapas de uma requisição repassada à Binance:
+// fila do agendador de peso, DNS, conexão, TLS, espera pelo primeiro byte,
+// leitura do corpo e transformação da resposta
+type serverTiming struct {
+	start time.Time
+
+	mu           sync.Mutex
+	phases       []serverTimingPhase
+	sent         time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+}
+
+// ServerTiming mede cada requisição (SERVER_TIMING) para que ProxyRequest
+// responda as etapas no header Server-Timing
+func ServerTiming() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timing := &serverTiming{start: time.Now()}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), serverTimingKey{}, timing))
+		c.Next()
+	}
+}
+
+// serverTimingFrom retorna a medição da requisição, ou nil sem SERVER_TIMING
+func serverTimingFrom(ctx context.Context) *serverTiming {
+	timing, _ := ctx.Value(serverTimingKey{}).(*serverTiming)
+	return timing
+}
+
+func (t *serverTiming) add(name string, dur time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, phase := range t.phases {
+		if phase.name == name {
+			return
+		}
+	}
+	t.phases = append(t.phases, serverTimingPhase{name, dur})
+}
+
+// trace acompanha a chamada à Binance feita com o contexto retornado.
+// Conexões reaproveitadas não têm dns, connect nem tls.
+func (t *serverTiming) trace(ctx context.Context) context.Context {
+	if t == nil {
+		return ctx
+	}
+	t.mu.Lock()
+	t.sent = time.Now()
+	t.mu.Unlock()
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			// Até aqui a chamada esperou pelo orçamento de peso e pelos
+			// limites de concorrência
+			t.mu.Lock()
+			sent := t.sent
+			t.mu.Unlock()
+			t.add("queue", time.Since(sent))
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			start := t.dnsStart
+			t.mu.Unlock()
+			t.add("dns", time.Since(start))
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				return
+			}
+			t.mu.Lock()
+			start := t.connectStart
+			t.mu.Unlock()
+			t.add("connect", time.Since(start))
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			start := t.tlsStart
+			t.mu.Unlock()
+			t.add("tls", time.Since(start))
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			t.wroteRequest = time.Now()
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			wrote := t.wroteRequest
+			t.mu.Unlock()
+			if !wrote.IsZero() {
+				t.add("ttfb", time.Since(wrote))
+			}
+		},
+	})
+}
+
+// since registra a etapa name como o tempo desde start
+func (t *serverTiming) since(name string, start time.Time) {
+	if t != nil {
+		t.add(name, time.Since(start))
+	}
+}
+
+// setHeader escreve Server-Timing com as etapas medidas e o total desde a
+// entrada da requisição no proxy
+func (t *serverTiming) setHeader(c *gin.Context) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	phases := append([]serverTimingPhase(nil), t.phases...)
+	t.mu.Unlock()
+
+	parts := make([]string, 0, len(phases)+1)
+	for _, name := range serverTimingOrder {
+		for _, phase := range phases {
+			if phase.name == name {
+				parts = append(parts, formatServerTiming(phase.name, phase.dur))
+			}
+		}
+	}
+	parts = append(parts, formatServerTiming("total", time.Since(t.start)))
+	c.Header("Server-Timing", strings.Join(parts, ", "))
+	// Sem estes headers o navegador esconde o Server-Timing de outra origem
+	c.Header("Timing-Allow-Origin", "*")
+	c.Header("Access-Control-Expose-Headers", "Server-Timing")
+}
+
+// formatServerTiming formata uma etapa com a duração em ms
+func formatServerTiming(name string, dur time.Duration) string {
+	return name + ";dur=" + strconv.FormatFloat(float64(dur.Microseconds())/1000, 'f', -1, 64)
+}
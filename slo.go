@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultSLOWindow    = 30 * 24 * time.Hour
+	maxSLOWindow        = 30 * 24 * time.Hour
+	sloEvaluateInterval = 30 * time.Second
+	sloWebhookTimeout   = 10 * time.Second
+	sloWebhookAttempts  = 3
+)
+
+// Regras padrão de burn rate (SRE Workbook, para janela de 30 dias): page
+// quando 2% do orçamento some em 1h, ticket quando 5% some em 6h
+var defaultSLOAlertRules = []SLOAlertRule{
+	{Severity: "page", Long: "1h", Short: "5m", BurnRate: 14.4},
+	{Severity: "ticket", Long: "6h", Short: "30m", BurnRate: 6},
+}
+
+// SLOConfig é um SLO de SLO_FILE
+type SLOConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Método opcional e padrão do path com * (ex: GET /api/v3/ticker/*)
+	Route string `yaml:"route" json:"route"`
+	// Porcentagem de requisições boas na janela (ex: 99.9)
+	Objective float64 `yaml:"objective" json:"objective"`
+	// Requisições mais lentas que latency gastam orçamento
+	Latency string `yaml:"latency" json:"latency,omitempty"`
+	// Respostas 5xx gastam orçamento (padrão true)
+	Errors *bool  `yaml:"errors" json:"errors"`
+	Window string `yaml:"window" json:"window"`
+	// Sobrepõe o webhook geral do arquivo
+	Webhook string `yaml:"webhook" json:"-"`
+}
+
+// SLOAlertRule dispara quando o burn rate passa de BurnRate nas duas
+// janelas, a longa e a curta (que faz o alerta cessar logo após o problema)
+type SLOAlertRule struct {
+	Severity string  `yaml:"severity" json:"severity"`
+	Long     string  `yaml:"long" json:"long"`
+	Short    string  `yaml:"short" json:"short"`
+	BurnRate float64 `yaml:"burn_rate" json:"burnRate"`
+
+	long, short time.Duration
+}
+
+type sloFile struct {
+	Webhook string         `yaml:"webhook"`
+	Alerts  []SLOAlertRule `yaml:"alerts"`
+	SLOs    []SLOConfig    `yaml:"slos"`
+}
+
+// sloBucket conta as requisições de um minuto
+type sloBucket struct {
+	minute     int64
+	total, bad int64
+}
+
+// sloTracker acompanha um SLO em baldes de um minuto cobrindo a janela
+type sloTracker struct {
+	config    SLOConfig
+	route     endpointPattern
+	latency   time.Duration
+	errors    bool
+	objective float64
+	window    time.Duration
+	webhook   string
+
+	mu           sync.Mutex
+	buckets      []sloBucket
+	total, bad   int64
+	firing       map[string]bool
+	webhookError string
+}
+
+// SLOStatus é a visão de um SLO em /admin/slo
+type SLOStatus struct {
+	SLOConfig
+	Requests int64 `json:"requests"`
+	Bad      int64 `json:"bad"`
+	// Porcentagem de requisições boas na janela (100 sem requisições)
+	Compliance float64 `json:"compliance"`
+	// Fração do orçamento de erro que resta (negativa se estourou)
+	ErrorBudgetRemaining float64            `json:"errorBudgetRemaining"`
+	BurnRates            map[string]float64 `json:"burnRates"`
+	Firing               []string           `json:"firing"`
+	LastWebhookError     string             `json:"lastWebhookError,omitempty"`
+}
+
+// sloAlert é o corpo enviado ao webhook quando um alerta dispara ou cessa
+type sloAlert struct {
+	SLO                  string             `json:"slo"`
+	Route                string             `json:"route"`
+	Severity             string             `json:"severity"`
+	Status               string             `json:"status"`
+	BurnRates            map[string]float64 `json:"burnRates"`
+	Threshold            float64            `json:"threshold"`
+	Objective            float64            `json:"objective"`
+	Compliance           float64            `json:"compliance"`
+	ErrorBudgetRemaining float64            `json:"errorBudgetRemaining"`
+	Window               string             `json:"window"`
+	Time                 int64              `json:"time"`
+}
+
+// SLOMonitor mede os SLOs por rota e avisa os webhooks quando o orçamento
+// de erro está sendo consumido rápido demais
+type SLOMonitor struct {
+	trackers []*sloTracker
+	rules    []SLOAlertRule
+	client   *http.Client
+	cancel   context.CancelFunc
+}
+
+// LoadSLOs lê e valida SLO_FILE
+func LoadSLOs(path string) (*SLOMonitor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file sloFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+
+	m := &SLOMonitor{rules: file.Alerts, client: &http.Client{Timeout: sloWebhookTimeout}}
+	if len(m.rules) == 0 {
+		m.rules = append([]SLOAlertRule(nil), defaultSLOAlertRules...)
+	}
+	for i := range m.rules {
+		rule := &m.rules[i]
+		var okLong, okShort bool
+		rule.long, okLong = parseWindow(rule.Long)
+		rule.short, okShort = parseWindow(rule.Short)
+		if rule.Severity == "" || !okLong || !okShort || rule.short > rule.long || rule.BurnRate <= 0 {
+			return nil, fmt.Errorf("alerta inválido em %s: severity, long >= short e burn_rate > 0 são obrigatórios", path)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, config := range file.SLOs {
+		if config.Name == "" || config.Route == "" {
+			return nil, fmt.Errorf("SLO incompleto em %s: name e route são obrigatórios", path)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("SLO duplicado: %s", config.Name)
+		}
+		names[config.Name] = true
+		if config.Objective <= 0 || config.Objective >= 100 {
+			return nil, fmt.Errorf("SLO %s: objective deve ficar entre 0 e 100 (ex: 99.9)", config.Name)
+		}
+		t := &sloTracker{config: config, objective: config.Objective / 100, errors: true, window: defaultSLOWindow,
+			webhook: config.Webhook, firing: map[string]bool{}}
+		if method, rest, ok := strings.Cut(strings.TrimSpace(config.Route), " "); ok {
+			t.route.method, config.Route = strings.ToUpper(method), strings.TrimSpace(rest)
+		}
+		t.route.path = globPattern(config.Route)
+		if config.Errors != nil {
+			t.errors = *config.Errors
+		}
+		if config.Latency != "" {
+			latency, err := time.ParseDuration(config.Latency)
+			if err != nil || latency <= 0 {
+				return nil, fmt.Errorf("SLO %s: latency inválida: %q", config.Name, config.Latency)
+			}
+			t.latency = latency
+		}
+		if !t.errors && t.latency == 0 {
+			return nil, fmt.Errorf("SLO %s: defina latency ou mantenha errors", config.Name)
+		}
+		if config.Window != "" {
+			window, ok := parseWindow(config.Window)
+			if !ok || window < time.Hour || window > maxSLOWindow {
+				return nil, fmt.Errorf("SLO %s: window deve ir de 1h a 30d", config.Name)
+			}
+			t.window = window
+		}
+		for _, rule := range m.rules {
+			if rule.long > t.window {
+				return nil, fmt.Errorf("SLO %s: a janela do alerta %s (%s) passa de window", config.Name, rule.Severity, rule.Long)
+			}
+		}
+		if t.webhook == "" {
+			t.webhook = file.Webhook
+		}
+		t.config.Window, t.config.Errors = shortDuration(t.window), &t.errors
+		t.buckets = make([]sloBucket, int(t.window/time.Minute))
+		m.trackers = append(m.trackers, t)
+	}
+	return m, nil
+}
+
+// Middleware conta cada requisição nos SLOs cuja rota ela casa. Upgrades
+// para WebSocket ficam de fora: a duração é a da conexão.
+func (m *SLOMonitor) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+		elapsed := time.Since(start)
+		status := c.Writer.Status()
+		for _, t := range m.trackers {
+			if !matchEndpoint([]endpointPattern{t.route}, c.Request.Method, c.Request.URL.Path) {
+				continue
+			}
+			bad := t.errors && status >= http.StatusInternalServerError || t.latency > 0 && elapsed > t.latency
+			t.record(start, bad)
+		}
+	}
+}
+
+func (t *sloTracker) record(at time.Time, bad bool) {
+	minute := at.Unix() / 60
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[minute%int64(len(t.buckets))]
+	if b.minute != minute {
+		*b = sloBucket{minute: minute}
+	}
+	b.total++
+	t.total++
+	if bad {
+		b.bad++
+		t.bad++
+	}
+}
+
+// counts soma as requisições dos últimos d; chamar com t.mu
+func (t *sloTracker) counts(now time.Time, d time.Duration) (total, bad int64) {
+	minute := now.Unix() / 60
+	for i := int64(0); i < int64(d/time.Minute) && i < int64(len(t.buckets)); i++ {
+		b := t.buckets[(minute-i)%int64(len(t.buckets))]
+		if b.minute == minute-i {
+			total += b.total
+			bad += b.bad
+		}
+	}
+	return total, bad
+}
+
+// burnRate é a taxa de erros em d dividida pela permitida: 1 consome o
+// orçamento exatamente ao fim da janela
+func (t *sloTracker) burnRate(now time.Time, d time.Duration) float64 {
+	total, bad := t.counts(now, d)
+	if total == 0 {
+		return 0
+	}
+	return float64(bad) / float64(total) / (1 - t.objective)
+}
+
+// status monta a visão do SLO com as janelas das regras
+func (t *sloTracker) status(now time.Time, rules []SLOAlertRule) SLOStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	total, bad := t.counts(now, t.window)
+	s := SLOStatus{SLOConfig: t.config, Requests: total, Bad: bad, Compliance: 100, ErrorBudgetRemaining: 1,
+		BurnRates: map[string]float64{}, Firing: []string{}, LastWebhookError: t.webhookError}
+	if total > 0 {
+		s.Compliance = roundRatio(100 * float64(total-bad) / float64(total))
+		s.ErrorBudgetRemaining = roundRatio(1 - float64(bad)/float64(total)/(1-t.objective))
+	}
+	for _, rule := range rules {
+		for _, d := range []time.Duration{rule.long, rule.short} {
+			s.BurnRates[shortDuration(d)] = roundRatio(t.burnRate(now, d))
+		}
+	}
+	for _, rule := range rules {
+		if t.firing[rule.Severity] {
+			s.Firing = append(s.Firing, rule.Severity)
+		}
+	}
+	return s
+}
+
+// Status lista os SLOs
+func (m *SLOMonitor) Status() []SLOStatus {
+	now := time.Now()
+	statuses := make([]SLOStatus, 0, len(m.trackers))
+	for _, t := range m.trackers {
+		statuses = append(statuses, t.status(now, m.rules))
+	}
+	return statuses
+}
+
+// Start avalia os alertas periodicamente
+func (m *SLOMonitor) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	go func() {
+		ticker := time.NewTicker(sloEvaluateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.evaluate(ctx, time.Now())
+			}
+		}
+	}()
+}
+
+// Close interrompe a avaliação dos alertas
+func (m *SLOMonitor) Close() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+// evaluate confere as regras de cada SLO e avisa o webhook quando um
+// alerta dispara ou cessa
+func (m *SLOMonitor) evaluate(ctx context.Context, now time.Time) {
+	for _, t := range m.trackers {
+		for _, rule := range m.rules {
+			t.mu.Lock()
+			long, short := t.burnRate(now, rule.long), t.burnRate(now, rule.short)
+			firing := long >= rule.BurnRate && short >= rule.BurnRate
+			changed := firing != t.firing[rule.Severity]
+			t.firing[rule.Severity] = firing
+			t.mu.Unlock()
+			if !changed || t.webhook == "" {
+				continue
+			}
+
+			status := t.status(now, m.rules)
+			alert := sloAlert{
+				SLO:                  t.config.Name,
+				Route:                t.config.Route,
+				Severity:             rule.Severity,
+				Status:               "resolved",
+				BurnRates:            map[string]float64{shortDuration(rule.long): roundRatio(long), shortDuration(rule.short): roundRatio(short)},
+				Threshold:            rule.BurnRate,
+				Objective:            t.config.Objective,
+				Compliance:           status.Compliance,
+				ErrorBudgetRemaining: status.ErrorBudgetRemaining,
+				Window:               t.config.Window,
+				Time:                 now.UnixMilli(),
+			}
+			if firing {
+				alert.Status = "firing"
+			}
+			go m.notify(ctx, t, alert)
+		}
+	}
+}
+
+// notify envia o alerta ao webhook, com novas tentativas em falhas
+func (m *SLOMonitor) notify(ctx context.Context, t *sloTracker, alert sloAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	for attempt := 0; attempt < sloWebhookAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+		if err = postWebhook(ctx, m.client, t.webhook, body); err == nil {
+			break
+		}
+	}
+	t.mu.Lock()
+	t.webhookError = ""
+	if err != nil {
+		t.webhookError = redactSecrets(err.Error())
+		// log.Printf("[WARN] Webhook do SLO %s falhou: %v", t.config.Name, err)
+	}
+	t.mu.Unlock()
+}
+
+// postWebhook envia um JSON ao webhook; respostas fora de 2xx são erro
+func postWebhook(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("webhook respondeu " + resp.Status)
+	}
+	return nil
+}
+
+// writeMetrics escreve as métricas dos SLOs
+func (m *SLOMonitor) writeMetrics(w *metricsWriter) {
+	statuses := m.Status()
+	w.family("proxy_slo_objective_ratio", "gauge", "Objetivo do SLO (fração de requisições boas).")
+	for _, s := range statuses {
+		w.sample("proxy_slo_objective_ratio", s.Objective/100, "slo", s.Name)
+	}
+	totals := make([][2]int64, len(m.trackers))
+	for i, t := range m.trackers {
+		t.mu.Lock()
+		totals[i] = [2]int64{t.total, t.bad}
+		t.mu.Unlock()
+	}
+	w.family("proxy_slo_requests_total", "counter", "Requisições contadas no SLO desde o início do processo.")
+	for i, t := range m.trackers {
+		w.sample("proxy_slo_requests_total", float64(totals[i][0]), "slo", t.config.Name)
+	}
+	w.family("proxy_slo_bad_requests_total", "counter", "Requisições lentas ou com erro desde o início do processo.")
+	for i, t := range m.trackers {
+		w.sample("proxy_slo_bad_requests_total", float64(totals[i][1]), "slo", t.config.Name)
+	}
+	w.family("proxy_slo_compliance_ratio", "gauge", "Fração de requisições boas na janela do SLO.")
+	for _, s := range statuses {
+		w.sample("proxy_slo_compliance_ratio", s.Compliance/100, "slo", s.Name)
+	}
+	w.family("proxy_slo_error_budget_remaining_ratio", "gauge", "Fração do orçamento de erro que resta na janela.")
+	for _, s := range statuses {
+		w.sample("proxy_slo_error_budget_remaining_ratio", s.ErrorBudgetRemaining, "slo", s.Name)
+	}
+	w.family("proxy_slo_burn_rate", "gauge", "Velocidade de consumo do orçamento de erro (1 = esgota ao fim da janela).")
+	for _, s := range statuses {
+		windows := make([]string, 0, len(s.BurnRates))
+		for window := range s.BurnRates {
+			windows = append(windows, window)
+		}
+		sort.Strings(windows)
+		for _, window := range windows {
+			w.sample("proxy_slo_burn_rate", s.BurnRates[window], "slo", s.Name, "window", window)
+		}
+	}
+	w.family("proxy_slo_alert_firing", "gauge", "1 enquanto o alerta de burn rate está disparado.")
+	for _, s := range statuses {
+		for _, rule := range m.rules {
+			firing := 0.0
+			for _, severity := range s.Firing {
+				if severity == rule.Severity {
+					firing = 1
+				}
+			}
+			w.sample("proxy_slo_alert_firing", firing, "slo", s.Name, "severity", rule.Severity)
+		}
+	}
+}
+
+// roundRatio arredonda em 4 casas
+func roundRatio(value float64) float64 {
+	return math.Round(value*1e4) / 1e4
+}
+
+// shortDuration formata durações redondas sem as unidades zeradas (30d, 1h, 5m)
+func shortDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	case d%time.Hour == 0:
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	case d%time.Minute == 0:
+		return strconv.Itoa(int(d/time.Minute)) + "m"
+	}
+	return d.String()
+}
+
+// SLOStatusList mostra os SLOs
+// @Summary SLOs por rota
+// @Description Conformidade, orçamento de erro restante, burn rates e alertas disparados de cada SLO de SLO_FILE, na janela configurada
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/slo [get]
+func (p *ProxyServer) SLOStatusList(c *gin.Context) {
+	if p.slos == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "SLOs desabilitados (SLO_FILE)")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"slos": p.slos.Status(), "alerts": p.slos.rules})
+}
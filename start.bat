@@ -26,5 +26,5 @@ echo    URL Binance: %BINANCE_API_URL%
 echo.
 
 REM Executar o proxy
-go run main.go
+go run .
 
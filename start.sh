@@ -32,5 +32,5 @@ echo ""
 #
 #
 # Executar o proxy
-go run main.go
+go run .
 
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const defaultDataDir = "./data"
+
+// Store é o armazenamento embutido (bbolt) usado para persistir dados locais
+// do proxy. Os valores são gravados como JSON, agrupados por bucket.
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore abre (ou cria) o banco de dados no caminho informado
+func OpenStore(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put grava o valor serializado em JSON na chave do bucket
+func (s *Store) Put(bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// Get lê a chave do bucket em out. Retorna false se a chave não existir.
+func (s *Store) Get(bucket, key string, out interface{}) (bool, error) {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(key)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, out)
+}
+
+// Delete remove a chave do bucket. Retorna false se a chave não existia.
+func (s *Store) Delete(bucket, key string) (bool, error) {
+	found := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil || b.Get([]byte(key)) == nil {
+			return nil
+		}
+		found = true
+		return b.Delete([]byte(key))
+	})
+	return found, err
+}
+
+// ForEach percorre todas as chaves do bucket em ordem
+func (s *Store) ForEach(bucket string, fn func(key string, data []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	binanceStreamBaseURL   = "wss://stream.binance.com:9443"
+	subscriberBufferSize   = 256
+	streamReconnectMin     = time.Second
+	streamReconnectMax     = 30 * time.Second
+	streamHandshakeTimeout = 10 * time.Second
+)
+
+// StreamMessage é uma mensagem recebida de um stream da Binance
+type StreamMessage struct {
+	Stream string
+	Data   json.RawMessage
+}
+
+// StreamHub compartilha conexões WebSocket com a Binance entre vários clientes.
+// Cada stream (ex: btcusdt@trade) tem no máximo uma conexão upstream, aberta
+// no primeiro assinante e fechada quando o último assinante sai.
+type StreamHub struct {
+	baseURL string
+	dialer  *websocket.Dialer
+	// Reconexão e pings das conexões com a Binance; os pings dos clientes
+	// servidos pelo proxy também ficam aqui
+	reconnect ReconnectPolicy
+	heartbeat wsHeartbeat
+	outages   *OutageNotifier
+	// Com várias réplicas, só a dona de cada stream conecta na Binance
+	cluster *Cluster
+	// O que fazer com os clientes lentos (SubscribeClient)
+	slow *SlowConsumerPolicies
+
+	mu      sync.Mutex
+	streams map[string]*upstreamStream
+	// Identificador das assinaturas em /admin/streams
+	nextSubID atomic.Uint64
+	// Eventos de reconexão recentes e a saída em que são escritos
+	events     []StreamEvent
+	eventsOut  io.Writer
+	reconnects map[streamReconnectKey]uint64
+	// Durante a manutenção da Binance, as reconexões esperam o intervalo
+	// máximo e não disparam alertas
+	maintenance func() bool
+}
+
+type upstreamStream struct {
+	name        string
+	cancel      context.CancelFunc
+	subscribers map[*Subscription]struct{}
+	// Esta réplica consome o stream e o publica às demais (modo cluster)
+	owner atomic.Bool
+
+	// Estatísticas de /admin/streams, protegidas por StreamHub.mu
+	opened      time.Time
+	connected   bool
+	connectedAt time.Time
+	reconnects  uint64
+	messages    uint64
+	lastMessage time.Time
+	lastError   string
+	rate        messageRate
+	// Tentativas seguidas sem conectar e se o alerta disparou
+	failures int
+	alerting bool
+}
+
+// messageRate conta as mensagens por segundo nos últimos
+// messageRateWindow segundos
+type messageRate struct {
+	second  int64
+	buckets [messageRateWindow]uint64
+}
+
+const messageRateWindow = 10
+
+func (r *messageRate) add(now time.Time) {
+	sec := now.Unix()
+	r.advance(sec)
+	r.buckets[sec%messageRateWindow]++
+}
+
+// advance zera os segundos que passaram sem mensagens
+func (r *messageRate) advance(sec int64) {
+	if sec-r.second >= messageRateWindow {
+		r.buckets = [messageRateWindow]uint64{}
+	} else {
+		for s := r.second + 1; s <= sec; s++ {
+			r.buckets[s%messageRateWindow] = 0
+		}
+	}
+	if sec > r.second {
+		r.second = sec
+	}
+}
+
+// perSecond é a média da janela, sem o segundo em andamento
+func (r *messageRate) perSecond(now time.Time) float64 {
+	sec := now.Unix()
+	r.advance(sec)
+	var total uint64
+	for i, count := range r.buckets {
+		if int64(i) != sec%messageRateWindow {
+			total += count
+		}
+	}
+	return float64(total) / (messageRateWindow - 1)
+}
+
+// Subscription recebe as mensagens dos streams assinados pelo canal C
+type Subscription struct {
+	C <-chan StreamMessage
+
+	ch      chan StreamMessage
+	release func()
+	once    sync.Once
+	// Política de consumidor lento; sem ela (assinaturas internas), a
+	// mensagem que não cabe no buffer é descartada
+	slow     *SlowConsumerPolicies
+	done     chan struct{}
+	doneOnce sync.Once
+	// Motivo do encerramento pelo proxy, enviado no close frame do WebSocket
+	closeCode int
+	closeText string
+
+	// Estatísticas de /admin/streams
+	id        uint64
+	label     atomic.Value
+	streams   []string
+	created   time.Time
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// newSubscription cria uma assinatura; release é chamado uma única vez no Close
+func newSubscription(release func(sub *Subscription)) *Subscription {
+	sub := &Subscription{ch: make(chan StreamMessage, subscriberBufferSize), done: make(chan struct{}), created: time.Now()}
+	sub.C = sub.ch
+	sub.release = func() { release(sub) }
+	return sub
+}
+
+// send entrega a mensagem sem bloquear. Com o buffer cheio, aplica a política
+// de consumidor lento; retorna false se a mensagem foi descartada.
+func (s *Subscription) send(msg StreamMessage) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	select {
+	case s.ch <- msg:
+		s.delivered.Add(1)
+		return true
+	default:
+	}
+	if s.slow == nil || !s.slow.overflow(s, msg) {
+		s.dropped.Add(1)
+		return false
+	}
+	s.delivered.Add(1)
+	return true
+}
+
+// Label identifica a assinatura em /admin/streams (ex: rota e IP do cliente)
+func (s *Subscription) Label(label string) *Subscription {
+	s.label.Store(label)
+	return s
+}
+
+// Done fecha quando o proxy encerra a assinatura (cliente lento com a
+// política disconnect, fim de um replay); quem serve o cliente deve encerrar
+// a conexão
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) disconnect() {
+	s.finish(websocket.ClosePolicyViolation, "slow consumer")
+}
+
+// finish encerra a assinatura com o motivo do close frame
+func (s *Subscription) finish(code int, text string) {
+	s.doneOnce.Do(func() {
+		s.closeCode, s.closeText = code, text
+		close(s.done)
+	})
+}
+
+// Close cancela a assinatura. O canal C não é fechado.
+func (s *Subscription) Close() {
+	s.once.Do(s.release)
+}
+
+// StreamHubConfig define como o hub se conecta à Binance
+type StreamHubConfig struct {
+	// URL base dos streams (BINANCE_STREAM_URL)
+	BaseURL string
+	// Família de endereço e TLS das conexões, os mesmos das chamadas HTTP;
+	// nil usa os do Go
+	Dial *UpstreamDialPolicy
+	TLS  *UpstreamTLSPolicy
+	// WS_RECONNECT_* e WS_UPSTREAM_MAX_AGE
+	Reconnect ReconnectPolicy
+	// WS_*_PING_INTERVAL e WS_*_READ_TIMEOUT
+	Heartbeat wsHeartbeat
+	// Streams fora do ar e problemas de TLS; nil desliga os avisos
+	Outages *OutageNotifier
+}
+
+func NewStreamHub(config StreamHubConfig) *StreamHub {
+	dialer := &websocket.Dialer{
+		HandshakeTimeout: streamHandshakeTimeout,
+		// HTTPS_PROXY/NO_PROXY, como nas chamadas HTTP
+		Proxy: http.ProxyFromEnvironment,
+	}
+	if config.Dial != nil {
+		dialer.NetDialContext = config.Dial.dial
+	}
+	if config.TLS != nil {
+		dialer.TLSClientConfig = config.TLS.Config(config.Outages)
+	}
+	return &StreamHub{
+		baseURL:   config.BaseURL,
+		dialer:    dialer,
+		reconnect: config.Reconnect,
+		heartbeat: config.Heartbeat,
+		outages:   config.Outages,
+		slow:      newSlowConsumerPolicies(slowDropNewest),
+		streams:   make(map[string]*upstreamStream),
+	}
+}
+
+// SubscribeClient é o Subscribe para assinaturas que servem clientes: um
+// cliente que não acompanha o stream recebe a política configurada para ele
+// (descartar, conflacionar ou desconectar), contada em /metrics
+func (h *StreamHub) SubscribeClient(streams ...string) *Subscription {
+	return h.subscribe(h.slow, streams)
+}
+
+// Subscribe assina um ou mais streams da Binance. A assinatura deve ser
+// encerrada com Close para liberar as conexões upstream.
+func (h *StreamHub) Subscribe(streams ...string) *Subscription {
+	return h.subscribe(nil, streams)
+}
+
+func (h *StreamHub) subscribe(slow *SlowConsumerPolicies, streams []string) *Subscription {
+	sub := newSubscription(func(sub *Subscription) {
+		h.unsubscribe(sub, streams)
+	})
+	sub.slow = slow
+	sub.id = h.nextSubID.Add(1)
+	sub.streams = streams
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, name := range streams {
+		us, ok := h.streams[name]
+		if !ok {
+			ctx, cancel := context.WithCancel(context.Background())
+			us = &upstreamStream{
+				name:        name,
+				cancel:      cancel,
+				subscribers: make(map[*Subscription]struct{}),
+				opened:      time.Now(),
+			}
+			h.streams[name] = us
+			go h.run(ctx, us)
+		}
+		us.subscribers[sub] = struct{}{}
+	}
+	return sub
+}
+
+// unsubscribe remove a assinatura dos streams, fechando as conexões upstream
+// que ficaram sem assinantes
+func (h *StreamHub) unsubscribe(sub *Subscription, streams []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, name := range streams {
+		us, ok := h.streams[name]
+		if !ok {
+			continue
+		}
+		delete(us.subscribers, sub)
+		if len(us.subscribers) == 0 {
+			us.cancel()
+			delete(h.streams, name)
+			// Sem assinantes, o stream fora do ar deixa de ser um problema
+			h.outages.Resolve(outageStreamDown, name)
+		}
+	}
+}
+
+func (h *StreamHub) run(ctx context.Context, us *upstreamStream) {
+	if h.cluster != nil {
+		h.runShared(ctx, us)
+		return
+	}
+	h.runUpstream(ctx, us)
+}
+
+// runUpstream mantém a conexão upstream aberta, reconectando conforme a
+// política de reconexão do hub
+func (h *StreamHub) runUpstream(ctx context.Context, us *upstreamStream) {
+	for {
+		connected, err := h.consume(ctx, us)
+		if ctx.Err() != nil {
+			return
+		}
+		// log.Printf("[WARN] Stream %s desconectado: %v", us.name, err)
+		delay := h.disconnected(us, connected, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// consume lê mensagens do stream até a conexão cair ou o contexto ser
+// cancelado, passando para a conexão substituta nas trocas programadas
+func (h *StreamHub) consume(ctx context.Context, us *upstreamStream) (bool, error) {
+	conn, _, err := h.dialer.DialContext(ctx, h.baseURL+"/ws/"+us.name, nil)
+	if err != nil {
+		return false, err
+	}
+	h.connectedUpstream(us)
+	for {
+		next, err := h.read(ctx, us, conn)
+		if next == nil {
+			return true, err
+		}
+		conn = next
+		h.rotated(us)
+	}
+}
+
+// read entrega as mensagens de conn até ela cair. Retorna a conexão que a
+// substitui quando a queda foi a troca programada (WS_UPSTREAM_MAX_AGE).
+func (h *StreamHub) read(ctx context.Context, us *upstreamStream, conn *websocket.Conn) (*websocket.Conn, error) {
+	defer conn.Close()
+
+	done := make(chan struct{})
+	next := make(chan *websocket.Conn, 1)
+	rotating := make(chan struct{})
+	go func() {
+		defer close(rotating)
+		h.rotate(ctx, us, conn, next, done)
+	}()
+
+	// Uma conexão que parou de receber (nem os pings da Binance) é refeita
+	alive := wsKeepAlive(conn, h.heartbeat.UpstreamPing, h.heartbeat.UpstreamTimeout, done)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			close(done)
+			<-rotating
+			select {
+			case replacement := <-next:
+				if ctx.Err() != nil {
+					replacement.Close()
+					return nil, err
+				}
+				return replacement, nil
+			default:
+				return nil, err
+			}
+		}
+		alive()
+		h.dispatch(us, data)
+	}
+}
+
+// dispatch entrega a mensagem a todos os assinantes do stream. Assinantes
+// lentos, com o buffer cheio, perdem a mensagem em vez de bloquear o stream.
+func (h *StreamHub) dispatch(us *upstreamStream, data []byte) {
+	msg := StreamMessage{Stream: us.name, Data: json.RawMessage(data)}
+	if us.owner.Load() {
+		h.cluster.publish(h.cluster.key("stream:"+us.name), data)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	us.messages++
+	us.lastMessage = now
+	us.rate.add(now)
+	for sub := range us.subscribers {
+		sub.send(msg)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// O hub montado só com a própria configuração: as duas primeiras conexões
+// são recusadas pela Binance falsa, o alerta sai na segunda falha e a
+// terceira entrega a mensagem, encerrando o stream_down
+func TestStreamHubReconnectPolicy(t *testing.T) {
+	var attempts atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"trade","s":"BTCUSDT"}`))
+		conn.ReadMessage()
+	}))
+	defer upstream.Close()
+
+	outages := NewOutageNotifier(io.Discard, "", 1)
+	defer outages.Close()
+	hub := NewStreamHub(StreamHubConfig{
+		BaseURL:   "ws" + strings.TrimPrefix(upstream.URL, "http"),
+		Reconnect: ReconnectPolicy{Initial: 5 * time.Millisecond, Max: 10 * time.Millisecond, AlertAfter: 2},
+		Heartbeat: defaultWSHeartbeat(),
+		Outages:   outages,
+	})
+	sub := hub.Subscribe("btcusdt@trade")
+	defer sub.Close()
+
+	select {
+	case msg := <-sub.C:
+		if msg.Stream != "btcusdt@trade" || !strings.Contains(string(msg.Data), "BTCUSDT") {
+			t.Fatalf("mensagem = %s %s", msg.Stream, msg.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("nenhuma mensagem depois de %d tentativas", attempts.Load())
+	}
+
+	var types []string
+	for _, event := range hub.Events() {
+		types = append([]string{event.Type}, types...)
+	}
+	want := []string{streamEventReconnect, streamEventReconnect, streamEventAlert, streamEventRecovered}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatalf("eventos = %v, esperado %v", types, want)
+	}
+
+	status := outages.Status()
+	if len(status.Active) != 0 || len(status.Recent) != 2 || status.Recent[1].Type != outageStreamDown || status.Recent[0].Status != outageResolved {
+		t.Fatalf("indisponibilidades = %+v, esperado stream_down disparado e resolvido", status)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamKeepAliveInterval = 15 * time.Second
+	streamWriteTimeout      = 10 * time.Second
+)
+
+// wsHeartbeat são os intervalos de ping/pong das conexões WebSocket. Com a
+// Binance, que manda um ping a cada 20s e derruba quem não responde, o
+// padrão é só responder e reconectar se nada chegar em 1min; com os
+// clientes, o proxy manda os pings e fecha quem para de responder.
+type wsHeartbeat struct {
+	// Ping enviado pelo proxy à Binance (WS_UPSTREAM_PING_INTERVAL; 0 desliga)
+	UpstreamPing time.Duration
+	// Sem nenhum frame da Binance nesse tempo, a conexão é refeita
+	// (WS_UPSTREAM_READ_TIMEOUT)
+	UpstreamTimeout time.Duration
+	// Ping enviado aos clientes (WS_CLIENT_PING_INTERVAL)
+	ClientPing time.Duration
+	// Sem pong nem mensagem do cliente nesse tempo, ele é desconectado
+	// (WS_CLIENT_READ_TIMEOUT)
+	ClientTimeout time.Duration
+}
+
+// defaultWSHeartbeat são os pings e prazos sem as variáveis WS_*
+func defaultWSHeartbeat() wsHeartbeat {
+	return wsHeartbeat{
+		UpstreamTimeout: time.Minute,
+		ClientPing:      20 * time.Second,
+		ClientTimeout:   time.Minute,
+	}
+}
+
+// wsKeepAlive configura o ping/pong da conexão: responde aos pings da outra
+// ponta dentro do prazo de escrita, manda um ping a cada interval até done
+// fechar e faz a leitura falhar se nada (mensagem, ping ou pong) chegar em
+// timeout. Retorna a função que renova o prazo, chamada a cada mensagem lida.
+func wsKeepAlive(conn *websocket.Conn, interval, timeout time.Duration, done <-chan struct{}) func() {
+	alive := func() {
+		if timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+	}
+	alive()
+	conn.SetPingHandler(func(data string) error {
+		alive()
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(streamWriteTimeout))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	conn.SetPongHandler(func(string) error {
+		alive()
+		return nil
+	})
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)) != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+	return alive
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// StreamTransform converte uma mensagem upstream no payload enviado ao cliente.
+// Retornar false descarta a mensagem.
+type StreamTransform func(msg StreamMessage) (interface{}, bool)
+
+// serveSubscription entrega as mensagens da assinatura ao cliente, via
+// WebSocket quando a requisição pede upgrade ou via Server-Sent Events. Com
+// ?maxRate=N, as mensagens de cada stream são conflacionadas em no máximo N
+// por segundo; com ?normalize=true, os eventos da Binance saem com nomes
+// descritivos e números no lugar de texto; com ?filter=, só as mensagens que
+// casam com a expressão (sobre o JSON já normalizado) são enviadas. Mensagens
+// com envelope (streamUpdate) recebem a seq depois disso. Bloqueia até o
+// cliente desconectar.
+func (p *ProxyServer) serveSubscription(c *gin.Context, sub *Subscription, transform StreamTransform) {
+	rate, ok := parseStreamRate(c.Query("maxRate"))
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'maxRate' deve ser um inteiro de 1 a "+strconv.Itoa(maxStreamRate)+" (mensagens por segundo)")
+		return
+	}
+	normalize, err := strconv.ParseBool(c.DefaultQuery("normalize", "false"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'normalize' deve ser true ou false")
+		return
+	}
+	filter, err := ParseStreamFilter(c.Query("filter"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'filter' inválido: "+err.Error())
+		return
+	}
+	if normalize {
+		transform = normalizeStream(transform)
+	}
+	if filter != nil {
+		transform = filter.Wrap(transform)
+	}
+	transform = sequenceStream(transform)
+	messages := sub.C
+	if rate > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		messages = conflateMessages(sub.C, rate, done)
+	}
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		p.serveWebSocket(c, sub, messages, transform)
+		return
+	}
+	serveSSE(c, sub, messages, transform)
+}
+
+func (p *ProxyServer) serveWebSocket(c *gin.Context, sub *Subscription, messages <-chan StreamMessage, transform StreamTransform) {
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Ler (e descartar) mensagens do cliente para detectar a desconexão; um
+	// cliente que para de responder aos pings é dado como morto
+	closed := make(chan struct{})
+	alive := wsKeepAlive(conn, p.hub.heartbeat.ClientPing, p.hub.heartbeat.ClientTimeout, closed)
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			alive()
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-sub.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(sub.closeCode, sub.closeText), time.Now().Add(streamWriteTimeout))
+			return
+		case msg := <-messages:
+			payload, ok := transform(msg)
+			if !ok {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func serveSSE(c *gin.Context, sub *Subscription, messages <-chan StreamMessage, transform StreamTransform) {
+	// Streams longos não podem ser limitados pelo WriteTimeout do servidor
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-sub.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case msg := <-messages:
+			payload, ok := transform(msg)
+			if !ok {
+				continue
+			}
+			c.SSEvent("message", payload)
+			c.Writer.Flush()
+		}
+	}
+}
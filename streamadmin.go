@@ -0,0 +1,261 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpstreamStreamStatus é uma conexão do hub com a Binance em /admin/streams
+type UpstreamStreamStatus struct {
+	Stream string `json:"stream"`
+	// Em modo cluster: owner (conecta na Binance) ou follower (recebe pelo Redis)
+	Role           string     `json:"role,omitempty"`
+	Connected      bool       `json:"connected"`
+	OpenedAt       time.Time  `json:"openedAt"`
+	ConnectedSince *time.Time `json:"connectedSince,omitempty"`
+	Messages       uint64     `json:"messages"`
+	RatePerSecond  float64    `json:"ratePerSecond"`
+	Reconnects     uint64     `json:"reconnects"`
+	// Tentativas seguidas sem conectar e se passaram de WS_RECONNECT_ALERT_AFTER
+	Failures      int        `json:"failures,omitempty"`
+	Alerting      bool       `json:"alerting,omitempty"`
+	LastMessageAt *time.Time `json:"lastMessageAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	Subscribers   int        `json:"subscribers"`
+}
+
+// SubscriberStatus é uma assinatura do hub em /admin/streams
+type SubscriberStatus struct {
+	ID uint64 `json:"id"`
+	// client (SubscribeClient, sujeita às políticas de consumidor lento) ou
+	// internal (livro local, gravações, alertas...)
+	Kind      string    `json:"kind"`
+	Label     string    `json:"label,omitempty"`
+	Streams   []string  `json:"streams"`
+	Since     time.Time `json:"since"`
+	Delivered uint64    `json:"delivered"`
+	Dropped   uint64    `json:"dropped"`
+	Buffered  int       `json:"buffered"`
+	Capacity  int       `json:"capacity"`
+}
+
+// Status retorna as conexões upstream e as assinaturas do hub
+func (h *StreamHub) Status() ([]UpstreamStreamStatus, []SubscriberStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	upstreams := make([]UpstreamStreamStatus, 0, len(h.streams))
+	seen := make(map[*Subscription]bool)
+	subscribers := []SubscriberStatus{}
+	for _, us := range h.streams {
+		status := UpstreamStreamStatus{
+			Stream:        us.name,
+			Connected:     us.connected,
+			OpenedAt:      us.opened,
+			Messages:      us.messages,
+			RatePerSecond: us.rate.perSecond(now),
+			Reconnects:    us.reconnects,
+			LastError:     us.lastError,
+			Alerting:      us.alerting,
+			Subscribers:   len(us.subscribers),
+		}
+		if !us.connected {
+			status.Failures = us.failures
+		}
+		if h.cluster != nil {
+			status.Role = "follower"
+			if us.owner.Load() {
+				status.Role = "owner"
+			}
+		}
+		if us.connected {
+			since := us.connectedAt
+			status.ConnectedSince = &since
+		}
+		if !us.lastMessage.IsZero() {
+			last := us.lastMessage
+			status.LastMessageAt = &last
+		}
+		upstreams = append(upstreams, status)
+
+		for sub := range us.subscribers {
+			if seen[sub] {
+				continue
+			}
+			seen[sub] = true
+			kind := "internal"
+			if sub.slow != nil {
+				kind = "client"
+			}
+			label, _ := sub.label.Load().(string)
+			subscribers = append(subscribers, SubscriberStatus{
+				ID:        sub.id,
+				Kind:      kind,
+				Label:     label,
+				Streams:   sub.streams,
+				Since:     sub.created,
+				Delivered: sub.delivered.Load(),
+				Dropped:   sub.dropped.Load(),
+				Buffered:  len(sub.ch),
+				Capacity:  cap(sub.ch),
+			})
+		}
+	}
+	sort.Slice(upstreams, func(i, j int) bool { return upstreams[i].Stream < upstreams[j].Stream })
+	sort.Slice(subscribers, func(i, j int) bool { return subscribers[i].ID < subscribers[j].ID })
+	return upstreams, subscribers
+}
+
+// StreamHubStatus mostra o estado do hub de WebSocket
+// @Summary Estado do hub de streams
+// @Description Conexões com a Binance (stream, papel no cluster, conectado desde, mensagens, taxa por segundo nos últimos 10s, reconexões, falhas seguidas, alerta, último erro), as assinaturas (cliente ou interna, rota e IP, entregues, descartadas e ocupação do buffer) e os eventos de reconexão recentes
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} StreamHubStatusResponse
+// @Router /admin/streams [get]
+func (p *ProxyServer) StreamHubStatus(c *gin.Context) {
+	upstreams, subscribers := p.hub.Status()
+	resp := StreamHubStatusResponse{Upstreams: upstreams, Subscribers: subscribers, Events: p.hub.Events()}
+	for _, us := range upstreams {
+		resp.Totals.RatePerSecond += us.RatePerSecond
+		resp.Totals.Reconnects += us.Reconnects
+		if us.Connected {
+			resp.Totals.Connected++
+		}
+		if us.Alerting {
+			resp.Totals.Alerting++
+		}
+	}
+	for _, sub := range subscribers {
+		if sub.Kind == "client" {
+			resp.Totals.Clients++
+		}
+		resp.Totals.Dropped += sub.Dropped
+	}
+	resp.Totals.Upstreams = len(upstreams)
+	resp.Totals.Subscribers = len(subscribers)
+	c.JSON(http.StatusOK, resp)
+}
+
+// StreamHubStatusResponse é a resposta de /admin/streams
+type StreamHubStatusResponse struct {
+	Upstreams   []UpstreamStreamStatus `json:"upstreams"`
+	Subscribers []SubscriberStatus     `json:"subscribers"`
+	// Reconexões, trocas programadas e alertas recentes, do mais novo ao mais antigo
+	Events []StreamEvent `json:"events"`
+	Totals struct {
+		Upstreams     int     `json:"upstreams"`
+		Connected     int     `json:"connected"`
+		Alerting      int     `json:"alerting"`
+		Subscribers   int     `json:"subscribers"`
+		Clients       int     `json:"clients"`
+		RatePerSecond float64 `json:"ratePerSecond"`
+		Reconnects    uint64  `json:"reconnects"`
+		Dropped       uint64  `json:"dropped"`
+	} `json:"totals"`
+}
+
+// StreamHubDashboard serve o painel do hub. A página não tem dados: pede o
+// ADMIN_TOKEN, guardado só na aba (sessionStorage), e consulta
+// /admin/streams a cada 2s.
+// @Summary Painel do hub de streams
+// @Tags Admin
+// @Produce html
+// @Success 200 {string} string
+// @Router /admin/streams/dashboard [get]
+func StreamHubDashboard(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(streamDashboardHTML))
+}
+
+const streamDashboardHTML = `<!doctype html>
+<html lang="pt-BR">
+<head>
+<meta charset="utf-8">
+<title>Hub de streams</title>
+<style>
+body { font: 13px system-ui, sans-serif; margin: 16px; color: #222; }
+h1 { font-size: 18px; } h2 { font-size: 15px; margin-top: 24px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; white-space: nowrap; }
+td.num, th.num { text-align: right; }
+.down { color: #b00; } .warn { color: #a60; } #status { color: #666; }
+</style>
+</head>
+<body>
+<h1>Hub de streams</h1>
+<div id="status">carregando...</div>
+<div id="totals"></div>
+<h2>Conexões com a Binance</h2>
+<table><thead><tr><th>stream</th><th>papel</th><th>estado</th><th class="num">msg/s</th><th class="num">mensagens</th><th class="num">reconexões</th><th>última mensagem</th><th class="num">assinantes</th><th>último erro</th></tr></thead><tbody id="upstreams"></tbody></table>
+<h2>Eventos de reconexão</h2>
+<table><thead><tr><th>quando</th><th>stream</th><th>evento</th><th class="num">tentativa</th><th>espera</th><th>erro</th></tr></thead><tbody id="events"></tbody></table>
+<h2>Assinaturas</h2>
+<table><thead><tr><th class="num">id</th><th>tipo</th><th>origem</th><th>streams</th><th>desde</th><th class="num">entregues</th><th class="num">descartadas</th><th class="num">buffer</th></tr></thead><tbody id="subscribers"></tbody></table>
+<script>
+"use strict";
+function token() {
+  let t = sessionStorage.getItem("adminToken");
+  if (!t) {
+    t = prompt("ADMIN_TOKEN") || "";
+    sessionStorage.setItem("adminToken", t);
+  }
+  return t;
+}
+function esc(v) {
+  return String(v == null ? "" : v).replace(/[&<>"]/g, c => ({"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"}[c]));
+}
+function ago(ts) {
+  if (!ts) return "";
+  const s = Math.round((Date.now() - new Date(ts)) / 1000);
+  return s < 60 ? s + "s" : s < 3600 ? Math.floor(s / 60) + "min" : Math.floor(s / 3600) + "h";
+}
+function row(cells) {
+  return "<tr>" + cells.map(c => Array.isArray(c) ? '<td class="' + c[1] + '">' + esc(c[0]) + "</td>" : "<td>" + esc(c) + "</td>").join("") + "</tr>";
+}
+async function refresh() {
+  const status = document.getElementById("status");
+  try {
+    const resp = await fetch("../streams", {headers: {"X-Admin-Token": token()}, cache: "no-store"});
+    if (resp.status === 401 || resp.status === 403) {
+      sessionStorage.removeItem("adminToken");
+      status.textContent = "token inválido";
+      return;
+    }
+    const data = await resp.json();
+    const t = data.totals;
+    document.getElementById("totals").textContent = t.upstreams + " conexões (" + t.connected + " conectadas), " +
+      t.subscribers + " assinaturas (" + t.clients + " clientes), " + t.ratePerSecond.toFixed(1) + " msg/s, " +
+      t.reconnects + " reconexões, " + t.alerting + " em alerta, " + t.dropped + " mensagens descartadas";
+    document.getElementById("upstreams").innerHTML = data.upstreams.map(u => row([
+      u.stream, u.role || "",
+      [u.connected ? "conectado há " + ago(u.connectedSince) : "desconectado" + (u.failures ? " (" + u.failures + " falhas)" : ""), u.connected ? "" : "down"],
+      [u.ratePerSecond.toFixed(1), "num"], [u.messages, "num"], [u.reconnects, "num" + (u.reconnects ? " warn" : "")],
+      u.lastMessageAt ? ago(u.lastMessageAt) + " atrás" : "", [u.subscribers, "num"], u.lastError || "",
+    ])).join("");
+    document.getElementById("events").innerHTML = data.events.slice(0, 20).map(e => row([
+      new Date(e.time).toLocaleTimeString(), e.stream,
+      [e.type, e.type === "alert" ? "down" : e.type === "reconnect" ? "warn" : ""],
+      [e.attempt || "", "num"], e.delay || "", e.error || "",
+    ])).join("");
+    document.getElementById("subscribers").innerHTML = data.subscribers.map(s => row([
+      [s.id, "num"], s.kind, s.label || "", s.streams.join(", "), ago(s.since),
+      [s.delivered, "num"], [s.dropped, "num" + (s.dropped ? " warn" : "")], [s.buffered + "/" + s.capacity, "num"],
+    ])).join("");
+    status.textContent = "atualizado " + new Date().toLocaleTimeString();
+  } catch (err) {
+    status.textContent = "erro: " + err;
+  }
+}
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Tamanho máximo de ?filter=
+const maxStreamFilterLength = 512
+
+// streamFilterAliases dão nomes legíveis aos campos curtos dos eventos da
+// Binance, pelo tipo do evento (campo e). Um campo que existe no evento com
+// o nome pedido tem precedência.
+var streamFilterAliases = map[string]map[string]string{
+	"trade":    {"price": "p", "qty": "q", "quantity": "q", "symbol": "s", "time": "T", "buyerIsMaker": "m"},
+	"aggTrade": {"price": "p", "qty": "q", "quantity": "q", "symbol": "s", "time": "T", "buyerIsMaker": "m"},
+	"24hrMiniTicker": {
+		"price": "c", "close": "c", "open": "o", "high": "h", "low": "l",
+		"volume": "v", "quoteVolume": "q", "symbol": "s", "time": "E",
+	},
+	"24hrTicker": {
+		"price": "c", "close": "c", "open": "o", "high": "h", "low": "l", "change": "p",
+		"changePercent": "P", "volume": "v", "quoteVolume": "q", "symbol": "s", "time": "E",
+	},
+	"depthUpdate": {"symbol": "s", "firstUpdateId": "U", "finalUpdateId": "u", "time": "E"},
+}
+
+// streamCondition é uma comparação campo op valor
+type streamCondition struct {
+	field string
+	op    string
+	raw   string
+	num   float64
+	isNum bool
+}
+
+// StreamFilter é uma expressão como "price > 50000 and qty >= 1": condições
+// ligadas por and (&&) e or (||), com and ligando mais forte. Cada grupo de
+// or é uma lista de condições ligadas por and.
+type StreamFilter struct {
+	groups [][]streamCondition
+}
+
+// ParseStreamFilter lê a expressão de ?filter=. Operadores: >, >=, <, <=,
+// = (ou ==) e !=; valores numéricos comparam como número (os preços em texto
+// da Binance também), os demais como texto, com ou sem aspas.
+func ParseStreamFilter(expr string) (*StreamFilter, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, nil
+	}
+	if len(expr) > maxStreamFilterLength {
+		return nil, fmt.Errorf("filtro com mais de %d caracteres", maxStreamFilterLength)
+	}
+	tokens, err := tokenizeStreamFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	f := &StreamFilter{}
+	var group []streamCondition
+	for i := 0; i < len(tokens); {
+		if i+3 > len(tokens) {
+			return nil, fmt.Errorf("condição incompleta perto de %q", strings.Join(tokens[i:], " "))
+		}
+		cond := streamCondition{field: tokens[i], op: tokens[i+1], raw: unquoteStreamValue(tokens[i+2])}
+		if cond.op == "==" {
+			cond.op = "="
+		}
+		switch cond.op {
+		case ">", ">=", "<", "<=", "=", "!=":
+		default:
+			return nil, fmt.Errorf("operador inválido %q (use >, >=, <, <=, = ou !=)", tokens[i+1])
+		}
+		if isStreamOperator(cond.field) || isStreamConnector(cond.field) {
+			return nil, fmt.Errorf("campo inválido %q", cond.field)
+		}
+		if n, err := strconv.ParseFloat(cond.raw, 64); err == nil && !math.IsNaN(n) {
+			cond.num, cond.isNum = n, true
+		} else if cond.op != "=" && cond.op != "!=" {
+			return nil, fmt.Errorf("%s %s exige um número", cond.field, cond.op)
+		}
+		group = append(group, cond)
+		i += 3
+		if i == len(tokens) {
+			break
+		}
+		switch strings.ToLower(tokens[i]) {
+		case "and", "&&":
+		case "or", "||":
+			f.groups = append(f.groups, group)
+			group = nil
+		default:
+			return nil, fmt.Errorf("esperado and/or, encontrado %q", tokens[i])
+		}
+		i++
+		if i == len(tokens) {
+			return nil, fmt.Errorf("expressão termina em %s", tokens[i-1])
+		}
+	}
+	f.groups = append(f.groups, group)
+	return f, nil
+}
+
+// tokenizeStreamFilter separa campos, operadores, valores (com aspas
+// simples ou duplas) e conectores
+func tokenizeStreamFilter(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+		switch {
+		case ch == ' ' || ch == '\t':
+			i++
+		case ch == '"' || ch == '\'':
+			end := strings.IndexByte(expr[i+1:], ch)
+			if end < 0 {
+				return nil, fmt.Errorf("aspas sem fechamento")
+			}
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		case strings.IndexByte("<>=!&|", ch) >= 0:
+			j := i + 1
+			for j < len(expr) && j-i < 2 && strings.IndexByte("=&|", expr[j]) >= 0 {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(expr) && strings.IndexByte(" \t<>=!&|\"'", expr[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func isStreamOperator(token string) bool {
+	switch token {
+	case ">", ">=", "<", "<=", "=", "==", "!=":
+		return true
+	}
+	return false
+}
+
+func isStreamConnector(token string) bool {
+	switch strings.ToLower(token) {
+	case "and", "&&", "or", "||":
+		return true
+	}
+	return false
+}
+
+func unquoteStreamValue(token string) string {
+	if len(token) >= 2 && (token[0] == '"' || token[0] == '\'') && token[len(token)-1] == token[0] {
+		return token[1 : len(token)-1]
+	}
+	return token
+}
+
+// match avalia o filtro sobre um evento decodificado
+func (f *StreamFilter) match(event map[string]interface{}) bool {
+	for _, group := range f.groups {
+		ok := true
+		for _, cond := range group {
+			if !cond.match(event) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *streamCondition) match(event map[string]interface{}) bool {
+	value, ok := event[c.field]
+	if !ok {
+		eventType, _ := event["e"].(string)
+		if alias, found := streamFilterAliases[eventType][c.field]; found {
+			value, ok = event[alias]
+		}
+	}
+	if !ok {
+		return false
+	}
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	case bool:
+		text = strconv.FormatBool(v)
+	default:
+		return false
+	}
+	if c.isNum {
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return c.op == "!="
+		}
+		switch c.op {
+		case ">":
+			return n > c.num
+		case ">=":
+			return n >= c.num
+		case "<":
+			return n < c.num
+		case "<=":
+			return n <= c.num
+		case "!=":
+			return n != c.num
+		}
+		return n == c.num
+	}
+	if c.op == "!=" {
+		return !strings.EqualFold(text, c.raw)
+	}
+	return strings.EqualFold(text, c.raw)
+}
+
+// Apply filtra o payload que seria enviado ao cliente. Um objeto passa
+// inteiro ou é descartado; de uma lista (ex: !miniTicker@arr) ficam só os
+// itens que casam, e a lista vazia é descartada. Snapshots (?snapshot=true)
+// são sempre enviados; nas atualizações, o filtro vale para data.
+func (f *StreamFilter) Apply(payload interface{}) (interface{}, bool) {
+	if update, ok := payload.(*streamUpdate); ok {
+		if update.Type == "snapshot" {
+			return update, true
+		}
+		data, ok := f.Apply(update.Data)
+		if !ok {
+			return nil, false
+		}
+		update.Data = data
+		return update, true
+	}
+	data, ok := payload.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, false
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, false
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return payload, f.match(v)
+	case []interface{}:
+		kept := make([]json.RawMessage, 0, len(v))
+		for _, item := range v {
+			if event, ok := item.(map[string]interface{}); ok && f.match(event) {
+				raw, _ := json.Marshal(event)
+				kept = append(kept, raw)
+			}
+		}
+		if len(kept) == 0 {
+			return nil, false
+		}
+		if len(kept) == len(v) {
+			return payload, true
+		}
+		return kept, true
+	}
+	return nil, false
+}
+
+// Wrap aplica o filtro depois da transformação do stream
+func (f *StreamFilter) Wrap(transform StreamTransform) StreamTransform {
+	return func(msg StreamMessage) (interface{}, bool) {
+		payload, ok := transform(msg)
+		if !ok {
+			return nil, false
+		}
+		return f.Apply(payload)
+	}
+}
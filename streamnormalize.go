@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Tipos dos campos no esquema normalizado
+const (
+	// Mantém o valor (texto, inteiro ou booleano)
+	normKeep = iota
+	// Texto decimal da Binance (preço, quantidade) vira número JSON, com os
+	// mesmos dígitos, sem passar por float64
+	normDecimal
+	// Lista de níveis [preço, quantidade] do depth
+	normLevels
+	// Objeto aninhado com o esquema do próprio tipo (ex: k do kline)
+	normNested
+)
+
+type normField struct {
+	name string
+	kind int
+}
+
+// streamSchemas dão nomes descritivos aos campos curtos de cada tipo de
+// evento da Binance (campo e). Campos fora do esquema são mantidos com o
+// nome original; os de nome vazio ("ignore" na documentação) são omitidos.
+var streamSchemas = map[string]map[string]normField{
+	"trade": {
+		"e": {"eventType", normKeep}, "E": {"eventTime", normKeep}, "s": {"symbol", normKeep},
+		"t": {"tradeId", normKeep}, "p": {"price", normDecimal}, "q": {"quantity", normDecimal},
+		"b": {"buyerOrderId", normKeep}, "a": {"sellerOrderId", normKeep},
+		"T": {"tradeTime", normKeep}, "m": {"buyerIsMaker", normKeep}, "M": {"", normKeep},
+	},
+	"aggTrade": {
+		"e": {"eventType", normKeep}, "E": {"eventTime", normKeep}, "s": {"symbol", normKeep},
+		"a": {"aggTradeId", normKeep}, "p": {"price", normDecimal}, "q": {"quantity", normDecimal},
+		"f": {"firstTradeId", normKeep}, "l": {"lastTradeId", normKeep},
+		"T": {"tradeTime", normKeep}, "m": {"buyerIsMaker", normKeep}, "M": {"", normKeep},
+	},
+	"24hrMiniTicker": {
+		"e": {"eventType", normKeep}, "E": {"eventTime", normKeep}, "s": {"symbol", normKeep},
+		"c": {"closePrice", normDecimal}, "o": {"openPrice", normDecimal},
+		"h": {"highPrice", normDecimal}, "l": {"lowPrice", normDecimal},
+		"v": {"volume", normDecimal}, "q": {"quoteVolume", normDecimal},
+	},
+	"24hrTicker": {
+		"e": {"eventType", normKeep}, "E": {"eventTime", normKeep}, "s": {"symbol", normKeep},
+		"p": {"priceChange", normDecimal}, "P": {"priceChangePercent", normDecimal},
+		"w": {"weightedAvgPrice", normDecimal}, "x": {"prevClosePrice", normDecimal},
+		"c": {"lastPrice", normDecimal}, "Q": {"lastQty", normDecimal},
+		"b": {"bidPrice", normDecimal}, "B": {"bidQty", normDecimal},
+		"a": {"askPrice", normDecimal}, "A": {"askQty", normDecimal},
+		"o": {"openPrice", normDecimal}, "h": {"highPrice", normDecimal}, "l": {"lowPrice", normDecimal},
+		"v": {"volume", normDecimal}, "q": {"quoteVolume", normDecimal},
+		"O": {"openTime", normKeep}, "C": {"closeTime", normKeep},
+		"F": {"firstTradeId", normKeep}, "L": {"lastTradeId", normKeep}, "n": {"tradeCount", normKeep},
+	},
+	"depthUpdate": {
+		"e": {"eventType", normKeep}, "E": {"eventTime", normKeep}, "s": {"symbol", normKeep},
+		"U": {"firstUpdateId", normKeep}, "u": {"finalUpdateId", normKeep},
+		"b": {"bids", normLevels}, "a": {"asks", normLevels},
+	},
+	"kline": {
+		"e": {"eventType", normKeep}, "E": {"eventTime", normKeep}, "s": {"symbol", normKeep},
+		"k": {"kline", normNested},
+	},
+	// Objeto k do evento kline
+	"kline.k": {
+		"t": {"openTime", normKeep}, "T": {"closeTime", normKeep}, "s": {"symbol", normKeep},
+		"i": {"interval", normKeep}, "f": {"firstTradeId", normKeep}, "L": {"lastTradeId", normKeep},
+		"o": {"openPrice", normDecimal}, "c": {"closePrice", normDecimal},
+		"h": {"highPrice", normDecimal}, "l": {"lowPrice", normDecimal},
+		"v": {"volume", normDecimal}, "n": {"tradeCount", normKeep}, "x": {"isClosed", normKeep},
+		"q": {"quoteVolume", normDecimal}, "V": {"takerBuyVolume", normDecimal},
+		"Q": {"takerBuyQuoteVolume", normDecimal}, "B": {"", normKeep},
+	},
+	// bookTicker não tem campo e
+	"bookTicker": {
+		"u": {"updateId", normKeep}, "s": {"symbol", normKeep},
+		"b": {"bidPrice", normDecimal}, "B": {"bidQty", normDecimal},
+		"a": {"askPrice", normDecimal}, "A": {"askQty", normDecimal},
+	},
+}
+
+// normalizeStreamPayload converte o payload de um stream (um evento ou uma
+// lista de eventos, como !miniTicker@arr) para o esquema normalizado.
+// Payloads que não são eventos da Binance conhecidos saem sem alteração; no
+// envelope de ?snapshot=true, o esquema vale para data.
+func normalizeStreamPayload(payload interface{}) (interface{}, bool) {
+	if update, ok := payload.(*streamUpdate); ok {
+		data, ok := normalizeStreamPayload(update.Data)
+		if !ok {
+			return nil, false
+		}
+		update.Data = data
+		return update, true
+	}
+	data, ok := payload.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, false
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, false
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if normalized, ok := normalizeStreamEvent(v); ok {
+			return normalized, true
+		}
+	case []interface{}:
+		changed := false
+		for i, item := range v {
+			if event, ok := item.(map[string]interface{}); ok {
+				if normalized, ok := normalizeStreamEvent(event); ok {
+					v[i] = normalized
+					changed = true
+				}
+			}
+		}
+		if changed {
+			return v, true
+		}
+	}
+	return payload, true
+}
+
+// normalizeStreamEvent aplica o esquema do tipo do evento; false se o tipo
+// não é conhecido
+func normalizeStreamEvent(event map[string]interface{}) (map[string]interface{}, bool) {
+	eventType, _ := event["e"].(string)
+	if eventType == "" && event["u"] != nil && event["b"] != nil && event["a"] != nil {
+		eventType = "bookTicker"
+	}
+	schema, ok := streamSchemas[eventType]
+	if !ok {
+		return nil, false
+	}
+	return applyStreamSchema(eventType, schema, event), true
+}
+
+func applyStreamSchema(schemaName string, schema map[string]normField, event map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(event))
+	for key, value := range event {
+		field, ok := schema[key]
+		if !ok {
+			out[key] = value
+			continue
+		}
+		if field.name == "" {
+			continue
+		}
+		switch field.kind {
+		case normDecimal:
+			value = decimalValue(value)
+		case normLevels:
+			if levels, ok := value.([]interface{}); ok {
+				for _, level := range levels {
+					if pair, ok := level.([]interface{}); ok {
+						for i := range pair {
+							pair[i] = decimalValue(pair[i])
+						}
+					}
+				}
+			}
+		case normNested:
+			if nested, ok := value.(map[string]interface{}); ok {
+				if inner, ok := streamSchemas[schemaName+"."+key]; ok {
+					value = applyStreamSchema(schemaName+"."+key, inner, nested)
+				}
+			}
+		}
+		out[field.name] = value
+	}
+	return out
+}
+
+// decimalValue converte o texto decimal em número JSON; outros valores
+// (ou texto que não é número) ficam como estão
+func decimalValue(value interface{}) interface{} {
+	text, ok := value.(string)
+	if !ok || text == "" || (text[0] != '-' && (text[0] < '0' || text[0] > '9')) || !json.Valid([]byte(text)) {
+		return value
+	}
+	return json.Number(text)
+}
+
+// normalizeStream aplica o esquema normalizado depois da transformação do stream
+func normalizeStream(transform StreamTransform) StreamTransform {
+	return func(msg StreamMessage) (interface{}, bool) {
+		payload, ok := transform(msg)
+		if !ok {
+			return nil, false
+		}
+		return normalizeStreamPayload(payload)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Maior multiplicador de ?speed= (speed=max dispensa a espera)
+	maxStreamReplaySpeed = 1000
+	// Maior linha aceita num arquivo de gravação (snapshots de depth grandes)
+	maxRecordedLine = 16 << 20
+	// Espera depois da última mensagem antes de encerrar o replay, para que
+	// a conflação (?maxRate=, no mínimo 1 por segundo) entregue o que juntou
+	streamReplayDrainGrace = time.Second
+)
+
+// streamReplayOptions são os parâmetros de ?replay=
+type streamReplayOptions struct {
+	recording *Recording
+	files     []RecordingFile
+	from, to  int64
+	// 0 = max: sem espera entre as mensagens
+	speed float64
+}
+
+// subscribeStreams assina os streams do cliente: ao vivo pelo hub ou, com
+// ?replay=<gravação>, a partir dos arquivos gravados, na mesma assinatura
+// servida por serveSubscription. Responde o erro e retorna false quando os
+// parâmetros do replay são inválidos.
+func (p *ProxyServer) subscribeStreams(c *gin.Context, streams ...string) (*Subscription, bool) {
+	if c.Query("replay") == "" {
+		return p.hub.SubscribeClient(streams...).Label(c.Request.URL.Path + " " + c.ClientIP()), true
+	}
+	opts, ok := p.parseStreamReplay(c, streams)
+	if !ok {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := newSubscription(func(*Subscription) { cancel() })
+	go replayStreams(ctx, opts, streams, sub)
+	return sub, true
+}
+
+// parseStreamReplay valida ?replay=, ?from=, ?to= e ?speed=
+func (p *ProxyServer) parseStreamReplay(c *gin.Context, streams []string) (*streamReplayOptions, bool) {
+	if p.recorder == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Gravação de streams desabilitada (RECORDINGS_FILE)")
+		return nil, false
+	}
+	if snapshot, _ := strconv.ParseBool(c.Query("snapshot")); snapshot {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'snapshot' não é suportado em replay")
+		return nil, false
+	}
+	recording, ok := p.recorder.byName[c.Query("replay")]
+	if !ok {
+		respondError(c, http.StatusNotFound, -1000, "Gravação não encontrada")
+		return nil, false
+	}
+	recorded := make(map[string]bool, len(recording.config.Streams))
+	for _, stream := range recording.config.Streams {
+		recorded[stream] = true
+	}
+	for _, stream := range streams {
+		if !recorded[stream] {
+			respondError(c, http.StatusNotFound, -1000, "A gravação "+recording.config.Name+" não contém o stream "+stream)
+			return nil, false
+		}
+	}
+
+	opts := &streamReplayOptions{recording: recording, from: 0, to: -1, speed: 1}
+	if raw := c.Query("from"); raw != "" {
+		if opts.from, ok = parseHistoryTime(raw); !ok {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'from' deve ser ms ou RFC3339")
+			return nil, false
+		}
+	}
+	if raw := c.Query("to"); raw != "" {
+		if opts.to, ok = parseHistoryTime(raw); !ok || opts.to < opts.from {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'to' deve ser ms ou RFC3339, depois de 'from'")
+			return nil, false
+		}
+	}
+	if speed, ok := parseStreamReplaySpeed(c.Query("speed")); ok {
+		opts.speed = speed
+	} else {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'speed' deve ser max ou um multiplicador de 0.1 a "+strconv.Itoa(maxStreamReplaySpeed)+" (ex: 1, 10x)")
+		return nil, false
+	}
+
+	files, err := recording.files()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao listar a gravação: "+err.Error())
+		return nil, false
+	}
+	for _, file := range files {
+		if file.End > opts.from && (opts.to < 0 || file.Start <= opts.to) {
+			opts.files = append(opts.files, file)
+		}
+	}
+	if len(opts.files) == 0 {
+		respondError(c, http.StatusNotFound, -1000, "Nenhum arquivo concluído da gravação no intervalo")
+		return nil, false
+	}
+	return opts, true
+}
+
+// parseStreamReplaySpeed lê ?speed=: max (0) ou um multiplicador, com ou sem x
+func parseStreamReplaySpeed(raw string) (float64, bool) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if raw == "" {
+		return 1, true
+	}
+	if raw == "max" {
+		return 0, true
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(raw, "x"), 64)
+	if err != nil || speed < 0.1 || speed > maxStreamReplaySpeed {
+		return 0, false
+	}
+	return speed, true
+}
+
+// replayStreams lê os arquivos em ordem e entrega as mensagens dos streams
+// na assinatura, com o relógio virtual: o intervalo entre duas mensagens é o
+// da gravação (receivedAt) dividido pela velocidade. O replay não descarta
+// mensagens: espera o cliente. No fim, encerra a assinatura.
+func replayStreams(ctx context.Context, opts *streamReplayOptions, streams []string, sub *Subscription) {
+	wanted := make(map[string]bool, len(streams))
+	for _, stream := range streams {
+		wanted[stream] = true
+	}
+	// Início do relógio virtual (primeira mensagem) e do real
+	var virtualStart int64 = -1
+	var wallStart time.Time
+
+	deliver := func(msg recordedMessage) bool {
+		if virtualStart < 0 {
+			virtualStart, wallStart = msg.ReceivedAt, time.Now()
+		} else if opts.speed > 0 {
+			elapsed := time.Duration(float64(msg.ReceivedAt-virtualStart)/opts.speed) * time.Millisecond
+			if wait := time.Until(wallStart.Add(elapsed)); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return false
+				case <-timer.C:
+				}
+			}
+		}
+		select {
+		case sub.ch <- StreamMessage{Stream: msg.Stream, Data: msg.Data}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for _, file := range opts.files {
+		done, ok := replayRecordedFile(filepath.Join(opts.recording.dir(), file.Name), func(msg recordedMessage) (bool, bool) {
+			if msg.ReceivedAt < opts.from || !wanted[msg.Stream] {
+				return true, false
+			}
+			if opts.to >= 0 && msg.ReceivedAt > opts.to {
+				return false, true
+			}
+			return deliver(msg), false
+		})
+		if !ok {
+			return
+		}
+		if done {
+			break
+		}
+	}
+
+	// Espera o cliente receber o que ficou no buffer antes de encerrar
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for len(sub.ch) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(streamReplayDrainGrace):
+	}
+	sub.finish(websocket.CloseNormalClosure, "replay finished")
+}
+
+// replayRecordedFile chama fn para cada linha do arquivo. fn retorna se continua e
+// se o intervalo terminou; replayRecordedFile retorna se terminou e false quando o
+// replay foi interrompido. Um arquivo ilegível é pulado.
+func replayRecordedFile(path string, fn func(msg recordedMessage) (bool, bool)) (bool, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, true
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return false, true
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordedLine)
+	for scanner.Scan() {
+		var msg recordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		next, done := fn(msg)
+		if done {
+			return true, true
+		}
+		if !next {
+			return false, false
+		}
+	}
+	return false, true
+}
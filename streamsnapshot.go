@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Mensagem colocada na assinatura pelo próprio handler para que o estado
+// atual seja enviado antes das atualizações do stream
+const streamSnapshotEvent = "snapshot"
+
+// streamUpdate é o envelope das mensagens com ?snapshot=true: a primeira é o
+// estado atual (type snapshot) e as seguintes as atualizações (type update),
+// com seq crescente por conexão. Um novo snapshot pode chegar no meio do
+// stream (depth fora de sequência) e substitui o estado do cliente.
+type streamUpdate struct {
+	Type string      `json:"type"`
+	Seq  uint64      `json:"seq"`
+	Data interface{} `json:"data"`
+}
+
+func newStreamSnapshot(data interface{}) *streamUpdate {
+	return &streamUpdate{Type: "snapshot", Data: data}
+}
+
+func newStreamUpdate(data interface{}) *streamUpdate {
+	return &streamUpdate{Type: "update", Data: data}
+}
+
+// wantsStreamSnapshot lê ?snapshot=, respondendo 400 quando inválido
+func wantsStreamSnapshot(c *gin.Context) (bool, bool) {
+	snapshot, err := strconv.ParseBool(c.DefaultQuery("snapshot", "false"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'snapshot' deve ser true ou false")
+		return false, false
+	}
+	return snapshot, true
+}
+
+// sequenceStream numera as mensagens com envelope na ordem em que saem para
+// o cliente, depois de filtros e normalização
+func sequenceStream(transform StreamTransform) StreamTransform {
+	var seq uint64
+	return func(msg StreamMessage) (interface{}, bool) {
+		payload, ok := transform(msg)
+		if !ok {
+			return nil, false
+		}
+		if update, ok := payload.(*streamUpdate); ok {
+			seq++
+			update.Seq = seq
+		}
+		return payload, true
+	}
+}
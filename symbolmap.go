@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// symbolMapFile é o formato de SYMBOL_MAP_FILE
+type symbolMapFile struct {
+	// Símbolo do cliente -> símbolo da Binance (ex: XBTUSD: BTCUSDT)
+	Symbols map[string]string `yaml:"symbols"`
+	// Ativo do cliente -> ativo da Binance (ex: USD: USDT, XBT: BTC)
+	Assets map[string]string `yaml:"assets"`
+}
+
+// SymbolMapper traduz símbolos no padrão de outras corretoras (BTC-USD,
+// XBT/USD) para o da Binance nos parâmetros de entrada, e de volta nas
+// respostas JSON
+type SymbolMapper struct {
+	market *MarketCache
+
+	mu      sync.RWMutex
+	symbols map[string]string
+	assets  map[string]string
+}
+
+// LoadSymbolMapper lê a tabela de tradução. Sem arquivo, apenas separadores
+// (-, /, _) são removidos.
+func LoadSymbolMapper(path string, market *MarketCache) (*SymbolMapper, error) {
+	m := &SymbolMapper{market: market, symbols: map[string]string{}, assets: map[string]string{}}
+	if path == "" {
+		return m, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	var file symbolMapFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return m, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+	for from, to := range file.Symbols {
+		m.symbols[symbolKey(from)] = strings.ToUpper(to)
+	}
+	for from, to := range file.Assets {
+		m.assets[strings.ToUpper(from)] = strings.ToUpper(to)
+	}
+	return m, nil
+}
+
+// Reload relê a tabela de tradução. Com erro, a tabela atual é mantida.
+func (m *SymbolMapper) Reload(path string) error {
+	fresh, err := LoadSymbolMapper(path, m.market)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.symbols, m.assets = fresh.symbols, fresh.assets
+	m.mu.Unlock()
+	return nil
+}
+
+// symbolKey normaliza um símbolo removendo separadores
+func symbolKey(symbol string) string {
+	return symbolSeparators.Replace(strings.ToUpper(strings.TrimSpace(symbol)))
+}
+
+var symbolSeparators = strings.NewReplacer("-", "", "/", "", "_", "")
+
+// Inbound converte o símbolo do cliente para o da Binance. Aliases de ativos
+// só são aplicados quando o símbolo original não existe na Binance e o
+// traduzido existe.
+func (m *SymbolMapper) Inbound(ctx context.Context, symbol string) string {
+	original := strings.ToUpper(strings.TrimSpace(symbol))
+	key := symbolKey(original)
+	m.mu.RLock()
+	symbols, assets := m.symbols, m.assets
+	m.mu.RUnlock()
+	if mapped, ok := symbols[key]; ok {
+		return mapped
+	}
+	if len(assets) == 0 {
+		return key
+	}
+
+	var base, quote string
+	if parts := strings.FieldsFunc(original, func(r rune) bool { return r == '-' || r == '/' || r == '_' }); len(parts) == 2 {
+		base, quote = parts[0], parts[1]
+	} else if b, q, ok := splitSymbol(key); ok {
+		base, quote = b, q
+	} else {
+		return key
+	}
+	if alias, ok := assets[base]; ok {
+		base = alias
+	}
+	if alias, ok := assets[quote]; ok {
+		quote = alias
+	}
+	if base+quote == key {
+		return key
+	}
+
+	info, err := m.market.ExchangeInfo(ctx)
+	if err != nil {
+		return key
+	}
+	if _, ok := info.Symbol(key); ok {
+		return key
+	}
+	if _, ok := info.Symbol(base + quote); ok {
+		return base + quote
+	}
+	return key
+}
+
+// jsonBufferWriter guarda respostas JSON para serem reescritas antes do envio
+// (tradução de símbolos, plugins). Outras respostas (SSE, NDJSON, binárias) e
+// conexões WebSocket passam direto.
+type jsonBufferWriter struct {
+	gin.ResponseWriter
+	status    int
+	decided   bool
+	buffering bool
+	buf       bytes.Buffer
+}
+
+func (w *jsonBufferWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	contentType := w.Header().Get("Content-Type")
+	w.buffering = strings.Contains(contentType, "json") && !strings.Contains(contentType, ndjsonContentType)
+	if !w.buffering {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *jsonBufferWriter) WriteHeader(code int) {
+	if !w.decided {
+		w.status = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *jsonBufferWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.buf.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *jsonBufferWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *jsonBufferWriter) Flush() {
+	w.decide()
+	if !w.buffering {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// rewriteQuerySymbols traduz symbol e symbols (lista JSON ou separada por
+// vírgula) e retorna a tradução inversa, Binance -> cliente
+func (m *SymbolMapper) rewriteQuerySymbols(c *gin.Context) map[string]string {
+	// Sem symbols e com symbol já no formato da Binance (o caso comum) não há
+	// o que traduzir: a query nem é decodificada
+	symbol, hasSymbol := rawQueryGet(c.Request.URL.RawQuery, "symbol")
+	if _, hasList := rawQueryGet(c.Request.URL.RawQuery, "symbols"); !hasList && (!hasSymbol || m.Inbound(c.Request.Context(), symbol) == symbol) {
+		return nil
+	}
+	query := c.Request.URL.Query()
+	reverse := map[string]string{}
+	if isSignedRequest(c) {
+		return reverse
+	}
+	translate := func(symbol string) string {
+		mapped := m.Inbound(c.Request.Context(), symbol)
+		if mapped != strings.ToUpper(strings.TrimSpace(symbol)) {
+			reverse[mapped] = strings.TrimSpace(symbol)
+		}
+		return mapped
+	}
+
+	if symbol := query.Get("symbol"); symbol != "" {
+		query.Set("symbol", translate(symbol))
+	}
+	if raw := query.Get("symbols"); raw != "" {
+		var list []string
+		isJSON := json.Unmarshal([]byte(raw), &list) == nil
+		if !isJSON {
+			list = strings.Split(raw, ",")
+		}
+		for i := range list {
+			list[i] = translate(list[i])
+		}
+		if isJSON {
+			encoded, _ := json.Marshal(list)
+			query.Set("symbols", string(encoded))
+		} else {
+			query.Set("symbols", strings.Join(list, ","))
+		}
+	}
+	if len(reverse) > 0 {
+		c.Request.URL.RawQuery = encodeQuery(c.Request.URL.RawQuery, query)
+	}
+	return reverse
+}
+
+// Middleware aplica a tradução de símbolos às rotas da Binance e locais. As
+// rotas multi-corretora (/<corretora>/*path) e as camadas de compatibilidade
+// (/compat/) têm conversão própria.
+func (m *SymbolMapper) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasSuffix(c.FullPath(), "/*path") || strings.HasPrefix(c.FullPath(), "/compat/") {
+			c.Next()
+			return
+		}
+		reverse := m.rewriteQuerySymbols(c)
+		if len(reverse) == 0 {
+			c.Next()
+			return
+		}
+
+		writer := &jsonBufferWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if !writer.decided {
+			writer.ResponseWriter.WriteHeader(writer.status)
+			return
+		}
+		if !writer.buffering {
+			return
+		}
+		body := writer.buf.Bytes()
+		for binance, client := range reverse {
+			quoted, _ := json.Marshal(client)
+			body = bytes.ReplaceAll(body, []byte(`"`+binance+`"`), quoted)
+		}
+		writer.Header().Del("Content-Length")
+		writer.ResponseWriter.WriteHeader(writer.status)
+		writer.ResponseWriter.Write(body)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSymbolSearchLimit = 20
+	maxSymbolSearchLimit     = 100
+)
+
+// SymbolFilterSummary são os filtros mais usados de um símbolo, já numéricos
+type SymbolFilterSummary struct {
+	TickSize    string `json:"tickSize"`
+	MinPrice    string `json:"minPrice"`
+	MaxPrice    string `json:"maxPrice"`
+	StepSize    string `json:"stepSize"`
+	MinQty      string `json:"minQty"`
+	MaxQty      string `json:"maxQty"`
+	MinNotional string `json:"minNotional"`
+	MaxNotional string `json:"maxNotional,omitempty"`
+}
+
+// SymbolSummary é a descrição compacta de um símbolo do exchangeInfo
+type SymbolSummary struct {
+	Symbol             string              `json:"symbol"`
+	Status             string              `json:"status"`
+	BaseAsset          string              `json:"baseAsset"`
+	QuoteAsset         string              `json:"quoteAsset"`
+	BaseAssetPrecision int                 `json:"baseAssetPrecision"`
+	QuotePrecision     int                 `json:"quotePrecision"`
+	OrderTypes         []string            `json:"orderTypes"`
+	Permissions        []string            `json:"permissions"`
+	Filters            SymbolFilterSummary `json:"filters"`
+	Score              int                 `json:"score,omitempty"`
+}
+
+// symbolPermissions junta permissions e permissionSets (formato novo da
+// Binance, em que permissions costuma vir vazio)
+func symbolPermissions(s *SymbolInfo) []string {
+	seen := map[string]bool{}
+	permissions := []string{}
+	add := func(p string) {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			permissions = append(permissions, p)
+		}
+	}
+	for _, p := range s.Permissions {
+		add(p)
+	}
+	for _, set := range s.PermissionSets {
+		for _, p := range set {
+			add(p)
+		}
+	}
+	if len(permissions) == 0 && s.IsSpotAllowed {
+		add("SPOT")
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+func newSymbolSummary(s *SymbolInfo) SymbolSummary {
+	f := s.ParsedFilters()
+	summary := SymbolSummary{
+		Symbol:             s.Symbol,
+		Status:             s.Status,
+		BaseAsset:          s.BaseAsset,
+		QuoteAsset:         s.QuoteAsset,
+		BaseAssetPrecision: s.BaseAssetPrecision,
+		QuotePrecision:     s.QuotePrecision,
+		OrderTypes:         s.OrderTypes,
+		Permissions:        symbolPermissions(s),
+		Filters: SymbolFilterSummary{
+			TickSize:    formatFloat(f.TickSize),
+			MinPrice:    formatFloat(f.MinPrice),
+			MaxPrice:    formatFloat(f.MaxPrice),
+			StepSize:    formatFloat(f.StepSize),
+			MinQty:      formatFloat(f.MinQty),
+			MaxQty:      formatFloat(f.MaxQty),
+			MinNotional: formatFloat(f.MinNotional),
+		},
+	}
+	if summary.OrderTypes == nil {
+		summary.OrderTypes = []string{}
+	}
+	if f.MaxNotional > 0 {
+		summary.Filters.MaxNotional = formatFloat(f.MaxNotional)
+	}
+	return summary
+}
+
+// fuzzyScore pontua o quanto o símbolo corresponde à busca; 0 = sem relação.
+// Correspondências exatas e prefixos valem mais que subsequências.
+func fuzzyScore(s *SymbolInfo, q string) int {
+	switch {
+	case s.Symbol == q:
+		return 100
+	case s.BaseAsset == q:
+		return 90
+	case strings.HasPrefix(s.Symbol, q):
+		return 80
+	case strings.HasPrefix(s.BaseAsset, q):
+		return 70
+	case s.QuoteAsset == q:
+		return 50
+	case strings.Contains(s.Symbol, q):
+		return 40
+	}
+
+	// Subsequência (ex: "btut" em BTCUSDT), penalizando os saltos
+	gaps, j := 0, 0
+	for i := 0; i < len(s.Symbol) && j < len(q); i++ {
+		if s.Symbol[i] == q[j] {
+			j++
+		} else if j > 0 {
+			gaps++
+		}
+	}
+	if j < len(q) {
+		return 0
+	}
+	return max(1, 30-gaps*3)
+}
+
+// SymbolSearch busca símbolos no exchangeInfo em cache
+// @Summary Busca de símbolos
+// @Description Busca aproximada (prefixo, trecho ou subsequência) sobre o exchangeInfo em cache, retornando ativos, status, filtros e permissões. Pensada para autocomplete.
+// @Tags Market Data
+// @Produce json
+// @Param q query string true "Texto da busca (ex: sol)"
+// @Param quoteAsset query string false "Filtrar pelo ativo de cotação"
+// @Param status query string false "Filtrar pelo status (ex: TRADING)"
+// @Param limit query int false "Máximo de resultados (padrão 20, máx. 100)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /symbols/search [get]
+func (p *ProxyServer) SymbolSearch(c *gin.Context) {
+	q := symbolKey(c.Query("q"))
+	if q == "" {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetro obrigatório 'q' ausente")
+		return
+	}
+	limit := defaultSymbolSearchLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, -1100, "limit inválido")
+			return
+		}
+		limit = min(n, maxSymbolSearchLimit)
+	}
+	quoteAsset := strings.ToUpper(c.Query("quoteAsset"))
+	status := strings.ToUpper(c.Query("status"))
+
+	info, err := p.market.ExchangeInfo(c.Request.Context())
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	results := []SymbolSummary{}
+	for i := range info.Symbols {
+		s := &info.Symbols[i]
+		if (quoteAsset != "" && s.QuoteAsset != quoteAsset) || (status != "" && s.Status != status) {
+			continue
+		}
+		if score := fuzzyScore(s, q); score > 0 {
+			summary := newSymbolSummary(s)
+			summary.Score = score
+			results = append(results, summary)
+		}
+	}
+	// Maior pontuação primeiro; em empate, símbolos em negociação e ordem alfabética
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if (a.Status == "TRADING") != (b.Status == "TRADING") {
+			return a.Status == "TRADING"
+		}
+		return a.Symbol < b.Symbol
+	})
+	total := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   q,
+		"total":   total,
+		"symbols": results,
+	})
+}
+
+// queryList lê um parâmetro com valores separados por vírgula (ou lista JSON,
+// como em symbols=["BTCUSDT"]), em maiúsculas
+func queryList(c *gin.Context, key string) map[string]bool {
+	values := map[string]bool{}
+	for _, raw := range c.QueryArray(key) {
+		for _, v := range strings.Split(strings.Trim(raw, "[]"), ",") {
+			if v = strings.ToUpper(strings.Trim(strings.TrimSpace(v), `"`)); v != "" {
+				values[v] = true
+			}
+		}
+	}
+	return values
+}
+
+// LocalExchangeInfo retorna o exchangeInfo em cache filtrado no servidor
+// @Summary exchangeInfo filtrado
+// @Description Filtra o exchangeInfo em cache por status, ativos, permissão e símbolos, retornando uma lista compacta. Os filtros aceitam vários valores separados por vírgula.
+// @Tags Market Data
+// @Produce json
+// @Param status query string false "Status (ex: TRADING)"
+// @Param quoteAsset query string false "Ativo de cotação (ex: USDT)"
+// @Param baseAsset query string false "Ativo base (ex: BTC)"
+// @Param permission query string false "Permissão (ex: SPOT)"
+// @Param symbols query string false "Símbolos (ex: BTCUSDT,ETHUSDT)"
+// @Success 200 {object} map[string]interface{}
+// @Router /local/exchangeInfo [get]
+func (p *ProxyServer) LocalExchangeInfo(c *gin.Context) {
+	statuses := queryList(c, "status")
+	quotes := queryList(c, "quoteAsset")
+	bases := queryList(c, "baseAsset")
+	permissions := queryList(c, "permission")
+	symbols := queryList(c, "symbols")
+
+	info, err := p.market.ExchangeInfo(c.Request.Context())
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	matches := func(filter map[string]bool, value string) bool {
+		return len(filter) == 0 || filter[value]
+	}
+	results := []SymbolSummary{}
+	for i := range info.Symbols {
+		s := &info.Symbols[i]
+		if !matches(statuses, s.Status) || !matches(quotes, s.QuoteAsset) || !matches(bases, s.BaseAsset) || !matches(symbols, s.Symbol) {
+			continue
+		}
+		summary := newSymbolSummary(s)
+		if len(permissions) > 0 {
+			allowed := false
+			for _, p := range summary.Permissions {
+				allowed = allowed || permissions[p]
+			}
+			if !allowed {
+				continue
+			}
+		}
+		results = append(results, summary)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Symbol < results[j].Symbol })
+
+	c.JSON(http.StatusOK, gin.H{
+		"timezone":   info.Timezone,
+		"serverTime": info.ServerTime,
+		"count":      len(results),
+		"symbols":    results,
+	})
+}
+
+// roundedValue descreve um valor antes e depois do arredondamento
+type roundedValue struct {
+	Input    string `json:"input"`
+	Rounded  string `json:"rounded"`
+	Step     string `json:"step"`
+	Adjusted bool   `json:"adjusted"`
+}
+
+// LocalRound arredonda preço e quantidade para os filtros do símbolo
+// @Summary Arredondamento por filtros
+// @Description Arredonda price para o tickSize e qty para o stepSize do símbolo (exchangeInfo em cache) e aponta violações de minQty, maxQty, minPrice e minNotional com os valores já arredondados. Sem price, o nocional usa o último preço.
+// @Tags Market Data
+// @Produce json
+// @Param symbol query string true "Símbolo (ex: BTCUSDT)"
+// @Param price query number false "Preço"
+// @Param qty query number false "Quantidade"
+// @Param type query string false "LIMIT ou MARKET (padrão: LIMIT com price, MARKET sem)"
+// @Param mode query string false "down (padrão), up ou nearest"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /local/round [get]
+func (p *ProxyServer) LocalRound(c *gin.Context) {
+	symbol := strings.ToUpper(c.Query("symbol"))
+	if symbol == "" {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetro obrigatório 'symbol' ausente")
+		return
+	}
+	mode := strings.ToLower(c.DefaultQuery("mode", "down"))
+	if mode != "down" && mode != "up" && mode != "nearest" {
+		respondError(c, http.StatusBadRequest, -1100, "mode deve ser down, up ou nearest")
+		return
+	}
+
+	parse := func(name string) (float64, bool) {
+		raw := c.Query(name)
+		if raw == "" {
+			return 0, true
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value < 0 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro '"+name+"' inválido")
+			return 0, false
+		}
+		return value, true
+	}
+	price, ok := parse("price")
+	if !ok {
+		return
+	}
+	qty, ok := parse("qty")
+	if !ok {
+		return
+	}
+	if price == 0 && qty == 0 {
+		respondError(c, http.StatusBadRequest, -1102, "Informe 'price' e/ou 'qty'")
+		return
+	}
+	orderType := strings.ToUpper(c.Query("type"))
+	if orderType == "" {
+		orderType = "LIMIT"
+		if price == 0 {
+			orderType = "MARKET"
+		}
+	}
+	if orderType != "LIMIT" && orderType != "MARKET" {
+		respondError(c, http.StatusBadRequest, -1100, "type deve ser LIMIT ou MARKET")
+		return
+	}
+	market := orderType == "MARKET"
+
+	ctx := c.Request.Context()
+	info, err := p.market.ExchangeInfo(ctx)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	symbolInfo, ok := info.Symbol(symbol)
+	if !ok {
+		respondError(c, http.StatusBadRequest, -1121, "Símbolo inválido: "+symbol)
+		return
+	}
+	f := symbolInfo.ParsedFilters()
+
+	result := gin.H{"symbol": symbol, "type": orderType, "mode": mode}
+	violations := []filterViolation{}
+	roundedPrice, roundedQty := 0.0, 0.0
+	if price > 0 {
+		roundedPrice = roundToStep(price, f.TickSize, mode)
+		result["price"] = roundedValue{
+			Input:    c.Query("price"),
+			Rounded:  formatStep(roundedPrice, f.TickSize),
+			Step:     formatFloat(f.TickSize),
+			Adjusted: math.Abs(roundedPrice-price) > 1e-12,
+		}
+		if !market {
+			violations = append(violations, f.checkPrice(roundedPrice)...)
+		}
+	}
+	if qty > 0 {
+		step := f.StepSize
+		if market && f.MarketStepSize > 0 {
+			step = f.MarketStepSize
+		}
+		roundedQty = roundToStep(qty, step, mode)
+		result["qty"] = roundedValue{
+			Input:    c.Query("qty"),
+			Rounded:  formatStep(roundedQty, step),
+			Step:     formatFloat(step),
+			Adjusted: math.Abs(roundedQty-qty) > 1e-12,
+		}
+		violations = append(violations, f.checkQuantity(roundedQty, market)...)
+
+		// Sem preço (ordem a mercado), o nocional é estimado pelo último preço
+		notionalPrice, source := roundedPrice, "price"
+		if notionalPrice == 0 {
+			if prices, err := p.market.Prices(ctx); err == nil {
+				notionalPrice, source = prices[symbol], "lastPrice"
+			}
+		}
+		if notionalPrice > 0 {
+			notional := roundedQty * notionalPrice
+			result["notional"] = formatFloat(notional)
+			result["notionalPriceSource"] = source
+			violations = append(violations, f.checkNotional(notional, market)...)
+		}
+	}
+
+	result["valid"] = len(violations) == 0
+	result["filterViolations"] = violations
+	c.JSON(http.StatusOK, result)
+}
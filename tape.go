@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTapeRetention   = 15 * time.Minute
+	defaultTapeIdleTimeout = 5 * time.Minute
+	defaultTapeWindow      = time.Minute
+	defaultTapeBucket      = time.Second
+	// Trades recentes buscados em /aggTrades ao abrir a fita de um símbolo
+	tapeSeedLimit = 1000
+)
+
+// tapeSecond acumula os trades de um segundo
+type tapeSecond struct {
+	second      int64
+	trades      int
+	volume      float64
+	quoteVolume float64
+	buyVolume   float64
+}
+
+// TapeAggregator agrega em memória o stream aggTrade dos símbolos
+// consultados em segundos, guardando TAPE_RETENTION de histórico. Fitas sem
+// consultas por TAPE_IDLE_TIMEOUT são encerradas.
+type TapeAggregator struct {
+	proxy     *ProxyServer
+	retention time.Duration
+	idle      time.Duration
+
+	mu    sync.Mutex
+	tapes map[string]*symbolTape
+}
+
+// symbolTape é a fita de um símbolo: um anel de segundos indexado por
+// segundo Unix
+type symbolTape struct {
+	symbol string
+	// Protegido por TapeAggregator.mu
+	lastUsed time.Time
+
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	mu      sync.Mutex
+	seconds []tapeSecond
+	// Trades anteriores a coveredFrom (ms) podem estar faltando
+	coveredFrom int64
+	// Último aggTrade carregado pelo REST, para descartar repetidos do stream
+	seedLastID int64
+}
+
+func NewTapeAggregator(proxy *ProxyServer) *TapeAggregator {
+	return &TapeAggregator{
+		proxy:     proxy,
+		retention: max(getEnvDuration("TAPE_RETENTION", defaultTapeRetention), time.Minute),
+		idle:      getEnvDuration("TAPE_IDLE_TIMEOUT", defaultTapeIdleTimeout),
+		tapes:     make(map[string]*symbolTape),
+	}
+}
+
+// Get retorna a fita do símbolo, iniciando-a no primeiro uso
+func (a *TapeAggregator) Get(symbol string) *symbolTape {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tape, ok := a.tapes[symbol]
+	if !ok {
+		tape = &symbolTape{
+			symbol:  symbol,
+			ready:   make(chan struct{}),
+			seconds: make([]tapeSecond, int(a.retention/time.Second)),
+		}
+		a.tapes[symbol] = tape
+		go a.run(tape)
+	}
+	tape.lastUsed = time.Now()
+	return tape
+}
+
+func (a *TapeAggregator) releaseIfIdle(tape *symbolTape) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if time.Since(tape.lastUsed) < a.idle {
+		return false
+	}
+	delete(a.tapes, tape.symbol)
+	return true
+}
+
+// run assina o stream aggTrade, carrega os trades recentes pelo REST e
+// agrega os eventos até a fita ficar sem uso
+func (a *TapeAggregator) run(tape *symbolTape) {
+	sub := a.proxy.hub.Subscribe(strings.ToLower(tape.symbol) + "@aggTrade").Label("tape")
+	defer sub.Close()
+
+	// Eventos que chegarem durante o carregamento ficam no buffer da
+	// assinatura; os que já vieram no REST são descartados por id
+	a.seed(tape)
+	tape.readyOnce.Do(func() { close(tape.ready) })
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if a.releaseIfIdle(tape) {
+				return
+			}
+		case msg := <-sub.C:
+			var event aggTradeEvent
+			if err := json.Unmarshal(msg.Data, &event); err != nil {
+				continue
+			}
+			tape.mu.Lock()
+			if event.AggTradeID > tape.seedLastID {
+				tape.addLocked(event)
+			}
+			tape.mu.Unlock()
+		}
+	}
+}
+
+// seed preenche a fita com os últimos trades de /aggTrades. Se eles não
+// cobrem toda a retenção, coveredFrom marca o início dos dados completos.
+func (a *TapeAggregator) seed(tape *symbolTape) {
+	now := time.Now()
+	tape.mu.Lock()
+	tape.coveredFrom = now.UnixMilli()
+	tape.mu.Unlock()
+
+	query := url.Values{"symbol": {tape.symbol}, "limit": {strconv.Itoa(tapeSeedLimit)}}
+	data, err := a.proxy.fetchUpstream(context.Background(), "/aggTrades", query)
+	if err != nil {
+		return
+	}
+	var events []aggTradeEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return
+	}
+
+	tape.mu.Lock()
+	defer tape.mu.Unlock()
+	tape.coveredFrom = now.Add(-a.retention).UnixMilli()
+	if len(events) == tapeSeedLimit {
+		tape.coveredFrom = max(tape.coveredFrom, events[0].TradeTime)
+	}
+	for _, event := range events {
+		tape.addLocked(event)
+		tape.seedLastID = max(tape.seedLastID, event.AggTradeID)
+	}
+}
+
+// addLocked soma o trade no seu segundo. Requer tape.mu.
+func (t *symbolTape) addLocked(event aggTradeEvent) {
+	price, errPrice := strconv.ParseFloat(event.Price, 64)
+	qty, errQty := strconv.ParseFloat(event.Quantity, 64)
+	if errPrice != nil || errQty != nil {
+		return
+	}
+	second := event.TradeTime / 1000
+	if second <= time.Now().Unix()-int64(len(t.seconds)) {
+		return
+	}
+	slot := &t.seconds[second%int64(len(t.seconds))]
+	if slot.second != second {
+		*slot = tapeSecond{second: second}
+	}
+	slot.trades++
+	slot.volume += qty
+	slot.quoteVolume += price * qty
+	// Comprador maker: o agressor foi a venda
+	if !event.BuyerIsMaker {
+		slot.buyVolume += qty
+	}
+}
+
+// tapeBucket é um intervalo agregado da fita
+type tapeBucket struct {
+	Time        int64    `json:"time"`
+	Trades      int      `json:"trades"`
+	Volume      string   `json:"volume"`
+	QuoteVolume string   `json:"quoteVolume"`
+	BuyVolume   string   `json:"buyVolume"`
+	SellVolume  string   `json:"sellVolume"`
+	BuyRatio    *float64 `json:"buyRatio,omitempty"`
+}
+
+// tapeResponse é a resposta de /local/tape/{symbol}
+type tapeResponse struct {
+	Symbol      string       `json:"symbol"`
+	Window      string       `json:"window"`
+	Bucket      string       `json:"bucket"`
+	From        int64        `json:"from"`
+	To          int64        `json:"to"`
+	CoveredFrom int64        `json:"coveredFrom"`
+	Buckets     []tapeBucket `json:"buckets"`
+}
+
+// Aggregate reagrupa os segundos da janela em buckets alinhados ao tamanho
+// do bucket, do mais antigo ao mais recente (o último pode estar em andamento)
+func (t *symbolTape) Aggregate(window, bucket time.Duration) *tapeResponse {
+	bucketSeconds := int64(bucket / time.Second)
+	last := time.Now().Unix() / bucketSeconds * bucketSeconds
+	first := last - int64(window/time.Second) + bucketSeconds
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := &tapeResponse{
+		Symbol:      t.symbol,
+		Window:      window.String(),
+		Bucket:      bucket.String(),
+		From:        first * 1000,
+		To:          (last+bucketSeconds)*1000 - 1,
+		CoveredFrom: t.coveredFrom,
+	}
+	for start := first; start <= last; start += bucketSeconds {
+		var sum tapeSecond
+		for second := start; second < start+bucketSeconds; second++ {
+			slot := t.seconds[second%int64(len(t.seconds))]
+			if slot.second != second {
+				continue
+			}
+			sum.trades += slot.trades
+			sum.volume += slot.volume
+			sum.quoteVolume += slot.quoteVolume
+			sum.buyVolume += slot.buyVolume
+		}
+		item := tapeBucket{
+			Time:        start * 1000,
+			Trades:      sum.trades,
+			Volume:      formatFloat(sum.volume),
+			QuoteVolume: formatFloat(sum.quoteVolume),
+			BuyVolume:   formatFloat(sum.buyVolume),
+			SellVolume:  formatFloat(sum.volume - sum.buyVolume),
+		}
+		if sum.volume > 0 {
+			ratio := sum.buyVolume / sum.volume
+			item.BuyRatio = &ratio
+		}
+		result.Buckets = append(result.Buckets, item)
+	}
+	return result
+}
+
+// LocalTape agrega os trades recentes do símbolo em buckets
+// @Summary Fita de trades agregada
+// @Description Agrega em memória o stream aggTrade em buckets (trades, volume, volume comprador/vendedor e proporção de compra) para heatmaps e leitura de fita
+// @Tags Market Data
+// @Produce json
+// @Param symbol path string true "Símbolo (ex: BTCUSDT)"
+// @Param window query string false "Janela (ex: 1m, 5m; máx. TAPE_RETENTION)"
+// @Param bucket query string false "Tamanho do bucket (ex: 1s, 5s)"
+// @Success 200 {object} tapeResponse
+// @Failure 400 {object} map[string]interface{}
+// @Router /local/tape/{symbol} [get]
+func (p *ProxyServer) LocalTape(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+
+	window, bucket := defaultTapeWindow, defaultTapeBucket
+	if raw := c.Query("window"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < time.Second || parsed > p.tape.retention {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'window' deve ser uma duração entre 1s e "+p.tape.retention.String())
+			return
+		}
+		window = parsed
+	}
+	if raw := c.Query("bucket"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < time.Second || parsed%time.Second != 0 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'bucket' deve ser uma duração em segundos inteiros (ex: 1s, 5s, 1m)")
+			return
+		}
+		bucket = parsed
+	}
+	if window < bucket || window%bucket != 0 {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'window' deve ser um múltiplo de 'bucket'")
+		return
+	}
+	if !p.requireKnownSymbol(c, symbol) {
+		return
+	}
+
+	tape := p.tape.Get(symbol)
+	timer := time.NewTimer(localBookReadyWait)
+	defer timer.Stop()
+	select {
+	case <-tape.ready:
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+	c.JSON(http.StatusOK, tape.Aggregate(window, bucket))
+}
+
+// LocalTapeStream envia os trades do símbolo via WebSocket ou SSE
+// @Summary Stream de trades
+// @Description Eventos do stream <symbol>@aggTrade da Binance, sem alteração. Com filter (ex: qty >= 1), só os trades que casam com a expressão são enviados.
+// @Tags Market Data
+// @Produce text/event-stream
+// @Param symbol path string true "Símbolo (ex: BTCUSDT)"
+// @Param filter query string false "Filtro avaliado a cada trade (ex: price > 50000 and qty >= 1)"
+// @Param maxRate query integer false "Máximo de mensagens por segundo (1 a 1000), com conflação"
+// @Param normalize query bool false "Nomes descritivos e números no lugar dos campos curtos da Binance"
+// @Param replay query string false "Gravação (RECORDINGS_FILE) reproduzida no lugar do stream ao vivo"
+// @Param speed query string false "Velocidade do replay (ex: 1, 10x, max)"
+// @Router /local/tape/{symbol}/stream [get]
+func (p *ProxyServer) LocalTapeStream(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+	if !p.requireKnownSymbol(c, symbol) {
+		return
+	}
+
+	sub, ok := p.subscribeStreams(c, strings.ToLower(symbol)+"@aggTrade")
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	p.serveSubscription(c, sub, func(msg StreamMessage) (interface{}, bool) {
+		return msg.Data, true
+	})
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultRecvWindow = 5000
+
+// Tenant é um cliente do proxy com credenciais próprias da Binance.
+// O cliente se autentica no proxy com Token e o proxy assina as chamadas
+// à Binance com APIKey/SecretKey, que nunca saem do servidor.
+type Tenant struct {
+	Name      string `yaml:"name"`
+	Token     string `yaml:"token"`
+	APIKey    string `yaml:"api_key"`
+	SecretKey string `yaml:"secret_key"`
+	// Prioridade padrão das chamadas do tenant (low, normal, high)
+	Priority string `yaml:"priority"`
+
+	// Credenciais em outras corretoras, por nome (bybit, coinbase, binanceus)
+	Exchanges map[string]ExchangeCredentials `yaml:"exchanges"`
+	// Segredo da autenticação HMAC do cliente (X-Proxy-Signature); com
+	// require_signature, o token sozinho deixa de ser aceito
+	ClientSecret     string `yaml:"client_secret"`
+	RequireSignature bool   `yaml:"require_signature"`
+	// Símbolos e endpoints permitidos nas chamadas assinadas (sem política,
+	// tudo é permitido)
+	Policy *TenantPolicy `yaml:"policy"`
+
+	// Cache das taxas de negociação do tenant por símbolo
+	feesMu sync.Mutex
+	fees   map[string]tradeFee
+}
+
+type tenantsFile struct {
+	Tenants []*Tenant `yaml:"tenants"`
+}
+
+// TenantRegistry indexa os tenants configurados pelo token de acesso: os do
+// arquivo TENANTS_FILE e os do cofre cifrado (API admin)
+type TenantRegistry struct {
+	mu      sync.RWMutex
+	tenants []*Tenant
+	path    string
+	box     *SecretBox
+	vault   *TenantVault
+}
+
+// LoadTenants lê o arquivo YAML de tenants. Um caminho vazio resulta em um
+// registro sem tenants (endpoints assinados ficam indisponíveis). Credenciais
+// no formato enc:v1:... são decifradas em memória com box.
+func LoadTenants(path string, box *SecretBox) (*TenantRegistry, error) {
+	registry := &TenantRegistry{path: path, box: box}
+	tenants, err := readTenantsFile(path, box)
+	registry.tenants = tenants
+	return registry, err
+}
+
+func readTenantsFile(path string, box *SecretBox) ([]*Tenant, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file tenantsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+	for _, t := range file.Tenants {
+		if err := prepareTenant(t, box); err != nil {
+			return nil, fmt.Errorf("%w em %s", err, path)
+		}
+	}
+	return file.Tenants, nil
+}
+
+// prepareTenant decifra as credenciais, confere os campos obrigatórios e
+// compila a política do tenant
+func prepareTenant(t *Tenant, box *SecretBox) error {
+	if err := box.openTenant(t); err != nil {
+		return fmt.Errorf("tenant %s: %w", t.Name, err)
+	}
+	if t.Name == "" || t.Token == "" || t.APIKey == "" || t.SecretKey == "" {
+		return fmt.Errorf("tenant incompleto: name, token, api_key e secret_key são obrigatórios")
+	}
+	if t.Policy != nil {
+		if err := t.Policy.compile(); err != nil {
+			return fmt.Errorf("política do tenant %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// SetVault liga o cofre de tenants e carrega os tenants dele
+func (r *TenantRegistry) SetVault(vault *TenantVault) error {
+	r.mu.Lock()
+	r.vault = vault
+	r.mu.Unlock()
+	return r.Refresh()
+}
+
+// Reload relê o arquivo de tenants e o cofre e troca a lista inteira. Com
+// erro, a lista atual é mantida. Tenants do arquivo têm precedência sobre
+// os do cofre com o mesmo nome.
+func (r *TenantRegistry) Reload(path string) error {
+	tenants, err := readTenantsFile(path, r.box)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	vault := r.vault
+	r.mu.RUnlock()
+	vaulted, err := vault.Tenants()
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, t := range tenants {
+		names[t.Name] = true
+	}
+	for _, t := range vaulted {
+		if names[t.Name] {
+			// log.Printf("[WARN] Tenant %s do cofre ignorado: já definido em %s", t.Name, path)
+			continue
+		}
+		if err := prepareTenant(t, r.box); err != nil {
+			return fmt.Errorf("%w no cofre", err)
+		}
+		tenants = append(tenants, t)
+	}
+	r.mu.Lock()
+	r.path = path
+	r.tenants = tenants
+	r.mu.Unlock()
+	return nil
+}
+
+// Refresh recarrega o arquivo atual e o cofre
+func (r *TenantRegistry) Refresh() error {
+	r.mu.RLock()
+	path := r.path
+	r.mu.RUnlock()
+	return r.Reload(path)
+}
+
+// Lookup retorna o tenant dono do token, comparando em tempo constante
+func (r *TenantRegistry) Lookup(token string) *Tenant {
+	if r == nil || token == "" {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range r.tenants {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return t
+		}
+	}
+	return nil
+}
+
+// ByName retorna o tenant pelo nome configurado
+func (r *TenantRegistry) ByName(name string) *Tenant {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range r.tenants {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Names lista os nomes dos tenants configurados
+func (r *TenantRegistry) Names() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// tenantToken extrai o token do cliente (X-Proxy-Token ou Authorization: Bearer)
+func tenantToken(r *http.Request) string {
+	if token := r.Header.Get("X-Proxy-Token"); token != "" {
+		return token
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+// consumerName é o nome do tenant dono do token da requisição, ou anonymous
+func (p *ProxyServer) consumerName(r *http.Request) string {
+	if tenant := p.requestTenant(r); tenant != nil {
+		return tenant.Name
+	}
+	return consumerAnonymous
+}
+
+// requireTenant autentica o cliente, respondendo 401 quando o token é inválido
+func (p *ProxyServer) requireTenant(c *gin.Context) (*Tenant, bool) {
+	tenant := p.requestTenant(c.Request)
+	if tenant == nil {
+		respondError(c, http.StatusUnauthorized, -2015, "Token de tenant inválido ou ausente")
+		return nil, false
+	}
+	return tenant, true
+}
+
+// apiRoot retorna a raiz do host da Binance (sem /api/v3), usada para
+// endpoints fora da API spot v3, como /sapi
+func (p *ProxyServer) apiRoot() string {
+	return strings.TrimSuffix(strings.TrimSuffix(p.binanceURL, "/"), "/api/v3")
+}
+
+// sign calcula a assinatura HMAC-SHA256 do payload com a chave secreta do tenant
+func (t *Tenant) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(t.SecretKey))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedRequest faz uma chamada assinada (SIGNED) à Binance em nome do tenant.
+// path é relativo à raiz do host (ex: /api/v3/account, /sapi/v1/asset/tradeFee).
+func (p *ProxyServer) signedRequest(ctx context.Context, tenant *Tenant, method, path string, params url.Values) ([]byte, error) {
+	if err := tenant.Policy.Allow(method, path, querySymbols(params)); err != nil {
+		// log.Printf("[WARN] Chamada de %s recusada pela política: %v", tenant.Name, err)
+		return nil, policyError(err)
+	}
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = append([]string(nil), values...)
+	}
+	query.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	if query.Get("recvWindow") == "" {
+		query.Set("recvWindow", strconv.Itoa(defaultRecvWindow))
+	}
+	payload := query.Encode()
+	payload += "&signature=" + tenant.sign(payload)
+
+	req, err := http.NewRequestWithContext(ctx, method, p.apiRoot()+path+"?"+payload, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-MBX-APIKEY", tenant.APIKey)
+	req.Header.Set("User-Agent", "Binance-Proxy/1.0")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &UpstreamError{StatusCode: resp.StatusCode, Body: body}
+	}
+	return body, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTopLimit = 10
+	maxTopLimit     = 100
+	// Sem quote, os rankings usam só os pares em USDT: volumes e variações de
+	// cotações diferentes não são comparáveis
+	defaultTopQuote = "USDT"
+)
+
+// topRankings são as listas de /local/top: o campo de ordenação, se é
+// decrescente e a condição que o símbolo precisa cumprir para entrar
+var topRankings = map[string]struct {
+	field  string
+	desc   bool
+	filter string
+}{
+	"gainers": {field: "change24h", desc: true, filter: ">0"},
+	"losers":  {field: "change24h", desc: false, filter: "<0"},
+	"volume":  {field: "volume", desc: true},
+}
+
+// TopSymbols retorna as maiores altas, as maiores baixas ou os maiores volumes de 24h
+// @Summary Maiores altas, baixas e volumes
+// @Description Rankings de 24h calculados sobre o ticker em cache: gainers (só variação positiva), losers (só negativa) e volume (no ativo de cotação). Aceitam os mesmos filtros do /screener, como minVolume.
+// @Tags Market Data
+// @Produce json
+// @Param quote query string false "Ativos de cotação (padrão: USDT; all = todos)"
+// @Param limit query int false "Quantidade de símbolos (padrão: 10, máximo: 100)"
+// @Param minVolume query number false "Volume mínimo de 24h no ativo de cotação"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /local/top/gainers [get]
+// @Router /local/top/losers [get]
+// @Router /local/top/volume [get]
+func (p *ProxyServer) TopSymbols(ranking string) gin.HandlerFunc {
+	top := topRankings[ranking]
+	return func(c *gin.Context) {
+		limit := defaultTopLimit
+		if raw := c.Query("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > maxTopLimit {
+				respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'limit' deve ser de 1 a "+strconv.Itoa(maxTopLimit))
+				return
+			}
+			limit = n
+		}
+		filters, err := parseScreenerFilters(c)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, -1100, err.Error())
+			return
+		}
+		if top.filter != "" {
+			f, _ := parseScreenerCondition(top.field, top.filter)
+			filters = append(filters, f)
+		}
+		quotes := queryList(c, "quote")
+		if len(quotes) == 0 {
+			quotes[defaultTopQuote] = true
+		} else if quotes["ALL"] {
+			quotes = nil
+		}
+
+		rows, ok := p.screenRows(c, quotes, filters)
+		if !ok {
+			return
+		}
+		sortScreenerRows(rows, top.field, top.desc)
+		c.JSON(http.StatusOK, gin.H{
+			"ranking": ranking,
+			"results": rows[:min(limit, len(rows))],
+		})
+	}
+}
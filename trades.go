@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tradesTypeAgg         = "agg"
+	tradesTypeMy          = "my"
+	defaultTradesLimit    = 500
+	defaultTradesRange    = 24 * time.Hour
+	myTradesWindow        = 24 * time.Hour
+	maxEmptyMyTradeWindow = 90
+	// Páginas percorridas para chegar em page em /myTrades, cujos ids não
+	// são contínuos (acima disso, use o cursor)
+	maxTradesPageWalk = 50
+)
+
+// tradesCursor identifica uma página de /local/trades: como o histórico de
+// trades não muda, o mesmo cursor sempre retorna as mesmas linhas
+type tradesCursor struct {
+	Type   string `json:"t"`
+	Symbol string `json:"s"`
+	Start  int64  `json:"a"`
+	End    int64  `json:"e"`
+	FromID int64  `json:"f"`
+	Limit  int    `json:"l"`
+	Page   int    `json:"p"`
+}
+
+func (cur tradesCursor) encode() string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTradesCursor(raw string) (tradesCursor, bool) {
+	var cur tradesCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || json.Unmarshal(data, &cur) != nil {
+		return cur, false
+	}
+	if (cur.Type != tradesTypeAgg && cur.Type != tradesTypeMy) || cur.Symbol == "" || cur.Limit <= 0 || cur.Limit > tradePageLimit || cur.Page < 1 {
+		return cur, false
+	}
+	return cur, true
+}
+
+// tradesPage é a resposta de /local/trades
+type tradesPage struct {
+	Symbol     string            `json:"symbol"`
+	Type       string            `json:"type"`
+	Start      int64             `json:"start"`
+	End        int64             `json:"end"`
+	Page       int               `json:"page"`
+	Limit      int               `json:"limit"`
+	Trades     []json.RawMessage `json:"trades"`
+	HasMore    bool              `json:"hasMore"`
+	Cursor     string            `json:"cursor"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// LocalTrades pagina o histórico de trades por intervalo e número de página
+// @Summary Histórico de trades paginado
+// @Description Esconde a paginação por fromId de /aggTrades (type=agg) e /myTrades (type=my, exige token de tenant) atrás de start/end/page/limit, com cursores estáveis
+// @Tags Market Data
+// @Produce json
+// @Param symbol query string true "Símbolo (ex: BTCUSDT)"
+// @Param type query string false "agg (padrão) ou my"
+// @Param start query string false "Início (ms ou RFC3339, padrão: end - 24h)"
+// @Param end query string false "Fim (ms ou RFC3339, padrão: agora)"
+// @Param page query integer false "Página, a partir de 1"
+// @Param limit query integer false "Trades por página (máx. 1000)"
+// @Param cursor query string false "Cursor retornado em cursor/nextCursor"
+// @Success 200 {object} tradesPage
+// @Failure 400 {object} map[string]interface{}
+// @Router /local/trades [get]
+func (p *ProxyServer) LocalTrades(c *gin.Context) {
+	var cur tradesCursor
+	fromID := int64(-1)
+	if raw := c.Query("cursor"); raw != "" {
+		var ok bool
+		if cur, ok = decodeTradesCursor(raw); !ok {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'cursor' inválido")
+			return
+		}
+		fromID = cur.FromID
+	} else {
+		var ok bool
+		if cur, ok = parseTradesQuery(c); !ok {
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	pager := ndjsonPagers["/aggTrades"]
+	window, maxWindows := aggTradesWindow, maxEmptyWindows
+	fetch := func(params url.Values) ([]json.RawMessage, error) {
+		params.Set("symbol", cur.Symbol)
+		params.Set("limit", strconv.Itoa(cur.Limit))
+		return p.fetchRows(ctx, "/aggTrades", params, "")
+	}
+	if cur.Type == tradesTypeMy {
+		tenant, ok := p.requireTenant(c)
+		if !ok {
+			return
+		}
+		pager = tradePager{idField: "id", timeField: "time"}
+		window, maxWindows = myTradesWindow, maxEmptyMyTradeWindow
+		fetch = func(params url.Values) ([]json.RawMessage, error) {
+			params.Set("symbol", cur.Symbol)
+			params.Set("limit", strconv.Itoa(cur.Limit))
+			body, err := p.signedRequest(ctx, tenant, http.MethodGet, "/api/v3/myTrades", params)
+			if err != nil {
+				return nil, err
+			}
+			var rows []json.RawMessage
+			err = json.Unmarshal(body, &rows)
+			return rows, err
+		}
+	}
+
+	result := tradesPage{
+		Symbol: cur.Symbol,
+		Type:   cur.Type,
+		Start:  cur.Start,
+		End:    cur.End,
+		Page:   cur.Page,
+		Limit:  cur.Limit,
+		Trades: []json.RawMessage{},
+	}
+
+	// Sem cursor, localiza o primeiro trade do intervalo e avança até a página
+	var rows []json.RawMessage
+	if fromID < 0 {
+		first, err := findFirstTrades(fetch, cur.Start, cur.End, window, maxWindows)
+		if err != nil {
+			respondUpstreamError(c, err)
+			return
+		}
+		if len(first) == 0 {
+			c.JSON(http.StatusOK, result)
+			return
+		}
+		fromID = rowField(first[0], pager.idField)
+		if cur.Type == tradesTypeAgg {
+			// Os ids de /aggTrades são contínuos por símbolo: a página é um offset
+			fromID += int64(cur.Page-1) * int64(cur.Limit)
+		} else if cur.Page > maxTradesPageWalk {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'page' muito alto para type=my; use o cursor da página anterior")
+			return
+		} else {
+			for page := 1; page < cur.Page; page++ {
+				rows, err = fetch(url.Values{"fromId": {strconv.FormatInt(fromID, 10)}})
+				if err != nil {
+					respondUpstreamError(c, err)
+					return
+				}
+				if len(rows) < cur.Limit || rowField(rows[len(rows)-1], pager.timeField) > cur.End {
+					// A página pedida está depois do fim do intervalo
+					rows = []json.RawMessage{}
+					break
+				}
+				fromID = rowField(rows[len(rows)-1], pager.idField) + 1
+				rows = nil
+			}
+		}
+	}
+	cur.FromID = fromID
+	result.Cursor = cur.encode()
+
+	if rows == nil {
+		var err error
+		rows, err = fetch(url.Values{"fromId": {strconv.FormatInt(fromID, 10)}})
+		if err != nil {
+			respondUpstreamError(c, err)
+			return
+		}
+	}
+	result.HasMore = len(rows) == cur.Limit
+	for i, row := range rows {
+		if rowField(row, pager.timeField) > cur.End {
+			rows, result.HasMore = rows[:i], false
+			break
+		}
+	}
+	result.Trades = append(result.Trades, rows...)
+	if result.HasMore {
+		next := cur
+		next.FromID = rowField(rows[len(rows)-1], pager.idField) + 1
+		next.Page++
+		result.NextCursor = next.encode()
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// parseTradesQuery lê symbol, type, start, end, page e limit de /local/trades,
+// respondendo 400 quando algum é inválido. Sem end, o intervalo termina no
+// momento da primeira página, o que mantém os cursores estáveis.
+func parseTradesQuery(c *gin.Context) (tradesCursor, bool) {
+	cur := tradesCursor{Type: c.DefaultQuery("type", tradesTypeAgg), Page: 1, Limit: defaultTradesLimit}
+	if cur.Type != tradesTypeAgg && cur.Type != tradesTypeMy {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'type' deve ser 'agg' ou 'my'")
+		return cur, false
+	}
+	symbols, err := normalizeSymbols([]string{c.Query("symbol")})
+	if err != nil || len(symbols) == 0 {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetro obrigatório 'symbol' ausente ou inválido")
+		return cur, false
+	}
+	cur.Symbol = symbols[0]
+
+	cur.End = time.Now().UnixMilli()
+	if raw := c.Query("end"); raw != "" {
+		ms, ok := parseHistoryTime(raw)
+		if !ok {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'end' inválido (use ms ou RFC3339)")
+			return cur, false
+		}
+		cur.End = ms
+	}
+	cur.Start = cur.End - defaultTradesRange.Milliseconds()
+	if raw := c.Query("start"); raw != "" {
+		ms, ok := parseHistoryTime(raw)
+		if !ok {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'start' inválido (use ms ou RFC3339)")
+			return cur, false
+		}
+		cur.Start = ms
+	}
+	if cur.Start > cur.End {
+		respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'start' deve ser anterior a 'end'")
+		return cur, false
+	}
+
+	if raw := c.Query("page"); raw != "" {
+		if cur.Page, err = strconv.Atoi(raw); err != nil || cur.Page < 1 {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'page' deve ser um inteiro a partir de 1")
+			return cur, false
+		}
+	}
+	if raw := c.Query("limit"); raw != "" {
+		if cur.Limit, err = strconv.Atoi(raw); err != nil || cur.Limit < 1 || cur.Limit > tradePageLimit {
+			respondError(c, http.StatusBadRequest, -1100, "Parâmetro 'limit' deve estar entre 1 e 1000")
+			return cur, false
+		}
+	}
+	return cur, true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpstreamError representa uma resposta não-OK da Binance
+type UpstreamError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("Binance retornou status %d: %s", e.StatusCode, string(e.Body[:min(200, len(e.Body))]))
+}
+
+// fetchUpstream faz uma requisição GET para a Binance e retorna o corpo da resposta.
+// Usada pelos endpoints locais que precisam de dados de mercado.
+func (p *ProxyServer) fetchUpstream(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	return p.fetchURL(ctx, p.binanceURL+path, query)
+}
+
+// fetchURL é o fetchUpstream para outras APIs da Binance (ex: futuros)
+func (p *ProxyServer) fetchURL(ctx context.Context, targetURL string, query url.Values) ([]byte, error) {
+	if len(query) > 0 {
+		targetURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Binance-Proxy/1.0")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &UpstreamError{StatusCode: resp.StatusCode, Body: body}
+	}
+	return body, nil
+}
+
+// Header e parâmetro que escolhem outra URL base da Binance por requisição
+const (
+	upstreamBaseHeader = "X-Upstream-Base"
+	upstreamBaseParam  = "_upstream"
+)
+
+// parseUpstreamAllowlist lê UPSTREAM_BASE_ALLOWLIST: URLs base separadas por
+// vírgula (ex: https://testnet.binance.vision/api/v3)
+func parseUpstreamAllowlist(raw string) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, base := range strings.Split(raw, ",") {
+		if base = strings.TrimRight(strings.TrimSpace(base), "/"); base != "" {
+			allowed[base] = true
+		}
+	}
+	return allowed
+}
+
+// upstreamBase retorna a URL base da requisição: a pedida em X-Upstream-Base
+// ou ?_upstream= (que é removido da query), se estiver na allowlist, ou a
+// padrão da Binance. Responde 403 quando a URL pedida não é permitida.
+func (p *ProxyServer) upstreamBase(c *gin.Context, query url.Values) (string, bool) {
+	requested := c.GetHeader(upstreamBaseHeader)
+	if value := query.Get(upstreamBaseParam); value != "" {
+		requested = value
+	}
+	query.Del(upstreamBaseParam)
+	if requested == "" {
+		return p.binanceURL, true
+	}
+	requested = strings.TrimRight(requested, "/")
+	if !p.upstreams[requested] {
+		respondError(c, http.StatusForbidden, -1002, "URL base não permitida em UPSTREAM_BASE_ALLOWLIST: "+requested)
+		return "", false
+	}
+	return requested, true
+}
+
+// respondUpstreamError repassa erros da Binance ao cliente preservando o
+// status e o corpo original; outros erros viram 502
+func respondUpstreamError(c *gin.Context, err error) {
+	if upstreamErr, ok := err.(*UpstreamError); ok {
+		c.Data(upstreamErr.StatusCode, "application/json", upstreamErr.Body)
+		return
+	}
+	if respondLimitError(c, err) {
+		return
+	}
+	respondError(c, http.StatusBadGateway, -1000, fmt.Sprintf("Erro ao conectar com Binance: %v", err))
+}
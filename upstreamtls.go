@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UpstreamTLSPolicy endurece o TLS das conexões HTTP e WebSocket com a
+// Binance: versão mínima, cipher suites, CAs adicionais e, opcionalmente, a
+// fixação (pinning) das chaves da cadeia de certificados
+type UpstreamTLSPolicy struct {
+	// UPSTREAM_TLS_MIN_VERSION
+	MinVersion uint16
+	// UPSTREAM_TLS_CIPHER_SUITES; vazio usa as do Go. Valem só até o TLS 1.2:
+	// as do TLS 1.3 não são configuráveis.
+	CipherSuites []uint16
+	// SHA-256 (base64) das chaves públicas aceitas (UPSTREAM_TLS_PINS): alguma
+	// chave da cadeia verificada precisa estar aqui
+	Pins map[string]bool
+	// CAs do sistema mais as de UPSTREAM_CA_FILE (ex: a do proxy de inspeção
+	// TLS da empresa); nil usa só as do sistema
+	RootCAs *x509.CertPool
+	CAFiles []string
+	// Desliga a verificação dos certificados (UPSTREAM_TLS_INSECURE_SKIP_VERIFY).
+	// Só para diagnóstico: qualquer um no caminho pode se passar pela Binance.
+	InsecureSkipVerify bool
+
+	// Certificados vistos em cada host desde o início do processo
+	certs *certTracker
+}
+
+var tlsVersionNames = map[string]uint16{"1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+
+// ParseUpstreamTLSPolicy lê a versão mínima (1.2 ou 1.3), as cipher suites e
+// os pins (sha256/BASE64 ou só BASE64), separados por vírgula
+func ParseUpstreamTLSPolicy(minVersion, cipherSuites, pins string) (*UpstreamTLSPolicy, error) {
+	policy := &UpstreamTLSPolicy{MinVersion: tls.VersionTLS12, certs: &certTracker{hosts: map[string]*UpstreamCertificate{}}}
+	if minVersion != "" {
+		version, ok := tlsVersionNames[minVersion]
+		if !ok {
+			return nil, fmt.Errorf("UPSTREAM_TLS_MIN_VERSION deve ser 1.2 ou 1.3, não %q", minVersion)
+		}
+		policy.MinVersion = version
+	}
+
+	suites := map[string]*tls.CipherSuite{}
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite
+	}
+	for _, name := range strings.Split(cipherSuites, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		suite, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("cipher suite desconhecida ou insegura em UPSTREAM_TLS_CIPHER_SUITES: %s", name)
+		}
+		if !supportsTLS12(suite) {
+			return nil, fmt.Errorf("cipher suite do TLS 1.3 não é configurável: %s", name)
+		}
+		policy.CipherSuites = append(policy.CipherSuites, suite.ID)
+	}
+	if len(policy.CipherSuites) > 0 && policy.MinVersion == tls.VersionTLS13 {
+		return nil, errors.New("UPSTREAM_TLS_CIPHER_SUITES não tem efeito com UPSTREAM_TLS_MIN_VERSION=1.3")
+	}
+
+	for _, pin := range strings.Split(pins, ",") {
+		if pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/"); pin == "" {
+			continue
+		}
+		if raw, err := base64.StdEncoding.DecodeString(pin); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("pin inválido em UPSTREAM_TLS_PINS (esperado o SHA-256 em base64): %s", pin)
+		}
+		if policy.Pins == nil {
+			policy.Pins = map[string]bool{}
+		}
+		policy.Pins[pin] = true
+	}
+	return policy, nil
+}
+
+// LoadRootCAs acrescenta às CAs do sistema os certificados PEM dos arquivos,
+// separados por vírgula
+func (p *UpstreamTLSPolicy) LoadRootCAs(files string) error {
+	for _, file := range strings.Split(files, ",") {
+		if file = strings.TrimSpace(file); file == "" {
+			continue
+		}
+		if p.RootCAs == nil {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			p.RootCAs = pool
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if !p.RootCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("nenhum certificado PEM em %s", file)
+		}
+		p.CAFiles = append(p.CAFiles, file)
+	}
+	return nil
+}
+
+func supportsTLS12(suite *tls.CipherSuite) bool {
+	for _, version := range suite.SupportedVersions {
+		if version == tls.VersionTLS12 {
+			return true
+		}
+	}
+	return false
+}
+
+// Config cria a configuração TLS das conexões com a Binance. A verificação
+// normal da cadeia continua valendo; os pins e o acompanhamento dos
+// certificados vêm depois dela, com os avisos em outages.
+func (p *UpstreamTLSPolicy) Config(outages *OutageNotifier) *tls.Config {
+	return &tls.Config{
+		MinVersion:         p.MinVersion,
+		CipherSuites:       p.CipherSuites,
+		RootCAs:            p.RootCAs,
+		InsecureSkipVerify: p.InsecureSkipVerify,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return p.verify(cs, outages)
+		},
+	}
+}
+
+func (p *UpstreamTLSPolicy) verify(cs tls.ConnectionState, outages *OutageNotifier) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("a Binance não apresentou certificado")
+	}
+	if len(p.Pins) > 0 {
+		chains := cs.VerifiedChains
+		if p.InsecureSkipVerify {
+			// Sem verificação não há cadeia confiável: só a chave do próprio
+			// host, que o handshake prova, vale para os pins
+			chains = [][]*x509.Certificate{cs.PeerCertificates[:1]}
+		}
+		if !p.pinned(chains) {
+			leaf := cs.PeerCertificates[0]
+			outages.Fire(outageTLSPinMismatch, cs.ServerName, "emissor "+leaf.Issuer.String())
+			return fmt.Errorf("certificado de %s fora de UPSTREAM_TLS_PINS (emissor %s)", cs.ServerName, leaf.Issuer)
+		}
+		outages.Resolve(outageTLSPinMismatch, cs.ServerName)
+	}
+	p.certs.observe(cs.ServerName, cs.PeerCertificates[0], outages)
+	return nil
+}
+
+// pinned indica se alguma chave de alguma cadeia verificada está nos pins
+func (p *UpstreamTLSPolicy) pinned(chains [][]*x509.Certificate) bool {
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if p.Pins[spkiPin(cert)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// spkiPin é o SHA-256 (base64) da chave pública do certificado, no formato
+// dos pins do HPKP
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// UpstreamCertificate é o último certificado apresentado por um host da
+// Binance, em /admin/upstreams
+type UpstreamCertificate struct {
+	Host    string `json:"host"`
+	Subject string `json:"subject"`
+	Issuer  string `json:"issuer"`
+	// SHA-256 do certificado (hex) e da chave pública (base64, o formato de
+	// UPSTREAM_TLS_PINS)
+	Fingerprint string    `json:"fingerprint"`
+	PublicKey   string    `json:"publicKey"`
+	NotAfter    time.Time `json:"notAfter"`
+	FirstSeen   int64     `json:"firstSeen"`
+	// Trocas de certificado vistas desde o início do processo
+	Changes   int   `json:"changes"`
+	ChangedAt int64 `json:"changedAt,omitempty"`
+	// Emissores vistos; um emissor novo dispara o evento certificate_changed
+	Issuers []string `json:"issuers"`
+}
+
+// certTracker acompanha os certificados de cada host da Binance
+type certTracker struct {
+	mu    sync.Mutex
+	hosts map[string]*UpstreamCertificate
+}
+
+// observe registra o certificado do handshake. A renovação pelo mesmo
+// emissor é normal e só é contada; um emissor nunca visto para o host é
+// avisado, já que pode ser interceptação.
+func (t *certTracker) observe(host string, leaf *x509.Certificate, outages *OutageNotifier) {
+	sum := sha256.Sum256(leaf.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	issuer := leaf.Issuer.String()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now().UnixMilli()
+	cert, ok := t.hosts[host]
+	if ok && cert.Fingerprint == fingerprint {
+		return
+	}
+	if !ok {
+		cert = &UpstreamCertificate{Host: host, FirstSeen: now}
+		t.hosts[host] = cert
+	} else {
+		cert.Changes++
+		cert.ChangedAt = now
+	}
+	cert.Subject = leaf.Subject.String()
+	cert.Issuer = issuer
+	cert.Fingerprint = fingerprint
+	cert.PublicKey = spkiPin(leaf)
+	cert.NotAfter = leaf.NotAfter
+	for _, seen := range cert.Issuers {
+		if seen == issuer {
+			return
+		}
+	}
+	if len(cert.Issuers) > 0 {
+		outages.Notify(outageCertificateChanged, host, fmt.Sprintf("emissor %s, antes %s", issuer, strings.Join(cert.Issuers, "; ")))
+	}
+	cert.Issuers = append(cert.Issuers, issuer)
+}
+
+// Status lista os certificados por host
+func (t *certTracker) Status() []UpstreamCertificate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	certs := make([]UpstreamCertificate, 0, len(t.hosts))
+	for _, cert := range t.hosts {
+		c := *cert
+		c.Issuers = append([]string{}, cert.Issuers...)
+		certs = append(certs, c)
+	}
+	sort.Slice(certs, func(i, j int) bool { return certs[i].Host < certs[j].Host })
+	return certs
+}
+
+func (p *UpstreamTLSPolicy) writeMetrics(m *metricsWriter) {
+	insecure := 0.0
+	if p.InsecureSkipVerify {
+		insecure = 1
+	}
+	m.family("proxy_upstream_tls_insecure", "gauge", "Verificação dos certificados da Binance desligada (UPSTREAM_TLS_INSECURE_SKIP_VERIFY)")
+	m.sample("proxy_upstream_tls_insecure", insecure)
+
+	certs := p.certs.Status()
+	m.family("proxy_upstream_tls_cert_expiry_timestamp_seconds", "gauge", "Vencimento do certificado apresentado por cada host da Binance (unix)")
+	for _, cert := range certs {
+		m.sample("proxy_upstream_tls_cert_expiry_timestamp_seconds", float64(cert.NotAfter.Unix()), "host", cert.Host)
+	}
+	m.family("proxy_upstream_tls_cert_changes_total", "counter", "Trocas do certificado apresentado por cada host da Binance")
+	for _, cert := range certs {
+		m.sample("proxy_upstream_tls_cert_changes_total", float64(cert.Changes), "host", cert.Host)
+	}
+}
+
+// UpstreamTLSStatus é a configuração TLS e os certificados em /admin/upstreams
+type UpstreamTLSStatus struct {
+	MinVersion   string   `json:"minVersion"`
+	CipherSuites []string `json:"cipherSuites,omitempty"`
+	Pins         int      `json:"pins"`
+	// Arquivos de UPSTREAM_CA_FILE somados às CAs do sistema
+	CAFiles            []string              `json:"caFiles,omitempty"`
+	InsecureSkipVerify bool                  `json:"insecureSkipVerify"`
+	Certificates       []UpstreamCertificate `json:"certificates"`
+}
+
+func (p *UpstreamTLSPolicy) Status() UpstreamTLSStatus {
+	status := UpstreamTLSStatus{
+		MinVersion:         tls.VersionName(p.MinVersion),
+		Pins:               len(p.Pins),
+		CAFiles:            p.CAFiles,
+		InsecureSkipVerify: p.InsecureSkipVerify,
+		Certificates:       p.certs.Status(),
+	}
+	for _, id := range p.CipherSuites {
+		status.CipherSuites = append(status.CipherSuites, tls.CipherSuiteName(id))
+	}
+	return status
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTLSTestProxy cria um proxy que confia na CA do servidor de teste e
+// aceita só os pins informados
+func newTLSTestProxy(t *testing.T, server *httptest.Server, pins string) *ProxyServer {
+	t.Helper()
+	p := NewProxyServer()
+	policy, err := ParseUpstreamTLSPolicy("", "", pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.RootCAs = x509.NewCertPool()
+	policy.RootCAs.AddCert(server.Certificate())
+	p.upstreamTLS = policy
+	p.binanceURL = server.URL + "/api/v3"
+	p.client = newUpstreamClient(p, nil)
+	return p
+}
+
+// Cada proxy tem a própria política TLS: os pins de um não valem para o
+// outro e os certificados vistos ficam em cada um
+func TestUpstreamTLSPolicyPerProxy(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	pinned := newTLSTestProxy(t, server, spkiPin(server.Certificate()))
+	// SHA-256 de outra chave qualquer
+	other := newTLSTestProxy(t, server, "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+
+	resp, err := pinned.client.Get(server.URL + "/api/v3/ping")
+	if err != nil {
+		t.Fatalf("proxy com o pin do servidor: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := other.client.Get(server.URL + "/api/v3/ping"); err == nil {
+		t.Fatalf("proxy com outro pin deveria recusar o certificado")
+	}
+
+	if certs := pinned.upstreamTLS.Status().Certificates; len(certs) != 1 || certs[0].PublicKey != spkiPin(server.Certificate()) {
+		t.Fatalf("certificados do proxy com o pin = %+v, esperado o do servidor", certs)
+	}
+	if certs := other.upstreamTLS.Status().Certificates; len(certs) != 0 {
+		t.Fatalf("certificados do proxy recusado = %+v, esperado nenhum", certs)
+	}
+	if dials := pinned.upstreamDial.Status(); dials.IPv4.Connected+dials.IPv6.Connected == 0 {
+		t.Fatalf("conexões do proxy com o pin não contadas: %+v", dials)
+	}
+	if dials := NewProxyServer().upstreamDial.Status(); dials.IPv4.Attempts+dials.IPv6.Attempts != 0 {
+		t.Fatalf("conexões contadas num proxy que não conectou: %+v", dials)
+	}
+}
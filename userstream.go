@@ -0,0 +1,558 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	listenKeyKeepAlive    = 30 * time.Minute
+	userStreamReadyWait   = 5 * time.Second
+	userStreamHTTPTimeout = 10 * time.Second
+)
+
+var errListenKeyExpired = errors.New("listenKey expirado")
+
+// openOrder é uma ordem aberta no formato de /api/v3/openOrders
+type openOrder struct {
+	Symbol                  string `json:"symbol"`
+	OrderID                 int64  `json:"orderId"`
+	OrderListID             int64  `json:"orderListId"`
+	ClientOrderID           string `json:"clientOrderId"`
+	Price                   string `json:"price"`
+	OrigQty                 string `json:"origQty"`
+	ExecutedQty             string `json:"executedQty"`
+	CummulativeQuoteQty     string `json:"cummulativeQuoteQty"`
+	Status                  string `json:"status"`
+	TimeInForce             string `json:"timeInForce"`
+	Type                    string `json:"type"`
+	Side                    string `json:"side"`
+	StopPrice               string `json:"stopPrice"`
+	IcebergQty              string `json:"icebergQty"`
+	Time                    int64  `json:"time"`
+	UpdateTime              int64  `json:"updateTime"`
+	IsWorking               bool   `json:"isWorking"`
+	WorkingTime             int64  `json:"workingTime"`
+	OrigQuoteOrderQty       string `json:"origQuoteOrderQty"`
+	SelfTradePreventionMode string `json:"selfTradePreventionMode"`
+}
+
+// executionReport é o evento de ordem do user data stream. Vários campos da
+// Binance diferem só na caixa (c/C, x/X, ...), por isso todos são declarados:
+// o encoding/json prefere a correspondência exata.
+type executionReport struct {
+	EventType         string `json:"e"`
+	EventTime         int64  `json:"E"`
+	Symbol            string `json:"s"`
+	ClientOrderID     string `json:"c"`
+	Side              string `json:"S"`
+	Type              string `json:"o"`
+	TimeInForce       string `json:"f"`
+	Quantity          string `json:"q"`
+	Price             string `json:"p"`
+	StopPrice         string `json:"P"`
+	IcebergQty        string `json:"F"`
+	OrderListID       int64  `json:"g"`
+	OrigClientOrderID string `json:"C"`
+	ExecutionType     string `json:"x"`
+	Status            string `json:"X"`
+	RejectReason      string `json:"r"`
+	OrderID           int64  `json:"i"`
+	LastQty           string `json:"l"`
+	CumulativeQty     string `json:"z"`
+	LastPrice         string `json:"L"`
+	Commission        string `json:"n"`
+	CommissionAsset   string `json:"N"`
+	TransactionTime   int64  `json:"T"`
+	TradeID           int64  `json:"t"`
+	Ignore            int64  `json:"I"`
+	IsWorking         bool   `json:"w"`
+	IsMaker           bool   `json:"m"`
+	IgnoreM           bool   `json:"M"`
+	CreationTime      int64  `json:"O"`
+	CumulativeQuote   string `json:"Z"`
+	LastQuote         string `json:"Y"`
+	QuoteOrderQty     string `json:"Q"`
+	WorkingTime       int64  `json:"W"`
+	STPMode           string `json:"V"`
+}
+
+// apply atualiza a ordem aberta com o evento
+func (r *executionReport) apply(order *openOrder) {
+	order.Symbol = r.Symbol
+	order.OrderID = r.OrderID
+	order.OrderListID = r.OrderListID
+	order.ClientOrderID = r.ClientOrderID
+	if r.ExecutionType == "CANCELED" && r.OrigClientOrderID != "" {
+		order.ClientOrderID = r.OrigClientOrderID
+	}
+	order.Price = r.Price
+	order.OrigQty = r.Quantity
+	order.ExecutedQty = r.CumulativeQty
+	order.CummulativeQuoteQty = r.CumulativeQuote
+	order.Status = r.Status
+	order.TimeInForce = r.TimeInForce
+	order.Type = r.Type
+	order.Side = r.Side
+	order.StopPrice = r.StopPrice
+	order.IcebergQty = r.IcebergQty
+	order.Time = r.CreationTime
+	order.UpdateTime = r.TransactionTime
+	order.IsWorking = r.IsWorking
+	order.WorkingTime = r.WorkingTime
+	order.OrigQuoteOrderQty = r.QuoteOrderQty
+	order.SelfTradePreventionMode = r.STPMode
+}
+
+// orderIsOpen indica se o status ainda aparece em /openOrders
+func orderIsOpen(status string) bool {
+	return status == "NEW" || status == "PARTIALLY_FILLED" || status == "PENDING_NEW"
+}
+
+// UserStream mantém o user data stream de um tenant e o estado derivado dele
+// (ordens abertas). A cada (re)conexão o estado é recarregado por snapshot.
+type UserStream struct {
+	proxy  *ProxyServer
+	tenant *Tenant
+
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	mu     sync.RWMutex
+	synced bool
+	orders map[int64]*openOrder
+
+	subsMu      sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+// UserStreamManager inicia sob demanda um user data stream por tenant
+type UserStreamManager struct {
+	proxy *ProxyServer
+
+	mu      sync.Mutex
+	streams map[string]*UserStream
+}
+
+func NewUserStreamManager(proxy *ProxyServer) *UserStreamManager {
+	return &UserStreamManager{
+		proxy:   proxy,
+		streams: make(map[string]*UserStream),
+	}
+}
+
+// Get retorna o user data stream do tenant, iniciando-o no primeiro uso
+func (m *UserStreamManager) Get(tenant *Tenant) *UserStream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.streams[tenant.Name]; ok {
+		return s
+	}
+	s := &UserStream{
+		proxy:       m.proxy,
+		tenant:      tenant,
+		ready:       make(chan struct{}),
+		orders:      make(map[int64]*openOrder),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+	m.streams[tenant.Name] = s
+	go s.run()
+	return s
+}
+
+// WaitReady aguarda o primeiro snapshot, até o timeout. Retorna se o estado
+// está sincronizado com a Binance.
+func (s *UserStream) WaitReady(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-s.ready:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.synced
+}
+
+// OpenOrders retorna as ordens abertas em cache, opcionalmente filtradas por símbolo
+func (s *UserStream) OpenOrders(symbol string) []openOrder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := make([]openOrder, 0, len(s.orders))
+	for _, order := range s.orders {
+		if symbol == "" || order.Symbol == symbol {
+			orders = append(orders, *order)
+		}
+	}
+	return orders
+}
+
+// Subscribe assina os eventos brutos do user data stream do tenant. O campo
+// Stream da mensagem contém o tipo do evento (ex: outboundAccountPosition).
+func (s *UserStream) Subscribe() *Subscription {
+	sub := newSubscription(func(sub *Subscription) {
+		s.subsMu.Lock()
+		delete(s.subscribers, sub)
+		s.subsMu.Unlock()
+	})
+	s.subsMu.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.subsMu.Unlock()
+	return sub
+}
+
+// publish repassa o evento aos assinantes sem bloquear
+func (s *UserStream) publish(eventType string, data []byte) {
+	msg := StreamMessage{Stream: eventType, Data: json.RawMessage(data)}
+
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	for sub := range s.subscribers {
+		sub.send(msg)
+	}
+}
+
+// run mantém a sessão do user data stream, reconectando conforme a política
+// de reconexão do hub
+func (s *UserStream) run() {
+	attempt := 0
+	for {
+		connected, _ := s.session()
+		// log.Printf("[WARN] User data stream de %s desconectado: %v", s.tenant.Name, err)
+
+		s.mu.Lock()
+		s.synced = false
+		s.mu.Unlock()
+
+		if connected {
+			attempt = 0
+		}
+		attempt++
+		time.Sleep(s.proxy.hub.reconnect.delay(attempt))
+	}
+}
+
+// session abre o stream, carrega o snapshot de ordens abertas e aplica os
+// eventos até a conexão cair
+func (s *UserStream) session() (bool, error) {
+	// No modo cluster só a réplica dona do tenant conecta; as demais seguem
+	// pelo Redis
+	cluster := s.proxy.cluster
+	var lease string
+	if cluster != nil {
+		if !cluster.OwnsTenant(s.tenant.Name) {
+			return s.followSession(cluster)
+		}
+		lease = cluster.key("userstream:" + s.tenant.Name)
+		if owner, err := cluster.acquire(lease); !owner && err == nil {
+			// A dona anterior ainda não liberou o tenant
+			return s.followSession(cluster)
+		}
+		defer cluster.release(lease)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listenKey, err := s.openListenKey(ctx)
+	if err != nil {
+		return false, err
+	}
+	conn, _, err := s.proxy.hub.dialer.DialContext(ctx, s.proxy.hub.baseURL+"/ws/"+listenKey, nil)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// Ao perder o tenant, a sessão é encerrada e segue como seguidora
+	if cluster != nil {
+		go s.holdTenant(ctx, cluster, lease, conn)
+	}
+
+	// Manter o listenKey válido enquanto a sessão estiver aberta
+	go func() {
+		ticker := time.NewTicker(listenKeyKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.listenKey(ctx, http.MethodPut, listenKey); err == nil && cluster != nil {
+					cluster.storeListenKey(s.tenant.Name, listenKey)
+				}
+			}
+		}
+	}()
+
+	// O snapshot é carregado depois de conectar: eventos que chegarem nesse
+	// intervalo ficam no buffer da conexão e são aplicados em seguida
+	if err := s.loadSnapshot(ctx); err != nil {
+		return true, err
+	}
+
+	alive := wsKeepAlive(conn, s.proxy.hub.heartbeat.UpstreamPing, s.proxy.hub.heartbeat.UpstreamTimeout, ctx.Done())
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+		alive()
+		if cluster != nil {
+			cluster.publish(cluster.key("user:"+s.tenant.Name), data)
+		}
+		if err := s.handleEvent(data); err != nil {
+			return true, err
+		}
+	}
+}
+
+// openListenKey cria o listenKey do tenant. No modo cluster, reaproveita o
+// da réplica anterior enquanto a Binance o aceitar e guarda o novo no Redis.
+func (s *UserStream) openListenKey(ctx context.Context) (string, error) {
+	cluster := s.proxy.cluster
+	if cluster == nil {
+		return s.listenKey(ctx, http.MethodPost, "")
+	}
+	if key := cluster.listenKey(s.tenant.Name); key != "" {
+		if _, err := s.listenKey(ctx, http.MethodPut, key); err == nil {
+			return key, nil
+		}
+	}
+	key, err := s.listenKey(ctx, http.MethodPost, "")
+	if err != nil {
+		return "", err
+	}
+	cluster.storeListenKey(s.tenant.Name, key)
+	return key, nil
+}
+
+// followSession acompanha o user data stream numa réplica que não é a dona
+// do tenant: o estado vem do snapshot e dos eventos que a dona publica no
+// Redis. Retorna quando esta réplica consegue a lease do tenant, para a
+// sessão recomeçar como dona.
+func (s *UserStream) followSession(cluster *Cluster) (bool, error) {
+	events := make(chan []byte, subscriberBufferSize)
+	overflow := make(chan struct{})
+	var overflowOnce sync.Once
+	channel := cluster.key("user:" + s.tenant.Name)
+	cluster.pubsub.Subscribe(channel, func(data []byte) {
+		select {
+		case events <- data:
+		default:
+			overflowOnce.Do(func() { close(overflow) })
+		}
+	})
+	defer cluster.pubsub.Unsubscribe(channel)
+
+	// Como na sessão direta, o snapshot vem depois da assinatura
+	if err := s.loadSnapshot(context.Background()); err != nil {
+		return false, err
+	}
+	lease := cluster.key("userstream:" + s.tenant.Name)
+	ticker := time.NewTicker(cluster.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !cluster.OwnsTenant(s.tenant.Name) {
+				continue
+			}
+			if owner, err := cluster.acquire(lease); owner || err != nil {
+				return true, nil
+			}
+		case <-overflow:
+			// Eventos perdidos: recomeça com um snapshot novo
+			return true, errors.New("eventos do user data stream descartados")
+		case data := <-events:
+			if err := s.handleEvent(data); err != nil {
+				return true, err
+			}
+		}
+	}
+}
+
+// listenKey cria (POST) ou renova (PUT) o listenKey do tenant
+func (s *UserStream) listenKey(ctx context.Context, method, key string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, userStreamHTTPTimeout)
+	defer cancel()
+
+	target := s.proxy.apiRoot() + "/api/v3/userDataStream"
+	if key != "" {
+		target += "?listenKey=" + key
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-MBX-APIKEY", s.tenant.APIKey)
+	req.Header.Set("User-Agent", "Binance-Proxy/1.0")
+
+	resp, err := s.proxy.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &UpstreamError{StatusCode: resp.StatusCode, Body: body}
+	}
+
+	var result struct {
+		ListenKey string `json:"listenKey"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	return result.ListenKey, nil
+}
+
+// loadSnapshot substitui o cache pelas ordens abertas atuais da Binance
+func (s *UserStream) loadSnapshot(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, userStreamHTTPTimeout)
+	defer cancel()
+
+	body, err := s.proxy.signedRequest(ctx, s.tenant, http.MethodGet, "/api/v3/openOrders", nil)
+	if err != nil {
+		return err
+	}
+	var orders []openOrder
+	if err := json.Unmarshal(body, &orders); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.orders = make(map[int64]*openOrder, len(orders))
+	for i := range orders {
+		s.orders[orders[i].OrderID] = &orders[i]
+	}
+	s.synced = true
+	s.mu.Unlock()
+
+	s.readyOnce.Do(func() { close(s.ready) })
+	return nil
+}
+
+// handleEvent aplica um evento do user data stream ao estado
+func (s *UserStream) handleEvent(data []byte) error {
+	var header struct {
+		EventType string `json:"e"`
+		EventTime int64  `json:"E"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil
+	}
+
+	switch header.EventType {
+	case "executionReport":
+		var report executionReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil
+		}
+		s.mu.Lock()
+		if orderIsOpen(report.Status) {
+			order, ok := s.orders[report.OrderID]
+			if !ok {
+				order = &openOrder{}
+				s.orders[report.OrderID] = order
+			}
+			report.apply(order)
+		} else {
+			delete(s.orders, report.OrderID)
+		}
+		s.mu.Unlock()
+	case "listenKeyExpired":
+		return errListenKeyExpired
+	}
+	s.publish(header.EventType, data)
+	return nil
+}
+
+// LocalOpenOrders serve as ordens abertas do tenant a partir do cache mantido
+// pelo user data stream
+// @Summary Ordens abertas (cache)
+// @Description Mesmo formato de /api/v3/openOrders, servido do cache atualizado pelo user data stream (eventos executionReport). Enquanto o stream não está sincronizado, a consulta é repassada à Binance. Requer token de tenant.
+// @Tags Account
+// @Produce json
+// @Param symbol query string false "Filtrar por símbolo"
+// @Success 200 {array} map[string]interface{}
+// @Router /local/openOrders [get]
+func (p *ProxyServer) LocalOpenOrders(c *gin.Context) {
+	tenant, ok := p.requireTenant(c)
+	if !ok {
+		return
+	}
+	symbol := ""
+	if raw := c.Query("symbol"); raw != "" {
+		symbols, err := normalizeSymbols([]string{raw})
+		if err != nil {
+			respondError(c, http.StatusBadRequest, -1100, err.Error())
+			return
+		}
+		symbol = symbols[0]
+	}
+
+	orders, cached, err := p.tenantOpenOrders(c.Request.Context(), tenant, symbol)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	if cached {
+		c.Header("X-Proxy-Cache", "HIT")
+	} else {
+		c.Header("X-Proxy-Cache", "MISS")
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+// tenantOpenOrders retorna as ordens abertas do tenant do cache do user data
+// stream ou, enquanto o stream não está sincronizado, direto da Binance.
+// O segundo retorno indica se o cache foi usado.
+func (p *ProxyServer) tenantOpenOrders(ctx context.Context, tenant *Tenant, symbol string) ([]openOrder, bool, error) {
+	// A política do tenant vale também para as respostas do cache
+	if symbol != "" {
+		if err := tenant.Policy.Allow(http.MethodGet, "/api/v3/openOrders", []string{symbol}); err != nil {
+			return nil, false, policyError(err)
+		}
+	}
+	stream := p.userStreams.Get(tenant)
+	if !stream.WaitReady(ctx, userStreamReadyWait) {
+		params := url.Values{}
+		if symbol != "" {
+			params.Set("symbol", symbol)
+		}
+		body, err := p.signedRequest(ctx, tenant, http.MethodGet, "/api/v3/openOrders", params)
+		if err != nil {
+			return nil, false, err
+		}
+		var orders []openOrder
+		if err := json.Unmarshal(body, &orders); err != nil {
+			return nil, false, err
+		}
+		return orders, false, nil
+	}
+
+	orders := stream.OpenOrders(symbol)
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].Time != orders[j].Time {
+			return orders[i].Time < orders[j].Time
+		}
+		return orders[i].OrderID < orders[j].OrderID
+	})
+	return orders, true, nil
+}
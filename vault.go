@@ -0,0 +1,349 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// sealedPrefix marca um valor cifrado com a chave mestra (enc:v1:<base64>)
+	sealedPrefix      = "enc:v1:"
+	tenantVaultBucket = "tenant_vault"
+	vaultMaxBody      = 64 << 10
+)
+
+var errNoMasterKey = errors.New("credencial cifrada sem chave mestra (CREDENTIALS_KEY ou CREDENTIALS_KEY_FILE)")
+
+// SecretBox cifra credenciais com AES-256-GCM usando a chave mestra de
+// CREDENTIALS_KEY (ou do arquivo CREDENTIALS_KEY_FILE, montado a partir de
+// um KMS/secret manager). Os valores cifrados são decifrados só em memória.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+func NewSecretBox(key []byte) (*SecretBox, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("a chave mestra deve ter 32 bytes (tem %d)", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+// LoadSecretBox lê a chave mestra em base64 ou hex, direto do valor ou do
+// arquivo. Sem nenhum dos dois, retorna nil: valores cifrados ficam
+// ilegíveis e o cofre de tenants indisponível.
+func LoadSecretBox(value, file string) (*SecretBox, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		value = string(data)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		if key, err = base64.StdEncoding.DecodeString(value); err != nil {
+			if key, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "=")); err != nil {
+				return nil, errors.New("chave mestra deve estar em hex ou base64")
+			}
+		}
+	}
+	return NewSecretBox(key)
+}
+
+// Seal cifra o texto com um nonce aleatório
+func (b *SecretBox) Seal(plaintext []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return sealedPrefix + base64.StdEncoding.EncodeToString(b.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Open decifra um valor gerado por Seal
+func (b *SecretBox) Open(sealed string) ([]byte, error) {
+	if b == nil {
+		return nil, errNoMasterKey
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return nil, errors.New("valor cifrado malformado")
+	}
+	plaintext, err := b.aead.Open(nil, data[:b.aead.NonceSize()], data[b.aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("valor cifrado não confere com a chave mestra")
+	}
+	return plaintext, nil
+}
+
+// openFields decifra em memória os campos no formato enc:v1:...; valores
+// em texto puro ficam como estão
+func (b *SecretBox) openFields(fields ...*string) error {
+	for _, field := range fields {
+		if !strings.HasPrefix(*field, sealedPrefix) {
+			continue
+		}
+		plaintext, err := b.Open(*field)
+		if err != nil {
+			return err
+		}
+		*field = string(plaintext)
+	}
+	return nil
+}
+
+// openTenant decifra as credenciais do tenant, inclusive as de outras
+// corretoras
+func (b *SecretBox) openTenant(t *Tenant) error {
+	if err := b.openFields(&t.Token, &t.APIKey, &t.SecretKey, &t.ClientSecret); err != nil {
+		return err
+	}
+	for name, creds := range t.Exchanges {
+		if err := b.openFields(&creds.APIKey, &creds.SecretKey, &creds.Passphrase); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		t.Exchanges[name] = creds
+	}
+	return nil
+}
+
+// vaultRecord é um tenant guardado no cofre: a configuração inteira,
+// credenciais incluídas, cifrada num único valor
+type vaultRecord struct {
+	Name      string    `json:"name"`
+	Sealed    string    `json:"sealed"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TenantVault guarda tenants cadastrados pela API admin no armazenamento
+// local, sempre cifrados com a chave mestra. Cada réplica tem o seu.
+type TenantVault struct {
+	store *Store
+	box   *SecretBox
+}
+
+func NewTenantVault(store *Store, box *SecretBox) *TenantVault {
+	return &TenantVault{store: store, box: box}
+}
+
+// Tenants decifra todos os tenants do cofre
+func (v *TenantVault) Tenants() ([]*Tenant, error) {
+	if v == nil {
+		return nil, nil
+	}
+	var tenants []*Tenant
+	err := v.store.ForEach(tenantVaultBucket, func(name string, data []byte) error {
+		var record vaultRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		plaintext, err := v.box.Open(record.Sealed)
+		if err != nil {
+			return fmt.Errorf("tenant %s do cofre: %w", name, err)
+		}
+		var tenant Tenant
+		if err := yaml.Unmarshal(plaintext, &tenant); err != nil {
+			return fmt.Errorf("tenant %s do cofre: %w", name, err)
+		}
+		tenants = append(tenants, &tenant)
+		return nil
+	})
+	return tenants, err
+}
+
+// Put cifra e grava o tenant
+func (v *TenantVault) Put(t *Tenant) (*vaultRecord, error) {
+	plaintext, err := yaml.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := v.box.Seal(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	record := &vaultRecord{Name: t.Name, Sealed: sealed, UpdatedAt: time.Now()}
+	return record, v.store.Put(tenantVaultBucket, t.Name, record)
+}
+
+// Delete remove o tenant do cofre
+func (v *TenantVault) Delete(name string) (bool, error) {
+	return v.store.Delete(tenantVaultBucket, name)
+}
+
+// Records lista os tenants do cofre sem decifrá-los
+func (v *TenantVault) Records() ([]vaultRecord, error) {
+	records := []vaultRecord{}
+	err := v.store.ForEach(tenantVaultBucket, func(_ string, data []byte) error {
+		var record vaultRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+// vaultAvailable responde 503 quando o cofre não pode ser usado
+func (p *ProxyServer) vaultAvailable(c *gin.Context) bool {
+	if p.tenants.vault == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Cofre de tenants indisponível: requer CREDENTIALS_KEY e o armazenamento local")
+		return false
+	}
+	return true
+}
+
+// ListVaultTenants lista os tenants do cofre
+// @Summary Tenants do cofre
+// @Description Nomes e datas de atualização dos tenants guardados cifrados no armazenamento local (as credenciais nunca são retornadas)
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {array} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/vault/tenants [get]
+func (p *ProxyServer) ListVaultTenants(c *gin.Context) {
+	if !p.vaultAvailable(c) {
+		return
+	}
+	records, err := p.tenants.vault.Records()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao ler o cofre: "+err.Error())
+		return
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	list := make([]gin.H, len(records))
+	for i, record := range records {
+		list[i] = gin.H{"name": record.Name, "updatedAt": record.UpdatedAt}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// PutVaultTenant cadastra ou substitui um tenant no cofre
+// @Summary Cadastrar tenant no cofre
+// @Description Grava o tenant (mesmos campos do TENANTS_FILE, em JSON ou YAML) cifrado com a chave mestra e o ativa sem reiniciar. Tenants do TENANTS_FILE têm precedência sobre os do cofre com o mesmo nome
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param name path string true "Nome do tenant"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/vault/tenants/{name} [put]
+func (p *ProxyServer) PutVaultTenant(c *gin.Context) {
+	if !p.vaultAvailable(c) {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, vaultMaxBody))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "Erro ao ler o corpo: "+err.Error())
+		return
+	}
+	var tenant Tenant
+	if err := yaml.Unmarshal(body, &tenant); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "Tenant inválido: "+err.Error())
+		return
+	}
+	tenant.Name = c.Param("name")
+	if err := prepareTenant(&tenant, p.tenants.box); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, err.Error())
+		return
+	}
+	record, err := p.tenants.vault.Put(&tenant)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao gravar no cofre: "+err.Error())
+		return
+	}
+	if err := p.tenants.Refresh(); err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Tenant gravado, mas a recarga falhou: "+err.Error())
+		return
+	}
+	// log.Printf("🔐 Tenant %s gravado no cofre", tenant.Name)
+	c.JSON(http.StatusOK, gin.H{"name": record.Name, "updatedAt": record.UpdatedAt})
+}
+
+// DeleteVaultTenant remove um tenant do cofre
+// @Summary Remover tenant do cofre
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Param name path string true "Nome do tenant"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/vault/tenants/{name} [delete]
+func (p *ProxyServer) DeleteVaultTenant(c *gin.Context) {
+	if !p.vaultAvailable(c) {
+		return
+	}
+	found, err := p.tenants.vault.Delete(c.Param("name"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao remover do cofre: "+err.Error())
+		return
+	}
+	if !found {
+		respondError(c, http.StatusNotFound, -1121, "Tenant não encontrado no cofre")
+		return
+	}
+	if err := p.tenants.Refresh(); err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Tenant removido, mas a recarga falhou: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": c.Param("name"), "deleted": true})
+}
+
+// EncryptSecret cifra um valor para uso nos arquivos de configuração
+// @Summary Cifrar credencial
+// @Description Cifra value com a chave mestra, no formato enc:v1:... aceito nos campos de credenciais do TENANTS_FILE e do EXPORT_FILE
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/vault/encrypt [post]
+func (p *ProxyServer) EncryptSecret(c *gin.Context) {
+	if p.secrets == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Chave mestra não configurada (CREDENTIALS_KEY)")
+		return
+	}
+	var req struct {
+		Value string `json:"value"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Value == "" {
+		respondError(c, http.StatusBadRequest, -1102, "Parâmetro value é obrigatório")
+		return
+	}
+	sealed, err := p.secrets.Seal([]byte(req.Value))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao cifrar: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sealed": sealed})
+}
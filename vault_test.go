@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func newTestSecretBox(t *testing.T, fill byte) *SecretBox {
+	t.Helper()
+	box, err := NewSecretBox(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func TestSecretBoxRoundTrip(t *testing.T) {
+	box := newTestSecretBox(t, 1)
+	for _, plaintext := range []string{"", "secret-key", strings.Repeat("x", 4096)} {
+		sealed, err := box.Seal([]byte(plaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(sealed, sealedPrefix) {
+			t.Fatalf("valor cifrado sem o prefixo %s: %q", sealedPrefix, sealed)
+		}
+		if plaintext != "" && strings.Contains(sealed, plaintext) {
+			t.Fatalf("valor cifrado contém o texto puro")
+		}
+		opened, err := box.Open(sealed)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		if string(opened) != plaintext {
+			t.Fatalf("Open = %q, esperado %q", opened, plaintext)
+		}
+	}
+
+	// Nonce aleatório: o mesmo texto não gera o mesmo valor cifrado
+	a, _ := box.Seal([]byte("same"))
+	b, _ := box.Seal([]byte("same"))
+	if a == b {
+		t.Fatalf("Seal repetiu o nonce")
+	}
+}
+
+func TestSecretBoxWrongKey(t *testing.T) {
+	sealed, err := newTestSecretBox(t, 1).Seal([]byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestSecretBox(t, 2).Open(sealed); err == nil {
+		t.Fatalf("Open com outra chave mestra deveria falhar")
+	}
+	var nilBox *SecretBox
+	if _, err := nilBox.Open(sealed); err != errNoMasterKey {
+		t.Fatalf("Open sem chave mestra: %v, esperado errNoMasterKey", err)
+	}
+}
+
+func TestSecretBoxTampered(t *testing.T) {
+	box := newTestSecretBox(t, 1)
+	sealed, err := box.Seal([]byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Inverte um bit no nonce, no texto cifrado e na tag de autenticação
+	for _, i := range []int{0, len(data) / 2, len(data) - 1} {
+		tampered := append([]byte(nil), data...)
+		tampered[i] ^= 0x01
+		if _, err := box.Open(sealedPrefix + base64.StdEncoding.EncodeToString(tampered)); err == nil {
+			t.Fatalf("Open aceitou o byte %d adulterado", i)
+		}
+	}
+	truncated := sealedPrefix + base64.StdEncoding.EncodeToString(data[:len(data)-1])
+	if _, err := box.Open(truncated); err == nil {
+		t.Fatalf("Open aceitou um valor truncado")
+	}
+	if _, err := box.Open(sealedPrefix + "não é base64"); err == nil {
+		t.Fatalf("Open aceitou um valor malformado")
+	}
+}
+
+func TestLoadSecretBox(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	sealed, err := newTestSecretBox(t, 7).Seal([]byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{
+		"hex":    hex.EncodeToString(key),
+		"base64": base64.StdEncoding.EncodeToString(key),
+		"rawurl": base64.RawURLEncoding.EncodeToString(key),
+	} {
+		box, err := LoadSecretBox(value+"\n", "")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if opened, err := box.Open(sealed); err != nil || string(opened) != "secret-key" {
+			t.Fatalf("%s: Open = %q, %v", name, opened, err)
+		}
+	}
+	if box, err := LoadSecretBox("", ""); box != nil || err != nil {
+		t.Fatalf("sem chave: box=%v err=%v, esperado nil", box, err)
+	}
+	if _, err := LoadSecretBox(hex.EncodeToString(key[:16]), ""); err == nil {
+		t.Fatalf("chave de 16 bytes deveria ser recusada")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultWarmupTimeout = 30 * time.Second
+
+// Warmup prepara o proxy antes de ele receber tráfego: confere o acesso à
+// Binance, carrega exchangeInfo e os tickers no cache e abre os streams de
+// WARMUP_STREAMS. Até terminar, /readyz responde 503, e o balanceador (ou o
+// processo anterior, num restart) continua mandando as requisições para
+// instâncias já aquecidas em vez de disparar uma rajada de chamadas com o
+// cache frio.
+type Warmup struct {
+	timeout time.Duration
+	streams []string
+	done    chan struct{}
+
+	mu       sync.Mutex
+	steps    []*warmupStep
+	started  time.Time
+	finished *time.Time
+	timedOut bool
+}
+
+// warmupStep é uma etapa do aquecimento em /readyz
+type warmupStep struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Duration string `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	run func(ctx context.Context) error
+}
+
+func NewWarmup(timeout time.Duration, streams []string) *Warmup {
+	w := &Warmup{timeout: timeout, done: make(chan struct{})}
+	for _, stream := range streams {
+		if stream = strings.TrimSpace(stream); stream != "" {
+			w.streams = append(w.streams, stream)
+		}
+	}
+	return w
+}
+
+// Start executa as etapas em paralelo. Cada etapa é repetida com backoff até
+// dar certo; passado o timeout, o proxy fica pronto mesmo com etapas
+// pendentes, que aparecem com erro em /readyz.
+func (w *Warmup) Start(p *ProxyServer) {
+	w.steps = []*warmupStep{
+		{Name: "ping", run: func(ctx context.Context) error { return p.pingUpstream(ctx) }},
+		{Name: "exchangeInfo", run: func(ctx context.Context) error {
+			_, err := p.market.ExchangeInfo(ctx)
+			return err
+		}},
+		{Name: "ticker", run: func(ctx context.Context) error {
+			if _, err := p.market.Tickers24h(ctx); err != nil {
+				return err
+			}
+			_, err := p.market.Prices(ctx)
+			return err
+		}},
+	}
+	for _, stream := range w.streams {
+		// A assinatura fica aberta enquanto o processo viver
+		sub := p.hub.Subscribe(stream)
+		go func() {
+			for range sub.C {
+			}
+		}()
+		w.steps = append(w.steps, &warmupStep{Name: "stream:" + stream, run: func(ctx context.Context) error {
+			return waitFirstMessage(ctx, p.hub, stream)
+		}})
+	}
+	for _, step := range w.steps {
+		step.Status = "pending"
+	}
+	w.started = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	var wg sync.WaitGroup
+	for _, step := range w.steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.runStep(ctx, step)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		w.mu.Lock()
+		now := time.Now()
+		w.finished = &now
+		w.timedOut = ctx.Err() != nil
+		w.mu.Unlock()
+		cancel()
+		close(w.done)
+		// log.Printf("🔥 Aquecimento concluído em %s", now.Sub(w.started))
+	}()
+}
+
+func (w *Warmup) runStep(ctx context.Context, step *warmupStep) {
+	backoff := streamReconnectMin
+	for {
+		err := step.run(ctx)
+		w.mu.Lock()
+		step.Attempts++
+		step.Duration = time.Since(w.started).Round(time.Millisecond).String()
+		if err == nil {
+			step.Status, step.Error = "ok", ""
+			w.mu.Unlock()
+			return
+		}
+		step.Status, step.Error = "error", err.Error()
+		w.mu.Unlock()
+		// log.Printf("[WARN] Aquecimento %s falhou: %v", step.Name, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > streamReconnectMax {
+			backoff = streamReconnectMax
+		}
+	}
+}
+
+// Done retorna um canal fechado quando o aquecimento termina. Sem
+// aquecimento (WARMUP desligado), o canal já vem fechado.
+func (w *Warmup) Done() <-chan struct{} {
+	if w == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return w.done
+}
+
+// Ready indica se o aquecimento terminou
+func (w *Warmup) Ready() bool {
+	select {
+	case <-w.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// pingUpstream confere o acesso à Binance
+func (p *ProxyServer) pingUpstream(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.binanceURL+"/ping", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping respondeu %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// waitFirstMessage espera a primeira mensagem do stream, prova de que a
+// conexão com a Binance (ou com a réplica dona, no modo cluster) está aberta
+func waitFirstMessage(ctx context.Context, hub *StreamHub, stream string) error {
+	sub := hub.Subscribe(stream)
+	defer sub.Close()
+	select {
+	case <-sub.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("nenhuma mensagem de %s", stream)
+	}
+}
+
+// Readiness informa se o proxy já pode receber tráfego
+// @Summary Readiness
+// @Description Responde 200 quando o proxy está pronto para receber tráfego. Com WARMUP=true, responde 503 até o aquecimento (ping da Binance, exchangeInfo, tickers e streams de WARMUP_STREAMS) terminar
+// @Tags Proxy
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /readyz [get]
+func (p *ProxyServer) Readiness(c *gin.Context) {
+	w := p.warmup
+	if w == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "ready"})
+		return
+	}
+	ready := w.Ready()
+
+	w.mu.Lock()
+	steps := make([]warmupStep, len(w.steps))
+	for i, step := range w.steps {
+		steps[i] = *step
+	}
+	body := gin.H{"status": "warming", "steps": steps, "started": w.started}
+	if ready {
+		body["status"] = "ready"
+		body["finished"] = w.finished
+		body["timedOut"] = w.timedOut
+	}
+	w.mu.Unlock()
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, body)
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
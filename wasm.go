@@ -0,0 +1,850 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Subconjunto do ABI proxy-wasm 0.2.1 (o mesmo do Envoy) suportado pelos
+// filtros: headers e corpo da requisição e da resposta, resposta local,
+// propriedades, dados compartilhados e log. Chamadas HTTP/gRPC, timers e
+// métricas não estão disponíveis dentro do sandbox.
+const (
+	wasmStatusOK            = 0
+	wasmStatusNotFound      = 1
+	wasmStatusBadArgument   = 2
+	wasmStatusCasMismatch   = 8
+	wasmStatusUnimplemented = 12
+
+	wasmMapRequestHeaders  = 0
+	wasmMapResponseHeaders = 2
+
+	wasmBufferRequestBody         = 0
+	wasmBufferResponseBody        = 1
+	wasmBufferVMConfiguration     = 6
+	wasmBufferPluginConfiguration = 7
+
+	wasmRootContextID = 1
+
+	defaultWasmPoolSize      = 4
+	defaultWasmMemoryLimitMB = 64
+	defaultWasmTimeout       = 100 * time.Millisecond
+)
+
+func init() {
+	RegisterPlugin("wasm", newWasmFilter)
+}
+
+type wasmConfig struct {
+	Module string `yaml:"module"`
+	// Entregue ao filtro em proxy_on_configure; objetos e listas viram JSON
+	Configuration interface{} `yaml:"configuration"`
+	// Instâncias do módulo, cada uma atende uma requisição por vez
+	PoolSize      int    `yaml:"pool_size"`
+	MemoryLimitMB int    `yaml:"memory_limit_mb"`
+	Timeout       string `yaml:"timeout"`
+}
+
+// wasmFilter é um filtro WebAssembly (type: wasm em PLUGINS_FILE). O módulo
+// roda isolado no wazero: sem arquivos, rede ou variáveis de ambiente, com
+// limite de memória e tempo máximo por chamada.
+type wasmFilter struct {
+	name          string
+	runtime       wazero.Runtime
+	compiled      wazero.CompiledModule
+	configuration []byte
+	timeout       time.Duration
+	pool          chan *wasmInstance
+	// Vagas para criar instâncias sob demanda, até PoolSize
+	slots chan struct{}
+
+	sharedMu sync.Mutex
+	shared   map[string]wasmSharedValue
+}
+
+type wasmSharedValue struct {
+	data []byte
+	cas  uint32
+}
+
+// wasmInstance é uma instância do módulo com o contexto raiz já configurado
+type wasmInstance struct {
+	module        api.Module
+	malloc        api.Function
+	nextContextID uint32
+	broken        bool
+}
+
+// wasmStream é o estado de uma requisição dentro de uma instância, lido
+// pelas funções do host através do context.Context da chamada
+type wasmStream struct {
+	filter          *wasmFilter
+	instance        *wasmInstance
+	contextID       uint32
+	requestHeaders  [][2]string
+	responseHeaders [][2]string
+	requestBody     []byte
+	responseBody    []byte
+	pluginConfig    []byte
+	properties      map[string]string
+	local           *wasmLocalResponse
+}
+
+// wasmLocalResponse é uma resposta gerada pelo filtro (proxy_send_local_response)
+type wasmLocalResponse struct {
+	status  int
+	body    []byte
+	headers [][2]string
+}
+
+type wasmStreamKey struct{}
+
+// Filtros que usam o mesmo módulo compilam o código uma vez só
+var wasmCompilationCache = wazero.NewCompilationCache()
+
+func newWasmFilter(config map[string]interface{}) (Plugin, error) {
+	var cfg wasmConfig
+	if err := decodePluginConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Module == "" {
+		return nil, fmt.Errorf("module é obrigatório")
+	}
+	code, err := os.ReadFile(cfg.Module)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = defaultWasmPoolSize
+	}
+	if cfg.MemoryLimitMB <= 0 {
+		cfg.MemoryLimitMB = defaultWasmMemoryLimitMB
+	}
+	f := &wasmFilter{
+		name:    cfg.Module,
+		timeout: defaultWasmTimeout,
+		pool:    make(chan *wasmInstance, cfg.PoolSize),
+		slots:   make(chan struct{}, cfg.PoolSize),
+		shared:  map[string]wasmSharedValue{},
+	}
+	if cfg.Timeout != "" {
+		if f.timeout, err = time.ParseDuration(cfg.Timeout); err != nil || f.timeout <= 0 {
+			return nil, fmt.Errorf("timeout inválido: %q", cfg.Timeout)
+		}
+	}
+	switch v := cfg.Configuration.(type) {
+	case nil:
+	case string:
+		f.configuration = []byte(v)
+	default:
+		if f.configuration, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("configuration inválida: %w", err)
+		}
+	}
+	for i := 0; i < cfg.PoolSize; i++ {
+		f.slots <- struct{}{}
+	}
+
+	ctx := context.Background()
+	// 64 KiB por página
+	f.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(cfg.MemoryLimitMB)*16).
+		WithCloseOnContextDone(true).
+		WithCompilationCache(wasmCompilationCache))
+	wasi_snapshot_preview1.MustInstantiate(ctx, f.runtime)
+	if err := f.instantiateHost(ctx); err != nil {
+		f.runtime.Close(ctx)
+		return nil, err
+	}
+	if f.compiled, err = f.runtime.CompileModule(ctx, code); err != nil {
+		f.runtime.Close(ctx)
+		return nil, fmt.Errorf("módulo inválido: %w", err)
+	}
+
+	// Uma instância de saída valida o módulo e a configuração já na carga
+	instance, err := f.newInstance(ctx)
+	if err != nil {
+		f.runtime.Close(ctx)
+		return nil, err
+	}
+	<-f.slots
+	f.pool <- instance
+	return f, nil
+}
+
+func (f *wasmFilter) Name() string { return "wasm:" + f.name }
+
+// newInstance instancia o módulo e roda proxy_on_vm_start e proxy_on_configure
+// no contexto raiz
+func (f *wasmFilter) newInstance(ctx context.Context) (*wasmInstance, error) {
+	module, err := f.runtime.InstantiateModule(ctx, f.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize", "_start").
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao instanciar o módulo: %w", err)
+	}
+	instance := &wasmInstance{module: module, nextContextID: wasmRootContextID + 1}
+	instance.malloc = module.ExportedFunction("proxy_on_memory_allocate")
+	if instance.malloc == nil {
+		instance.malloc = module.ExportedFunction("malloc")
+	}
+	if instance.malloc == nil {
+		module.Close(ctx)
+		return nil, fmt.Errorf("o módulo não exporta proxy_on_memory_allocate nem malloc")
+	}
+
+	root := &wasmStream{
+		filter:       f,
+		instance:     instance,
+		contextID:    wasmRootContextID,
+		pluginConfig: f.configuration,
+		properties:   map[string]string{"plugin_name": f.name},
+	}
+	if _, err := root.call(ctx, "proxy_on_context_create", wasmRootContextID, 0); err != nil {
+		module.Close(ctx)
+		return nil, err
+	}
+	for _, step := range []struct {
+		fn   string
+		size int
+	}{{"proxy_on_vm_start", 0}, {"proxy_on_configure", len(f.configuration)}} {
+		if module.ExportedFunction(step.fn) == nil {
+			continue
+		}
+		ok, err := root.call(ctx, step.fn, wasmRootContextID, uint64(step.size))
+		if err == nil && ok == 0 {
+			err = fmt.Errorf("%s recusou a configuração", step.fn)
+		}
+		if err != nil {
+			module.Close(ctx)
+			return nil, err
+		}
+	}
+	return instance, nil
+}
+
+// acquire retira uma instância livre, criando outra se houver vaga
+func (f *wasmFilter) acquire(ctx context.Context) (*wasmInstance, error) {
+	select {
+	case instance := <-f.pool:
+		return instance, nil
+	default:
+	}
+	select {
+	case instance := <-f.pool:
+		return instance, nil
+	case <-f.slots:
+		instance, err := f.newInstance(context.Background())
+		if err != nil {
+			f.slots <- struct{}{}
+			return nil, err
+		}
+		return instance, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release devolve a instância; instâncias que falharam são descartadas
+func (f *wasmFilter) release(instance *wasmInstance) {
+	if instance.broken {
+		instance.module.Close(context.Background())
+		f.slots <- struct{}{}
+		return
+	}
+	f.pool <- instance
+}
+
+// call chama uma função exportada do filtro com o stream no contexto.
+// Funções que o filtro não exporta são ignoradas.
+func (s *wasmStream) call(ctx context.Context, name string, args ...uint64) (uint64, error) {
+	fn := s.instance.module.ExportedFunction(name)
+	if fn == nil {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, wasmStreamKey{}, s), s.filter.timeout)
+	defer cancel()
+	results, err := fn.Call(ctx, args...)
+	if err != nil {
+		s.instance.broken = true
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0], nil
+}
+
+func (f *wasmFilter) streamFrom(c *gin.Context) *wasmStream {
+	value, ok := c.Get("wasm:" + f.name)
+	if !ok {
+		return nil
+	}
+	return value.(*wasmStream)
+}
+
+// respondWasmError responde 502 quando o próprio filtro falha
+func respondWasmError(c *gin.Context, err error) {
+	respondError(c, http.StatusBadGateway, -1000, "Filtro WASM falhou: "+err.Error())
+	c.Abort()
+}
+
+func (f *wasmFilter) BeforeRequest(c *gin.Context) error {
+	instance, err := f.acquire(c.Request.Context())
+	if err != nil {
+		respondWasmError(c, err)
+		return nil
+	}
+	stream := &wasmStream{
+		filter:    f,
+		instance:  instance,
+		contextID: instance.nextContextID,
+		properties: map[string]string{
+			"plugin_name":      f.name,
+			"request.path":     c.Request.URL.RequestURI(),
+			"request.url_path": c.Request.URL.Path,
+			"request.query":    c.Request.URL.RawQuery,
+			"request.method":   c.Request.Method,
+			"request.host":     c.Request.Host,
+			"source.address":   c.ClientIP(),
+			"tenant":           c.GetString(pluginTenantKey),
+		},
+	}
+	instance.nextContextID++
+	c.Set("wasm:"+f.name, stream)
+
+	ctx := c.Request.Context()
+	if _, err := stream.call(ctx, "proxy_on_context_create", uint64(stream.contextID), wasmRootContextID); err != nil {
+		respondWasmError(c, err)
+		return nil
+	}
+
+	stream.requestHeaders = [][2]string{
+		{":method", c.Request.Method},
+		{":path", c.Request.URL.RequestURI()},
+		{":authority", c.Request.Host},
+		{":scheme", "http"},
+	}
+	for name, values := range c.Request.Header {
+		for _, value := range values {
+			stream.requestHeaders = append(stream.requestHeaders, [2]string{strings.ToLower(name), value})
+		}
+	}
+	if stream.requestBody, err = readBody(c); err != nil {
+		respondBodyError(c, err)
+		return nil
+	}
+
+	endOfStream := uint64(0)
+	if len(stream.requestBody) == 0 {
+		endOfStream = 1
+	}
+	if _, err := stream.call(ctx, "proxy_on_request_headers", uint64(stream.contextID), uint64(len(stream.requestHeaders)), endOfStream); err != nil {
+		respondWasmError(c, err)
+		return nil
+	}
+	if stream.local == nil && len(stream.requestBody) > 0 {
+		if _, err := stream.call(ctx, "proxy_on_request_body", uint64(stream.contextID), uint64(len(stream.requestBody)), 1); err != nil {
+			respondWasmError(c, err)
+			return nil
+		}
+	}
+	if stream.local != nil {
+		stream.local.write(c)
+		return nil
+	}
+	stream.applyRequest(c)
+	return nil
+}
+
+// applyRequest leva para c.Request os headers, o :path e o corpo alterados
+func (s *wasmStream) applyRequest(c *gin.Context) {
+	header := http.Header{}
+	for _, pair := range s.requestHeaders {
+		switch pair[0] {
+		case ":path":
+			// Só reescreve se mudou: a ordem da query importa para chamadas assinadas
+			if pair[1] != c.Request.URL.RequestURI() {
+				if u, err := url.ParseRequestURI(pair[1]); err == nil {
+					c.Request.URL.Path = u.Path
+					c.Request.URL.RawPath = u.RawPath
+					c.Request.URL.RawQuery = u.RawQuery
+				}
+			}
+		case ":method", ":authority", ":scheme":
+		default:
+			header.Add(pair[0], pair[1])
+		}
+	}
+	c.Request.Header = header
+	if s.requestBody != nil {
+		setRequestBody(c, s.requestBody)
+	}
+}
+
+func (f *wasmFilter) AfterResponse(c *gin.Context, status int, body []byte) (int, []byte, error) {
+	stream := f.streamFrom(c)
+	if stream == nil || stream.instance.broken {
+		return status, body, nil
+	}
+	stream.responseHeaders = [][2]string{{":status", fmt.Sprint(status)}}
+	for name, values := range c.Writer.Header() {
+		for _, value := range values {
+			stream.responseHeaders = append(stream.responseHeaders, [2]string{strings.ToLower(name), value})
+		}
+	}
+	stream.responseBody = body
+
+	ctx := c.Request.Context()
+	if _, err := stream.call(ctx, "proxy_on_response_headers", uint64(stream.contextID), uint64(len(stream.responseHeaders)), 0); err != nil {
+		return status, body, err
+	}
+	if stream.local == nil {
+		if _, err := stream.call(ctx, "proxy_on_response_body", uint64(stream.contextID), uint64(len(stream.responseBody)), 1); err != nil {
+			return status, body, err
+		}
+	}
+	if stream.local != nil {
+		setHeaderPairs(c.Writer.Header(), stream.local.headers)
+		return stream.local.status, stream.local.body, nil
+	}
+
+	header := c.Writer.Header()
+	for name := range header {
+		delete(header, name)
+	}
+	for _, pair := range stream.responseHeaders {
+		if pair[0] == ":status" {
+			if code, err := parseStatus(pair[1]); err == nil {
+				status = code
+			}
+			continue
+		}
+		header.Add(pair[0], pair[1])
+	}
+	return status, stream.responseBody, nil
+}
+
+func parseStatus(value string) (int, error) {
+	var code int
+	if _, err := fmt.Sscan(value, &code); err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("status inválido: %q", value)
+	}
+	return code, nil
+}
+
+// Done encerra o contexto da requisição no filtro e devolve a instância
+func (f *wasmFilter) Done(c *gin.Context) {
+	stream := f.streamFrom(c)
+	if stream == nil {
+		return
+	}
+	ctx := context.Background()
+	if !stream.instance.broken {
+		id := uint64(stream.contextID)
+		stream.call(ctx, "proxy_on_done", id)
+		stream.call(ctx, "proxy_on_log", id)
+		stream.call(ctx, "proxy_on_delete", id)
+	}
+	f.release(stream.instance)
+}
+
+func (r *wasmLocalResponse) write(c *gin.Context) {
+	setHeaderPairs(c.Writer.Header(), r.headers)
+	if c.Writer.Header().Get("Content-Type") == "" && len(r.body) > 0 {
+		c.Writer.Header().Set("Content-Type", http.DetectContentType(r.body))
+	}
+	c.Data(r.status, c.Writer.Header().Get("Content-Type"), r.body)
+	c.Abort()
+}
+
+func setHeaderPairs(header http.Header, pairs [][2]string) {
+	for _, pair := range pairs {
+		if !strings.HasPrefix(pair[0], ":") {
+			header.Set(pair[0], pair[1])
+		}
+	}
+}
+
+// encodeHeaderPairs serializa no formato do ABI: quantidade, tamanhos de
+// cada nome e valor, e depois os bytes terminados em \0
+func encodeHeaderPairs(pairs [][2]string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pairs)))
+	for _, pair := range pairs {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(pair[0])))
+		binary.Write(&buf, binary.LittleEndian, uint32(len(pair[1])))
+	}
+	for _, pair := range pairs {
+		buf.WriteString(pair[0])
+		buf.WriteByte(0)
+		buf.WriteString(pair[1])
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+func decodeHeaderPairs(data []byte) ([][2]string, bool) {
+	if len(data) < 4 {
+		return nil, len(data) == 0
+	}
+	count := int(binary.LittleEndian.Uint32(data))
+	offset := 4 + count*8
+	if count > len(data) || offset > len(data) {
+		return nil, false
+	}
+	pairs := make([][2]string, 0, count)
+	for i := 0; i < count; i++ {
+		nameLen := int(binary.LittleEndian.Uint32(data[4+i*8:]))
+		valueLen := int(binary.LittleEndian.Uint32(data[8+i*8:]))
+		if offset+nameLen+valueLen+2 > len(data) {
+			return nil, false
+		}
+		name := string(data[offset : offset+nameLen])
+		offset += nameLen + 1
+		value := string(data[offset : offset+valueLen])
+		offset += valueLen + 1
+		pairs = append(pairs, [2]string{strings.ToLower(name), value})
+	}
+	return pairs, true
+}
+
+// headerMap retorna o mapa de headers do stream para o tipo do ABI
+func (s *wasmStream) headerMap(mapType uint32) (*[][2]string, bool) {
+	switch mapType {
+	case wasmMapRequestHeaders:
+		return &s.requestHeaders, true
+	case wasmMapResponseHeaders:
+		return &s.responseHeaders, true
+	}
+	return nil, false
+}
+
+func (s *wasmStream) buffer(bufferType uint32) (*[]byte, bool) {
+	switch bufferType {
+	case wasmBufferRequestBody:
+		return &s.requestBody, true
+	case wasmBufferResponseBody:
+		return &s.responseBody, true
+	case wasmBufferPluginConfiguration:
+		return &s.pluginConfig, true
+	case wasmBufferVMConfiguration:
+		empty := []byte{}
+		return &empty, true
+	}
+	return nil, false
+}
+
+// Acesso à memória do módulo
+
+func wasmRead(mod api.Module, ptr, size uint64) ([]byte, bool) {
+	data, ok := mod.Memory().Read(uint32(ptr), uint32(size))
+	if !ok {
+		return nil, false
+	}
+	return bytes.Clone(data), true
+}
+
+func wasmReadString(mod api.Module, ptr, size uint64) (string, bool) {
+	data, ok := wasmRead(mod, ptr, size)
+	return string(data), ok
+}
+
+// wasmReturn copia data para memória alocada pelo próprio módulo e escreve
+// o endereço e o tamanho em retPtr e retSize
+func (s *wasmStream) wasmReturn(ctx context.Context, mod api.Module, data []byte, retPtr, retSize uint64) uint32 {
+	var ptr uint32
+	if len(data) > 0 {
+		results, err := s.instance.malloc.Call(ctx, uint64(len(data)))
+		if err != nil || len(results) == 0 {
+			return wasmStatusBadArgument
+		}
+		ptr = uint32(results[0])
+		if !mod.Memory().Write(ptr, data) {
+			return wasmStatusBadArgument
+		}
+	}
+	if !mod.Memory().WriteUint32Le(uint32(retPtr), ptr) || !mod.Memory().WriteUint32Le(uint32(retSize), uint32(len(data))) {
+		return wasmStatusBadArgument
+	}
+	return wasmStatusOK
+}
+
+// Funções do host (módulo "env")
+
+type wasmHostFunc struct {
+	params []api.ValueType
+	fn     func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32
+}
+
+func i32s(n int) []api.ValueType {
+	types := make([]api.ValueType, n)
+	for i := range types {
+		types[i] = api.ValueTypeI32
+	}
+	return types
+}
+
+func wasmUnimplemented(params []api.ValueType) wasmHostFunc {
+	return wasmHostFunc{params: params, fn: func(context.Context, api.Module, *wasmStream, []uint64) uint32 {
+		return wasmStatusUnimplemented
+	}}
+}
+
+func wasmNoop(params int) wasmHostFunc {
+	return wasmHostFunc{params: i32s(params), fn: func(context.Context, api.Module, *wasmStream, []uint64) uint32 {
+		return wasmStatusOK
+	}}
+}
+
+func (f *wasmFilter) hostFunctions() map[string]wasmHostFunc {
+	i32i64 := []api.ValueType{api.ValueTypeI32, api.ValueTypeI64}
+	return map[string]wasmHostFunc{
+		"proxy_log": {i32s(3), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			msg, ok := wasmReadString(mod, args[1], args[2])
+			if !ok {
+				return wasmStatusBadArgument
+			}
+			// log.Printf("[WASM %s] %s", s.filter.name, msg)
+			_ = msg
+			return wasmStatusOK
+		}},
+		"proxy_get_log_level": {i32s(1), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			mod.Memory().WriteUint32Le(uint32(args[0]), 2)
+			return wasmStatusOK
+		}},
+		"proxy_get_current_time_nanoseconds": {i32s(1), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			if !mod.Memory().WriteUint64Le(uint32(args[0]), uint64(time.Now().UnixNano())) {
+				return wasmStatusBadArgument
+			}
+			return wasmStatusOK
+		}},
+		"proxy_get_property": {i32s(4), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			path, ok := wasmReadString(mod, args[0], args[1])
+			if !ok {
+				return wasmStatusBadArgument
+			}
+			value, found := s.properties[strings.Join(strings.Split(strings.TrimRight(path, "\x00"), "\x00"), ".")]
+			if !found {
+				return wasmStatusNotFound
+			}
+			return s.wasmReturn(ctx, mod, []byte(value), args[2], args[3])
+		}},
+		"proxy_get_header_map_pairs": {i32s(3), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			pairs, ok := s.headerMap(uint32(args[0]))
+			if !ok {
+				return wasmStatusBadArgument
+			}
+			return s.wasmReturn(ctx, mod, encodeHeaderPairs(*pairs), args[1], args[2])
+		}},
+		"proxy_set_header_map_pairs": {i32s(3), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			pairs, ok := s.headerMap(uint32(args[0]))
+			data, readOK := wasmRead(mod, args[1], args[2])
+			if !ok || !readOK {
+				return wasmStatusBadArgument
+			}
+			decoded, ok := decodeHeaderPairs(data)
+			if !ok {
+				return wasmStatusBadArgument
+			}
+			*pairs = decoded
+			return wasmStatusOK
+		}},
+		"proxy_get_header_map_value": {i32s(5), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			pairs, ok := s.headerMap(uint32(args[0]))
+			key, readOK := wasmReadString(mod, args[1], args[2])
+			if !ok || !readOK {
+				return wasmStatusBadArgument
+			}
+			key = strings.ToLower(key)
+			for _, pair := range *pairs {
+				if pair[0] == key {
+					return s.wasmReturn(ctx, mod, []byte(pair[1]), args[3], args[4])
+				}
+			}
+			return wasmStatusNotFound
+		}},
+		"proxy_add_header_map_value": {i32s(5), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			return s.editHeader(mod, args, false)
+		}},
+		"proxy_replace_header_map_value": {i32s(5), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			return s.editHeader(mod, args, true)
+		}},
+		"proxy_remove_header_map_value": {i32s(3), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			pairs, ok := s.headerMap(uint32(args[0]))
+			key, readOK := wasmReadString(mod, args[1], args[2])
+			if !ok || !readOK {
+				return wasmStatusBadArgument
+			}
+			key = strings.ToLower(key)
+			kept := (*pairs)[:0]
+			for _, pair := range *pairs {
+				if pair[0] != key {
+					kept = append(kept, pair)
+				}
+			}
+			*pairs = kept
+			return wasmStatusOK
+		}},
+		"proxy_get_buffer_bytes": {i32s(5), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			buf, ok := s.buffer(uint32(args[0]))
+			if !ok {
+				return wasmStatusBadArgument
+			}
+			start, size := int(uint32(args[1])), int(uint32(args[2]))
+			if start > len(*buf) {
+				return wasmStatusBadArgument
+			}
+			end := min(start+size, len(*buf))
+			return s.wasmReturn(ctx, mod, (*buf)[start:end], args[3], args[4])
+		}},
+		"proxy_set_buffer_bytes": {i32s(5), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			buf, ok := s.buffer(uint32(args[0]))
+			data, readOK := wasmRead(mod, args[3], args[4])
+			if !ok || !readOK || uint32(args[0]) > wasmBufferResponseBody {
+				return wasmStatusBadArgument
+			}
+			// Como no Envoy: start 0 e size 0 substitui o buffer inteiro
+			start, size := int(uint32(args[1])), int(uint32(args[2]))
+			if start == 0 && size == 0 {
+				*buf = data
+				return wasmStatusOK
+			}
+			if start > len(*buf) {
+				return wasmStatusBadArgument
+			}
+			end := min(start+size, len(*buf))
+			*buf = append(append(append([]byte{}, (*buf)[:start]...), data...), (*buf)[end:]...)
+			return wasmStatusOK
+		}},
+		"proxy_send_local_response": {i32s(8), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			body, okBody := wasmRead(mod, args[3], args[4])
+			headers, okHeaders := wasmRead(mod, args[5], args[6])
+			pairs, okPairs := decodeHeaderPairs(headers)
+			status := int(uint32(args[0]))
+			if !okBody || !okHeaders || !okPairs || status < 100 || status > 599 {
+				return wasmStatusBadArgument
+			}
+			s.local = &wasmLocalResponse{status: status, body: body, headers: pairs}
+			return wasmStatusOK
+		}},
+		"proxy_get_shared_data": {i32s(5), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			key, ok := wasmReadString(mod, args[0], args[1])
+			if !ok {
+				return wasmStatusBadArgument
+			}
+			s.filter.sharedMu.Lock()
+			value, found := s.filter.shared[key]
+			s.filter.sharedMu.Unlock()
+			if !found {
+				return wasmStatusNotFound
+			}
+			if status := s.wasmReturn(ctx, mod, value.data, args[2], args[3]); status != wasmStatusOK {
+				return status
+			}
+			mod.Memory().WriteUint32Le(uint32(args[4]), value.cas)
+			return wasmStatusOK
+		}},
+		"proxy_set_shared_data": {i32s(5), func(ctx context.Context, mod api.Module, s *wasmStream, args []uint64) uint32 {
+			key, okKey := wasmReadString(mod, args[0], args[1])
+			data, okData := wasmRead(mod, args[2], args[3])
+			if !okKey || !okData {
+				return wasmStatusBadArgument
+			}
+			cas := uint32(args[4])
+			s.filter.sharedMu.Lock()
+			defer s.filter.sharedMu.Unlock()
+			current := s.filter.shared[key]
+			if cas != 0 && cas != current.cas {
+				return wasmStatusCasMismatch
+			}
+			s.filter.shared[key] = wasmSharedValue{data: data, cas: current.cas + 1}
+			return wasmStatusOK
+		}},
+		// Sem pausa de streams: as chamadas já seguem ao fim de cada callback
+		"proxy_continue_stream":       wasmNoop(1),
+		"proxy_close_stream":          wasmNoop(1),
+		"proxy_continue_request":      wasmNoop(0),
+		"proxy_continue_response":     wasmNoop(0),
+		"proxy_clear_route_cache":     wasmNoop(0),
+		"proxy_set_effective_context": wasmNoop(1),
+		"proxy_done":                  wasmNoop(0),
+
+		"proxy_set_tick_period_milliseconds": wasmUnimplemented(i32s(1)),
+		"proxy_set_property":                 wasmUnimplemented(i32s(4)),
+		"proxy_get_status":                   wasmUnimplemented(i32s(3)),
+		"proxy_http_call":                    wasmUnimplemented(i32s(10)),
+		"proxy_grpc_call":                    wasmUnimplemented(i32s(12)),
+		"proxy_grpc_stream":                  wasmUnimplemented(i32s(9)),
+		"proxy_grpc_send":                    wasmUnimplemented(i32s(4)),
+		"proxy_grpc_cancel":                  wasmUnimplemented(i32s(1)),
+		"proxy_grpc_close":                   wasmUnimplemented(i32s(1)),
+		"proxy_register_shared_queue":        wasmUnimplemented(i32s(3)),
+		"proxy_resolve_shared_queue":         wasmUnimplemented(i32s(5)),
+		"proxy_dequeue_shared_queue":         wasmUnimplemented(i32s(3)),
+		"proxy_enqueue_shared_queue":         wasmUnimplemented(i32s(3)),
+		"proxy_define_metric":                wasmUnimplemented(i32s(4)),
+		"proxy_increment_metric":             wasmUnimplemented(i32i64),
+		"proxy_record_metric":                wasmUnimplemented(i32i64),
+		"proxy_get_metric":                   wasmUnimplemented(i32s(2)),
+		"proxy_call_foreign_function":        wasmUnimplemented(i32s(6)),
+	}
+}
+
+// editHeader implementa add (replace=false) e replace de um header
+func (s *wasmStream) editHeader(mod api.Module, args []uint64, replace bool) uint32 {
+	pairs, ok := s.headerMap(uint32(args[0]))
+	key, okKey := wasmReadString(mod, args[1], args[2])
+	value, okValue := wasmReadString(mod, args[3], args[4])
+	if !ok || !okKey || !okValue {
+		return wasmStatusBadArgument
+	}
+	key = strings.ToLower(key)
+	if replace {
+		kept := (*pairs)[:0]
+		for _, pair := range *pairs {
+			if pair[0] != key {
+				kept = append(kept, pair)
+			}
+		}
+		*pairs = kept
+	}
+	*pairs = append(*pairs, [2]string{key, value})
+	return wasmStatusOK
+}
+
+func (f *wasmFilter) instantiateHost(ctx context.Context) error {
+	builder := f.runtime.NewHostModuleBuilder("env")
+	for name, host := range f.hostFunctions() {
+		host := host
+		builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+			stream, ok := ctx.Value(wasmStreamKey{}).(*wasmStream)
+			if !ok {
+				stack[0] = wasmStatusBadArgument
+				return
+			}
+			args := append([]uint64(nil), stack[:len(host.params)]...)
+			stack[0] = uint64(host.fn(ctx, mod, stream, args))
+		}), host.params, []api.ValueType{api.ValueTypeI32}).Export(name)
+	}
+	_, err := builder.Instantiate(ctx)
+	return err
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	watchlistBucket     = "watchlists"
+	maxWatchlistSymbols = 200
+	miniTickerArrStream = "!miniTicker@arr"
+)
+
+var watchlistNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Watchlist é uma lista nomeada de símbolos persistida no armazenamento local
+type Watchlist struct {
+	Name      string    `json:"name"`
+	Symbols   []string  `json:"symbols"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type watchlistRequest struct {
+	Name    string   `json:"name"`
+	Symbols []string `json:"symbols"`
+}
+
+// miniTicker é o evento 24hrMiniTicker dos streams da Binance
+type miniTicker struct {
+	EventType   string `json:"e"`
+	EventTime   int64  `json:"E"`
+	Symbol      string `json:"s"`
+	Close       string `json:"c"`
+	Open        string `json:"o"`
+	High        string `json:"h"`
+	Low         string `json:"l"`
+	Volume      string `json:"v"`
+	QuoteVolume string `json:"q"`
+}
+
+// requireStore garante que o armazenamento local está disponível
+func (p *ProxyServer) requireStore(c *gin.Context) bool {
+	if p.store == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Armazenamento local indisponível")
+		return false
+	}
+	return true
+}
+
+// loadWatchlist busca a watchlist do path, respondendo 404 se não existir
+func (p *ProxyServer) loadWatchlist(c *gin.Context) (*Watchlist, bool) {
+	if !p.requireStore(c) {
+		return nil, false
+	}
+	var wl Watchlist
+	found, err := p.store.Get(watchlistBucket, c.Param("name"), &wl)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao ler watchlist: "+err.Error())
+		return nil, false
+	}
+	if !found {
+		respondError(c, http.StatusNotFound, -1000, "Watchlist não encontrada")
+		return nil, false
+	}
+	return &wl, true
+}
+
+// bindWatchlistSymbols lê e valida a lista de símbolos do corpo da requisição
+func bindWatchlistSymbols(c *gin.Context) (*watchlistRequest, bool) {
+	var req watchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, -1100, "JSON inválido: "+err.Error())
+		return nil, false
+	}
+	symbols, err := normalizeSymbols(req.Symbols)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, -1100, err.Error())
+		return nil, false
+	}
+	if len(symbols) > maxWatchlistSymbols {
+		respondError(c, http.StatusBadRequest, -1100, "Watchlist excede o limite de símbolos")
+		return nil, false
+	}
+	req.Symbols = symbols
+	return &req, true
+}
+
+// ListWatchlists lista as watchlists cadastradas
+// @Summary Listar watchlists
+// @Tags Watchlists
+// @Produce json
+// @Success 200 {array} Watchlist
+// @Router /watchlists [get]
+func (p *ProxyServer) ListWatchlists(c *gin.Context) {
+	if !p.requireStore(c) {
+		return
+	}
+	watchlists := []Watchlist{}
+	err := p.store.ForEach(watchlistBucket, func(_ string, data []byte) error {
+		var wl Watchlist
+		if err := json.Unmarshal(data, &wl); err != nil {
+			return err
+		}
+		watchlists = append(watchlists, wl)
+		return nil
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao listar watchlists: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, watchlists)
+}
+
+// CreateWatchlist cria uma nova watchlist
+// @Summary Criar watchlist
+// @Tags Watchlists
+// @Accept json
+// @Produce json
+// @Success 201 {object} Watchlist
+// @Failure 409 {object} map[string]interface{}
+// @Router /watchlists [post]
+func (p *ProxyServer) CreateWatchlist(c *gin.Context) {
+	if !p.requireStore(c) {
+		return
+	}
+	req, ok := bindWatchlistSymbols(c)
+	if !ok {
+		return
+	}
+	if !watchlistNamePattern.MatchString(req.Name) {
+		respondError(c, http.StatusBadRequest, -1100, "Nome de watchlist inválido (use letras, números, '-' ou '_')")
+		return
+	}
+
+	var existing Watchlist
+	if found, err := p.store.Get(watchlistBucket, req.Name, &existing); err != nil || found {
+		respondError(c, http.StatusConflict, -1000, "Watchlist já existe")
+		return
+	}
+
+	now := time.Now().UTC()
+	wl := Watchlist{Name: req.Name, Symbols: req.Symbols, CreatedAt: now, UpdatedAt: now}
+	if err := p.store.Put(watchlistBucket, wl.Name, wl); err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao salvar watchlist: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, wl)
+}
+
+// GetWatchlist retorna uma watchlist
+// @Summary Obter watchlist
+// @Tags Watchlists
+// @Produce json
+// @Param name path string true "Nome da watchlist"
+// @Success 200 {object} Watchlist
+// @Failure 404 {object} map[string]interface{}
+// @Router /watchlists/{name} [get]
+func (p *ProxyServer) GetWatchlist(c *gin.Context) {
+	wl, ok := p.loadWatchlist(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, wl)
+}
+
+// UpdateWatchlist substitui os símbolos de uma watchlist
+// @Summary Atualizar watchlist
+// @Tags Watchlists
+// @Accept json
+// @Produce json
+// @Param name path string true "Nome da watchlist"
+// @Success 200 {object} Watchlist
+// @Router /watchlists/{name} [put]
+func (p *ProxyServer) UpdateWatchlist(c *gin.Context) {
+	wl, ok := p.loadWatchlist(c)
+	if !ok {
+		return
+	}
+	req, ok := bindWatchlistSymbols(c)
+	if !ok {
+		return
+	}
+
+	wl.Symbols = req.Symbols
+	wl.UpdatedAt = time.Now().UTC()
+	if err := p.store.Put(watchlistBucket, wl.Name, wl); err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao salvar watchlist: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, wl)
+}
+
+// DeleteWatchlist remove uma watchlist
+// @Summary Remover watchlist
+// @Tags Watchlists
+// @Param name path string true "Nome da watchlist"
+// @Success 204
+// @Router /watchlists/{name} [delete]
+func (p *ProxyServer) DeleteWatchlist(c *gin.Context) {
+	if !p.requireStore(c) {
+		return
+	}
+	found, err := p.store.Delete(watchlistBucket, c.Param("name"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao remover watchlist: "+err.Error())
+		return
+	}
+	if !found {
+		respondError(c, http.StatusNotFound, -1000, "Watchlist não encontrada")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// WatchlistPrices retorna os preços atuais dos símbolos da watchlist,
+// servidos a partir do cache de preços (uma única chamada upstream para todos)
+// @Summary Preços da watchlist
+// @Tags Watchlists
+// @Produce json
+// @Param name path string true "Nome da watchlist"
+// @Success 200 {object} map[string]interface{}
+// @Router /watchlists/{name}/prices [get]
+func (p *ProxyServer) WatchlistPrices(c *gin.Context) {
+	wl, ok := p.loadWatchlist(c)
+	if !ok {
+		return
+	}
+
+	prices, err := p.market.Prices(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao obter preços da Binance: "+err.Error())
+		return
+	}
+
+	result := make([]PriceTicker, 0, len(wl.Symbols))
+	missing := []string{}
+	for _, symbol := range wl.Symbols {
+		price, ok := prices[symbol]
+		if !ok {
+			missing = append(missing, symbol)
+			continue
+		}
+		result = append(result, PriceTicker{Symbol: symbol, Price: formatFloat(price)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":    wl.Name,
+		"prices":  result,
+		"missing": missing,
+	})
+}
+
+// WatchlistStream envia atualizações de preço (mini ticker) apenas dos
+// símbolos da watchlist, via WebSocket ou SSE. Todos os clientes compartilham
+// uma única conexão upstream com o stream !miniTicker@arr.
+// @Summary Stream de preços da watchlist
+// @Tags Watchlists
+// @Produce text/event-stream
+// @Param name path string true "Nome da watchlist"
+// @Param filter query string false "Filtro avaliado a cada mensagem (ex: symbol = BTCUSDT or price > 100)"
+// @Param snapshot query bool false "Enviar os tickers atuais antes das atualizações, com seq"
+// @Router /watchlists/{name}/stream [get]
+func (p *ProxyServer) WatchlistStream(c *gin.Context) {
+	withSnapshot, ok := wantsStreamSnapshot(c)
+	if !ok {
+		return
+	}
+	wl, ok := p.loadWatchlist(c)
+	if !ok {
+		return
+	}
+
+	wanted := make(map[string]bool, len(wl.Symbols))
+	for _, symbol := range wl.Symbols {
+		wanted[symbol] = true
+	}
+
+	sub, ok := p.subscribeStreams(c, miniTickerArrStream)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	// O snapshot sai do cache de /ticker/24hr, no formato do mini ticker
+	if withSnapshot {
+		tickers, err := p.market.Tickers24h(c.Request.Context())
+		if err != nil {
+			respondError(c, http.StatusBadGateway, -1000, "Erro ao obter tickers da Binance: "+err.Error())
+			return
+		}
+		snapshot := make([]miniTicker, 0, len(wl.Symbols))
+		for _, symbol := range wl.Symbols {
+			if t, ok := tickers[symbol]; ok {
+				snapshot = append(snapshot, miniTicker{
+					EventType:   "24hrMiniTicker",
+					EventTime:   t.CloseTime,
+					Symbol:      t.Symbol,
+					Close:       t.LastPrice,
+					Open:        t.OpenPrice,
+					High:        t.HighPrice,
+					Low:         t.LowPrice,
+					Volume:      t.Volume,
+					QuoteVolume: t.QuoteVolume,
+				})
+			}
+		}
+		sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Symbol < snapshot[j].Symbol })
+		data, _ := json.Marshal(snapshot)
+		sub.send(StreamMessage{Stream: streamSnapshotEvent, Data: data})
+	}
+
+	p.serveSubscription(c, sub, func(msg StreamMessage) (interface{}, bool) {
+		if msg.Stream == streamSnapshotEvent {
+			return newStreamSnapshot(msg.Data), true
+		}
+		var tickers []miniTicker
+		if err := json.Unmarshal(msg.Data, &tickers); err != nil {
+			return nil, false
+		}
+		filtered := make([]miniTicker, 0, len(wanted))
+		for _, t := range tickers {
+			if wanted[t.Symbol] {
+				filtered = append(filtered, t)
+			}
+		}
+		if len(filtered) == 0 {
+			return nil, false
+		}
+		sort.Slice(filtered, func(i, j int) bool { return filtered[i].Symbol < filtered[j].Symbol })
+		if withSnapshot {
+			return newStreamUpdate(filtered), true
+		}
+		return filtered, true
+	})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	withdrawPath          = "/sapi/v1/capital/withdraw/apply"
+	withdrawConfirmHeader = "X-Withdraw-Confirm"
+	withdrawAuditBucket   = "withdraw_audit"
+)
+
+var errWithdrawBlocked = errors.New("saque bloqueado pelo proxy")
+
+// withdrawConfirmedKey marca no contexto um saque que passou pelo
+// WithdrawGuard; sem a marca, o transporte recusa a chamada
+type withdrawConfirmedKey struct{}
+
+// withdrawSeq desempata chaves de auditoria gravadas no mesmo instante
+var withdrawSeq atomic.Uint64
+
+// WithdrawAuditEntry é uma tentativa de saque na trilha de auditoria
+type WithdrawAuditEntry struct {
+	Time     time.Time `json:"time"`
+	Consumer string    `json:"consumer"`
+	ClientIP string    `json:"clientIp,omitempty"`
+	Path     string    `json:"path"`
+	Coin     string    `json:"coin,omitempty"`
+	Amount   string    `json:"amount,omitempty"`
+	Address  string    `json:"address,omitempty"`
+	Network  string    `json:"network,omitempty"`
+	// denied (recusado pelo guard), blocked (chamada interna recusada pelo
+	// transporte), pending (repassado, aguardando a Binance) ou forwarded
+	Outcome string `json:"outcome"`
+	Status  int    `json:"status,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+
+	key string
+}
+
+// isWithdrawPath reconhece o endpoint de saque com qualquer prefixo
+// (/sapi/..., /binance/sapi/..., /api/v3/sapi/...), também com segmentos
+// . e .. ou barras repetidas no caminho
+func isWithdrawPath(urlPath string) bool {
+	return strings.HasSuffix(path.Clean("/"+urlPath), withdrawPath)
+}
+
+// withdrawConfirmation é o valor esperado em X-Withdraw-Confirm:
+// moeda:quantidade:endereço, repetindo os parâmetros do saque
+func withdrawConfirmation(params url.Values) string {
+	return params.Get("coin") + ":" + params.Get("amount") + ":" + params.Get("address")
+}
+
+// auditWithdraw grava (ou atualiza) a entrada na trilha de auditoria
+func (p *ProxyServer) auditWithdraw(entry *WithdrawAuditEntry) error {
+	if p.store == nil {
+		return errors.New("armazenamento local indisponível")
+	}
+	if entry.key == "" {
+		entry.key = fmt.Sprintf("%020d-%06d", entry.Time.UnixNano(), withdrawSeq.Add(1)%1000000)
+	}
+	return p.store.Put(withdrawAuditBucket, entry.key, entry)
+}
+
+// WithdrawGuard protege o endpoint de saque: desligado por padrão
+// (WITHDRAW_ENABLED), exige X-Withdraw-Confirm repetindo moeda, quantidade
+// e endereço e grava toda tentativa na auditoria antes de repassá-la. Sem
+// auditoria gravada, o saque é recusado.
+func (p *ProxyServer) WithdrawGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isWithdrawPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		// Parâmetros na query ou no corpo (form), que continua disponível para o repasse
+		body, err := readBody(c)
+		if err != nil {
+			respondBodyError(c, err)
+			return
+		}
+		params := bodyParams(c.Request, body)
+
+		entry := &WithdrawAuditEntry{
+			Time:     time.Now(),
+			Consumer: p.consumerName(c.Request),
+			ClientIP: c.ClientIP(),
+			Path:     c.Request.URL.Path,
+			Coin:     params.Get("coin"),
+			Amount:   params.Get("amount"),
+			Address:  params.Get("address"),
+			Network:  params.Get("network"),
+			Outcome:  "pending",
+		}
+		switch {
+		case !p.withdrawals:
+			entry.Outcome, entry.Detail = "denied", "saques desabilitados (WITHDRAW_ENABLED)"
+		case c.GetHeader(withdrawConfirmHeader) != withdrawConfirmation(params):
+			entry.Outcome, entry.Detail = "denied", withdrawConfirmHeader+" ausente ou diferente de moeda:quantidade:endereço"
+		}
+		if err := p.auditWithdraw(entry); err != nil {
+			// log.Printf("[ERROR] Erro ao gravar auditoria de saque: %v", err)
+			respondError(c, http.StatusServiceUnavailable, -1000, "Saque recusado: auditoria indisponível ("+err.Error()+")")
+			c.Abort()
+			return
+		}
+		if entry.Outcome == "denied" {
+			// log.Printf("[WARN] Saque recusado para %s: %s", entry.Consumer, entry.Detail)
+			respondError(c, http.StatusForbidden, -1002, "Saque recusado: "+entry.Detail)
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), withdrawConfirmedKey{}, true))
+		c.Next()
+
+		entry.Outcome, entry.Status = "forwarded", c.Writer.Status()
+		if err := p.auditWithdraw(entry); err != nil {
+			// log.Printf("[ERROR] Erro ao atualizar auditoria de saque: %v", err)
+		}
+	}
+}
+
+// withdrawTransport recusa chamadas de saque que não passaram pelo
+// WithdrawGuard (jobs, JSON-RPC e outros caminhos internos), registrando-as
+// na auditoria
+type withdrawTransport struct {
+	base  http.RoundTripper
+	proxy *ProxyServer
+}
+
+func (t *withdrawTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isWithdrawPath(req.URL.Path) && req.Context().Value(withdrawConfirmedKey{}) == nil {
+		query := req.URL.Query()
+		t.proxy.auditWithdraw(&WithdrawAuditEntry{
+			Time:     time.Now(),
+			Consumer: consumerFrom(req.Context()),
+			Path:     req.URL.Path,
+			Coin:     query.Get("coin"),
+			Amount:   query.Get("amount"),
+			Address:  query.Get("address"),
+			Network:  query.Get("network"),
+			Outcome:  "blocked",
+			Detail:   "chamada sem confirmação pelo endpoint de saque",
+		})
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, errWithdrawBlocked
+	}
+	return t.base.RoundTrip(req)
+}
+
+// WithdrawAudit lista a trilha de auditoria de saques
+// @Summary Auditoria de saques
+// @Description Todas as tentativas de saque (/sapi/v1/capital/withdraw/apply), repassadas ou recusadas, em ordem cronológica
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "Token admin"
+// @Success 200 {array} WithdrawAuditEntry
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/withdrawals [get]
+func (p *ProxyServer) WithdrawAudit(c *gin.Context) {
+	if p.store == nil {
+		respondError(c, http.StatusServiceUnavailable, -1000, "Armazenamento local indisponível")
+		return
+	}
+	entries := []WithdrawAuditEntry{}
+	err := p.store.ForEach(withdrawAuditBucket, func(_ string, data []byte) error {
+		var entry WithdrawAuditEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, -1000, "Erro ao ler auditoria: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
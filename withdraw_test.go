@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newWithdrawTestProxy monta o roteador completo apontado para um upstream
+// falso, com o withdrawTransport instalado como em main e uma URL base
+// alternativa permitida
+func newWithdrawTestProxy(t *testing.T) (*ProxyServer, *gin.Engine, *atomic.Int64) {
+	t.Helper()
+	var hits atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"w-1"}`))
+	}))
+	t.Cleanup(upstream.Close)
+	t.Setenv("EXCHANGES", "binance")
+	t.Setenv("EXCHANGE_BINANCE_URL", upstream.URL)
+
+	file := filepath.Join(t.TempDir(), "tenants.yaml")
+	config := `tenants:
+  - name: desk
+    token: desk-token
+    api_key: KEY
+    secret_key: SECRET
+`
+	if err := os.WriteFile(file, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := LoadTenants(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	p := NewProxyServer()
+	p.binanceURL = upstream.URL + "/api/v3"
+	p.client = newUpstreamClient(p, nil)
+	p.client.Transport = &withdrawTransport{base: p.client.Transport, proxy: p}
+	p.tenants = tenants
+	p.store = store
+	p.upstreams = map[string]bool{upstream.URL + "/alt": true}
+	return p, setupRouter(p), &hits
+}
+
+func withdrawAudit(t *testing.T, p *ProxyServer) []WithdrawAuditEntry {
+	t.Helper()
+	var entries []WithdrawAuditEntry
+	err := p.store.ForEach(withdrawAuditBucket, func(_ string, data []byte) error {
+		var entry WithdrawAuditEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+const withdrawQuery = "coin=USDT&amount=100&address=TXabc&network=TRX"
+
+func TestWithdrawBlockedOnEveryRoute(t *testing.T) {
+	routes := []struct {
+		name   string
+		target string
+		header map[string]string
+		form   bool
+	}{
+		{"raiz assinada pelo cliente", withdrawPath + "?" + withdrawQuery + "&timestamp=1&signature=x", map[string]string{"X-MBX-APIKEY": "KEY"}, false},
+		{"raiz com barra final", withdrawPath + "/?" + withdrawQuery + "&timestamp=1&signature=x", map[string]string{"X-MBX-APIKEY": "KEY"}, false},
+		{"raiz assinada pelo proxy", "/api" + withdrawPath + "?" + withdrawQuery, map[string]string{"X-Proxy-Token": "desk-token"}, false},
+		{"raiz com corpo form", withdrawPath, map[string]string{"X-MBX-APIKEY": "KEY"}, true},
+		{"URL base alternativa", withdrawPath + "?" + withdrawQuery + "&timestamp=1&signature=x&" + upstreamBaseParam + "=ALT", map[string]string{"X-MBX-APIKEY": "KEY"}, false},
+		{"URL base alternativa assinada pelo proxy", "/api" + withdrawPath + "?" + withdrawQuery + "&" + upstreamBaseParam + "=ALT", map[string]string{"X-Proxy-Token": "desk-token"}, false},
+		{"raiz com segmentos ..", withdrawPath + "/x/..?" + withdrawQuery + "&timestamp=1&signature=x", map[string]string{"X-MBX-APIKEY": "KEY"}, false},
+		{"multi-corretora", "/binance" + withdrawPath + "?" + withdrawQuery + "&timestamp=1&signature=x", map[string]string{"X-MBX-APIKEY": "KEY"}, false},
+	}
+	for _, enabled := range []bool{false, true} {
+		for _, route := range routes {
+			name := route.name
+			if enabled {
+				name += " sem confirmação"
+			}
+			t.Run(name, func(t *testing.T) {
+				p, router, hits := newWithdrawTestProxy(t)
+				p.withdrawals = enabled
+				alt := url.QueryEscape(p.binanceURL[:len(p.binanceURL)-len("/api/v3")] + "/alt")
+				target := strings.Replace(route.target, "=ALT", "="+alt, 1)
+
+				var req *http.Request
+				if route.form {
+					req = httptest.NewRequest(http.MethodPost, target, strings.NewReader(withdrawQuery+"&timestamp=1&signature=x"))
+					req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				} else {
+					req = httptest.NewRequest(http.MethodPost, target, nil)
+				}
+				for key, value := range route.header {
+					req.Header.Set(key, value)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				if w.Code != http.StatusForbidden {
+					t.Fatalf("status %d, esperado 403 (%s)", w.Code, w.Body)
+				}
+				if hits.Load() != 0 {
+					t.Fatalf("saque chegou ao upstream")
+				}
+				entries := withdrawAudit(t, p)
+				if len(entries) != 1 || entries[0].Outcome != "denied" || entries[0].Coin != "USDT" || entries[0].Address != "TXabc" {
+					t.Fatalf("auditoria = %+v, esperada uma tentativa denied", entries)
+				}
+			})
+		}
+	}
+}
+
+func TestWithdrawForwardedWithConfirmation(t *testing.T) {
+	p, router, hits := newWithdrawTestProxy(t)
+	p.withdrawals = true
+
+	req := httptest.NewRequest(http.MethodPost, withdrawPath+"?"+withdrawQuery+"&timestamp=1&signature=x", nil)
+	req.Header.Set("X-MBX-APIKEY", "KEY")
+	req.Header.Set(withdrawConfirmHeader, "USDT:100:TXabc")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || hits.Load() != 1 {
+		t.Fatalf("saque confirmado: status %d, %d chamadas ao upstream (%s)", w.Code, hits.Load(), w.Body)
+	}
+	entries := withdrawAudit(t, p)
+	if len(entries) != 1 || entries[0].Outcome != "forwarded" || entries[0].Status != http.StatusOK {
+		t.Fatalf("auditoria = %+v, esperada uma tentativa forwarded", entries)
+	}
+}
+
+// O withdrawTransport é a última barreira: chamadas internas (jobs,
+// JSON-RPC, scripts) não passam pelo WithdrawGuard e são recusadas mesmo
+// com os saques habilitados
+func TestWithdrawTransportBlocksInternalCalls(t *testing.T) {
+	p, _, hits := newWithdrawTestProxy(t)
+	p.withdrawals = true
+	params := url.Values{"coin": {"USDT"}, "amount": {"100"}, "address": {"TXabc"}}
+
+	_, err := p.signedRequest(context.Background(), p.tenants.ByName("desk"), http.MethodPost, withdrawPath, params)
+	if !errors.Is(err, errWithdrawBlocked) {
+		t.Fatalf("signedRequest: %v, esperado errWithdrawBlocked", err)
+	}
+
+	alt := p.binanceURL[:len(p.binanceURL)-len("/api/v3")] + "/alt"
+	req, _ := http.NewRequest(http.MethodPost, alt+withdrawPath+"?"+params.Encode(), nil)
+	if _, err := p.client.Do(req); !errors.Is(err, errWithdrawBlocked) {
+		t.Fatalf("URL base alternativa: %v, esperado errWithdrawBlocked", err)
+	}
+
+	if hits.Load() != 0 {
+		t.Fatalf("saque interno chegou ao upstream")
+	}
+	entries := withdrawAudit(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("auditoria = %+v, esperadas duas tentativas blocked", entries)
+	}
+	for _, entry := range entries {
+		if entry.Outcome != "blocked" || entry.Coin != "USDT" {
+			t.Fatalf("auditoria = %+v, esperado blocked", entry)
+		}
+	}
+}
+
+func TestIsWithdrawPath(t *testing.T) {
+	for path, want := range map[string]bool{
+		withdrawPath:                        true,
+		withdrawPath + "/":                  true,
+		"/binance" + withdrawPath:           true,
+		"/api/v3" + withdrawPath:            true,
+		withdrawPath + "/.":                 true,
+		withdrawPath + "/x/..":              true,
+		"/sapi//v1/capital/withdraw/apply":  true,
+		"/sapi/v1/capital/withdraw":         false,
+		"/sapi/v1/capital/withdraw/history": false,
+	} {
+		if got := isWithdrawPath(path); got != want {
+			t.Errorf("isWithdrawPath(%q) = %v, esperado %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const binanceWSAPIURL = "wss://ws-api.binance.com:443/ws-api/v3"
+
+// wsAPISignedMethods são os métodos da WebSocket API que exigem assinatura
+// (SIGNED / USER_DATA)
+var wsAPISignedMethods = map[string]bool{
+	"account.status":            true,
+	"account.rateLimits.orders": true,
+	"account.commission":        true,
+	"order.place":               true,
+	"order.test":                true,
+	"order.status":              true,
+	"order.cancel":              true,
+	"order.cancelReplace":       true,
+	"order.amend.keepPriority":  true,
+	"openOrders.status":         true,
+	"openOrders.cancelAll":      true,
+	"orderList.place":           true,
+	"orderList.place.oco":       true,
+	"orderList.place.oto":       true,
+	"orderList.place.otoco":     true,
+	"orderList.status":          true,
+	"orderList.cancel":          true,
+	"openOrderLists.status":     true,
+	"allOrders":                 true,
+	"allOrderLists":             true,
+	"myTrades":                  true,
+	"myPreventedMatches":        true,
+	"myAllocations":             true,
+	"sor.order.place":           true,
+	"sor.order.test":            true,
+}
+
+// wsAPIKeyMethods exigem apenas a API key (USER_STREAM)
+var wsAPIKeyMethods = map[string]bool{
+	"userDataStream.start": true,
+	"userDataStream.ping":  true,
+	"userDataStream.stop":  true,
+}
+
+type wsAPIRequest struct {
+	ID     json.RawMessage            `json:"id"`
+	Method string                     `json:"method"`
+	Params map[string]json.RawMessage `json:"params,omitempty"`
+}
+
+// wsAPIConn serializa as escritas na conexão do cliente, feitas tanto pelo
+// repasse das respostas da Binance quanto pelos erros gerados localmente
+type wsAPIConn struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (w *wsAPIConn) write(messageType int, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return w.conn.WriteMessage(messageType, data)
+}
+
+// wsAPIError responde no formato de erro da WebSocket API
+func (w *wsAPIConn) wsAPIError(id json.RawMessage, status, code int, msg string) error {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"id":     id,
+		"status": status,
+		"error":  map[string]interface{}{"code": code, "msg": redactSecrets(msg)},
+	})
+	return w.write(websocket.TextMessage, data)
+}
+
+// signWSAPIParams injeta apiKey, timestamp e assinatura nos parâmetros. A
+// assinatura cobre todos os parâmetros ordenados por nome, no formato
+// nome=valor separados por &.
+func signWSAPIParams(tenant *Tenant, params map[string]json.RawMessage, sign bool) {
+	params["apiKey"], _ = json.Marshal(tenant.APIKey)
+	if !sign {
+		return
+	}
+	if _, ok := params["timestamp"]; !ok {
+		params["timestamp"] = json.RawMessage(strconv.FormatInt(time.Now().UnixMilli(), 10))
+	}
+	if _, ok := params["recvWindow"]; !ok {
+		params["recvWindow"] = json.RawMessage(strconv.Itoa(defaultRecvWindow))
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := string(params[key])
+		var s string
+		if err := json.Unmarshal(params[key], &s); err == nil {
+			value = s
+		}
+		parts = append(parts, key+"="+value)
+	}
+	params["signature"], _ = json.Marshal(tenant.sign(strings.Join(parts, "&")))
+}
+
+// WSAPI faz a ponte entre o cliente e a WebSocket API da Binance
+// @Summary Proxy da WebSocket API
+// @Description Abre uma conexão com a WebSocket API da Binance (ws-api) por cliente. Com token de tenant, requisições de métodos assinados sem signature recebem apiKey, timestamp e signature do tenant; as respostas são repassadas sem alteração.
+// @Tags Proxy
+// @Success 101 {string} string "Switching Protocols"
+// @Failure 401 {object} map[string]interface{}
+// @Failure 502 {object} map[string]interface{}
+// @Router /ws-api [get]
+func (p *ProxyServer) WSAPI(c *gin.Context) {
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		respondError(c, http.StatusBadRequest, -1100, "Use uma conexão WebSocket")
+		return
+	}
+	tenant := p.requestTenant(c.Request)
+	if tenant == nil && tenantToken(c.Request) != "" {
+		respondError(c, http.StatusUnauthorized, -2015, "Token de tenant inválido ou ausente")
+		return
+	}
+
+	upstream, _, err := p.hub.dialer.DialContext(c.Request.Context(), p.wsAPIURL, nil)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, -1000, "Erro ao conectar com a WebSocket API da Binance: "+err.Error())
+		return
+	}
+	defer upstream.Close()
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	client := &wsAPIConn{conn: conn}
+	// log.Printf("[WS-API] Cliente conectado (tenant: %v)", tenant != nil)
+
+	// Os pings e pongs ficam em cada ponta: o proxy responde aos da Binance e
+	// manda os seus ao cliente, e qualquer lado mudo encerra a sessão
+	done := make(chan struct{})
+	upstreamAlive := wsKeepAlive(upstream, p.hub.heartbeat.UpstreamPing, p.hub.heartbeat.UpstreamTimeout, done)
+	clientAlive := wsKeepAlive(conn, p.hub.heartbeat.ClientPing, p.hub.heartbeat.ClientTimeout, done)
+
+	// Binance -> cliente: respostas repassadas sem alteração
+	go func() {
+		defer close(done)
+		defer conn.Close()
+		for {
+			messageType, data, err := upstream.ReadMessage()
+			if err != nil {
+				return
+			}
+			upstreamAlive()
+			if err := client.write(messageType, data); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Cliente -> Binance: assina as requisições quando há tenant
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		clientAlive()
+		if messageType == websocket.TextMessage {
+			var req wsAPIRequest
+			if err := json.Unmarshal(data, &req); err != nil {
+				client.wsAPIError(nil, http.StatusBadRequest, -1100, "JSON inválido: "+err.Error())
+				continue
+			}
+			signed, keyOnly := wsAPISignedMethods[req.Method], wsAPIKeyMethods[req.Method]
+			if signed || keyOnly {
+				if req.Params == nil {
+					req.Params = map[string]json.RawMessage{}
+				}
+				_, hasSignature := req.Params["signature"]
+				_, hasAPIKey := req.Params["apiKey"]
+				if !hasSignature && !(keyOnly && hasAPIKey) {
+					if tenant == nil {
+						client.wsAPIError(req.ID, http.StatusUnauthorized, -2015, "Token de tenant inválido ou ausente")
+						continue
+					}
+					if err := tenant.Policy.Allow("", req.Method, wsAPISymbols(req.Params)); err != nil {
+						client.wsAPIError(req.ID, http.StatusForbidden, -1002, err.Error())
+						continue
+					}
+					signWSAPIParams(tenant, req.Params, signed)
+					if data, err = json.Marshal(req); err != nil {
+						client.wsAPIError(req.ID, http.StatusInternalServerError, -1000, err.Error())
+						continue
+					}
+				}
+			}
+		}
+		upstream.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := upstream.WriteMessage(messageType, data); err != nil {
+			break
+		}
+	}
+	upstream.Close()
+	<-done
+}